@@ -0,0 +1,68 @@
+// Package assistants remembers which backend holds each assistant, thread
+// and vector store the router has seen created, so later requests naming them
+// go back to the provider that has them.
+package assistants
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxRemembered bounds how many objects are remembered; the oldest go first
+const maxRemembered = 100000
+
+// idPattern finds the IDs of assistants, threads and vector stores in a
+// response, including streamed run events
+var idPattern = regexp.MustCompile(`"(?:id|assistant_id|thread_id|vector_store_id)"\s*:\s*"((?:asst|thread|vs)_[A-Za-z0-9]+)"`)
+
+// IsObjectID reports whether s looks like the ID of an assistant, a thread or
+// a vector store
+func IsObjectID(s string) bool {
+	return strings.HasPrefix(s, "asst_") || strings.HasPrefix(s, "thread_") || strings.HasPrefix(s, "vs_")
+}
+
+// Routes maps object IDs to the backends holding them
+type Routes struct {
+	mu       sync.Mutex
+	backends map[string]string
+	order    []string
+}
+
+// New returns an empty set of routes
+func New() *Routes {
+	return &Routes{backends: make(map[string]string)}
+}
+
+// Backend returns the backend holding an object, if it is known
+func (r *Routes) Backend(id string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backend, ok := r.backends[id]
+	return backend, ok
+}
+
+// Learn remembers that backend holds the objects named in a response body
+func (r *Routes) Learn(backend string, body []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, match := range idPattern.FindAllSubmatch(body, -1) {
+		id := string(match[1])
+		if _, ok := r.backends[id]; !ok {
+			r.order = append(r.order, id)
+		}
+		r.backends[id] = backend
+	}
+	if over := len(r.order) - maxRemembered; over > 0 {
+		for _, id := range r.order[:over] {
+			delete(r.backends, id)
+		}
+		r.order = r.order[over:]
+	}
+}
@@ -0,0 +1,32 @@
+package assistants
+
+import "testing"
+
+func TestLearnFindsObjectIDs(t *testing.T) {
+	r := New()
+	r.Learn("azure", []byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_abc","assistant_id":"asst_x"}`))
+	r.Learn("openai", []byte("event: thread.created\ndata: {\"id\": \"thread_def\"}\n\n"))
+
+	for id, want := range map[string]string{"thread_abc": "azure", "asst_x": "azure", "thread_def": "openai"} {
+		if got, ok := r.Backend(id); !ok || got != want {
+			t.Errorf("Expected %s on %s, got %q", id, want, got)
+		}
+	}
+	if _, ok := r.Backend("run_1"); ok {
+		t.Errorf("Expected runs not to be remembered")
+	}
+
+	var missing *Routes
+	missing.Learn("azure", []byte(`{"id":"asst_y"}`))
+	if _, ok := missing.Backend("asst_y"); ok {
+		t.Errorf("Expected nil routes to remember nothing")
+	}
+}
+
+func TestIsObjectID(t *testing.T) {
+	for id, want := range map[string]bool{"asst_1": true, "thread_1": true, "vs_1": true, "runs": false, "file-1": false} {
+		if IsObjectID(id) != want {
+			t.Errorf("IsObjectID(%q) = %v", id, !want)
+		}
+	}
+}
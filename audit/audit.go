@@ -0,0 +1,415 @@
+// Package audit keeps a persistent log of the requests the router serves:
+// who sent them, which model and backend answered, the status, latency and
+// token usage, and optionally the bodies. Entries are appended to a JSON Lines
+// file that outlives the terminal's scrollback and can be queried with the
+// llm-router logs command. The file is rotated at midnight UTC, so queries for
+// recent requests read only the days they cover.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/migrate"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// Schema is the format history of the log. Add a migration whenever the
+// format of entries changes; it must rewrite the rotated days as well.
+var Schema = migrate.Schema{Name: "audit log"}
+
+// Entry is one audited request
+type Entry struct {
+	Time    time.Time `json:"time"`
+	ID      string    `json:"id"`
+	KeyID   string    `json:"key_id"`
+	KeyName string    `json:"key_name,omitempty"`
+	Model   string    `json:"model"`
+	Backend string    `json:"backend,omitempty"`
+	Path    string    `json:"path"`
+	// RequestHash is the canonical hash of the request body, as /router/hash
+	// computes it, empty for bodies that are not JSON
+	RequestHash      string `json:"request_hash,omitempty"`
+	Status           int    `json:"status"`
+	DurationMS       int64  `json:"duration_ms"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	TotalTokens      int    `json:"total_tokens,omitempty"`
+	// CostUSD is the estimated cost of the request from its token usage and
+	// the model's price, if one is configured
+	CostUSD  float64         `json:"cost_usd,omitempty"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// Estimated is set when the backend reported no usage and the prompt
+	// tokens were counted by the router
+	Estimated bool `json:"estimated,omitempty"`
+	// Outcome is set when the request ended without a complete answer, such
+	// as client_cancelled
+	Outcome string `json:"outcome,omitempty"`
+	// Method, Job and Files record what a fine-tuning request did: the job it
+	// created or changed and the files it trained on
+	Method string   `json:"method,omitempty"`
+	Job    string   `json:"job,omitempty"`
+	Files  []string `json:"files,omitempty"`
+}
+
+// Query selects entries. Zero fields match everything.
+type Query struct {
+	// ID selects the entries of one request
+	ID      string
+	Since   time.Time
+	Until   time.Time
+	KeyID   string
+	Model   string
+	Backend string
+	// Limit keeps only the most recent matches
+	Limit int
+}
+
+// dayFormat names the day of a rotated file
+const dayFormat = "2006-01-02"
+
+// Log appends entries to a file
+type Log struct {
+	path   string
+	bodies bool
+
+	mu   sync.Mutex
+	file *os.File
+	// day is the UTC day the file at path holds the entries of
+	day string
+	// now is the clock rotation follows
+	now func() time.Time
+}
+
+// Open opens or creates the audit log at path. Bodies are only kept if bodies is set.
+func Open(path string, bodies bool) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{path: path, bodies: bodies, file: file, now: time.Now}
+	l.day = l.now().UTC().Format(dayFormat)
+	// A file left by an earlier day is rotated before the first entry of today
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		l.day = info.ModTime().UTC().Format(dayFormat)
+	}
+	return l, nil
+}
+
+// Bodies reports whether request and response bodies are kept
+func (l *Log) Bodies() bool {
+	return l.bodies
+}
+
+// Record appends an entry
+func (l *Log) Record(e Entry) error {
+	if !l.bodies {
+		e.Request, e.Response = nil, nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var rotateErr error
+	if today := l.now().UTC().Format(dayFormat); today != l.day {
+		if rotateErr = l.rotate(); rotateErr != nil {
+			rotateErr = fmt.Errorf("rotating %s: %w", l.path, rotateErr)
+		}
+		l.day = today
+	}
+	_, err = l.file.Write(append(line, '\n'))
+	return errors.Join(rotateErr, err)
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// rotate moves the entries of the day to the file named after it and starts
+// a new file at path. A day rotated already, by a run that was restarted,
+// gets the entries appended. If they cannot be moved, the file at path is
+// kept and written on.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	dayPath := segmentPath(l.path, l.day)
+	var moved error
+	if _, err := os.Stat(dayPath); errors.Is(err, os.ErrNotExist) {
+		moved = os.Rename(l.path, dayPath)
+	} else {
+		moved = appendFile(dayPath, l.path)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if moved == nil {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(l.path, flags, 0600)
+	if err != nil {
+		return errors.Join(moved, err)
+	}
+	l.file = file
+	return moved
+}
+
+// appendFile appends the content of the file at src to the file at dst
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// segmentPath is where the entries of a rotated day are kept: audit.jsonl
+// becomes audit.2024-05-01.jsonl
+func segmentPath(path, day string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + day + ext
+}
+
+// segment is a file of the log and the UTC day it starts, zero for the file
+// being written
+type segment struct {
+	path string
+	day  time.Time
+}
+
+// segments returns the files of the log at path, newest first: the file being
+// written, then the rotated days
+func segments(path string) ([]segment, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "."
+	dir, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	var days []segment
+	for _, entry := range dir {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		day, err := time.Parse(dayFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err == nil {
+			days = append(days, segment{path: filepath.Join(filepath.Dir(path), name), day: day})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].day.After(days[j].day) })
+
+	var files []segment
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, segment{path: path})
+	} else if !errors.Is(err, os.ErrNotExist) || len(days) == 0 {
+		return nil, err
+	}
+	return append(files, days...), nil
+}
+
+// Read returns the entries in the log at path matching q, oldest first. Days
+// rotated before q.Since are not read, and neither are older days once q.Limit
+// entries are found.
+func Read(path string, q Query) ([]Entry, error) {
+	files, err := segments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		// A day's file holds the entries written that day, which began no later
+		if !file.day.IsZero() && !q.Since.IsZero() && !file.day.AddDate(0, 0, 1).After(q.Since) {
+			break
+		}
+		found, err := readFile(file.path, q)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(found, entries...)
+		if q.Limit > 0 && len(entries) >= q.Limit {
+			break
+		}
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
+
+// readFile returns the entries in one file of the log matching q, oldest first
+func readFile(path string, q Query) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotated away since the files were listed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 1 {
+			var e Entry
+			if json.Unmarshal(line, &e) == nil && q.Match(e) {
+				entries = append(entries, e)
+				if q.Limit > 0 && len(entries) > 2*q.Limit {
+					entries = append(entries[:0], entries[len(entries)-q.Limit:]...)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Match reports whether e passes the query. A model matches with or without
+// its backend prefix.
+func (q Query) Match(e Entry) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	if q.ID != "" && e.ID != q.ID {
+		return false
+	}
+	if q.KeyID != "" && e.KeyID != q.KeyID {
+		return false
+	}
+	if q.Backend != "" && e.Backend != q.Backend {
+		return false
+	}
+	if q.Model != "" && e.Model != q.Model && !strings.HasSuffix(e.Model, "/"+q.Model) {
+		return false
+	}
+	return true
+}
+
+// ParseTime parses an absolute time (RFC 3339 or a date), a duration such as
+// 24h or 7d, meaning that long before now, or the start of a calendar period:
+// today, yesterday, month or last-month. Dates and periods are in the location
+// of now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch s {
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	case "month":
+		return midnight.AddDate(0, 0, 1-now.Day()), nil
+	case "last-month":
+		return midnight.AddDate(0, -1, 1-now.Day()), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a duration such as 24h or 7d, a date, an RFC 3339 time, today, yesterday, month or last-month", s)
+}
+
+// ErrNoUsage is returned by Usage when a response reports no token usage
+var ErrNoUsage = errors.New("no usage reported")
+
+// Usage extracts the token usage a backend reported in a response body, either
+// JSON or a server-sent event stream. Both the chat completions and responses
+// API field names are understood.
+func Usage(body []byte) (prompt, completion, total int, err error) {
+	var found bool
+	parse := func(data []byte) {
+		var payload struct {
+			Usage    *usage `json:"usage"`
+			Response struct {
+				Usage *usage `json:"usage"`
+			} `json:"response"`
+		}
+		if json.Unmarshal(data, &payload) != nil {
+			return
+		}
+		u := payload.Usage
+		if u == nil {
+			u = payload.Response.Usage
+		}
+		if u == nil {
+			return
+		}
+		prompt, completion, total = u.PromptTokens+u.InputTokens, u.CompletionTokens+u.OutputTokens, u.TotalTokens
+		if total == 0 {
+			total = prompt + completion
+		}
+		found = true
+	}
+
+	if json.Valid(body) {
+		parse(body)
+	} else {
+		// Streams report usage in one of the last events; keep the last one seen
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			data, ok := utils.SSEData(line)
+			if ok && bytes.Contains(data, []byte(`"usage"`)) {
+				parse(data)
+			}
+		}
+	}
+	if !found {
+		return 0, 0, 0, ErrNoUsage
+	}
+	return prompt, completion, total, nil
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadFiltersAndLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	log, err := Open(path, true)
+	if err != nil {
+		t.Fatalf("Failed to open log: %s", err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, m := range []string{"openai/gpt-4o", "ollama/llama3", "openai/gpt-4o", "openai/gpt-4o"} {
+		e := Entry{Time: start.Add(time.Duration(i) * time.Hour), ID: string(rune('a' + i)), KeyID: "k1", Model: m, Request: []byte(`{}`)}
+		if i == 3 {
+			e.KeyID = "k2"
+		}
+		if err := log.Record(e); err != nil {
+			t.Fatalf("Failed to record: %s", err)
+		}
+	}
+	log.Close()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"all", Query{}, "abcd"},
+		{"model without prefix", Query{Model: "gpt-4o"}, "acd"},
+		{"key", Query{KeyID: "k2"}, "d"},
+		{"time range", Query{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)}, "bc"},
+		{"most recent", Query{Limit: 2}, "cd"},
+	}
+	for _, tt := range tests {
+		entries, err := Read(path, tt.query)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		got := ""
+		for _, e := range entries {
+			got += e.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBodiesAreOptional(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, _ := Open(path, false)
+	log.Record(Entry{ID: "a", Request: []byte(`{"secret":true}`), Response: []byte(`{}`)})
+	log.Close()
+
+	entries, _ := Read(path, Query{})
+	if len(entries) != 1 || entries[0].Request != nil || entries[0].Response != nil {
+		t.Errorf("Expected bodies to be dropped, got %+v", entries)
+	}
+}
+
+func TestLogRotatesDaily(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	log.day = day.Format(dayFormat)
+	for i, id := range []string{"a", "b", "c"} {
+		now := day.Add(time.Duration(i) * time.Hour)
+		log.now = func() time.Time { return now }
+		if err := log.Record(Entry{Time: now, ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.Close()
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "audit.2024-05-01.jsonl")); err != nil {
+		t.Errorf("Expected the first day in its own file: %s", err)
+	}
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"all", Query{}, "abc"},
+		{"since the second day", Query{Since: day.Add(time.Hour)}, "bc"},
+		{"most recent", Query{Limit: 2}, "bc"},
+		{"across days", Query{Limit: 3}, "abc"},
+	}
+	for _, tt := range tests {
+		entries, err := Read(path, tt.query)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		got := ""
+		for _, e := range entries {
+			got += e.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Days before the query are not read at all
+	os.Remove(filepath.Join(filepath.Dir(path), "audit.2024-05-01.jsonl"))
+	os.Mkdir(filepath.Join(filepath.Dir(path), "audit.2024-05-01.jsonl"), 0755)
+	if _, err := Read(path, Query{Since: day.Add(time.Hour)}); err != nil {
+		t.Errorf("Expected the first day to be skipped, got %s", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		name                      string
+		body                      string
+		prompt, completion, total int
+	}{
+		{"chat completions", `{"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, 10, 5, 15},
+		{"responses", `{"usage":{"input_tokens":7,"output_tokens":3}}`, 7, 3, 10},
+		{"chat stream", "data: {\"choices\":[],\"usage\":null}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":2,\"total_tokens\":6}}\n\ndata: [DONE]\n\n", 4, 2, 6},
+		{"responses stream", "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":8,\"output_tokens\":1,\"total_tokens\":9}}}\n\n", 8, 1, 9},
+	}
+	for _, tt := range tests {
+		prompt, completion, total, err := Usage([]byte(tt.body))
+		if err != nil || prompt != tt.prompt || completion != tt.completion || total != tt.total {
+			t.Errorf("%s: got %d/%d/%d %v", tt.name, prompt, completion, total, err)
+		}
+	}
+	if _, _, _, err := Usage([]byte(`{"choices":[]}`)); err != ErrNoUsage {
+		t.Errorf("Expected ErrNoUsage, got %v", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	if got, _ := ParseTime("2h", now); !got.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("Unexpected time for duration: %s", got)
+	}
+	if got, _ := ParseTime("7d", now); !got.Equal(now.AddDate(0, 0, -7)) {
+		t.Errorf("Unexpected time for days: %s", got)
+	}
+	if got, _ := ParseTime("2024-05-01", now); !got.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected time for date: %s", got)
+	}
+	if _, err := ParseTime("someday", now); err == nil {
+		t.Errorf("Expected an error for an invalid time")
+	}
+
+	// Calendar periods start at midnight where now is, not in UTC
+	tokyo := time.FixedZone("JST", 9*60*60)
+	local := time.Date(2024, 3, 1, 1, 30, 0, 0, tokyo)
+	periods := map[string]time.Time{
+		"today":      time.Date(2024, 3, 1, 0, 0, 0, 0, tokyo),
+		"yesterday":  time.Date(2024, 2, 29, 0, 0, 0, 0, tokyo),
+		"month":      time.Date(2024, 3, 1, 0, 0, 0, 0, tokyo),
+		"last-month": time.Date(2024, 2, 1, 0, 0, 0, 0, tokyo),
+		"2024-02-15": time.Date(2024, 2, 15, 0, 0, 0, 0, tokyo),
+	}
+	for s, want := range periods {
+		if got, err := ParseTime(s, local); err != nil || !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %s %v", s, want, got, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package batch emulates OpenAI's Batch API for backends that lack it. Batch
+// input files are kept in a directory, each batch runs its requests through
+// the router a few at a time, and the results are written back as output and
+// error files the client downloads like OpenAI's.
+package batch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/kcolemangt/llm-router/migrate"
+)
+
+// Schema is the format history of a store's files. Add a migration whenever
+// the format of files or batches changes.
+var Schema = migrate.Schema{Name: "batches"}
+
+// ErrNotFound is returned for files and batches that do not exist or belong
+// to another client
+var ErrNotFound = errors.New("not found")
+
+// Batch statuses
+const (
+	StatusValidating = "validating"
+	StatusFailed     = "failed"
+	StatusInProgress = "in_progress"
+	StatusFinalizing = "finalizing"
+	StatusCompleted  = "completed"
+	StatusCancelling = "cancelling"
+	StatusCancelled  = "cancelled"
+)
+
+// Purposes of files
+const (
+	PurposeBatch  = "batch"
+	PurposeOutput = "batch_output"
+)
+
+// Endpoints lists the endpoints a batch can target
+var Endpoints = []string{"/v1/chat/completions", "/v1/responses", "/v1/embeddings", "/v1/completions"}
+
+// MaxRequests bounds the requests of a batch, as OpenAI does
+const MaxRequests = 50000
+
+// File is a stored file, in the fields of OpenAI's file object
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// Batch is a batch, in the fields of OpenAI's batch object
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *Errors           `json:"errors,omitempty"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     string            `json:"output_file_id,omitempty"`
+	ErrorFileID      string            `json:"error_file_id,omitempty"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     int64             `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64             `json:"expires_at,omitempty"`
+	FinalizingAt     int64             `json:"finalizing_at,omitempty"`
+	CompletedAt      int64             `json:"completed_at,omitempty"`
+	FailedAt         int64             `json:"failed_at,omitempty"`
+	CancellingAt     int64             `json:"cancelling_at,omitempty"`
+	CancelledAt      int64             `json:"cancelled_at,omitempty"`
+	RequestCounts    RequestCounts     `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// Errors lists why a batch failed validation
+type Errors struct {
+	Object string  `json:"object"`
+	Data   []Error `json:"data"`
+}
+
+// Error is a problem with one line of an input file, or with the whole batch
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// RequestCounts counts the requests of a batch by outcome
+type RequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// Request is one line of an input file
+type Request struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// Result is one line of an output or error file
+type Result struct {
+	ID       string    `json:"id"`
+	CustomID string    `json:"custom_id"`
+	Response *Response `json:"response"`
+	Error    *Error    `json:"error"`
+}
+
+// Response is the answer to a request of a batch
+type Response struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Executor sends one request of a batch and returns the response
+type Executor func(ctx context.Context, req Request) Response
+
+// newID returns a random identifier with an OpenAI-style prefix
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
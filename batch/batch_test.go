@@ -0,0 +1,110 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitFor polls a batch until it reaches one of the final statuses
+func waitFor(t *testing.T, s *Store, owner, id string) Batch {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b, err := s.Batch(owner, id)
+		if err != nil {
+			t.Fatalf("Batch: %v", err)
+		}
+		switch b.Status {
+		case StatusCompleted, StatusFailed, StatusCancelled:
+			return b
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Batch %s did not finish", id)
+	return Batch{}
+}
+
+func TestBatchRunsRequestsAndSplitsResults(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	input := `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"m","messages":[]}}
+{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"bad","messages":[]}}
+`
+	f, err := s.AddFile("key1", "input.jsonl", PurposeBatch, []byte(input))
+	if err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	b, err := s.Create("key1", Batch{InputFileID: f.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s.Start("key1", b.ID, 2, func(ctx context.Context, req Request) Response {
+		if strings.Contains(string(req.Body), "bad") {
+			return Response{StatusCode: 404, Body: json.RawMessage(`{"error":{}}`)}
+		}
+		return Response{StatusCode: 200, RequestID: "r1", Body: json.RawMessage(`{"choices":[]}`)}
+	})
+
+	b = waitFor(t, s, "key1", b.ID)
+	if b.Status != StatusCompleted || b.RequestCounts != (RequestCounts{Total: 2, Completed: 1, Failed: 1}) {
+		t.Fatalf("Unexpected batch %+v", b)
+	}
+	output, err := s.Content("key1", b.OutputFileID)
+	if err != nil || !bytes.Contains(output, []byte(`"custom_id":"a"`)) || bytes.Contains(output, []byte(`"custom_id":"b"`)) {
+		t.Errorf("Expected only the success in the output file, got %s %v", output, err)
+	}
+	errorsOut, err := s.Content("key1", b.ErrorFileID)
+	if err != nil || !bytes.Contains(errorsOut, []byte(`"status_code":404`)) {
+		t.Errorf("Expected the failure in the error file, got %s %v", errorsOut, err)
+	}
+	if _, err := s.Batch("key2", b.ID); err != ErrNotFound {
+		t.Errorf("Expected another client not to see the batch, got %v", err)
+	}
+}
+
+func TestBatchValidationFailsBadLines(t *testing.T) {
+	s, _ := Open(t.TempDir())
+	input := `{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{}}
+not json
+{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}
+`
+	f, _ := s.AddFile("key1", "input.jsonl", PurposeBatch, []byte(input))
+	b, _ := s.Create("key1", Batch{InputFileID: f.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	s.Start("key1", b.ID, 1, func(ctx context.Context, req Request) Response {
+		t.Error("Expected no requests to be sent")
+		return Response{}
+	})
+
+	b = waitFor(t, s, "key1", b.ID)
+	if b.Status != StatusFailed || b.Errors == nil || len(b.Errors.Data) != 2 {
+		t.Fatalf("Expected two validation errors, got %+v", b)
+	}
+	if b.Errors.Data[0].Code != "mismatched_url" || b.Errors.Data[1].Line != 2 {
+		t.Errorf("Unexpected errors %+v", b.Errors.Data)
+	}
+}
+
+func TestReopenMarksInterruptedBatches(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir)
+	f, _ := s.AddFile("key1", "input.jsonl", PurposeBatch, []byte("{}\n"))
+	b, _ := s.Create("key1", Batch{InputFileID: f.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := reopened.Batch("key1", b.ID)
+	if err != nil || got.Status != StatusFailed {
+		t.Errorf("Expected the interrupted batch to be failed, got %+v %v", got, err)
+	}
+	if _, err := reopened.File("key1", f.ID); err != nil {
+		t.Errorf("Expected the file to survive a restart: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Start runs one of owner's batches in the background, sending concurrency
+// of its requests at a time with exec
+func (s *Store) Start(owner, id string, concurrency int, exec Executor) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancels[id] = cancel
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.cancels, id)
+			s.mu.Unlock()
+			cancel()
+		}()
+		s.run(ctx, owner, id, max(concurrency, 1), exec)
+	}()
+}
+
+// run validates a batch, sends its requests and writes the results
+func (s *Store) run(ctx context.Context, owner, id string, concurrency int, exec Executor) {
+	b, err := s.Batch(owner, id)
+	if err != nil {
+		return
+	}
+	requests, problems := s.parse(owner, b)
+	if len(problems) > 0 {
+		s.update(id, func(b *Batch) {
+			b.Status, b.FailedAt = StatusFailed, time.Now().Unix()
+			b.Errors = &Errors{Object: "list", Data: problems}
+		})
+		return
+	}
+	b, err = s.update(id, func(b *Batch) {
+		if b.Status == StatusValidating {
+			b.Status, b.InProgressAt = StatusInProgress, time.Now().Unix()
+		}
+		b.RequestCounts.Total = len(requests)
+	})
+	if err != nil || b.Status != StatusInProgress {
+		s.finish(owner, id, nil)
+		return
+	}
+
+	results := make([]*Result, len(requests))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i, req := range requests {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, req Request) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			// Requests already sent finish even if the batch is cancelled
+			response := exec(context.WithoutCancel(ctx), req)
+			results[i] = &Result{ID: newID("batch_req_"), CustomID: req.CustomID, Response: &response}
+			s.update(id, func(b *Batch) {
+				if response.StatusCode < 400 {
+					b.RequestCounts.Completed++
+				} else {
+					b.RequestCounts.Failed++
+				}
+			})
+		}(i, req)
+	}
+	wg.Wait()
+	s.finish(owner, id, results)
+}
+
+// finish writes the results of a batch to an output file for successes and
+// an error file for failures, and completes or cancels it
+func (s *Store) finish(owner, id string, results []*Result) {
+	s.update(id, func(b *Batch) {
+		if b.Status == StatusInProgress {
+			b.Status, b.FinalizingAt = StatusFinalizing, time.Now().Unix()
+		}
+	})
+
+	var output, errorsOut bytes.Buffer
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		line, err := json.Marshal(result)
+		if err != nil {
+			continue
+		}
+		if result.Response.StatusCode < 400 {
+			output.Write(append(line, '\n'))
+		} else {
+			errorsOut.Write(append(line, '\n'))
+		}
+	}
+	var outputID, errorID string
+	if output.Len() > 0 {
+		if f, err := s.AddFile(owner, id+"_output.jsonl", PurposeOutput, output.Bytes()); err == nil {
+			outputID = f.ID
+		}
+	}
+	if errorsOut.Len() > 0 {
+		if f, err := s.AddFile(owner, id+"_error.jsonl", PurposeOutput, errorsOut.Bytes()); err == nil {
+			errorID = f.ID
+		}
+	}
+
+	s.update(id, func(b *Batch) {
+		b.OutputFileID, b.ErrorFileID = outputID, errorID
+		now := time.Now().Unix()
+		if b.Status == StatusCancelling {
+			b.Status, b.CancelledAt = StatusCancelled, now
+		} else {
+			b.Status, b.CompletedAt = StatusCompleted, now
+		}
+	})
+}
+
+// parse reads the requests of a batch's input file, or the problems that
+// keep it from running
+func (s *Store) parse(owner string, b Batch) ([]Request, []Error) {
+	content, err := s.Content(owner, b.InputFileID)
+	if err != nil {
+		return nil, []Error{{Code: "invalid_input_file", Message: fmt.Sprintf("Input file %s was not found", b.InputFileID)}}
+	}
+
+	var requests []Request
+	var problems []Error
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var req Request
+		problem := func(code, format string, args ...interface{}) {
+			problems = append(problems, Error{Code: code, Message: fmt.Sprintf(format, args...), Line: line})
+		}
+		switch {
+		case json.Unmarshal(scanner.Bytes(), &req) != nil:
+			problem("invalid_json_line", "This line is not valid JSON")
+		case req.CustomID == "":
+			problem("missing_required_parameter", "The custom_id is missing")
+		case seen[req.CustomID]:
+			problem("duplicate_custom_id", "The custom_id %s is used more than once", req.CustomID)
+		case req.Method != "POST":
+			problem("invalid_method", "Only POST requests can be batched")
+		case req.URL != b.Endpoint:
+			problem("mismatched_url", "The url %s does not match the batch endpoint %s", req.URL, b.Endpoint)
+		default:
+			seen[req.CustomID] = true
+			requests = append(requests, req)
+		}
+	}
+	if len(requests) == 0 && len(problems) == 0 {
+		problems = append(problems, Error{Code: "empty_file", Message: "The input file has no requests"})
+	}
+	if len(requests) > MaxRequests {
+		problems = append(problems, Error{Code: "too_many_requests",
+			Message: fmt.Sprintf("A batch can have at most %d requests", MaxRequests)})
+	}
+	return requests, problems
+}
+
+// ValidEndpoint reports whether a batch can target an endpoint
+func ValidEndpoint(endpoint string) bool {
+	return slices.Contains(Endpoints, endpoint)
+}
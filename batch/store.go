@@ -0,0 +1,284 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps files and batches in a directory: each file's content and
+// description in files/, and each batch in batches/. Every file and batch
+// belongs to the client that created it.
+type Store struct {
+	dir string
+
+	mu      sync.Mutex
+	files   map[string]storedFile
+	batches map[string]storedBatch
+	cancels map[string]context.CancelFunc
+}
+
+// storedFile is a file's description and its owner
+type storedFile struct {
+	Owner string `json:"owner"`
+	File
+}
+
+// storedBatch is a batch and its owner
+type storedBatch struct {
+	Owner string `json:"owner"`
+	Batch
+}
+
+// Open opens or creates a store in dir. Batches that were running when the
+// router stopped are marked failed, or cancelled if they were cancelling.
+func Open(dir string) (*Store, error) {
+	for _, sub := range []string{"files", "batches"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{dir: dir, files: make(map[string]storedFile), batches: make(map[string]storedBatch),
+		cancels: make(map[string]context.CancelFunc)}
+
+	err := s.load("files", func(data []byte) {
+		var f storedFile
+		if json.Unmarshal(data, &f) == nil && f.ID != "" {
+			s.files[f.ID] = f
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var interrupted []storedBatch
+	err = s.load("batches", func(data []byte) {
+		var b storedBatch
+		if json.Unmarshal(data, &b) != nil || b.ID == "" {
+			return
+		}
+		s.batches[b.ID] = b
+		switch b.Status {
+		case StatusValidating, StatusInProgress, StatusFinalizing, StatusCancelling:
+			interrupted = append(interrupted, b)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	for _, b := range interrupted {
+		if b.Status == StatusCancelling {
+			b.Status, b.CancelledAt = StatusCancelled, now
+		} else {
+			b.Status, b.FailedAt = StatusFailed, now
+			b.Errors = &Errors{Object: "list", Data: []Error{{Code: "interrupted", Message: "The router stopped while the batch was running"}}}
+		}
+		if err := s.save(b); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddFile stores a file for owner
+func (s *Store) AddFile(owner, filename, purpose string, content []byte) (File, error) {
+	f := storedFile{Owner: owner, File: File{
+		ID:        newID("file-"),
+		Object:    "file",
+		Bytes:     len(content),
+		CreatedAt: time.Now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}}
+	if err := writeFile(filepath.Join(s.dir, "files", f.ID+".jsonl"), content); err != nil {
+		return File{}, err
+	}
+	if err := writeJSON(filepath.Join(s.dir, "files", f.ID+".json"), f); err != nil {
+		return File{}, err
+	}
+	s.mu.Lock()
+	s.files[f.ID] = f
+	s.mu.Unlock()
+	return f.File, nil
+}
+
+// HasFile reports whether a file is kept in the store, whoever owns it
+func (s *Store) HasFile(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[id]
+	return ok
+}
+
+// File returns the description of one of owner's files
+func (s *Store) File(owner, id string) (File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[id]
+	if !ok || f.Owner != owner {
+		return File{}, ErrNotFound
+	}
+	return f.File, nil
+}
+
+// Content returns the content of one of owner's files
+func (s *Store) Content(owner, id string) ([]byte, error) {
+	if _, err := s.File(owner, id); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(s.dir, "files", id+".jsonl"))
+}
+
+// DeleteFile removes one of owner's files
+func (s *Store) DeleteFile(owner, id string) error {
+	if _, err := s.File(owner, id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.files, id)
+	s.mu.Unlock()
+	return errors.Join(os.Remove(filepath.Join(s.dir, "files", id+".json")),
+		os.Remove(filepath.Join(s.dir, "files", id+".jsonl")))
+}
+
+// Create records a new batch for owner, validating
+func (s *Store) Create(owner string, b Batch) (Batch, error) {
+	now := time.Now()
+	b.ID = newID("batch_")
+	b.Object = "batch"
+	b.Status = StatusValidating
+	b.CreatedAt = now.Unix()
+	if window, err := time.ParseDuration(b.CompletionWindow); err == nil {
+		b.ExpiresAt = now.Add(window).Unix()
+	}
+	if err := s.save(storedBatch{Owner: owner, Batch: b}); err != nil {
+		return Batch{}, err
+	}
+	return b, nil
+}
+
+// Batch returns one of owner's batches
+func (s *Store) Batch(owner, id string) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[id]
+	if !ok || b.Owner != owner {
+		return Batch{}, ErrNotFound
+	}
+	return b.Batch, nil
+}
+
+// List returns up to limit of owner's batches, newest first, starting after
+// the batch with ID after if set, and whether there are more
+func (s *Store) List(owner, after string, limit int) ([]Batch, bool) {
+	s.mu.Lock()
+	var batches []Batch
+	for _, b := range s.batches {
+		if b.Owner == owner {
+			batches = append(batches, b.Batch)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(batches, func(a, b Batch) int {
+		if a.CreatedAt != b.CreatedAt {
+			return int(b.CreatedAt - a.CreatedAt)
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if after != "" {
+		for i, b := range batches {
+			if b.ID == after {
+				batches = batches[i+1:]
+				break
+			}
+		}
+	}
+	if len(batches) > limit {
+		return batches[:limit], true
+	}
+	return batches, false
+}
+
+// Cancel stops one of owner's batches. Requests already sent finish, and
+// the results so far are kept.
+func (s *Store) Cancel(owner, id string) (Batch, error) {
+	b, err := s.Batch(owner, id)
+	if err != nil {
+		return Batch{}, err
+	}
+	if b.Status != StatusValidating && b.Status != StatusInProgress {
+		return b, nil
+	}
+	b, err = s.update(id, func(b *Batch) {
+		b.Status, b.CancellingAt = StatusCancelling, time.Now().Unix()
+	})
+	s.mu.Lock()
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+	return b, err
+}
+
+// update changes a batch and saves it
+func (s *Store) update(id string, change func(*Batch)) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[id]
+	if !ok {
+		return Batch{}, ErrNotFound
+	}
+	change(&b.Batch)
+	s.batches[id] = b
+	return b.Batch, writeJSON(filepath.Join(s.dir, "batches", id+".json"), b)
+}
+
+// save writes a batch and records it in memory
+func (s *Store) save(b storedBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches[b.ID] = b
+	return writeJSON(filepath.Join(s.dir, "batches", b.ID+".json"), b)
+}
+
+// load calls fn with the content of each description in a subdirectory
+func (s *Store) load(sub string, fn func(data []byte)) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, sub, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fn(data)
+	}
+	return nil
+}
+
+// writeJSON replaces a file with the encoding of v
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// writeFile replaces a file atomically, so a crash leaves the old content
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
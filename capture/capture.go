@@ -0,0 +1,268 @@
+// Package capture records the router's traffic for offline analysis and bug
+// reports: every request a client sent and the response it got, with
+// credentials and secrets redacted, as a HAR file that browsers' developer
+// tools and HAR viewers open, or as JSON Lines of HAR entries.
+package capture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// redacted replaces the values of credential headers
+const redacted = "[REDACTED]"
+
+// secretHeaders carry credentials and are never recorded
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"Api-Key":             true,
+	"X-Goog-Api-Key":      true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// Entry is a HAR 1.2 entry: one request and its response
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	// Comment holds the router's request ID
+	Comment string `json:"comment,omitempty"`
+}
+
+// Request is the request of an entry
+type Request struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	HTTPVersion string    `json:"httpVersion"`
+	Cookies     []NameVal `json:"cookies"`
+	Headers     []NameVal `json:"headers"`
+	QueryString []NameVal `json:"queryString"`
+	PostData    *PostData `json:"postData,omitempty"`
+	HeadersSize int       `json:"headersSize"`
+	BodySize    int       `json:"bodySize"`
+}
+
+// Response is the response of an entry
+type Response struct {
+	Status      int       `json:"status"`
+	StatusText  string    `json:"statusText"`
+	HTTPVersion string    `json:"httpVersion"`
+	Cookies     []NameVal `json:"cookies"`
+	Headers     []NameVal `json:"headers"`
+	Content     Content   `json:"content"`
+	RedirectURL string    `json:"redirectURL"`
+	HeadersSize int       `json:"headersSize"`
+	BodySize    int       `json:"bodySize"`
+	// Comment notes a response body that was cut short
+	Comment string `json:"comment,omitempty"`
+}
+
+// NameVal is a header or query parameter
+type NameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is a request body
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Content is a response body. Encoding is "base64" for bodies that are not text.
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings splits an entry's time. The router only knows how long the response
+// took to start and to finish.
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Exchange is what the router saw of one request
+type Exchange struct {
+	ID        string
+	Request   *http.Request
+	Body      []byte
+	Status    int
+	Header    http.Header
+	Response  []byte
+	Truncated bool
+	Start     time.Time
+	FirstByte time.Duration
+	Duration  time.Duration
+}
+
+// Writer records entries to a file
+type Writer struct {
+	scrub func(string) string
+
+	mu      sync.Mutex
+	file    *os.File
+	har     bool
+	offset  int64
+	entries int
+}
+
+// harTail closes the entries list and the log, and is overwritten by the next entry
+const harTail = "\n]}}\n"
+
+// Open creates a HAR file at path, replacing one that exists, or appends to a
+// JSON Lines file if path ends in .jsonl. Bodies, URLs and header values are
+// passed through scrub before they are written.
+func Open(path, version string, scrub func(string) string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	w := &Writer{scrub: scrub, har: !strings.HasSuffix(path, ".jsonl")}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if w.har {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w.file = file
+	if w.har {
+		creator, _ := json.Marshal(map[string]string{"name": "llm-router", "version": version})
+		header := fmt.Sprintf(`{"log":{"version":"1.2","creator":%s,"entries":[`, creator)
+		if _, err := file.WriteString(header + harTail); err != nil {
+			file.Close()
+			return nil, err
+		}
+		w.offset = int64(len(header))
+	}
+	return w, nil
+}
+
+// Record writes the entry of an exchange. A HAR file is a complete document
+// after every entry, so it can be opened while the router runs.
+func (w *Writer) Record(ex Exchange) error {
+	line, err := json.Marshal(w.entry(ex))
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.har {
+		_, err = w.file.Write(append(line, '\n'))
+		return err
+	}
+	if w.entries > 0 {
+		line = append([]byte(","), line...)
+	}
+	line = append([]byte("\n"), line...)
+	if _, err := w.file.WriteAt(append(line, harTail...), w.offset); err != nil {
+		return err
+	}
+	w.offset += int64(len(line))
+	w.entries++
+	return nil
+}
+
+// Close closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// entry describes an exchange as a HAR entry, with secrets redacted
+func (w *Writer) entry(ex Exchange) Entry {
+	r := ex.Request
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	request := Request{
+		Method:      r.Method,
+		URL:         w.scrub(scheme + "://" + r.Host + r.URL.RequestURI()),
+		HTTPVersion: r.Proto,
+		Cookies:     []NameVal{},
+		Headers:     w.headers(r.Header),
+		QueryString: []NameVal{},
+		HeadersSize: -1,
+		BodySize:    len(ex.Body),
+	}
+	for name, values := range r.URL.Query() {
+		for _, value := range values {
+			request.QueryString = append(request.QueryString, NameVal{name, w.scrub(value)})
+		}
+	}
+	if len(ex.Body) > 0 {
+		text := fmt.Sprintf("[%d bytes of binary data]", len(ex.Body))
+		if utf8.Valid(ex.Body) {
+			text = w.scrub(string(ex.Body))
+		}
+		request.PostData = &PostData{MimeType: r.Header.Get("Content-Type"), Text: text}
+	}
+
+	response := Response{
+		Status:      ex.Status,
+		StatusText:  http.StatusText(ex.Status),
+		HTTPVersion: r.Proto,
+		Cookies:     []NameVal{},
+		Headers:     w.headers(ex.Header),
+		Content:     Content{Size: len(ex.Response), MimeType: ex.Header.Get("Content-Type")},
+		HeadersSize: -1,
+		BodySize:    len(ex.Response),
+	}
+	if utf8.Valid(ex.Response) {
+		response.Content.Text = w.scrub(string(ex.Response))
+	} else {
+		response.Content.Text, response.Content.Encoding = base64.StdEncoding.EncodeToString(ex.Response), "base64"
+	}
+	if ex.Truncated {
+		response.Comment = "body truncated to the recorded response limit"
+	}
+
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return Entry{
+		StartedDateTime: ex.Start,
+		Time:            ms(ex.Duration),
+		Request:         request,
+		Response:        response,
+		Timings:         Timings{Wait: ms(ex.FirstByte), Receive: ms(ex.Duration - ex.FirstByte)},
+		Comment:         ex.ID,
+	}
+}
+
+// headers lists a header in name order, redacting credentials
+func (w *Writer) headers(header http.Header) []NameVal {
+	list := []NameVal{}
+	for name, values := range header {
+		for _, value := range values {
+			if secretHeaders[http.CanonicalHeaderKey(name)] {
+				value = redacted
+			} else {
+				value = w.scrub(value)
+			}
+			list = append(list, NameVal{name, value})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
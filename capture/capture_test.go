@@ -0,0 +1,94 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exchange(body string) Exchange {
+	r := httptest.NewRequest("POST", "http://router/v1/chat/completions?key=sk-secret", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer router-key")
+	r.Header.Set("Content-Type", "application/json")
+	header := http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"session=1"}}
+	return Exchange{
+		ID:        "req-1",
+		Request:   r,
+		Body:      []byte(body),
+		Status:    200,
+		Header:    header,
+		Response:  []byte(`{"choices":[]}`),
+		Start:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		FirstByte: 20 * time.Millisecond,
+		Duration:  50 * time.Millisecond,
+	}
+}
+
+func scrub(s string) string { return strings.ReplaceAll(s, "sk-secret", "[API_KEY]") }
+
+func TestHARIsValidAfterEveryEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.har")
+	w, err := Open(path, "1.0", scrub)
+	if err != nil {
+		t.Fatalf("Failed to open: %s", err)
+	}
+	defer w.Close()
+
+	for i := 1; i <= 3; i++ {
+		if err := w.Record(exchange(`{"messages":[{"role":"user","content":"my key is sk-secret"}]}`)); err != nil {
+			t.Fatalf("Failed to record: %s", err)
+		}
+		data, _ := os.ReadFile(path)
+		var har struct {
+			Log struct {
+				Version string
+				Creator struct{ Name, Version string }
+				Entries []Entry
+			}
+		}
+		if err := json.Unmarshal(data, &har); err != nil {
+			t.Fatalf("Invalid HAR after %d entries: %s\n%s", i, err, data)
+		}
+		if len(har.Log.Entries) != i || har.Log.Version != "1.2" || har.Log.Creator.Version != "1.0" {
+			t.Fatalf("Unexpected log after %d entries: %+v", i, har.Log)
+		}
+	}
+}
+
+func TestEntriesAreRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	w, err := Open(path, "1.0", scrub)
+	if err != nil {
+		t.Fatalf("Failed to open: %s", err)
+	}
+	w.Record(exchange(`{"content":"my key is sk-secret"}`))
+	w.Close()
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatal("Expected an entry")
+	}
+	line := scanner.Text()
+	if strings.Contains(line, "sk-secret") || strings.Contains(line, "router-key") || strings.Contains(line, "session=1") {
+		t.Errorf("Secret leaked into the capture: %s", line)
+	}
+
+	var e Entry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatalf("Invalid entry: %s", err)
+	}
+	if e.Comment != "req-1" || e.Request.PostData == nil || e.Request.PostData.Text != `{"content":"my key is [API_KEY]"}` {
+		t.Errorf("Unexpected request: %+v", e.Request)
+	}
+	if e.Response.Content.Text != `{"choices":[]}` || e.Time != 50 || e.Timings.Wait != 20 {
+		t.Errorf("Unexpected response or timings: %+v %+v", e.Response, e.Timings)
+	}
+}
@@ -0,0 +1,151 @@
+// Package clientip finds the address a request really came from when the
+// router sits behind tunnels and reverse proxies such as ngrok or Cloudflare,
+// and decides whether that address may use the router at all.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Policy resolves client addresses and filters them. The zero value and a nil
+// policy trust no proxy and admit every address.
+type Policy struct {
+	trusted []netip.Prefix
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+}
+
+// New returns a policy that takes the client address from X-Forwarded-For on
+// connections from trusted proxies, admits only addresses in allow if it is
+// not empty, and refuses addresses in deny. Entries are CIDRs or single addresses.
+func New(trusted, allow, deny []string) (*Policy, error) {
+	var p Policy
+	var err error
+	if p.trusted, err = ParsePrefixes(trusted); err != nil {
+		return nil, err
+	}
+	if p.allow, err = ParsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = ParsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ParsePrefixes parses CIDRs, treating a single address as a prefix of its own
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ClientIP returns the address of the client. Only a connection from a trusted
+// proxy may name another address: X-Forwarded-For is read from the right,
+// skipping the proxies that appended to it, and X-Real-IP is used without it.
+// Connections without an IP address, such as over a Unix socket, return
+// their remote address as it is.
+func (p *Policy) ClientIP(r *http.Request) string {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return hostOf(r.RemoteAddr)
+	}
+	if !p.trusts(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	if len(hops) == 0 {
+		if real, ok := parseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ok {
+			return real.String()
+		}
+		return remote.String()
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(strings.TrimSpace(hops[i]))
+		if !ok {
+			// Whatever precedes a malformed entry cannot be trusted
+			break
+		}
+		client = hop
+		if !p.trusts(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// Permits reports whether the allow and deny lists admit a client address.
+// An address that cannot be parsed, such as a Unix socket peer, is admitted
+// unless an allow list is set.
+func (p *Policy) Permits(ip string) bool {
+	if p == nil {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return len(p.allow) == 0
+	}
+	addr = addr.Unmap()
+	if contains(p.deny, addr) {
+		return false
+	}
+	return len(p.allow) == 0 || contains(p.allow, addr)
+}
+
+// Trusted reports whether an address is one of the trusted proxies
+func (p *Policy) Trusted(ip string) bool {
+	addr, ok := parseAddr(ip)
+	return ok && p.trusts(addr)
+}
+
+func (p *Policy) trusts(addr netip.Addr) bool {
+	return p != nil && contains(p.trusted, addr)
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an address with or without a port
+func parseAddr(s string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(hostOf(s))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func hostOf(s string) string {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.Trim(s, "[]")
+}
@@ -0,0 +1,75 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	policy, err := New([]string{"127.0.0.1", "10.0.0.0/8"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remote, forwarded, real, want string
+	}{
+		{"203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7"},
+		{"127.0.0.1:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"127.0.0.1:5000", "6.6.6.6, 198.51.100.1, 10.1.2.3", "", "198.51.100.1"},
+		{"127.0.0.1:5000", "10.0.0.1, 10.1.2.3", "", "10.0.0.1"},
+		{"127.0.0.1:5000", "6.6.6.6, garbage, 10.1.2.3", "", "10.1.2.3"},
+		{"127.0.0.1:5000", "", "198.51.100.2", "198.51.100.2"},
+		{"[::ffff:127.0.0.1]:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"@", "198.51.100.1", "", "@"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.real != "" {
+			r.Header.Set("X-Real-IP", tt.real)
+		}
+		if got := policy.ClientIP(r); got != tt.want {
+			t.Errorf("%s with X-Forwarded-For %q: expected %s, got %s", tt.remote, tt.forwarded, tt.want, got)
+		}
+	}
+
+	var none *Policy
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := none.ClientIP(r); got != "127.0.0.1" {
+		t.Errorf("Expected a nil policy to trust no proxy, got %s", got)
+	}
+}
+
+func TestPermits(t *testing.T) {
+	policy, err := New(nil, []string{"192.168.0.0/16", "2001:db8::/32"}, []string{"192.168.66.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"192.168.1.10":        true,
+		"192.168.66.10":       false,
+		"8.8.8.8":             false,
+		"2001:db8::1":         true,
+		"::ffff:192.168.1.10": true,
+		"@":                   false,
+	}
+	for ip, want := range tests {
+		if got := policy.Permits(ip); got != want {
+			t.Errorf("%s: expected %v, got %v", ip, want, got)
+		}
+	}
+
+	denyOnly, _ := New(nil, nil, []string{"203.0.113.0/24"})
+	if denyOnly.Permits("203.0.113.9") || !denyOnly.Permits("8.8.8.8") || !denyOnly.Permits("@") {
+		t.Errorf("Unexpected deny list result")
+	}
+	if _, err := New(nil, []string{"10.0.0.0/33"}, nil); err == nil {
+		t.Errorf("Expected an invalid CIDR to be rejected")
+	}
+}
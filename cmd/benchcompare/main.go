@@ -0,0 +1,117 @@
+// Command benchcompare compares two sets of `go test -bench` results and fails
+// when any benchmark present in both got slower than the allowed threshold.
+//
+//	benchcompare [-threshold 10] baseline.txt current.txt
+//
+// When a benchmark was run several times (-count), the median ns/op is used.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	threshold := flag.Float64("threshold", 10, "maximum allowed slowdown in percent")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: benchcompare [-threshold percent] baseline.txt current.txt")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	baseline, err := parseResults(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	current, err := parseResults(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	regressions := 0
+	fmt.Printf("%-40s %14s %14s %9s\n", "benchmark", "baseline ns/op", "current ns/op", "delta")
+	for _, name := range names {
+		old, ok := baseline[name]
+		if !ok {
+			fmt.Printf("%-40s %14s %14.0f %9s\n", name, "-", median(current[name]), "new")
+			continue
+		}
+		oldNs, newNs := median(old), median(current[name])
+		delta := (newNs - oldNs) / oldNs * 100
+		marker := ""
+		if delta > *threshold {
+			marker = "  REGRESSION"
+			regressions++
+		}
+		fmt.Printf("%-40s %14.0f %14.0f %+8.1f%%%s\n", name, oldNs, newNs, delta, marker)
+	}
+
+	if regressions > 0 {
+		fmt.Printf("\n%d benchmark(s) slower than the %.0f%% threshold\n", regressions, *threshold)
+		os.Exit(1)
+	}
+}
+
+// parseResults reads the ns/op values of every benchmark in a go test output file
+func parseResults(path string) (map[string][]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	results := make(map[string][]float64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		for i := 2; i+1 < len(fields); i++ {
+			if fields[i+1] != "ns/op" {
+				continue
+			}
+			ns, err := strconv.ParseFloat(fields[i], 64)
+			if err == nil {
+				// Strip the -GOMAXPROCS suffix so results from different machines line up
+				name := fields[0]
+				if dash := strings.LastIndexByte(name, '-'); dash > 0 {
+					if _, err := strconv.Atoi(name[dash+1:]); err == nil {
+						name = name[:dash]
+					}
+				}
+				results[name] = append(results[name], ns)
+			}
+			break
+		}
+	}
+	return results, scanner.Err()
+}
+
+// median returns the middle value, which is less sensitive to noisy runs than the mean
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
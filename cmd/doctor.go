@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kcolemangt/llm-router/config"
+	"github.com/kcolemangt/llm-router/keyring"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/postcondition"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/redact"
+	"github.com/kcolemangt/llm-router/rules"
+	"github.com/kcolemangt/llm-router/state"
+	"github.com/kcolemangt/llm-router/synthetic"
+	"github.com/kcolemangt/llm-router/tokenizer"
+	"go.uber.org/zap"
+)
+
+// doctorCheck is one row of the doctor's report
+type doctorCheck struct {
+	name   string
+	err    error
+	detail string
+}
+
+// runDoctor implements the doctor subcommand, which checks the configuration,
+// keys and every backend and prints a PASS/FAIL table
+func runDoctor(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configFile := flags.String("config", "config.json", "Path to the configuration file")
+	apiKeyEnvVar := flags.String("api-key-env", "OPENAI_API_KEY", "Environment variable for the router API key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var checks []doctorCheck
+	add := func(name string, err error, detail string) {
+		checks = append(checks, doctorCheck{name, err, detail})
+	}
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		add("config", err, "")
+		return printDoctor(out, checks)
+	}
+	problems := config.Validate(cfg)
+	if _, err := rules.NewResolver(cfg.RoutingRules, cfg.Backends, zap.NewNop()); err != nil {
+		problems = append(problems, fmt.Errorf("routing rules: %w", err))
+	}
+	if _, err := redact.New(cfg.Redaction); err != nil {
+		problems = append(problems, fmt.Errorf("redaction: %w", err))
+	}
+	for i, tc := range cfg.Tokenizers {
+		if _, err := tokenizer.Load(tc.Type, tc.Path, tc.Pattern); err != nil {
+			problems = append(problems, fmt.Errorf("tokenizer %d: %w", i, err))
+		}
+	}
+	for _, backend := range cfg.Backends {
+		if _, err := proxy.NewTransport(backend.Transport); err != nil {
+			problems = append(problems, fmt.Errorf("backend %s transport: %w", backend.Name, err))
+		}
+	}
+	for i, pc := range cfg.PostConditions {
+		if _, err := postcondition.Compile(pc.Models, pc.MaxLength, pc.JSON, pc.MustMatch); err != nil {
+			problems = append(problems, fmt.Errorf("post-condition %d: %w", i, err))
+		}
+	}
+	for i, sm := range cfg.SyntheticModels {
+		rules := make([]synthetic.Rule, len(sm.Rules))
+		for j, r := range sm.Rules {
+			rules[j] = synthetic.Rule(r)
+		}
+		if _, err := synthetic.Compile(sm.Name, sm.Response, rules); err != nil {
+			problems = append(problems, fmt.Errorf("synthetic model %d: %w", i, err))
+		}
+	}
+	if len(problems) == 0 {
+		add("config", nil, *configFile)
+	}
+	for _, problem := range problems {
+		add("config", problem, "")
+	}
+
+	if cfg.KeyFile != "" {
+		add("router key", keyFileReadable(cfg.KeyFile), cfg.KeyFile)
+	} else {
+		add("router key", envSet(*apiKeyEnvVar), "$"+*apiKeyEnvVar)
+	}
+
+	if cfg.State.Driver == state.DriverRedis {
+		// Reading a key no one writes checks the address, password and database
+		store := state.NewRedis(cfg.State.Address, os.Getenv(cfg.State.PasswordEnv), cfg.State.DB, "")
+		_, _, err := store.Get(context.Background(), "llm-router:doctor")
+		store.Close()
+		add("state", err, "redis "+cfg.State.Address)
+	}
+
+	for _, backend := range cfg.Backends {
+		name := "backend " + backend.Name
+		if backend.RequireAPIKey {
+			if backend.KeyEnvVar == "" {
+				// Without its own key the backend is sent the router key
+				backend.KeyEnvVar = *apiKeyEnvVar
+			}
+			add(name+" key", envSet(backend.KeyEnvVar), "$"+backend.KeyEnvVar)
+		}
+
+		urls := backend.Instances
+		if len(urls) == 0 {
+			urls = []string{backend.BaseURL}
+		}
+		for _, baseURL := range urls {
+			if err := resolveHost(baseURL); err != nil {
+				add(name+" dns", err, baseURL)
+				continue
+			}
+			models, err := proxy.FetchModels(baseURL, backend)
+			add(name+" models", err, fmt.Sprintf("%s: %d models", baseURL, len(models)))
+		}
+
+		detection := proxy.Probe(backend)
+		var apiErr error
+		if detection.Error != "" {
+			apiErr = errors.New(detection.Error)
+		} else if !slices.Contains(detection.Formats, proxy.FormatOpenAI) {
+			apiErr = fmt.Errorf("no OpenAI-compatible API; found %s", strings.Join(detection.Formats, ", "))
+		}
+		add(name+" api", apiErr, detection.String())
+	}
+	return printDoctor(out, checks)
+}
+
+// readConfig reads a config file, or the configuration in the environment,
+// without the side effects of config.LoadConfig
+func readConfig(path string) (*model.Config, error) {
+	source, data := "$"+config.EnvConfigJSON, []byte(os.Getenv(config.EnvConfigJSON))
+	if len(data) == 0 {
+		source = path
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var cfg model.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", source, err)
+	}
+	if _, _, err := config.ApplyEnv(&cfg, os.Environ()); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// keyFileReadable checks a key file that exists; one that does not is created
+// with a new key when the router starts
+func keyFileReadable(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	_, err := keyring.Open(path)
+	return err
+}
+
+func envSet(name string) error {
+	if os.Getenv(name) == "" {
+		return fmt.Errorf("$%s is not set", name)
+	}
+	return nil
+}
+
+// resolveHost looks up the host of a backend URL
+func resolveHost(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	_, err = net.LookupHost(u.Hostname())
+	return err
+}
+
+// printDoctor prints the checks and returns an error if any failed
+func printDoctor(out io.Writer, checks []doctorCheck) error {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHECK\tRESULT\tDETAIL")
+	failed := 0
+	for _, check := range checks {
+		result, detail := "PASS", check.detail
+		if check.err != nil {
+			result, detail = "FAIL", check.err.Error()
+			failed++
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", check.name, result, detail)
+	}
+	table.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
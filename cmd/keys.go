@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kcolemangt/llm-router/keyring"
+)
+
+// runKeys implements the keys subcommand, which shows the router key from the
+// key file or rotates it. A running router picks up a rotation within a second.
+func runKeys(args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "show" && args[0] != "rotate") {
+		return errors.New("usage: llm-router keys show|rotate [-config config.json] [-grace 24h]")
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("keys "+action, flag.ContinueOnError)
+	configFile := flags.String("config", "config.json", "Path to the configuration file naming the key file")
+	grace := flags.Duration("grace", keyring.DefaultGrace, "How long the replaced key keeps working")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if cfg.KeyFile == "" {
+		return fmt.Errorf("no key_file is configured in %s; the router key comes from $%s", *configFile, cfg.GlobalAPIKeyEnv)
+	}
+	ring, err := keyring.Open(cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	if action == "show" {
+		fmt.Fprintln(out, ring.Current())
+		return nil
+	}
+
+	if *grace < 0 {
+		return errors.New("grace must not be negative")
+	}
+	state, err := ring.Rotate(*grace)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "New router key: %s\n", state.Key)
+	if *grace > 0 {
+		fmt.Fprintf(out, "The previous key works until %s\n", state.Previous[0].Expires.Format(time.RFC1123))
+	} else {
+		fmt.Fprintln(out, "The previous key no longer works")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// listen opens a listener for an address: host:port for TCP, unix:/path for a
+// Unix domain socket, or systemd or systemd:name for a socket passed by
+// systemd socket activation
+func listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return listenUnix(path)
+	}
+	if address == "systemd" || strings.HasPrefix(address, "systemd:") {
+		return systemdListener(strings.TrimPrefix(strings.TrimPrefix(address, "systemd"), ":"))
+	}
+	return net.Listen("tcp", address)
+}
+
+// serve serves HTTPS on listener if the server has a TLS config, HTTP otherwise
+func serve(server *http.Server, listener net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(listener, "", "")
+	}
+	return server.Serve(listener)
+}
+
+// listenerTLS loads a listener's certificate and the CA bundle that client
+// certificates must chain to
+func listenerTLS(tc model.ListenerTLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if tc.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(tc.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", tc.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if tc.ClientCerts == model.ClientCertsOptional {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// listenUnix listens on a Unix domain socket, replacing a socket left behind by
+// a previous run. The socket is readable and writable by its owner and group,
+// so a reverse proxy in the group can connect.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// systemdFirstFD is the first file descriptor systemd passes
+const systemdFirstFD = 3
+
+var (
+	systemdOnce    sync.Once
+	systemdSockets map[string]net.Listener
+	systemdOrder   []string
+	systemdErr     error
+)
+
+// systemdListener returns a socket passed by systemd socket activation: the
+// one named with FileDescriptorName= if name is set, or else the first one
+func systemdListener(name string) (net.Listener, error) {
+	systemdOnce.Do(loadSystemdSockets)
+	if systemdErr != nil {
+		return nil, systemdErr
+	}
+	if name == "" {
+		name = systemdOrder[0]
+	}
+	listener, ok := systemdSockets[name]
+	if !ok {
+		return nil, fmt.Errorf("systemd passed no socket named %q (available: %s)", name, strings.Join(systemdOrder, ", "))
+	}
+	return listener, nil
+}
+
+// loadSystemdSockets reads the sockets systemd passed in LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES
+func loadSystemdSockets() {
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid != os.Getpid() {
+		systemdErr = errors.New("no sockets passed by systemd; start the router from a .socket unit")
+		return
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		systemdErr = errors.New("no sockets passed by systemd: LISTEN_FDS is not set")
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// Children such as hooks must not think the sockets are theirs
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	systemdSockets = make(map[string]net.Listener)
+	for i := 0; i < count; i++ {
+		name := strconv.Itoa(systemdFirstFD + i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(systemdFirstFD+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			systemdErr = fmt.Errorf("systemd socket %s: %w", name, err)
+			return
+		}
+		systemdSockets[name] = listener
+		systemdOrder = append(systemdOrder, name)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// runLogs implements the logs subcommand, which queries the audit log
+func runLogs(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	configFile := flags.String("config", "config.json", "Path to the configuration file naming the audit log")
+	path := flags.String("file", "", "Path to the audit log (overrides the config file)")
+	since := flags.String("since", "24h", "Show requests since a time or duration ago, e.g. 2h, 2024-05-01 or month")
+	until := flags.String("until", "", "Show requests before a time or duration ago")
+	keyID := flags.String("key", "", "Only show requests from this key ID")
+	modelName := flags.String("model", "", "Only show requests for this model, with or without its prefix")
+	backend := flags.String("backend", "", "Only show requests served by this backend")
+	limit := flags.Int("limit", 50, "Show at most this many of the most recent requests; 0 shows all")
+	asJSON := flags.Bool("json", false, "Print entries as JSON Lines")
+	timezone := flags.String("timezone", "", "Show and parse times in this IANA time zone (overrides the config file)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *path == "" || *timezone == "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil && *path == "" {
+			return fmt.Errorf("reading config: %w", err)
+		}
+		var cfg model.Config
+		if err == nil {
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return fmt.Errorf("parsing config: %w", err)
+			}
+		}
+		if *path == "" && cfg.Audit.Path == "" {
+			return fmt.Errorf("no audit log configured in %s; set audit.path or pass -file", *configFile)
+		}
+		if *path == "" {
+			*path = cfg.Audit.Path
+		}
+		if *timezone == "" {
+			*timezone = cfg.Timezone
+		}
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", *timezone)
+	}
+
+	now := time.Now().In(loc)
+	q := audit.Query{KeyID: *keyID, Model: *modelName, Backend: *backend, Limit: *limit}
+	if *since != "" {
+		if q.Since, err = audit.ParseTime(*since, now); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if q.Until, err = audit.ParseTime(*until, now); err != nil {
+			return err
+		}
+	}
+
+	entries, err := audit.Read(*path, q)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		for _, e := range entries {
+			if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TIME\tID\tKEY\tMODEL\tBACKEND\tSTATUS\tDURATION\tTOKENS\tCOST")
+	for _, e := range entries {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%d\t%dms\t%d\t$%.4f\n",
+			e.Time.In(loc).Format("2006-01-02 15:04:05"), e.ID, e.KeyID, e.Model, e.Backend, e.Status, e.DurationMS, e.TotalTokens, e.CostUSD)
+	}
+	return table.Flush()
+}
@@ -1,19 +1,59 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
 
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/batch"
+	"github.com/kcolemangt/llm-router/capture"
 	"github.com/kcolemangt/llm-router/config"
 	"github.com/kcolemangt/llm-router/handler"
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/keyring"
 	"github.com/kcolemangt/llm-router/logging"
 	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/pkg/router"
 	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/redact"
+	"github.com/kcolemangt/llm-router/report"
+	"github.com/kcolemangt/llm-router/utils"
 	"go.uber.org/zap"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
+	// Subcommands run instead of the server
+	subcommands := map[string]func([]string, io.Writer) error{
+		"logs":    runLogs,
+		"doctor":  runDoctor,
+		"service": runService,
+		"migrate": runMigrate,
+		"keys":    runKeys,
+		"report":  runReport,
+		"replay":  runReplay,
+	}
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// DefaultConfig is the default configuration in case the configuration file cannot be read.
 	var defaultConfig = model.Config{
 		ListeningPort: 11411,
@@ -33,6 +73,11 @@ func main() {
 		},
 	}
 
+	// Defined here so InitFlags parses them along with the server flags
+	setup := flag.String("setup", "", "Run an interactive setup assistant for a client: cursor")
+	capturePath := flag.String("capture", "", "Record requests and responses, with secrets redacted, to a HAR file, or to JSON Lines if the name ends in .jsonl")
+	listenAddr := flag.String("listen", "", "Listen on host:port, unix:/path/router.sock or systemd (socket activation) instead of the configured port and listeners")
+
 	// Initialize command-line flags
 	configFile, apiKeyEnvVar, listeningPort, logLevel := config.InitFlags()
 
@@ -49,18 +94,205 @@ func main() {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
-	// Initialize proxies based on the loaded configuration
-	proxy.InitializeProxies(cfg.Backends, logger)
+	cfg.Version = version
+	if *listenAddr != "" {
+		cfg.Listeners = []model.ListenerConfig{{Address: *listenAddr}}
+	}
 
-	// Set up HTTP server and handlers
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		handler.HandleRequest(cfg, w, r)
-	})
+	// Build the proxies, rules, caches and trackers the configuration asks for
+	if err := router.Prepare(cfg); err != nil {
+		logger.Fatal("Failed to set up the router", zap.Error(err))
+	}
+	defer cfg.StateStore.Close()
+	logger = cfg.Logger
+
+	// Bring persistent stores to the current format before opening them
+	stores := configuredStores(cfg)
+	for _, s := range stores {
+		if err := upgradeStore(s, logger); err != nil {
+			logger.Fatal("Failed to migrate store", zap.String("store", s.schema.Name), zap.Error(err))
+		}
+	}
+
+	// Open the exchange history if configured
+	if cfg.HistoryDir != "" {
+		store, err := history.Open(cfg.HistoryDir)
+		if err != nil {
+			logger.Fatal("Failed to open history", zap.String("dir", cfg.HistoryDir), zap.Error(err))
+		}
+		defer store.Close()
+		cfg.History = store
+		logger.Info("Recording exchanges", zap.String("dir", cfg.HistoryDir))
+	}
+
+	// Keep batch files and results if the Batch API is emulated
+	if cfg.Batches.Dir != "" {
+		store, err := batch.Open(cfg.Batches.Dir)
+		if err != nil {
+			logger.Fatal("Failed to open batches", zap.String("dir", cfg.Batches.Dir), zap.Error(err))
+		}
+		cfg.BatchStore = store
+		logger.Info("Emulating the Batch API", zap.String("dir", cfg.Batches.Dir))
+	}
+
+	// Open the audit log if configured
+	if cfg.Audit.Path != "" {
+		auditLog, err := audit.Open(cfg.Audit.Path, cfg.Audit.Bodies)
+		if err != nil {
+			logger.Fatal("Failed to open audit log", zap.String("path", cfg.Audit.Path), zap.Error(err))
+		}
+		defer auditLog.Close()
+		cfg.AuditLog = auditLog
+		logger.Info("Writing audit log", zap.String("path", cfg.Audit.Path), zap.Bool("bodies", cfg.Audit.Bodies))
+	}
+
+	// Capture traffic for offline analysis if asked to
+	if *capturePath != "" {
+		writer, err := openCapture(*capturePath, cfg)
+		if err != nil {
+			logger.Fatal("Failed to open capture file", zap.String("path", *capturePath), zap.Error(err))
+		}
+		defer writer.Close()
+		cfg.Capture = writer
+		logger.Info("Capturing traffic", zap.String("path", *capturePath))
+	}
+
+	// Keep track of the models installed on Ollama backends that discover them,
+	// and keep the models of backends that keep them warm loaded
+	if rt, ok := cfg.Router.(*proxy.Router); ok {
+		rt.Discover(context.Background(), cfg.Backends, logger)
+		rt.KeepWarm(context.Background(), cfg.Backends, cfg.Location, logger)
+	}
+
+	// Post usage summaries from the audit log if configured
+	if cfg.Report.WebhookURL != "" {
+		go report.Schedule(context.Background(), cfg.Report, cfg.Audit.Path, cfg.Location, logger)
+		logger.Info("Posting usage reports", zap.String("schedule", cfg.Report.Schedule), zap.Int("hour", cfg.Report.Hour))
+	}
+
+	// Stores just created are in the current format
+	for _, s := range stores {
+		if err := s.schema.Stamp(s.path); err != nil {
+			logger.Fatal("Failed to record store version", zap.String("store", s.schema.Name), zap.Error(err))
+		}
+	}
+
+	// Keep the router key in the key file, generating one on first start
+	if cfg.KeyFile != "" {
+		cfg.Keys, err = keyring.Open(cfg.KeyFile)
+		if err != nil {
+			logger.Fatal("Failed to open key file", zap.String("path", cfg.KeyFile), zap.Error(err))
+		}
+		cfg.GlobalAPIKey = cfg.Keys.Current()
+		logger.Info("Router key read from key file", zap.String("path", cfg.KeyFile),
+			zap.String("APIKey", utils.RedactAuthorization(cfg.GlobalAPIKey)))
+	}
+
+	// Set up a server per listener, or a single one serving everything
+	servers, err := listenerServers(cfg)
+	if err != nil {
+		logger.Fatal("Invalid listeners", zap.Error(err))
+	}
 
-	// Start the server
-	addr := fmt.Sprintf(":%d", cfg.ListeningPort)
-	log.Printf("Starting server on %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("Failed to start server: %s", err)
+	// Start the servers
+	if *setup != "" {
+		runSetupAndServe(*setup, cfg, servers)
+		return
 	}
+	failed := make(chan error, len(servers))
+	for _, server := range servers {
+		listener, err := listen(server.Addr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %s", server.Addr, err)
+		}
+		log.Printf("Starting server on %s", server.Addr)
+		go func(server *http.Server) { failed <- serve(server, listener) }(server)
+	}
+	log.Fatalf("Failed to start server: %s", <-failed)
+}
+
+// listenerServers builds a server for each configured listener. Without
+// listeners, one server on the listening port serves every endpoint. The
+// listening port is set to the first listener serving the API, which is the
+// one the setup assistant checks.
+func listenerServers(cfg *model.Config) ([]*http.Server, error) {
+	if len(cfg.Listeners) == 0 {
+		return []*http.Server{{Addr: fmt.Sprintf(":%d", cfg.ListeningPort), Handler: handler.NewHandler(cfg)}}, nil
+	}
+	if problems := config.ValidateListeners(cfg.Listeners); len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	var servers []*http.Server
+	apiPort := 0
+	for _, listener := range cfg.Listeners {
+		server := &http.Server{Addr: listener.Address, Handler: handler.NewListenerHandler(cfg, listener)}
+		if listener.TLS != nil {
+			tlsConfig, err := listenerTLS(*listener.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", listener.Address, err)
+			}
+			server.TLSConfig = tlsConfig
+		}
+		servers = append(servers, server)
+		if apiPort == 0 && (len(listener.Serve) == 0 || slices.Contains(listener.Serve, model.ServeAPI)) {
+			_, port, _ := net.SplitHostPort(listener.Address)
+			apiPort, _ = strconv.Atoi(port)
+		}
+		cfg.Logger.Info("Listener configured",
+			zap.String("address", listener.Address),
+			zap.Strings("serve", listener.Serve),
+			zap.Bool("auth", listener.Auth == nil || !listener.Auth.Disabled),
+			zap.Bool("tls", listener.TLS != nil))
+	}
+	if apiPort != 0 {
+		cfg.ListeningPort = apiPort
+	}
+	return servers, nil
+}
+
+// runSetupAndServe serves in the background while the setup assistant checks
+// every hop, then keeps serving. If a port is taken, the assistant checks
+// the router already listening there instead.
+func runSetupAndServe(target string, cfg *model.Config, servers []*http.Server) {
+	served := make(chan error, len(servers))
+	listening := 0
+	for _, server := range servers {
+		listener, err := listen(server.Addr)
+		if err != nil {
+			continue
+		}
+		listening++
+		go func(server *http.Server) { served <- serve(server, listener) }(server)
+	}
+
+	if err := runSetup(target, cfg, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if listening == 0 {
+		return
+	}
+	for _, server := range servers {
+		log.Printf("Serving on %s", server.Addr)
+	}
+	log.Printf("Press Ctrl+C to stop")
+	log.Fatalf("Failed to serve: %s", <-served)
+}
+
+// openCapture opens a capture file whose bodies are scrubbed by the configured
+// redaction detectors and patterns, and always of API keys
+func openCapture(path string, cfg *model.Config) (*capture.Writer, error) {
+	settings := cfg.Redaction
+	if !slices.Contains(settings.Detectors, "api_key") {
+		settings.Detectors = append(slices.Clone(settings.Detectors), "api_key")
+	}
+	redactor, err := redact.New(settings)
+	if err != nil {
+		return nil, err
+	}
+	return capture.Open(path, cfg.Version, func(s string) string {
+		scrubbed, _ := redactor.String(s)
+		return scrubbed
+	})
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/batch"
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/migrate"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// store is a persistent store the config names, with the schema of its format
+type store struct {
+	schema migrate.Schema
+	path   string
+}
+
+// configuredStores lists the persistent stores cfg uses
+func configuredStores(cfg *model.Config) []store {
+	var stores []store
+	if cfg.HistoryDir != "" {
+		stores = append(stores, store{history.Schema, cfg.HistoryDir})
+	}
+	if cfg.Audit.Path != "" {
+		stores = append(stores, store{audit.Schema, cfg.Audit.Path})
+	}
+	if cfg.Batches.Dir != "" {
+		stores = append(stores, store{batch.Schema, cfg.Batches.Dir})
+	}
+	return stores
+}
+
+// upgradeStore brings a store to the current format before it is opened
+func upgradeStore(s store, logger *zap.Logger) error {
+	applied, err := s.schema.Upgrade(s.path)
+	for _, m := range applied {
+		logger.Info("Migrated store", zap.String("store", s.schema.Name), zap.String("path", s.path),
+			zap.Int("version", m.Version), zap.String("migration", m.Description))
+	}
+	return err
+}
+
+// runMigrate implements the migrate subcommand, which reports the format of
+// each configured store and upgrades it. The router upgrades stores on start
+// too; this lets upgrades be checked and run while it is stopped.
+func runMigrate(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configFile := flags.String("config", "config.json", "Path to the configuration file naming the stores")
+	dryRun := flags.Bool("dry-run", false, "Only report the migrations that would be applied")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	stores := configuredStores(cfg)
+	if len(stores) == 0 {
+		fmt.Fprintf(out, "No persistent stores are configured in %s\n", *configFile)
+		return nil
+	}
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "STORE\tPATH\tVERSION\tLATEST\tPENDING")
+	var failed error
+	for _, s := range stores {
+		version, err := migrate.Version(s.path)
+		if err != nil {
+			return err
+		}
+		pending, err := s.schema.Pending(s.path)
+		if err != nil {
+			failed = err
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%d\n", s.schema.Name, s.path, version, s.schema.Latest(), len(pending))
+	}
+	table.Flush()
+	if failed != nil || *dryRun {
+		return failed
+	}
+
+	for _, s := range stores {
+		applied, err := s.schema.Upgrade(s.path)
+		for _, m := range applied {
+			fmt.Fprintf(out, "%s: migrated to version %d: %s\n", s.schema.Name, m.Version, m.Description)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(out, "All stores are up to date")
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/keyring"
+)
+
+// runReplay implements the replay subcommand, which asks a running router to
+// send a recorded request again and prints how the answers differ
+func runReplay(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configFile := flags.String("config", "config.json", "Path to the configuration file of the running router")
+	apiKeyEnvVar := flags.String("api-key-env", "OPENAI_API_KEY", "Environment variable for the router API key")
+	routerURL := flags.String("url", "", "URL of the running router (default http://localhost and the configured port)")
+	modelName := flags.String("model", "", "Send the request to this model instead of the original")
+	backend := flags.String("backend", "", "Send the request to this backend instead of the one the model routes to")
+	asJSON := flags.Bool("json", false, "Print the router's full answer as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: llm-router replay [-model name] [-backend name] <request-id>")
+	}
+
+	cfg, err := readConfig(*configFile)
+	if err != nil && (*routerURL == "" || !errors.Is(err, os.ErrNotExist)) {
+		return err
+	}
+	key := os.Getenv(*apiKeyEnvVar)
+	if cfg != nil && cfg.KeyFile != "" {
+		ring, err := keyring.Open(cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		key = ring.Current()
+	}
+	if *routerURL == "" {
+		port := cfg.ListeningPort
+		if port == 0 {
+			port = 11411
+		}
+		*routerURL = "http://localhost:" + strconv.Itoa(port)
+	}
+
+	options, _ := json.Marshal(map[string]string{"model": *modelName, "backend": *backend})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*routerURL, "/")+"/router/replay/"+flags.Arg(0), bytes.NewReader(options))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("router answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if *asJSON {
+		_, err := out.Write(body)
+		return err
+	}
+
+	var result struct {
+		ReplayID string `json:"replay_id"`
+		Original struct {
+			Model, Backend string
+			Status         int
+		} `json:"original"`
+		Replay struct {
+			Model, Backend string
+			Status         int
+		} `json:"replay"`
+		Identical bool     `json:"identical"`
+		Diff      []string `json:"diff"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("parsing the router's answer: %w", err)
+	}
+	fmt.Fprintf(out, "--- %s via %s (%d)\n", result.Original.Model, result.Original.Backend, result.Original.Status)
+	fmt.Fprintf(out, "+++ %s via %s (%d), request %s\n", result.Replay.Model, result.Replay.Backend, result.Replay.Status, result.ReplayID)
+	if result.Identical {
+		fmt.Fprintln(out, "The answers are identical")
+		return nil
+	}
+	for _, line := range result.Diff {
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/report"
+)
+
+// runReport implements the report subcommand, which summarizes the audit log
+// per key, backend and model
+func runReport(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	configFile := flags.String("config", "config.json", "Path to the configuration file naming the audit log")
+	path := flags.String("file", "", "Path to the audit log (overrides the config file)")
+	since := flags.String("since", "7d", "Summarize requests since a time or duration ago, e.g. 7d, 2024-05-01 or month")
+	until := flags.String("until", "", "Summarize requests before a time or duration ago")
+	format := flags.String("format", report.FormatMarkdown, "Output format: json, csv or markdown")
+	timezone := flags.String("timezone", "", "Show and parse times in this IANA time zone (overrides the config file)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *path == "" || *timezone == "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil && *path == "" {
+			return fmt.Errorf("reading config: %w", err)
+		}
+		var cfg model.Config
+		if err == nil {
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return fmt.Errorf("parsing config: %w", err)
+			}
+		}
+		if *path == "" && cfg.Audit.Path == "" {
+			return fmt.Errorf("no audit log configured in %s; set audit.path or pass -file", *configFile)
+		}
+		if *path == "" {
+			*path = cfg.Audit.Path
+		}
+		if *timezone == "" {
+			*timezone = cfg.Timezone
+		}
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", *timezone)
+	}
+
+	now := time.Now().In(loc)
+	q := audit.Query{Until: now}
+	if q.Since, err = audit.ParseTime(*since, now); err != nil {
+		return err
+	}
+	if *until != "" {
+		if q.Until, err = audit.ParseTime(*until, now); err != nil {
+			return err
+		}
+	}
+
+	entries, err := audit.Read(*path, q)
+	if err != nil {
+		return err
+	}
+	return report.Render(out, report.Build(entries, q.Since, q.Until), *format, loc)
+}
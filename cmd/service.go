@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// serviceName names the service on every platform
+const serviceName = "llm-router"
+
+// serviceSpec is what a platform service runs: the router binary with the
+// flags given to service install, in the current directory, with the
+// environment variables holding the router and backend keys
+type serviceSpec struct {
+	Executable string
+	Args       []string
+	Dir        string
+	Env        map[string]string
+}
+
+// runService implements the service subcommand: install, start, stop and
+// uninstall the router as a user service of the platform's service manager
+func runService(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s service install|start|stop|uninstall [server flags]", serviceName)
+	}
+	action, serverArgs := args[0], args[1:]
+
+	switch action {
+	case "install":
+		spec, err := newServiceSpec(serverArgs, out)
+		if err != nil {
+			return err
+		}
+		return installService(spec, out)
+	case "start":
+		return startService(out)
+	case "stop":
+		return stopService(out)
+	case "uninstall":
+		return uninstallService(out)
+	default:
+		return fmt.Errorf("unknown service action %q; use install, start, stop or uninstall", action)
+	}
+}
+
+// newServiceSpec captures the binary, flags, directory and key environment
+// variables of the current invocation
+func newServiceSpec(serverArgs []string, out io.Writer) (serviceSpec, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return serviceSpec{}, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	spec := serviceSpec{Executable: executable, Args: serverArgs, Dir: dir, Env: make(map[string]string)}
+
+	names := []string{flagValue(serverArgs, "api-key-env", "OPENAI_API_KEY")}
+	if cfg, err := readConfig(flagValue(serverArgs, "config", "config.json")); err == nil {
+		for _, backend := range cfg.Backends {
+			if backend.KeyEnvVar != "" {
+				names = append(names, backend.KeyEnvVar)
+			}
+		}
+	}
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			spec.Env[name] = value
+		} else {
+			fmt.Fprintf(out, "Warning: $%s is not set; the service will run without it\n", name)
+		}
+	}
+	return spec, nil
+}
+
+// flagValue returns the value of a flag in args, written -name value,
+// --name value or -name=value, or def if it is absent
+func flagValue(args []string, name, def string) string {
+	for i, arg := range args {
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+		if value, ok := strings.CutPrefix(trimmed, name+"="); ok {
+			return value
+		}
+		if trimmed == name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return def
+}
+
+// envNames returns the names of the spec's environment variables in order
+func (s serviceSpec) envNames() []string {
+	names := make([]string, 0, len(s.Env))
+	for name := range s.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// systemdUnit renders a systemd user unit; output goes to the journal
+func systemdUnit(spec serviceSpec, envFile string) string {
+	quoted := []string{systemdQuote(spec.Executable)}
+	for _, arg := range spec.Args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	return fmt.Sprintf(`[Unit]
+Description=LLM-router
+After=network-online.target
+
+[Service]
+ExecStart=%s
+WorkingDirectory=%s
+EnvironmentFile=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`, strings.Join(quoted, " "), strings.ReplaceAll(spec.Dir, "%", "%%"), envFile)
+}
+
+// systemdEnv renders an EnvironmentFile
+func systemdEnv(spec serviceSpec) string {
+	var b strings.Builder
+	for _, name := range spec.envNames() {
+		// Environment files are not subject to $ or % expansion
+		fmt.Fprintf(&b, "%s=\"%s\"\n", name, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(spec.Env[name]))
+	}
+	return b.String()
+}
+
+// systemdQuote quotes an ExecStart argument, escaping specifiers and variables
+func systemdQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%").Replace(s) + `"`
+}
+
+// launchdLabel identifies the launchd agent
+const launchdLabel = "com.kcolemangt.llm-router"
+
+// launchdPlist renders a launchd agent that starts at login and restarts on exit
+func launchdPlist(spec serviceSpec, logPath string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + launchdLabel + `</string>
+	<key>ProgramArguments</key>
+	<array>
+`)
+	for _, arg := range append([]string{spec.Executable}, spec.Args...) {
+		b.WriteString("\t\t<string>" + xmlEscape(arg) + "</string>\n")
+	}
+	b.WriteString("\t</array>\n\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	for _, name := range spec.envNames() {
+		b.WriteString("\t\t<key>" + xmlEscape(name) + "</key>\n\t\t<string>" + xmlEscape(spec.Env[name]) + "</string>\n")
+	}
+	b.WriteString("\t</dict>\n")
+	b.WriteString(`	<key>WorkingDirectory</key>
+	<string>` + xmlEscape(spec.Dir) + `</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>` + xmlEscape(logPath) + `</string>
+	<key>StandardErrorPath</key>
+	<string>` + xmlEscape(logPath) + `</string>
+</dict>
+</plist>
+`)
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// windowsWrapper renders a batch file that sets the environment and runs the
+// router, appending its output to logPath
+func windowsWrapper(spec serviceSpec, logPath string) string {
+	var b strings.Builder
+	b.WriteString("@echo off\r\n")
+	for _, name := range spec.envNames() {
+		fmt.Fprintf(&b, "set \"%s=%s\"\r\n", name, strings.ReplaceAll(spec.Env[name], "%", "%%"))
+	}
+	fmt.Fprintf(&b, "cd /d \"%s\"\r\n", spec.Dir)
+	quoted := []string{`"` + spec.Executable + `"`}
+	for _, arg := range spec.Args {
+		quoted = append(quoted, `"`+arg+`"`)
+	}
+	fmt.Fprintf(&b, "%s >> \"%s\" 2>&1\r\n", strings.Join(quoted, " "), logPath)
+	return b.String()
+}
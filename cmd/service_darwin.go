@@ -0,0 +1,71 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func launchdPaths() (plist, logPath string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"),
+		filepath.Join(home, "Library", "Logs", serviceName+".log"), nil
+}
+
+func installService(spec serviceSpec, out io.Writer) error {
+	plist, logPath, err := launchdPaths()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(plist), 0755); err != nil {
+		return err
+	}
+	// The plist holds API keys
+	if err := os.WriteFile(plist, []byte(launchdPlist(spec, logPath)), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Installed %s; it starts at login\nStart it now with: %s service start\nLogs are written to %s and shown in Console.app\n", plist, serviceName, logPath)
+	return nil
+}
+
+func startService(out io.Writer) error {
+	plist, _, err := launchdPaths()
+	if err != nil {
+		return err
+	}
+	return launchctl(out, "bootstrap", launchdDomain(), plist)
+}
+
+func stopService(out io.Writer) error {
+	return launchctl(out, "bootout", launchdDomain()+"/"+launchdLabel)
+}
+
+func uninstallService(out io.Writer) error {
+	stopService(out)
+	plist, _, err := launchdPaths()
+	if err != nil {
+		return err
+	}
+	return os.Remove(plist)
+}
+
+// launchdDomain is the launchd domain of the logged-in user's agents
+func launchdDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+func launchctl(out io.Writer, args ...string) error {
+	cmd := exec.Command("launchctl", args...)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("launchctl %v: %w", args, err)
+	}
+	return nil
+}
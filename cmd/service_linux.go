@@ -0,0 +1,78 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// systemdDir holds the user unit and its environment file
+func systemdDir() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "systemd", "user"), nil
+}
+
+func installService(spec serviceSpec, out io.Writer) error {
+	dir, err := systemdDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	unitPath := filepath.Join(dir, serviceName+".service")
+	envPath := filepath.Join(dir, serviceName+".env")
+	// The environment file holds API keys
+	if err := os.WriteFile(envPath, []byte(systemdEnv(spec)), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitPath, []byte(systemdUnit(spec, envPath)), 0644); err != nil {
+		return err
+	}
+	if err := systemctl(out, "daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl(out, "enable", serviceName); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Installed %s\nStart it with: %s service start\nFollow its logs with: journalctl --user -u %s -f\n", unitPath, serviceName, serviceName)
+	fmt.Fprintln(out, "To keep it running while you are logged out, run: loginctl enable-linger")
+	return nil
+}
+
+func startService(out io.Writer) error {
+	return systemctl(out, "start", serviceName)
+}
+
+func stopService(out io.Writer) error {
+	return systemctl(out, "stop", serviceName)
+}
+
+func uninstallService(out io.Writer) error {
+	systemctl(out, "disable", "--now", serviceName)
+	dir, err := systemdDir()
+	if err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(dir, serviceName+".env"))
+	if err := os.Remove(filepath.Join(dir, serviceName+".service")); err != nil {
+		return err
+	}
+	return systemctl(out, "daemon-reload")
+}
+
+func systemctl(out io.Writer, args ...string) error {
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %v: %w", args, err)
+	}
+	return nil
+}
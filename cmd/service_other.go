@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"runtime"
+)
+
+var errServiceUnsupported = errors.New("service management is not supported on " + runtime.GOOS)
+
+func installService(spec serviceSpec, out io.Writer) error { return errServiceUnsupported }
+func startService(out io.Writer) error                     { return errServiceUnsupported }
+func stopService(out io.Writer) error                      { return errServiceUnsupported }
+func uninstallService(out io.Writer) error                 { return errServiceUnsupported }
@@ -0,0 +1,72 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// On Windows the router is registered as a scheduled task that runs at logon.
+// A Windows service proper would have to answer the service control manager,
+// which the router binary does not do.
+
+func windowsPaths() (wrapper, logPath string, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir = filepath.Join(dir, serviceName)
+	return filepath.Join(dir, serviceName+".cmd"), filepath.Join(dir, serviceName+".log"), nil
+}
+
+func installService(spec serviceSpec, out io.Writer) error {
+	wrapper, logPath, err := windowsPaths()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(wrapper), 0700); err != nil {
+		return err
+	}
+	// The wrapper holds API keys
+	if err := os.WriteFile(wrapper, []byte(windowsWrapper(spec, logPath)), 0600); err != nil {
+		return err
+	}
+	if err := schtasks(out, "/Create", "/TN", serviceName, "/TR", `"`+wrapper+`"`, "/SC", "ONLOGON", "/RL", "LIMITED", "/F"); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Installed scheduled task %s; it starts at logon\nStart it now with: %s service start\nLogs are written to %s\n", serviceName, serviceName, logPath)
+	return nil
+}
+
+func startService(out io.Writer) error {
+	return schtasks(out, "/Run", "/TN", serviceName)
+}
+
+func stopService(out io.Writer) error {
+	return schtasks(out, "/End", "/TN", serviceName)
+}
+
+func uninstallService(out io.Writer) error {
+	stopService(out)
+	if err := schtasks(out, "/Delete", "/TN", serviceName, "/F"); err != nil {
+		return err
+	}
+	wrapper, _, err := windowsPaths()
+	if err != nil {
+		return err
+	}
+	return os.Remove(wrapper)
+}
+
+func schtasks(out io.Writer, args ...string) error {
+	cmd := exec.Command("schtasks", args...)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("schtasks %v: %w", args, err)
+	}
+	return nil
+}
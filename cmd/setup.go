@@ -0,0 +1,260 @@
+//go:build !nosetup && !minimal
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// ngrokAPI is the local API ngrok serves its tunnel list on
+const ngrokAPI = "http://127.0.0.1:4040/api/tunnels"
+
+// setupClient makes the setup checks; every hop should answer well within its timeout
+var setupClient = &http.Client{Timeout: 30 * time.Second}
+
+// runSetup walks the user through connecting Cursor to the router: it checks
+// the OpenAI key, finds or starts an ngrok tunnel, prints the settings to
+// paste into Cursor and then sends a test completion through the public URL,
+// reporting which hop fails
+func runSetup(target string, cfg *model.Config, in io.Reader, out io.Writer) error {
+	if target != "cursor" {
+		return fmt.Errorf("unknown setup target %q; only cursor is supported", target)
+	}
+	input := bufio.NewReader(in)
+	local := fmt.Sprintf("http://localhost:%d", cfg.ListeningPort)
+
+	fmt.Fprintln(out, "Setting up LLM-router for Cursor")
+	fmt.Fprintln(out)
+
+	// Step 1: the key Cursor will send, which the router forwards to OpenAI
+	if openai, ok := openAIBackend(cfg); ok {
+		key := cfg.GlobalAPIKey
+		if openai.KeyEnvVar != "" && os.Getenv(openai.KeyEnvVar) != "" {
+			key = os.Getenv(openai.KeyEnvVar)
+		}
+		if err := checkOpenAIKey(openai.BaseURL, key); err != nil {
+			return setupFailed(out, "OpenAI key", err,
+				"Check that $"+cfg.GlobalAPIKeyEnv+" holds a valid key from https://platform.openai.com/api-keys")
+		}
+		setupPassed(out, "OpenAI key", "accepted by "+openai.BaseURL)
+	} else {
+		setupPassed(out, "OpenAI key", "skipped, no OpenAI backend configured")
+	}
+
+	// Step 2: the router itself
+	if err := checkRouter(local, cfg.GlobalAPIKey); err != nil {
+		return setupFailed(out, "Router", err, "Is another program using port "+fmt.Sprint(cfg.ListeningPort)+"? Choose another with -port")
+	}
+	setupPassed(out, "Router", "listening on "+local)
+
+	// Step 3: a public HTTPS URL, which Cursor requires
+	public, err := findTunnel(cfg.ListeningPort)
+	if err != nil {
+		fmt.Fprintf(out, "       %s\n", err)
+		fmt.Fprint(out, "       Public HTTPS URL of your tunnel (e.g. https://xxxx.ngrok-free.app): ")
+		line, _ := input.ReadString('\n')
+		public = strings.TrimSuffix(strings.TrimSpace(line), "/")
+		public = strings.TrimSuffix(public, "/v1")
+	}
+	if !strings.HasPrefix(public, "https://") {
+		return setupFailed(out, "Tunnel", fmt.Errorf("%q is not an https URL", public),
+			"Cursor only accepts https base URLs; start a tunnel with: ngrok http "+fmt.Sprint(cfg.ListeningPort))
+	}
+	if err := checkRouter(public, cfg.GlobalAPIKey); err != nil {
+		return setupFailed(out, "Tunnel", err,
+			"The tunnel does not reach this router; make sure it forwards to port "+fmt.Sprint(cfg.ListeningPort))
+	}
+	setupPassed(out, "Tunnel", public+" reaches the router")
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "In Cursor, open Settings > Models and set:")
+	fmt.Fprintf(out, "  Override OpenAI Base URL: %s/v1\n", public)
+	fmt.Fprintf(out, "  OpenAI API Key:           %s\n", cfg.GlobalAPIKey)
+	fmt.Fprintln(out)
+
+	// Step 4: a real completion through every hop
+	testModel := defaultTestModel(cfg)
+	fmt.Fprintf(out, "Model for the self-test [%s]: ", testModel)
+	if line, _ := input.ReadString('\n'); strings.TrimSpace(line) != "" {
+		testModel = strings.TrimSpace(line)
+	}
+	if testModel == "" {
+		return setupFailed(out, "Completion", errors.New("no model given"), "Enter a model with its prefix, e.g. ollama/llama3")
+	}
+	if err := checkCompletion(public, cfg.GlobalAPIKey, testModel); err != nil {
+		return setupFailed(out, "Completion", err, "The router and tunnel work; the backend for "+testModel+" does not")
+	}
+	setupPassed(out, "Completion", testModel+" answered through "+public+"/v1")
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "All checks passed. Add %s to Cursor's models and select it.\n", testModel)
+	return nil
+}
+
+func setupPassed(out io.Writer, step, detail string) {
+	fmt.Fprintf(out, "  ok   %-10s %s\n", step, detail)
+}
+
+// setupFailed reports the failing step with a hint and returns the error
+func setupFailed(out io.Writer, step string, err error, hint string) error {
+	fmt.Fprintf(out, "  FAIL %-10s %s\n", step, err)
+	fmt.Fprintf(out, "       %s\n", hint)
+	return fmt.Errorf("setup failed at %s", strings.ToLower(step))
+}
+
+// openAIBackend returns the backend that forwards to OpenAI, if any
+func openAIBackend(cfg *model.Config) (model.BackendConfig, bool) {
+	for _, backend := range cfg.Backends {
+		if strings.Contains(backend.BaseURL, "api.openai.com") {
+			return backend, true
+		}
+	}
+	return model.BackendConfig{}, false
+}
+
+// defaultTestModel suggests a cheap model on the OpenAI backend for the self-test
+func defaultTestModel(cfg *model.Config) string {
+	if openai, ok := openAIBackend(cfg); ok {
+		return openai.Prefix + "gpt-4o-mini"
+	}
+	return ""
+}
+
+// checkOpenAIKey lists models with key to see whether OpenAI accepts it
+func checkOpenAIKey(baseURL, key string) error {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(baseURL, "/")+"/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := setupClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OpenAI answered %s: %s", resp.Status, errorMessage(resp.Body))
+	}
+	return nil
+}
+
+// checkRouter confirms that baseURL is served by LLM-router and accepts key
+func checkRouter(baseURL, key string) error {
+	req, err := http.NewRequest("GET", baseURL+"/router/info", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := setupClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("the router rejected the API key")
+	}
+	var info struct {
+		Name string `json:"name"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&info) != nil || info.Name != "llm-router" {
+		return fmt.Errorf("%s answered %s, but not as LLM-router", baseURL, resp.Status)
+	}
+	return nil
+}
+
+// checkCompletion sends a one-token chat completion through baseURL
+func checkCompletion(baseURL, key, modelName string) error {
+	body := fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"Say ok"}],"max_tokens":1}`, modelName)
+	req, err := http.NewRequest("POST", baseURL+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := setupClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if class := resp.Header.Get("X-Router-Error-Class"); class != "" {
+			return fmt.Errorf("backend error (%s) %s: %s", class, resp.Status, errorMessage(resp.Body))
+		}
+		return fmt.Errorf("%s: %s", resp.Status, errorMessage(resp.Body))
+	}
+	return nil
+}
+
+// errorMessage extracts the message from an OpenAI-style error body
+func errorMessage(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, 4096))
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &parsed) == nil && parsed.Error.Message != "" {
+		return parsed.Error.Message
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// findTunnel returns the public URL of an ngrok tunnel to port, starting
+// ngrok if it is installed and not yet running
+func findTunnel(port int) (string, error) {
+	if url, err := ngrokTunnel(port); err == nil {
+		return url, nil
+	}
+	if _, err := exec.LookPath("ngrok"); err != nil {
+		return "", errors.New("ngrok is not running and not installed (https://ngrok.com)")
+	}
+	cmd := exec.Command("ngrok", "http", fmt.Sprint(port))
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("starting ngrok: %w", err)
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+		if url, err := ngrokTunnel(port); err == nil {
+			return url, nil
+		}
+	}
+	return "", errors.New("ngrok started but did not report a tunnel; is it authenticated? (ngrok config add-authtoken)")
+}
+
+// ngrokTunnel asks a running ngrok for an https tunnel forwarding to port
+func ngrokTunnel(port int) (string, error) {
+	resp, err := setupClient.Get(ngrokAPI)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Tunnels []struct {
+			PublicURL string `json:"public_url"`
+			Config    struct {
+				Addr string `json:"addr"`
+			} `json:"config"`
+		} `json:"tunnels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	for _, tunnel := range list.Tunnels {
+		if strings.HasPrefix(tunnel.PublicURL, "https://") && (strings.HasSuffix(tunnel.Config.Addr, fmt.Sprintf(":%d", port)) || tunnel.Config.Addr == fmt.Sprint(port)) {
+			return tunnel.PublicURL, nil
+		}
+	}
+	return "", fmt.Errorf("ngrok has no https tunnel to port %d", port)
+}
@@ -0,0 +1,14 @@
+//go:build nosetup || minimal
+
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func runSetup(target string, cfg *model.Config, in io.Reader, out io.Writer) error {
+	return errors.New("the setup assistant is not built in")
+}
@@ -0,0 +1,7 @@
+//go:build !minimal
+
+package main
+
+// Embed the time zone database so the timezone setting works on systems
+// without one, such as Windows or minimal containers
+import _ "time/tzdata"
@@ -2,11 +2,30 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/kcolemangt/llm-router/clientip"
+	"github.com/kcolemangt/llm-router/history"
 	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/oidc"
+	"github.com/kcolemangt/llm-router/preset"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/report"
+	"github.com/kcolemangt/llm-router/state"
+	"github.com/kcolemangt/llm-router/transcription"
+	"github.com/kcolemangt/llm-router/usage"
 	"github.com/kcolemangt/llm-router/utils"
+	"github.com/kcolemangt/llm-router/vision"
 	"go.uber.org/zap"
 )
 
@@ -16,7 +35,14 @@ func LoadConfig(configFile, apiKeyEnvVar string, listeningPort int, defaultConfi
 	logger.Info("Starting configuration loading", zap.String("configFile", configFile))
 
 	var cfg model.Config
-	if _, err := os.Stat(configFile); err == nil { // If the file exists
+	fromDefaults := false
+	if data := os.Getenv(EnvConfigJSON); data != "" {
+		if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+			logger.Error("Failed to unmarshal config data", zap.String("variable", EnvConfigJSON), zap.Error(err))
+			return nil, err
+		}
+		logger.Info("Config read from the environment", zap.String("variable", EnvConfigJSON))
+	} else if _, err := os.Stat(configFile); err == nil { // If the file exists
 		logger.Info("Config file found", zap.String("file", configFile))
 		fileData, err := os.ReadFile(configFile)
 		if err != nil {
@@ -32,6 +58,30 @@ func LoadConfig(configFile, apiKeyEnvVar string, listeningPort int, defaultConfi
 	} else { // If the file doesn't exist, use the default config
 		logger.Warn("Config file not found, using default configuration", zap.String("file", configFile))
 		cfg = defaultConfig
+		fromDefaults = true
+	}
+
+	// Variables naming single fields override the file, so containers can
+	// adjust or replace it without mounting one
+	if fromDefaults && EnvSetsBackends(os.Environ()) {
+		cfg.Backends = nil
+	}
+	applied, unknown, err := ApplyEnv(&cfg, os.Environ())
+	if err != nil {
+		logger.Error("Failed to apply config from the environment", zap.Error(err))
+		return nil, err
+	}
+	if len(applied) > 0 {
+		logger.Info("Config fields set from the environment", zap.Strings("variables", applied))
+	}
+	if len(unknown) > 0 {
+		logger.Warn("Environment variables name no config field", zap.Strings("variables", unknown))
+	}
+
+	for i := range cfg.Backends {
+		if err := preset.Apply(&cfg.Backends[i]); err != nil {
+			logger.Warn("Backend preset not applied", zap.String("backend", cfg.Backends[i].Name), zap.Error(err))
+		}
 	}
 
 	// Apply command line overrides
@@ -47,12 +97,36 @@ func LoadConfig(configFile, apiKeyEnvVar string, listeningPort int, defaultConfi
 	cfg.Logger = logger
 
 	cfg.GlobalAPIKey = os.Getenv(cfg.GlobalAPIKeyEnv)
-	if cfg.GlobalAPIKey == "" {
+	if cfg.KeyFile != "" {
+		// The key file holds the router key and its rotations
+		if cfg.GlobalAPIKey != "" {
+			logger.Warn("API key environment variable ignored in favour of the key file",
+				zap.String("variable", cfg.GlobalAPIKeyEnv), zap.String("keyFile", cfg.KeyFile))
+		}
+		cfg.GlobalAPIKey = ""
+	} else if cfg.GlobalAPIKey == "" {
 		logger.Fatal("API key environment variable not set", zap.String("variable", cfg.GlobalAPIKeyEnv))
 	} else {
 		logger.Info("API key retrieved from environment variable", zap.String("APIKey", utils.RedactAuthorization(cfg.GlobalAPIKey)))
 	}
 
+	if cfg.UsageReport.SecretEnv != "" {
+		cfg.UsageReport.Secret = os.Getenv(cfg.UsageReport.SecretEnv)
+		if cfg.UsageReport.Secret == "" {
+			logger.Fatal("Usage report secret environment variable not set", zap.String("variable", cfg.UsageReport.SecretEnv))
+		}
+	}
+
+	for i, key := range cfg.APIKeys {
+		if key.KeyEnv == "" {
+			continue
+		}
+		cfg.APIKeys[i].Key = os.Getenv(key.KeyEnv)
+		if cfg.APIKeys[i].Key == "" {
+			logger.Fatal("API key environment variable not set", zap.String("key", key.Name), zap.String("variable", key.KeyEnv))
+		}
+	}
+
 	logger.Info("Configuration loading completed successfully")
 	return &cfg, nil
 }
@@ -68,3 +142,499 @@ func InitFlags() (string, string, int, string) {
 
 	return *configFile, *apiKeyEnvVar, *listeningPort, *logLevel
 }
+
+// Validate checks a configuration for mistakes that would only show up once
+// requests fail, and returns every problem found
+func Validate(cfg *model.Config) []error {
+	var problems []error
+	if len(cfg.Backends) == 0 {
+		problems = append(problems, errors.New("no backends configured"))
+	}
+
+	names := make(map[string]bool)
+	prefixes := make(map[string]string)
+	defaults := 0
+	assistants := make(map[string]bool)
+	// Backends that are sent the client's own Authorization
+	var forwarding []string
+	for i, backend := range cfg.Backends {
+		label := backend.Name
+		if label == "" {
+			label = fmt.Sprintf("backend %d", i)
+			problems = append(problems, fmt.Errorf("%s has no name", label))
+		} else if names[backend.Name] {
+			problems = append(problems, fmt.Errorf("backend name %s is used more than once", backend.Name))
+		}
+		names[backend.Name] = true
+
+		if _, ok := preset.Lookup(backend.Preset); backend.Preset != "" && !ok {
+			problems = append(problems, fmt.Errorf("%s has an unknown preset %q (available: %s)",
+				label, backend.Preset, strings.Join(preset.Names(), ", ")))
+		}
+
+		if other, ok := prefixes[backend.Prefix]; ok {
+			problems = append(problems, fmt.Errorf("backends %s and %s share the prefix %q", other, label, backend.Prefix))
+		}
+		prefixes[backend.Prefix] = label
+		if backend.Default {
+			defaults++
+		}
+		if backend.Assistants {
+			assistants[backend.Name] = true
+		}
+		if backend.RequireAPIKey && backend.KeyEnvVar == "" {
+			forwarding = append(forwarding, backend.Name)
+		}
+		if backend.RequireAPIKey && backend.KeyEnvVar == "" && cfg.KeyFile != "" {
+			// Without its own key the backend would be sent the generated router key
+			problems = append(problems, fmt.Errorf("%s requires an API key but sets no key_env_var, which key_file needs", label))
+		}
+		for _, name := range backend.Guardrails {
+			if _, ok := cfg.Guardrails[name]; !ok {
+				problems = append(problems, fmt.Errorf("%s names unknown guardrail %s", label, name))
+			}
+		}
+		for name := range backend.SetHeaders {
+			if !validHeaderName(name) {
+				problems = append(problems, fmt.Errorf("%s sets invalid header name %q", label, name))
+			} else if strings.EqualFold(name, "Authorization") {
+				problems = append(problems, fmt.Errorf("%s sets Authorization in set_headers; use require_api_key and key_env_var", label))
+			}
+		}
+		for _, pattern := range slices.Concat(backend.RemoveHeaders, backend.PassHeaders) {
+			if !validHeaderName(strings.TrimSuffix(pattern, "*")) && pattern != "*" {
+				problems = append(problems, fmt.Errorf("%s has an invalid header pattern %q", label, pattern))
+			}
+		}
+		if backend.OpenAIOrg != "" && !strings.HasPrefix(backend.OpenAIOrg, "org-") {
+			problems = append(problems, fmt.Errorf("%s has openai_organization %q, expected an ID starting with org-", label, backend.OpenAIOrg))
+		}
+		if backend.OpenAIProject != "" && !strings.HasPrefix(backend.OpenAIProject, "proj_") {
+			problems = append(problems, fmt.Errorf("%s has openai_project %q, expected an ID starting with proj_", label, backend.OpenAIProject))
+		}
+		if backend.ModelFamily != "" && backend.ModelFamily != proxy.FamilyNone {
+			if _, ok := proxy.LookupFamily(slices.Concat(cfg.ModelFamilies, proxy.DefaultModelFamilies), backend.ModelFamily); !ok {
+				problems = append(problems, fmt.Errorf("%s names unknown model family %s", label, backend.ModelFamily))
+			}
+		}
+		if backend.Heartbeat < 0 {
+			problems = append(problems, fmt.Errorf("%s has a negative heartbeat_seconds", label))
+		}
+		if backend.RateLimits.RetryBudget < 0 {
+			problems = append(problems, fmt.Errorf("%s has a negative rate_limits retry_budget_seconds", label))
+		}
+		if backend.PullMissing.TimeoutSeconds < 0 {
+			problems = append(problems, fmt.Errorf("%s has a negative pull_missing timeout_seconds", label))
+		}
+		for _, glob := range backend.PullMissing.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid pull_missing model pattern %q", label, glob))
+			}
+		}
+		if backend.KeepWarm.IntervalSeconds < 0 {
+			problems = append(problems, fmt.Errorf("%s has a negative keep_warm interval_seconds", label))
+		}
+		if keepAlive := backend.KeepWarm.KeepAlive; keepAlive != "" {
+			_, seconds := strconv.Atoi(keepAlive)
+			if _, err := time.ParseDuration(keepAlive); err != nil && seconds != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid keep_warm keep_alive %q", label, keepAlive))
+			}
+		}
+		for _, window := range backend.KeepWarm.Schedule {
+			if _, err := proxy.ParseWindow(window); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid keep_warm schedule: %w", label, err))
+			}
+		}
+		if backend.Discovery.IntervalSeconds < 0 {
+			problems = append(problems, fmt.Errorf("%s has a negative discovery interval_seconds", label))
+		}
+		if backend.Discovery.Aliases && backend.Discovery.IntervalSeconds == 0 {
+			problems = append(problems, fmt.Errorf("%s has discovery aliases but no interval_seconds to discover models", label))
+		}
+		switch backend.LoadBalancing {
+		case "", proxy.RoundRobin, proxy.Sticky, proxy.Adaptive:
+		default:
+			problems = append(problems, fmt.Errorf("%s has an unknown load_balancing %q (available: %s, %s, %s)",
+				label, backend.LoadBalancing, proxy.RoundRobin, proxy.Sticky, proxy.Adaptive))
+		}
+		if backend.ImageMode == vision.ModeResize && !vision.Available {
+			problems = append(problems, fmt.Errorf("%s resizes images, but this build has no image support", label))
+		}
+
+		urls := backend.Instances
+		if len(urls) == 0 {
+			urls = []string{backend.BaseURL}
+		}
+		for _, raw := range urls {
+			if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Errorf("%s has an invalid URL %q", label, raw))
+			}
+		}
+	}
+	if defaults > 1 {
+		problems = append(problems, fmt.Errorf("%d backends are marked default; only the last one is used", defaults))
+	}
+	for id, name := range cfg.AssistantBackends {
+		if !assistants[name] {
+			problems = append(problems, fmt.Errorf("assistant %s is mapped to %q, which is not a backend marked assistants", id, name))
+		}
+	}
+
+	keyNames := make(map[string]bool)
+	for i, key := range cfg.APIKeys {
+		label := key.Name
+		if label == "" {
+			label = fmt.Sprintf("api key %d", i)
+			problems = append(problems, fmt.Errorf("%s has no name", label))
+		} else if keyNames[key.Name] {
+			problems = append(problems, fmt.Errorf("api key name %s is used more than once", key.Name))
+		}
+		keyNames[key.Name] = true
+		// Keys only named by a JWT claim carry policies but have no key of their own
+		if key.KeyEnv == "" && key.ClientCert == "" && cfg.JWT.KeyClaim == "" {
+			problems = append(problems, fmt.Errorf("api key %s has no key_env or client_cert", label))
+		}
+		if key.ClientCert != "" && !verifiesClientCerts(cfg.Listeners) {
+			problems = append(problems, fmt.Errorf("api key %s has a client_cert, but no listener has a client_ca_file", label))
+		}
+		if key.ClientCert != "" && key.KeyEnv == "" {
+			// Clients with only a certificate send no key such a backend could be sent
+			for _, name := range forwarding {
+				if len(key.Backends) == 0 || slices.Contains(key.Backends, name) {
+					problems = append(problems, fmt.Errorf("api key %s has only a client_cert, but backend %s requires an API key and sets no key_env_var", label, name))
+				}
+			}
+		}
+		if key.Backend != "" && !names[key.Backend] {
+			problems = append(problems, fmt.Errorf("api key %s is pinned to unknown backend %s", label, key.Backend))
+		}
+		for _, backend := range key.Backends {
+			if !names[backend] {
+				problems = append(problems, fmt.Errorf("api key %s allows unknown backend %s", label, backend))
+			}
+		}
+		if key.Backend != "" && len(key.Backends) > 0 && !slices.Contains(key.Backends, key.Backend) {
+			problems = append(problems, fmt.Errorf("api key %s is pinned to backend %s, which its backends do not allow", label, key.Backend))
+		}
+		for _, glob := range key.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("api key %s has an invalid model pattern %q", label, glob))
+			}
+		}
+		for _, name := range key.Guardrails {
+			if _, ok := cfg.Guardrails[name]; !ok {
+				problems = append(problems, fmt.Errorf("api key %s names unknown guardrail %s", label, name))
+			}
+		}
+		if key.RequestsPerMinute < 0 || key.BudgetUSD < 0 {
+			problems = append(problems, fmt.Errorf("api key %s has a negative limit", label))
+		}
+		switch key.BudgetPeriod {
+		case "", usage.PeriodDay, usage.PeriodMonth:
+		default:
+			problems = append(problems, fmt.Errorf("api key %s has an unknown budget_period %q (available: %s, %s)",
+				label, key.BudgetPeriod, usage.PeriodDay, usage.PeriodMonth))
+		}
+		if key.BudgetUSD > 0 && len(cfg.ModelPrices) == 0 {
+			problems = append(problems, fmt.Errorf("api key %s has a budget, but no model_prices are set", label))
+		}
+	}
+	for name, guardrail := range cfg.Guardrails {
+		if guardrail.SystemPrompt == "" && guardrail.Prefix == "" && guardrail.Suffix == "" {
+			problems = append(problems, fmt.Errorf("guardrail %s has no system_prompt, prefix or suffix", name))
+		}
+	}
+
+	for i, window := range cfg.ContextWindows {
+		label := fmt.Sprintf("context window %d", i)
+		if window.Tokens <= 0 {
+			problems = append(problems, fmt.Errorf("%s has no tokens", label))
+		}
+		for _, glob := range window.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid model pattern %q", label, glob))
+			}
+		}
+	}
+
+	for i, capabilities := range cfg.Capabilities {
+		label := fmt.Sprintf("model capabilities %d", i)
+		if len(capabilities.Models) == 0 {
+			problems = append(problems, fmt.Errorf("%s has no models", label))
+		}
+		if capabilities.MaxContext < 0 {
+			problems = append(problems, fmt.Errorf("%s has a negative max_context", label))
+		}
+		for _, glob := range capabilities.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid model pattern %q", label, glob))
+			}
+		}
+	}
+
+	familyNames := make(map[string]bool)
+	for i, family := range cfg.ModelFamilies {
+		label := family.Name
+		if label == "" {
+			label = fmt.Sprintf("model family %d", i)
+			problems = append(problems, fmt.Errorf("%s has no name", label))
+		} else if familyNames[family.Name] {
+			problems = append(problems, fmt.Errorf("model family name %s is used more than once", family.Name))
+		}
+		familyNames[family.Name] = true
+		switch family.InstructionRole {
+		case "", proxy.RoleSystem, proxy.RoleDeveloper, proxy.RoleUser:
+		default:
+			problems = append(problems, fmt.Errorf("%s has an unknown instruction_role %q (available: %s, %s, %s)",
+				label, family.InstructionRole, proxy.RoleSystem, proxy.RoleDeveloper, proxy.RoleUser))
+		}
+		for _, glob := range family.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid model pattern %q", label, glob))
+			}
+		}
+	}
+
+	for i, compression := range cfg.Compression {
+		label := fmt.Sprintf("compression %d", i)
+		if compression.ThresholdTokens <= 0 {
+			problems = append(problems, fmt.Errorf("%s has no threshold_tokens", label))
+		}
+		if compression.SummaryModel == "" {
+			problems = append(problems, fmt.Errorf("%s has no summary_model", label))
+		}
+		for _, glob := range compression.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid model pattern %q", label, glob))
+			}
+		}
+	}
+
+	if cache := cfg.SemanticCache; len(cache.Models) > 0 {
+		if cache.EmbeddingModel == "" {
+			problems = append(problems, fmt.Errorf("semantic_cache has no embedding_model"))
+		}
+		if cache.Threshold < 0 || cache.Threshold > 1 {
+			problems = append(problems, fmt.Errorf("semantic_cache threshold %v is not between 0 and 1", cache.Threshold))
+		}
+		for _, glob := range cache.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("semantic_cache has an invalid model pattern %q", glob))
+			}
+		}
+	}
+
+	if moderation := cfg.Moderation; moderation.Model == "" && (len(moderation.Block) > 0 || len(moderation.Flag) > 0) {
+		problems = append(problems, fmt.Errorf("moderation has categories but no model"))
+	}
+	for _, glob := range slices.Concat(cfg.Moderation.Models, cfg.Moderation.Block, cfg.Moderation.Flag) {
+		if _, err := path.Match(glob, ""); err != nil {
+			problems = append(problems, fmt.Errorf("moderation has an invalid pattern %q", glob))
+		}
+	}
+
+	for i, class := range cfg.PriorityClasses {
+		label := class.Name
+		if label == "" {
+			label = fmt.Sprintf("priority class %d", i)
+		}
+		for _, key := range class.Keys {
+			if !keyNames[key] {
+				problems = append(problems, fmt.Errorf("%s names unknown api key %s", label, key))
+			}
+		}
+		for _, glob := range class.Models {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid model pattern %q", label, glob))
+			}
+		}
+	}
+
+	for name, alias := range cfg.Aliases {
+		if len(alias.Models) == 0 {
+			problems = append(problems, fmt.Errorf("alias %s has no models", name))
+		}
+		switch alias.RoutePolicy {
+		case "", proxy.PolicyPriority, proxy.PolicyCheapest, proxy.PolicyFastest:
+		default:
+			problems = append(problems, fmt.Errorf("alias %s has an unknown route_policy %q (available: %s, %s, %s)",
+				name, alias.RoutePolicy, proxy.PolicyPriority, proxy.PolicyCheapest, proxy.PolicyFastest))
+		}
+		if alias.RoutePolicy == proxy.PolicyCheapest {
+			for _, m := range alias.Models {
+				if _, ok := cfg.ModelPrices[m]; !ok {
+					problems = append(problems, fmt.Errorf("alias %s routes to the cheapest model but %s has no price", name, m))
+				}
+			}
+		}
+	}
+	if cfg.Limits.RecordedResponseBytes < 0 || cfg.Limits.ErrorPeekBytes < 0 || cfg.Limits.StreamLineBytes < 0 {
+		problems = append(problems, errors.New("limits must not be negative"))
+	}
+	if jwt := cfg.JWT; jwt != (model.JWTConfig{}) {
+		if !oidc.Available {
+			problems = append(problems, errors.New("jwt is configured, but this build has no single sign-on support"))
+		}
+		if u, err := url.Parse(jwt.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("jwt has an invalid issuer %q", jwt.Issuer))
+		}
+		if jwt.Audience == "" {
+			problems = append(problems, errors.New("jwt has no audience"))
+		}
+		if u, err := url.Parse(jwt.JWKSURL); jwt.JWKSURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			problems = append(problems, fmt.Errorf("jwt has an invalid jwks_url %q", jwt.JWKSURL))
+		}
+		if jwt.RequireKey && jwt.KeyClaim == "" {
+			problems = append(problems, errors.New("jwt require_key is set without key_claim"))
+		}
+	}
+	if cfg.HistoryDir != "" && !history.Available {
+		problems = append(problems, errors.New("history_dir is set, but this build has no history support"))
+	}
+	for _, list := range [][]string{cfg.Network.Allow, cfg.Network.Deny, cfg.Network.TrustedProxies} {
+		if _, err := clientip.ParsePrefixes(list); err != nil {
+			problems = append(problems, fmt.Errorf("network: %w", err))
+		}
+	}
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		problems = append(problems, fmt.Errorf("unknown timezone %q: use an IANA name such as Europe/Berlin", cfg.Timezone))
+	}
+	switch cfg.State.Driver {
+	case "", state.DriverMemory:
+	case state.DriverFile:
+		if cfg.State.Path == "" {
+			problems = append(problems, errors.New("state driver file has no path"))
+		}
+	case state.DriverRedis:
+		if cfg.State.Address == "" {
+			problems = append(problems, errors.New("state driver redis has no address"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("unknown state driver %q (available: %s, %s, %s)",
+			cfg.State.Driver, state.DriverMemory, state.DriverFile, state.DriverRedis))
+	}
+	if cfg.Lockout.Threshold < 0 || cfg.Lockout.WindowSeconds < 0 || cfg.Lockout.BanSeconds < 0 {
+		problems = append(problems, errors.New("lockout settings must not be negative"))
+	}
+	if cfg.StreamResume.RetentionSeconds < 0 {
+		problems = append(problems, errors.New("stream_resume retention_seconds must not be negative"))
+	}
+	switch cfg.Transcription.Mode {
+	case "", transcription.ModeFirst, transcription.ModeConfidence:
+	default:
+		problems = append(problems, fmt.Errorf("unknown transcription mode %q (available: %s, %s)",
+			cfg.Transcription.Mode, transcription.ModeFirst, transcription.ModeConfidence))
+	}
+	if cfg.Transcription.LargeFileModel != "" && cfg.Transcription.LargeFileBytes <= 0 {
+		problems = append(problems, errors.New("transcription large_file_model is set without large_file_bytes"))
+	}
+	if r := cfg.Report; r != (model.ReportConfig{}) {
+		if u, err := url.Parse(r.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("report has an invalid webhook_url %q", r.WebhookURL))
+		}
+		switch r.Schedule {
+		case report.ScheduleDaily, report.ScheduleWeekly:
+		default:
+			problems = append(problems, fmt.Errorf("report has an unknown schedule %q (available: %s, %s)",
+				r.Schedule, report.ScheduleDaily, report.ScheduleWeekly))
+		}
+		switch r.Format {
+		case "", report.FormatJSON, report.FormatCSV, report.FormatMarkdown:
+		default:
+			problems = append(problems, fmt.Errorf("report has an unknown format %q (available: %s, %s, %s)",
+				r.Format, report.FormatJSON, report.FormatCSV, report.FormatMarkdown))
+		}
+		if r.Hour < 0 || r.Hour > 23 {
+			problems = append(problems, fmt.Errorf("report hour %d is not between 0 and 23", r.Hour))
+		}
+		if cfg.Audit.Path == "" {
+			problems = append(problems, errors.New("report is configured without an audit path"))
+		}
+	}
+	return append(problems, ValidateListeners(cfg.Listeners)...)
+}
+
+// ValidateListeners checks listener addresses and groups, and that listeners
+// without authentication are only reachable from this machine. Addresses are
+// host:port, unix:/path or systemd[:name].
+func ValidateListeners(listeners []model.ListenerConfig) []error {
+	var problems []error
+	addresses := make(map[string]bool)
+	for i, listener := range listeners {
+		label := fmt.Sprintf("listener %d", i)
+		local := false
+		switch {
+		case strings.HasPrefix(listener.Address, "unix:"):
+			if listener.Address == "unix:" {
+				problems = append(problems, fmt.Errorf("%s has no socket path", label))
+				continue
+			}
+			// Unix domain sockets cannot be reached from other machines
+			local = true
+		case listener.Address == "systemd" || strings.HasPrefix(listener.Address, "systemd:"):
+		default:
+			host, _, err := net.SplitHostPort(listener.Address)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s has an invalid address %q", label, listener.Address))
+				continue
+			}
+			local = isLoopback(host)
+		}
+		label = "listener " + listener.Address
+		if addresses[listener.Address] {
+			problems = append(problems, fmt.Errorf("%s is configured more than once", label))
+		}
+		addresses[listener.Address] = true
+
+		for _, group := range listener.Serve {
+			switch group {
+			case model.ServeAPI, model.ServeAdmin, model.ServeMetrics, model.ServeHealth:
+			default:
+				problems = append(problems, fmt.Errorf("%s serves unknown group %q (available: %s, %s, %s, %s)",
+					label, group, model.ServeAPI, model.ServeAdmin, model.ServeMetrics, model.ServeHealth))
+			}
+		}
+		if listener.Auth != nil && listener.Auth.Disabled && !local {
+			problems = append(problems, fmt.Errorf("%s disables authentication but is not bound to a loopback address or Unix socket", label))
+		}
+		if tls := listener.TLS; tls != nil {
+			if tls.CertFile == "" || tls.KeyFile == "" {
+				problems = append(problems, fmt.Errorf("%s serves TLS without a cert_file and key_file", label))
+			}
+			switch tls.ClientCerts {
+			case "", model.ClientCertsRequired, model.ClientCertsOptional:
+			default:
+				problems = append(problems, fmt.Errorf("%s has unknown client_certs %q (available: %s, %s)",
+					label, tls.ClientCerts, model.ClientCertsRequired, model.ClientCertsOptional))
+			}
+			if tls.ClientCerts != "" && tls.ClientCAFile == "" {
+				problems = append(problems, fmt.Errorf("%s sets client_certs without a client_ca_file", label))
+			}
+		}
+	}
+	return problems
+}
+
+// verifiesClientCerts reports whether any listener verifies client certificates
+func verifiesClientCerts(listeners []model.ListenerConfig) bool {
+	for _, listener := range listeners {
+		if listener.TLS != nil && listener.TLS.ClientCAFile != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopback reports whether a listen host only accepts local connections
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validHeaderName reports whether name can be sent as an HTTP header name
+func validHeaderName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\r\n:*")
+}
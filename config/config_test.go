@@ -101,3 +101,234 @@ func TestErrorReadingFile(t *testing.T) {
 		t.Errorf("Expected default configuration, got: %+v", config)
 	}
 }
+
+func FuzzLoadConfig(f *testing.F) {
+	f.Add([]byte(`{"listening_port": 11411, "backends": [{"name": "ollama", "base_url": "http://localhost:11434", "prefix": "ollama/"}]}`))
+	f.Add([]byte(`{"routing_rules": [{"when": "tokens > 1", "backend": "x"}]}`))
+	f.Add([]byte(`{"listening_port": "11411"}`))
+	f.Add([]byte(`[]`))
+
+	logger := zap.NewNop()
+	os.Setenv("FUZZ_API_KEY", "fuzz")
+	defer os.Unsetenv("FUZZ_API_KEY")
+	dir := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path, "FUZZ_API_KEY", 0, model.Config{}, logger)
+		if err == nil && config == nil {
+			t.Fatalf("LoadConfig returned neither config nor error")
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *model.Config {
+		return &model.Config{Backends: []model.BackendConfig{
+			{Name: "openai", BaseURL: "https://api.openai.com", Prefix: "openai/", Default: true},
+			{Name: "ollama", Instances: []string{"http://gpu1:11434", "http://gpu2:11434"}, Prefix: "ollama/"},
+		}}
+	}
+	if problems := Validate(valid()); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *model.Config, openai, ollama *model.BackendConfig)
+		want   string
+	}{
+		{"base_url", func(cfg *model.Config, openai, ollama *model.BackendConfig) { openai.BaseURL = "localhost:11434" },
+			`openai has an invalid URL "localhost:11434"`},
+		{"duplicate name", func(cfg *model.Config, openai, ollama *model.BackendConfig) { ollama.Name = "openai" },
+			"backend name openai is used more than once"},
+		{"shared prefix", func(cfg *model.Config, openai, ollama *model.BackendConfig) { ollama.Prefix = "openai/" },
+			`backends openai and ollama share the prefix "openai/"`},
+		{"no name", func(cfg *model.Config, openai, ollama *model.BackendConfig) { ollama.Name = "" },
+			"backend 1 has no name"},
+		{"load_balancing", func(cfg *model.Config, openai, ollama *model.BackendConfig) { ollama.LoadBalancing = "random" },
+			`ollama has an unknown load_balancing "random" (available: round_robin, sticky, adaptive)`},
+		{"preset", func(cfg *model.Config, openai, ollama *model.BackendConfig) { openai.Preset = "acme" },
+			`openai has an unknown preset "acme" (available: groq, lmstudio, mistral, ollama, openai, openrouter, together, vllm)`},
+		{"require_api_key", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.KeyFile, openai.RequireAPIKey = "keys.json", true
+		}, "openai requires an API key but sets no key_env_var, which key_file needs"},
+		{"set_headers", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			openai.SetHeaders = map[string]string{"Authorization": "Bearer sk"}
+		}, "openai sets Authorization in set_headers; use require_api_key and key_env_var"},
+		{"remove_headers", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			openai.RemoveHeaders = []string{"X-Stainless-*", "bad header"}
+		}, `openai has an invalid header pattern "bad header"`},
+		{"openai_organization", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			openai.OpenAIOrg, openai.OpenAIProject = "acme", "proj_abc"
+		}, `openai has openai_organization "acme", expected an ID starting with org-`},
+		{"model_family", func(cfg *model.Config, openai, ollama *model.BackendConfig) { openai.ModelFamily = "o5" },
+			"openai names unknown model family o5"},
+		{"heartbeat_seconds", func(cfg *model.Config, openai, ollama *model.BackendConfig) { openai.Heartbeat = -1 },
+			"openai has a negative heartbeat_seconds"},
+		{"pull_missing", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			ollama.PullMissing = model.PullConfig{TimeoutSeconds: -1}
+		}, "ollama has a negative pull_missing timeout_seconds"},
+		{"keep_alive", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			ollama.KeepWarm = model.KeepWarmConfig{KeepAlive: "all day"}
+		}, `ollama has an invalid keep_warm keep_alive "all day"`},
+		{"keep_warm schedule", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			ollama.KeepWarm = model.KeepWarmConfig{Schedule: []model.KeepWarmWindow{
+				{Days: "mon-fri", Start: "09:00", End: "18:00"}, {Days: "mon-fri", Start: "9am", End: "6pm"}}}
+		}, `ollama has an invalid keep_warm schedule: invalid time of day "9am", expected HH:MM`},
+		{"discovery", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			ollama.Discovery = model.DiscoveryConfig{Aliases: true}
+		}, "ollama has discovery aliases but no interval_seconds to discover models"},
+		{"default", func(cfg *model.Config, openai, ollama *model.BackendConfig) { ollama.Default = true },
+			"2 backends are marked default; only the last one is used"},
+		{"assistant_backends", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.AssistantBackends = map[string]string{"asst_1": "ollama"}
+		}, `assistant asst_1 is mapped to "ollama", which is not a backend marked assistants`},
+		{"budget_period", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.APIKeys = []model.APIKeyConfig{{Name: "ci", KeyEnv: "CI_KEY", BudgetPeriod: "week"}}
+		}, `api key ci has an unknown budget_period "week" (available: day, month)`},
+		{"api key name", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.APIKeys = []model.APIKeyConfig{{Name: "ci", KeyEnv: "CI_KEY"}, {Name: "ci", KeyEnv: "CI_KEY_2"}}
+		}, "api key name ci is used more than once"},
+		{"key_env", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.APIKeys = []model.APIKeyConfig{{Name: "ci"}}
+		}, "api key ci has no key_env or client_cert"},
+		{"client_cert", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.APIKeys = []model.APIKeyConfig{{Name: "runner", ClientCert: "runner"}}
+		}, "api key runner has a client_cert, but no listener has a client_ca_file"},
+		{"client_cert forwarding", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Listeners = []model.ListenerConfig{{Address: ":8443", TLS: &model.ListenerTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}}}
+			cfg.APIKeys = []model.APIKeyConfig{{Name: "runner", ClientCert: "runner"}}
+			openai.RequireAPIKey = true
+		}, "api key runner has only a client_cert, but backend openai requires an API key and sets no key_env_var"},
+		{"api key guardrails", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.APIKeys = []model.APIKeyConfig{{Name: "runner", KeyEnv: "RUNNER_KEY", Guardrails: []string{"internal"}}}
+		}, "api key runner names unknown guardrail internal"},
+		{"guardrails", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Guardrails = map[string]model.GuardrailConfig{"empty": {}}
+		}, "guardrail empty has no system_prompt, prefix or suffix"},
+		{"context_windows", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.ContextWindows = []model.ContextWindowConfig{{Models: []string{"ollama/*"}}}
+		}, "context window 0 has no tokens"},
+		{"capabilities models", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Capabilities = []model.ModelCapabilityConfig{{MaxContext: 8192}}
+		}, "model capabilities 0 has no models"},
+		{"capabilities max_context", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Capabilities = []model.ModelCapabilityConfig{{Models: []string{"ollama/*"}, MaxContext: -1}}
+		}, "model capabilities 0 has a negative max_context"},
+		{"model family name", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.ModelFamilies = []model.ModelFamilyConfig{{Models: []string{"house-*"}}}
+		}, "model family 0 has no name"},
+		{"model family instruction_role", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.ModelFamilies = []model.ModelFamilyConfig{{Name: "house", Models: []string{"house-*"}, InstructionRole: "assistant"}}
+		}, `house has an unknown instruction_role "assistant" (available: system, developer, user)`},
+		{"model family models", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.ModelFamilies = []model.ModelFamilyConfig{{Name: "house", Models: []string{"["}}}
+		}, `house has an invalid model pattern "["`},
+		{"compression threshold_tokens", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Compression = []model.CompressionConfig{{Models: []string{"ollama/*"}, SummaryModel: "ollama/llama3.2"}}
+		}, "compression 0 has no threshold_tokens"},
+		{"compression summary_model", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Compression = []model.CompressionConfig{{Models: []string{"ollama/*"}, ThresholdTokens: 8000}}
+		}, "compression 0 has no summary_model"},
+		{"semantic_cache embedding_model", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.SemanticCache = model.SemanticCacheConfig{Models: []string{"openai/*"}}
+		}, "semantic_cache has no embedding_model"},
+		{"semantic_cache threshold", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.SemanticCache = model.SemanticCacheConfig{Models: []string{"openai/*"}, EmbeddingModel: "openai/text-embedding-3-small", Threshold: 95}
+		}, "semantic_cache threshold 95 is not between 0 and 1"},
+		{"moderation model", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Moderation = model.ModerationConfig{Block: []string{"hate"}}
+		}, "moderation has categories but no model"},
+		{"moderation block", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Moderation = model.ModerationConfig{Model: "openai/omni-moderation-latest", Block: []string{"[hate"}}
+		}, `moderation has an invalid pattern "[hate"`},
+		{"priority class keys", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.PriorityClasses = []model.PriorityClass{{Name: "interactive", Keys: []string{"cursor"}}}
+		}, "interactive names unknown api key cursor"},
+		{"priority class models", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.PriorityClasses = []model.PriorityClass{{Name: "interactive", Models: []string{"ollama/[qwen"}}}
+		}, `interactive has an invalid model pattern "ollama/[qwen"`},
+		{"alias models", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Aliases = map[string]model.ModelAlias{"fast": {}}
+		}, "alias fast has no models"},
+		{"alias prices", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Aliases = map[string]model.ModelAlias{"cheap": {Models: []string{"openai/gpt-4o"}, RoutePolicy: "cheapest"}}
+		}, "alias cheap routes to the cheapest model but openai/gpt-4o has no price"},
+		{"alias route_policy", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Aliases = map[string]model.ModelAlias{"odd": {Models: []string{"openai/gpt-4o"}, RoutePolicy: "random"}}
+		}, `alias odd has an unknown route_policy "random" (available: priority, cheapest, fastest)`},
+		{"timezone", func(cfg *model.Config, openai, ollama *model.BackendConfig) { cfg.Timezone = "Mars/Olympus_Mons" },
+			`unknown timezone "Mars/Olympus_Mons": use an IANA name such as Europe/Berlin`},
+		{"transcription mode", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Transcription = model.TranscriptionConfig{Mode: "best"}
+		}, `unknown transcription mode "best" (available: first, confidence)`},
+		{"transcription large_file_model", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Transcription = model.TranscriptionConfig{LargeFileModel: "openai/whisper-1"}
+		}, "transcription large_file_model is set without large_file_bytes"},
+		{"state driver", func(cfg *model.Config, openai, ollama *model.BackendConfig) { cfg.State.Driver = "sqlite" },
+			`unknown state driver "sqlite" (available: memory, file, redis)`},
+		{"state path", func(cfg *model.Config, openai, ollama *model.BackendConfig) { cfg.State.Driver = "file" },
+			"state driver file has no path"},
+		{"state address", func(cfg *model.Config, openai, ollama *model.BackendConfig) { cfg.State.Driver = "redis" },
+			"state driver redis has no address"},
+		{"report webhook_url", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Audit.Path, cfg.Report = "audit.jsonl", model.ReportConfig{WebhookURL: "hooks.example.com", Schedule: "daily"}
+		}, `report has an invalid webhook_url "hooks.example.com"`},
+		{"report schedule", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Audit.Path, cfg.Report = "audit.jsonl", model.ReportConfig{WebhookURL: "https://hooks.example.com/usage", Schedule: "hourly"}
+		}, `report has an unknown schedule "hourly" (available: daily, weekly)`},
+		{"report hour", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Audit.Path, cfg.Report = "audit.jsonl", model.ReportConfig{WebhookURL: "https://hooks.example.com/usage", Schedule: "daily", Hour: 24}
+		}, "report hour 24 is not between 0 and 23"},
+		{"report audit path", func(cfg *model.Config, openai, ollama *model.BackendConfig) {
+			cfg.Report = model.ReportConfig{WebhookURL: "https://hooks.example.com/usage", Schedule: "daily"}
+		}, "report is configured without an audit path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.change(cfg, &cfg.Backends[0], &cfg.Backends[1])
+			problems := Validate(cfg)
+			if len(problems) != 1 || problems[0].Error() != tt.want {
+				t.Errorf("Expected only %q, got %v", tt.want, problems)
+			}
+		})
+	}
+
+	if problems := Validate(&model.Config{}); len(problems) != 1 || problems[0].Error() != "no backends configured" {
+		t.Errorf("Expected a missing backends problem, got %v", problems)
+	}
+}
+
+func TestValidateListeners(t *testing.T) {
+	open := &model.AuthConfig{Disabled: true}
+	valid := []model.ListenerConfig{
+		{Address: ":11411", Serve: []string{model.ServeAPI, model.ServeHealth}},
+		{Address: "127.0.0.1:11412", Serve: []string{model.ServeAdmin, model.ServeMetrics}, Auth: open},
+		{Address: "localhost:11413", Auth: open},
+		{Address: "[::1]:11414", Auth: open},
+		{Address: "unix:/run/llm-router/admin.sock", Serve: []string{model.ServeAdmin}, Auth: open},
+		{Address: "systemd:api", Serve: []string{model.ServeAPI}},
+		{Address: ":8443", TLS: &model.ListenerTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}},
+	}
+	if problems := ValidateListeners(valid); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	invalid := []model.ListenerConfig{
+		{Address: "11411"},
+		{Address: ":11412", Serve: []string{"metrics", "prometheus"}},
+		{Address: ":11412", Auth: open},
+		{Address: "0.0.0.0:11413", Auth: open},
+		{Address: "unix:"},
+		{Address: "systemd", Auth: open},
+		{Address: ":8443", TLS: &model.ListenerTLSConfig{CertFile: "cert.pem", ClientCerts: "sometimes"}},
+	}
+	if problems := ValidateListeners(invalid); len(problems) != 10 {
+		t.Errorf("Expected 10 problems, got %d: %v", len(problems), problems)
+	}
+}
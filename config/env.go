@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// EnvConfigJSON is the variable holding a whole configuration as JSON, read in
+// place of the config file
+const EnvConfigJSON = "LLMROUTER_CONFIG_JSON"
+
+// envPrefix starts the variables that set single configuration fields
+const envPrefix = "LLMROUTER_"
+
+// ApplyEnv sets the configuration fields named by LLMROUTER_ variables in
+// environ. A variable is named after the JSON path of its field in upper
+// case, with list indexes as path elements: LLMROUTER_LISTENING_PORT or
+// LLMROUTER_BACKENDS_0_BASE_URL. Strings, numbers and booleans are given as
+// is, lists of strings as JSON or separated by commas, and maps and objects as
+// JSON. It returns the variables it applied and those naming no field.
+func ApplyEnv(cfg *model.Config, environ []string) (applied, unknown []string, err error) {
+	vars := make(map[string]string)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, envPrefix) && name != EnvConfigJSON {
+			vars[name] = value
+		}
+	}
+	// Sorted so list elements are set in order, whatever the environment's
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, compareEnvNames)
+
+	for _, name := range names {
+		ok, err := setEnvField(reflect.ValueOf(cfg).Elem(), strings.TrimPrefix(name, envPrefix), vars[name])
+		if err != nil {
+			return applied, unknown, fmt.Errorf("%s: %w", name, err)
+		}
+		if ok {
+			applied = append(applied, name)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return applied, unknown, nil
+}
+
+// EnvSetsBackends reports whether environ sets backends, which then replace
+// the default configuration's
+func EnvSetsBackends(environ []string) bool {
+	return slices.ContainsFunc(environ, func(kv string) bool {
+		return strings.HasPrefix(kv, envPrefix+"BACKENDS_") || strings.HasPrefix(kv, envPrefix+"BACKENDS=")
+	})
+}
+
+// compareEnvNames orders variable names with numbers compared by value, so
+// BACKENDS_2 comes before BACKENDS_10
+func compareEnvNames(a, b string) int {
+	as, bs := strings.Split(a, "_"), strings.Split(b, "_")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			return an - bn
+		}
+		return strings.Compare(as[i], bs[i])
+	}
+	return len(as) - len(bs)
+}
+
+// setEnvField sets the field at path below v, reporting false if path names
+// no field
+func setEnvField(v reflect.Value, path, value string) (bool, error) {
+	if path == "" {
+		return true, setEnvValue(v, value)
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setEnvField(v.Elem(), path, value)
+	case reflect.Struct:
+		// Longer names first, so BASE_URL is not taken for a field BASE
+		var best reflect.Value
+		bestName := ""
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			if tag == "" || tag == "-" || !v.Type().Field(i).IsExported() {
+				continue
+			}
+			name := strings.ToUpper(tag)
+			if (path == name || strings.HasPrefix(path, name+"_")) && len(name) > len(bestName) {
+				best, bestName = v.Field(i), name
+			}
+		}
+		if bestName == "" {
+			return false, nil
+		}
+		return setEnvField(best, strings.TrimPrefix(strings.TrimPrefix(path, bestName), "_"), value)
+	case reflect.Slice:
+		index, rest, _ := strings.Cut(path, "_")
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 {
+			return false, nil
+		}
+		if i >= v.Len() {
+			if i > v.Len() {
+				return true, fmt.Errorf("index %d skips element %d", i, v.Len())
+			}
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return setEnvField(v.Index(i), rest, value)
+	}
+	return false, nil
+}
+
+// setEnvValue parses value into v
+func setEnvValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items).Convert(v.Type()))
+			return nil
+		}
+	}
+	// Maps, objects and lists of objects are given as JSON
+	target := reflect.New(v.Type())
+	if err := json.Unmarshal([]byte(value), target.Interface()); err != nil {
+		return fmt.Errorf("invalid JSON for %s: %w", v.Type(), err)
+	}
+	v.Set(target.Elem())
+	return nil
+}
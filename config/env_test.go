@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestApplyEnv(t *testing.T) {
+	cfg := model.Config{ListeningPort: 11411}
+	applied, unknown, err := ApplyEnv(&cfg, []string{
+		"PATH=/usr/bin",
+		"LLMROUTER_LISTENING_PORT=8080",
+		"LLMROUTER_BACKENDS_0_NAME=openai",
+		"LLMROUTER_BACKENDS_0_BASE_URL=https://api.openai.com",
+		"LLMROUTER_BACKENDS_0_DEFAULT=true",
+		"LLMROUTER_BACKENDS_1_NAME=vllm",
+		"LLMROUTER_BACKENDS_1_INSTANCES=http://gpu1:8000, http://gpu2:8000",
+		`LLMROUTER_MODEL_PRICES={"openai/gpt-4o":{"input":0.0025,"output":0.01}}`,
+		"LLMROUTER_LISTENERS_0_AUTH_DISABLED=true",
+		"LLMROUTER_NOPE=1",
+		"LLMROUTER_CONFIG_JSON={}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 8 || len(unknown) != 1 || unknown[0] != "LLMROUTER_NOPE" {
+		t.Errorf("Unexpected variables: applied %v, unknown %v", applied, unknown)
+	}
+	if cfg.ListeningPort != 8080 || len(cfg.Backends) != 2 {
+		t.Fatalf("Unexpected config: %+v", cfg)
+	}
+	if b := cfg.Backends[0]; b.Name != "openai" || b.BaseURL != "https://api.openai.com" || !b.Default {
+		t.Errorf("Unexpected first backend: %+v", b)
+	}
+	if b := cfg.Backends[1]; b.Name != "vllm" || len(b.Instances) != 2 || b.Instances[1] != "http://gpu2:8000" {
+		t.Errorf("Unexpected second backend: %+v", b)
+	}
+	if cfg.ModelPrices["openai/gpt-4o"].Output != 0.01 {
+		t.Errorf("Expected model prices from JSON, got %v", cfg.ModelPrices)
+	}
+	if len(cfg.Listeners) != 1 || cfg.Listeners[0].Auth == nil || !cfg.Listeners[0].Auth.Disabled {
+		t.Errorf("Expected a listener with auth disabled, got %+v", cfg.Listeners)
+	}
+
+	for _, env := range [][]string{
+		{"LLMROUTER_LISTENING_PORT=http"},
+		{"LLMROUTER_BACKENDS_1_NAME=skipped"},
+		{"LLMROUTER_MODEL_PRICES=cheap"},
+	} {
+		if _, _, err := ApplyEnv(&model.Config{}, env); err == nil {
+			t.Errorf("Expected %v to be refused", env)
+		}
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	t.Setenv("TEST_API_KEY", "router-key")
+	t.Setenv(EnvConfigJSON, `{"listening_port": 9000, "backends": [{"name": "from-json"}]}`)
+	t.Setenv("LLMROUTER_BACKENDS_0_BASE_URL", "http://ollama:11434")
+	cfg, err := LoadConfig("non_existent_config.json", "TEST_API_KEY", 0, model.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ListeningPort != 9000 || len(cfg.Backends) != 1 || cfg.Backends[0].Name != "from-json" || cfg.Backends[0].BaseURL != "http://ollama:11434" {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	// Backends in the environment replace the default ones
+	t.Setenv(EnvConfigJSON, "")
+	t.Setenv("LLMROUTER_BACKENDS_0_NAME", "ollama")
+	defaults := model.Config{Backends: []model.BackendConfig{{Name: "openai"}, {Name: "ollama"}}}
+	cfg, err = LoadConfig("non_existent_config.json", "TEST_API_KEY", 0, defaults, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Backends) != 1 || cfg.Backends[0].Name != "ollama" {
+		t.Errorf("Expected only the backend from the environment, got %+v", cfg.Backends)
+	}
+}
@@ -0,0 +1,67 @@
+// Package events broadcasts what the router is doing to admin subscribers,
+// such as a dashboard following GET /router/events. Publishing never blocks:
+// a subscriber that falls behind misses events rather than slowing requests.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is one notification on the admin event stream
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[chan Event]struct{})
+	active      atomic.Int32
+)
+
+// Active reports whether anyone is subscribed, so publishers can skip
+// building events nobody will receive
+func Active() bool {
+	return active.Load() > 0
+}
+
+// Publish sends an event to every subscriber with room in its buffer
+func Publish(eventType string, data interface{}) {
+	if !Active() {
+		return
+	}
+	event := Event{Type: eventType, Time: time.Now().UTC(), Data: data}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a function that ends the
+// subscription and closes the channel
+func Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	active.Add(1)
+	mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, ch)
+			active.Add(-1)
+			mu.Unlock()
+			close(ch)
+		})
+	}
+}
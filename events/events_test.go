@@ -0,0 +1,36 @@
+package events
+
+import "testing"
+
+func TestPublishSubscribe(t *testing.T) {
+	if Active() {
+		t.Fatalf("Expected no subscribers")
+	}
+	Publish("ignored", nil)
+
+	ch, unsubscribe := Subscribe(1)
+	if !Active() {
+		t.Errorf("Expected a subscriber")
+	}
+	Publish("first", 1)
+	// The buffer is full, so this event is dropped instead of blocking
+	Publish("second", 2)
+
+	if event := <-ch; event.Type != "first" || event.Data != 1 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	select {
+	case event := <-ch:
+		t.Errorf("Expected the second event to be dropped, got %+v", event)
+	default:
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, open := <-ch; open {
+		t.Errorf("Expected the channel to be closed")
+	}
+	if Active() {
+		t.Errorf("Expected no subscribers after unsubscribing")
+	}
+}
@@ -0,0 +1,233 @@
+package extension
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/tokenizer"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// RequestContext describes a request as it moves through the pipeline. It is
+// populated once, right after authentication, and is the single source of
+// request facts for routing rules, resolvers, transformers and log fields.
+type RequestContext struct {
+	// ID identifies the request in logs and admin events
+	ID string
+	// KeyID identifies the client API key without revealing it
+	KeyID string
+	// ClientIP is the address of the client, behind any trusted proxies
+	ClientIP string
+	// Tags are free-form labels sent by the client in the X-Router-Tags header
+	Tags []string
+	// Model is the model requested by the client, including any prefix
+	Model string
+	// Backend is the name of the backend the request was sent to, once proxied
+	Backend string
+	// BackendModel is the model name sent to the backend, after aliases and
+	// prefixes are resolved; responses report Model in its place
+	BackendModel string
+	// PinnedBackend is the backend the client chose in the X-Router-Backend
+	// header or its key is pinned to; it overrides routing by model prefix
+	PinnedBackend string
+	// Key is the named API key the request was sent with, or nil for the router key
+	Key *model.APIKeyConfig
+	// ForwardAuthorization is set when the client's Authorization may be sent
+	// to backends that require a key but have none of their own: it carries
+	// the router key, or the router checks no keys. Named keys, certificates
+	// and JWTs are credentials for the router only and are never forwarded.
+	ForwardAuthorization bool
+	// Messages is the number of chat messages
+	Messages int
+	// Chars is the number of characters of message text
+	Chars int
+	// TokensEstimate is the token count of the message text, from the model's
+	// configured tokenizer or roughly derived from Chars
+	TokensEstimate int
+	// Language is the detected language of the last user message, or "und"
+	Language string
+	// Capabilities lists what a backend must support to serve the request:
+	// "stream", "tools", "vision" and "json"
+	Capabilities []string
+	// ChatRequest is the decoded chat completions or responses body
+	ChatRequest map[string]interface{}
+	// UsageEstimated is set when the backend reported no token usage and the
+	// router added an estimate to the response
+	UsageEstimated bool
+	// Route records why the request went to its backend
+	Route Route
+	// Price is what the model costs, if model_prices lists it
+	Price *model.ModelPrice
+	// Outcome is set when the request ended without a complete answer, such
+	// as "client_cancelled" when the client went away first
+	Outcome string
+}
+
+// Reasons a request was sent to its backend, reported in the routing decision log
+const (
+	// RoutePinnedHeader is a backend the client chose in the X-Router-Backend header
+	RoutePinnedHeader = "pinned_header"
+	// RoutePinnedKey is the backend the client's key is pinned to
+	RoutePinnedKey = "pinned_key"
+	// RouteResolver is a backend chosen by a registered resolver
+	RouteResolver = "resolver"
+	// RoutePrefix is the backend whose prefix starts the model name
+	RoutePrefix = "prefix"
+	// RouteDefault is the default backend, when no prefix matches
+	RouteDefault = "default"
+	// RouteRace sends the request to every model of an alias at once
+	RouteRace = "race"
+)
+
+// Route is the routing decision for a request: which backend it went to, the
+// rule that chose it and what the router changed on the way
+type Route struct {
+	// Reason is one of the Route constants
+	Reason string
+	// Rule is the prefix or resolver that matched, if any
+	Rule string
+	// Alias is the alias the client requested, and Policy the route policy
+	// that chose among its models
+	Alias  string
+	Policy string
+	// Backend is the name of the chosen backend
+	Backend string
+	// Transformations lists what the router changed in the request, such as
+	// "alias" or "prefix_stripped"
+	Transformations []string
+}
+
+type requestContextKey struct{}
+
+// NewRequestContext starts a context for an authenticated request
+func NewRequestContext(r *http.Request, authorization string) *RequestContext {
+	rc := &RequestContext{ID: newRequestID(), KeyID: utils.KeyID(authorization), PinnedBackend: r.Header.Get("X-Router-Backend")}
+	for _, tag := range strings.Split(r.Header.Get("X-Router-Tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			rc.Tags = append(rc.Tags, tag)
+		}
+	}
+	return rc
+}
+
+// newRequestID returns a random identifier for a request
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestContext returns a copy of r carrying rc
+func WithRequestContext(r *http.Request, rc *RequestContext) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestContextKey{}, rc))
+}
+
+// FromRequest returns the context attached to r, or an empty one if there is none
+func FromRequest(r *http.Request) *RequestContext {
+	if rc, ok := r.Context().Value(requestContextKey{}).(*RequestContext); ok {
+		return rc
+	}
+	return &RequestContext{}
+}
+
+// ChatRequest returns the decoded chat completions or responses body attached to r, if any
+func ChatRequest(r *http.Request) map[string]interface{} {
+	return FromRequest(r).ChatRequest
+}
+
+// SetChatRequest records the decoded chat completions or responses body and derives message
+// statistics, language and required capabilities from it. Tokens are counted with the
+// tokenizer tokenizers selects for the model, or estimated when there is none
+func (rc *RequestContext) SetChatRequest(chatReq map[string]interface{}, tokenizers *tokenizer.Set) {
+	rc.ChatRequest = chatReq
+	rc.Model, _ = chatReq["model"].(string)
+	rc.Messages, rc.Chars = utils.MessageStats(chatReq)
+	rc.TokensEstimate = utils.EstimateTokens(rc.Chars)
+	if t := tokenizers.For(rc.Model); t != nil {
+		rc.TokensEstimate = 0
+		for _, m := range utils.Messages(chatReq) {
+			rc.TokensEstimate += t.Count(utils.MessageText(m))
+		}
+	}
+	rc.Language = utils.DetectLanguage(utils.LastUserText(chatReq))
+
+	rc.Capabilities = nil
+	if stream, _ := chatReq["stream"].(bool); stream {
+		rc.Capabilities = append(rc.Capabilities, "stream")
+	}
+	if chatReq["tools"] != nil || chatReq["functions"] != nil {
+		rc.Capabilities = append(rc.Capabilities, "tools")
+	}
+	if hasImages(chatReq) {
+		rc.Capabilities = append(rc.Capabilities, "vision")
+	}
+	if text, _ := chatReq["text"].(map[string]interface{}); chatReq["response_format"] != nil || text["format"] != nil {
+		rc.Capabilities = append(rc.Capabilities, "json")
+	}
+}
+
+// Requires reports whether the request needs the given capability
+func (rc *RequestContext) Requires(capability string) bool {
+	for _, c := range rc.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag reports whether the client labelled the request with tag
+func (rc *RequestContext) HasTag(tag string) bool {
+	for _, t := range rc.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Vars returns the context as named variables for rules and templates
+func (rc *RequestContext) Vars() map[string]interface{} {
+	return map[string]interface{}{
+		"key_id":   rc.KeyID,
+		"model":    rc.Model,
+		"messages": rc.Messages,
+		"chars":    rc.Chars,
+		"tokens":   rc.TokensEstimate,
+		"language": rc.Language,
+		"stream":   rc.Requires("stream"),
+	}
+}
+
+// LogFields returns the context as structured log fields
+func (rc *RequestContext) LogFields() []zap.Field {
+	return []zap.Field{
+		zap.String("requestID", rc.ID),
+		zap.String("keyID", rc.KeyID),
+		zap.String("clientIP", rc.ClientIP),
+		zap.Strings("tags", rc.Tags),
+		zap.String("model", rc.Model),
+		zap.Int("tokensEstimate", rc.TokensEstimate),
+		zap.String("language", rc.Language),
+		zap.Strings("capabilities", rc.Capabilities),
+	}
+}
+
+// hasImages reports whether any message contains an image content part
+func hasImages(chatReq map[string]interface{}) bool {
+	for _, m := range utils.Messages(chatReq) {
+		message, _ := m.(map[string]interface{})
+		parts, _ := message["content"].([]interface{})
+		for _, p := range parts {
+			if part, _ := p.(map[string]interface{}); part["type"] == "image_url" || part["type"] == "input_image" {
+				return true
+			}
+		}
+	}
+	return false
+}
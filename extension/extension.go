@@ -0,0 +1,187 @@
+// Package extension lets custom builds of LLM-router compile in their own
+// routing logic. Register implementations from an init function and
+// blank-import the package from cmd/main.go, the same way database/sql
+// drivers are registered.
+package extension
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Resolver chooses the backend for a chat completions request. It returns the
+// prefix of a configured backend and the model name to send upstream, or
+// ok=false to defer to the next resolver and finally to prefix matching.
+type Resolver interface {
+	Resolve(r *http.Request, modelName string) (prefix string, upstreamModel string, ok bool)
+}
+
+// Transformer modifies the decoded chat completions request after a backend has
+// been chosen and before it is forwarded. Returning an error rejects the request.
+type Transformer interface {
+	Transform(r *http.Request, chatReq map[string]interface{}) error
+}
+
+// Middleware wraps the request pipeline with one stage of processing. Registered
+// middlewares run after authentication, so they can use FromRequest, and before
+// the request is routed. A middleware may answer the request itself by not
+// calling next.
+type Middleware func(next http.Handler) http.Handler
+
+// ResolverFunc adapts an ordinary function to the Resolver interface
+type ResolverFunc func(r *http.Request, modelName string) (string, string, bool)
+
+// Resolve calls f(r, modelName)
+func (f ResolverFunc) Resolve(r *http.Request, modelName string) (string, string, bool) {
+	return f(r, modelName)
+}
+
+// TransformerFunc adapts an ordinary function to the Transformer interface
+type TransformerFunc func(r *http.Request, chatReq map[string]interface{}) error
+
+// Transform calls f(r, chatReq)
+func (f TransformerFunc) Transform(r *http.Request, chatReq map[string]interface{}) error {
+	return f(r, chatReq)
+}
+
+// Registry holds resolvers, transformers and middlewares. The package
+// functions register into the compiled-in registry, shared by every router in
+// the process; each router also has a registry of its own, made by
+// NewRegistry, for what its configuration adds, such as routing rules.
+type Registry struct {
+	mu           sync.RWMutex
+	parent       *Registry
+	resolvers    []namedResolver
+	transformers []namedTransformer
+	middlewares  []namedMiddleware
+}
+
+type namedResolver struct {
+	name string
+	Resolver
+}
+
+type namedTransformer struct {
+	name string
+	Transformer
+}
+
+type namedMiddleware struct {
+	name string
+	Middleware
+}
+
+// compiledIn holds what custom builds register from init functions
+var compiledIn Registry
+
+// NewRegistry returns an empty registry for one router. Its lookups consult
+// the compiled-in extensions first, then its own.
+func NewRegistry() *Registry {
+	return &Registry{parent: &compiledIn}
+}
+
+// RegisterResolver adds a compiled-in resolver. Resolvers are consulted in registration order.
+func RegisterResolver(name string, resolver Resolver) {
+	compiledIn.RegisterResolver(name, resolver)
+}
+
+// RegisterTransformer adds a compiled-in transformer. Transformers run in registration order.
+func RegisterTransformer(name string, transformer Transformer) {
+	compiledIn.RegisterTransformer(name, transformer)
+}
+
+// RegisterMiddleware adds a compiled-in middleware. Middlewares run in registration order.
+func RegisterMiddleware(name string, middleware Middleware) {
+	compiledIn.RegisterMiddleware(name, middleware)
+}
+
+// RegisterResolver adds a resolver to the registry
+func (reg *Registry) RegisterResolver(name string, resolver Resolver) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.resolvers = append(reg.resolvers, namedResolver{name, resolver})
+}
+
+// RegisterTransformer adds a transformer to the registry
+func (reg *Registry) RegisterTransformer(name string, transformer Transformer) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.transformers = append(reg.transformers, namedTransformer{name, transformer})
+}
+
+// RegisterMiddleware adds a middleware to the registry
+func (reg *Registry) RegisterMiddleware(name string, middleware Middleware) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.middlewares = append(reg.middlewares, namedMiddleware{name, middleware})
+}
+
+// Middlewares returns the names and middlewares registered so far, in order
+func (reg *Registry) Middlewares() ([]string, []Middleware) {
+	var names []string
+	var list []Middleware
+	if reg.parent != nil {
+		names, list = reg.parent.Middlewares()
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, m := range reg.middlewares {
+		names, list = append(names, m.name), append(list, m.Middleware)
+	}
+	return names, list
+}
+
+// Wrap wraps next in the registered middlewares so that the first registered
+// runs first, and returns their names
+func (reg *Registry) Wrap(next http.Handler) (http.Handler, []string) {
+	names, list := reg.Middlewares()
+	for i := len(list) - 1; i >= 0; i-- {
+		next = list[i](next)
+	}
+	return next, names
+}
+
+// Resolve asks each registered resolver in turn for a backend, returning the
+// name of the resolver that matched
+func (reg *Registry) Resolve(r *http.Request, modelName string) (name, prefix, upstreamModel string, ok bool) {
+	if reg.parent != nil {
+		if name, prefix, upstreamModel, ok := reg.parent.Resolve(r, modelName); ok {
+			return name, prefix, upstreamModel, true
+		}
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, resolver := range reg.resolvers {
+		if prefix, upstreamModel, ok := resolver.Resolve(r, modelName); ok {
+			return resolver.name, prefix, upstreamModel, true
+		}
+	}
+	return "", "", "", false
+}
+
+// Transform runs every registered transformer over the request, stopping at the first error
+func (reg *Registry) Transform(r *http.Request, chatReq map[string]interface{}) error {
+	if reg.parent != nil {
+		if err := reg.parent.Transform(r, chatReq); err != nil {
+			return err
+		}
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, transformer := range reg.transformers {
+		if err := transformer.Transform(r, chatReq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasTransformers reports whether any transformer is registered
+func (reg *Registry) HasTransformers() bool {
+	if reg.parent != nil && reg.parent.HasTransformers() {
+		return true
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return len(reg.transformers) > 0
+}
@@ -0,0 +1,68 @@
+package extension
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolversConsultedInOrder(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterResolver("skip", ResolverFunc(func(r *http.Request, modelName string) (string, string, bool) {
+		return "", "", false
+	}))
+	reg.RegisterResolver("fast", ResolverFunc(func(r *http.Request, modelName string) (string, string, bool) {
+		if modelName == "fast" {
+			return "groq/", "llama3-8b-8192", true
+		}
+		return "", "", false
+	}))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	name, prefix, upstreamModel, ok := reg.Resolve(req, "fast")
+	if !ok || name != "fast" || prefix != "groq/" || upstreamModel != "llama3-8b-8192" {
+		t.Errorf("Unexpected resolution: %s %s %s %v", name, prefix, upstreamModel, ok)
+	}
+
+	if _, _, _, ok := reg.Resolve(req, "gpt-4"); ok {
+		t.Errorf("Expected no resolver to match")
+	}
+}
+
+func TestTransformStopsAtFirstError(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterTransformer("upper", TransformerFunc(func(r *http.Request, chatReq map[string]interface{}) error {
+		chatReq["model"] = strings.ToUpper(chatReq["model"].(string))
+		return nil
+	}))
+	reg.RegisterTransformer("reject", TransformerFunc(func(r *http.Request, chatReq map[string]interface{}) error {
+		return errors.New("rejected")
+	}))
+
+	chatReq := map[string]interface{}{"model": "phi3"}
+	err := reg.Transform(httptest.NewRequest("POST", "/", nil), chatReq)
+	if err == nil || err.Error() != "rejected" {
+		t.Errorf("Expected rejection error, got %v", err)
+	}
+	if chatReq["model"] != "PHI3" {
+		t.Errorf("Expected earlier transformer to run, got %v", chatReq["model"])
+	}
+}
+
+func TestMiddlewaresKeepRegistrationOrder(t *testing.T) {
+	passthrough := func(next http.Handler) http.Handler { return next }
+	RegisterMiddleware("cors", passthrough)
+	defer func() { compiledIn.middlewares = nil }()
+	reg := NewRegistry()
+	reg.RegisterMiddleware("redact", passthrough)
+
+	names, list := reg.Middlewares()
+	if len(list) != 2 || strings.Join(names, ",") != "cors,redact" {
+		t.Errorf("Expected compiled-in middlewares before the registry's own, got %v", names)
+	}
+	if names, _ := NewRegistry().Middlewares(); strings.Join(names, ",") != "cors" {
+		t.Errorf("Expected another registry not to see the first one's middlewares, got %v", names)
+	}
+}
@@ -1,8 +1,7 @@
 module github.com/kcolemangt/llm-router
 
-go 1.22.2
+go 1.24.0
 
-require (
-	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-)
+require go.uber.org/zap v1.27.0
+
+require go.uber.org/multierr v1.10.0 // indirect
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/assistants"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// assistantsPaths are the stateful APIs whose objects live on one provider
+var assistantsPaths = []string{"/v1/assistants", "/v1/threads", "/v1/vector_stores"}
+
+// assistantsPurpose is the purpose of files uploaded for the Assistants API
+const assistantsPurpose = "assistants"
+
+// isAssistantsRequest reports whether r belongs to the Assistants API: its
+// endpoints, and file uploads and listings for the assistants purpose
+func isAssistantsRequest(r *http.Request) bool {
+	for _, path := range assistantsPaths {
+		if r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/") {
+			return true
+		}
+	}
+	if r.URL.Path != "/v1/files" {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return r.URL.Query().Get("purpose") == assistantsPurpose
+	case http.MethodPost:
+		return uploadPurpose(r) == assistantsPurpose
+	}
+	return false
+}
+
+// uploadPurpose reads the purpose field of a multipart file upload. Only the
+// parts up to the purpose or the file are read, and the body is restored, so a
+// large upload is not buffered.
+func uploadPurpose(r *http.Request) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return ""
+	}
+	var consumed bytes.Buffer
+	reader := multipart.NewReader(io.TeeReader(r.Body, &consumed), params["boundary"])
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&consumed, r.Body), r.Body}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == "purpose" {
+			value, _ := io.ReadAll(io.LimitReader(part, 64))
+			return strings.TrimSpace(string(value))
+		}
+		if part.FileName() != "" {
+			return ""
+		}
+	}
+}
+
+// handleAssistants passes Assistants API requests through to a backend marked
+// assistants. Assistants, threads and their files exist only on the provider
+// that created them, so a request naming one goes to the backend holding it:
+// the one configured in assistant_backends or the one seen creating it. New
+// objects go to the backend whose prefix their model carries, and anything
+// else to the first backend marked assistants.
+func handleAssistants(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	logger := cfg.Logger
+	var body []byte
+	var payload map[string]interface{}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+			return
+		}
+		utils.UnmarshalJSON(body, &payload)
+	}
+
+	backend, err := assistantsBackend(cfg, r, payload)
+	if err != nil {
+		logger.Info("Assistants API request without an assistants backend", zap.String("path", r.URL.Path), zap.Error(err))
+		utils.WriteErr(w, err)
+		return
+	}
+	if key := extension.FromRequest(r).Key; key != nil {
+		if err := keyPermitsBackend(key, backend.Name); err != nil {
+			utils.WriteErr(w, err)
+			return
+		}
+	}
+	var target http.Handler
+	if cfg.Router != nil {
+		target, _, _ = cfg.Router.ByName(backend.Name)
+	}
+	if target == nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrNoBackend, "Backend %s is not initialized", backend.Name))
+		return
+	}
+
+	// Assistants and runs name a model, which may carry the backend's prefix
+	if body != nil {
+		if modelName, _ := payload["model"].(string); modelName != "" {
+			if other := assistantsModelBackend(cfg, backend, modelName); other != "" {
+				utils.WriteErr(w, utils.NewError(utils.ErrUnsupported,
+					"Backend %s does not serve the Assistants API; %s does", other, backend.Name))
+				return
+			}
+			if stripped, ok := strings.CutPrefix(modelName, backend.Prefix); ok && backend.Prefix != "" {
+				payload["model"] = stripped
+				if body, err = json.Marshal(payload); err != nil {
+					utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error re-marshalling request body"))
+					return
+				}
+			}
+		}
+		setBody(r, body)
+	}
+
+	logger.Info("Routing Assistants API request", zap.String("path", r.URL.Path), zap.String("backend", backend.Name))
+	if r.Method != http.MethodPost {
+		target.ServeHTTP(w, r)
+		return
+	}
+	// Remember where created objects live
+	capture := newCaptureWriter(w, cfg.Limits)
+	target.ServeHTTP(capture, r)
+	if capture.status < http.StatusBadRequest {
+		cfg.AssistantRoutes.Learn(backend.Name, capture.body)
+	}
+}
+
+// assistantsBackend returns the backend marked assistants that a request
+// belongs to
+func assistantsBackend(cfg *model.Config, r *http.Request, payload map[string]interface{}) (*model.BackendConfig, error) {
+	byName := func(name string) *model.BackendConfig {
+		for i := range cfg.Backends {
+			if cfg.Backends[i].Name == name && cfg.Backends[i].Assistants {
+				return &cfg.Backends[i]
+			}
+		}
+		return nil
+	}
+
+	// The assistant, thread or vector store the request names
+	var ids []string
+	if parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/"); len(parts) > 2 && assistants.IsObjectID(parts[2]) {
+		ids = append(ids, parts[2])
+	}
+	if id, _ := payload["assistant_id"].(string); id != "" {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		name, ok := cfg.AssistantBackends[id]
+		if !ok {
+			name, ok = cfg.AssistantRoutes.Backend(id)
+		}
+		if ok {
+			if backend := byName(name); backend != nil {
+				return backend, nil
+			}
+		}
+	}
+
+	var first *model.BackendConfig
+	modelName, _ := payload["model"].(string)
+	for i := range cfg.Backends {
+		backend := &cfg.Backends[i]
+		if !backend.Assistants {
+			continue
+		}
+		if modelName != "" && backend.Prefix != "" && strings.HasPrefix(modelName, backend.Prefix) {
+			return backend, nil
+		}
+		if first == nil {
+			first = backend
+		}
+	}
+	if first == nil {
+		return nil, utils.NewError(utils.ErrUnsupported,
+			"The Assistants API is only passed to a backend with \"assistants\": true, and none is configured")
+	}
+	return first, nil
+}
+
+// assistantsModelBackend returns the name of the backend not serving the
+// Assistants API whose prefix modelName carries, if any
+func assistantsModelBackend(cfg *model.Config, chosen *model.BackendConfig, modelName string) string {
+	if chosen.Prefix != "" && strings.HasPrefix(modelName, chosen.Prefix) {
+		return ""
+	}
+	for _, backend := range cfg.Backends {
+		if !backend.Assistants && backend.Prefix != "" && strings.HasPrefix(modelName, backend.Prefix) {
+			return backend.Name
+		}
+	}
+	return ""
+}
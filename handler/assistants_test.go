@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/assistants"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+// newAssistantsConfig sets up an OpenAI backend serving the Assistants API
+// next to a default local backend that must never see those requests
+func newAssistantsConfig(t *testing.T, openai http.Handler, assistants bool) (*model.Config, func()) {
+	upstream := httptest.NewServer(openai)
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected %s %s not to reach the local backend", r.Method, r.URL)
+	}))
+	backends := []model.BackendConfig{
+		{Name: "openai", BaseURL: upstream.URL, Prefix: "openai/", Assistants: assistants},
+		{Name: "ollama", BaseURL: local.URL, Prefix: "ollama/", Default: true},
+	}
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Backends: backends}
+	cfg.Router = proxy.NewRouter(cfg)
+	return cfg, func() {
+		upstream.Close()
+		local.Close()
+	}
+}
+
+func serveAssistants(cfg *model.Config, req *http.Request) *httptest.ResponseRecorder {
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	return rec
+}
+
+func TestAssistantsPassthrough(t *testing.T) {
+	var gotPath, gotQuery, gotBeta string
+	var gotBody map[string]interface{}
+	cfg, done := newAssistantsConfig(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotBeta = r.URL.Path, r.URL.RawQuery, r.Header.Get("OpenAI-Beta")
+		gotBody = nil
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &gotBody)
+		io.WriteString(w, `{"object":"list","data":[],"first_id":"msg_1","last_id":"msg_2","has_more":true}`)
+	}), true)
+	defer done()
+
+	req := httptest.NewRequest("GET", "/v1/threads/thread_1/messages?limit=2&after=msg_0&order=asc", nil)
+	req.Header.Set("OpenAI-Beta", "assistants=v2")
+	rec := serveAssistants(cfg, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"has_more":true`) {
+		t.Errorf("Expected the page to pass through, got %d %s", rec.Code, rec.Body.String())
+	}
+	if gotPath != "/v1/threads/thread_1/messages" || gotQuery != "limit=2&after=msg_0&order=asc" || gotBeta != "assistants=v2" {
+		t.Errorf("Expected path, pagination and beta header kept, got %s?%s %q", gotPath, gotQuery, gotBeta)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/assistants", strings.NewReader(`{"model":"openai/gpt-4o","name":"Helper"}`))
+	req.Header.Set("Content-Type", "application/json")
+	serveAssistants(cfg, req)
+	if gotBody["model"] != "gpt-4o" || gotBody["name"] != "Helper" {
+		t.Errorf("Expected the backend prefix stripped from the model, got %v", gotBody)
+	}
+
+	req = httptest.NewRequest("DELETE", "/v1/vector_stores/vs_1", nil)
+	serveAssistants(cfg, req)
+	if gotPath != "/v1/vector_stores/vs_1" {
+		t.Errorf("Expected the vector store request to reach openai, got %s", gotPath)
+	}
+}
+
+func TestAssistantsBlocked(t *testing.T) {
+	cfg, done := newAssistantsConfig(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected %s not to be proxied", r.URL)
+	}), false)
+	defer done()
+
+	rec := serveAssistants(cfg, httptest.NewRequest("GET", "/v1/assistants?limit=20", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "unsupported_endpoint") {
+		t.Errorf("Expected unsupported_endpoint without an assistants backend, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	cfg.Backends[0].Assistants = true
+	req := httptest.NewRequest("POST", "/v1/threads/thread_1/runs", strings.NewReader(`{"assistant_id":"asst_1","model":"ollama/llama3"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = serveAssistants(cfg, req)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "Backend ollama does not serve the Assistants API") {
+		t.Errorf("Expected a run on another backend's model to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAssistantsFileUpload(t *testing.T) {
+	var gotPurpose string
+	var gotFile []byte
+	cfg, done := newAssistantsConfig(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPurpose = r.FormValue("purpose")
+		if file, _, err := r.FormFile("file"); err == nil {
+			gotFile, _ = io.ReadAll(file)
+		}
+		io.WriteString(w, `{"id":"file_1","object":"file"}`)
+	}), true)
+	defer done()
+
+	content := bytes.Repeat([]byte("notes "), 4096)
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("purpose", "assistants")
+	part, _ := form.CreateFormFile("file", "notes.txt")
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/v1/files", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := serveAssistants(cfg, req)
+	if rec.Code != http.StatusOK || gotPurpose != "assistants" || !bytes.Equal(gotFile, content) {
+		t.Errorf("Expected the upload to reach openai intact, got %d purpose %q and %d bytes", rec.Code, gotPurpose, len(gotFile))
+	}
+
+	if !isAssistantsRequest(httptest.NewRequest("GET", "/v1/files?purpose=assistants", nil)) {
+		t.Errorf("Expected listing assistant files to go to the assistants backend")
+	}
+	if isAssistantsRequest(httptest.NewRequest("GET", "/v1/files?purpose=batch", nil)) {
+		t.Errorf("Expected other files to go to the default backend")
+	}
+}
+
+func TestAssistantsFollowTheBackendHoldingThem(t *testing.T) {
+	var seen []string
+	serve := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, name+" "+r.Method+" "+r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.URL.Path == "/v1/assistants" && r.Method == http.MethodPost:
+				io.WriteString(w, `{"id":"asst_`+name+`","object":"assistant"}`)
+			case r.URL.Path == "/v1/threads/runs":
+				io.WriteString(w, `{"id":"run_1","object":"thread.run","thread_id":"thread_`+name+`"}`)
+			default:
+				io.WriteString(w, `{"object":"list","data":[]}`)
+			}
+		}
+	}
+	openai := httptest.NewServer(serve("openai"))
+	defer openai.Close()
+	azure := httptest.NewServer(serve("azure"))
+	defer azure.Close()
+	backends := []model.BackendConfig{
+		{Name: "openai", BaseURL: openai.URL, Prefix: "openai/", Assistants: true, Default: true},
+		{Name: "azure", BaseURL: azure.URL, Prefix: "azure/", Assistants: true},
+	}
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Backends: backends,
+		AssistantBackends: map[string]string{"asst_legacy": "azure"}, AssistantRoutes: assistants.New()}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	post := func(path, body string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if rec := serveAssistants(cfg, req); rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: got %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	get := func(path string) {
+		if rec := serveAssistants(cfg, httptest.NewRequest("GET", path, nil)); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: got %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	post("/v1/assistants", `{"model":"azure/gpt-4o","name":"helper"}`)
+	get("/v1/assistants/asst_azure")
+	post("/v1/threads/runs", `{"assistant_id":"asst_azure"}`)
+	get("/v1/threads/thread_azure/messages")
+	get("/v1/assistants/asst_legacy")
+	get("/v1/assistants")
+
+	want := []string{
+		"azure POST /v1/assistants",
+		"azure GET /v1/assistants/asst_azure",
+		"azure POST /v1/threads/runs",
+		"azure GET /v1/threads/thread_azure/messages",
+		"azure GET /v1/assistants/asst_legacy",
+		"openai GET /v1/assistants",
+	}
+	if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected routing:\n%s", strings.Join(seen, "\n"))
+	}
+}
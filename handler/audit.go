@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// auditExchange appends a served request to the audit log, with the token
+// usage the backend reported or, failing that, the counted prompt tokens
+func auditExchange(cfg *model.Config, r *http.Request, rc *extension.RequestContext, start time.Time, capture *captureWriter, body []byte, hash string) {
+	entry := audit.Entry{
+		Time:        start.UTC(),
+		ID:          rc.ID,
+		KeyID:       rc.KeyID,
+		KeyName:     keyName(rc),
+		Model:       rc.Model,
+		Backend:     rc.Backend,
+		Path:        r.URL.Path,
+		RequestHash: hash,
+		Status:      capture.status,
+		DurationMS:  time.Since(start).Milliseconds(),
+		Outcome:     rc.Outcome,
+	}
+	entry.PromptTokens, entry.CompletionTokens, entry.TotalTokens, entry.Estimated = exchangeUsage(rc, capture)
+	if rc.Price != nil {
+		entry.CostUSD = rc.Price.Cost(entry.PromptTokens, entry.CompletionTokens)
+	}
+	if cfg.AuditLog.Bodies() {
+		entry.Request = rawJSON(body)
+		entry.Response = rawJSON(capture.body)
+	}
+	if err := cfg.AuditLog.Record(entry); err != nil {
+		cfg.Logger.Error("Failed to write audit log", zap.String("requestID", rc.ID), zap.Error(err))
+	}
+}
+
+// exchangeUsage returns the token usage the backend reported or, failing
+// that, the counted prompt tokens, and whether it is estimated
+func exchangeUsage(rc *extension.RequestContext, capture *captureWriter) (prompt, completion, total int, estimated bool) {
+	prompt, completion, total, err := audit.Usage(capture.body)
+	if errors.Is(err, audit.ErrNoUsage) && rc.TokensEstimate > 0 {
+		return rc.TokensEstimate, 0, rc.TokensEstimate, true
+	}
+	return prompt, completion, total, rc.UsageEstimated
+}
+
+// keyName returns the name of the request's API key, empty for the router key
+func keyName(rc *extension.RequestContext) string {
+	if rc.Key == nil {
+		return ""
+	}
+	return rc.Key.Name
+}
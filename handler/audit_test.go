@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/usage"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+func TestAuditLogRecordsBackendAndUsage(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`)
+	})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, false)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %s", err)
+	}
+	defer auditLog.Close()
+	cfg.AuditLog = auditLog
+	cfg.ModelPrices = map[string]model.ModelPrice{"up/llama3": {Input: 1, Output: 2}}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"up/llama3","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	entries, err := audit.Read(path, audit.Query{Model: "llama3"})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected one entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.ID != rec.Header().Get("X-Router-Request-ID") || e.Backend != "up" || e.Status != http.StatusOK {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if e.PromptTokens != 12 || e.CompletionTokens != 3 || e.TotalTokens != 15 {
+		t.Errorf("Expected usage 12/3/15, got %d/%d/%d", e.PromptTokens, e.CompletionTokens, e.TotalTokens)
+	}
+	if e.Request != nil || e.Response != nil {
+		t.Errorf("Expected bodies to be left out")
+	}
+	if hash, _ := utils.RequestHash([]byte(`{"messages":[{"content":"hello","role":"user"}],"model":"up/llama3"}`)); e.RequestHash != hash {
+		t.Errorf("Expected the request hash %s recorded, got %q", hash, e.RequestHash)
+	}
+	if got := rec.Header().Get("X-Router-Cost"); got != "0.018000" || e.CostUSD != 0.018 {
+		t.Errorf("Expected a cost of $0.018 in the header and entry, got %q and %v", got, e.CostUSD)
+	}
+}
+
+func TestUsageReportExactAndExported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, false)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %s", err)
+	}
+	defer auditLog.Close()
+	auditLog.Record(audit.Entry{Time: time.Now(), KeyID: "k1", PromptTokens: 1234, CompletionTokens: 66, TotalTokens: 1300})
+
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", AuditLog: auditLog,
+		Audit: model.AuditConfig{Path: path}, UsageReport: model.UsageReportConfig{Bucket: 1000}}
+	get := func(path string) usage.Report {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		var report usage.Report
+		json.Unmarshal(rec.Body.Bytes(), &report)
+		return report
+	}
+
+	if exact := get("/router/usage?since=1h"); len(exact.Keys) != 1 || exact.Keys[0].PromptTokens != 1234 || exact.Privatized {
+		t.Errorf("Unexpected exact report %+v", exact)
+	}
+	if exported := get("/router/usage/export"); len(exported.Keys) != 1 || exported.Keys[0].PromptTokens != 1000 || !exported.Privatized {
+		t.Errorf("Unexpected exported report %+v", exported)
+	}
+}
+
+func TestUsageReportPeriodsFollowTimezone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, false)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %s", err)
+	}
+	defer auditLog.Close()
+	// 23:00 on January 31 and 01:00 on February 1 in Tokyo are the same UTC day
+	auditLog.Record(audit.Entry{Time: time.Date(2024, 1, 31, 14, 0, 0, 0, time.UTC), KeyID: "k1", TotalTokens: 1})
+	auditLog.Record(audit.Entry{Time: time.Date(2024, 1, 31, 16, 0, 0, 0, time.UTC), KeyID: "k1", TotalTokens: 2})
+	auditLog.Record(audit.Entry{Time: time.Date(2024, 2, 2, 16, 0, 0, 0, time.UTC), KeyID: "k1", TotalTokens: 4})
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", AuditLog: auditLog,
+		Audit: model.AuditConfig{Path: path}, Location: tokyo}
+	req := httptest.NewRequest("GET", "/router/usage?since=2024-01-31&until=2024-02-02&period=day", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	var report usage.Report
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if len(report.Periods) != 2 || report.Keys[0].TotalTokens != 3 {
+		t.Fatalf("Expected two Tokyo days, got %s", rec.Body.String())
+	}
+	if !report.Periods[1].Start.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, tokyo)) || report.Periods[1].Keys[0].TotalTokens != 2 {
+		t.Errorf("Unexpected second day %+v", report.Periods[1])
+	}
+
+	req = httptest.NewRequest("GET", "/router/usage?period=week", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec = httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown period to be refused, got %d", rec.Code)
+	}
+}
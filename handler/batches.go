@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/batch"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// defaultBatchConcurrency is how many requests of a batch are sent at a time
+// unless configured
+const defaultBatchConcurrency = 4
+
+// isBatchRequest reports whether a request is for the emulated Batch API:
+// batches, uploads for the batch purpose and the files kept by the router
+func isBatchRequest(cfg *model.Config, r *http.Request) bool {
+	switch {
+	case r.URL.Path == "/v1/batches" || strings.HasPrefix(r.URL.Path, "/v1/batches/"):
+		return true
+	case r.URL.Path == "/v1/files":
+		return r.Method == http.MethodPost && uploadPurpose(r) == batch.PurposeBatch
+	case strings.HasPrefix(r.URL.Path, "/v1/files/"):
+		id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/files/"), "/")
+		return cfg.BatchStore.HasFile(id)
+	}
+	return false
+}
+
+// handleBatches serves the Batch API and the files it uses. Files and
+// batches belong to the key that created them.
+func handleBatches(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	store := cfg.BatchStore
+	owner := extension.FromRequest(r).KeyID
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"), "/")
+
+	switch {
+	case parts[0] == "files" && len(parts) == 1:
+		uploadBatchFile(w, r, cfg)
+	case parts[0] == "files" && len(parts) == 2 && r.Method == http.MethodGet:
+		f, err := store.File(owner, parts[1])
+		writeBatchResult(w, f, err)
+	case parts[0] == "files" && len(parts) == 2 && r.Method == http.MethodDelete:
+		err := store.DeleteFile(owner, parts[1])
+		writeBatchResult(w, map[string]interface{}{"id": parts[1], "object": "file", "deleted": err == nil}, err)
+	case parts[0] == "files" && len(parts) == 3 && parts[2] == "content" && r.Method == http.MethodGet:
+		content, err := store.Content(owner, parts[1])
+		if err != nil {
+			writeBatchResult(w, nil, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(content)
+	case parts[0] == "batches" && len(parts) == 1 && r.Method == http.MethodPost:
+		createBatch(w, r, cfg)
+	case parts[0] == "batches" && len(parts) == 1 && r.Method == http.MethodGet:
+		listBatches(w, r, store, owner)
+	case parts[0] == "batches" && len(parts) == 2 && r.Method == http.MethodGet:
+		b, err := store.Batch(owner, parts[1])
+		writeBatchResult(w, b, err)
+	case parts[0] == "batches" && len(parts) == 3 && parts[2] == "cancel" && r.Method == http.MethodPost:
+		b, err := store.Cancel(owner, parts[1])
+		if err == nil {
+			cfg.Logger.Info("Batch cancelled", zap.String("batch", b.ID), zap.String("keyID", owner))
+		}
+		writeBatchResult(w, b, err)
+	default:
+		utils.WriteErr(w, utils.NewError(utils.ErrUnsupported, "%s %s is not supported by the emulated Batch API", r.Method, r.URL.Path))
+	}
+}
+
+// uploadBatchFile keeps a file uploaded for batches
+func uploadBatchFile(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "The file is missing"))
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading the file"))
+		return
+	}
+	f, err := cfg.BatchStore.AddFile(extension.FromRequest(r).KeyID, header.Filename, batch.PurposeBatch, content)
+	if err != nil {
+		cfg.Logger.Error("Failed to store batch file", zap.Error(err))
+	}
+	writeBatchResult(w, f, err)
+}
+
+// createBatch validates a new batch and starts it in the background
+func createBatch(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	var req struct {
+		InputFileID      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Error unmarshalling request body"))
+		return
+	}
+	if !batch.ValidEndpoint(req.Endpoint) {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "endpoint must be one of %s", strings.Join(batch.Endpoints, ", ")))
+		return
+	}
+	if req.CompletionWindow != "24h" {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "completion_window must be 24h"))
+		return
+	}
+	owner := extension.FromRequest(r).KeyID
+	if f, err := cfg.BatchStore.File(owner, req.InputFileID); err != nil || f.Purpose != batch.PurposeBatch {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "input_file_id %s is not a file uploaded for batches", req.InputFileID))
+		return
+	}
+
+	b, err := cfg.BatchStore.Create(owner, batch.Batch{
+		InputFileID:      req.InputFileID,
+		Endpoint:         req.Endpoint,
+		CompletionWindow: req.CompletionWindow,
+		Metadata:         req.Metadata,
+	})
+	if err != nil {
+		cfg.Logger.Error("Failed to create batch", zap.Error(err))
+		writeBatchResult(w, nil, err)
+		return
+	}
+	concurrency := cfg.Batches.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	cfg.BatchStore.Start(owner, b.ID, concurrency, batchExecutor(cfg, r))
+	cfg.Logger.Info("Batch created", zap.String("batch", b.ID), zap.String("keyID", owner),
+		zap.String("endpoint", b.Endpoint), zap.String("inputFile", b.InputFileID))
+	writeBatchResult(w, b, nil)
+}
+
+// listBatches lists the client's batches, newest first, a page at a time
+func listBatches(w http.ResponseWriter, r *http.Request, store *batch.Store, owner string) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, more := store.List(owner, r.URL.Query().Get("after"), limit)
+	page := map[string]interface{}{"object": "list", "data": batches, "has_more": more}
+	if batches == nil {
+		page["data"] = []batch.Batch{}
+	}
+	if len(batches) > 0 {
+		page["first_id"], page["last_id"] = batches[0].ID, batches[len(batches)-1].ID
+	}
+	writeBatchResult(w, page, nil)
+}
+
+// batchExecutor sends the requests of a batch through the router as if the
+// client that created it had sent them, so they are routed, limited and
+// audited like any other
+func batchExecutor(cfg *model.Config, r *http.Request) batch.Executor {
+	handler := NewHandler(cfg)
+	header := r.Header.Clone()
+	for _, name := range []string{"Content-Type", "Content-Length"} {
+		header.Del(name)
+	}
+	remoteAddr := r.RemoteAddr
+
+	return func(ctx context.Context, req batch.Request) batch.Response {
+		inner, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+		if err != nil {
+			return batch.Response{StatusCode: http.StatusBadRequest}
+		}
+		inner.Header = header.Clone()
+		inner.Header.Set("Content-Type", "application/json")
+		inner.RemoteAddr = remoteAddr
+
+		response := newBufferedResponse()
+		handler.ServeHTTP(response, inner)
+		body := response.body.Bytes()
+		if !json.Valid(body) {
+			body, _ = json.Marshal(string(body))
+		}
+		return batch.Response{
+			StatusCode: max(response.status, http.StatusOK),
+			RequestID:  response.header.Get("X-Router-Request-ID"),
+			Body:       body,
+		}
+	}
+}
+
+// writeBatchResult writes a Batch API object, or the error getting it
+func writeBatchResult(w http.ResponseWriter, v interface{}, err error) {
+	if errors.Is(err, batch.ErrNotFound) {
+		utils.WriteErr(w, utils.NewError(utils.ErrNotFound, "No such file or batch"))
+		return
+	}
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "The batch store failed"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/batch"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestBatchAPIRunsRequestsThroughRoutedBackends(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "llama3" {
+			t.Errorf("Expected the prefix to be stripped, got %v", body["model"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"chat.completion","choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	})
+	store, err := batch.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	cfg.BatchStore = store
+
+	send := func(method, path, contentType string, body io.Reader) []byte {
+		t.Helper()
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Authorization", "Bearer router-key")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d %s", method, path, rec.Code, rec.Body.String())
+		}
+		return rec.Body.Bytes()
+	}
+	object := func(data []byte) map[string]interface{} {
+		var out map[string]interface{}
+		json.Unmarshal(data, &out)
+		return out
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("purpose", "batch")
+	part, _ := writer.CreateFormFile("file", "input.jsonl")
+	io.WriteString(part, `{"custom_id":"q1","method":"POST","url":"/v1/chat/completions","body":{"model":"up/llama3","messages":[{"role":"user","content":"hi"}]}}`+"\n")
+	writer.Close()
+	file := object(send("POST", "/v1/files", writer.FormDataContentType(), &form))
+	if file["purpose"] != "batch" {
+		t.Fatalf("Expected a batch file, got %v", file)
+	}
+
+	created := object(send("POST", "/v1/batches", "application/json", strings.NewReader(
+		`{"input_file_id":"`+file["id"].(string)+`","endpoint":"/v1/chat/completions","completion_window":"24h"}`)))
+	id := created["id"].(string)
+
+	var done map[string]interface{}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if done = object(send("GET", "/v1/batches/"+id, "", nil)); done["status"] == "completed" {
+			break
+		}
+	}
+	if done["status"] != "completed" {
+		t.Fatalf("Expected the batch to complete, got %v", done)
+	}
+	output := send("GET", "/v1/files/"+done["output_file_id"].(string)+"/content", "", nil)
+	var result batch.Result
+	json.Unmarshal(output, &result)
+	if result.CustomID != "q1" || result.Response.StatusCode != 200 || !strings.Contains(string(result.Response.Body), "chat.completion") {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	list := object(send("GET", "/v1/batches?limit=5", "", nil))
+	if data, _ := list["data"].([]interface{}); len(data) != 1 || list["first_id"] != id {
+		t.Errorf("Expected the batch to be listed, got %v", list)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+// benchChatBody is a typical Cursor request: a system prompt, some history and code context
+var benchChatBody = []byte(fmt.Sprintf(`{"model":"up/llama3","stream":true,"temperature":0.2,"messages":[`+
+	`{"role":"system","content":%q},{"role":"user","content":%q},{"role":"assistant","content":"Sure."},{"role":"user","content":%q}]}`,
+	strings.Repeat("You are a helpful coding assistant. ", 20),
+	strings.Repeat("func main() { fmt.Println(\"hello\") }\n", 200),
+	"Explain this code."))
+
+// BenchmarkModelRequestRouting measures parsing, routing and re-encoding a chat
+// request, with the backend replaced by a stub
+func BenchmarkModelRequestRouting(b *testing.B) {
+	stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	})
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Router: stubRouter{stub}}
+
+	b.SetBytes(int64(len(benchChatBody)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(benchChatBody))
+		req.Header.Set("Authorization", "Bearer router-key")
+		HandleRequest(cfg, httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkStreamingPassthrough measures a full streamed completion of 200
+// chunks through the reverse proxy to a local upstream
+func BenchmarkStreamingPassthrough(b *testing.B) {
+	var stream bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&stream, "data: {\"choices\":[{\"delta\":{\"content\":\"token%d \"}}]}\n\n", i)
+	}
+	stream.WriteString("data: [DONE]\n\n")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write(stream.Bytes())
+	}))
+	defer upstream.Close()
+
+	backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "up", BaseURL: upstream.URL, Prefix: "up/"}}, Logger: zap.NewNop()})
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key"}
+	cfg.Router = backendRouter
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleRequest(cfg, w, r)
+	}))
+	defer router.Close()
+
+	b.SetBytes(int64(stream.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest("POST", router.URL+"/v1/chat/completions", bytes.NewReader(benchChatBody))
+		req.Header.Set("Authorization", "Bearer router-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/utils"
+	"github.com/kcolemangt/llm-router/vision"
+	"go.uber.org/zap"
+)
+
+// capabilitiesFor returns what a model supports: the first configured entry
+// matching it, or what its backend reports if it probes capabilities
+func capabilitiesFor(cfg *model.Config, modelName string) *model.ModelCapabilityConfig {
+	for i, capabilities := range cfg.Capabilities {
+		if matchesAny(capabilities.Models, modelName) {
+			return &cfg.Capabilities[i]
+		}
+	}
+	router, ok := cfg.Router.(*proxy.Router)
+	if !ok {
+		return nil
+	}
+	_, name, prefix, ok := router.Match(modelName)
+	if !ok {
+		_, name = router.Default()
+	}
+	for _, backend := range cfg.Backends {
+		if backend.Name != name || !backend.ProbeCapabilities {
+			continue
+		}
+		capabilities, err := router.ModelCapabilities(backend, strings.TrimPrefix(modelName, prefix))
+		if err != nil {
+			cfg.Logger.Debug("Failed to probe model capabilities", zap.String("backend", name), zap.String("model", modelName), zap.Error(err))
+		}
+		return capabilities
+	}
+	return nil
+}
+
+// adaptToCapabilities checks a request against what its model supports.
+// Requests using capabilities the model lacks are refused, or changed to do
+// without them if the model's capabilities allow adapting. It returns the
+// changes made.
+func adaptToCapabilities(r *http.Request, capabilities *model.ModelCapabilityConfig, chatReq map[string]interface{}, modelName string) ([]string, error) {
+	if capabilities == nil {
+		return nil, nil
+	}
+	lacks := func(supported *bool) bool { return supported != nil && !*supported }
+	format, _ := chatReq["response_format"].(map[string]interface{})
+	stream, _ := chatReq["stream"].(bool)
+	_, functions := chatReq["functions"]
+
+	var missing, changes []string
+	if lacks(capabilities.Tools) && (functions || len(asSlice(chatReq["tools"])) > 0) {
+		missing = append(missing, "tools")
+		changes = append(changes, "tools_removed")
+	}
+	if lacks(capabilities.Vision) && vision.HasImages(chatReq) {
+		missing = append(missing, "images")
+		changes = append(changes, "images_removed")
+	}
+	if lacks(capabilities.JSONMode) && (format["type"] == "json_object" || format["type"] == "json_schema") {
+		missing = append(missing, "JSON mode")
+		changes = append(changes, "json_mode_emulated")
+	}
+	if lacks(capabilities.Streaming) && stream {
+		missing = append(missing, "streaming")
+		changes = append(changes, "stream_emulated")
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	// Only chat completions can be answered as a stream the router assembles
+	if !capabilities.Adapt || stream && lacks(capabilities.Streaming) && r.URL.Path != "/v1/chat/completions" {
+		return nil, utils.NewError(utils.ErrCapability, "Model %s does not support %s", modelName, strings.Join(missing, ", "))
+	}
+
+	for _, change := range changes {
+		switch change {
+		case "tools_removed":
+			for _, param := range []string{"tools", "tool_choice", "parallel_tool_calls", "functions", "function_call"} {
+				delete(chatReq, param)
+			}
+		case "images_removed":
+			vision.Adapt(chatReq, vision.ModeStrip, 0)
+		case "json_mode_emulated":
+			instruction := "Respond only with valid JSON, without any other text."
+			if schema, ok := format["json_schema"].(map[string]interface{}); ok {
+				encoded, _ := json.Marshal(schema["schema"])
+				instruction += " The JSON must match this schema: " + string(encoded)
+			}
+			delete(chatReq, "response_format")
+			messages := append([]interface{}{map[string]interface{}{"role": "system", "content": instruction}}, utils.Messages(chatReq)...)
+			if _, ok := chatReq["messages"]; ok {
+				chatReq["messages"] = messages
+			}
+		case "stream_emulated":
+			chatReq["stream"] = false
+			delete(chatReq, "stream_options")
+		}
+	}
+	return changes, nil
+}
+
+// asSlice returns v if it is a JSON array
+func asSlice(v interface{}) []interface{} {
+	slice, _ := v.([]interface{})
+	return slice
+}
+
+// streamCompletion sends a whole chat completion as the stream the client
+// asked for, with usage if it asked for that too
+func streamCompletion(w http.ResponseWriter, response *bufferedResponse, includeUsage bool) {
+	var completion map[string]interface{}
+	if response.status != http.StatusOK || json.Unmarshal(response.body.Bytes(), &completion) != nil {
+		response.writeTo(w)
+		return
+	}
+	for key, values := range response.header {
+		if key != "Content-Length" && key != "Content-Type" {
+			w.Header()[key] = values
+		}
+	}
+
+	chunk := func(choices []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id": completion["id"], "object": "chat.completion.chunk", "created": completion["created"], "model": completion["model"], "choices": choices,
+		}
+	}
+	var chunks []interface{}
+	for _, c := range asSlice(completion["choices"]) {
+		choice, _ := c.(map[string]interface{})
+		message, _ := choice["message"].(map[string]interface{})
+		delta := map[string]interface{}{"role": "assistant", "content": message["content"]}
+		if calls := asSlice(message["tool_calls"]); len(calls) > 0 {
+			for i, call := range calls {
+				if call, ok := call.(map[string]interface{}); ok {
+					call["index"] = i
+				}
+			}
+			delta["tool_calls"] = calls
+		}
+		chunks = append(chunks,
+			chunk([]interface{}{map[string]interface{}{"index": choice["index"], "delta": delta, "finish_reason": nil}}),
+			chunk([]interface{}{map[string]interface{}{"index": choice["index"], "delta": map[string]interface{}{}, "finish_reason": choice["finish_reason"]}}))
+	}
+	if usage, ok := completion["usage"]; ok && includeUsage {
+		last := chunk([]interface{}{})
+		last["usage"] = usage
+		chunks = append(chunks, last)
+	}
+	writeEvents(w, chunks...)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+)
+
+func sendChat(cfg *model.Config, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	return rec
+}
+
+func TestCapabilitiesRefuseUnsupported(t *testing.T) {
+	no := false
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The request should not reach the backend")
+	})
+	cfg.Capabilities = []model.ModelCapabilityConfig{{Models: []string{"up/*"}, Tools: &no, Vision: &no}}
+
+	rec := sendChat(cfg, `{"model": "up/tiny", "tools": [{"type": "function", "function": {"name": "f"}}], "messages": [{"role": "user", "content": "hi"}]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unsupported_capability") || !strings.Contains(rec.Body.String(), "does not support tools") {
+		t.Errorf("Expected the request to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCapabilitiesAdapt(t *testing.T) {
+	no := false
+	var got map[string]interface{}
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"tiny","choices":[{"index":0,"message":{"role":"assistant","content":"{\"ok\":true}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	})
+	cfg.Capabilities = []model.ModelCapabilityConfig{{Models: []string{"up/*"}, Tools: &no, JSONMode: &no, Streaming: &no, Adapt: true}}
+
+	rec := sendChat(cfg, `{"model": "up/tiny", "stream": true, "stream_options": {"include_usage": true},
+		"tools": [{"type": "function", "function": {"name": "f"}}], "response_format": {"type": "json_object"},
+		"messages": [{"role": "user", "content": "hi"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got["tools"] != nil || got["response_format"] != nil || got["stream"] != false || got["stream_options"] != nil {
+		t.Errorf("Expected the request adapted, got %v", got)
+	}
+	if first := got["messages"].([]interface{})[0].(map[string]interface{}); first["role"] != "system" || !strings.Contains(first["content"].(string), "JSON") {
+		t.Errorf("Expected a JSON instruction, got %v", first)
+	}
+	if adapted := rec.Header().Get("X-Router-Adapted"); adapted != "tools_removed, json_mode_emulated, stream_emulated" {
+		t.Errorf("Unexpected adaptations %q", adapted)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"delta":{"content":"{\"ok\":true}","role":"assistant"}`) || !strings.Contains(body, `"total_tokens":5`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Expected the answer as a stream, got %s", body)
+	}
+}
+
+func TestCapabilitiesProbed(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/show" {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		io.WriteString(w, `{"capabilities": ["completion"], "model_info": {"llama.context_length": 64}}`)
+	}))
+	t.Cleanup(ollama.Close)
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {})
+	cfg.Backends = []model.BackendConfig{{Name: "probed", BaseURL: ollama.URL, Prefix: "probed/", ProbeCapabilities: true}}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	rec := sendChat(cfg, `{"model": "probed/llama3", "tools": [{"type": "function", "function": {"name": "f"}}], "messages": [{"role": "user", "content": "hi"}]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "does not support tools") {
+		t.Errorf("Expected tools to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = sendChat(cfg, `{"model": "probed/llama3", "max_tokens": 100, "messages": [{"role": "user", "content": "hi"}]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "context_length_exceeded") {
+		t.Errorf("Expected the context length to be checked, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
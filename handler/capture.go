@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/capture"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// captureExchanges records every request and its response to the capture
+// file when the router runs with -capture
+func captureExchanges(cfg *model.Config) extension.Middleware {
+	return func(next http.Handler) http.Handler {
+		if cfg.Capture == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			body := &teeBody{ReadCloser: r.Body, limit: recordedLimit(cfg.Limits)}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			timed := &timedWriter{captureWriter: newCaptureWriter(w, cfg.Limits), start: start}
+			next.ServeHTTP(timed, r)
+
+			status := timed.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			err := cfg.Capture.Record(capture.Exchange{
+				ID:        w.Header().Get("X-Router-Request-ID"),
+				Request:   r,
+				Body:      body.data,
+				Status:    status,
+				Header:    w.Header(),
+				Response:  timed.body,
+				Truncated: timed.truncated,
+				Start:     start,
+				FirstByte: timed.firstByte,
+				Duration:  time.Since(start),
+			})
+			if err != nil {
+				cfg.Logger.Warn("Failed to capture exchange", zap.Error(err))
+			}
+		})
+	}
+}
+
+// recordedLimit is how much of a body is kept for recording
+func recordedLimit(limits model.LimitsConfig) int {
+	if limits.RecordedResponseBytes > 0 {
+		return limits.RecordedResponseBytes
+	}
+	return defaultRecordedResponse
+}
+
+// teeBody keeps a copy of what the handlers read of a request body, so bodies
+// are still bounded by the limits the handlers enforce
+type teeBody struct {
+	io.ReadCloser
+	limit int
+	data  []byte
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if room := t.limit - len(t.data); room > 0 {
+		t.data = append(t.data, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+// timedWriter notes when the response started
+type timedWriter struct {
+	*captureWriter
+	start     time.Time
+	firstByte time.Duration
+}
+
+func (t *timedWriter) WriteHeader(status int) {
+	t.mark()
+	t.captureWriter.WriteHeader(status)
+}
+
+func (t *timedWriter) Write(p []byte) (int, error) {
+	t.mark()
+	return t.captureWriter.Write(p)
+}
+
+func (t *timedWriter) mark() {
+	if t.firstByte == 0 {
+		t.firstByte = time.Since(t.start)
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/capture"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestCaptureRecordsExchanges(t *testing.T) {
+	cfg := keyLimitConfig(t, model.APIKeyConfig{Name: "ci", Key: "ci-key"})
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	w, err := capture.Open(path, "test", func(s string) string { return s })
+	if err != nil {
+		t.Fatalf("Failed to open capture: %s", err)
+	}
+	cfg.Capture = w
+
+	rec := sendAs(cfg, "ci-key")
+	w.Close()
+
+	data, _ := os.ReadFile(path)
+	var e capture.Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("Invalid capture: %s\n%s", err, data)
+	}
+	if strings.Contains(string(data), "ci-key") {
+		t.Errorf("Key leaked into the capture: %s", data)
+	}
+	if e.Comment != rec.Header().Get("X-Router-Request-ID") || e.Response.Status != 200 {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+	if e.Request.PostData == nil || !strings.Contains(e.Request.PostData.Text, `"openai/gpt-4o"`) {
+		t.Errorf("Expected the request body, got %+v", e.Request.PostData)
+	}
+	if !strings.Contains(e.Response.Content.Text, `"prompt_tokens":1000`) {
+		t.Errorf("Expected the response body, got %q", e.Response.Content.Text)
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// clientCertIdentities returns the common name and subject alternative names
+// of the client certificate r was sent with, if the listener verified it
+func clientCertIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+// keyPresented reports whether r carries everything key requires: its bearer
+// key, its client certificate, or both if it has both
+func keyPresented(key model.APIKeyConfig, r *http.Request) bool {
+	if key.Key == "" && key.ClientCert == "" {
+		return false
+	}
+	if key.Key != "" && requestAuthorization(r) != "Bearer "+key.Key {
+		return false
+	}
+	return key.ClientCert == "" || slices.Contains(clientCertIdentities(r), key.ClientCert)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestClientCertKeys(t *testing.T) {
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		APIKeys: []model.APIKeyConfig{
+			{Name: "ci", ClientCert: "ci-runner"},
+			{Name: "deploy", Key: "deploy-key", ClientCert: "deploy.example.com"},
+		},
+	}
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	ciCert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci-runner"}}
+	deployCert := &x509.Certificate{Subject: pkix.Name{CommonName: "deploy"}, DNSNames: []string{"deploy.example.com"}}
+	otherCert := &x509.Certificate{Subject: pkix.Name{CommonName: "laptop"}}
+
+	tests := []struct {
+		name   string
+		key    string
+		tls    *tls.ConnectionState
+		status int
+	}{
+		{"certificate alone", "", verified(ciCert), http.StatusOK},
+		{"certificate and key", "deploy-key", verified(deployCert), http.StatusOK},
+		{"key without its certificate", "deploy-key", verified(otherCert), http.StatusUnauthorized},
+		{"certificate without its key", "", verified(deployCert), http.StatusUnauthorized},
+		{"unverified certificate", "", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{ciCert}}, http.StatusUnauthorized},
+		{"router key", "router-key", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/router/info", nil)
+		req.TLS = tt.tls
+		if tt.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestOnlyTheRouterKeyIsForwarded(t *testing.T) {
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		APIKeys: []model.APIKeyConfig{
+			{Name: "ci", ClientCert: "ci-runner"},
+			{Name: "deploy", Key: "deploy-key"},
+		},
+	}
+	cfg.Router = proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{
+		{Name: "openai", BaseURL: upstream.URL, Prefix: "openai/", Default: true, RequireAPIKey: true},
+	}, Logger: cfg.Logger})
+
+	send := func(key string, state *tls.ConnectionState) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.TLS = state
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec.Code
+	}
+	ciCert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci-runner"}}
+	if status := send("", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{ciCert}}}); status != http.StatusInternalServerError {
+		t.Errorf("Expected a certificate-only client refused without a key to send, got %d", status)
+	}
+	if status := send("deploy-key", nil); status != http.StatusInternalServerError {
+		t.Errorf("Expected a named key refused rather than forwarded, got %d", status)
+	}
+	if len(received) != 0 {
+		t.Errorf("Expected no request to reach the backend, got %q", received)
+	}
+	if status := send("router-key", nil); status != http.StatusOK || len(received) != 1 || received[0] != "Bearer router-key" {
+		t.Errorf("Expected the router key forwarded, got %d %q", status, received)
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestResponsesAreCompressedForClientsAcceptingGzip(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"llama3","choices":[{"message":{"content":"hello"}}]}`)
+	})
+
+	send := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"up/llama3","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	rec := send("gzip, br")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip response, got headers %v", rec.Header())
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(reader)
+	// The body was decompressed from the backend and rewritten before compression
+	if !strings.Contains(string(body), `"model":"up/llama3"`) {
+		t.Errorf("Expected the rewritten body, got %s", body)
+	}
+
+	rec = send("gzip;q=0")
+	if rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), "hello") {
+		t.Errorf("Expected a plain response when gzip is refused, got %v %q", rec.Header(), rec.Body.String())
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, GZIP;q=0.5": true,
+		"br":                  false,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"gzip; q=0.0, br":     false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
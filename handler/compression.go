@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/summary"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// defaultKeepRecent is how many of the latest messages are kept verbatim when
+// a compression entry does not say
+const defaultKeepRecent = 6
+
+const summaryInstructions = "Summarize the conversation below so an assistant can continue it without the original. " +
+	"Keep decisions, facts, names, file paths, code identifiers and open questions. Reply with the summary only."
+
+// compressionFor returns the first compression entry matching a model, if any
+func compressionFor(cfg *model.Config, modelName string) *model.CompressionConfig {
+	for i, compression := range cfg.Compression {
+		for _, glob := range compression.Models {
+			if ok, _ := path.Match(glob, modelName); ok {
+				return &cfg.Compression[i]
+			}
+		}
+	}
+	return nil
+}
+
+// compressHistory replaces the older turns of a conversation that exceeds the
+// model's compression threshold with a summary written by the summary model,
+// keeping system messages and the latest messages as they are. A summary that
+// cannot be written leaves the request unchanged. It returns how many
+// messages were replaced.
+func compressHistory(r *http.Request, cfg *model.Config, chatReq map[string]interface{}, modelName string, logger *zap.Logger) int {
+	compression := compressionFor(cfg, modelName)
+	if compression == nil || compression.ThresholdTokens <= 0 || compression.SummaryModel == "" {
+		return 0
+	}
+	key := "messages"
+	if _, ok := chatReq[key].([]interface{}); !ok {
+		key = "input"
+	}
+	messages, ok := chatReq[key].([]interface{})
+	if !ok {
+		return 0
+	}
+
+	tokens := 0
+	for _, m := range messages {
+		tokens += cfg.TokenizerSet.Count(modelName, utils.MessageText(m)) + messageOverhead
+	}
+	if tokens <= compression.ThresholdTokens {
+		return 0
+	}
+
+	keep := compression.KeepRecent
+	if keep <= 0 {
+		keep = defaultKeepRecent
+	}
+	// Tool results stay with the call they answer
+	split := len(messages) - keep
+	for split > 0 && isToolResult(messages[split]) {
+		split--
+	}
+	var system, older []interface{}
+	for _, m := range messages[:max(split, 0)] {
+		if role := messageRole(m); role == "system" || role == "developer" {
+			system = append(system, m)
+		} else {
+			older = append(older, m)
+		}
+	}
+	if len(older) < 2 {
+		return 0
+	}
+
+	// Start from the summary of the longest prefix already summarized
+	keys := summary.Keys(older)
+	previous, start := "", 0
+	for i := len(keys) - 1; i >= 0; i-- {
+		if text, ok := cfg.Summaries.Get(keys[i]); ok {
+			previous, start = text, i+1
+			break
+		}
+	}
+	text := previous
+	if start < len(older) {
+		var err error
+		text, err = summarize(r, cfg, compression.SummaryModel, previous, older[start:], logger)
+		if err != nil {
+			logger.Warn("Could not summarize the conversation, sending it whole",
+				zap.String("summaryModel", compression.SummaryModel), zap.Error(err))
+			return 0
+		}
+		cfg.Summaries.Put(keys[len(keys)-1], text)
+	}
+
+	compressed := append(system, map[string]interface{}{
+		"role":    "system",
+		"content": "Summary of the earlier conversation:\n\n" + text,
+	})
+	chatReq[key] = append(compressed, messages[split:]...)
+	return len(older)
+}
+
+// summarize asks the summary model for a summary of messages, continuing a
+// previous summary if there is one
+func summarize(r *http.Request, cfg *model.Config, summaryModel, previous string, messages []interface{}, logger *zap.Logger) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&transcript, "Summary so far:\n%s\n\n", previous)
+	}
+	for _, m := range messages {
+		if text := utils.MessageText(m); text != "" {
+			role := messageRole(m)
+			if role == "" {
+				role = "tool"
+			}
+			fmt.Fprintf(&transcript, "%s: %s\n\n", role, text)
+		}
+	}
+
+	response, err := callModel(r, cfg, summaryModel, "/v1/chat/completions", func(backendModel string) map[string]interface{} {
+		return map[string]interface{}{
+			"model": backendModel,
+			"messages": []interface{}{
+				map[string]interface{}{"role": "system", "content": summaryInstructions},
+				map[string]interface{}{"role": "user", "content": transcript.String()},
+			},
+		}
+	}, logger)
+	if err != nil {
+		return "", err
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(response.body.Bytes(), &completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 || strings.TrimSpace(completion.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("summary model returned no summary")
+	}
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
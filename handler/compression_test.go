@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/summary"
+)
+
+func TestCompressionSummarizesOlderTurns(t *testing.T) {
+	var sent []map[string]interface{}
+	var transcripts []string
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model    string                   `json:"model"`
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Model == "tiny" {
+			transcripts = append(transcripts, body.Messages[1]["content"].(string))
+			io.WriteString(w, `{"object":"chat.completion","choices":[{"message":{"role":"assistant","content":"They set up the project."}}]}`)
+			return
+		}
+		sent = body.Messages
+		io.WriteString(w, `{"object":"chat.completion","choices":[]}`)
+	})
+	cfg.Compression = []model.CompressionConfig{{Models: []string{"up/llama3"}, ThresholdTokens: 40, KeepRecent: 2, SummaryModel: "up/tiny"}}
+	cfg.Summaries = summary.New()
+
+	filler := strings.Repeat("x", 40)
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "Be brief"},
+		{"role": "user", "content": "first " + filler},
+		{"role": "assistant", "content": "second " + filler},
+		{"role": "user", "content": "third " + filler},
+		{"role": "assistant", "content": "fourth " + filler},
+		{"role": "user", "content": "And now?"},
+	}
+	send := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"model": "up/llama3", "messages": messages})
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	rec := send()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the compressed request to be served, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Router-Compressed-Messages") != "3" {
+		t.Errorf("Expected 3 compressed messages reported, got %q", rec.Header().Get("X-Router-Compressed-Messages"))
+	}
+	var roles []string
+	for _, m := range sent {
+		roles = append(roles, m["role"].(string))
+	}
+	if strings.Join(roles, ",") != "system,system,assistant,user" {
+		t.Errorf("Expected the system message, a summary and the latest messages, got %v", roles)
+	}
+	if len(sent) > 1 && !strings.Contains(sent[1]["content"].(string), "They set up the project.") {
+		t.Errorf("Expected the summary to be sent, got %v", sent[1]["content"])
+	}
+
+	// The next turn only summarizes what aged out since
+	messages = append(messages,
+		map[string]interface{}{"role": "assistant", "content": "fifth " + filler},
+		map[string]interface{}{"role": "user", "content": "Done?"})
+	send()
+	if len(transcripts) != 2 {
+		t.Fatalf("Expected two summary requests, got %d", len(transcripts))
+	}
+	if !strings.Contains(transcripts[1], "Summary so far") || strings.Contains(transcripts[1], "first") {
+		t.Errorf("Expected the second summary to continue the first, got %q", transcripts[1])
+	}
+}
+
+func TestCompressionFailureSendsConversationWhole(t *testing.T) {
+	var sent int
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model    string        `json:"model"`
+			Messages []interface{} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Model == "tiny" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sent = len(body.Messages)
+		io.WriteString(w, `{"choices":[]}`)
+	})
+	cfg.Compression = []model.CompressionConfig{{Models: []string{"up/*"}, ThresholdTokens: 10, KeepRecent: 1, SummaryModel: "up/tiny"}}
+
+	long := strings.Repeat("word ", 20)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(
+		`{"model":"up/llama3","messages":[{"role":"user","content":"`+long+`"},{"role":"assistant","content":"`+long+`"},{"role":"user","content":"next"}]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusOK || sent != 3 {
+		t.Errorf("Expected the whole conversation to be sent, got %d with %d messages", rec.Code, sent)
+	}
+	if rec.Header().Get("X-Router-Compressed-Messages") != "" {
+		t.Errorf("Expected no compression reported")
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"path"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// messageOverhead is roughly what chat templates add around each message
+const messageOverhead = 4
+
+// contextWindowFor returns the context window of the first entry matching a
+// model, if any, or else the model's maximum context
+func contextWindowFor(cfg *model.Config, modelName string) *model.ContextWindowConfig {
+	for i, window := range cfg.ContextWindows {
+		for _, glob := range window.Models {
+			if ok, _ := path.Match(glob, modelName); ok {
+				return &cfg.ContextWindows[i]
+			}
+		}
+	}
+	if capabilities := capabilitiesFor(cfg, modelName); capabilities != nil && capabilities.MaxContext > 0 {
+		return &model.ContextWindowConfig{Tokens: capabilities.MaxContext}
+	}
+	return nil
+}
+
+// fitContextWindow checks that a request fits the context window of the
+// model it is sent to. A window that truncates drops the oldest messages
+// until the request fits, keeping system messages and the last message, and
+// the tool results of a dropped call with it. It returns how many messages
+// were dropped.
+func fitContextWindow(cfg *model.Config, chatReq map[string]interface{}, modelName string) (int, error) {
+	window := contextWindowFor(cfg, modelName)
+	if window == nil || window.Tokens <= 0 {
+		return 0, nil
+	}
+
+	output := utils.MaxOutputTokens(chatReq)
+	messages := utils.Messages(chatReq)
+	counts := make([]int, len(messages))
+	prompt := 0
+	for i, m := range messages {
+		counts[i] = cfg.TokenizerSet.Count(modelName, utils.MessageText(m)) + messageOverhead
+		prompt += counts[i]
+	}
+	if prompt+output <= window.Tokens {
+		return 0, nil
+	}
+
+	key := "messages"
+	if _, ok := chatReq[key].([]interface{}); !ok {
+		key = "input"
+	}
+	if _, ok := chatReq[key].([]interface{}); window.Truncate && ok {
+		kept := make([]bool, len(messages))
+		for i := range kept {
+			kept[i] = true
+		}
+		dropped, remaining := 0, prompt
+		for i := 0; i < len(messages)-1 && remaining+output > window.Tokens; i++ {
+			if role := messageRole(messages[i]); role == "system" || role == "developer" {
+				continue
+			}
+			kept[i] = false
+			remaining -= counts[i]
+			dropped++
+			// Results of a dropped tool call cannot be sent without it
+			for i+1 < len(messages)-1 && isToolResult(messages[i+1]) {
+				i++
+				kept[i] = false
+				remaining -= counts[i]
+				dropped++
+			}
+		}
+		if remaining+output <= window.Tokens {
+			var truncated []interface{}
+			for i, m := range messages {
+				if kept[i] {
+					truncated = append(truncated, m)
+				}
+			}
+			chatReq[key] = truncated
+			return dropped, nil
+		}
+	}
+
+	return 0, utils.NewError(utils.ErrContextLength,
+		"This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+		window.Tokens, prompt+output, prompt, output)
+}
+
+// messageRole returns the role of a chat message
+func messageRole(m interface{}) string {
+	message, _ := m.(map[string]interface{})
+	role, _ := message["role"].(string)
+	return role
+}
+
+// isToolResult reports whether a message answers a tool call, in the chat
+// completions or responses format
+func isToolResult(m interface{}) bool {
+	message, _ := m.(map[string]interface{})
+	return message["role"] == "tool" || message["type"] == "function_call_output"
+}
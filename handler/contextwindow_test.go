@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestContextWindowRefusesOverLimitRequests(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the request not to reach the backend")
+	})
+	cfg.ContextWindows = []model.ContextWindowConfig{{Models: []string{"up/*"}, Tokens: 50}}
+
+	long := strings.Repeat("word ", 60)
+	req := httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model":"up/llama3","messages":[{"role":"user","content":"`+long+`"}]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "context_length_exceeded") {
+		t.Errorf("Expected a context_length_exceeded error, got %d %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "maximum context length is 50 tokens") {
+		t.Errorf("Expected the window in the message, got %s", rec.Body.String())
+	}
+}
+
+func TestContextWindowTruncatesOldestMessages(t *testing.T) {
+	var sent []map[string]interface{}
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sent = body.Messages
+		w.Write([]byte(`{"choices":[]}`))
+	})
+	cfg.ContextWindows = []model.ContextWindowConfig{{Models: []string{"up/*"}, Tokens: 60, Truncate: true}}
+
+	// Each filler message is 40 characters, 10 tokens plus overhead
+	filler := strings.Repeat("x", 40)
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "Be brief"},
+		{"role": "user", "content": filler},
+		{"role": "assistant", "tool_calls": []interface{}{}},
+		{"role": "tool", "content": filler},
+		{"role": "user", "content": filler},
+		{"role": "assistant", "content": filler},
+		{"role": "user", "content": "And now?"},
+	}
+	body, _ := json.Marshal(map[string]interface{}{"model": "up/llama3", "messages": messages, "max_tokens": 10})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the truncated request to be served, got %d %s", rec.Code, rec.Body.String())
+	}
+	var roles []string
+	for _, m := range sent {
+		roles = append(roles, m["role"].(string))
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Errorf("Expected the oldest messages and the orphaned tool result dropped, got %v", roles)
+	}
+	if rec.Header().Get("X-Router-Truncated-Messages") != "3" {
+		t.Errorf("Expected 3 dropped messages reported, got %q", rec.Header().Get("X-Router-Truncated-Messages"))
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRoutingDecisionLoggedOncePerRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	core, logs := observer.New(zap.InfoLevel)
+	cfg := &model.Config{
+		Logger:       zap.New(core),
+		GlobalAPIKey: "router-key",
+		Backends: []model.BackendConfig{
+			{Name: "ollama", BaseURL: upstream.URL, Prefix: "ollama/", Default: true},
+			{Name: "openai", BaseURL: upstream.URL, Prefix: "openai/"},
+		},
+		APIKeys: []model.APIKeyConfig{{Name: "bench", Key: "bench-key", Backend: "openai"}},
+		Aliases: map[string]model.ModelAlias{"fast": {Models: []string{"openai/gpt-4o-mini"}}},
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	tests := []struct {
+		key, header, model    string
+		reason, rule, backend string
+		finalModel            string
+		transformations       []string
+	}{
+		{"router-key", "", "openai/gpt-4o", "prefix", "openai/", "openai", "gpt-4o", []string{"prefix_stripped"}},
+		{"router-key", "", "llama3", "default", "", "ollama", "llama3", nil},
+		{"router-key", "openai", "llama3", "pinned_header", "", "openai", "llama3", nil},
+		{"bench-key", "", "llama3", "pinned_key", "", "openai", "llama3", nil},
+		{"router-key", "", "fast", "prefix", "openai/", "openai", "gpt-4o-mini", []string{"alias", "prefix_stripped"}},
+	}
+	for _, tt := range tests {
+		logs.TakeAll()
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`"}`))
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		if tt.header != "" {
+			req.Header.Set("X-Router-Backend", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d %s", tt.model, rec.Code, rec.Body.String())
+		}
+
+		decisions := logs.FilterField(zap.String("event", "routing.decision")).All()
+		if len(decisions) != 1 {
+			t.Fatalf("%s: expected one routing decision, got %d", tt.model, len(decisions))
+		}
+		fields := decisions[0].ContextMap()
+		if fields["reason"] != tt.reason || fields["rule"] != tt.rule || fields["backend"] != tt.backend {
+			t.Errorf("%s: expected %s %q to %s, got %v", tt.model, tt.reason, tt.rule, tt.backend, fields)
+		}
+		if fields["originalModel"] != tt.model || fields["finalModel"] != tt.finalModel {
+			t.Errorf("%s: expected models %s and %s, got %v", tt.model, tt.model, tt.finalModel, fields)
+		}
+		var transformations []string
+		for _, v := range fields["transformations"].([]interface{}) {
+			transformations = append(transformations, v.(string))
+		}
+		if !slices.Equal(transformations, tt.transformations) {
+			t.Errorf("%s: expected transformations %v, got %v", tt.model, tt.transformations, transformations)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+// handleModels lists the default backend's models, adding the installed
+// models discovered on Ollama backends under their prefixes
+func handleModels(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	router, ok := cfg.Router.(*proxy.Router)
+	var discovered []proxy.DiscoveredModel
+	if ok {
+		discovered = router.Discovered()
+	}
+	if len(discovered) == 0 {
+		routeRequestThroughProxy(r, w, cfg.Router, cfg.Logger)
+		return
+	}
+
+	response := newBufferedResponse()
+	routeRequestThroughProxy(r, response, cfg.Router, cfg.Logger)
+	var list map[string]interface{}
+	if response.status != http.StatusOK || json.Unmarshal(response.body.Bytes(), &list) != nil {
+		cfg.Logger.Warn("Listing only discovered models, the default backend's list failed", zap.Int("status", response.status))
+		list = map[string]interface{}{"object": "list"}
+	}
+	for key, values := range response.header {
+		if key != "Content-Length" {
+			w.Header()[key] = values
+		}
+	}
+
+	data := asSlice(list["data"])
+	listed := make(map[interface{}]bool)
+	for _, m := range data {
+		if m, ok := m.(map[string]interface{}); ok {
+			listed[m["id"]] = true
+		}
+	}
+	for _, m := range discovered {
+		if !listed[m.ID] {
+			data = append(data, map[string]interface{}{"id": m.ID, "object": "model", "created": m.ModifiedAt.Unix(), "owned_by": m.Backend})
+		}
+	}
+	list["data"] = data
+	writeJSON(w, list)
+}
+
+// discoveredModel returns the discovered model a bare model name stands for
+func discoveredModel(cfg *model.Config, modelName string) (string, bool) {
+	router, ok := cfg.Router.(*proxy.Router)
+	if !ok {
+		return "", false
+	}
+	if _, _, _, prefixed := router.Match(modelName); prefixed {
+		return "", false
+	}
+	return router.BareModel(modelName)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestDiscoveredModels(t *testing.T) {
+	var routed string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/tags":
+			io.WriteString(w, `{"models": [{"name": "llama3:latest"}, {"name": "phi3:mini"}]}`)
+		case "/v1/models":
+			io.WriteString(w, `{"object": "list", "data": [{"id": "phi3:mini", "object": "model"}]}`)
+		case "/v1/chat/completions":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			routed, _ = body["model"].(string)
+			io.WriteString(w, `{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	backends := []model.BackendConfig{{Name: "local", BaseURL: upstream.URL, Prefix: "local/", Default: true,
+		Discovery: model.DiscoveryConfig{IntervalSeconds: 60, Aliases: true}}}
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Backends: backends}
+	router := proxy.NewRouter(cfg)
+	cfg.Router = router
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router.Discover(ctx, backends, cfg.Logger)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(router.Discovered()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := sendOllama(cfg, http.MethodGet, "/v1/models", "")
+	var list struct {
+		Data []struct {
+			ID      string `json:"id"`
+			OwnedBy string `json:"owned_by"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	if rec.Code != http.StatusOK || len(ids) != 3 || ids[0] != "phi3:mini" || ids[1] != "local/llama3:latest" || ids[2] != "local/phi3:mini" {
+		t.Fatalf("Expected the backend's models plus the discovered ones, got %d %v", rec.Code, ids)
+	}
+	if list.Data[1].OwnedBy != "local" {
+		t.Errorf("Expected discovered models to be owned by their backend, got %q", list.Data[1].OwnedBy)
+	}
+
+	rec = sendOllama(cfg, http.MethodPost, "/v1/chat/completions", `{"model": "llama3", "messages": [{"role": "user", "content": "hi"}]}`)
+	if rec.Code != http.StatusOK || routed != "llama3:latest" {
+		t.Errorf("Expected the bare name to reach the discovering backend as llama3:latest, got %d %q", rec.Code, routed)
+	}
+}
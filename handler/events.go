@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/events"
+	"go.uber.org/zap"
+)
+
+// eventBuffer is how many events a slow admin client may fall behind before
+// events are dropped for it
+const eventBuffer = 256
+
+// handleEvents streams admin events, such as the progress of active
+// completions, to the client as server-sent events until it disconnects
+func handleEvents(w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	ch, unsubscribe := events.Subscribe(eventBuffer)
+	defer unsubscribe()
+	logger.Info("Admin event subscriber connected")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	controller.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			logger.Info("Admin event subscriber disconnected")
+			return
+		case event := <-ch:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			controller.Flush()
+		}
+	}
+}
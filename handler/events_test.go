@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestEventsEndpointStreamsEvents(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key"}
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleRequest(cfg, w, r)
+	}))
+	defer router.Close()
+
+	req, _ := http.NewRequest("GET", router.URL+"/router/events", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// The headers arrive once the subscription exists
+	events.Publish("stream.progress", map[string]int{"chunks": 3})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	var got []string
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for event, got %q", got)
+		}
+	}
+	if got[0] != "event: stream.progress" || !strings.Contains(got[1], `"chunks":3`) {
+		t.Errorf("Unexpected event %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// handleFineTuning passes fine-tuning requests to the default backend for
+// named keys with the fine_tuning permission. Every request, including a
+// refused one, is logged and audited with the key, the job and its files.
+func handleFineTuning(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	rc := extension.FromRequest(r)
+	key := apiKeyFor(cfg, r)
+	keyName := ""
+	if key != nil {
+		keyName = key.Name
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+		return
+	}
+	setBody(r, body)
+
+	capture := newCaptureWriter(w, cfg.Limits)
+	start := time.Now()
+	if key == nil || !key.FineTuning {
+		utils.WriteErr(capture, utils.NewError(utils.ErrPermissionDenied,
+			"This key is not permitted to use the fine-tuning API; use a named key with \"fine_tuning\": true"))
+	} else {
+		routeRequestThroughProxy(r, capture, cfg.Router, cfg.Logger)
+	}
+
+	var request, response map[string]interface{}
+	json.Unmarshal(body, &request)
+	json.Unmarshal(capture.body, &response)
+	job := fineTuningJob(r.URL.Path)
+	if job == "" && capture.status < http.StatusBadRequest {
+		job, _ = response["id"].(string)
+	}
+	modelName, _ := request["model"].(string)
+	var files []string
+	for _, field := range []string{"training_file", "validation_file"} {
+		if file, _ := request[field].(string); file != "" {
+			files = append(files, file)
+		}
+	}
+
+	fields := []zap.Field{
+		zap.String("requestID", rc.ID),
+		zap.String("keyID", rc.KeyID),
+		zap.String("keyName", keyName),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", capture.status),
+		zap.String("job", job),
+		zap.Strings("files", files),
+	}
+	switch {
+	case capture.status == http.StatusForbidden:
+		cfg.Logger.Warn("Fine-tuning request refused", fields...)
+	case r.Method != http.MethodGet:
+		// Changes to jobs are billable, so they are logged at the default level
+		cfg.Logger.Warn("Fine-tuning job changed", fields...)
+	default:
+		cfg.Logger.Info("Fine-tuning request", fields...)
+	}
+
+	if cfg.AuditLog == nil {
+		return
+	}
+	hash, _ := utils.RequestHash(body)
+	entry := audit.Entry{
+		Time:        start.UTC(),
+		ID:          rc.ID,
+		KeyID:       rc.KeyID,
+		KeyName:     keyName,
+		Model:       modelName,
+		Backend:     rc.Backend,
+		Path:        r.URL.Path,
+		RequestHash: hash,
+		Status:      capture.status,
+		DurationMS:  time.Since(start).Milliseconds(),
+		Method:      r.Method,
+		Job:         job,
+		Files:       files,
+	}
+	if cfg.AuditLog.Bodies() {
+		entry.Request = rawJSON(body)
+		entry.Response = rawJSON(capture.body)
+	}
+	if err := cfg.AuditLog.Record(entry); err != nil {
+		cfg.Logger.Error("Failed to write audit log", zap.String("requestID", rc.ID), zap.Error(err))
+	}
+}
+
+// fineTuningJob returns the job ID in a fine-tuning path such as
+// /v1/fine_tuning/jobs/{id}/cancel, if there is one
+func fineTuningJob(path string) string {
+	rest, ok := strings.CutPrefix(path, "/v1/fine_tuning/jobs/")
+	if !ok {
+		return ""
+	}
+	job, _, _ := strings.Cut(rest, "/")
+	return job
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestFineTuningPermittedPerKeyAndAudited(t *testing.T) {
+	calls := 0
+	cfg := newTestRouter(t, model.BackendConfig{Default: true}, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected the client key not to reach the backend")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"ftjob-abc","object":"fine_tuning.job","status":"queued"}`)
+	})
+	cfg.APIKeys = []model.APIKeyConfig{
+		{Name: "ml-team", Key: "ml-key", FineTuning: true},
+		{Name: "intern", Key: "intern-key"},
+	}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, false)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %s", err)
+	}
+	defer auditLog.Close()
+	cfg.AuditLog = auditLog
+
+	send := func(key, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	create := `{"model":"gpt-4o-mini","training_file":"file-train","validation_file":"file-val"}`
+	for _, key := range []string{"router-key", "intern-key"} {
+		if rec := send(key, "POST", "/v1/fine_tuning/jobs", create); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "permission_denied") {
+			t.Errorf("%s: expected permission_denied, got %d %s", key, rec.Code, rec.Body.String())
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Expected refused requests not to reach the backend")
+	}
+	if rec := send("ml-key", "POST", "/v1/fine_tuning/jobs", create); rec.Code != http.StatusOK {
+		t.Errorf("Expected the permitted key to create the job, got %d %s", rec.Code, rec.Body.String())
+	}
+	send("ml-key", "POST", "/v1/fine_tuning/jobs/ftjob-abc/cancel", "")
+
+	entries, err := audit.Read(path, audit.Query{})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %s", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected four entries, got %d", len(entries))
+	}
+	if e := entries[1]; e.KeyName != "intern" || e.Status != http.StatusForbidden || e.Job != "" {
+		t.Errorf("Unexpected refusal entry %+v", e)
+	}
+	created := entries[2]
+	if created.KeyName != "ml-team" || created.Method != "POST" || created.Job != "ftjob-abc" || created.Model != "gpt-4o-mini" || created.Backend != "up" ||
+		!reflect.DeepEqual(created.Files, []string{"file-train", "file-val"}) {
+		t.Errorf("Unexpected creation entry %+v", created)
+	}
+	if e := entries[3]; e.Job != "ftjob-abc" || e.Path != "/v1/fine_tuning/jobs/ftjob-abc/cancel" {
+		t.Errorf("Unexpected cancel entry %+v", e)
+	}
+}
+
+func TestNamedKeysReachOnlyTheAPI(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{Default: true}, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":[]}`)
+	})
+	cfg.APIKeys = []model.APIKeyConfig{{Name: "ci", Key: "ci-key"}}
+
+	for target, want := range map[string]int{
+		"/v1/models":     http.StatusOK,
+		"/router/info":   http.StatusOK,
+		"/router/errors": http.StatusUnauthorized,
+		"/router/events": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Authorization", "Bearer ci-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+}
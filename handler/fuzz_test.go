@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// FuzzModelRequest feeds arbitrary bodies to the chat completions and responses
+// parsing path. Backends are replaced with a stub so only the router is exercised.
+func FuzzModelRequest(f *testing.F) {
+	f.Add(false, []byte(`{"model":"up/llama3","messages":[{"role":"user","content":"hi"}]}`))
+	f.Add(false, []byte(`{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:"}}]}]}`))
+	f.Add(true, []byte(`{"model":"up/x","input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}]}`))
+	f.Add(false, []byte(`null`))
+	f.Add(false, []byte(`{"model":1}`))
+
+	stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Router: stubRouter{stub}}
+
+	f.Fuzz(func(t *testing.T, responses bool, body []byte) {
+		path := "/v1/chat/completions"
+		if responses {
+			path = "/v1/responses"
+		}
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest {
+			t.Fatalf("Unexpected status %d for body %q: %s", rec.Code, body, rec.Body.String())
+		}
+	})
+}
@@ -3,107 +3,805 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/extension"
 	"github.com/kcolemangt/llm-router/model"
 	"github.com/kcolemangt/llm-router/proxy"
 	"github.com/kcolemangt/llm-router/utils"
 	"go.uber.org/zap"
 )
 
+// NewHandler returns the router's request pipeline: response compression, path
+// canonicalization, authentication, the request context, any middlewares
+// registered with extension.RegisterMiddleware, and finally routing by path.
+// Build it once, after extensions have registered.
+func NewHandler(cfg *model.Config) http.Handler {
+	return compressResponses(canonicalizePath(newHandler(cfg, cfg.Auth)))
+}
+
+// NewListenerHandler returns the pipeline for one listener. Requests for
+// endpoint groups the listener does not serve are answered as not found before
+// authentication, and the listener's auth settings replace the global ones.
+func NewListenerHandler(cfg *model.Config, listener model.ListenerConfig) http.Handler {
+	auth := cfg.Auth
+	if listener.Auth != nil {
+		auth = *listener.Auth
+	}
+	next := compressResponses(canonicalizePath(newHandler(cfg, auth)))
+	if len(listener.Serve) == 0 {
+		return next
+	}
+	serves := make(map[string]bool)
+	for _, group := range listener.Serve {
+		serves[group] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !serves[endpointGroup(r.URL.Path)] {
+			utils.WriteErr(w, utils.ErrNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// endpointGroup returns the listener group a path belongs to
+func endpointGroup(path string) string {
+	switch {
+	case path == "/healthz":
+		return model.ServeHealth
+	case path == "/router/errors" || path == "/router/cancellations" || path == "/router/cache" || strings.HasPrefix(path, "/router/usage"):
+		return model.ServeMetrics
+	case path == "/router/info" || path == "/router/hash" || path == "/router/ping":
+		return model.ServeAPI
+	case strings.HasPrefix(path, "/router/"):
+		return model.ServeAdmin
+	}
+	return model.ServeAPI
+}
+
+func newHandler(cfg *model.Config, auth model.AuthConfig) http.Handler {
+	routed, names := extensionsOf(cfg.Router).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route(cfg, w, r)
+	}))
+	if len(names) > 0 {
+		cfg.Logger.Info("Middlewares registered", zap.Strings("middlewares", names))
+	}
+	return chain(routed, captureExchanges(cfg), filterClients(cfg), authenticate(cfg, auth), attachRequestContext(cfg, auth), limitKeys(cfg))
+}
+
 // HandleRequest is the main HTTP handler function that processes incoming requests
 func HandleRequest(cfg *model.Config, w http.ResponseWriter, r *http.Request) {
-	// Authenticate the request
-	authHeader := r.Header.Get("Authorization")
-	expectedAuthHeader := "Bearer " + cfg.GlobalAPIKey
-	if authHeader != expectedAuthHeader {
-		cfg.Logger.Warn("Invalid or missing API key",
-			zap.String("receivedAuthHeader", utils.RedactAuthorization(authHeader)),
-			zap.String("expectedAuthHeader", utils.RedactAuthorization(expectedAuthHeader)))
-		http.Error(w, "Invalid or missing API key", http.StatusUnauthorized)
+	NewHandler(cfg).ServeHTTP(w, r)
+}
+
+// extensionsOf returns the extensions of a router, or only the compiled-in
+// ones without a router
+func extensionsOf(router model.Router) model.Extensions {
+	if router == nil {
+		return extension.NewRegistry()
+	}
+	return router.Extensions()
+}
+
+// chain wraps h in middlewares so that the first middleware runs first
+func chain(h http.Handler, middlewares ...extension.Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// setupDocsURL is where unauthenticated clients are pointed when hints are enabled
+const setupDocsURL = "https://github.com/kcolemangt/llm-router#getting-started"
+
+// authenticate rejects requests that do not carry the router API key or, for
+// the API, a named key or a valid JWT, except on the paths the auth settings exempt
+func authenticate(cfg *model.Config, auth model.AuthConfig) extension.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublic(auth, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authHeader := requestAuthorization(r)
+			// Named keys and JWTs reach the API but not the router's admin and metrics endpoints
+			named := apiKeyFor(cfg, r) != nil && endpointGroup(r.URL.Path) == model.ServeAPI
+			if !isRouterKey(cfg, authHeader) && !named {
+				fields := []zap.Field{
+					zap.String("clientIP", cfg.ClientIPs.ClientIP(r)),
+					zap.String("receivedAuthHeader", utils.RedactAuthorization(authHeader)),
+					zap.String("expectedAuthHeader", utils.RedactAuthorization("Bearer "+routerKey(cfg))),
+				}
+				if _, _, err := jwtKey(cfg, r); err != nil {
+					fields = append(fields, zap.NamedError("jwtError", err))
+				}
+				cfg.Logger.Warn("Invalid or missing API key", fields...)
+				recordAuthFailure(cfg, r)
+				if auth.Hint {
+					utils.WriteErr(w, utils.NewError(utils.ErrInvalidAPIKey,
+						"Missing or wrong API key. Send the router key as \"Authorization: Bearer <key>\"; see %s", setupDocsURL))
+					return
+				}
+				utils.WriteErr(w, utils.ErrInvalidAPIKey)
+				return
+			}
+			cfg.Logger.Info("API key validated successfully",
+				zap.String("Authorization", utils.RedactAuthorization(authHeader)))
+			cfg.Lockouts.Succeed(cfg.ClientIPs.ClientIP(r))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestAuthorization returns the client's credentials as an Authorization
+// header value. Anthropic clients send their key in X-Api-Key instead, and
+// browsers opening a WebSocket as an API key subprotocol.
+func requestAuthorization(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	if key := r.Header.Get("X-Api-Key"); key != "" && r.URL.Path == messagesPath {
+		return "Bearer " + key
+	}
+	if key := webSocketKey(r); key != "" {
+		return "Bearer " + key
+	}
+	return ""
+}
+
+// routerKey returns the key clients should send, from the key file if one is
+// configured
+func routerKey(cfg *model.Config) string {
+	if cfg.Keys != nil {
+		return cfg.Keys.Current()
+	}
+	return cfg.GlobalAPIKey
+}
+
+// isRouterKey reports whether authHeader carries the router key or, with a key
+// file, a rotated key still in its grace window
+func isRouterKey(cfg *model.Config, authHeader string) bool {
+	if cfg.Keys != nil {
+		key, ok := strings.CutPrefix(authHeader, "Bearer ")
+		return ok && cfg.Keys.Valid(key)
+	}
+	return authHeader == "Bearer "+cfg.GlobalAPIKey
+}
+
+// recordAuthFailure counts a failed attempt against the client's address and
+// reports a lockout as a security event. Trusted proxies are never locked out,
+// since every client behind them would be.
+func recordAuthFailure(cfg *model.Config, r *http.Request) {
+	ip := cfg.ClientIPs.ClientIP(r)
+	if cfg.ClientIPs.Trusted(ip) {
+		return
+	}
+	until, banned := cfg.Lockouts.Fail(ip)
+	if !banned {
+		return
+	}
+	cfg.Logger.Warn("Locked out client after repeated authentication failures",
+		zap.String("event", "security.lockout"),
+		zap.String("clientIP", ip),
+		zap.Int("failures", cfg.Lockout.Threshold),
+		zap.Time("until", until))
+	events.Publish("security.lockout", map[string]interface{}{"client_ip": ip, "until": until})
+}
+
+// apiKeyFor returns the named API key r was sent with, or presented a client
+// certificate for, or the key a valid JWT maps to, if any
+func apiKeyFor(cfg *model.Config, r *http.Request) *model.APIKeyConfig {
+	for i, key := range cfg.APIKeys {
+		if keyPresented(key, r) {
+			return &cfg.APIKeys[i]
+		}
+	}
+	key, _, _ := jwtKey(cfg, r)
+	return key
+}
+
+// filterClients refuses clients the network allow and deny lists exclude and
+// clients locked out for failing authentication, before they can try a key
+func filterClients(cfg *model.Config) extension.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := cfg.ClientIPs.ClientIP(r)
+			if !cfg.ClientIPs.Permits(ip) {
+				cfg.Logger.Warn("Refused client address", zap.String("clientIP", ip), zap.String("remoteAddr", r.RemoteAddr))
+				utils.WriteErr(w, utils.ErrAddressDenied)
+				return
+			}
+			// The lockout was logged when it began; scanners would flood the log otherwise
+			if until, banned := cfg.Lockouts.Banned(ip); banned {
+				cfg.Logger.Debug("Refused locked out client", zap.String("clientIP", ip))
+				w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+				utils.WriteErr(w, utils.ErrLockedOut)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isPublic reports whether the auth config lets r through without a key
+func isPublic(auth model.AuthConfig, r *http.Request) bool {
+	switch {
+	case auth.Disabled:
+		return true
+	case r.Method == http.MethodOptions:
+		return auth.ExemptOptions
+	case r.URL.Path == "/healthz":
+		return auth.PublicHealth
+	case r.URL.Path == "/router/info":
+		return auth.PublicInfo
+	case r.URL.Path == "/router/ping":
+		// Reports whether the key is valid itself, for troubleshooting
+		return true
+	}
+	return false
+}
+
+// attachRequestContext describes the request once so every later stage sees the same facts
+func attachRequestContext(cfg *model.Config, auth model.AuthConfig) extension.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := requestAuthorization(r)
+			rc := extension.NewRequestContext(r, authHeader)
+			rc.Key = apiKeyFor(cfg, r)
+			rc.ClientIP = cfg.ClientIPs.ClientIP(r)
+			// Every token differs, so clients with JWTs are told apart by identity
+			_, identity, _ := jwtKey(cfg, r)
+			if identity != "" {
+				rc.KeyID = utils.KeyID(identity)
+			}
+			rc.ForwardAuthorization = isRouterKey(cfg, authHeader) || auth.Disabled && rc.Key == nil && identity == ""
+			// Clients with only a certificate send no key to derive an ID from
+			if rc.Key != nil && rc.Key.Key == "" && rc.Key.ClientCert != "" {
+				rc.KeyID = utils.KeyID(rc.Key.ClientCert)
+			}
+			// Clients need the ID to refer to the request later, e.g. to annotate it
+			w.Header().Set("X-Router-Request-ID", rc.ID)
+			next.ServeHTTP(w, extension.WithRequestContext(r, rc))
+		})
+	}
+}
+
+// route dispatches an authenticated request to the handler for its path
+func route(cfg *model.Config, w http.ResponseWriter, r *http.Request) {
+	// Answer CORS preflight requests for browser-based clients
+	if r.Method == http.MethodOptions {
+		handlePreflight(w, r)
+		return
+	}
+
+	// A key pinned to a backend may not choose another one
+	rc := extension.FromRequest(r)
+	if key := rc.Key; key != nil && key.Backend != "" {
+		if rc.PinnedBackend != "" && rc.PinnedBackend != key.Backend {
+			utils.WriteErr(w, utils.NewError(utils.ErrPermissionDenied, "Key %s is pinned to backend %s", key.Name, key.Backend))
+			return
+		}
+		rc.PinnedBackend = key.Backend
+	}
+
+	// Report that the router is up, for load balancers and monitors
+	if r.URL.Path == "/healthz" && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status":"ok"}`)
 		return
 	}
-	cfg.Logger.Info("API key validated successfully",
-		zap.String("Authorization", utils.RedactAuthorization(authHeader)))
 
 	// Process specific API endpoint logic if applicable
-	if r.URL.Path == "/v1/chat/completions" && r.Method == "POST" {
-		handleChatCompletions(w, r, cfg.Logger)
+	if (r.URL.Path == "/v1/chat/completions" || r.URL.Path == "/v1/responses") && r.Method == "POST" {
+		resumeStream(w, r, cfg, func(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+			recordExchange(w, r, cfg, handleModelRequest)
+		})
+		return
+	}
+
+	// Serve Anthropic clients by translating the Messages API to chat completions
+	if r.URL.Path == messagesPath && r.Method == "POST" {
+		handleMessages(w, r, cfg)
+		return
+	}
+
+	// Serve apps that only speak Ollama's native API by translating it too
+	if isOllamaRequest(r) {
+		handleOllama(w, r, cfg)
+		return
+	}
+
+	// Add the models discovered on Ollama backends to the model list
+	if r.URL.Path == "/v1/models" && r.Method == "GET" {
+		handleModels(w, r, cfg)
+		return
+	}
+
+	// Realtime API sessions are WebSocket upgrades routed by the model query parameter
+	if r.URL.Path == "/v1/realtime" && isWebSocketUpgrade(r) {
+		handleRealtime(w, r, cfg.Router, cfg.Logger)
+		return
+	}
+
+	// Route text-to-speech requests by model like chat completions
+	if r.URL.Path == "/v1/audio/speech" && r.Method == "POST" {
+		handleSpeech(w, r, cfg)
+		return
+	}
+
+	// Send audio to several transcription models if configured
+	if r.URL.Path == "/v1/audio/transcriptions" && r.Method == "POST" && len(cfg.Transcription.Models) > 0 {
+		handleTranscription(w, r, cfg.Router, cfg.Transcription, cfg.Logger)
+		return
+	}
+
+	// Emulate the Batch API by running batches through the router itself
+	if cfg.BatchStore != nil && isBatchRequest(cfg, r) {
+		handleBatches(w, r, cfg)
+		return
+	}
+
+	// The stateful Assistants API only goes to the backend that serves it
+	if isAssistantsRequest(r) {
+		handleAssistants(w, r, cfg)
+		return
+	}
+
+	// Fine-tuning changes billable provider state, so it is permitted per key and audited
+	if r.URL.Path == "/v1/fine_tuning" || strings.HasPrefix(r.URL.Path, "/v1/fine_tuning/") {
+		handleFineTuning(w, r, cfg)
+		return
+	}
+
+	// Expose the canonical request hash for external tooling
+	if r.URL.Path == "/router/hash" && r.Method == "POST" {
+		handleRequestHash(w, r, cfg.Logger)
+		return
+	}
+
+	// Describe the router to client tooling
+	if r.URL.Path == "/router/info" && r.Method == "GET" {
+		handleInfo(w, cfg)
+		return
+	}
+
+	// Echo what the router sees of the request, for connectivity troubleshooting
+	if r.URL.Path == "/router/ping" && r.Method == "GET" {
+		handlePing(w, r, cfg)
+		return
+	}
+
+	// Stream admin events such as live generation progress
+	if r.URL.Path == "/router/events" && r.Method == "GET" {
+		handleEvents(w, r, cfg.Logger)
+		return
+	}
+
+	// Report backend errors by class
+	if r.URL.Path == "/router/errors" && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		rt, _ := cfg.Router.(*proxy.Router)
+		json.NewEncoder(w).Encode(rt.ErrorCounts())
+		return
+	}
+
+	// Report the requests clients went away from
+	if r.URL.Path == "/router/cancellations" && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		rt, _ := cfg.Router.(*proxy.Router)
+		json.NewEncoder(w).Encode(rt.Cancellations())
+		return
+	}
+
+	// Report semantic cache hits and misses
+	if r.URL.Path == "/router/cache" && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cfg.ResponseCache.Stats())
+		return
+	}
+
+	// Probe every backend for the API formats and endpoints it offers
+	if r.URL.Path == "/router/probe" && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proxy.ProbeAll(cfg.Backends))
+		return
+	}
+
+	// Report usage per key, exact or privatized for external dashboards
+	if (r.URL.Path == "/router/usage" || r.URL.Path == "/router/usage/export") && r.Method == "GET" {
+		handleUsage(w, r, cfg, r.URL.Path == "/router/usage/export")
+		return
+	}
+
+	// Replace the router key, keeping the old one valid for a grace window
+	if r.URL.Path == "/router/keys/rotate" && r.Method == "POST" {
+		handleKeyRotation(w, r, cfg)
+		return
+	}
+
+	// Send a recorded request again and compare the answers
+	if strings.HasPrefix(r.URL.Path, "/router/replay/") && r.Method == "POST" {
+		handleReplay(w, r, cfg)
+		return
+	}
+
+	// Label and export recorded exchanges
+	if strings.HasPrefix(r.URL.Path, "/router/history/") {
+		handleHistory(w, r, cfg)
 		return
 	}
 
 	// Otherwise, route the request to the default backend
-	routeRequestThroughProxy(r, w, cfg.Logger)
+	routeRequestThroughProxy(r, w, cfg.Router, cfg.Logger)
 }
 
-// handleChatCompletions processes specific logic for the chat completions endpoint
-func handleChatCompletions(w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+// handleModelRequest routes chat completions and responses requests by the model in the body
+func handleModelRequest(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	logger := cfg.Logger
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
 		return
 	}
 
 	var chatReq map[string]interface{}
-	if err := json.Unmarshal(body, &chatReq); err != nil {
-		http.Error(w, "Error unmarshalling request body", http.StatusInternalServerError)
+	if err := utils.UnmarshalJSON(body, &chatReq); err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Error unmarshalling request body"))
 		return
 	}
 
 	modelName, ok := chatReq["model"].(string)
 	if !ok {
-		http.Error(w, "Model key missing or not a string", http.StatusBadRequest)
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Model key missing or not a string"))
 		return
 	}
 
-	logger.Info("Incoming request for model", zap.String("model", modelName))
+	rc := extension.FromRequest(r)
+	rc.SetChatRequest(chatReq, cfg.TokenizerSet)
+	logger.Info("Incoming request for model", rc.LogFields()...)
 
-	for prefix, proxy := range proxy.Proxies {
-		if strings.HasPrefix(modelName, prefix) {
-			newModelName := strings.TrimPrefix(modelName, prefix)
-			chatReq["model"] = newModelName
-			modifiedBody, err := json.Marshal(chatReq)
-			if err != nil {
-				http.Error(w, "Error re-marshalling request body", http.StatusInternalServerError)
+	// Refuse prompts the moderation model flags in a blocked category
+	if err := moderate(w, r, cfg, chatReq, modelName, logger); err != nil {
+		utils.WriteErr(w, err)
+		return
+	}
+
+	requestedModel := modelName
+	if alias, ok := cfg.Aliases[modelName]; ok && len(alias.Models) > 0 {
+		rc.Route.Alias, rc.Route.Policy = requestedModel, alias.RoutePolicy
+		stream, _ := chatReq["stream"].(bool)
+		if alias.Race && len(alias.Models) > 1 && !stream {
+			rc.Route.Reason = extension.RouteRace
+			logRoutingDecision(logger, rc, requestedModel, "", zap.Strings("models", alias.Models))
+			raceModels(w, r, cfg.Router, chatReq, alias.Models, logger)
+			return
+		}
+		if modelName, err = chooseAliasModel(cfg, alias, rc, chatReq); err != nil {
+			logger.Warn("No healthy backend for alias", zap.String("alias", requestedModel), zap.Error(err))
+			utils.WriteErr(w, err)
+			return
+		}
+		logger.Debug("Resolved model alias", zap.String("alias", requestedModel), zap.String("model", modelName),
+			zap.String("routePolicy", alias.RoutePolicy))
+		w.Header().Set("X-Router-Alias-Model", modelName)
+		rc.Route.Transformations = append(rc.Route.Transformations, "alias")
+	}
+
+	// Bare names of discovered Ollama models go to the backend that has them
+	if discovered, ok := discoveredModel(cfg, modelName); ok {
+		logger.Debug("Resolved discovered model", zap.String("model", modelName), zap.String("discovered", discovered))
+		modelName = discovered
+		rc.Route.Transformations = append(rc.Route.Transformations, "discovered_model")
+	}
+
+	// Price the request by the model it resolved to, or the name the client used
+	rc.Price = priceFor(cfg, modelName, requestedModel)
+
+	// Synthetic models are answered by the router without a backend
+	if m := cfg.SyntheticSet.For(modelName); m != nil {
+		serveSynthetic(w, r, m, chatReq, logger)
+		return
+	}
+
+	// Answer prompts similar to ones answered before from the semantic cache
+	lookup, served := lookupCache(w, r, cfg, chatReq, modelName, logger)
+	if served {
+		return
+	}
+
+	// Summarize the older turns of long conversations when configured
+	compressed := compressHistory(r, cfg, chatReq, modelName, logger)
+	if compressed > 0 {
+		logger.Info("Replaced older messages with a summary",
+			zap.String("requestID", rc.ID), zap.String("model", modelName), zap.Int("compressed", compressed))
+		w.Header().Set("X-Router-Compressed-Messages", strconv.Itoa(compressed))
+		rc.SetChatRequest(chatReq, cfg.TokenizerSet)
+		rc.Route.Transformations = append(rc.Route.Transformations, "history_compressed")
+	}
+
+	// Refuse or adapt requests using capabilities the model lacks, rather than
+	// letting the backend fail them with an opaque error
+	options, _ := chatReq["stream_options"].(map[string]interface{})
+	includeUsage, _ := options["include_usage"].(bool)
+	adapted, err := adaptToCapabilities(r, capabilitiesFor(cfg, modelName), chatReq, modelName)
+	if err != nil {
+		logger.Warn("Request uses capabilities the model lacks", append(rc.LogFields(), zap.Error(err))...)
+		utils.WriteErr(w, err)
+		return
+	}
+	if len(adapted) > 0 {
+		logger.Info("Adapted request to the model's capabilities",
+			zap.String("requestID", rc.ID), zap.String("model", modelName), zap.Strings("changes", adapted))
+		w.Header().Set("X-Router-Adapted", strings.Join(adapted, ", "))
+		rc.SetChatRequest(chatReq, cfg.TokenizerSet)
+		rc.Route.Transformations = append(rc.Route.Transformations, adapted...)
+	}
+
+	// Refuse or shorten requests the model's context window cannot hold,
+	// rather than letting the backend silently cut them
+	dropped, err := fitContextWindow(cfg, chatReq, modelName)
+	if err != nil {
+		logger.Warn("Request exceeds the context window", append(rc.LogFields(), zap.Error(err))...)
+		utils.WriteErr(w, err)
+		return
+	}
+	if dropped > 0 {
+		logger.Info("Dropped the oldest messages to fit the context window",
+			zap.String("requestID", rc.ID), zap.String("model", modelName), zap.Int("dropped", dropped))
+		w.Header().Set("X-Router-Truncated-Messages", strconv.Itoa(dropped))
+		rc.SetChatRequest(chatReq, cfg.TokenizerSet)
+		rc.Route.Transformations = append(rc.Route.Transformations, "messages_truncated")
+	}
+
+	target, newModelName, err := resolveBackend(r, cfg.Router, modelName, logger)
+	if err != nil {
+		logger.Warn("No suitable backend found", zap.String("model", modelName), zap.Error(err))
+		utils.WriteErr(w, err)
+		return
+	}
+
+	rc.BackendModel = newModelName
+	if newModelName != modelName {
+		rc.Route.Transformations = append(rc.Route.Transformations, "prefix_stripped")
+	}
+	extensions := extensionsOf(cfg.Router)
+	if extensions.HasTransformers() {
+		rc.Route.Transformations = append(rc.Route.Transformations, "transformers")
+	}
+	logRoutingDecision(logger, rc, requestedModel, newModelName)
+
+	// Forward the original body untouched unless something needs to change
+	if newModelName != requestedModel || compressed > 0 || len(adapted) > 0 || dropped > 0 || extensions.HasTransformers() {
+		body, err = transformRequest(r, extensions, chatReq, newModelName, logger)
+		if err != nil {
+			utils.WriteErr(w, err)
+			return
+		}
+	}
+	setBody(r, body)
+
+	serve := func(w http.ResponseWriter) {
+		// Check answers of non-streaming chat completions against the model's post-conditions
+		if conditions := cfg.Requirements.For(requestedModel, modelName); conditions != nil && r.URL.Path == "/v1/chat/completions" {
+			if stream, _ := chatReq["stream"].(bool); !stream {
+				enforcePostConditions(w, r, target, body, conditions, logger)
 				return
 			}
-			r.Body = io.NopCloser(bytes.NewBuffer(modifiedBody))
-			r.ContentLength = int64(len(modifiedBody))
-			r.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBody)))
+		}
+		target.ServeHTTP(w, r)
+	}
 
-			logger.Info("Routing model to new model", zap.String("originalModel", modelName), zap.String("newModel", newModelName))
+	// Send the answer of a model that cannot stream as the stream the client asked for
+	if slices.Contains(adapted, "stream_emulated") {
+		response := newBufferedResponse()
+		serve(response)
+		streamCompletion(w, response, includeUsage)
+		return
+	}
 
-			proxy.ServeHTTP(w, r)
-			return
+	// Remember the answer to a prompt that missed the semantic cache
+	if lookup != nil {
+		response := newBufferedResponse()
+		serve(response)
+		lookup.store(cfg, response)
+		response.writeTo(w)
+		return
+	}
+	serve(w)
+}
+
+// transformRequest sets the model, applies registered transformers and
+// returns the re-encoded body
+func transformRequest(r *http.Request, extensions model.Extensions, chatReq map[string]interface{}, modelName string, logger *zap.Logger) ([]byte, error) {
+	chatReq["model"] = modelName
+	if err := extensions.Transform(r, chatReq); err != nil {
+		logger.Warn("Request rejected by transformer", zap.String("model", modelName), zap.Error(err))
+		// Transformers may return a *utils.Error to choose the status and code
+		if !errors.As(err, new(*utils.Error)) {
+			err = utils.NewError(utils.ErrInvalidRequest, "%s", err)
+		}
+		return nil, err
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrInternal, "Error re-marshalling request body")
+	}
+	return body, nil
+}
+
+// setBody replaces the body of r
+func setBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+}
+
+// resolveBackend picks the backend for a model and checks that the client's
+// key may use both
+func resolveBackend(r *http.Request, router model.Router, modelName string, logger *zap.Logger) (http.Handler, string, error) {
+	target, backend, newModelName, err := pickBackend(r, router, modelName, logger)
+	if err != nil {
+		return nil, modelName, err
+	}
+	if key := extension.FromRequest(r).Key; key != nil {
+		if err := keyPermits(key, modelName, backend); err != nil {
+			logger.Warn("Key not permitted to use model", zap.String("key", key.Name),
+				zap.String("model", modelName), zap.String("backend", backend))
+			return nil, modelName, err
+		}
+	}
+	return target, newModelName, nil
+}
+
+// pickBackend returns the backend for a model, its name and the model name to
+// send it: the pinned backend if there is one, otherwise registered resolvers
+// first, then model prefixes, then the default proxy
+func pickBackend(r *http.Request, router model.Router, modelName string, logger *zap.Logger) (http.Handler, string, string, error) {
+	if router == nil {
+		return nil, "", modelName, utils.NewError(utils.ErrNoBackend, "No suitable backend found for model %s", modelName)
+	}
+	rc := extension.FromRequest(r)
+	if name := rc.PinnedBackend; name != "" {
+		target, prefix, ok := router.ByName(name)
+		if !ok {
+			return nil, "", modelName, utils.NewError(utils.ErrInvalidRequest, "Unknown backend %s", name)
+		}
+		newModelName := strings.TrimPrefix(modelName, prefix)
+		logger.Debug("Routing model to pinned backend", zap.String("backend", name),
+			zap.String("originalModel", modelName), zap.String("newModel", newModelName))
+		reason := extension.RoutePinnedHeader
+		if rc.Key != nil && rc.Key.Backend == name {
+			reason = extension.RoutePinnedKey
+		}
+		rc.Route.Reason, rc.Route.Rule, rc.Route.Backend = reason, "", name
+		return target, name, newModelName, nil
+	}
+
+	if name, prefix, newModelName, ok := router.Extensions().Resolve(r, modelName); ok {
+		if target, backend, found := router.ByPrefix(prefix); found {
+			logger.Debug("Routing model via resolver",
+				zap.String("resolver", name),
+				zap.String("originalModel", modelName),
+				zap.String("newModel", newModelName))
+			rc.Route.Reason, rc.Route.Rule, rc.Route.Backend = extension.RouteResolver, name, backend
+			return target, backend, newModelName, nil
 		}
+		logger.Warn("Resolver returned unknown backend prefix",
+			zap.String("resolver", name),
+			zap.String("prefix", prefix))
+	}
+
+	if target, backend, prefix, ok := router.Match(modelName); ok {
+		newModelName := strings.TrimPrefix(modelName, prefix)
+		logger.Debug("Routing model to new model", zap.String("originalModel", modelName), zap.String("newModel", newModelName))
+		rc.Route.Reason, rc.Route.Rule, rc.Route.Backend = extension.RoutePrefix, prefix, backend
+		return target, backend, newModelName, nil
 	}
 
 	// If no prefix matches, use the default proxy
-	if proxy.DefaultProxy != nil {
-		logger.Info("Routing request to default proxy", zap.String("model", modelName))
+	if target, backend := router.Default(); target != nil {
+		logger.Debug("Routing request to default proxy", zap.String("model", modelName))
+		rc.Route.Reason, rc.Route.Rule, rc.Route.Backend = extension.RouteDefault, "", backend
+		return target, backend, modelName, nil
+	}
+
+	return nil, "", modelName, utils.NewError(utils.ErrNoBackend, "No suitable backend found for model %s", modelName)
+}
+
+// logRoutingDecision reports in one entry where a request went and why:
+// the rule that chose the backend, the model the client asked for and the one
+// sent, and what the router changed in the request
+func logRoutingDecision(logger *zap.Logger, rc *extension.RequestContext, originalModel, finalModel string, fields ...zap.Field) {
+	route := rc.Route
+	logger.Info("Routing decision", append([]zap.Field{
+		zap.String("event", "routing.decision"),
+		zap.String("requestID", rc.ID),
+		zap.String("keyID", rc.KeyID),
+		zap.String("reason", route.Reason),
+		zap.String("rule", route.Rule),
+		zap.String("alias", route.Alias),
+		zap.String("routePolicy", route.Policy),
+		zap.String("originalModel", originalModel),
+		zap.String("finalModel", finalModel),
+		zap.String("backend", route.Backend),
+		zap.Strings("transformations", route.Transformations),
+	}, fields...)...)
+	events.Publish("routing.decision", map[string]interface{}{
+		"request_id":      rc.ID,
+		"reason":          route.Reason,
+		"rule":            route.Rule,
+		"alias":           route.Alias,
+		"original_model":  originalModel,
+		"final_model":     finalModel,
+		"backend":         route.Backend,
+		"transformations": route.Transformations,
+	})
+}
 
-		r.Body = io.NopCloser(bytes.NewBuffer(body))
-		proxy.DefaultProxy.ServeHTTP(w, r)
+// handleRequestHash returns the canonical hash of the request body so external
+// tooling can correlate its records with the router's
+func handleRequestHash(w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+		return
+	}
+
+	hash, err := utils.RequestHash(body)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Request body is not valid JSON"))
 		return
 	}
 
-	logger.Warn("No suitable backend found", zap.String("model", modelName))
-	http.Error(w, "No suitable backend found", http.StatusBadGateway)
+	logger.Debug("Computed request hash", zap.String("hash", hash))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"hash": hash})
 }
 
 // routeRequestThroughProxy routes all generic requests through the default proxy
-func routeRequestThroughProxy(r *http.Request, w http.ResponseWriter, logger *zap.Logger) {
+func routeRequestThroughProxy(r *http.Request, w http.ResponseWriter, router model.Router, logger *zap.Logger) {
+	var target http.Handler
+	var backend string
+	if router != nil {
+		target, backend = router.Default()
+	}
+	if key := extension.FromRequest(r).Key; key != nil {
+		if err := keyPermitsBackend(key, backend); err != nil {
+			logger.Warn("Key not permitted to use backend", zap.String("key", key.Name), zap.String("path", r.URL.Path))
+			utils.WriteErr(w, err)
+			return
+		}
+	}
 
-	if proxy.DefaultProxy != nil {
-		logger.Info("Routing general request",
+	if target != nil {
+		logger.Debug("Routing general request",
 			zap.String("path", r.URL.Path))
-		proxy.DefaultProxy.ServeHTTP(w, r)
+		rc := extension.FromRequest(r)
+		rc.Route.Reason, rc.Route.Backend = extension.RouteDefault, backend
+		logRoutingDecision(logger, rc, "", "", zap.String("path", r.URL.Path))
+		target.ServeHTTP(w, r)
 	} else {
 		logger.Info("No suitable backend configured for request",
 			zap.String("path", r.URL.Path))
-		http.Error(w, "No suitable backend configured", http.StatusBadGateway)
+		utils.WriteErr(w, utils.NewError(utils.ErrNoBackend, "No suitable backend configured"))
 	}
 }
+
+// handlePreflight allows cross-origin requests with the headers clients send
+func handlePreflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Router-Tags, X-Router-Backend, X-Conversation-ID, OpenAI-Beta")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/vision"
+	"go.uber.org/zap"
+)
+
+// newTestRouter starts upstream as the only backend, with prefix "up/", and
+// returns a config whose API key is "router-key"
+func newTestRouter(t *testing.T, backend model.BackendConfig, upstream http.HandlerFunc) *model.Config {
+	return newTestRouterWithLimits(t, model.LimitsConfig{}, backend, upstream)
+}
+
+// newTestRouterWithLimits is newTestRouter with the backend's proxy built
+// under limits
+func newTestRouterWithLimits(t *testing.T, limits model.LimitsConfig, backend model.BackendConfig, upstream http.HandlerFunc) *model.Config {
+	logger, _ := zap.NewDevelopment()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	backend.Name = "up"
+	backend.BaseURL = server.URL
+	backend.Prefix = "up/"
+	cfg := &model.Config{Logger: logger, GlobalAPIKey: "router-key", Limits: limits}
+	cfg.Router = proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{backend}, Logger: logger, Limits: limits})
+	return cfg
+}
+
+// stubRouter sends every request to one handler, as the default backend "up"
+// with prefix "up/"
+type stubRouter struct{ http.Handler }
+
+func (s stubRouter) ByName(name string) (http.Handler, string, bool) {
+	return s.Handler, "up/", name == "up"
+}
+
+func (s stubRouter) ByPrefix(prefix string) (http.Handler, string, bool) {
+	return s.Handler, "up", prefix == "up/"
+}
+
+func (s stubRouter) Match(modelName string) (http.Handler, string, string, bool) {
+	return s.Handler, "up", "up/", strings.HasPrefix(modelName, "up/")
+}
+
+func (s stubRouter) Default() (http.Handler, string) {
+	return s.Handler, "up"
+}
+
+func (s stubRouter) Extensions() model.Extensions {
+	return extension.NewRegistry()
+}
+
+func TestResponsesRoutingStripsPrefixAndParams(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{StripParams: []string{"store", "reasoning"}},
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/responses" {
+				t.Errorf("Unexpected upstream path %s", r.URL.Path)
+			}
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["model"] != "llama3" {
+				t.Errorf("Expected prefix to be stripped, got %v", body["model"])
+			}
+			if _, ok := body["store"]; ok {
+				t.Errorf("Expected store to be stripped")
+			}
+			if _, ok := body["reasoning"]; ok {
+				t.Errorf("Expected reasoning to be stripped")
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: response.output_text.delta\ndata: {\"delta\":\"hi\"}\n\n")
+		})
+
+	req := httptest.NewRequest("POST", "/v1/responses",
+		strings.NewReader(`{"model":"up/llama3","input":"hello","stream":true,"store":false,"reasoning":{"effort":"low"}}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "response.output_text.delta") {
+		t.Errorf("Expected streamed events to pass through, got %q", rec.Body.String())
+	}
+}
+
+func TestResponsesReportRequestedModel(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if stream, _ := body["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"model\":\"deepseek-r1:latest\",\"choices\":[]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"deepseek-r1:latest","choices":[]}`)
+	})
+	cfg.Aliases = map[string]model.ModelAlias{"o1": {Models: []string{"up/deepseek-r1"}}}
+
+	for _, body := range []string{`{"model":"o1"}`, `{"model":"o1","stream":true}`, `{"model":"up/deepseek-r1"}`} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		var sent struct{ Model string }
+		json.Unmarshal([]byte(body), &sent)
+		if !strings.Contains(rec.Body.String(), `"model":"`+sent.Model+`"`) || strings.Contains(rec.Body.String(), "deepseek-r1:latest") {
+			t.Errorf("%s: expected the response to report %s, got %s", body, sent.Model, rec.Body.String())
+		}
+	}
+}
+
+func TestUnknownModelPrefixWithoutDefault(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Upstream should not be called")
+	})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"other/llama3"}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", rec.Code)
+	}
+}
+
+func TestStructuredOutputEmulation(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{EmulateJSONSchema: true},
+		func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if _, ok := body["response_format"]; ok {
+				t.Errorf("Expected response_format to be replaced with instructions")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"`+
+				"```json\\n{\\\"answer\\\": 42}\\n```"+`"}}]}`)
+		})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{
+		"model": "up/llama3",
+		"messages": [{"role": "user", "content": "?"}],
+		"response_format": {"type": "json_schema", "json_schema": {"name": "a", "schema": {
+			"type": "object", "properties": {"answer": {"type": "integer"}}, "required": ["answer"]
+		}}}
+	}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Header().Get("X-Router-Structured-Output") != "repaired" {
+		t.Errorf("Expected repaired outcome, got %q", rec.Header().Get("X-Router-Structured-Output"))
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &completion)
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != `{"answer": 42}` {
+		t.Errorf("Unexpected response body %s", rec.Body.String())
+	}
+}
+
+func TestRouterInfoOmitsURLsAndKeys(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {})
+	cfg.Version = "v1.2.3"
+	cfg.Backends = []model.BackendConfig{
+		{Name: "openai", BaseURL: "https://api.openai.com", Prefix: "openai/", Default: true, RequireAPIKey: true, KeyEnvVar: "OPENAI_API_KEY"},
+		{Name: "ollama", BaseURL: "http://localhost:11434", Prefix: "ollama/"},
+	}
+	cfg.Aliases = map[string]model.ModelAlias{"fast": {Models: []string{"ollama/llama3"}}}
+
+	req := httptest.NewRequest("GET", "/router/info", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	for _, secret := range []string{"api.openai.com", "localhost:11434", "OPENAI_API_KEY", "router-key"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Info leaks %q: %s", secret, body)
+		}
+	}
+	var info routerInfo
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if info.Name != "llm-router" || info.Version != "v1.2.3" || len(info.Backends) != 2 || !info.Backends[0].Default {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	if !info.Features["aliases"] || info.Features["history"] {
+		t.Errorf("Unexpected features %v", info.Features)
+	}
+	if info.BuiltIn["image_resize"] != vision.Available || len(info.BuiltIn) != 3 {
+		t.Errorf("Unexpected built-in subsystems %v", info.BuiltIn)
+	}
+}
+
+func TestBarePathsAreRoutedLikeV1Paths(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v1/chat/completions" || body["model"] != "llama3" {
+			t.Errorf("Expected a routed chat completion, got %s with model %v", r.URL.Path, body["model"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[]}`)
+	})
+
+	for _, path := range []string{"/chat/completions", "/v1/chat/completions/"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model":"up/llama3","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/chat/completions":     "/v1/chat/completions",
+		"/v1/chat/completions/": "/v1/chat/completions",
+		"/models/gpt-4o":        "/v1/models/gpt-4o",
+		"/healthz":              "/healthz",
+		"/router/info":          "/router/info",
+		"/router/history/":      "/router/history/",
+		"/modelsx":              "/modelsx",
+		"/":                     "/",
+	} {
+		if got := canonicalPath(path); got != want {
+			t.Errorf("canonicalPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
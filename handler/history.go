@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// defaultRecordedResponse bounds how much of a response is kept in the
+// history and audit log unless configured
+const defaultRecordedResponse = 4 << 20
+
+// recordExchange runs next and, if a history store or audit log is configured,
+// records the request body and the response it produced. The cost of the
+// response is charged to the budget of the key that sent it.
+func recordExchange(w http.ResponseWriter, r *http.Request, cfg *model.Config, next func(http.ResponseWriter, *http.Request, *model.Config)) {
+	rc := extension.FromRequest(r)
+	budgeted := rc.Key != nil && rc.Key.BudgetUSD > 0
+	if cfg.History == nil && cfg.AuditLog == nil && !budgeted {
+		next(w, r, cfg)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+		return
+	}
+	setBody(r, body)
+
+	capture := newCaptureWriter(w, cfg.Limits)
+	start := time.Now()
+	next(capture, r, cfg)
+
+	if budgeted && rc.Price != nil {
+		prompt, completion, _, _ := exchangeUsage(rc, capture)
+		chargeKey(cfg, rc, rc.Price.Cost(prompt, completion))
+	}
+	// Records of the same request share its hash, whatever its key order
+	hash, _ := utils.RequestHash(body)
+	if cfg.AuditLog != nil {
+		auditExchange(cfg, r, rc, start, capture, body, hash)
+	}
+	if cfg.History == nil {
+		return
+	}
+	exchange := history.Exchange{
+		ID:          rc.ID,
+		Time:        start.UTC(),
+		KeyID:       rc.KeyID,
+		Model:       rc.Model,
+		Path:        r.URL.Path,
+		RequestHash: hash,
+		Status:      capture.status,
+		DurationMS:  time.Since(start).Milliseconds(),
+		Request:     rawJSON(body),
+		Response:    rawJSON(capture.body),
+		Truncated:   capture.truncated,
+	}
+	if err := cfg.History.Record(exchange); err != nil {
+		cfg.Logger.Error("Failed to record exchange", zap.String("requestID", rc.ID), zap.Error(err))
+	}
+}
+
+// rawJSON returns data as is if it is JSON, otherwise as a JSON string, so
+// streamed responses are kept verbatim
+func rawJSON(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return data
+	}
+	encoded, _ := json.Marshal(string(data))
+	return encoded
+}
+
+// captureWriter keeps a copy of the response it writes, up to limit bytes.
+// The client always receives the whole response; only the copy is truncated.
+type captureWriter struct {
+	http.ResponseWriter
+	limit     int
+	status    int
+	body      []byte
+	truncated bool
+}
+
+// newCaptureWriter returns a captureWriter keeping as much as limits allow
+func newCaptureWriter(w http.ResponseWriter, limits model.LimitsConfig) *captureWriter {
+	limit := limits.RecordedResponseBytes
+	if limit <= 0 {
+		limit = defaultRecordedResponse
+	}
+	return &captureWriter{ResponseWriter: w, limit: limit}
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if room := c.limit - len(c.body); room < len(p) {
+		c.body = append(c.body, p[:max(room, 0)]...)
+		c.truncated = true
+	} else {
+		c.body = append(c.body, p...)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// handleHistory serves the admin history API:
+//
+//	POST /router/history/{id}/annotation  label an exchange
+//	GET  /router/history/export           export exchanges as JSON Lines
+func handleHistory(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	if cfg.History == nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "History is not enabled; set history_dir in the config"))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/router/history/")
+	switch {
+	case path == "export" && r.Method == "GET":
+		exportHistory(w, r, cfg)
+	case strings.HasSuffix(path, "/annotation") && r.Method == "POST":
+		annotateExchange(w, r, cfg, strings.TrimSuffix(path, "/annotation"))
+	default:
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Unknown history endpoint %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// annotateExchange records a rating, tags and note for an exchange
+func annotateExchange(w http.ResponseWriter, r *http.Request, cfg *model.Config, id string) {
+	var annotation history.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&annotation); err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Invalid annotation: %s", err))
+		return
+	}
+	annotation.ID = id
+	annotation.Time = time.Time{}
+
+	err := cfg.History.Annotate(annotation)
+	if errors.Is(err, history.ErrNotFound) {
+		utils.WriteErr(w, utils.NewError(utils.ErrNotFound, "No recorded exchange %s", id))
+		return
+	}
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "%s", err))
+		return
+	}
+
+	cfg.Logger.Info("Exchange annotated",
+		zap.String("requestID", id),
+		zap.String("rating", annotation.Rating),
+		zap.Strings("tags", annotation.Tags))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportHistory streams the exchanges matching the rating, tag and annotated
+// query parameters
+func exportHistory(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	query := r.URL.Query()
+	filter := history.Filter{
+		Rating:    query.Get("rating"),
+		Tags:      query["tag"],
+		Annotated: query.Get("annotated") == "true",
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	count, err := cfg.History.Export(w, filter)
+	if err != nil {
+		cfg.Logger.Error("History export failed", zap.Error(err))
+		return
+	}
+	cfg.Logger.Info("History exported", zap.Int("exchanges", count))
+}
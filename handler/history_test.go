@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+func TestHistoryAnnotateAndExport(t *testing.T) {
+	if !history.Available {
+		t.Skip("history is not built in")
+	}
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"SELECT 1"}}]}`)
+	})
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open history: %s", err)
+	}
+	defer store.Close()
+	cfg.History = store
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	rec := send("POST", "/v1/chat/completions", `{"model":"up/llama3","messages":[{"role":"user","content":"sql please"}]}`)
+	id := rec.Header().Get("X-Router-Request-ID")
+	if rec.Code != http.StatusOK || id == "" {
+		t.Fatalf("Expected a successful request with an ID, got %d %q", rec.Code, id)
+	}
+	send("POST", "/v1/chat/completions", `{"model":"up/llama3","messages":[{"role":"user","content":"unlabelled"}]}`)
+
+	if rec := send("POST", "/router/history/"+id+"/annotation", `{"rating":"good","tags":["sql"]}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected annotation to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send("POST", "/router/history/unknown/annotation", `{"rating":"good"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown exchange, got %d", rec.Code)
+	}
+
+	rec = send("GET", "/router/history/export?rating=good&tag=sql", "")
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "sql please") || !strings.Contains(lines[0], "SELECT 1") {
+		t.Errorf("Expected only the labelled exchange with its response, got %q", rec.Body.String())
+	}
+	if hash, _ := utils.RequestHash([]byte(`{"model":"up/llama3","messages":[{"role":"user","content":"sql please"}]}`)); !strings.Contains(lines[0], `"request_hash":"`+hash+`"`) {
+		t.Errorf("Expected the exchange to carry its request hash %s, got %q", hash, lines[0])
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/oidc"
+	"github.com/kcolemangt/llm-router/vision"
+)
+
+// routerEndpoints lists the endpoints the router handles itself; every other
+// path is proxied to the default backend
+var routerEndpoints = []string{
+	"POST /v1/chat/completions",
+	"POST /v1/responses",
+	"POST /v1/messages",
+	"POST /api/chat",
+	"POST /api/generate",
+	"GET /api/tags",
+	"GET /v1/realtime",
+	"POST /v1/audio/speech",
+	"POST /v1/audio/transcriptions",
+	"/v1/assistants",
+	"/v1/threads",
+	"/v1/vector_stores",
+	"/v1/fine_tuning",
+	"GET /healthz",
+	"POST /router/hash",
+	"GET /router/info",
+	"GET /router/ping",
+	"GET /router/events",
+	"GET /router/errors",
+	"GET /router/cancellations",
+	"GET /router/probe",
+	"GET /router/usage",
+	"GET /router/usage/export",
+	"POST /router/history/{id}/annotation",
+	"GET /router/history/export",
+}
+
+// routerInfo describes the router to client tooling. It names backends but
+// never reveals their URLs or keys.
+type routerInfo struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	Backends  []backendInfo   `json:"backends"`
+	Endpoints []string        `json:"endpoints"`
+	Features  map[string]bool `json:"features"`
+	BuiltIn   map[string]bool `json:"built_in"`
+}
+
+type backendInfo struct {
+	Name    string `json:"name"`
+	Prefix  string `json:"prefix"`
+	Default bool   `json:"default,omitempty"`
+}
+
+// handleInfo reports the router's version, backends, endpoints and enabled
+// features so clients can verify they are talking to llm-router and adapt
+func handleInfo(w http.ResponseWriter, cfg *model.Config) {
+	info := routerInfo{
+		Name:      "llm-router",
+		Version:   cfg.Version,
+		Backends:  make([]backendInfo, 0, len(cfg.Backends)),
+		Endpoints: routerEndpoints,
+		Features: map[string]bool{
+			"aliases":          len(cfg.Aliases) > 0,
+			"routing_rules":    len(cfg.RoutingRules) > 0,
+			"redaction":        len(cfg.Redaction.Detectors) > 0 || len(cfg.Redaction.Patterns) > 0,
+			"history":          cfg.History != nil,
+			"audit":            cfg.AuditLog != nil,
+			"post_conditions":  len(cfg.PostConditions) > 0,
+			"synthetic_models": len(cfg.SyntheticModels) > 0,
+			"stream_resume":    cfg.Streams != nil,
+			"jwt_auth":         cfg.JWTVerifier != nil,
+		},
+		// Subsystems a slim build may leave out, whether configured or not
+		BuiltIn: map[string]bool{
+			"history":        history.Available,
+			"image_resize":   vision.Available,
+			"single_sign_on": oidc.Available,
+		},
+	}
+	for _, key := range cfg.APIKeys {
+		if key.FineTuning {
+			info.Features["fine_tuning"] = true
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	for _, backend := range cfg.Backends {
+		info.Backends = append(info.Backends, backendInfo{Name: backend.Name, Prefix: backend.Prefix, Default: backend.Default})
+		if backend.Hooks.RequestURL != "" || backend.Hooks.ResponseURL != "" {
+			info.Features["hooks"] = true
+		}
+		if backend.EmulateJSONSchema {
+			info.Features["structured_output_emulation"] = true
+		}
+		if len(backend.Instances) > 0 {
+			info.Features["instance_pools"] = true
+		}
+		if backend.Assistants {
+			info.Features["assistants"] = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
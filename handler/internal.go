@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// callModel sends a request of the router's own, such as for a summary or an
+// embedding, to a model on behalf of a client request. It gets its own copy
+// of the request context and is routed like any other, with the client's key,
+// except that a pinned backend does not apply and it is not priced. build returns the body given
+// the model name the backend expects.
+func callModel(r *http.Request, cfg *model.Config, modelName, apiPath string, build func(backendModel string) map[string]interface{}, logger *zap.Logger) (*bufferedResponse, error) {
+	rc := *extension.FromRequest(r)
+	rc.PinnedBackend = ""
+	// The client's model is priced, not the router's own calls
+	rc.Price = nil
+	attempt := extension.WithRequestContext(r.Clone(r.Context()), &rc)
+	target, backendModel, err := resolveBackend(attempt, cfg.Router, modelName, logger)
+	if err != nil {
+		return nil, err
+	}
+	req := build(backendModel)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	rc.SetChatRequest(req, cfg.TokenizerSet)
+	rc.Model = modelName
+	rc.BackendModel = backendModel
+	attempt.Method = http.MethodPost
+	attempt.URL.Path, attempt.URL.RawPath = apiPath, ""
+	setBody(attempt, body)
+
+	response := newBufferedResponse()
+	target.ServeHTTP(response, attempt)
+	if response.status >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("%s answered %d", modelName, response.status)
+	}
+	return response, nil
+}
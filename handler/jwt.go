@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/oidc"
+)
+
+// jwtError returns why the JWT r carries was rejected, if it was
+func jwtError(cfg *model.Config, r *http.Request) error {
+	_, _, err := jwtKey(cfg, r)
+	return err
+}
+
+// jwtKey verifies the JWT r carries, if JWT auth is configured, and returns
+// the key whose policies apply and the identity it was issued to. The key is
+// the api_keys entry the token's key claim names, or one named after the
+// identity without any policies. It returns a nil key for anything but a JWT.
+func jwtKey(cfg *model.Config, r *http.Request) (*model.APIKeyConfig, string, error) {
+	token, ok := strings.CutPrefix(requestAuthorization(r), "Bearer ")
+	if cfg.JWTVerifier == nil || !ok || !oidc.LooksLikeJWT(token) {
+		return nil, "", nil
+	}
+	claims, err := cfg.JWTVerifier.Verify(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	identityClaim := cfg.JWT.IdentityClaim
+	if identityClaim == "" {
+		identityClaim = "sub"
+	}
+	identities := claims.Strings(identityClaim)
+	if len(identities) == 0 {
+		return nil, "", fmt.Errorf("token has no %s claim", identityClaim)
+	}
+	identity := identities[0]
+
+	if cfg.JWT.KeyClaim != "" {
+		for _, name := range claims.Strings(cfg.JWT.KeyClaim) {
+			for i, key := range cfg.APIKeys {
+				if key.Name == name {
+					return &cfg.APIKeys[i], identity, nil
+				}
+			}
+		}
+		if cfg.JWT.RequireKey {
+			return nil, "", fmt.Errorf("%s is not permitted: its %s claim names no api key", identity, cfg.JWT.KeyClaim)
+		}
+	}
+	return &model.APIKeyConfig{Name: identity}, identity, nil
+}
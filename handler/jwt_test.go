@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/oidc"
+)
+
+func TestJWTAuthMapsClaimsToKeys(t *testing.T) {
+	if !oidc.Available {
+		t.Skip("single sign-on is not built in")
+	}
+	b64 := base64.RawURLEncoding
+	signingKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "n": b64.EncodeToString(signingKey.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+		}}})
+	}))
+	defer provider.Close()
+	token := func(sub string, groups ...string) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+		payload, _ := json.Marshal(map[string]interface{}{"iss": "https://sso.example.com", "aud": "llm-router", "sub": sub, "groups": groups, "exp": time.Now().Add(time.Hour).Unix()})
+		signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, signingKey, crypto.SHA256, digest[:])
+		return signed + "." + b64.EncodeToString(signature)
+	}
+
+	cfg := newTestRouter(t, model.BackendConfig{Default: true}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[]}`))
+	})
+	cfg.Backends = []model.BackendConfig{{Name: "up", Prefix: "up/"}}
+	cfg.APIKeys = []model.APIKeyConfig{{Name: "interns", Models: []string{"up/small-*"}}}
+	cfg.JWT = model.JWTConfig{Issuer: "https://sso.example.com", Audience: "llm-router", KeyClaim: "groups"}
+	cfg.JWTVerifier = oidc.New(cfg.JWT.Issuer, cfg.JWT.Audience, provider.URL)
+
+	send := func(auth, target, modelName string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, strings.NewReader(`{"model":"`+modelName+`"}`))
+		req.Header.Set("Authorization", "Bearer "+auth)
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name, auth, target, model string
+		status                    int
+	}{
+		{"unmapped identity", token("alice"), "/v1/chat/completions", "up/big-model", http.StatusOK},
+		{"mapped to interns", token("bob", "staff", "interns"), "/v1/chat/completions", "up/small-model", http.StatusOK},
+		{"interns allowlist", token("bob", "interns"), "/v1/chat/completions", "up/big-model", http.StatusForbidden},
+		{"admin endpoint", token("alice"), "/router/errors", "", http.StatusUnauthorized},
+		{"tampered", token("alice") + "x", "/v1/chat/completions", "up/big-model", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rec := send(tt.auth, tt.target, tt.model); rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	cfg.JWT.RequireKey = true
+	if rec := send(token("alice"), "/v1/chat/completions", "up/big-model"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a token mapping to no key to be refused, got %d", rec.Code)
+	}
+}
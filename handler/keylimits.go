@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/usage"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// limitKeys refuses API requests from named keys that are over their requests
+// per minute or have spent their budget for the period. The counts live in the
+// state store; when it fails, requests are let through.
+func limitKeys(cfg *model.Config) extension.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := extension.FromRequest(r).Key
+			if key == nil || cfg.StateStore == nil || endpointGroup(r.URL.Path) != model.ServeAPI {
+				next.ServeHTTP(w, r)
+				return
+			}
+			now := time.Now()
+			fields := []zap.Field{zap.String("key", key.Name)}
+
+			if key.RequestsPerMinute > 0 {
+				minute := now.Truncate(time.Minute)
+				count, err := cfg.StateStore.Incr(r.Context(), "ratelimit:"+key.Name+":"+strconv.FormatInt(minute.Unix(), 10), 1, time.Minute)
+				if err != nil {
+					cfg.Logger.Warn("Failed to count request against rate limit", append(fields, zap.Error(err))...)
+				} else if count > int64(key.RequestsPerMinute) {
+					cfg.Logger.Info("API key over its rate limit", append(fields,
+						zap.String("event", "key.rate_limited"),
+						zap.Int("requestsPerMinute", key.RequestsPerMinute))...)
+					w.Header().Set("Retry-After", strconv.Itoa(int(minute.Add(time.Minute).Sub(now).Seconds())+1))
+					utils.WriteErr(w, utils.NewError(utils.ErrRateLimited,
+						"Key %s is limited to %d requests per minute, try again later", key.Name, key.RequestsPerMinute))
+					return
+				}
+			}
+
+			if key.BudgetUSD > 0 {
+				start, end := budgetPeriod(cfg, key, now)
+				spent, ok, err := cfg.StateStore.Get(r.Context(), budgetKey(key, start))
+				micros, _ := strconv.ParseInt(string(spent), 10, 64)
+				if err != nil {
+					cfg.Logger.Warn("Failed to read spend against budget", append(fields, zap.Error(err))...)
+				} else if ok && micros >= dollarsToMicros(key.BudgetUSD) {
+					cfg.Logger.Info("API key over its budget", append(fields,
+						zap.String("event", "key.over_budget"),
+						zap.Float64("budgetUSD", key.BudgetUSD))...)
+					w.Header().Set("Retry-After", strconv.Itoa(int(end.Sub(now).Seconds())+1))
+					utils.WriteErr(w, utils.NewError(utils.ErrQuotaExceeded,
+						"Key %s has spent its budget of $%.2f for this %s", key.Name, key.BudgetUSD, budgetPeriodName(key)))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// chargeKey adds the cost of a request to its key's spend for the period, and
+// reports the request that exhausts the budget
+func chargeKey(cfg *model.Config, rc *extension.RequestContext, cost float64) {
+	key := rc.Key
+	if key == nil || key.BudgetUSD <= 0 || cost <= 0 || cfg.StateStore == nil {
+		return
+	}
+	now := time.Now()
+	start, end := budgetPeriod(cfg, key, now)
+	micros := dollarsToMicros(cost)
+	// The counter outlives the period a little, so clocks that disagree
+	// slightly still find it
+	total, err := cfg.StateStore.Incr(context.Background(), budgetKey(key, start), micros, end.Sub(now)+time.Hour)
+	if err != nil {
+		cfg.Logger.Warn("Failed to record spend against budget", zap.String("key", key.Name), zap.String("requestID", rc.ID), zap.Error(err))
+		return
+	}
+	budget := dollarsToMicros(key.BudgetUSD)
+	if total >= budget && total-micros < budget {
+		cfg.Logger.Warn("API key spent its budget",
+			zap.String("event", "key.budget_exhausted"),
+			zap.String("key", key.Name),
+			zap.Float64("budgetUSD", key.BudgetUSD),
+			zap.String("period", budgetPeriodName(key)),
+			zap.Time("until", end))
+		events.Publish("key.budget_exhausted", map[string]interface{}{
+			"key": key.Name, "budget_usd": key.BudgetUSD, "period": budgetPeriodName(key), "until": end,
+		})
+	}
+}
+
+// budgetPeriod returns the calendar day or month, in the configured time
+// zone, that now falls in
+func budgetPeriod(cfg *model.Config, key *model.APIKeyConfig, now time.Time) (time.Time, time.Time) {
+	local := now.In(reportLocation(cfg))
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	if key.BudgetPeriod == usage.PeriodMonth {
+		start = start.AddDate(0, 0, 1-local.Day())
+		return start, start.AddDate(0, 1, 0)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+func budgetPeriodName(key *model.APIKeyConfig) string {
+	if key.BudgetPeriod == "" {
+		return usage.PeriodDay
+	}
+	return key.BudgetPeriod
+}
+
+// budgetKey is the state store counter of a key's spend in the period
+// starting at start, in millionths of a dollar
+func budgetKey(key *model.APIKeyConfig, start time.Time) string {
+	return "budget:" + key.Name + ":" + start.Format("2006-01-02")
+}
+
+func dollarsToMicros(usd float64) int64 {
+	return int64(math.Round(usd * 1e6))
+}
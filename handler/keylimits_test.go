@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/state"
+	"go.uber.org/zap"
+)
+
+func keyLimitConfig(t *testing.T, key model.APIKeyConfig) *model.Config {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":1000,"total_tokens":2000}}`)
+	}))
+	t.Cleanup(backend.Close)
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		Backends:     []model.BackendConfig{{Name: "openai", BaseURL: backend.URL, Prefix: "openai/", Default: true}},
+		APIKeys:      []model.APIKeyConfig{key},
+		ModelPrices:  map[string]model.ModelPrice{"openai/gpt-4o": {Input: 0.5, Output: 1}},
+		StateStore:   state.NewMemory(100),
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+	return cfg
+}
+
+func sendAs(cfg *model.Config, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	return rec
+}
+
+func TestKeyRateLimit(t *testing.T) {
+	cfg := keyLimitConfig(t, model.APIKeyConfig{Name: "ci", Key: "ci-key", RequestsPerMinute: 2})
+	for i := 0; i < 2; i++ {
+		if rec := sendAs(cfg, "ci-key"); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	rec := sendAs(cfg, "ci-key")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "rate_limited") {
+		t.Errorf("Expected the third request to be rate limited, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+	// The router key is not limited
+	if rec := sendAs(cfg, "router-key"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the router key to be let through, got %d", rec.Code)
+	}
+}
+
+func TestKeyBudget(t *testing.T) {
+	// Each request costs $1.50, so the second one spends the $2 budget
+	cfg := keyLimitConfig(t, model.APIKeyConfig{Name: "ci", Key: "ci-key", BudgetUSD: 2})
+	for i := 0; i < 2; i++ {
+		if rec := sendAs(cfg, "ci-key"); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	rec := sendAs(cfg, "ci-key")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "quota_exceeded") {
+		t.Errorf("Expected the key's budget to be spent, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
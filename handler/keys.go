@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/keyring"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// keyPermits checks a model and the backend it is routed to against a named
+// key's allowlists
+func keyPermits(key *model.APIKeyConfig, modelName, backend string) error {
+	if err := keyPermitsBackend(key, backend); err != nil {
+		return err
+	}
+	if len(key.Models) == 0 {
+		return nil
+	}
+	for _, glob := range key.Models {
+		if ok, _ := path.Match(glob, modelName); ok {
+			return nil
+		}
+	}
+	return utils.NewError(utils.ErrModelDenied, "Key %s may not use model %s", key.Name, modelName)
+}
+
+// keyPermitsBackend checks a backend against a named key's allowlist
+func keyPermitsBackend(key *model.APIKeyConfig, backend string) error {
+	if len(key.Backends) == 0 || slices.Contains(key.Backends, backend) {
+		return nil
+	}
+	return utils.NewError(utils.ErrPermissionDenied, "Key %s may not use backend %s", key.Name, backend)
+}
+
+// handleKeyRotation replaces the router key in the key file and returns the
+// new one. The replaced key keeps working for the grace duration given in the
+// query, a day by default, so clients can be moved over without an outage.
+func handleKeyRotation(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	if cfg.Keys == nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Key rotation needs a key file; set key_file in the config"))
+		return
+	}
+	grace := keyring.DefaultGrace
+	if value := r.URL.Query().Get("grace"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "grace must be a duration such as 1h30m"))
+			return
+		}
+		grace = d
+	}
+
+	state, err := cfg.Keys.Rotate(grace)
+	if err != nil {
+		cfg.Logger.Error("Failed to rotate the router key", zap.String("keyFile", cfg.KeyFile), zap.Error(err))
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Failed to rotate the router key"))
+		return
+	}
+	validUntil := time.Now()
+	if grace > 0 {
+		validUntil = state.Previous[0].Expires
+	}
+	cfg.Logger.Info("Rotated the router key",
+		zap.String("event", "security.key_rotated"),
+		zap.String("keyID", utils.KeyID("Bearer "+state.Key)),
+		zap.Time("previousValidUntil", validUntil))
+	events.Publish("security.key_rotated", map[string]interface{}{"previous_valid_until": validUntil})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":                  state.Key,
+		"previous_valid_until": validUntil,
+	})
+}
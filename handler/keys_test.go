@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/keyring"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestKeyAllowlists(t *testing.T) {
+	served := make(map[string]bool)
+	newBackend := func(name string) model.BackendConfig {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served[name] = true
+			w.Write([]byte(`{"choices":[],"data":[]}`))
+		}))
+		t.Cleanup(server.Close)
+		return model.BackendConfig{Name: name, BaseURL: server.URL, Prefix: name + "/"}
+	}
+	backends := []model.BackendConfig{newBackend("openai"), newBackend("ollama")}
+	backends[0].Default = true
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		Backends:     backends,
+		APIKeys: []model.APIKeyConfig{
+			{Name: "intern", Key: "intern-key", Backends: []string{"ollama"}},
+			{Name: "mini", Key: "mini-key", Models: []string{"openai/gpt-4o-mini*", "ollama/*"}},
+		},
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	tests := []struct {
+		key, path, model string
+		status           int
+		code             string
+	}{
+		{"intern-key", "/v1/chat/completions", "ollama/llama3", http.StatusOK, ""},
+		{"intern-key", "/v1/chat/completions", "openai/gpt-4o", http.StatusForbidden, "permission_denied"},
+		{"intern-key", "/v1/chat/completions", "gpt-4o", http.StatusForbidden, "permission_denied"},
+		{"intern-key", "/v1/embeddings", "text-embedding-3-small", http.StatusForbidden, "permission_denied"},
+		{"mini-key", "/v1/chat/completions", "openai/gpt-4o-mini", http.StatusOK, ""},
+		{"mini-key", "/v1/chat/completions", "ollama/qwen2.5", http.StatusOK, ""},
+		{"mini-key", "/v1/chat/completions", "openai/gpt-4o", http.StatusForbidden, "model_denied"},
+		{"mini-key", "/v1/audio/speech", "openai/tts-1", http.StatusForbidden, "model_denied"},
+		{"router-key", "/v1/chat/completions", "openai/gpt-4o", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		clear(served)
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"model":"`+tt.model+`"}`))
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s %s %s: expected %d %s, got %d %s", tt.key, tt.path, tt.model, tt.status, tt.code, rec.Code, rec.Body.String())
+		}
+		if tt.status != http.StatusOK && len(served) != 0 {
+			t.Errorf("%s %s %s: expected no backend to be used, got %v", tt.key, tt.path, tt.model, served)
+		}
+	}
+}
+
+func TestKeyRotationKeepsOldKeyDuringGrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ring, err := keyring.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &model.Config{Logger: zap.NewNop(), KeyFile: path, Keys: ring}
+	old := ring.Current()
+	send := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	rec := send("POST", "/router/keys/rotate?grace=1h", old)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the rotation to succeed, got %d %s", rec.Code, rec.Body.String())
+	}
+	var rotated struct {
+		Key string `json:"key"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &rotated)
+	if rotated.Key == "" || rotated.Key == old {
+		t.Fatalf("Expected a new key, got %q", rotated.Key)
+	}
+	for _, key := range []string{old, rotated.Key} {
+		if rec := send("GET", "/router/info", key); rec.Code != http.StatusOK {
+			t.Errorf("Expected %s to be accepted during the grace window, got %d", key, rec.Code)
+		}
+	}
+
+	if rec := send("POST", "/router/keys/rotate?grace=0s", rotated.Key); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the rotation to succeed, got %d", rec.Code)
+	}
+	if rec := send("GET", "/router/info", rotated.Key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the key replaced without grace to be rejected, got %d", rec.Code)
+	}
+	if rec := send("POST", "/router/keys/rotate?grace=soon", ring.Current()); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid grace to be rejected, got %d", rec.Code)
+	}
+}
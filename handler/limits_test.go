@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// recordEverything enables history and an audit log with bodies on cfg
+func recordEverything(t *testing.T, cfg *model.Config) {
+	if !history.Available {
+		t.Skip("history is not built in")
+	}
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open history: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"), true)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %s", err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+	cfg.History, cfg.AuditLog = store, auditLog
+}
+
+func TestCaptureWriterKeepsLimitButPassesEverything(t *testing.T) {
+	rec := httptest.NewRecorder()
+	capture := newCaptureWriter(rec, model.LimitsConfig{RecordedResponseBytes: 10})
+	capture.Write([]byte("0123456789abcdef"))
+	capture.Write([]byte("ghijklmnop"))
+
+	if rec.Body.String() != "0123456789abcdefghijklmnop" {
+		t.Errorf("Expected the client to receive every byte, got %q", rec.Body.String())
+	}
+	if string(capture.body) != "0123456789" || !capture.truncated {
+		t.Errorf("Expected a truncated 10 byte copy, got %q (truncated %v)", capture.body, capture.truncated)
+	}
+	if newCaptureWriter(rec, model.LimitsConfig{}).limit != defaultRecordedResponse {
+		t.Errorf("Expected the default limit when unset")
+	}
+}
+
+func TestLargeResponsesReachClientIntact(t *testing.T) {
+	content := strings.Repeat("x", 6<<20)
+	want := `{"choices":[{"message":{"content":"` + content + `"}}]}`
+	for _, limit := range []int{0, 1024} {
+		cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			// Written in pieces, like a backend flushing a large body
+			for i := 0; i < len(want); i += 64 << 10 {
+				w.Write([]byte(want[i:min(i+64<<10, len(want))]))
+			}
+		})
+		recordEverything(t, cfg)
+		cfg.Limits.RecordedResponseBytes = limit
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"up/llama3","messages":[{"role":"user","content":"long"}]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if rec.Body.Len() != len(want) || rec.Body.String() != want {
+			t.Errorf("limit %d: expected %d bytes intact, got %d", limit, len(want), rec.Body.Len())
+		}
+	}
+}
+
+func TestSlowStreamWithLongLinesReachesClientIntact(t *testing.T) {
+	var sent bytes.Buffer
+	long := strings.Repeat("y", 2<<20)
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("chunk %d ", i)
+		if i == 10 {
+			content = long
+		}
+		fmt.Fprintf(&sent, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+	}
+	sent.WriteString("data: [DONE]\n\n")
+	stream := sent.Bytes()
+
+	cfg := newTestRouterWithLimits(t, model.LimitsConfig{StreamLineBytes: 1024, ErrorPeekBytes: 512}, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		// Odd-sized writes split lines, including the long one, across reads
+		for i := 0; i < len(stream); i += 7919 {
+			w.Write(stream[i:min(i+7919, len(stream))])
+			flusher.Flush()
+			if i%(100*7919) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	})
+	recordEverything(t, cfg)
+	cfg.Limits.RecordedResponseBytes = 4096
+
+	server := httptest.NewServer(NewHandler(cfg))
+	defer server.Close()
+	req, _ := http.NewRequest("POST", server.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model":"up/llama3","stream":true,"messages":[{"role":"user","content":"stream"}]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	var got bytes.Buffer
+	got.ReadFrom(resp.Body)
+
+	if !bytes.Equal(got.Bytes(), stream) {
+		t.Errorf("Expected the %d byte stream intact, got %d bytes", len(stream), got.Len())
+	}
+}
+
+func TestLargeErrorBodyReachesClientIntact(t *testing.T) {
+	message := "Rate limit reached. " + strings.Repeat("details ", 100<<10)
+	want := `{"error":{"message":"` + message + `","type":"rate_limit_error"}}`
+	cfg := newTestRouterWithLimits(t, model.LimitsConfig{ErrorPeekBytes: 512}, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(want))
+	})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"up/llama3","messages":[]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusTooManyRequests || rec.Body.String() != want {
+		t.Errorf("Expected the %d byte error intact, got %d with %d bytes", len(want), rec.Code, rec.Body.Len())
+	}
+	if class := rec.Header().Get("X-Router-Error-Class"); class == "" {
+		t.Errorf("Expected the error to be classified from its first bytes")
+	}
+}
@@ -0,0 +1,635 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// messagesPath is the Anthropic Messages API, which the router serves by
+// translating to and from chat completions
+const messagesPath = "/v1/messages"
+
+// messagesRequest is the part of an Anthropic Messages request the router translates
+type messagesRequest struct {
+	Model         string            `json:"model"`
+	MaxTokens     int               `json:"max_tokens"`
+	System        json.RawMessage   `json:"system"`
+	Messages      []messagesMessage `json:"messages"`
+	Stream        bool              `json:"stream"`
+	Temperature   *float64          `json:"temperature"`
+	TopP          *float64          `json:"top_p"`
+	StopSequences []string          `json:"stop_sequences"`
+	Tools         []struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		InputSchema json.RawMessage `json:"input_schema"`
+	} `json:"tools"`
+	ToolChoice *struct {
+		Type                   string `json:"type"`
+		Name                   string `json:"name"`
+		DisableParallelToolUse bool   `json:"disable_parallel_tool_use"`
+	} `json:"tool_choice"`
+	Metadata struct {
+		UserID string `json:"user_id"`
+	} `json:"metadata"`
+}
+
+type messagesMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// messagesBlock is a content block of a message or a tool result
+type messagesBlock struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Source struct {
+		Type      string `json:"type"`
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+		URL       string `json:"url"`
+	} `json:"source"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// handleMessages serves an Anthropic Messages request: it is translated to a
+// chat completions request, routed like any other, and the answer translated back
+func handleMessages(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeMessagesError(w, http.StatusInternalServerError, "Error reading request body")
+		return
+	}
+	var req messagesRequest
+	if err := utils.UnmarshalJSON(body, &req); err != nil {
+		writeMessagesError(w, http.StatusBadRequest, "Error unmarshalling request body")
+		return
+	}
+	chatReq, err := messagesToChat(req)
+	if err != nil {
+		writeMessagesError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body, err = json.Marshal(chatReq); err != nil {
+		writeMessagesError(w, http.StatusInternalServerError, "Error encoding request")
+		return
+	}
+
+	// Backends are sent a chat completions request with the key where the
+	// router expects it, and none of the Anthropic headers
+	if auth := requestAuthorization(r); auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	r.Header.Del("X-Api-Key")
+	r.Header.Del("Anthropic-Version")
+	r.Header.Del("Anthropic-Beta")
+	asChatCompletions(r, body)
+
+	if req.Stream {
+		stream := newMessagesStream(w, req.Model, extension.FromRequest(r).ID)
+		recordExchange(stream, r, cfg, handleModelRequest)
+		stream.finish()
+		return
+	}
+	response := newBufferedResponse()
+	recordExchange(response, r, cfg, handleModelRequest)
+	for key, values := range response.header {
+		if key != "Content-Length" {
+			w.Header()[key] = values
+		}
+	}
+	if response.status >= 400 {
+		writeMessagesError(w, response.status, errorMessage(response.body.Bytes()))
+		return
+	}
+	message, err := chatToMessage(response.body.Bytes(), req.Model, extension.FromRequest(r).ID)
+	if err != nil {
+		writeMessagesError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, message)
+}
+
+// asChatCompletions turns r into the chat completions request body
+func asChatCompletions(r *http.Request, body []byte) {
+	r.URL.Path, r.URL.RawPath = "/v1/chat/completions", ""
+	setBody(r, body)
+}
+
+// messagesToChat translates an Anthropic Messages request to chat completions
+func messagesToChat(req messagesRequest) (map[string]interface{}, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("model: field required")
+	}
+	var messages []interface{}
+	system, err := messagesText(req.System)
+	if err != nil {
+		return nil, fmt.Errorf("system: %s", err)
+	}
+	if system != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": system})
+	}
+	for i, m := range req.Messages {
+		translated, err := messageToChat(m)
+		if err != nil {
+			return nil, fmt.Errorf("messages.%d: %s", i, err)
+		}
+		messages = append(messages, translated...)
+	}
+
+	chatReq := map[string]interface{}{"model": req.Model, "messages": messages}
+	if req.MaxTokens > 0 {
+		chatReq["max_tokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		chatReq["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		chatReq["top_p"] = *req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		chatReq["stop"] = req.StopSequences
+	}
+	if req.Metadata.UserID != "" {
+		chatReq["user"] = req.Metadata.UserID
+	}
+	if req.Stream {
+		chatReq["stream"] = true
+		chatReq["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	if len(req.Tools) > 0 {
+		var tools []interface{}
+		for _, tool := range req.Tools {
+			function := map[string]interface{}{"name": tool.Name}
+			if tool.Description != "" {
+				function["description"] = tool.Description
+			}
+			if len(tool.InputSchema) > 0 {
+				function["parameters"] = tool.InputSchema
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+		chatReq["tools"] = tools
+	}
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "auto", "none":
+			chatReq["tool_choice"] = choice.Type
+		case "any":
+			chatReq["tool_choice"] = "required"
+		case "tool":
+			chatReq["tool_choice"] = map[string]interface{}{"type": "function", "function": map[string]string{"name": choice.Name}}
+		}
+		if choice.DisableParallelToolUse {
+			chatReq["parallel_tool_calls"] = false
+		}
+	}
+	return chatReq, nil
+}
+
+// messageToChat translates one message. Tool results become tool messages,
+// which precede whatever else the user said.
+func messageToChat(m messagesMessage) ([]interface{}, error) {
+	var text string
+	if json.Unmarshal(m.Content, &text) == nil {
+		return []interface{}{map[string]interface{}{"role": m.Role, "content": text}}, nil
+	}
+	var blocks []messagesBlock
+	if err := json.Unmarshal(m.Content, &blocks); err != nil {
+		return nil, fmt.Errorf("content must be a string or a list of content blocks")
+	}
+
+	var messages, parts, toolCalls []interface{}
+	var texts []string
+	images := false
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+			parts = append(parts, map[string]interface{}{"type": "text", "text": block.Text})
+		case "image":
+			url := block.Source.URL
+			if block.Source.Type == "base64" {
+				url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			images = true
+			parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]string{"url": url}})
+		case "tool_use":
+			input := block.Input
+			if len(input) == 0 {
+				input = json.RawMessage(`{}`)
+			}
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       block.ID,
+				"type":     "function",
+				"function": map[string]string{"name": block.Name, "arguments": string(input)},
+			})
+		case "tool_result":
+			content, err := messagesText(block.Content)
+			if err != nil {
+				return nil, fmt.Errorf("tool_result: %s", err)
+			}
+			if block.IsError {
+				content = "Error: " + content
+			}
+			messages = append(messages, map[string]interface{}{"role": "tool", "tool_call_id": block.ToolUseID, "content": content})
+		case "thinking", "redacted_thinking":
+			// Reasoning from an earlier turn is for the model that produced it
+		default:
+			return nil, fmt.Errorf("content blocks of type %q are not supported", block.Type)
+		}
+	}
+
+	message := map[string]interface{}{"role": m.Role}
+	switch {
+	case images:
+		message["content"] = parts
+	case len(texts) > 0:
+		message["content"] = strings.Join(texts, "\n")
+	case len(toolCalls) > 0:
+		message["content"] = nil
+	default:
+		return messages, nil
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	return append(messages, message), nil
+}
+
+// messagesText returns the text of a string or of a list of text blocks
+func messagesText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, nil
+	}
+	var blocks []messagesBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", fmt.Errorf("must be a string or a list of text blocks")
+	}
+	var texts []string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// chatCompletion is the part of a chat completion the router translates back
+type chatCompletion struct {
+	Choices []struct {
+		Message struct {
+			Content   string     `json:"content"`
+			ToolCalls []toolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+}
+
+type toolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// chatToMessage translates a chat completion to an Anthropic message
+func chatToMessage(body []byte, modelName, id string) (map[string]interface{}, error) {
+	var completion chatCompletion
+	if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("The backend's answer could not be translated")
+	}
+	choice := completion.Choices[0]
+	content := []interface{}{}
+	if choice.Message.Content != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": choice.Message.Content})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		content = append(content, map[string]interface{}{
+			"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": toolInput(call.Function.Arguments),
+		})
+	}
+	message := newMessage(id, modelName)
+	message["content"] = content
+	message["stop_reason"] = stopReason(choice.FinishReason)
+	if completion.Usage != nil {
+		message["usage"] = map[string]int{"input_tokens": completion.Usage.PromptTokens, "output_tokens": completion.Usage.CompletionTokens}
+	}
+	return message, nil
+}
+
+// newMessage returns an empty Anthropic message, identified by the request ID
+func newMessage(id, modelName string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            "msg_" + id,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         modelName,
+		"content":       []interface{}{},
+		"stop_reason":   nil,
+		"stop_sequence": nil,
+		"usage":         map[string]int{"input_tokens": 0, "output_tokens": 0},
+	}
+}
+
+// toolInput returns a tool call's arguments as the object Anthropic clients
+// expect, even when the model produced invalid JSON
+func toolInput(arguments string) json.RawMessage {
+	var input map[string]interface{}
+	if json.Unmarshal([]byte(arguments), &input) != nil || input == nil {
+		return json.RawMessage(`{}`)
+	}
+	return json.RawMessage(arguments)
+}
+
+// stopReason translates a chat completion finish reason
+func stopReason(finish string) string {
+	switch finish {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// errorMessage returns the message of an error response, or its body
+func errorMessage(body []byte) string {
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &response) == nil && response.Error.Message != "" {
+		return response.Error.Message
+	}
+	if message := strings.TrimSpace(string(body)); message != "" {
+		return message
+	}
+	return "The backend sent no answer"
+}
+
+// messagesErrorType is the Anthropic error type of a status
+func messagesErrorType(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	}
+	if status >= 500 {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
+
+// messagesError is an error as Anthropic clients expect it
+func messagesError(status int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": messagesErrorType(status), "message": message},
+	}
+}
+
+// writeMessagesError writes an error as Anthropic clients expect it
+func writeMessagesError(w http.ResponseWriter, status int, message string) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(messagesError(status, message))
+}
+
+// chunkWriter passes the chunks of a chat completions stream to onChunk as
+// they arrive, for translation into another API's stream. Errors, and answers
+// that come back whole, are held for the translation to finish with.
+type chunkWriter struct {
+	w       http.ResponseWriter
+	onChunk func(data string)
+	status  int
+	held    bytes.Buffer
+	pending []byte
+}
+
+func (c *chunkWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *chunkWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	c.WriteHeader(http.StatusOK)
+	if c.status >= 400 || !strings.Contains(c.w.Header().Get("Content-Type"), "text/event-stream") {
+		return c.held.Write(p)
+	}
+	c.pending = append(c.pending, p...)
+	for {
+		data := bytes.ReplaceAll(c.pending, []byte("\r\n"), []byte("\n"))
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		c.pending = data[end+2:]
+		for _, line := range bytes.Split(data[:end], []byte("\n")) {
+			if payload, ok := utils.SSEData(line); ok && string(payload) != "[DONE]" {
+				c.onChunk(string(payload))
+			}
+		}
+	}
+	http.NewResponseController(c.w).Flush()
+	return len(p), nil
+}
+
+// streamChunk is the part of a chat completions stream chunk translations read
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string     `json:"content"`
+			ToolCalls []toolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+}
+
+// messagesStream translates a chat completions stream into Anthropic's
+// Messages events as it arrives
+type messagesStream struct {
+	chunkWriter
+	model string
+	id    string
+
+	started    bool
+	index      int
+	block      string
+	tools      map[int]bool
+	stopReason string
+	usage      chatUsage
+}
+
+func newMessagesStream(w http.ResponseWriter, modelName, id string) *messagesStream {
+	s := &messagesStream{model: modelName, id: id, index: -1, tools: map[int]bool{}}
+	s.chunkWriter = chunkWriter{w: w, onChunk: s.chunk}
+	return s
+}
+
+// chunk translates one chat completions stream chunk
+func (s *messagesStream) chunk(data string) {
+	var chunk streamChunk
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return
+	}
+	s.start()
+	if chunk.Usage != nil {
+		s.usage = *chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+	if choice.Delta.Content != "" {
+		if s.block != "text" {
+			s.open(map[string]interface{}{"type": "text", "text": ""})
+		}
+		s.event("content_block_delta", map[string]interface{}{"index": s.index, "delta": map[string]string{"type": "text_delta", "text": choice.Delta.Content}})
+	}
+	for _, call := range choice.Delta.ToolCalls {
+		if !s.tools[call.Index] {
+			s.tools[call.Index] = true
+			s.open(map[string]interface{}{"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": map[string]interface{}{}})
+		}
+		if call.Function.Arguments != "" {
+			s.event("content_block_delta", map[string]interface{}{"index": s.index, "delta": map[string]string{"type": "input_json_delta", "partial_json": call.Function.Arguments}})
+		}
+	}
+	if choice.FinishReason != "" {
+		s.stopReason = stopReason(choice.FinishReason)
+	}
+}
+
+// start sends message_start before the first event
+func (s *messagesStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Del("Content-Length")
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.WriteHeader(http.StatusOK)
+	s.event("message_start", map[string]interface{}{"message": newMessage(s.id, s.model)})
+}
+
+// open closes the current content block and starts another
+func (s *messagesStream) open(block map[string]interface{}) {
+	s.close()
+	s.index++
+	s.block, _ = block["type"].(string)
+	s.event("content_block_start", map[string]interface{}{"index": s.index, "content_block": block})
+}
+
+// close ends the current content block
+func (s *messagesStream) close() {
+	if s.block != "" {
+		s.event("content_block_stop", map[string]interface{}{"index": s.index})
+		s.block = ""
+	}
+}
+
+// event writes an event of the given type
+func (s *messagesStream) event(name string, fields map[string]interface{}) {
+	fields["type"] = name
+	data, _ := json.Marshal(fields)
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+// finish ends the stream, translating an error or whole answer that was held
+func (s *messagesStream) finish() {
+	switch {
+	case s.status >= 400 && s.started:
+		s.event("error", messagesError(s.status, errorMessage(s.held.Bytes())))
+		return
+	case s.status >= 400 || s.status == 0:
+		if s.status == 0 {
+			s.status = http.StatusBadGateway
+		}
+		writeMessagesError(s.w, s.status, errorMessage(s.held.Bytes()))
+		return
+	case s.held.Len() > 0:
+		message, err := chatToMessage(s.held.Bytes(), s.model, s.id)
+		if err != nil {
+			writeMessagesError(s.w, http.StatusBadGateway, err.Error())
+			return
+		}
+		s.replay(message)
+	}
+	s.start()
+	s.close()
+	if s.stopReason == "" {
+		s.stopReason = "end_turn"
+	}
+	s.event("message_delta", map[string]interface{}{
+		"delta": map[string]interface{}{"stop_reason": s.stopReason, "stop_sequence": nil},
+		"usage": map[string]int{"input_tokens": s.usage.PromptTokens, "output_tokens": s.usage.CompletionTokens},
+	})
+	s.event("message_stop", map[string]interface{}{})
+	http.NewResponseController(s.w).Flush()
+}
+
+// replay sends a whole message as the events that would have streamed it
+func (s *messagesStream) replay(message map[string]interface{}) {
+	s.start()
+	for _, block := range message["content"].([]interface{}) {
+		block := block.(map[string]interface{})
+		switch block["type"] {
+		case "text":
+			s.open(map[string]interface{}{"type": "text", "text": ""})
+			s.event("content_block_delta", map[string]interface{}{"index": s.index, "delta": map[string]interface{}{"type": "text_delta", "text": block["text"]}})
+		case "tool_use":
+			s.open(map[string]interface{}{"type": "tool_use", "id": block["id"], "name": block["name"], "input": map[string]interface{}{}})
+			s.event("content_block_delta", map[string]interface{}{"index": s.index, "delta": map[string]interface{}{"type": "input_json_delta", "partial_json": string(block["input"].(json.RawMessage))}})
+		}
+	}
+	s.stopReason, _ = message["stop_reason"].(string)
+	if usage, ok := message["usage"].(map[string]int); ok {
+		s.usage = chatUsage{PromptTokens: usage["input_tokens"], CompletionTokens: usage["output_tokens"]}
+	}
+}
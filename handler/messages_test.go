@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func sendMessages(cfg *model.Config, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+	req.Header.Set("X-Api-Key", "router-key")
+	req.Header.Set("Anthropic-Version", "2023-06-01")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	return rec
+}
+
+func TestMessagesTranslatesRequestAndAnswer(t *testing.T) {
+	var got map[string]interface{}
+	var headers http.Header
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"Checking.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":12,"completion_tokens":5}}`)
+	})
+
+	rec := sendMessages(cfg, `{
+		"model": "up/llama3", "max_tokens": 100, "system": [{"type": "text", "text": "Be brief."}],
+		"tools": [{"name": "weather", "input_schema": {"type": "object"}}], "tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "Paris"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "toolu_1", "content": "Sunny"}, {"type": "text", "text": "And tomorrow?"}]}
+		]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if headers.Get("X-Api-Key") != "" || headers.Get("Anthropic-Version") != "" {
+		t.Errorf("Anthropic headers reached the backend: %v", headers)
+	}
+
+	messages, _ := got["messages"].([]interface{})
+	roles := []string{}
+	for _, m := range messages {
+		roles = append(roles, m.(map[string]interface{})["role"].(string))
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,tool,user" || got["tool_choice"] != "required" || got["max_tokens"] != float64(100) {
+		t.Errorf("Unexpected chat request: %v", got)
+	}
+
+	var message struct {
+		Type       string `json:"type"`
+		Model      string `json:"model"`
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &message); err != nil {
+		t.Fatalf("Invalid message: %s", err)
+	}
+	if message.Type != "message" || message.Model != "up/llama3" || message.StopReason != "tool_use" || message.Usage.InputTokens != 12 {
+		t.Errorf("Unexpected message: %s", rec.Body.String())
+	}
+	if len(message.Content) != 2 || message.Content[0].Text != "Checking." || message.Content[1].Name != "weather" || string(message.Content[1].Input) != `{"city":"Paris"}` {
+		t.Errorf("Unexpected content: %s", rec.Body.String())
+	}
+}
+
+func TestMessagesStream(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2}}`,
+		} {
+			io.WriteString(w, "data: "+chunk+"\n\n")
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	})
+
+	rec := sendMessages(cfg, `{"model": "up/llama3", "max_tokens": 10, "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`)
+	var names []string
+	var text strings.Builder
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var event struct {
+				Delta struct {
+					Text       string `json:"text"`
+					StopReason string `json:"stop_reason"`
+				} `json:"delta"`
+			}
+			json.Unmarshal([]byte(data), &event)
+			text.WriteString(event.Delta.Text)
+		}
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(names, ",") != want || text.String() != "Hello" {
+		t.Errorf("Unexpected events %v with text %q:\n%s", names, text.String(), rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"stop_reason":"end_turn"`) || !strings.Contains(rec.Body.String(), `"output_tokens":2`) {
+		t.Errorf("Expected the stop reason and usage: %s", rec.Body.String())
+	}
+}
+
+func TestMessagesErrors(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"message":"slow down"}}`)
+	})
+
+	for _, stream := range []string{"false", "true"} {
+		rec := sendMessages(cfg, `{"model": "up/llama3", "stream": `+stream+`, "messages": [{"role": "user", "content": "Hi"}]}`)
+		if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), `{"message":"slow down","type":"rate_limit_error"}`) {
+			t.Errorf("stream %s: expected an Anthropic rate limit error, got %d: %s", stream, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{}`))
+	req.Header.Set("X-Api-Key", "wrong")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong key to be refused, got %d", rec.Code)
+	}
+}
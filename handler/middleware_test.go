@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestMiddlewaresRunAfterAuthentication(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key"}
+	var order []string
+	record := func(name string) extension.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if extension.FromRequest(r).ID == "" {
+					t.Errorf("Expected %s to see the request context", name)
+				}
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "route")
+	}), authenticate(cfg, cfg.Auth), attachRequestContext(cfg, cfg.Auth), record("first"), record("second"))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+	if rec.Code != http.StatusUnauthorized || len(order) != 0 {
+		t.Errorf("Expected unauthenticated request to stop at authentication, got %d %v", rec.Code, order)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "route" {
+		t.Errorf("Unexpected middleware order %v", order)
+	}
+}
+
+func TestAuthModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   model.AuthConfig
+		method string
+		path   string
+		want   int
+	}{
+		{"strict preflight", model.AuthConfig{}, "OPTIONS", "/v1/chat/completions", http.StatusUnauthorized},
+		{"strict healthz", model.AuthConfig{}, "GET", "/healthz", http.StatusUnauthorized},
+		{"strict info", model.AuthConfig{}, "GET", "/router/info", http.StatusUnauthorized},
+		{"exempt preflight", model.AuthConfig{ExemptOptions: true}, "OPTIONS", "/v1/chat/completions", http.StatusNoContent},
+		{"public healthz", model.AuthConfig{PublicHealth: true}, "GET", "/healthz", http.StatusOK},
+		{"public info", model.AuthConfig{PublicInfo: true}, "GET", "/router/info", http.StatusOK},
+		{"public info keeps others private", model.AuthConfig{PublicInfo: true, PublicHealth: true}, "GET", "/router/errors", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Auth: tt.auth}
+		rec := httptest.NewRecorder()
+		NewHandler(cfg).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestAuthHint(t *testing.T) {
+	for _, hint := range []bool{false, true} {
+		cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Auth: model.AuthConfig{Hint: hint}}
+		rec := httptest.NewRecorder()
+		NewHandler(cfg).ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+		if got := strings.Contains(rec.Body.String(), setupDocsURL); got != hint || !strings.Contains(rec.Body.String(), "invalid_api_key") {
+			t.Errorf("hint=%v: unexpected body %s", hint, rec.Body.String())
+		}
+	}
+}
+
+func TestListenerGroups(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key"}
+	public := NewListenerHandler(cfg, model.ListenerConfig{Address: ":11411", Serve: []string{model.ServeAPI}})
+	admin := NewListenerHandler(cfg, model.ListenerConfig{
+		Address: "127.0.0.1:11412",
+		Serve:   []string{model.ServeAdmin, model.ServeMetrics, model.ServeHealth},
+		Auth:    &model.AuthConfig{Disabled: true},
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		key     bool
+		path    string
+		want    int
+	}{
+		{"public info", public, true, "/router/info", http.StatusOK},
+		{"public hides errors", public, true, "/router/errors", http.StatusNotFound},
+		{"public hides usage", public, true, "/router/usage", http.StatusNotFound},
+		{"public hides history", public, true, "/router/history/export", http.StatusNotFound},
+		{"public hides healthz", public, true, "/healthz", http.StatusNotFound},
+		{"public requires key", public, false, "/router/info", http.StatusUnauthorized},
+		{"admin errors without key", admin, false, "/router/errors", http.StatusOK},
+		{"admin healthz without key", admin, false, "/healthz", http.StatusOK},
+		{"admin hides api", admin, false, "/v1/models", http.StatusNotFound},
+		{"admin hides info", admin, false, "/router/info", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.key {
+			req.Header.Set("Authorization", "Bearer router-key")
+		}
+		rec := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+}
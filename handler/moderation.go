@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// moderate checks the prompt of a request with the moderation model. A prompt
+// flagged in a blocked category is refused with a content policy error; one
+// flagged in a flagged category is logged and marked with a header. If the
+// moderation model cannot be reached the request is refused, unless the
+// moderation fails open.
+func moderate(w http.ResponseWriter, r *http.Request, cfg *model.Config, chatReq map[string]interface{}, modelName string, logger *zap.Logger) error {
+	settings := cfg.Moderation
+	if settings.Model == "" || (len(settings.Models) > 0 && !matchesAny(settings.Models, modelName)) {
+		return nil
+	}
+	text := moderatedText(chatReq)
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	rc := extension.FromRequest(r)
+	categories, err := moderationCategories(r, cfg, settings.Model, text, logger)
+	if err != nil {
+		logger.Warn("Moderation failed", zap.String("requestID", rc.ID), zap.String("moderationModel", settings.Model),
+			zap.Bool("failOpen", settings.FailOpen), zap.Error(err))
+		if settings.FailOpen {
+			return nil
+		}
+		return utils.NewError(utils.ErrHookFailed, "The request could not be checked by the moderation model")
+	}
+
+	var blocked, flagged []string
+	for _, category := range categories {
+		switch {
+		case matchesAny(settings.Block, category):
+			blocked = append(blocked, category)
+		case matchesAny(settings.Flag, category):
+			flagged = append(flagged, category)
+		}
+	}
+	if len(blocked) == 0 && len(flagged) == 0 {
+		return nil
+	}
+
+	fields := append(rc.LogFields(), zap.String("event", "moderation.flagged"), zap.Strings("blocked", blocked), zap.Strings("flagged", flagged))
+	events.Publish("moderation.flagged", map[string]interface{}{
+		"request_id": rc.ID,
+		"key_id":     rc.KeyID,
+		"model":      modelName,
+		"blocked":    blocked,
+		"flagged":    flagged,
+	})
+	if len(blocked) > 0 {
+		logger.Warn("Request blocked by moderation", fields...)
+		return utils.NewError(utils.ErrContentPolicy,
+			"Your request was rejected as a result of the content policy. It was flagged for: %s", strings.Join(blocked, ", "))
+	}
+	logger.Warn("Request flagged by moderation", fields...)
+	w.Header().Set("X-Router-Moderation", strings.Join(flagged, ","))
+	return nil
+}
+
+// moderatedText returns the text a client controls on each turn: the system
+// and developer messages and the latest user message
+func moderatedText(chatReq map[string]interface{}) string {
+	messages := utils.Messages(chatReq)
+	var parts []string
+	for _, m := range messages {
+		if role := messageRole(m); role == "system" || role == "developer" {
+			parts = append(parts, utils.MessageText(m))
+		}
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if role := messageRole(messages[i]); role == "user" || role == "" {
+			parts = append(parts, utils.MessageText(messages[i]))
+			break
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// moderationCategories returns the categories the moderation model flags text in
+func moderationCategories(r *http.Request, cfg *model.Config, moderationModel, text string, logger *zap.Logger) ([]string, error) {
+	response, err := callModel(r, cfg, moderationModel, "/v1/moderations", func(backendModel string) map[string]interface{} {
+		return map[string]interface{}{"model": backendModel, "input": text}
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	var moderation struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(response.body.Bytes(), &moderation); err != nil {
+		return nil, err
+	}
+	if len(moderation.Results) == 0 {
+		return nil, fmt.Errorf("%s returned no results", moderationModel)
+	}
+
+	var categories []string
+	for _, result := range moderation.Results {
+		for category, flagged := range result.Categories {
+			if flagged && !slices.Contains(categories, category) {
+				categories = append(categories, category)
+			}
+		}
+		// Classifiers without categories only say whether the text is flagged
+		if result.Flagged && len(result.Categories) == 0 && !slices.Contains(categories, "flagged") {
+			categories = append(categories, "flagged")
+		}
+	}
+	slices.Sort(categories)
+	return categories, nil
+}
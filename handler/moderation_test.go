@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestModerationBlocksAndFlagsPrompts(t *testing.T) {
+	var moderated []string
+	completions := 0
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/v1/moderations" {
+			input, _ := body["input"].(string)
+			moderated = append(moderated, input)
+			switch {
+			case strings.Contains(input, "outage"):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case strings.Contains(input, "fight"):
+				io.WriteString(w, `{"results":[{"flagged":true,"categories":{"violence":true,"hate":false}}]}`)
+			case strings.Contains(input, "insult"):
+				io.WriteString(w, `{"results":[{"flagged":true,"categories":{"harassment":true}}]}`)
+			default:
+				io.WriteString(w, `{"results":[{"flagged":false,"categories":{"violence":false}}]}`)
+			}
+			return
+		}
+		completions++
+		io.WriteString(w, `{"choices":[]}`)
+	})
+	cfg.Moderation = model.ModerationConfig{Model: "up/omni-moderation-latest", Block: []string{"violence*"}, Flag: []string{"harassment*"}}
+
+	ask := func(prompt string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(
+			`{"model":"up/llama3","messages":[{"role":"system","content":"Be kind"},{"role":"user","content":"earlier"},{"role":"assistant","content":"ok"},{"role":"user","content":"`+prompt+`"}]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	rec := ask("Describe a fight")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "content_policy_violation") || !strings.Contains(rec.Body.String(), "violence") {
+		t.Errorf("Expected a content policy error, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := ask("Write an insult"); rec.Code != http.StatusOK || rec.Header().Get("X-Router-Moderation") != "harassment" {
+		t.Errorf("Expected a flagged request to pass with a header, got %d %q", rec.Code, rec.Header().Get("X-Router-Moderation"))
+	}
+	if rec := ask("Say hello"); rec.Code != http.StatusOK || rec.Header().Get("X-Router-Moderation") != "" {
+		t.Errorf("Expected a clean request to pass unmarked, got %d", rec.Code)
+	}
+	if rec := ask("Cause an outage"); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected a failed moderation to refuse the request, got %d", rec.Code)
+	}
+	cfg.Moderation.FailOpen = true
+	if rec := ask("Cause an outage"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a failed moderation to pass when failing open, got %d", rec.Code)
+	}
+
+	if completions != 3 {
+		t.Errorf("Expected 3 completions to reach the backend, got %d", completions)
+	}
+	if !strings.Contains(moderated[0], "Be kind") || strings.Contains(moderated[0], "earlier") {
+		t.Errorf("Expected the system message and latest user message to be moderated, got %q", moderated[0])
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/clientip"
+	"github.com/kcolemangt/llm-router/lockout"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestNetworkFilterUsesRealClientAddress(t *testing.T) {
+	policy, err := clientip.New([]string{"127.0.0.1"}, []string{"198.51.100.0/24"}, []string{"198.51.100.66"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", ClientIPs: policy}
+
+	tests := []struct {
+		remote, forwarded string
+		status            int
+	}{
+		{"127.0.0.1:5000", "198.51.100.7", http.StatusOK},
+		{"127.0.0.1:5000", "198.51.100.66", http.StatusForbidden},
+		{"127.0.0.1:5000", "203.0.113.7", http.StatusForbidden},
+		{"203.0.113.7:5000", "198.51.100.7", http.StatusForbidden},
+		{"198.51.100.7:5000", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/router/info", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s for %q: expected %d, got %d %s", tt.remote, tt.forwarded, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestLockoutAfterFailedAttempts(t *testing.T) {
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		Lockout:      model.LockoutConfig{Threshold: 3},
+		Lockouts:     lockout.New(3, time.Minute, time.Minute),
+	}
+	get := func(remote, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/router/info", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := get("203.0.113.7:5000", "guess"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+	rec := get("203.0.113.7:5000", "router-key")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the locked out client to be refused with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("198.51.100.1:5000", "router-key"); rec.Code != http.StatusOK {
+		t.Errorf("Expected other clients to be served, got %d", rec.Code)
+	}
+	if rec := get("203.0.113.7:5000", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the ban to hold for later attempts, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,395 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// ollamaRequest is the part of an Ollama /api/chat or /api/generate request
+// the router translates
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Prompt   string                 `json:"prompt"`
+	System   string                 `json:"system"`
+	Images   []string               `json:"images"`
+	Tools    json.RawMessage        `json:"tools"`
+	Format   json.RawMessage        `json:"format"`
+	Options  map[string]interface{} `json:"options"`
+	Stream   *bool                  `json:"stream"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaOptions are the Ollama options with a chat completions equivalent
+var ollamaOptions = map[string]string{
+	"temperature":       "temperature",
+	"top_p":             "top_p",
+	"seed":              "seed",
+	"stop":              "stop",
+	"num_predict":       "max_tokens",
+	"frequency_penalty": "frequency_penalty",
+	"presence_penalty":  "presence_penalty",
+}
+
+// isOllamaRequest reports whether r is for one of the Ollama endpoints the router translates
+func isOllamaRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/chat", "/api/generate":
+		return r.Method == "POST"
+	case "/api/tags":
+		return r.Method == "GET"
+	}
+	return false
+}
+
+// handleOllama serves Ollama's native API for apps that only speak it: chat
+// and generate requests are translated to chat completions and routed like
+// any other, and the tags list every backend's models
+func handleOllama(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	if r.URL.Path == "/api/tags" {
+		handleOllamaTags(w, cfg)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeOllamaError(w, http.StatusInternalServerError, "Error reading request body")
+		return
+	}
+	var req ollamaRequest
+	if err := utils.UnmarshalJSON(body, &req); err != nil {
+		writeOllamaError(w, http.StatusBadRequest, "Error unmarshalling request body")
+		return
+	}
+	generate := r.URL.Path == "/api/generate"
+	stream := &ollamaStream{model: req.Model, generate: generate, stream: req.Stream == nil || *req.Stream, start: time.Now()}
+	stream.chunkWriter = chunkWriter{w: w, onChunk: stream.chunk}
+
+	// Ollama loads a model when asked for nothing, which backends do on demand
+	if generate && req.Prompt == "" || !generate && len(req.Messages) == 0 {
+		stream.done("load")
+		return
+	}
+	chatReq, err := ollamaToChat(req, generate)
+	if err != nil {
+		writeOllamaError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body, err = json.Marshal(chatReq); err != nil {
+		writeOllamaError(w, http.StatusInternalServerError, "Error encoding request")
+		return
+	}
+	asChatCompletions(r, body)
+	recordExchange(stream, r, cfg, handleModelRequest)
+	stream.finish()
+}
+
+// ollamaToChat translates an Ollama chat or generate request to chat completions
+func ollamaToChat(req ollamaRequest, generate bool) (map[string]interface{}, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	messages := req.Messages
+	if generate {
+		messages = []ollamaMessage{{Role: "user", Content: req.Prompt, Images: req.Images}}
+		if req.System != "" {
+			messages = append([]ollamaMessage{{Role: "system", Content: req.System}}, messages...)
+		}
+	}
+
+	// Ollama answers tool calls in order without IDs, so they are numbered
+	var translated, pendingCalls []interface{}
+	calls := 0
+	for _, m := range messages {
+		message := map[string]interface{}{"role": m.Role, "content": m.Content}
+		if len(m.Images) > 0 {
+			parts := []interface{}{map[string]interface{}{"type": "text", "text": m.Content}}
+			for _, image := range m.Images {
+				parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]string{"url": imageURL(image)}})
+			}
+			message["content"] = parts
+		}
+		if len(m.ToolCalls) > 0 {
+			var toolCalls []interface{}
+			pendingCalls = nil
+			for _, call := range m.ToolCalls {
+				calls++
+				id := fmt.Sprintf("call_%d", calls)
+				arguments := "{}"
+				var compact bytes.Buffer
+				if json.Compact(&compact, call.Function.Arguments) == nil && compact.String() != "null" {
+					arguments = compact.String()
+				}
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id": id, "type": "function", "function": map[string]string{"name": call.Function.Name, "arguments": arguments},
+				})
+				pendingCalls = append(pendingCalls, id)
+			}
+			message["tool_calls"] = toolCalls
+		}
+		if m.Role == "tool" && len(pendingCalls) > 0 {
+			message["tool_call_id"], pendingCalls = pendingCalls[0], pendingCalls[1:]
+		}
+		translated = append(translated, message)
+	}
+
+	chatReq := map[string]interface{}{"model": req.Model, "messages": translated}
+	for option, param := range ollamaOptions {
+		if value, ok := req.Options[option]; ok {
+			chatReq[param] = value
+		}
+	}
+	if n, ok := chatReq["max_tokens"].(float64); ok && n <= 0 {
+		// Ollama takes -1 and -2 for no limit and filling the context
+		delete(chatReq, "max_tokens")
+	}
+	if len(req.Tools) > 0 && string(req.Tools) != "null" {
+		chatReq["tools"] = req.Tools
+	}
+	var format string
+	switch {
+	case json.Unmarshal(req.Format, &format) == nil && format == "json":
+		chatReq["response_format"] = map[string]string{"type": "json_object"}
+	case len(req.Format) > 0 && req.Format[0] == '{':
+		chatReq["response_format"] = map[string]interface{}{
+			"type": "json_schema", "json_schema": map[string]interface{}{"name": "response", "schema": req.Format},
+		}
+	}
+	if req.Stream == nil || *req.Stream {
+		chatReq["stream"] = true
+		chatReq["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	return chatReq, nil
+}
+
+// imageURL returns a data URL for an Ollama image, which is bare base64
+func imageURL(image string) string {
+	if strings.HasPrefix(image, "data:") {
+		return image
+	}
+	head, _ := base64.StdEncoding.DecodeString(image[:min(len(image), 44)])
+	return "data:" + http.DetectContentType(head) + ";base64," + image
+}
+
+// ollamaStream translates a chat completions answer, streamed or whole,
+// into Ollama's chat or generate answer, as JSON Lines when streaming
+type ollamaStream struct {
+	chunkWriter
+	model    string
+	generate bool
+	stream   bool
+	start    time.Time
+
+	started    bool
+	calls      []*toolCall
+	doneReason string
+	usage      chatUsage
+}
+
+// chunk translates one chat completions stream chunk
+func (s *ollamaStream) chunk(data string) {
+	var chunk streamChunk
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return
+	}
+	if chunk.Usage != nil {
+		s.usage = *chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+	if choice.Delta.Content != "" {
+		s.line(s.answer(choice.Delta.Content, nil))
+	}
+	// Ollama sends each tool call whole, so their arguments are gathered first
+	for _, call := range choice.Delta.ToolCalls {
+		for len(s.calls) <= call.Index {
+			s.calls = append(s.calls, &toolCall{})
+		}
+		gathered := s.calls[call.Index]
+		gathered.Function.Name += call.Function.Name
+		gathered.Function.Arguments += call.Function.Arguments
+	}
+	if choice.FinishReason != "" {
+		s.doneReason = ollamaDoneReason(choice.FinishReason)
+	}
+}
+
+// finish ends the answer, translating an error or whole answer that was held
+func (s *ollamaStream) finish() {
+	switch {
+	case s.status >= 400 && s.started:
+		s.line(map[string]interface{}{"error": errorMessage(s.held.Bytes())})
+		return
+	case s.status >= 400 || s.status == 0:
+		if s.status == 0 {
+			s.status = http.StatusBadGateway
+		}
+		writeOllamaError(s.w, s.status, errorMessage(s.held.Bytes()))
+		return
+	case s.held.Len() > 0:
+		var completion chatCompletion
+		if err := json.Unmarshal(s.held.Bytes(), &completion); err != nil || len(completion.Choices) == 0 {
+			writeOllamaError(s.w, http.StatusBadGateway, "The backend's answer could not be translated")
+			return
+		}
+		choice := completion.Choices[0]
+		s.doneReason = ollamaDoneReason(choice.FinishReason)
+		if completion.Usage != nil {
+			s.usage = *completion.Usage
+		}
+		var gathered []*toolCall
+		for i := range choice.Message.ToolCalls {
+			gathered = append(gathered, &choice.Message.ToolCalls[i])
+		}
+		calls := ollamaToolCalls(gathered)
+		if !s.stream {
+			s.done(s.doneReason, s.answer(choice.Message.Content, calls))
+			return
+		}
+		if choice.Message.Content != "" || len(calls) > 0 {
+			s.line(s.answer(choice.Message.Content, calls))
+		}
+	case len(s.calls) > 0:
+		s.line(s.answer("", ollamaToolCalls(s.calls)))
+	}
+	if s.doneReason == "" {
+		s.doneReason = "stop"
+	}
+	s.done(s.doneReason)
+}
+
+// done sends the last line of an answer, with its statistics
+func (s *ollamaStream) done(reason string, answer ...map[string]interface{}) {
+	fields := s.answer("", nil)
+	if len(answer) > 0 {
+		fields = answer[0]
+	}
+	fields["done"] = true
+	fields["done_reason"] = reason
+	fields["total_duration"] = time.Since(s.start).Nanoseconds()
+	fields["prompt_eval_count"] = s.usage.PromptTokens
+	fields["eval_count"] = s.usage.CompletionTokens
+	s.line(fields)
+}
+
+// answer returns the fields of a line carrying text and tool calls
+func (s *ollamaStream) answer(text string, calls []ollamaToolCall) map[string]interface{} {
+	if s.generate {
+		return map[string]interface{}{"response": text, "done": false}
+	}
+	return map[string]interface{}{"message": ollamaMessage{Role: "assistant", Content: text, ToolCalls: calls}, "done": false}
+}
+
+// line writes one line of the answer
+func (s *ollamaStream) line(fields map[string]interface{}) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Del("Content-Length")
+		s.w.Header().Set("Content-Type", "application/json")
+		if s.stream {
+			s.w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		s.w.WriteHeader(http.StatusOK)
+	}
+	fields["model"] = s.model
+	fields["created_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, _ := json.Marshal(fields)
+	s.w.Write(append(data, '\n'))
+	http.NewResponseController(s.w).Flush()
+}
+
+// ollamaToolCalls translates chat completions tool calls, whose arguments are
+// a JSON string, to Ollama's, whose arguments are an object
+func ollamaToolCalls(calls []*toolCall) []ollamaToolCall {
+	var translated []ollamaToolCall
+	for _, call := range calls {
+		var c ollamaToolCall
+		c.Function.Name = call.Function.Name
+		c.Function.Arguments = toolInput(call.Function.Arguments)
+		translated = append(translated, c)
+	}
+	return translated
+}
+
+// ollamaDoneReason translates a chat completions finish reason
+func ollamaDoneReason(finish string) string {
+	if finish == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// writeOllamaError writes an error as Ollama clients expect it
+func writeOllamaError(w http.ResponseWriter, status int, message string) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// handleOllamaTags lists every backend's models, under their prefixes, and
+// the aliases and bare names of discovered models, as Ollama lists its
+// installed models
+func handleOllamaTags(w http.ResponseWriter, cfg *model.Config) {
+	var names []string
+	if router, ok := cfg.Router.(*proxy.Router); ok {
+		for _, backend := range cfg.Backends {
+			models, err := router.BackendModels(backend)
+			if err != nil {
+				cfg.Logger.Warn("Failed to list backend models", zap.String("backend", backend.Name), zap.Error(err))
+				continue
+			}
+			for _, name := range models {
+				names = append(names, backend.Prefix+name)
+			}
+		}
+	}
+	for alias := range cfg.Aliases {
+		names = append(names, alias)
+	}
+	if router, ok := cfg.Router.(*proxy.Router); ok {
+		names = append(names, router.BareNames()...)
+	}
+	slices.Sort(names)
+
+	modified := time.Now().UTC().Format(time.RFC3339)
+	models := []interface{}{}
+	for _, name := range slices.Compact(names) {
+		models = append(models, map[string]interface{}{
+			"name":        name,
+			"model":       name,
+			"modified_at": modified,
+			"size":        0,
+			"digest":      "",
+			"details":     map[string]string{"format": "", "family": "", "parameter_size": "", "quantization_level": ""},
+		})
+	}
+	writeJSON(w, map[string]interface{}{"models": models})
+}
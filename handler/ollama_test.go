@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+)
+
+func sendOllama(cfg *model.Config, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	return rec
+}
+
+func TestOllamaChat(t *testing.T) {
+	var got map[string]interface{}
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"call_9","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":7,"completion_tokens":4}}`)
+	})
+
+	rec := sendOllama(cfg, "POST", "/api/chat", `{"model": "up/llama3", "stream": false, "options": {"temperature": 0.2, "num_predict": 50},
+		"messages": [
+			{"role": "user", "content": "Weather?"},
+			{"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "weather", "arguments": {"city": "Rome"}}}]},
+			{"role": "tool", "content": "Sunny"}
+		]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got["temperature"] != 0.2 || got["max_tokens"] != float64(50) || got["stream"] != nil {
+		t.Errorf("Unexpected chat request: %v", got)
+	}
+	messages := got["messages"].([]interface{})
+	call := messages[1].(map[string]interface{})["tool_calls"].([]interface{})[0].(map[string]interface{})
+	if call["id"] != messages[2].(map[string]interface{})["tool_call_id"] || call["function"].(map[string]interface{})["arguments"] != `{"city":"Rome"}` {
+		t.Errorf("Expected the tool result to answer the call: %v", messages)
+	}
+
+	var answer struct {
+		Model           string        `json:"model"`
+		Message         ollamaMessage `json:"message"`
+		Done            bool          `json:"done"`
+		DoneReason      string        `json:"done_reason"`
+		PromptEvalCount int           `json:"prompt_eval_count"`
+		EvalCount       int           `json:"eval_count"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("Invalid answer: %s", err)
+	}
+	if answer.Model != "up/llama3" || !answer.Done || answer.DoneReason != "stop" || answer.PromptEvalCount != 7 || answer.EvalCount != 4 {
+		t.Errorf("Unexpected answer: %s", rec.Body.String())
+	}
+	if len(answer.Message.ToolCalls) != 1 || string(answer.Message.ToolCalls[0].Function.Arguments) != `{"city":"Paris"}` {
+		t.Errorf("Unexpected tool calls: %s", rec.Body.String())
+	}
+}
+
+func TestOllamaGenerateStreams(t *testing.T) {
+	var got map[string]interface{}
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"length\"}]}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	})
+
+	rec := sendOllama(cfg, "POST", "/api/generate", `{"model": "up/llama3", "system": "Be brief.", "prompt": "Hi", "format": "json"}`)
+	if rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("Expected JSON Lines, got %q", rec.Header().Get("Content-Type"))
+	}
+	if len(got["messages"].([]interface{})) != 2 || got["response_format"] == nil || got["stream"] != true {
+		t.Errorf("Unexpected chat request: %v", got)
+	}
+
+	var text strings.Builder
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	for _, line := range lines {
+		var answer struct {
+			Response   string `json:"response"`
+			Done       bool   `json:"done"`
+			DoneReason string `json:"done_reason"`
+		}
+		if err := json.Unmarshal([]byte(line), &answer); err != nil {
+			t.Fatalf("Invalid line %q: %s", line, err)
+		}
+		text.WriteString(answer.Response)
+		if answer.Done && answer.DoneReason != "length" {
+			t.Errorf("Unexpected done reason: %s", line)
+		}
+	}
+	if len(lines) != 3 || text.String() != "Hello" {
+		t.Errorf("Unexpected answer: %s", rec.Body.String())
+	}
+}
+
+func TestOllamaTags(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":[{"id":"llama3"},{"id":"qwen2.5"}]}`)
+	}))
+	t.Cleanup(backend.Close)
+	cfg.Backends = []model.BackendConfig{{Name: "tags", BaseURL: backend.URL, Prefix: "local/"}}
+	cfg.Router = proxy.NewRouter(cfg)
+	cfg.Aliases = map[string]model.ModelAlias{"fast": {Models: []string{"local/llama3"}}}
+
+	rec := sendOllama(cfg, "GET", "/api/tags", "")
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &tags)
+	var names []string
+	for _, m := range tags.Models {
+		names = append(names, m.Name)
+	}
+	if strings.Join(names, ",") != "fast,local/llama3,local/qwen2.5" {
+		t.Errorf("Unexpected models: %s", rec.Body.String())
+	}
+}
+
+func TestOllamaErrors(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"error":{"message":"overloaded"}}`)
+	})
+	rec := sendOllama(cfg, "POST", "/api/chat", `{"model": "up/llama3", "messages": [{"role": "user", "content": "Hi"}]}`)
+	if rec.Code != http.StatusServiceUnavailable || strings.TrimSpace(rec.Body.String()) != `{"error":"overloaded"}` {
+		t.Errorf("Expected an Ollama error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
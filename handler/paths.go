@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiRoots are the OpenAI endpoints clients may send without the /v1 prefix,
+// e.g. when their base URL omits it
+var apiRoots = []string{
+	"chat/completions", "completions", "responses", "embeddings", "models", "moderations",
+	"audio", "images", "files", "uploads", "batches", "assistants", "threads", "vector_stores",
+	"fine_tuning", "realtime", "messages",
+}
+
+// canonicalPath returns the /v1 form of an API path, so /chat/completions and
+// /v1/chat/completions/ are routed like /v1/chat/completions. Other paths are
+// returned unchanged.
+func canonicalPath(path string) string {
+	trimmed := strings.TrimSuffix(path, "/")
+	rest, _ := strings.CutPrefix(trimmed, "/v1")
+	for _, root := range apiRoots {
+		if rest == "/"+root || strings.HasPrefix(rest, "/"+root+"/") {
+			return "/v1" + rest
+		}
+	}
+	return path
+}
+
+// canonicalizePath rewrites API paths to their canonical form before any other
+// stage sees them, so every routing feature applies whichever form clients use
+func canonicalizePath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := canonicalPath(r.URL.Path); path != r.URL.Path {
+			r.URL.Path, r.URL.RawPath = path, ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
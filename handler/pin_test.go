@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestBackendChosenByHeaderOrKey(t *testing.T) {
+	served := make(map[string]string)
+	newBackend := func(name string) model.BackendConfig {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			served[name], _ = body["model"].(string)
+			w.Write([]byte(`{"choices":[]}`))
+		}))
+		t.Cleanup(server.Close)
+		return model.BackendConfig{Name: name, BaseURL: server.URL, Prefix: name + "/"}
+	}
+	backends := []model.BackendConfig{newBackend("ollama"), newBackend("vllm")}
+	backends[0].Default = true
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		Backends:     backends,
+		APIKeys:      []model.APIKeyConfig{{Name: "bench", Key: "bench-key", Backend: "vllm"}},
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	tests := []struct {
+		key, header, model string
+		status             int
+		backend, sent      string
+	}{
+		{"router-key", "", "llama3", http.StatusOK, "ollama", "llama3"},
+		{"router-key", "vllm", "llama3", http.StatusOK, "vllm", "llama3"},
+		{"router-key", "vllm", "vllm/llama3", http.StatusOK, "vllm", "llama3"},
+		{"router-key", "vllm", "ollama/llama3", http.StatusOK, "vllm", "ollama/llama3"},
+		{"router-key", "nope", "llama3", http.StatusBadRequest, "", ""},
+		{"bench-key", "", "ollama/llama3", http.StatusOK, "vllm", "ollama/llama3"},
+		{"bench-key", "vllm", "llama3", http.StatusOK, "vllm", "llama3"},
+		{"bench-key", "ollama", "llama3", http.StatusForbidden, "", ""},
+	}
+	for _, tt := range tests {
+		clear(served)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`"}`))
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		if tt.header != "" {
+			req.Header.Set("X-Router-Backend", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %q %s: expected %d, got %d %s", tt.key, tt.header, tt.model, tt.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if tt.backend == "" {
+			if len(served) != 0 {
+				t.Errorf("%s %q %s: expected no backend to be used, got %v", tt.key, tt.header, tt.model, served)
+			}
+		} else if got, ok := served[tt.backend]; !ok || len(served) != 1 || got != tt.sent {
+			t.Errorf("%s %q %s: expected %s to receive %s, got %v", tt.key, tt.header, tt.model, tt.backend, tt.sent, served)
+		}
+	}
+}
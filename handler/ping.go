@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// pingResponse describes a request as the router received it, for users to
+// paste into issues when a client cannot connect. Credentials are redacted.
+type pingResponse struct {
+	Status         string              `json:"status"`
+	Version        string              `json:"version,omitempty"`
+	Time           time.Time           `json:"time"`
+	Method         string              `json:"method"`
+	Path           string              `json:"path"`
+	Protocol       string              `json:"protocol"`
+	Host           string              `json:"host"`
+	TLS            bool                `json:"tls"`
+	ClientCert     []string            `json:"client_cert,omitempty"`
+	RemoteAddr     string              `json:"remote_addr"`
+	ClientIP       string              `json:"client_ip"`
+	Headers        map[string][]string `json:"headers"`
+	Auth           pingAuth            `json:"auth"`
+	BackendLatency map[string]int64    `json:"backend_latency_ms,omitempty"`
+}
+
+// pingAuth is what authentication would make of the request's key
+type pingAuth struct {
+	Result string `json:"result"`
+	Key    string `json:"key,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// Results of checking the key of a ping
+const (
+	authValid       = "valid"
+	authInvalid     = "invalid"
+	authMissing     = "missing"
+	authNotRequired = "not_required"
+)
+
+// redactedHeaders carry credentials and are never echoed
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Api-Key", "X-Api-Key"}
+
+// handlePing reports what the router sees of a request: its headers, the
+// client's address and whether its key would be accepted. It is always
+// public, so a wrong key counts as a failed attempt towards a lockout as it
+// would anywhere else, or ping would let anyone guess keys without limit.
+func handlePing(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	resp := pingResponse{
+		Status:     "ok",
+		Time:       time.Now().UTC(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Protocol:   r.Proto,
+		Host:       r.Host,
+		TLS:        r.TLS != nil,
+		ClientCert: clientCertIdentities(r),
+		RemoteAddr: r.RemoteAddr,
+		ClientIP:   cfg.ClientIPs.ClientIP(r),
+		Headers:    make(map[string][]string, len(r.Header)),
+		Auth:       checkPingAuth(cfg, r),
+	}
+	if resp.Auth.Result == authInvalid {
+		recordAuthFailure(cfg, r)
+	}
+	for name, values := range r.Header {
+		resp.Headers[name] = values
+	}
+	for _, name := range redactedHeaders {
+		if values := r.Header.Values(name); len(values) > 0 {
+			redacted := make([]string, len(values))
+			for i, v := range values {
+				redacted[i] = utils.RedactAuthorization(v)
+			}
+			resp.Headers[http.CanonicalHeaderKey(name)] = redacted
+		}
+	}
+	// What the router runs and where it sends requests is for clients with a
+	// key, as on /router/info
+	if resp.Auth.Result == authValid || resp.Auth.Result == authNotRequired || cfg.Auth.PublicInfo {
+		resp.Version = cfg.Version
+		if resp.Version == "" {
+			resp.Version = "dev"
+		}
+		resp.BackendLatency = make(map[string]int64)
+		rt, _ := cfg.Router.(*proxy.Router)
+		for _, backend := range cfg.Backends {
+			if d, ok := rt.Latency(backend.Name); ok {
+				resp.BackendLatency[backend.Name] = d.Milliseconds()
+			}
+		}
+	}
+
+	// Browser-based clients must be able to read the answer to diagnose CORS
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkPingAuth tells whether the key of r would reach the API, with a hint
+// for the usual mistakes
+func checkPingAuth(cfg *model.Config, r *http.Request) pingAuth {
+	if cfg.Auth.Disabled {
+		return pingAuth{Result: authNotRequired}
+	}
+	authHeader := requestAuthorization(r)
+	if key := apiKeyFor(cfg, r); authHeader == "" && key != nil {
+		return pingAuth{Result: authValid, Key: key.Name, KeyID: utils.KeyID(key.ClientCert)}
+	}
+	if authHeader == "" {
+		hint := "Send the router key as \"Authorization: Bearer <key>\""
+		if r.Header.Get("Api-Key") != "" || r.Header.Get("X-Api-Key") != "" {
+			hint = "The key was sent in an api-key header; send it as \"Authorization: Bearer <key>\" instead"
+		}
+		return pingAuth{Result: authMissing, Hint: hint}
+	}
+
+	auth := pingAuth{Result: authInvalid, KeyID: utils.KeyID(authHeader)}
+	jwtErr := jwtError(cfg, r)
+	switch {
+	case isRouterKey(cfg, authHeader):
+		auth.Result, auth.Key = authValid, "router"
+	case apiKeyFor(cfg, r) != nil:
+		auth.Result, auth.Key = authValid, apiKeyFor(cfg, r).Name
+		if _, identity, _ := jwtKey(cfg, r); identity != "" {
+			auth.KeyID = utils.KeyID(identity)
+		}
+	case jwtErr != nil:
+		auth.Hint = "The token was rejected: " + jwtErr.Error()
+	case !strings.HasPrefix(authHeader, "Bearer "):
+		auth.Hint = "The Authorization header must start with \"Bearer \""
+	case strings.TrimSpace(authHeader) != authHeader || strings.Contains(authHeader, "Bearer  "):
+		auth.Hint = "The key has extra whitespace around it"
+	default:
+		auth.Hint = "The key is not the router key or a named key"
+	}
+	return auth
+}
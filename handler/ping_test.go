@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/clientip"
+	"github.com/kcolemangt/llm-router/lockout"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestPingReportsWithoutRequiringTheKey(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {})
+	cfg.APIKeys = []model.APIKeyConfig{{Name: "cursor", Key: "cursor-key"}}
+	cfg.ClientIPs, _ = clientip.New([]string{"10.0.0.0/8"}, nil, nil)
+
+	tests := []struct {
+		header, value string
+		result, key   string
+		hint          bool
+	}{
+		{"", "", authMissing, "", true},
+		{"Authorization", "Bearer router-key", authValid, "router", false},
+		{"Authorization", "Bearer cursor-key", authValid, "cursor", false},
+		{"Authorization", "router-key", authInvalid, "", true},
+		{"Authorization", "Bearer wrong", authInvalid, "", true},
+		{"X-Api-Key", "router-key", authMissing, "", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/router/ping", nil)
+		req.RemoteAddr = "10.0.0.5:51234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %q: expected 200, got %d", tt.header, tt.value, rec.Code)
+			continue
+		}
+		var resp pingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response: %s", err)
+		}
+		if resp.Auth.Result != tt.result || resp.Auth.Key != tt.key || (resp.Auth.Hint != "") != tt.hint {
+			t.Errorf("%s %q: unexpected auth %+v", tt.header, tt.value, resp.Auth)
+		}
+		if (resp.Version != "") != (tt.result == authValid) {
+			t.Errorf("%s %q: expected the version only for a valid key, got %q", tt.header, tt.value, resp.Version)
+		}
+		if resp.ClientIP != "203.0.113.7" || resp.RemoteAddr != "10.0.0.5:51234" {
+			t.Errorf("Unexpected client address %s from %s", resp.ClientIP, resp.RemoteAddr)
+		}
+		if tt.header != "" && resp.Headers[tt.header][0] == tt.value {
+			t.Errorf("Expected %s to be redacted", tt.header)
+		}
+	}
+}
+
+func TestPingCountsWrongKeysTowardsALockout(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {})
+	cfg.Lockout = model.LockoutConfig{Threshold: 3}
+	cfg.Lockouts = lockout.New(3, time.Minute, time.Minute)
+	ping := func(key string) int {
+		req := httptest.NewRequest("GET", "/router/ping", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if status := ping(""); status != http.StatusOK {
+			t.Fatalf("Expected pings without a key never to count, got %d", status)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		ping("guess")
+	}
+	if status := ping("router-key"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected a client guessing keys through ping to be locked out, got %d", status)
+	}
+}
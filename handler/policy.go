@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// expectedOutputTokens is the answer length assumed for pricing when the
+// request sets no limit
+const expectedOutputTokens = 256
+
+// chooseAliasModel picks the model of an alias the alias's route policy
+// prefers for this request, or the first one without a policy. It fails with
+// utils.ErrBackendUnhealthy if the backends of all the models are unhealthy.
+func chooseAliasModel(cfg *model.Config, alias model.ModelAlias, rc *extension.RequestContext, chatReq map[string]interface{}) (string, error) {
+	if alias.RoutePolicy == "" || len(alias.Models) == 1 {
+		return alias.Models[0], nil
+	}
+
+	output := expectedOutputTokens
+	if limit := utils.MaxOutputTokens(chatReq); limit > 0 {
+		output = limit
+	}
+	candidates := make([]proxy.Candidate, len(alias.Models))
+	for i, m := range alias.Models {
+		candidates[i] = proxy.Candidate{Model: m, Backend: backendName(cfg, m)}
+		if price, ok := cfg.ModelPrices[m]; ok {
+			candidates[i].Cost = price.Cost(rc.TokensEstimate, output)
+			candidates[i].Priced = true
+		}
+	}
+	rt, _ := cfg.Router.(*proxy.Router)
+	chosen, err := rt.Choose(alias.RoutePolicy, candidates)
+	if err != nil {
+		return "", err
+	}
+	return candidates[chosen].Model, nil
+}
+
+// priceFor returns the price of the first of names that model_prices lists
+func priceFor(cfg *model.Config, names ...string) *model.ModelPrice {
+	for _, name := range names {
+		if price, ok := cfg.ModelPrices[name]; ok {
+			return &price
+		}
+	}
+	return nil
+}
+
+// backendName returns the name of the backend a model is routed to by
+// prefix, the longest matching prefix winning, or the default backend's
+func backendName(cfg *model.Config, modelName string) string {
+	name, longest, fallback := "", -1, ""
+	for _, backend := range cfg.Backends {
+		if strings.HasPrefix(modelName, backend.Prefix) && len(backend.Prefix) > longest {
+			name, longest = backend.Name, len(backend.Prefix)
+		}
+		if backend.Default {
+			fallback = backend.Name
+		}
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
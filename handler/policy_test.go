@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestAliasRoutesToCheapestModel(t *testing.T) {
+	served := make(map[string]string)
+	newBackend := func(name string) model.BackendConfig {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			served[name] = string(body)
+			io.WriteString(w, `{"choices":[]}`)
+		}))
+		t.Cleanup(server.Close)
+		return model.BackendConfig{Name: name, BaseURL: server.URL, Prefix: name + "/"}
+	}
+	backends := []model.BackendConfig{newBackend("openai"), newBackend("groq")}
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		Backends:     backends,
+		Aliases: map[string]model.ModelAlias{
+			"gpt-class": {Models: []string{"openai/gpt-4o-mini", "groq/llama-3.3-70b"}, RoutePolicy: proxy.PolicyCheapest},
+		},
+		// groq is cheaper for long prompts, openai for long answers
+		ModelPrices: map[string]model.ModelPrice{
+			"openai/gpt-4o-mini": {Input: 0.15, Output: 0.6},
+			"groq/llama-3.3-70b": {Input: 0.05, Output: 0.8},
+		},
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	tests := []struct {
+		body, want string
+	}{
+		{`{"model":"gpt-class","messages":[{"role":"user","content":"` + strings.Repeat("long prompt ", 2000) + `"}]}`, "groq"},
+		{`{"model":"gpt-class","max_tokens":4000,"messages":[{"role":"user","content":"write a novel"}]}`, "openai"},
+	}
+	for _, tt := range tests {
+		clear(served)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if _, ok := served[tt.want]; !ok || len(served) != 1 {
+			t.Errorf("Expected only %s to be used, got %v", tt.want, served)
+		}
+		if got := rec.Header().Get("X-Router-Alias-Model"); !strings.HasPrefix(got, tt.want+"/") {
+			t.Errorf("Expected the alias model header to name %s, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestAliasRefusesWhenEveryBackendIsUnhealthy(t *testing.T) {
+	var backends []model.BackendConfig
+	for _, name := range []string{"openai", "groq"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"error":{"message":"overloaded"}}`)
+		}))
+		t.Cleanup(server.Close)
+		backends = append(backends, model.BackendConfig{Name: name, BaseURL: server.URL, Prefix: name + "/"})
+	}
+	cfg := &model.Config{
+		Logger:       zap.NewNop(),
+		GlobalAPIKey: "router-key",
+		Backends:     backends,
+		Aliases: map[string]model.ModelAlias{
+			"gpt-class": {Models: []string{"openai/gpt-4o-mini", "groq/llama-3.3-70b"}, RoutePolicy: proxy.PolicyFastest},
+		},
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+	send := func(modelName string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"`+modelName+`","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	send("openai/gpt-4o-mini")
+	if rec := send("gpt-class"); rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "backend_unhealthy") {
+		t.Fatalf("Expected the alias to use the backend still healthy, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := send("gpt-class")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"code":"backend_unhealthy"`) {
+		t.Errorf("Expected backend_unhealthy once every backend failed, got %d %s", rec.Code, rec.Body.String())
+	}
+}
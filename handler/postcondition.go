@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/postcondition"
+	"go.uber.org/zap"
+)
+
+// enforcePostConditions sends a non-streaming chat completion to target and
+// checks every choice against conditions. If any violates them, the request is
+// retried once with the answer and corrective instructions appended. The
+// outcome is reported in the X-Router-Postconditions header as passed, retried
+// or failed.
+func enforcePostConditions(w http.ResponseWriter, r *http.Request, target http.Handler, body []byte, conditions *postcondition.Conditions, logger *zap.Logger) {
+	retry := r.Clone(r.Context())
+
+	first := newBufferedResponse()
+	target.ServeHTTP(first, r)
+	answer, violations := checkChoices(first, conditions)
+	if len(violations) == 0 {
+		first.header.Set("X-Router-Postconditions", "passed")
+		first.writeTo(w)
+		return
+	}
+	logger.Warn("Answer violates post-conditions, retrying", zap.Strings("violations", violations))
+
+	var chatReq map[string]interface{}
+	json.Unmarshal(body, &chatReq)
+	messages, _ := chatReq["messages"].([]interface{})
+	chatReq["messages"] = append(messages,
+		map[string]interface{}{"role": "assistant", "content": answer},
+		map[string]interface{}{"role": "user", "content": postcondition.Correction(violations)})
+	retryBody, err := json.Marshal(chatReq)
+	if err != nil {
+		first.header.Set("X-Router-Postconditions", "failed")
+		first.writeTo(w)
+		return
+	}
+	setBody(retry, retryBody)
+
+	second := newBufferedResponse()
+	target.ServeHTTP(second, retry)
+	outcome := "retried"
+	if _, violations := checkChoices(second, conditions); len(violations) > 0 {
+		outcome = "failed"
+		logger.Warn("Retried answer still violates post-conditions", zap.Strings("violations", violations))
+	}
+	second.header.Set("X-Router-Postconditions", outcome)
+	second.writeTo(w)
+}
+
+// checkChoices returns the first violating answer of a successful completion
+// and its violations. Failed and unparsable responses are not checked.
+func checkChoices(response *bufferedResponse, conditions *postcondition.Conditions) (string, []string) {
+	if response.status >= 300 {
+		return "", nil
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content *string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(response.body.Bytes(), &completion) != nil {
+		return "", nil
+	}
+	for _, choice := range completion.Choices {
+		if choice.Message.Content == nil {
+			continue
+		}
+		if violations := conditions.Check(*choice.Message.Content); len(violations) > 0 {
+			return *choice.Message.Content, violations
+		}
+	}
+	return "", nil
+}
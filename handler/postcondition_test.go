@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/postcondition"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestPostConditionsRetryOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		want     string
+		attempts int
+	}{
+		{"passed", []string{`{"ok":true}`}, "passed", 1},
+		{"retried", []string{"Sure! ```{\"ok\":true}```", `{"ok":true}`}, "retried", 2},
+		{"failed", []string{"no", "still no"}, "failed", 2},
+	}
+	for _, tt := range tests {
+		var requests []map[string]interface{}
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var chatReq map[string]interface{}
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &chatReq)
+			requests = append(requests, chatReq)
+			answer, _ := json.Marshal(tt.answers[len(requests)-1])
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":`+string(answer)+`}}]}`)
+		}))
+
+		backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "ollama", BaseURL: backend.URL, Prefix: "ollama/"}}, Logger: zap.NewNop()})
+		conditions, err := postcondition.Compile([]string{"ollama/*"}, 0, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Requirements: &postcondition.Set{}}
+		cfg.Requirements.Add(conditions)
+		cfg.Router = backendRouter
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model":"ollama/llama3","messages":[{"role":"user","content":"give me json"}]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		backend.Close()
+
+		if got := rec.Header().Get("X-Router-Postconditions"); got != tt.want {
+			t.Errorf("%s: expected outcome %q, got %q", tt.name, tt.want, got)
+		}
+		if len(requests) != tt.attempts {
+			t.Fatalf("%s: expected %d attempts, got %d", tt.name, tt.attempts, len(requests))
+		}
+		if !strings.Contains(rec.Body.String(), strings.Trim(mustJSON(tt.answers[tt.attempts-1]), `"`)) {
+			t.Errorf("%s: expected the last answer, got %s", tt.name, rec.Body.String())
+		}
+		if tt.attempts == 2 {
+			messages, _ := requests[1]["messages"].([]interface{})
+			last, _ := messages[len(messages)-1].(map[string]interface{})
+			if len(messages) != 3 || !strings.Contains(last["content"].(string), "not valid JSON") {
+				t.Errorf("%s: expected the retry to carry the answer and a correction, got %v", tt.name, messages)
+			}
+		}
+	}
+}
+
+func mustJSON(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// raceResult is the buffered response of one racing model
+type raceResult struct {
+	model    string
+	backend  string
+	response *bufferedResponse
+}
+
+// serveAttempt sends one of several concurrent attempts at a request to
+// target. The attempt gets its own copy of the request context so proxies can
+// record its backend without racing the others.
+func serveAttempt(target http.Handler, attempt *http.Request, modelName string) raceResult {
+	rc := *extension.FromRequest(attempt)
+	response := newBufferedResponse()
+	target.ServeHTTP(response, extension.WithRequestContext(attempt, &rc))
+	return raceResult{model: modelName, backend: rc.Backend, response: response}
+}
+
+// errRaceDecided cancels the requests that lost a race
+var errRaceDecided = errors.New("race decided")
+
+// raceModels sends the request to every model at once and returns the first
+// successful response, canceling the others. If every model fails, the last
+// failure is returned.
+func raceModels(w http.ResponseWriter, r *http.Request, router model.Router, chatReq map[string]interface{}, models []string, logger *zap.Logger) {
+	original, err := json.Marshal(chatReq)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error re-marshalling request body"))
+		return
+	}
+
+	// Canceling on return stops the requests that lost the race, which the
+	// cause tells apart from requests the client cancelled
+	ctx, cancel := context.WithCancelCause(r.Context())
+	defer cancel(errRaceDecided)
+
+	results := make(chan raceResult, len(models))
+	started := 0
+	var lastErr error
+	for _, modelName := range models {
+		target, newModelName, err := resolveBackend(r, router, modelName, logger)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// Each attempt gets its own copy so transformers cannot interfere
+		var attemptReq map[string]interface{}
+		utils.UnmarshalJSON(original, &attemptReq)
+		attempt := r.Clone(ctx)
+		body, err := transformRequest(attempt, router.Extensions(), attemptReq, newModelName, logger)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		setBody(attempt, body)
+		rc := *extension.FromRequest(attempt)
+		rc.BackendModel = newModelName
+		attempt = extension.WithRequestContext(attempt, &rc)
+
+		started++
+		go func(modelName string) {
+			results <- serveAttempt(target, attempt, modelName)
+		}(modelName)
+	}
+	if started == 0 {
+		utils.WriteErr(w, lastErr)
+		return
+	}
+
+	var last raceResult
+	for i := 0; i < started; i++ {
+		last = <-results
+		if last.response.status < 300 {
+			logger.Info("Race won", zap.String("model", last.model), zap.Int("racers", started))
+			break
+		}
+		logger.Warn("Race entrant failed", zap.String("model", last.model), zap.Int("status", last.response.status))
+	}
+	extension.FromRequest(r).Backend = last.backend
+	w.Header().Set("X-Router-Race-Winner", last.model)
+	last.response.writeTo(w)
+}
+
+// bufferedResponse records a complete response so it can be discarded or
+// replayed to the client later
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// writeTo replays the response to w
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestRaceReturnsFirstSuccess(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	canceled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices a client hanging up once the body is consumed
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"model":"gpt-4o-mini"`) {
+			t.Errorf("Expected prefix to be stripped, got %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"fast"}}]}`)
+	}))
+	defer fast.Close()
+
+	backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{
+		{Name: "local", BaseURL: slow.URL, Prefix: "local/"},
+		{Name: "cloud", BaseURL: fast.URL, Prefix: "cloud/"},
+	}, Logger: logger})
+	cfg := &model.Config{Logger: logger, GlobalAPIKey: "router-key", Aliases: map[string]model.ModelAlias{
+		"coder": {Models: []string{"local/llama3", "cloud/gpt-4o-mini"}, Race: true},
+	}}
+	cfg.Router = backendRouter
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"coder","messages":[]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "fast") {
+		t.Fatalf("Expected the fast response, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if winner := rec.Header().Get("X-Router-Race-Winner"); winner != "cloud/gpt-4o-mini" {
+		t.Errorf("Expected cloud/gpt-4o-mini to win, got %q", winner)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the losing request to be canceled")
+	}
+}
+
+func TestRaceAllFail(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"down"}}`, http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{
+		{Name: "a", BaseURL: failing.URL, Prefix: "a/"},
+		{Name: "b", BaseURL: failing.URL, Prefix: "b/"},
+	}, Logger: logger})
+	cfg := &model.Config{Logger: logger, GlobalAPIKey: "router-key", Aliases: map[string]model.ModelAlias{
+		"coder": {Models: []string{"a/m", "b/m"}, Race: true},
+	}}
+	cfg.Router = backendRouter
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"coder"}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// insecureKeyProtocol is the WebSocket subprotocol prefix OpenAI clients use to
+// send an API key from environments that cannot set an Authorization header
+const insecureKeyProtocol = "openai-insecure-api-key."
+
+// isWebSocketUpgrade reports whether r asks to switch to the WebSocket protocol
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// webSocketKey returns the API key a WebSocket upgrade offers as a
+// subprotocol, if any
+func webSocketKey(r *http.Request) string {
+	if !isWebSocketUpgrade(r) {
+		return ""
+	}
+	for _, protocol := range webSocketProtocols(r) {
+		if key, ok := strings.CutPrefix(protocol, insecureKeyProtocol); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// webSocketProtocols returns the subprotocols offered in Sec-WebSocket-Protocol
+func webSocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
+}
+
+// handleRealtime proxies a Realtime API WebSocket session, routing on the model query parameter
+func handleRealtime(w http.ResponseWriter, r *http.Request, router model.Router, logger *zap.Logger) {
+	// Move a subprotocol key into the Authorization header so backends see it the
+	// same way as on HTTP requests, and it is never forwarded to the wrong backend
+	var protocols []string
+	for _, protocol := range webSocketProtocols(r) {
+		if strings.HasPrefix(protocol, insecureKeyProtocol) {
+			if r.Header.Get("Authorization") == "" {
+				r.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(protocol, insecureKeyProtocol))
+			}
+			continue
+		}
+		protocols = append(protocols, protocol)
+	}
+	r.Header.Del("Sec-WebSocket-Protocol")
+	if len(protocols) > 0 {
+		r.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+
+	modelName := r.URL.Query().Get("model")
+	extension.FromRequest(r).Model = modelName
+	logger.Info("Incoming realtime session", zap.String("model", modelName))
+
+	target, newModelName, err := resolveBackend(r, router, modelName, logger)
+	if err != nil {
+		logger.Warn("No suitable backend found", zap.String("model", modelName), zap.Error(err))
+		utils.WriteErr(w, err)
+		return
+	}
+
+	if newModelName != modelName {
+		query := r.URL.Query()
+		query.Set("model", newModelName)
+		r.URL.RawQuery = query.Encode()
+	}
+
+	target.ServeHTTP(w, r)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestRealtimeWebSocketPassthrough(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	// Upstream accepts the upgrade and echoes one line back
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("model") != "gpt-4o-realtime-preview" {
+			t.Errorf("Expected prefix to be stripped from model, got %q", r.URL.Query().Get("model"))
+		}
+		if r.Header.Get("Authorization") != "Bearer router-key" {
+			t.Errorf("Expected subprotocol key moved to Authorization, got %q", r.Header.Get("Authorization"))
+		}
+		if protocols := r.Header.Get("Sec-WebSocket-Protocol"); strings.Contains(protocols, insecureKeyProtocol) {
+			t.Errorf("Expected key subprotocol to be stripped, got %q", protocols)
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %s", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		line, _ := buf.ReadString('\n')
+		buf.WriteString("echo " + line)
+		buf.Flush()
+	}))
+	defer upstream.Close()
+
+	backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{
+		{Name: "openai", BaseURL: upstream.URL, Prefix: "openai/", Default: true, RequireAPIKey: true},
+	}, Logger: logger})
+	cfg := &model.Config{Logger: logger, GlobalAPIKey: "router-key"}
+	cfg.Router = backendRouter
+
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleRequest(cfg, w, r)
+	}))
+	defer router.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(router.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /v1/realtime?model=openai/gpt-4o-realtime-preview HTTP/1.1\r\n" +
+		"Host: router\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.router-key\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Reading upgrade response failed: %s", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+
+	conn.Write([]byte("ping\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "echo ping\n" {
+		t.Errorf("Expected echoed frame, got %q (%v)", line, err)
+	}
+}
+
+func TestRealtimeRejectsWrongSubprotocolKey(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	cfg := &model.Config{Logger: logger, GlobalAPIKey: "router-key"}
+
+	req := httptest.NewRequest("GET", "/v1/realtime?model=gpt-4o", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Protocol", "realtime, openai-insecure-api-key.wrong")
+
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rec.Code)
+	}
+}
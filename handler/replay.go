@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// maxDiffLines bounds the answers compared line by line; longer ones are
+// only reported as differing
+const maxDiffLines = 2000
+
+// replayOptions change where a replayed request is sent
+type replayOptions struct {
+	Model   string `json:"model"`
+	Backend string `json:"backend"`
+}
+
+// replayAnswer is one side of a replay's comparison
+type replayAnswer struct {
+	Model    string          `json:"model"`
+	Backend  string          `json:"backend,omitempty"`
+	Status   int             `json:"status"`
+	Text     string          `json:"text"`
+	Response json.RawMessage `json:"response"`
+}
+
+// handleReplay sends a request recorded in the audit log again and compares
+// the new answer with the recorded one:
+//
+//	POST /router/replay/{id}  {"model": "ollama/llama3", "backend": "ollama"}
+//
+// The request goes to its original model unless model or backend say
+// otherwise. It is sent without streaming, under a new request ID.
+func handleReplay(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	if cfg.AuditLog == nil || !cfg.AuditLog.Bodies() {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Replay needs recorded bodies; set audit.path and audit.bodies in the config"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/router/replay/")
+	var options replayOptions
+	if data, _ := io.ReadAll(r.Body); len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &options); err != nil {
+			utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Invalid replay options: %v", err))
+			return
+		}
+	}
+
+	entries, err := audit.Read(cfg.Audit.Path, audit.Query{ID: id})
+	if err != nil {
+		cfg.Logger.Error("Failed to read audit log", zap.Error(err))
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Failed to read audit log"))
+		return
+	}
+	var original *audit.Entry
+	for i := range entries {
+		if len(entries[i].Request) > 0 {
+			original = &entries[i]
+		}
+	}
+	if original == nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrNotFound, "No request %s with a recorded body in the audit log", id))
+		return
+	}
+	var chatReq map[string]interface{}
+	if original.Path != "/v1/chat/completions" && original.Path != "/v1/responses" || json.Unmarshal(original.Request, &chatReq) != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Request %s to %s cannot be replayed", id, original.Path))
+		return
+	}
+
+	// The answers are compared whole, so the replay does not stream
+	if options.Model != "" {
+		chatReq["model"] = options.Model
+	}
+	chatReq["stream"] = false
+	delete(chatReq, "stream_options")
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error encoding request"))
+		return
+	}
+	replay := r.Clone(r.Context())
+	replay.Method = http.MethodPost
+	replay.URL.Path, replay.URL.RawPath = original.Path, ""
+	setBody(replay, body)
+	rc := extension.NewRequestContext(replay, requestAuthorization(r))
+	rc.PinnedBackend = options.Backend
+	rc.ClientIP = extension.FromRequest(r).ClientIP
+	rc.ForwardAuthorization = extension.FromRequest(r).ForwardAuthorization
+	replay = extension.WithRequestContext(replay, rc)
+
+	response := newBufferedResponse()
+	start := time.Now()
+	handleModelRequest(response, replay, cfg)
+	if response.status == 0 {
+		response.status = http.StatusOK
+	}
+	cfg.Logger.Info("Replayed request",
+		zap.String("requestID", id),
+		zap.String("replayID", rc.ID),
+		zap.String("model", rc.Model),
+		zap.String("backend", rc.Backend),
+		zap.Int("status", response.status),
+		zap.Duration("duration", time.Since(start)))
+
+	before := replayAnswer{Model: original.Model, Backend: original.Backend, Status: original.Status,
+		Text: answerText(original.Response), Response: original.Response}
+	after := replayAnswer{Model: rc.Model, Backend: rc.Backend, Status: response.status,
+		Text: answerText(response.body.Bytes()), Response: rawJSON(response.body.Bytes())}
+	writeJSON(w, map[string]interface{}{
+		"id":        id,
+		"replay_id": rc.ID,
+		"original":  before,
+		"replay":    after,
+		"identical": before.Text == after.Text,
+		"diff":      diffLines(before.Text, after.Text),
+	})
+}
+
+// answerText returns the text of a chat completions or responses answer,
+// assembled from its events if it was streamed, or the body itself if it
+// has no text
+func answerText(body []byte) string {
+	// Streamed answers are recorded as a JSON string of their events
+	var stream string
+	if json.Unmarshal(body, &stream) == nil {
+		var text strings.Builder
+		reader := utils.NewSSEReader(strings.NewReader(stream))
+		for {
+			event, err := reader.Next()
+			if err != nil {
+				break
+			}
+			var chunk struct {
+				Type    string `json:"type"`
+				Delta   string `json:"delta"`
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			if json.Unmarshal([]byte(event.Data), &chunk) != nil {
+				continue
+			}
+			if chunk.Type == "response.output_text.delta" {
+				text.WriteString(chunk.Delta)
+			}
+			if len(chunk.Choices) > 0 {
+				text.WriteString(chunk.Choices[0].Delta.Content)
+			}
+		}
+		if text.Len() > 0 {
+			return text.String()
+		}
+		return stream
+	}
+
+	var answer struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Output []struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+	}
+	if json.Unmarshal(body, &answer) == nil {
+		if len(answer.Choices) > 0 {
+			return answer.Choices[0].Message.Content
+		}
+		var text strings.Builder
+		for _, item := range answer.Output {
+			for _, part := range item.Content {
+				if part.Type == "output_text" {
+					text.WriteString(part.Text)
+				}
+			}
+		}
+		if text.Len() > 0 {
+			return text.String()
+		}
+	}
+	return string(body)
+}
+
+// diffLines returns the lines of a and b, prefixed with "-" if only a has
+// them, "+" if only b has them and " " if both do
+func diffLines(a, b string) []string {
+	before, after := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if len(before) > maxDiffLines || len(after) > maxDiffLines {
+		if a == b {
+			return nil
+		}
+		return []string{"answers are too long to compare line by line"}
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:]
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case before[i] == after[j]:
+			diff = append(diff, " "+before[i])
+			i, j = i+1, j+1
+		case common[i+1][j] >= common[i][j+1]:
+			diff = append(diff, "-"+before[i])
+			i++
+		default:
+			diff = append(diff, "+"+after[j])
+			j++
+		}
+	}
+	for ; i < len(before); i++ {
+		diff = append(diff, "-"+before[i])
+	}
+	for ; j < len(after); j++ {
+		diff = append(diff, "+"+after[j])
+	}
+	return diff
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestReplayComparesAnswers(t *testing.T) {
+	var models []string
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		models = append(models, req.Model)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"one\\n\"}}]}\n\n")
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"two\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":"one\nthree from %s"}}]}`, req.Model)
+	})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	cfg.AuditLog, cfg.Audit = auditLog, model.AuditConfig{Path: path, Bodies: true}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"up/llama3","stream":true,"messages":[{"role":"user","content":"count"}]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	id := rec.Header().Get("X-Router-Request-ID")
+
+	req = httptest.NewRequest("POST", "/router/replay/"+id, strings.NewReader(`{"model":"up/qwen"}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec = httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result struct {
+		Original  replayAnswer `json:"original"`
+		Replay    replayAnswer `json:"replay"`
+		Identical bool         `json:"identical"`
+		Diff      []string     `json:"diff"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(models, []string{"llama3", "qwen"}) {
+		t.Errorf("Expected the replay to use the new model, got %v", models)
+	}
+	if result.Original.Text != "one\ntwo" || result.Replay.Text != "one\nthree from qwen" || result.Identical {
+		t.Errorf("Unexpected answers %q and %q", result.Original.Text, result.Replay.Text)
+	}
+	if want := []string{" one", "-two", "+three from qwen"}; !slices.Equal(result.Diff, want) {
+		t.Errorf("Expected diff %q, got %q", want, result.Diff)
+	}
+
+	req = httptest.NewRequest("POST", "/router/replay/unknown", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec = httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown request, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/resume"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// resumeStream runs next with the events of a streamed response numbered and
+// kept, or replays a kept stream from the client's Last-Event-ID. A kept
+// stream runs to completion even if the client disconnects, so it can be resumed.
+func resumeStream(w http.ResponseWriter, r *http.Request, cfg *model.Config, next func(http.ResponseWriter, *http.Request, *model.Config)) {
+	if cfg.Streams == nil {
+		next(w, r, cfg)
+		return
+	}
+
+	rc := extension.FromRequest(r)
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		id, after, ok := resume.ParseID(last)
+		stream := cfg.Streams.Get(id)
+		if !ok || stream == nil || stream.KeyID != rc.KeyID {
+			utils.WriteErr(w, utils.NewError(utils.ErrNotFound, "Stream %s can no longer be resumed; send the request again without Last-Event-ID", last))
+			return
+		}
+		replayStream(w, r, stream, after, cfg.Logger)
+		return
+	}
+
+	ew := &eventWriter{ResponseWriter: w, store: cfg.Streams, rc: rc}
+	defer ew.finish()
+	// Only a disconnect before the response starts streaming cancels the request
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+	stop := context.AfterFunc(r.Context(), func() {
+		if !ew.streaming.Load() {
+			cancel()
+		}
+	})
+	defer stop()
+	next(ew, r.WithContext(ctx), cfg)
+}
+
+// replayStream writes the events of stream numbered after after, following
+// the stream if it is still being generated
+func replayStream(w http.ResponseWriter, r *http.Request, stream *resume.Stream, after int, logger *zap.Logger) {
+	logger.Info("Resuming stream", zap.String("stream", stream.ID), zap.Int("after", after))
+	controller := http.NewResponseController(w)
+	started := false
+	err := stream.Follow(r.Context(), after, func(n int, event []byte) error {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\n%s\n\n", resume.FormatID(stream.ID, n), event); err != nil {
+			return err
+		}
+		return controller.Flush()
+	})
+	switch {
+	case errors.Is(err, resume.ErrTruncated) && !started:
+		utils.WriteErr(w, utils.NewError(utils.ErrNotFound, "Stream %s was too large to keep; send the request again without Last-Event-ID", stream.ID))
+	case err != nil:
+		logger.Warn("Stream resumption ended early", zap.String("stream", stream.ID), zap.Error(err))
+	case !started:
+		// Nothing was left to send
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// eventWriter numbers the events of an event stream response and keeps them
+// for resumption. Writes to a client that has gone are discarded so the
+// response still runs to completion.
+type eventWriter struct {
+	http.ResponseWriter
+	store     *resume.Store
+	rc        *extension.RequestContext
+	stream    *resume.Stream
+	checked   bool
+	streaming atomic.Bool
+	pending   []byte
+	gone      bool
+}
+
+func (e *eventWriter) WriteHeader(status int) {
+	e.check(status)
+	e.ResponseWriter.WriteHeader(status)
+}
+
+func (e *eventWriter) Write(p []byte) (int, error) {
+	e.check(http.StatusOK)
+	if e.stream == nil {
+		return e.ResponseWriter.Write(p)
+	}
+
+	e.pending = append(e.pending, p...)
+	start := 0
+	for {
+		i := bytes.Index(e.pending[start:], []byte("\n\n"))
+		if i < 0 {
+			break
+		}
+		event := e.pending[start : start+i]
+		n := e.stream.Append(event)
+		e.send([]byte(fmt.Sprintf("id: %s\n%s\n\n", resume.FormatID(e.stream.ID, n), event)))
+		start += i + 2
+	}
+	e.pending = append(e.pending[:0], e.pending[start:]...)
+	return len(p), nil
+}
+
+// send writes to the client unless it has gone
+func (e *eventWriter) send(p []byte) {
+	if e.gone {
+		return
+	}
+	if _, err := e.ResponseWriter.Write(p); err != nil {
+		e.gone = true
+	}
+}
+
+// FlushError flushes to the client unless it has gone
+func (e *eventWriter) FlushError() error {
+	if e.gone {
+		return nil
+	}
+	if err := http.NewResponseController(e.ResponseWriter).Flush(); err != nil {
+		e.gone = true
+	}
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to set deadlines
+func (e *eventWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// check decides once, when the response starts, whether it is an event stream to keep
+func (e *eventWriter) check(status int) {
+	if e.checked {
+		return
+	}
+	e.checked = true
+	if status != http.StatusOK || !strings.HasPrefix(e.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	e.stream = e.store.Start(e.rc.ID, e.rc.KeyID)
+	e.streaming.Store(true)
+}
+
+// finish passes on an incomplete last event and marks the stream complete
+func (e *eventWriter) finish() {
+	if e.stream == nil {
+		return
+	}
+	if len(e.pending) > 0 {
+		e.send(e.pending)
+	}
+	e.stream.Finish()
+}
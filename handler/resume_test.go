@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/resume"
+)
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"one", "two", "three"} {
+			io.WriteString(w, `data: {"choices":[{"delta":{"content":"`+word+`"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	})
+	cfg.Streams = resume.New(time.Minute, 0)
+	cfg.APIKeys = []model.APIKeyConfig{{Name: "other", Key: "other-key"}}
+
+	send := func(key, lastEventID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"up/llama3","stream":true}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	first := send("router-key", "")
+	id := first.Header().Get("X-Router-Request-ID")
+	body := first.Body.String()
+	for n := 1; n <= 4; n++ {
+		if !strings.Contains(body, "id: "+resume.FormatID(id, n)+"\n") {
+			t.Errorf("Expected event %d to be numbered, got %s", n, body)
+		}
+	}
+	if !strings.Contains(body, `"content":"one"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Expected the whole stream, got %s", body)
+	}
+
+	resumed := send("router-key", resume.FormatID(id, 1))
+	got := resumed.Body.String()
+	if strings.Contains(got, `"one"`) || !strings.Contains(got, `"two"`) || !strings.Contains(got, `"three"`) || !strings.Contains(got, "[DONE]") {
+		t.Errorf("Expected the events after the first, got %s", got)
+	}
+	if !strings.HasPrefix(got, "id: "+resume.FormatID(id, 2)+"\n") {
+		t.Errorf("Expected the resumed stream to keep its numbering, got %s", got)
+	}
+
+	for _, tt := range []struct{ key, last string }{
+		{"other-key", resume.FormatID(id, 1)},
+		{"router-key", resume.FormatID("unknown", 1)},
+	} {
+		if rec := send(tt.key, tt.last); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d %s", tt.key, tt.last, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// defaultSimilarity is how similar a prompt must be to a cached one unless configured
+const defaultSimilarity = 0.95
+
+// cacheBackend is the backend recorded for requests answered from the cache
+const cacheBackend = "semantic-cache"
+
+// cacheLookup is a prompt that missed the semantic cache, kept to store its
+// answer under
+type cacheLookup struct {
+	scope  string
+	vector []float64
+}
+
+// lookupCache looks a non-streaming chat completion up in the semantic cache.
+// A hit is answered and reported as served. A miss returns the lookup to
+// store the answer under; requests that are not cached return nil.
+func lookupCache(w http.ResponseWriter, r *http.Request, cfg *model.Config, chatReq map[string]interface{}, modelName string, logger *zap.Logger) (*cacheLookup, bool) {
+	settings := cfg.SemanticCache
+	if cfg.ResponseCache == nil || settings.EmbeddingModel == "" || r.URL.Path != "/v1/chat/completions" {
+		return nil, false
+	}
+	if stream, _ := chatReq["stream"].(bool); stream || !matchesAny(settings.Models, modelName) {
+		return nil, false
+	}
+
+	vector, err := embed(r, cfg, settings.EmbeddingModel, promptText(chatReq), logger)
+	if err != nil {
+		logger.Warn("Could not embed the prompt, skipping the semantic cache",
+			zap.String("embeddingModel", settings.EmbeddingModel), zap.Error(err))
+		return nil, false
+	}
+	rc := extension.FromRequest(r)
+	lookup := &cacheLookup{scope: cacheScope(rc, chatReq), vector: vector}
+	threshold := settings.Threshold
+	if threshold <= 0 {
+		threshold = defaultSimilarity
+	}
+
+	entry, similarity, ok := cfg.ResponseCache.Lookup(lookup.scope, vector, threshold)
+	if !ok {
+		w.Header().Set("X-Router-Cache", "miss")
+		return lookup, false
+	}
+	logger.Info("Answered from the semantic cache",
+		zap.String("requestID", rc.ID), zap.String("model", rc.Model), zap.Float64("similarity", similarity))
+	rc.Backend = cacheBackend
+	w.Header().Set("Content-Type", entry.ContentType)
+	w.Header().Set("X-Router-Cache", "hit")
+	w.Header().Set("X-Router-Cache-Similarity", fmt.Sprintf("%.3f", similarity))
+	w.Write(entry.Body)
+	return nil, true
+}
+
+// store remembers a successful answer to the prompt
+func (l *cacheLookup) store(cfg *model.Config, response *bufferedResponse) {
+	contentType := response.header.Get("Content-Type")
+	if response.status != http.StatusOK || response.header.Get("Content-Encoding") != "" || !strings.Contains(contentType, "json") {
+		return
+	}
+	cfg.ResponseCache.Store(l.scope, l.vector, contentType, response.body.Bytes())
+}
+
+// cacheScope returns what a cached answer must share with a request besides
+// a similar prompt: the client's key and the request hash of the model, every
+// other parameter and what the messages carry besides their text
+func cacheScope(rc *extension.RequestContext, chatReq map[string]interface{}) string {
+	params := make(map[string]interface{}, len(chatReq))
+	for name, value := range chatReq {
+		if name != "messages" {
+			params[name] = value
+		}
+	}
+	if extras := messageExtras(chatReq); len(extras) > 0 {
+		params["messages"] = extras
+	}
+	encoded, _ := json.Marshal(params)
+	hash, _ := utils.RequestHash(encoded)
+	return rc.KeyID + "\x00" + hash
+}
+
+// messageExtras returns what the messages of a request carry that their text
+// leaves out, such as images, tool calls and the IDs of tool results, so
+// prompts differing only there are never answered for each other
+func messageExtras(chatReq map[string]interface{}) []interface{} {
+	var extras []interface{}
+	for i, m := range utils.Messages(chatReq) {
+		message, _ := m.(map[string]interface{})
+		extra := make(map[string]interface{})
+		for name, value := range message {
+			if name != "role" && name != "content" {
+				extra[name] = value
+			}
+		}
+		parts, _ := message["content"].([]interface{})
+		var other []interface{}
+		for _, p := range parts {
+			if part, _ := p.(map[string]interface{}); part["type"] != "text" {
+				other = append(other, p)
+			}
+		}
+		if len(other) > 0 {
+			extra["content"] = other
+		}
+		if len(extra) > 0 {
+			extra["index"] = i
+			extras = append(extras, extra)
+		}
+	}
+	return extras
+}
+
+// promptText returns the text of the messages of a request, by role
+func promptText(chatReq map[string]interface{}) string {
+	var text strings.Builder
+	for _, m := range utils.Messages(chatReq) {
+		fmt.Fprintf(&text, "%s: %s\n\n", messageRole(m), utils.MessageText(m))
+	}
+	return text.String()
+}
+
+// embed returns the embedding of text by an embeddings model
+func embed(r *http.Request, cfg *model.Config, embeddingModel, text string, logger *zap.Logger) ([]float64, error) {
+	response, err := callModel(r, cfg, embeddingModel, "/v1/embeddings", func(backendModel string) map[string]interface{} {
+		return map[string]interface{}{"model": backendModel, "input": text}
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	var embeddings struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(response.body.Bytes(), &embeddings); err != nil {
+		return nil, err
+	}
+	if len(embeddings.Data) == 0 || len(embeddings.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("%s returned no embedding", embeddingModel)
+	}
+	return embeddings.Data[0].Embedding, nil
+}
+
+// matchesAny reports whether a model matches one of the globs
+func matchesAny(globs []string, modelName string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, modelName); ok {
+			return true
+		}
+	}
+	return false
+}
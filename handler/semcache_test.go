@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/semcache"
+)
+
+func TestSemanticCacheServesSimilarPrompts(t *testing.T) {
+	completions := 0
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/embeddings" {
+			// Questions about France embed close together
+			vector := "[0,1]"
+			if strings.Contains(body["input"].(string), "France") {
+				vector = "[1,0.1]"
+				if strings.Contains(body["input"].(string), "capital city") {
+					vector = "[1,0.12]"
+				}
+			}
+			io.WriteString(w, `{"data":[{"embedding":`+vector+`}]}`)
+			return
+		}
+		completions++
+		io.WriteString(w, `{"object":"chat.completion","choices":[{"message":{"role":"assistant","content":"Paris"}}]}`)
+	})
+	cfg.SemanticCache = model.SemanticCacheConfig{Models: []string{"up/llama3"}, EmbeddingModel: "up/embed"}
+	cfg.ResponseCache = semcache.New(10, 0)
+
+	send := func(content string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model":"up/llama3","messages":[{"role":"user","content":`+content+`}]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+	ask := func(question string) *httptest.ResponseRecorder {
+		return send(`"` + question + `"`)
+	}
+
+	if rec := ask("What is the capital of France?"); rec.Header().Get("X-Router-Cache") != "miss" {
+		t.Errorf("Expected the first question to miss, got %q", rec.Header().Get("X-Router-Cache"))
+	}
+	rec := ask("What is the capital city of France?")
+	if rec.Header().Get("X-Router-Cache") != "hit" || !strings.Contains(rec.Body.String(), "Paris") {
+		t.Errorf("Expected a similar question to be answered from the cache, got %q %s", rec.Header().Get("X-Router-Cache"), rec.Body.String())
+	}
+	if rec := ask("How do I sort a slice?"); rec.Header().Get("X-Router-Cache") != "miss" {
+		t.Errorf("Expected an unrelated question to miss")
+	}
+	if completions != 2 {
+		t.Errorf("Expected 2 completions to reach the backend, got %d", completions)
+	}
+
+	req := httptest.NewRequest("GET", "/router/cache", nil)
+	req.Header.Set("Authorization", "Bearer router-key")
+	stats := httptest.NewRecorder()
+	HandleRequest(cfg, stats, req)
+	var report semcache.Stats
+	json.NewDecoder(stats.Body).Decode(&report)
+	if report.Hits != 1 || report.Misses != 2 || report.Entries != 2 {
+		t.Errorf("Unexpected cache stats %+v", report)
+	}
+
+	picture := func(url string) string {
+		return `[{"type":"text","text":"What is the capital of France?"},{"type":"image_url","image_url":{"url":"` + url + `"}}]`
+	}
+	if rec := send(picture("https://example.com/a.png")); rec.Header().Get("X-Router-Cache") != "miss" {
+		t.Errorf("Expected a prompt with an image not to be answered for the same text without it")
+	}
+	if rec := send(picture("https://example.com/b.png")); rec.Header().Get("X-Router-Cache") != "miss" {
+		t.Errorf("Expected a prompt with another image not to be answered for the first")
+	}
+	if rec := send(picture("https://example.com/a.png")); rec.Header().Get("X-Router-Cache") != "hit" {
+		t.Errorf("Expected the same text and image to be answered from the cache")
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+var (
+	soak         = flag.Duration("soak", 0, "run the soak test for this long (e.g. 2h); skipped when 0")
+	soakWorkers  = flag.Int("soak.workers", 16, "concurrent clients in the soak test")
+	soakInterval = flag.Duration("soak.interval", 30*time.Second, "how often the soak test samples goroutines and heap")
+)
+
+// Leak thresholds: once traffic stops the goroutine count must settle back near
+// the count before traffic started, and the live heap must not keep growing
+// between the first sample after warmup and the end of the run.
+const (
+	soakGoroutineSlack = 10
+	soakHeapGrowth     = 2.0
+	soakSettleTimeout  = 30 * time.Second
+)
+
+// soakCounters tallies the outcome of every soak request
+type soakCounters struct {
+	ok, errors, canceled atomic.Int64
+}
+
+// TestSoak runs sustained mixed traffic through the router against a mock
+// backend while sampling goroutine and heap counts, and fails if either leaks.
+// It exercises the paths where proxies typically leak: clients hanging up
+// mid-stream, backends failing, backends hanging and requests waiting in a
+// concurrency queue.
+//
+//	go test ./handler -run TestSoak -soak 2h -v
+func TestSoak(t *testing.T) {
+	if *soak == 0 {
+		t.Skip("soak test disabled; run with -soak <duration>")
+	}
+	logger := zap.NewNop()
+
+	upstream := httptest.NewServer(http.HandlerFunc(soakBackend))
+	defer upstream.Close()
+	backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{{
+		Name:          "up",
+		BaseURL:       upstream.URL,
+		Prefix:        "up/",
+		Default:       true,
+		MaxConcurrent: *soakWorkers / 2,
+		MaxQueue:      *soakWorkers,
+		QueueTimeout:  5,
+	}}, Logger: logger})
+	cfg := &model.Config{Logger: logger, GlobalAPIKey: "router-key"}
+	cfg.Router = backendRouter
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleRequest(cfg, w, r)
+	}))
+	defer router.Close()
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *soakWorkers}}
+	baseGoroutines := settledGoroutines(0)
+	t.Logf("Baseline: %d goroutines", baseGoroutines)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *soak)
+	defer cancel()
+	var counters soakCounters
+	var wg sync.WaitGroup
+	for i := 0; i < *soakWorkers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				soakRequest(ctx, client, router.URL, rng, &counters)
+			}
+		}(int64(i))
+	}
+
+	var firstHeap uint64
+	ticker := time.NewTicker(*soakInterval)
+	defer ticker.Stop()
+sampling:
+	for {
+		select {
+		case <-ctx.Done():
+			break sampling
+		case <-ticker.C:
+			heap := liveHeap()
+			if firstHeap == 0 {
+				firstHeap = heap
+			}
+			t.Logf("goroutines=%d heap=%dKiB ok=%d errors=%d canceled=%d",
+				runtime.NumGoroutine(), heap>>10, counters.ok.Load(), counters.errors.Load(), counters.canceled.Load())
+		}
+	}
+	wg.Wait()
+	client.CloseIdleConnections()
+
+	if counters.ok.Load() == 0 {
+		t.Fatalf("No request succeeded during the soak test")
+	}
+	if n := settledGoroutines(baseGoroutines + soakGoroutineSlack); n > baseGoroutines+soakGoroutineSlack {
+		buf := make([]byte, 1<<20)
+		t.Errorf("Goroutine leak: %d goroutines after traffic stopped, %d before\n%s",
+			n, baseGoroutines, buf[:runtime.Stack(buf, true)])
+	}
+	if heap := liveHeap(); firstHeap > 0 && float64(heap) > float64(firstHeap)*soakHeapGrowth {
+		t.Errorf("Heap grew from %dKiB to %dKiB during the soak test", firstHeap>>10, heap>>10)
+	}
+}
+
+// soakRequest sends one request of a randomly chosen kind and records the outcome
+func soakRequest(ctx context.Context, client *http.Client, url string, rng *rand.Rand, counters *soakCounters) {
+	kind := []string{"complete", "stream", "stream", "disconnect", "error", "hang"}[rng.Intn(6)]
+	stream := kind != "complete" && kind != "error"
+	body := fmt.Sprintf(`{"model":"up/%s","stream":%t,"messages":[{"role":"user","content":%q}]}`,
+		kind, stream, strings.Repeat("hello ", rng.Intn(200)))
+
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if kind == "hang" {
+		reqCtx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+	}
+	req, _ := http.NewRequestWithContext(reqCtx, "POST", url+"/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer router-key")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		counters.canceled.Add(1)
+		return
+	}
+	defer resp.Body.Close()
+
+	if kind == "disconnect" {
+		// Read a little of the stream, then hang up
+		io.CopyN(io.Discard, resp.Body, int64(rng.Intn(512)))
+		cancel()
+		counters.canceled.Add(1)
+		return
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		counters.canceled.Add(1)
+		return
+	}
+	if resp.StatusCode == http.StatusOK {
+		counters.ok.Add(1)
+	} else {
+		counters.errors.Add(1)
+	}
+}
+
+// soakBackend mimics an LLM server; the model name selects its behaviour
+func soakBackend(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case strings.Contains(string(body), `"model":"error"`):
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	case strings.Contains(string(body), `"model":"hang"`):
+		<-r.Context().Done()
+	case strings.Contains(string(body), `"stream":true`):
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, _ := w.(http.Flusher)
+		for i := 0; i < 50; i++ {
+			if _, err := fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"token%d \"}}]}\n\n", i); err != nil {
+				return
+			}
+			flusher.Flush()
+			time.Sleep(time.Millisecond)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`)
+	}
+}
+
+// settledGoroutines waits for background goroutines (closing connections,
+// finishing handlers) to exit and returns the goroutine count, giving up
+// after soakSettleTimeout or as soon as the count is at most target
+func settledGoroutines(target int) int {
+	deadline := time.Now().Add(soakSettleTimeout)
+	n, prev := runtime.NumGoroutine(), -1
+	for time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(100 * time.Millisecond)
+		n = runtime.NumGoroutine()
+		if (target > 0 && n <= target) || (target == 0 && n == prev) {
+			break
+		}
+		prev = n
+	}
+	return n
+}
+
+// liveHeap returns the bytes of reachable heap objects after a full collection
+func liveHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// handleSpeech routes text-to-speech requests by the model in the body, like
+// chat completions. Voices are translated by the backend's voice map.
+func handleSpeech(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	logger := cfg.Logger
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+		return
+	}
+
+	var speechReq map[string]interface{}
+	if err := utils.UnmarshalJSON(body, &speechReq); err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Error unmarshalling request body"))
+		return
+	}
+	modelName, ok := speechReq["model"].(string)
+	if !ok {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Model key missing or not a string"))
+		return
+	}
+	extension.FromRequest(r).Model = modelName
+
+	if alias, ok := cfg.Aliases[modelName]; ok && len(alias.Models) > 0 {
+		logger.Info("Resolved model alias", zap.String("alias", modelName), zap.String("model", alias.Models[0]))
+		modelName = alias.Models[0]
+	}
+	target, newModelName, err := resolveBackend(r, cfg.Router, modelName, logger)
+	if err != nil {
+		logger.Warn("No suitable backend found", zap.String("model", modelName), zap.Error(err))
+		utils.WriteErr(w, err)
+		return
+	}
+
+	if newModelName != speechReq["model"] {
+		speechReq["model"] = newModelName
+		if body, err = json.Marshal(speechReq); err != nil {
+			utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error re-marshalling request body"))
+			return
+		}
+	}
+	setBody(r, body)
+	target.ServeHTTP(w, r)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+func TestSpeechRoutesByPrefixAndMapsVoices(t *testing.T) {
+	var got map[string]interface{}
+	kokoro := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte{0xff, 0xfb})
+	}))
+	defer kokoro.Close()
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the speech request to go to kokoro")
+	}))
+	defer openai.Close()
+
+	backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{
+		{Name: "openai", BaseURL: openai.URL, Prefix: "openai/", Default: true},
+		{Name: "kokoro", BaseURL: kokoro.URL, Prefix: "kokoro/", Voices: map[string]string{"alloy": "af_bella", "*": "am_adam"}},
+	}, Logger: zap.NewNop()})
+	cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Aliases: map[string]model.ModelAlias{
+		"tts": {Models: []string{"kokoro/kokoro-82m"}},
+	}}
+	cfg.Router = backendRouter
+
+	tests := []struct {
+		model, voice, wantVoice string
+	}{
+		{"kokoro/kokoro-82m", "alloy", "af_bella"},
+		{"kokoro/kokoro-82m", "onyx", "am_adam"},
+		{"tts", "alloy", "af_bella"},
+	}
+	for _, tt := range tests {
+		got = nil
+		req := httptest.NewRequest("POST", "/v1/audio/speech",
+			strings.NewReader(`{"model":"`+tt.model+`","input":"Hello","voice":"`+tt.voice+`"}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "audio/mpeg" {
+			t.Errorf("%s: expected audio, got %d %s", tt.model, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if got["model"] != "kokoro-82m" || got["voice"] != tt.wantVoice || got["input"] != "Hello" {
+			t.Errorf("%s %s: unexpected upstream request %v", tt.model, tt.voice, got)
+		}
+	}
+}
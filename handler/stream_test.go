@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// Each event must reach the client as soon as the backend sends it, even when
+// the stream is rewritten, recorded and compressed on the way
+func TestStreamedEventsAreNotHeldBack(t *testing.T) {
+	release := make(chan struct{})
+	cfg := newTestRouter(t, model.BackendConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"model\":\"llama3\",\"choices\":[{\"delta\":{\"content\":\"first\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	})
+	if history.Available {
+		store, err := history.Open(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to open history: %s", err)
+		}
+		defer store.Close()
+		cfg.History = store
+	}
+	server := httptest.NewServer(NewHandler(cfg))
+	defer server.Close()
+	defer close(release)
+
+	req, _ := http.NewRequest("POST", server.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model":"up/llama3","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	// The client's transport asks for gzip and decompresses the response itself
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !resp.Uncompressed {
+		t.Errorf("Expected a compressed stream")
+	}
+
+	first := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		if !strings.Contains(line, `"model":"up/llama3"`) {
+			t.Errorf("Expected the first event with the requested model, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("The first event was held back until the stream ended")
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/synthetic"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// serveSynthetic answers a chat completions or responses request for a
+// synthetic model in the format, streamed or not, that the client asked for
+func serveSynthetic(w http.ResponseWriter, r *http.Request, m *synthetic.Model, chatReq map[string]interface{}, logger *zap.Logger) {
+	rc := extension.FromRequest(r)
+	text, err := m.Respond(rc.Vars(), utils.LastUserText(chatReq))
+	if err != nil {
+		logger.Error("Synthetic model failed", zap.String("model", m.Name), zap.Error(err))
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Synthetic model %s failed: %s", m.Name, err))
+		return
+	}
+	logger.Info("Answered by synthetic model", zap.String("model", m.Name), zap.String("requestID", rc.ID))
+
+	created := time.Now().Unix()
+	promptTokens, completionTokens := rc.TokensEstimate, utils.EstimateTokens(len(text))
+	stream, _ := chatReq["stream"].(bool)
+
+	if r.URL.Path == "/v1/responses" {
+		response := map[string]interface{}{
+			"id":         "resp_" + rc.ID,
+			"object":     "response",
+			"created_at": created,
+			"status":     "completed",
+			"model":      m.Name,
+			"output": []interface{}{map[string]interface{}{
+				"type":    "message",
+				"id":      "msg_" + rc.ID,
+				"status":  "completed",
+				"role":    "assistant",
+				"content": []interface{}{map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}},
+			}},
+			"usage": map[string]interface{}{
+				"input_tokens":  promptTokens,
+				"output_tokens": completionTokens,
+				"total_tokens":  promptTokens + completionTokens,
+			},
+		}
+		if !stream {
+			writeJSON(w, response)
+			return
+		}
+		started := map[string]interface{}{"id": response["id"], "object": "response", "created_at": created, "status": "in_progress", "model": m.Name, "output": []interface{}{}}
+		writeEvents(w,
+			map[string]interface{}{"type": "response.created", "response": started},
+			map[string]interface{}{"type": "response.output_text.delta", "item_id": "msg_" + rc.ID, "output_index": 0, "content_index": 0, "delta": text},
+			map[string]interface{}{"type": "response.completed", "response": response},
+		)
+		return
+	}
+
+	usage := map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+	if !stream {
+		writeJSON(w, map[string]interface{}{
+			"id":      "chatcmpl-" + rc.ID,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   m.Name,
+			"choices": []interface{}{map[string]interface{}{
+				"index":         0,
+				"message":       map[string]interface{}{"role": "assistant", "content": text},
+				"finish_reason": "stop",
+			}},
+			"usage": usage,
+		})
+		return
+	}
+	chunk := func(choices []interface{}) map[string]interface{} {
+		return map[string]interface{}{"id": "chatcmpl-" + rc.ID, "object": "chat.completion.chunk", "created": created, "model": m.Name, "choices": choices}
+	}
+	chunks := []interface{}{
+		chunk([]interface{}{map[string]interface{}{"index": 0, "delta": map[string]interface{}{"role": "assistant", "content": text}, "finish_reason": nil}}),
+		chunk([]interface{}{map[string]interface{}{"index": 0, "delta": map[string]interface{}{}, "finish_reason": "stop"}}),
+	}
+	if options, _ := chatReq["stream_options"].(map[string]interface{}); options["include_usage"] == true {
+		last := chunk([]interface{}{})
+		last["usage"] = usage
+		chunks = append(chunks, last)
+	}
+	writeEvents(w, chunks...)
+}
+
+// writeJSON answers with payload as JSON
+func writeJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+// writeEvents answers with payloads as server-sent events. Responses API
+// events are named after their type; chat completion chunks end with [DONE].
+func writeEvents(w http.ResponseWriter, payloads ...interface{}) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	chat := true
+	for _, payload := range payloads {
+		data, _ := json.Marshal(payload)
+		if event, _ := payload.(map[string]interface{})["type"].(string); event != "" {
+			chat = false
+			fmt.Fprintf(w, "event: %s\n", event)
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	if chat {
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
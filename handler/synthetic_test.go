@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/synthetic"
+)
+
+func TestSyntheticModelAnswersWithoutBackend(t *testing.T) {
+	cfg := newTestRouter(t, model.BackendConfig{Default: true}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the synthetic model not to reach a backend")
+	})
+	bot, err := synthetic.Compile("policy-bot", "Policy: be kind to {{.last_user}}", nil)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	cfg.SyntheticSet = &synthetic.Set{}
+	cfg.SyntheticSet.Add(bot)
+	cfg.Aliases = map[string]model.ModelAlias{"policy": {Models: []string{"policy-bot"}}}
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, req)
+		return rec
+	}
+
+	rec := send("/v1/chat/completions", `{"model":"policy","messages":[{"role":"user","content":"robots"}]}`)
+	var completion struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &completion)
+	if completion.Object != "chat.completion" || len(completion.Choices) != 1 ||
+		completion.Choices[0].Message.Content != "Policy: be kind to robots" || completion.Usage.TotalTokens == 0 {
+		t.Errorf("Unexpected completion %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = send("/v1/chat/completions", `{"model":"policy-bot","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"cats"}]}`)
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" || !strings.Contains(body, `"content":"Policy: be kind to cats"`) ||
+		!strings.Contains(body, `"finish_reason":"stop"`) || !strings.Contains(body, `"usage"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Unexpected stream %s", body)
+	}
+
+	rec = send("/v1/responses", `{"model":"policy-bot","input":"dogs"}`)
+	if !strings.Contains(rec.Body.String(), `"text":"Policy: be kind to dogs"`) || !strings.Contains(rec.Body.String(), `"object":"response"`) {
+		t.Errorf("Unexpected response %s", rec.Body.String())
+	}
+
+	rec = send("/v1/responses", `{"model":"policy-bot","input":"birds","stream":true}`)
+	body = rec.Body.String()
+	if !strings.Contains(body, "event: response.output_text.delta") || !strings.Contains(body, "event: response.completed") || strings.Contains(body, "[DONE]") {
+		t.Errorf("Unexpected responses stream %s", body)
+	}
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/transcription"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// formPart is one part of a multipart form, kept so the form can be rebuilt
+// with different fields for each backend
+type formPart struct {
+	header textproto.MIMEHeader
+	name   string
+	data   []byte
+}
+
+// handleTranscription sends an audio transcription request to the configured
+// models at once and returns one transcript. In first mode the first model's
+// transcript wins unless it fails; in confidence mode every backend is asked
+// for verbose_json and the most confident transcript is rendered in the format
+// the client asked for. Large files go only to the large file model.
+func handleTranscription(w http.ResponseWriter, r *http.Request, router model.Router, tc model.TranscriptionConfig, logger *zap.Logger) {
+	parts, err := readForm(r)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Error reading multipart form: %s", err))
+		return
+	}
+
+	models := tc.Models
+	format := transcription.FormatJSON
+	for _, part := range parts {
+		switch part.name {
+		case "file":
+			if tc.LargeFileModel != "" && tc.LargeFileBytes > 0 && int64(len(part.data)) > tc.LargeFileBytes {
+				logger.Info("Routing large audio file",
+					zap.Int("bytes", len(part.data)),
+					zap.String("model", tc.LargeFileModel))
+				models = []string{tc.LargeFileModel}
+			}
+		case "response_format":
+			format = string(part.data)
+		}
+	}
+	confidence := tc.Mode == transcription.ModeConfidence && len(models) > 1
+
+	// Canceling on return stops the requests whose transcripts are not needed
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	results := make([]chan raceResult, len(models))
+	for i, modelName := range models {
+		results[i] = make(chan raceResult, 1)
+		target, newModelName, err := resolveBackend(r, router, modelName, logger)
+		if err != nil {
+			results[i] <- raceResult{model: modelName, response: errorResponse(err)}
+			continue
+		}
+		fields := map[string]string{"model": newModelName}
+		if confidence {
+			fields["response_format"] = transcription.FormatVerboseJSON
+		}
+		body, contentType, err := writeForm(parts, fields)
+		if err != nil {
+			results[i] <- raceResult{model: modelName, response: errorResponse(utils.NewError(utils.ErrInternal, "Error rebuilding multipart form"))}
+			continue
+		}
+
+		attempt := r.Clone(ctx)
+		attempt.Header.Set("Content-Type", contentType)
+		setBody(attempt, body)
+		go func(modelName string, result chan<- raceResult) {
+			result <- serveAttempt(target, attempt, modelName)
+		}(modelName, results[i])
+	}
+
+	var chosen *raceResult
+	best := -1.0
+	for i, result := range results {
+		res := <-result
+		if res.response.status >= 300 {
+			logger.Warn("Transcription failed", zap.String("model", res.model), zap.Int("status", res.response.status))
+			if chosen == nil && i == len(models)-1 {
+				// Every model failed; report the last failure
+				chosen = &res
+			}
+			continue
+		}
+		if !confidence {
+			chosen = &res
+			break
+		}
+		verbose, err := transcription.Parse(res.response.body.Bytes())
+		if err != nil {
+			logger.Warn("Transcript is not verbose_json", zap.String("model", res.model), zap.Error(err))
+			continue
+		}
+		score, _ := transcription.Confidence(verbose)
+		logger.Info("Transcript confidence", zap.String("model", res.model), zap.Float64("confidence", score))
+		if score > best {
+			chosen, best = &res, score
+		}
+	}
+	if chosen == nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrBackendUnavailable, "No model returned a usable transcript"))
+		return
+	}
+
+	extension.FromRequest(r).Backend = chosen.backend
+	w.Header().Set("X-Router-Transcription-Model", chosen.model)
+	if !confidence || chosen.response.status >= 300 {
+		chosen.response.writeTo(w)
+		return
+	}
+	body, contentType, err := transcription.Render(chosen.response.body.Bytes(), format)
+	if err != nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "%s", err))
+		return
+	}
+	w.Header().Set("X-Router-Transcription-Confidence", strconv.FormatFloat(best, 'f', 3, 64))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// errorResponse records a router error as a response of its own
+func errorResponse(err error) *bufferedResponse {
+	response := newBufferedResponse()
+	utils.WriteErr(response, err)
+	return response
+}
+
+// readForm reads every part of a multipart request body
+func readForm(r *http.Request) ([]formPart, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, fmt.Errorf("expected multipart/form-data")
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	var parts []formPart
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, formPart{header: part.Header, name: part.FormName(), data: data})
+	}
+}
+
+// writeForm rebuilds a multipart form, replacing or adding the given fields
+func writeForm(parts []formPart, fields map[string]string) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	written := make(map[string]bool)
+	for _, part := range parts {
+		data := part.data
+		if value, ok := fields[part.name]; ok {
+			data = []byte(value)
+			written[part.name] = true
+		}
+		pw, err := writer.CreatePart(part.header)
+		if err != nil {
+			return nil, "", err
+		}
+		pw.Write(data)
+	}
+	for name, value := range fields {
+		if !written[name] {
+			writer.WriteField(name, value)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
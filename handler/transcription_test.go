@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/transcription"
+	"go.uber.org/zap"
+)
+
+// newWhisperStub returns a transcription backend answering with text and a
+// log probability, or failing if status is not 200, and records the models
+// and response formats it was sent
+func newWhisperStub(t *testing.T, text, logprob string, status int, seen *[]string, mu *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Expected a multipart form: %v", err)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected the audio file: %v", err)
+		} else if audio, _ := io.ReadAll(file); len(audio) == 0 {
+			t.Errorf("Expected audio data")
+		}
+		mu.Lock()
+		*seen = append(*seen, r.FormValue("model")+" "+r.FormValue("response_format"))
+		mu.Unlock()
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("response_format") == "verbose_json" {
+			io.WriteString(w, `{"text":"`+text+`","segments":[{"start":0,"end":2,"text":"`+text+`","avg_logprob":`+logprob+`}]}`)
+			return
+		}
+		io.WriteString(w, `{"text":"`+text+`"}`)
+	}))
+}
+
+func transcriptionRequest(audio int, format string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	file, _ := writer.CreateFormFile("file", "speech.wav")
+	file.Write(bytes.Repeat([]byte{1}, audio))
+	writer.WriteField("model", "whisper-1")
+	if format != "" {
+		writer.WriteField("response_format", format)
+	}
+	writer.Close()
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer router-key")
+	return req
+}
+
+func TestTranscriptionRouting(t *testing.T) {
+	tests := []struct {
+		name       string
+		tc         model.TranscriptionConfig
+		localFails bool
+		audio      int
+		format     string
+		wantModel  string
+		wantBody   string
+		wantSeen   int
+	}{
+		{"first prefers local", model.TranscriptionConfig{Models: []string{"local/whisper", "cloud/whisper-1"}}, false, 10, "", "local/whisper", `{"text":"local"}`, 0},
+		{"first falls back", model.TranscriptionConfig{Models: []string{"local/whisper", "cloud/whisper-1"}}, true, 10, "", "cloud/whisper-1", `{"text":"cloud"}`, 2},
+		{"confidence", model.TranscriptionConfig{Models: []string{"local/whisper", "cloud/whisper-1"}, Mode: transcription.ModeConfidence}, false, 10, "text", "cloud/whisper-1", "cloud\n", 2},
+		{"large file", model.TranscriptionConfig{Models: []string{"local/whisper", "cloud/whisper-1"}, LargeFileBytes: 100, LargeFileModel: "local/whisper"}, false, 1000, "", "local/whisper", `{"text":"local"}`, 1},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		var seen []string
+		status := http.StatusOK
+		if tt.localFails {
+			status = http.StatusInternalServerError
+		}
+		local := newWhisperStub(t, "local", "-0.9", status, &seen, &mu)
+		cloud := newWhisperStub(t, "cloud", "-0.2", http.StatusOK, &seen, &mu)
+		backendRouter := proxy.NewRouter(&model.Config{Backends: []model.BackendConfig{
+			{Name: "local", BaseURL: local.URL, Prefix: "local/"},
+			{Name: "cloud", BaseURL: cloud.URL, Prefix: "cloud/"},
+		}, Logger: zap.NewNop()})
+		cfg := &model.Config{Logger: zap.NewNop(), GlobalAPIKey: "router-key", Transcription: tt.tc}
+		cfg.Router = backendRouter
+
+		rec := httptest.NewRecorder()
+		HandleRequest(cfg, rec, transcriptionRequest(tt.audio, tt.format))
+		if got := rec.Header().Get("X-Router-Transcription-Model"); got != tt.wantModel {
+			t.Errorf("%s: expected %s, got %q", tt.name, tt.wantModel, got)
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != strings.TrimSpace(tt.wantBody) {
+			t.Errorf("%s: expected body %q, got %q", tt.name, tt.wantBody, got)
+		}
+		local.Close()
+		cloud.Close()
+		mu.Lock()
+		// Zero skips the count where the losing request may be canceled before it arrives
+		if tt.wantSeen > 0 && len(seen) != tt.wantSeen {
+			t.Errorf("%s: expected %d backend requests, got %v", tt.name, tt.wantSeen, seen)
+		}
+		for _, s := range seen {
+			if strings.Contains(s, "/") || (tt.tc.Mode == transcription.ModeConfidence) != strings.HasSuffix(s, "verbose_json") {
+				t.Errorf("%s: unexpected model or format sent: %q", tt.name, s)
+			}
+		}
+		mu.Unlock()
+	}
+}
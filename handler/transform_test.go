@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// transformCase is the input half of a golden-file test: the backends to route
+// between, the rest of the configuration, such as aliases, guardrails, API keys
+// and model families, and the request a client sends with the key of the
+// api_keys entry named Key, or the router key
+type transformCase struct {
+	Backends []model.BackendConfig `json:"backends"`
+	Config   model.Config          `json:"config"`
+	Key      string                `json:"key"`
+	Path     string                `json:"path"`
+	Request  json.RawMessage       `json:"request"`
+}
+
+// outgoingRequest is what a backend receives, recorded as the golden output
+type outgoingRequest struct {
+	Path string      `json:"path"`
+	Body interface{} `json:"body"`
+}
+
+// TestTransformGolden sends each testdata/transform/*.input.json request through
+// the router and compares the request received upstream with the matching
+// .golden.json file. Run with -update to regenerate the golden files.
+func TestTransformGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "transform", "*.input.json"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("No golden inputs found: %v", err)
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".input.json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("Failed to read input: %s", err)
+			}
+			var tc transformCase
+			if err := json.Unmarshal(data, &tc); err != nil {
+				t.Fatalf("Failed to parse input: %s", err)
+			}
+
+			got := runTransform(t, tc)
+			goldenFile := filepath.Join("testdata", "transform", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(goldenFile, got, 0644); err != nil {
+					t.Fatalf("Failed to write golden file: %s", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("Failed to read golden file (run with -update to create it): %s", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Outgoing request does not match %s\n--- got\n%s\n--- want\n%s", goldenFile, got, want)
+			}
+		})
+	}
+}
+
+// runTransform routes one request and returns the indented outgoing request.
+// Each backend's base URL is replaced with the capture server plus "/<name>"
+// so the recorded path shows which backend was chosen.
+func runTransform(t *testing.T, tc transformCase) []byte {
+	logger := zap.NewNop()
+
+	var captured outgoingRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured.Path = r.URL.Path
+		if err := utils.UnmarshalJSON(body, &captured.Body); err != nil {
+			captured.Body = string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{}`)
+	}))
+	defer upstream.Close()
+
+	for i := range tc.Backends {
+		tc.Backends[i].BaseURL = upstream.URL + "/" + tc.Backends[i].Name
+	}
+	cfg := &tc.Config
+	cfg.Backends, cfg.Logger, cfg.GlobalAPIKey = tc.Backends, logger, "router-key"
+	key := "router-key"
+	for i := range cfg.APIKeys {
+		cfg.APIKeys[i].Key = "key-" + cfg.APIKeys[i].Name
+		if cfg.APIKeys[i].Name == tc.Key {
+			key = cfg.APIKeys[i].Key
+		}
+	}
+	cfg.Router = proxy.NewRouter(cfg)
+
+	path := tc.Path
+	if path == "" {
+		path = "/v1/chat/completions"
+	}
+	req := httptest.NewRequest("POST", path, bytes.NewReader(tc.Request))
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	HandleRequest(cfg, rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	out, err := json.MarshalIndent(captured, "", "\t")
+	if err != nil {
+		t.Fatalf("Failed to encode outgoing request: %s", err)
+	}
+	return append(out, '\n')
+}
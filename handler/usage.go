@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/usage"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// handleUsage reports usage per key from the audit log, optionally between
+// two times or durations ago and broken down by day or month. Exact counts are
+// for operators; export applies the configured noise and bucketing for
+// dashboards shared externally.
+func handleUsage(w http.ResponseWriter, r *http.Request, cfg *model.Config, export bool) {
+	if cfg.AuditLog == nil {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "Usage reports need the audit log; set audit.path in the config"))
+		return
+	}
+
+	// Dates and calendar periods are in the configured time zone
+	loc := reportLocation(cfg)
+	now := time.Now().In(loc)
+	var q audit.Query
+	for _, bound := range []struct {
+		param string
+		t     *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := audit.ParseTime(value, now)
+		if err != nil {
+			utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "%s", err))
+			return
+		}
+		*bound.t = t
+	}
+	period := r.URL.Query().Get("period")
+	if period != "" && period != usage.PeriodDay && period != usage.PeriodMonth {
+		utils.WriteErr(w, utils.NewError(utils.ErrInvalidRequest, "period must be %s or %s", usage.PeriodDay, usage.PeriodMonth))
+		return
+	}
+	entries, err := audit.Read(cfg.Audit.Path, q)
+	if err != nil {
+		cfg.Logger.Error("Failed to read audit log", zap.Error(err))
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Failed to read the audit log"))
+		return
+	}
+
+	report := usage.Aggregate(entries)
+	if period != "" {
+		report = usage.AggregateBy(entries, period, loc)
+	}
+	if export {
+		report = usage.Privatize(report, cfg.UsageReport)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// reportLocation is the time zone of report dates and periods, the server's
+// unless one is configured
+func reportLocation(cfg *model.Config) *time.Location {
+	if cfg.Location != nil {
+		return cfg.Location
+	}
+	return time.Local
+}
@@ -0,0 +1,84 @@
+// Package history records the exchanges the router forwards so they can be
+// reviewed, labelled and exported, for example as a fine-tuning dataset for
+// the local models behind the router. Records are appended to JSON Lines
+// files in a directory: exchanges.jsonl and annotations.jsonl.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/kcolemangt/llm-router/migrate"
+)
+
+// Ratings an exchange can be annotated with
+const (
+	RatingGood = "good"
+	RatingBad  = "bad"
+)
+
+// Schema is the format history of a store's files. Add a migration whenever
+// the format of exchanges or annotations changes.
+var Schema = migrate.Schema{Name: "history"}
+
+// ErrNotFound is returned when annotating an exchange that was never recorded
+var ErrNotFound = errors.New("exchange not found")
+
+// Exchange is one recorded request and its response
+type Exchange struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	KeyID string    `json:"key_id"`
+	Model string    `json:"model"`
+	Path  string    `json:"path"`
+	// RequestHash is the canonical hash of the request body, as /router/hash
+	// computes it, empty for bodies that are not JSON
+	RequestHash string          `json:"request_hash,omitempty"`
+	Status      int             `json:"status"`
+	DurationMS  int64           `json:"duration_ms"`
+	Request     json.RawMessage `json:"request"`
+	Response    json.RawMessage `json:"response"`
+	Truncated   bool            `json:"truncated,omitempty"`
+	Annotation  *Annotation     `json:"annotation,omitempty"`
+}
+
+// Annotation labels an exchange. Annotating again replaces the earlier annotation.
+type Annotation struct {
+	ID     string    `json:"id"`
+	Rating string    `json:"rating,omitempty"`
+	Tags   []string  `json:"tags,omitempty"`
+	Note   string    `json:"note,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Filter selects exchanges to export. Empty fields match everything; every
+// tag must be present.
+type Filter struct {
+	Rating    string
+	Tags      []string
+	Annotated bool
+}
+
+// Match reports whether an exchange with annotation a passes the filter
+func (f Filter) Match(a *Annotation) bool {
+	if a == nil {
+		return !f.Annotated && f.Rating == "" && len(f.Tags) == 0
+	}
+	if f.Rating != "" && a.Rating != f.Rating {
+		return false
+	}
+	for _, tag := range f.Tags {
+		found := false
+		for _, t := range a.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+//go:build !nostorage && !minimal
+
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateAndExport(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %s", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Record(Exchange{ID: id, Request: json.RawMessage(`{}`), Response: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("Failed to record: %s", err)
+		}
+	}
+	store.Annotate(Annotation{ID: "a", Rating: RatingBad})
+	store.Annotate(Annotation{ID: "a", Rating: RatingGood, Tags: []string{"sql", "short"}})
+	store.Annotate(Annotation{ID: "b", Rating: RatingBad, Tags: []string{"sql"}})
+
+	if err := store.Annotate(Annotation{ID: "missing", Rating: RatingGood}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.Annotate(Annotation{ID: "c", Rating: "meh"}); err == nil {
+		t.Errorf("Expected an invalid rating to be rejected")
+	}
+	store.Close()
+
+	// Annotations survive reopening the store
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %s", err)
+	}
+	defer store.Close()
+
+	tests := []struct {
+		filter Filter
+		want   string
+	}{
+		{Filter{}, "a,b,c"},
+		{Filter{Annotated: true}, "a,b"},
+		{Filter{Rating: RatingGood}, "a"},
+		{Filter{Tags: []string{"sql"}}, "a,b"},
+		{Filter{Rating: RatingBad, Tags: []string{"short"}}, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		count, err := store.Export(&buf, tt.filter)
+		if err != nil {
+			t.Fatalf("Export failed: %s", err)
+		}
+		var ids []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var ex Exchange
+			if json.Unmarshal([]byte(line), &ex) == nil {
+				ids = append(ids, ex.ID)
+			}
+		}
+		if got := strings.Join(ids, ","); got != tt.want || count != len(ids) {
+			t.Errorf("Export(%+v) = %q (%d), want %q", tt.filter, got, count, tt.want)
+		}
+	}
+}
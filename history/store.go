@@ -0,0 +1,183 @@
+//go:build !nostorage && !minimal
+
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Available reports whether the store is built in
+const Available = true
+
+// Store appends exchanges and annotations to files in a directory
+type Store struct {
+	mu          sync.Mutex
+	dir         string
+	exchanges   *os.File
+	annotations *os.File
+	ids         map[string]bool
+	labels      map[string]Annotation
+}
+
+// Open opens or creates a store in dir
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, ids: make(map[string]bool), labels: make(map[string]Annotation)}
+
+	// Index what is already on disk
+	err := s.scan("exchanges.jsonl", func(line []byte) {
+		var ex struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(line, &ex) == nil {
+			s.ids[ex.ID] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.scan("annotations.jsonl", func(line []byte) {
+		var a Annotation
+		if json.Unmarshal(line, &a) == nil {
+			s.labels[a.ID] = a
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.exchanges, err = s.openAppend("exchanges.jsonl"); err != nil {
+		return nil, err
+	}
+	if s.annotations, err = s.openAppend("annotations.jsonl"); err != nil {
+		s.exchanges.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the store's files
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.exchanges.Close(), s.annotations.Close())
+}
+
+// Record appends an exchange
+func (s *Store) Record(ex Exchange) error {
+	ex.Annotation = nil
+	line, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.exchanges.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.ids[ex.ID] = true
+	return nil
+}
+
+// Annotate labels a recorded exchange
+func (s *Store) Annotate(a Annotation) error {
+	if a.Rating != "" && a.Rating != RatingGood && a.Rating != RatingBad {
+		return fmt.Errorf("rating must be %q or %q", RatingGood, RatingBad)
+	}
+	if a.Time.IsZero() {
+		a.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ids[a.ID] {
+		return ErrNotFound
+	}
+	if _, err := s.annotations.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.labels[a.ID] = a
+	return nil
+}
+
+// Export writes the exchanges matching filter to w as JSON Lines, each with
+// its annotation, and returns how many were written
+func (s *Store) Export(w io.Writer, filter Filter) (int, error) {
+	s.mu.Lock()
+	labels := make(map[string]Annotation, len(s.labels))
+	for id, a := range s.labels {
+		labels[id] = a
+	}
+	s.mu.Unlock()
+
+	count := 0
+	var writeErr error
+	err := s.scan("exchanges.jsonl", func(line []byte) {
+		var ex Exchange
+		if writeErr != nil || json.Unmarshal(line, &ex) != nil {
+			return
+		}
+		if a, ok := labels[ex.ID]; ok {
+			ex.Annotation = &a
+		}
+		if !filter.Match(ex.Annotation) {
+			return
+		}
+		out, err := json.Marshal(ex)
+		if err != nil {
+			return
+		}
+		if _, writeErr = w.Write(append(out, '\n')); writeErr == nil {
+			count++
+		}
+	})
+	if writeErr != nil {
+		return count, writeErr
+	}
+	return count, err
+}
+
+// scan calls fn with each line of a store file; a missing file has no lines
+func (s *Store) scan(name string, fn func(line []byte)) error {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 1 {
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Store) openAppend(name string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+}
@@ -0,0 +1,24 @@
+//go:build nostorage || minimal
+
+package history
+
+import (
+	"errors"
+	"io"
+)
+
+// Available reports whether the store is built in
+const Available = false
+
+var errNotBuiltIn = errors.New("history is not built in")
+
+// Store cannot be opened in builds without storage
+type Store struct{}
+
+// Open always fails
+func Open(dir string) (*Store, error) { return nil, errNotBuiltIn }
+
+func (s *Store) Close() error                                   { return errNotBuiltIn }
+func (s *Store) Record(ex Exchange) error                       { return errNotBuiltIn }
+func (s *Store) Annotate(a Annotation) error                    { return errNotBuiltIn }
+func (s *Store) Export(w io.Writer, filter Filter) (int, error) { return 0, errNotBuiltIn }
@@ -0,0 +1,192 @@
+// Package keyring keeps the router key in a state file so it survives
+// restarts, and rotates it with a grace window during which the previous key
+// still validates, so clients can be moved to the new key without an outage.
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// reloadInterval is how often the state file is checked for a rotation made
+// by another process, such as the keys subcommand
+const reloadInterval = time.Second
+
+// DefaultGrace is how long a replaced key stays valid unless told otherwise,
+// long enough to update clients over a working day
+const DefaultGrace = 24 * time.Hour
+
+// State is the content of the state file
+type State struct {
+	Key      string    `json:"key"`
+	Previous []Retired `json:"previous,omitempty"`
+}
+
+// Retired is a replaced key that is accepted until it expires
+type Retired struct {
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+// Ring is the router key and the retired keys still in their grace window,
+// backed by a state file
+type Ring struct {
+	path string
+
+	mu      sync.Mutex
+	state   State
+	modTime time.Time
+	checked time.Time
+}
+
+// Open reads the state file at path, creating it with a new random key if it
+// does not exist
+func Open(path string) (*Ring, error) {
+	ring := &Ring{path: path}
+	err := ring.load()
+	if errors.Is(err, os.ErrNotExist) {
+		ring.state = State{Key: NewKey()}
+		err = ring.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// NewKey returns a random router key
+func NewKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "sk-router-" + hex.EncodeToString(b)
+}
+
+// Current returns the key clients should use
+func (r *Ring) Current() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+	return r.state.Key
+}
+
+// Valid reports whether key is the current key or a retired one still in its
+// grace window
+func (r *Ring) Valid(key string) bool {
+	if key == "" {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+	if equal(key, r.state.Key) {
+		return true
+	}
+	now := time.Now()
+	for _, retired := range r.state.Previous {
+		if now.Before(retired.Expires) && equal(key, retired.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rotate replaces the key with a new random one and keeps accepting the
+// replaced key for grace. Retired keys past their window are dropped.
+func (r *Ring) Rotate(grace time.Duration) (State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(); err != nil {
+		return State{}, err
+	}
+
+	now := time.Now()
+	var previous []Retired
+	if grace > 0 {
+		previous = append(previous, Retired{Key: r.state.Key, Expires: now.Add(grace)})
+	}
+	for _, retired := range r.state.Previous {
+		if now.Before(retired.Expires) {
+			previous = append(previous, retired)
+		}
+	}
+	r.state = State{Key: NewKey(), Previous: previous}
+	if err := r.save(); err != nil {
+		return State{}, err
+	}
+	return r.state, nil
+}
+
+// refresh reloads the state file if it changed since it was read, checking at
+// most once per reloadInterval. A file that cannot be read keeps the keys
+// already loaded.
+func (r *Ring) refresh() {
+	now := time.Now()
+	if now.Sub(r.checked) < reloadInterval {
+		return
+	}
+	r.checked = now
+	if info, err := os.Stat(r.path); err == nil && !info.ModTime().Equal(r.modTime) {
+		r.load()
+	}
+}
+
+// load reads the state file
+func (r *Ring) load() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("parsing %s: %w", r.path, err)
+	}
+	if state.Key == "" {
+		return fmt.Errorf("%s has no key", r.path)
+	}
+	r.state, r.modTime = state, info.ModTime()
+	return nil
+}
+
+// save writes the state file atomically, readable only by its owner
+func (r *Ring) save() error {
+	data, err := json.MarshalIndent(r.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// equal compares keys in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
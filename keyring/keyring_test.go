@@ -0,0 +1,112 @@
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenPersistsKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ring, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ring.Current()
+	if key == "" {
+		t.Fatal("expected a generated key")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected a state file readable only by its owner, got %v, %v", info, err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Current() != key {
+		t.Errorf("expected the key to survive a restart, got %q and %q", key, reopened.Current())
+	}
+}
+
+func TestRotateKeepsPreviousKeyForGrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ring, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := ring.Current()
+
+	state, err := ring.Rotate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Key == old || ring.Current() != state.Key {
+		t.Fatalf("expected a new current key, got %q after %q", ring.Current(), old)
+	}
+	if !ring.Valid(old) || !ring.Valid(state.Key) {
+		t.Error("expected both keys to validate during the grace window")
+	}
+	if ring.Valid("sk-router-other") || ring.Valid("") {
+		t.Error("expected unknown keys to be rejected")
+	}
+
+	// Without a grace window the replaced key stops working at once
+	if _, err := ring.Rotate(0); err != nil {
+		t.Fatal(err)
+	}
+	if ring.Valid(state.Key) {
+		t.Error("expected the key replaced without grace to be rejected")
+	}
+	if !ring.Valid(old) {
+		t.Error("expected the earlier key to stay valid until its window ends")
+	}
+}
+
+func TestExpiredKeysAreRejectedAndDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ring, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := ring.Current()
+	if _, err := ring.Rotate(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if ring.Valid(old) {
+		t.Error("expected the key to be rejected after its grace window")
+	}
+	state, err := ring.Rotate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Previous) != 1 {
+		t.Errorf("expected expired keys to be dropped, got %d retired keys", len(state.Previous))
+	}
+}
+
+func TestRingPicksUpRotationByAnotherProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	running, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := cli.Rotate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the change visible past the reload interval and mtime granularity
+	running.checked = time.Time{}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if !running.Valid(state.Key) {
+		t.Error("expected the running ring to accept the rotated key")
+	}
+}
@@ -0,0 +1,164 @@
+// Package lockout bans client addresses that keep failing authentication for
+// a while, so scanners guessing keys against a public tunnel are turned away
+// cheaply instead of costing a full pass through the router each time.
+// Failures and bans are kept in a state store, so instances sharing one ban
+// an address together. Each tracker also remembers locally which addresses
+// failed through it and which were found not banned a moment ago, so the
+// requests of clients that authenticate cost no store round trips.
+package lockout
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/state"
+	"go.uber.org/zap"
+)
+
+// maxTracked bounds how many addresses a tracker with its own store
+// remembers, and how many a tracker remembers locally
+const maxTracked = 10000
+
+// recheck is how long an address found not banned is let through before the
+// store is asked again, and so how long a ban by another instance may take to
+// apply here
+const recheck = time.Second
+
+// Tracker counts failed attempts per address within a window starting at the
+// first failure and bans an address that reaches the threshold
+type Tracker struct {
+	threshold int
+	window    time.Duration
+	ban       time.Duration
+	store     state.Store
+	logger    *zap.Logger
+	recheck   time.Duration
+
+	mu sync.Mutex
+	// failed holds when the failure windows of the addresses that failed
+	// through this tracker end; only their failures need clearing
+	failed map[string]time.Time
+	// clear holds when addresses were last found not banned
+	clear map[string]time.Time
+}
+
+// New returns a tracker that bans an address for ban after threshold failures
+// within window, keeping them in its own memory
+func New(threshold int, window, ban time.Duration) *Tracker {
+	return NewShared(state.NewMemory(maxTracked), threshold, window, ban, zap.NewNop())
+}
+
+// NewShared returns a tracker keeping failures and bans in store. When the
+// store fails, addresses are let through and the error is logged.
+func NewShared(store state.Store, threshold int, window, ban time.Duration, logger *zap.Logger) *Tracker {
+	return &Tracker{threshold: threshold, window: window, ban: ban, store: store, logger: logger, recheck: recheck,
+		failed: make(map[string]time.Time), clear: make(map[string]time.Time)}
+}
+
+// Banned reports whether an address is banned and until when
+func (t *Tracker) Banned(addr string) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	now := time.Now()
+	t.mu.Lock()
+	checked, seen := t.clear[addr]
+	t.mu.Unlock()
+	if seen && now.Sub(checked) < t.recheck {
+		return time.Time{}, false
+	}
+
+	value, ok, err := t.store.Get(context.Background(), banKey(addr))
+	if err != nil {
+		t.logger.Warn("Failed to read lockout", zap.String("clientIP", addr), zap.Error(err))
+		return time.Time{}, false
+	}
+	var until time.Time
+	if ok {
+		ms, err := strconv.ParseInt(string(value), 10, 64)
+		if err == nil {
+			until = time.UnixMilli(ms)
+		}
+	}
+	if !now.Before(until) {
+		t.remember(t.clear, addr, now, now.Add(-t.recheck))
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// Fail records a failed attempt and returns the end of the ban it triggers,
+// if it is the one that reaches the threshold
+func (t *Tracker) Fail(addr string) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	if _, banned := t.Banned(addr); banned {
+		return time.Time{}, false
+	}
+	ctx := context.Background()
+	failures, err := t.store.Incr(ctx, failKey(addr), 1, t.window)
+	if err != nil {
+		t.logger.Warn("Failed to record failed attempt", zap.String("clientIP", addr), zap.Error(err))
+		return time.Time{}, false
+	}
+	t.remember(t.failed, addr, time.Now().Add(t.window), time.Now())
+	if failures < int64(t.threshold) {
+		return time.Time{}, false
+	}
+
+	until := time.Now().Add(t.ban)
+	t.mu.Lock()
+	delete(t.clear, addr)
+	t.mu.Unlock()
+	err = t.store.Set(ctx, banKey(addr), strconv.AppendInt(nil, until.UnixMilli(), 10), t.ban)
+	if err == nil {
+		err = t.store.Delete(ctx, failKey(addr))
+	}
+	if err != nil {
+		t.logger.Warn("Failed to record lockout", zap.String("clientIP", addr), zap.Error(err))
+	}
+	return until, true
+}
+
+// Succeed forgets the failures of an address that authenticated
+func (t *Tracker) Succeed(addr string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	_, failed := t.failed[addr]
+	delete(t.failed, addr)
+	t.mu.Unlock()
+	// Failures recorded through other instances expire with their window
+	if !failed {
+		return
+	}
+	if err := t.store.Delete(context.Background(), failKey(addr)); err != nil {
+		t.logger.Warn("Failed to clear failed attempts", zap.String("clientIP", addr), zap.Error(err))
+	}
+}
+
+// remember sets addr to at in one of the tracker's local maps. A full map
+// first drops the entries before stale, and is emptied if that frees nothing.
+func (t *Tracker) remember(m map[string]time.Time, addr string, at, stale time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := m[addr]; !ok && len(m) >= maxTracked {
+		for a, at := range m {
+			if at.Before(stale) {
+				delete(m, a)
+			}
+		}
+		if len(m) >= maxTracked {
+			clear(m)
+		}
+	}
+	m[addr] = at
+}
+
+func failKey(addr string) string { return "lockout:failures:" + addr }
+
+func banKey(addr string) string { return "lockout:ban:" + addr }
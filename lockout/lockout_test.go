@@ -0,0 +1,111 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/state"
+	"go.uber.org/zap"
+)
+
+func TestLockout(t *testing.T) {
+	tracker := New(3, time.Minute, 50*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, banned := tracker.Fail("203.0.113.7"); banned {
+			t.Fatalf("Banned after %d failures", i+1)
+		}
+	}
+	until, banned := tracker.Fail("203.0.113.7")
+	if !banned || time.Until(until) <= 0 {
+		t.Fatalf("Expected a ban on the third failure")
+	}
+	if _, banned := tracker.Banned("203.0.113.7"); !banned {
+		t.Errorf("Expected the address to be banned")
+	}
+	if _, banned := tracker.Banned("198.51.100.1"); banned {
+		t.Errorf("Expected other addresses not to be banned")
+	}
+	// Failing again during a ban neither extends it nor reports it again
+	if _, again := tracker.Fail("203.0.113.7"); again {
+		t.Errorf("Expected a failure during the ban not to start another")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, banned := tracker.Banned("203.0.113.7"); banned {
+		t.Errorf("Expected the ban to expire")
+	}
+	if _, banned := tracker.Fail("203.0.113.7"); banned {
+		t.Errorf("Expected the count to start over after a ban")
+	}
+}
+
+func TestLockoutWindowAndSuccess(t *testing.T) {
+	tracker := New(2, 20*time.Millisecond, time.Minute)
+	tracker.Fail("a")
+	time.Sleep(30 * time.Millisecond)
+	if _, banned := tracker.Fail("a"); banned {
+		t.Errorf("Expected failures outside the window not to count")
+	}
+
+	tracker.Succeed("a")
+	if _, banned := tracker.Fail("a"); banned {
+		t.Errorf("Expected a success to forget earlier failures")
+	}
+
+	var none *Tracker
+	if _, banned := none.Fail("a"); banned {
+		t.Errorf("Expected a nil tracker never to ban")
+	}
+}
+
+func TestLockoutShared(t *testing.T) {
+	// Two instances sharing a store count an address's failures together
+	store := state.NewMemory(100)
+	a := NewShared(store, 2, time.Minute, time.Minute, zap.NewNop())
+	b := NewShared(store, 2, time.Minute, time.Minute, zap.NewNop())
+	// Ask the store every time instead of after a second
+	a.recheck = 0
+	a.Fail("203.0.113.7")
+	if _, banned := b.Fail("203.0.113.7"); !banned {
+		t.Fatalf("Expected the second failure on another instance to ban")
+	}
+	if _, banned := a.Banned("203.0.113.7"); !banned {
+		t.Errorf("Expected the ban to be seen by every instance")
+	}
+}
+
+// countingStore counts the calls that would be round trips to a remote store
+type countingStore struct {
+	*state.Memory
+	gets, deletes int
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.gets++
+	return s.Memory.Get(ctx, key)
+}
+
+func (s *countingStore) Delete(ctx context.Context, key string) error {
+	s.deletes++
+	return s.Memory.Delete(ctx, key)
+}
+
+func TestAuthenticatedClientsCostNoRoundTrips(t *testing.T) {
+	store := &countingStore{Memory: state.NewMemory(100)}
+	tracker := NewShared(store, 3, time.Minute, time.Minute, zap.NewNop())
+	for i := 0; i < 5; i++ {
+		tracker.Banned("198.51.100.1")
+		tracker.Succeed("198.51.100.1")
+	}
+	if store.gets != 1 || store.deletes != 0 {
+		t.Errorf("Expected one lookup and no deletes, got %d and %d", store.gets, store.deletes)
+	}
+
+	tracker.Fail("203.0.113.7")
+	tracker.Succeed("203.0.113.7")
+	tracker.Succeed("203.0.113.7")
+	if store.deletes != 1 {
+		t.Errorf("Expected the failures to be cleared once, got %d deletes", store.deletes)
+	}
+}
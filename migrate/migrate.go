@@ -0,0 +1,198 @@
+// Package migrate upgrades the files the router keeps between runs, such as
+// the history and the audit log, when a new version changes their format.
+// Each store records its format version in a marker beside its data, so an
+// upgrade applies only the migrations it is missing, and a store written by a
+// newer router is refused rather than misread.
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Migration upgrades a store to Version from the version before it
+type Migration struct {
+	Version     int
+	Description string
+	// Apply rewrites the store at path; it must leave the store intact if it fails
+	Apply func(path string) error
+}
+
+// Schema is the format history of one kind of store. Version 1 is the format
+// stores had before they were versioned; Migrations lead from it, in order.
+type Schema struct {
+	Name       string
+	Migrations []Migration
+}
+
+// Latest is the version the router writes
+func (s Schema) Latest() int {
+	if len(s.Migrations) == 0 {
+		return 1
+	}
+	return s.Migrations[len(s.Migrations)-1].Version
+}
+
+// Version returns the version of the store at path: 0 if it does not exist,
+// and 1 if it has data but no marker
+func Version(path string) (int, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(markerPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid version marker %s", markerPath(path))
+	}
+	return version, nil
+}
+
+// Pending returns the migrations the store at path is missing. A store newer
+// than the schema is an error; a store that does not exist needs none.
+func (s Schema) Pending(path string) ([]Migration, error) {
+	version, err := Version(path)
+	if err != nil {
+		return nil, err
+	}
+	if version > s.Latest() {
+		return nil, fmt.Errorf("%s %s has format version %d, but this router only knows up to %d; upgrade the router",
+			s.Name, path, version, s.Latest())
+	}
+	var pending []Migration
+	for _, m := range s.Migrations {
+		if m.Version > version && version > 0 {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Upgrade applies the migrations the store at path is missing, recording the
+// version after each so an interrupted upgrade resumes where it stopped, and
+// returns the ones it applied
+func (s Schema) Upgrade(path string) ([]Migration, error) {
+	pending, err := s.Pending(path)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, m := range pending {
+		if err := m.Apply(path); err != nil {
+			return applied, fmt.Errorf("%s migration to version %d (%s): %w", s.Name, m.Version, m.Description, err)
+		}
+		if err := writeMarker(path, m.Version); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// Stamp records the latest version for a store that has no marker yet, such
+// as one just created. Stores are upgraded before they are opened and stamped
+// after, so a new store is never mistaken for version 1.
+func (s Schema) Stamp(path string) error {
+	if _, err := os.Stat(markerPath(path)); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return writeMarker(path, s.Latest())
+}
+
+// markerPath is where the version of the store at path is recorded: a file
+// inside a directory store, or next to a file store
+func markerPath(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, ".version")
+	}
+	return path + ".version"
+}
+
+func writeMarker(path string, version int) error {
+	return writeAtomic(markerPath(path), func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%d\n", version)
+		return err
+	})
+}
+
+// RewriteLines passes every line of a JSON Lines file through fn and replaces
+// the file with the result in one step, so a failure leaves the original. fn
+// returns nil to drop a line.
+func RewriteLines(path string, fn func(line []byte) ([]byte, error)) error {
+	in, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeAtomic(path, func(w io.Writer) error {
+		reader := bufio.NewReader(in)
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if line = bytes.TrimRight(line, "\n"); len(line) > 0 {
+				out, err := fn(line)
+				if err != nil {
+					return err
+				}
+				if out != nil {
+					if _, err := w.Write(append(out, '\n')); err != nil {
+						return err
+					}
+				}
+			}
+			if readErr == io.EOF {
+				return nil
+			}
+			if readErr != nil {
+				return readErr
+			}
+		}
+	})
+}
+
+// writeAtomic writes a file through a temporary file in the same directory,
+// keeping the mode of the file it replaces
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(path, []byte("{\"a\":1}\n{\"a\":2}\n"), 0600)
+
+	var ran []int
+	schema := Schema{Name: "test", Migrations: []Migration{
+		{Version: 2, Description: "rename a to b", Apply: func(path string) error {
+			ran = append(ran, 2)
+			return RewriteLines(path, func(line []byte) ([]byte, error) {
+				return bytes.Replace(line, []byte(`"a"`), []byte(`"b"`), 1), nil
+			})
+		}},
+		{Version: 3, Description: "drop the first entry", Apply: func(path string) error {
+			ran = append(ran, 3)
+			return RewriteLines(path, func(line []byte) ([]byte, error) {
+				if bytes.Contains(line, []byte(":1")) {
+					return nil, nil
+				}
+				return line, nil
+			})
+		}},
+	}}
+
+	if version, _ := Version(path); version != 1 {
+		t.Errorf("Expected a store without a marker to be version 1, got %d", version)
+	}
+	applied, err := schema.Upgrade(path)
+	if err != nil || len(applied) != 2 || len(ran) != 2 {
+		t.Fatalf("Expected both migrations to run, got %v %v", applied, err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "{\"b\":2}\n" {
+		t.Errorf("Unexpected migrated data %q", data)
+	}
+	if version, _ := Version(path); version != 3 {
+		t.Errorf("Expected version 3, got %d", version)
+	}
+
+	// Nothing is left to do, and the store can be stamped again harmlessly
+	if applied, err := schema.Upgrade(path); err != nil || len(applied) != 0 || len(ran) != 2 {
+		t.Errorf("Expected no migrations to run again, got %v %v", applied, err)
+	}
+	if err := schema.Stamp(path); err != nil {
+		t.Errorf("Unexpected error stamping: %s", err)
+	}
+
+	// A store written by a newer router is refused
+	older := Schema{Name: "test", Migrations: schema.Migrations[:1]}
+	if _, err := older.Upgrade(path); err == nil || !strings.Contains(err.Error(), "upgrade the router") {
+		t.Errorf("Expected a newer store to be refused, got %v", err)
+	}
+}
+
+func TestFailedMigrationKeepsData(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history")
+	os.Mkdir(path, 0755)
+	file := filepath.Join(path, "exchanges.jsonl")
+	os.WriteFile(file, []byte("{\"id\":\"x\"}\n"), 0600)
+
+	schema := Schema{Name: "test", Migrations: []Migration{
+		{Version: 2, Description: "fail halfway", Apply: func(string) error {
+			return RewriteLines(file, func([]byte) ([]byte, error) { return nil, errors.New("boom") })
+		}},
+	}}
+	if _, err := schema.Upgrade(path); err == nil {
+		t.Fatalf("Expected the migration to fail")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "{\"id\":\"x\"}\n" {
+		t.Errorf("Expected the data to be left intact, got %q", data)
+	}
+	if version, _ := Version(path); version != 1 {
+		t.Errorf("Expected the version to stay 1, got %d", version)
+	}
+	if entries, _ := os.ReadDir(path); len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %v", entries)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	schema := Schema{Name: "test", Migrations: []Migration{{Version: 2, Apply: func(string) error {
+		t.Errorf("Expected no migration for a store that does not exist")
+		return nil
+	}}}}
+	if applied, err := schema.Upgrade(path); err != nil || len(applied) != 0 {
+		t.Errorf("Unexpected upgrade of a missing store: %v %v", applied, err)
+	}
+
+	// Once created, the store is stamped with the latest version
+	os.Mkdir(path, 0755)
+	if err := schema.Stamp(path); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := Version(path); version != 2 {
+		t.Errorf("Expected a new store to be version 2, got %d", version)
+	}
+}
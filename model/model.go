@@ -1,15 +1,535 @@
 package model
 
-import "go.uber.org/zap"
+import (
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/assistants"
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/batch"
+	"github.com/kcolemangt/llm-router/capture"
+	"github.com/kcolemangt/llm-router/clientip"
+	"github.com/kcolemangt/llm-router/history"
+	"github.com/kcolemangt/llm-router/keyring"
+	"github.com/kcolemangt/llm-router/lockout"
+	"github.com/kcolemangt/llm-router/oidc"
+	"github.com/kcolemangt/llm-router/postcondition"
+	"github.com/kcolemangt/llm-router/resume"
+	"github.com/kcolemangt/llm-router/semcache"
+	"github.com/kcolemangt/llm-router/state"
+	"github.com/kcolemangt/llm-router/summary"
+	"github.com/kcolemangt/llm-router/synthetic"
+	"github.com/kcolemangt/llm-router/tokenizer"
+	"go.uber.org/zap"
+)
 
 // BackendConfig defines the structure for backend configuration
 type BackendConfig struct {
-	Name          string `json:"name"`
-	BaseURL       string `json:"base_url"`
-	Prefix        string `json:"prefix"`
-	Default       bool   `json:"default"`
-	RequireAPIKey bool   `json:"require_api_key"`
-	KeyEnvVar     string `json:"key_env_var"`
+	Name              string                `json:"name"`
+	BaseURL           string                `json:"base_url"`
+	Instances         []string              `json:"instances"`
+	LoadBalancing     string                `json:"load_balancing"`
+	StickyHeader      string                `json:"sticky_header"`
+	Prefix            string                `json:"prefix"`
+	Default           bool                  `json:"default"`
+	RequireAPIKey     bool                  `json:"require_api_key"`
+	KeyEnvVar         string                `json:"key_env_var"`
+	MaxConcurrent     int                   `json:"max_concurrent"`
+	MaxQueue          int                   `json:"max_queue"`
+	QueueTimeout      int                   `json:"queue_timeout_seconds"`
+	StallTimeout      int                   `json:"client_stall_timeout_seconds"`
+	Heartbeat         int                   `json:"heartbeat_seconds"`
+	SetHeaders        map[string]string     `json:"set_headers"`
+	RemoveHeaders     []string              `json:"remove_headers"`
+	PassHeaders       []string              `json:"pass_headers"`
+	OpenAIOrg         string                `json:"openai_organization"`
+	OpenAIProject     string                `json:"openai_project"`
+	StripParams       []string              `json:"strip_params"`
+	ParamLimits       map[string]ParamLimit `json:"param_limits"`
+	ParamRenames      map[string]string     `json:"param_renames"`
+	EmulateJSONSchema bool                  `json:"emulate_json_schema"`
+	ImageMode         string                `json:"image_mode"`
+	MaxImageDimension int                   `json:"max_image_dimension"`
+	Hooks             HookConfig            `json:"hooks"`
+	ModelFallback     string                `json:"model_fallback"`
+	ModelNearestMatch bool                  `json:"model_nearest_match"`
+	Transport         TransportConfig       `json:"transport"`
+	Voices            map[string]string     `json:"voices"`
+	PathRewrite       map[string]string     `json:"path_rewrite"`
+	AutoDetect        bool                  `json:"auto_detect"`
+	Assistants        bool                  `json:"assistants"`
+	Preset            string                `json:"preset"`
+	Guardrails        []string              `json:"guardrails"`
+	RateLimits        RateLimitConfig       `json:"rate_limits"`
+	ProbeCapabilities bool                  `json:"probe_capabilities"`
+	Discovery         DiscoveryConfig       `json:"discovery"`
+	PullMissing       PullConfig            `json:"pull_missing"`
+	KeepWarm          KeepWarmConfig        `json:"keep_warm"`
+	ModelFamily       string                `json:"model_family"`
+	StripThinking     bool                  `json:"strip_thinking"`
+}
+
+// DiscoveryConfig polls an Ollama backend's installed models every
+// IntervalSeconds, listing them in /v1/models under the backend's prefix.
+// Aliases routes each model's bare name, and its name without :latest, to it
+// when no other discovering backend has a model of that name.
+type DiscoveryConfig struct {
+	IntervalSeconds int  `json:"interval_seconds"`
+	Aliases         bool `json:"aliases"`
+}
+
+// PullConfig has an Ollama backend pull the models matching Models that it
+// does not have when they are asked for, then sends the request again.
+// Streaming requests wait, with the pull's progress sent as SSE comments;
+// others are answered 425 Too Early while the pull runs. TimeoutSeconds bounds
+// a pull, 30 minutes if 0.
+type PullConfig struct {
+	Models         []string `json:"models"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+// KeepWarmConfig keeps a backend's Models loaded, sending each a request at
+// startup and every IntervalSeconds, 4 minutes if 0. With KeepAlive, an
+// Ollama duration such as "30m", or seconds with -1 meaning for ever, Ollama
+// is asked to load each model and keep it that long; otherwise each model is
+// sent a one-token chat completion. With a Schedule, models are only kept
+// warm during its windows, and Ollama is asked to unload them outside.
+type KeepWarmConfig struct {
+	Models          []string         `json:"models"`
+	IntervalSeconds int              `json:"interval_seconds"`
+	KeepAlive       string           `json:"keep_alive"`
+	Schedule        []KeepWarmWindow `json:"schedule"`
+}
+
+// KeepWarmWindow is a time of the week, in the configured time zone, when
+// models are kept warm. Days is a cron-like list such as "mon-fri" or
+// "sat,sun", every day if empty. Start and End are times of day such as
+// "09:00" and "18:00"; a window ending before it starts runs past midnight.
+type KeepWarmWindow struct {
+	Days  string `json:"days"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// RateLimitConfig handles a backend's rate limits. Responses with status 429
+// or 5xx that carry Retry-After are held and the request retried while the
+// waits fit in RetryBudget seconds; otherwise they reach the client as they
+// are. Pace reads the provider's x-ratelimit headers and holds requests once
+// the remaining requests or tokens run out, until they reset.
+type RateLimitConfig struct {
+	RetryBudget int  `json:"retry_budget_seconds"`
+	Pace        bool `json:"pace"`
+}
+
+// TransportConfig tunes the connections to a backend. Protocol is auto
+// (HTTP/2 when TLS negotiates it), http1 or http2, which speaks HTTP/2 only:
+// over TLS for https URLs and as h2c for http URLs. Proxy is an outbound proxy
+// URL, or "direct" to ignore the proxy environment variables. CAFile adds PEM
+// certificates to the system trust store. Zero values keep Go's defaults.
+type TransportConfig struct {
+	Protocol            string `json:"protocol"`
+	MaxIdleConnsPerHost int    `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int    `json:"max_conns_per_host"`
+	IdleConnTimeout     int    `json:"idle_conn_timeout_seconds"`
+	DisableKeepAlives   bool   `json:"disable_keep_alives"`
+	KeepAlive           int    `json:"tcp_keep_alive_seconds"`
+	DialTimeout         int    `json:"dial_timeout_seconds"`
+	Proxy               string `json:"proxy"`
+	CAFile              string `json:"ca_file"`
+	InsecureSkipVerify  bool   `json:"insecure_skip_verify"`
+}
+
+// HookConfig sends request and response bodies to an external service that may
+// rewrite or reject them
+type HookConfig struct {
+	RequestURL  string `json:"request_url"`
+	ResponseURL string `json:"response_url"`
+	Timeout     int    `json:"timeout_seconds"`
+	FailOpen    bool   `json:"fail_open"`
+}
+
+// ModelFamilyConfig describes how the API of a family of models differs from
+// what clients send. Requests for models matching Models lose StripParams, and
+// reasoning_effort if ReasoningEffort is false, have ParamRenames applied, and
+// their system or developer messages given InstructionRole, after the backend's
+// own parameter adjustments. ThinkTags marks families answering with their
+// reasoning in <think> blocks, which backends with StripThinking remove, and
+// ThinkOpened those whose chat template opens the block in the prompt.
+type ModelFamilyConfig struct {
+	Name            string            `json:"name"`
+	Models          []string          `json:"models"`
+	StripParams     []string          `json:"strip_params"`
+	ParamRenames    map[string]string `json:"param_renames"`
+	InstructionRole string            `json:"instruction_role"`
+	ReasoningEffort *bool             `json:"reasoning_effort"`
+	ThinkTags       bool              `json:"think_tags"`
+	ThinkOpened     bool              `json:"think_opened"`
+}
+
+// ParamLimit bounds a numeric request parameter; either side may be omitted
+type ParamLimit struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// RoutingRule routes chat completions to a backend when its expression evaluates to true
+type RoutingRule struct {
+	When    string `json:"when"`
+	Backend string `json:"backend"`
+	Model   string `json:"model"`
+}
+
+// RedactionConfig scrubs sensitive data from request bodies before they leave
+// the router and from log output
+type RedactionConfig struct {
+	Detectors []string           `json:"detectors"`
+	Patterns  []RedactionPattern `json:"patterns"`
+	Requests  bool               `json:"requests"`
+	Logs      bool               `json:"logs"`
+}
+
+// RedactionPattern is a named regular expression whose matches are redacted
+type RedactionPattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+}
+
+// AuditConfig enables the persistent audit log of served requests
+type AuditConfig struct {
+	Path   string `json:"path"`
+	Bodies bool   `json:"bodies"`
+}
+
+// AuthConfig relaxes authentication for paths clients and monitors reach
+// without a key. The zero value requires the key on every request.
+type AuthConfig struct {
+	// ExemptOptions answers CORS preflight requests, which browsers send without credentials
+	ExemptOptions bool `json:"exempt_options"`
+	// PublicHealth serves /healthz without a key
+	PublicHealth bool `json:"public_healthz"`
+	// PublicInfo serves /router/info without a key, and lets /router/ping
+	// report the version and backend latencies to clients without one
+	PublicInfo bool `json:"public_info"`
+	// Hint points unauthenticated clients at the setup documentation
+	Hint bool `json:"hint"`
+	// Disabled serves every request without a key; only allowed on loopback listeners
+	Disabled bool `json:"disabled"`
+}
+
+// NetworkConfig filters clients by address. TrustedProxies are the tunnels
+// and reverse proxies whose X-Forwarded-For header names the real client.
+// Allow, if set, admits only the addresses it lists; Deny refuses addresses.
+// Entries are CIDRs or single addresses.
+type NetworkConfig struct {
+	Allow          []string `json:"allow"`
+	Deny           []string `json:"deny"`
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// StateConfig chooses where state that router instances share, lockouts and
+// key limits, is kept: in this process with Driver "memory" (the default), in
+// this process and the file at Path with Driver "file", or on the Redis
+// server at Address with Driver "redis", logging in with the password in
+// PasswordEnv and selecting database DB. Redis keys start with Prefix,
+// "llm-router:" by default.
+type StateConfig struct {
+	Driver      string `json:"driver"`
+	Path        string `json:"path"`
+	Address     string `json:"address"`
+	PasswordEnv string `json:"password_env"`
+	DB          int    `json:"db"`
+	Prefix      string `json:"prefix"`
+}
+
+// LockoutConfig bans client addresses that fail authentication Threshold
+// times within WindowSeconds (10 minutes by default) for BanSeconds (15
+// minutes by default). A zero threshold disables lockouts.
+type LockoutConfig struct {
+	Threshold     int `json:"threshold"`
+	WindowSeconds int `json:"window_seconds"`
+	BanSeconds    int `json:"ban_seconds"`
+}
+
+// JWTConfig accepts JSON Web Tokens from an OpenID Connect provider as client
+// keys. IdentityClaim identifies the client, "sub" by default. KeyClaim names a
+// claim whose value, or one of whose values, names the api_keys entry whose
+// policies apply; RequireKey refuses tokens that map to none.
+type JWTConfig struct {
+	Issuer        string `json:"issuer"`
+	Audience      string `json:"audience"`
+	JWKSURL       string `json:"jwks_url"`
+	IdentityClaim string `json:"identity_claim"`
+	KeyClaim      string `json:"key_claim"`
+	RequireKey    bool   `json:"require_key"`
+}
+
+// APIKeyConfig is a named client key accepted for the API besides the router
+// key. The key itself is read from the environment variable KeyEnv. FineTuning
+// permits the key to use the fine-tuning API. Backend pins the key to the named
+// backend, whatever the model's prefix. Backends and Models, when set, are the
+// only backends and model globs the key may use. ClientCert is the common name
+// or subject alternative name of a verified client certificate that presents
+// the key; a key with both must be sent over a connection with that certificate.
+// RequestsPerMinute limits the key's API requests, and BudgetUSD what its
+// priced requests may cost per BudgetPeriod, a calendar "day" (the default) or
+// "month". Both are counted in the state store, so routers sharing one enforce
+// them together.
+type APIKeyConfig struct {
+	Name       string   `json:"name"`
+	KeyEnv     string   `json:"key_env"`
+	Key        string   `json:"-"`
+	FineTuning bool     `json:"fine_tuning"`
+	Backend    string   `json:"backend"`
+	Backends   []string `json:"backends"`
+	Models     []string `json:"models"`
+	ClientCert string   `json:"client_cert"`
+	Guardrails []string `json:"guardrails"`
+
+	RequestsPerMinute int     `json:"requests_per_minute"`
+	BudgetUSD         float64 `json:"budget_usd"`
+	BudgetPeriod      string  `json:"budget_period"`
+}
+
+// Groups of endpoints a listener can serve
+const (
+	// ServeAPI is the OpenAI-compatible API with /router/info and /router/hash
+	ServeAPI = "api"
+	// ServeAdmin is /router/events and /router/history/
+	ServeAdmin = "admin"
+	// ServeMetrics is /router/errors and /router/usage
+	ServeMetrics = "metrics"
+	// ServeHealth is /healthz
+	ServeHealth = "health"
+)
+
+// ListenerConfig is one address the router listens on, serving only the
+// endpoint groups in Serve (all of them if empty). Auth replaces the global
+// auth settings on this listener if set. TLS serves HTTPS instead of HTTP.
+type ListenerConfig struct {
+	Address string             `json:"address"`
+	Serve   []string           `json:"serve"`
+	Auth    *AuthConfig        `json:"auth"`
+	TLS     *ListenerTLSConfig `json:"tls"`
+}
+
+// Client certificate policies of a TLS listener
+const (
+	ClientCertsRequired = "required"
+	ClientCertsOptional = "optional"
+)
+
+// ListenerTLSConfig is the certificate a listener serves and the CA bundle
+// client certificates are verified against. ClientCerts is required, the
+// default with a CA bundle, or optional, which verifies certificates that
+// clients present but lets the others authenticate with a key.
+type ListenerTLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"`
+	ClientCerts  string `json:"client_certs"`
+}
+
+// ReportConfig posts a usage summary from the audit log to WebhookURL every
+// day or every Monday, as Schedule daily or weekly says. Summaries are sent
+// at Hour o'clock in the configured time zone and cover the day or week just
+// ended, as json, csv or markdown.
+type ReportConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	Schedule   string `json:"schedule"`
+	Hour       int    `json:"hour"`
+	Format     string `json:"format"`
+}
+
+// UsageReportConfig controls how per-key usage is privatized for external
+// dashboards. Epsilon is the privacy budget of each count; smaller values add
+// more noise. TokenSensitivity is the most tokens one request is assumed to
+// add, 4096 if unset. Bucket rounds counts to a multiple of itself. The noise
+// is derived from Secret, read from the variable SecretEnv names, so routers
+// sharing it add the same noise to the same counts.
+type UsageReportConfig struct {
+	Epsilon          float64 `json:"epsilon"`
+	TokenSensitivity int     `json:"token_sensitivity"`
+	Bucket           int     `json:"bucket"`
+	SecretEnv        string  `json:"secret_env"`
+	Secret           string  `json:"-"`
+}
+
+// TokenizerConfig selects a tokenizer for the models matching its globs, such
+// as "openai/gpt-4o*". Type is tiktoken, huggingface or heuristic; Path is the
+// tiktoken rank file or tokenizer.json, and Pattern overrides the tiktoken
+// pre-tokenization pattern.
+type TokenizerConfig struct {
+	Models  []string `json:"models"`
+	Type    string   `json:"type"`
+	Path    string   `json:"path"`
+	Pattern string   `json:"pattern"`
+}
+
+// ContextWindowConfig sets the context window, in tokens, of the models
+// matching its globs. Requests whose messages and requested output exceed it
+// are refused, or with Truncate lose their oldest messages until they fit.
+type ContextWindowConfig struct {
+	Models   []string `json:"models"`
+	Tokens   int      `json:"tokens"`
+	Truncate bool     `json:"truncate"`
+}
+
+// ModelCapabilityConfig declares what the models matching its globs support.
+// Unset capabilities are not checked. Requests using a capability a model lacks
+// are refused, or with Adapt changed to do without it. MaxContext is the
+// context window of models without a ContextWindowConfig.
+type ModelCapabilityConfig struct {
+	Models     []string `json:"models"`
+	Tools      *bool    `json:"tools"`
+	Vision     *bool    `json:"vision"`
+	JSONMode   *bool    `json:"json_mode"`
+	Streaming  *bool    `json:"streaming"`
+	MaxContext int      `json:"max_context"`
+	Adapt      bool     `json:"adapt"`
+}
+
+// SemanticCacheConfig answers non-streaming chat completions for the models
+// matching its globs from a cache, when the embedding of the prompt by
+// EmbeddingModel is at least Threshold similar to one answered before
+type SemanticCacheConfig struct {
+	Models         []string `json:"models"`
+	EmbeddingModel string   `json:"embedding_model"`
+	Threshold      float64  `json:"threshold"`
+	TTLSeconds     int      `json:"ttl_seconds"`
+	MaxEntries     int      `json:"max_entries"`
+}
+
+// BatchConfig emulates the Batch API. Batch input files and results are kept
+// in Dir, and each batch sends Concurrency of its requests at a time.
+type BatchConfig struct {
+	Dir         string `json:"dir"`
+	Concurrency int    `json:"concurrency"`
+}
+
+// ModerationConfig checks prompts for the models matching Models, or every
+// model, with a moderation model before they are sent. Prompts flagged in a
+// Block category are refused and those flagged in a Flag category are logged.
+type ModerationConfig struct {
+	Model    string   `json:"model"`
+	Models   []string `json:"models"`
+	Block    []string `json:"block"`
+	Flag     []string `json:"flag"`
+	FailOpen bool     `json:"fail_open"`
+}
+
+// GuardrailConfig is text the router adds to every prompt sent with an API key
+// or to a backend naming it, so clients cannot leave it out. SystemPrompt is
+// sent before the client's messages as a system message, and Prefix and
+// Suffix are added around the latest user message.
+type GuardrailConfig struct {
+	SystemPrompt string `json:"system_prompt"`
+	Prefix       string `json:"prefix"`
+	Suffix       string `json:"suffix"`
+}
+
+// CompressionConfig shortens long conversations with the models matching its
+// globs. Once the messages exceed ThresholdTokens, all but the system
+// messages and the KeepRecent latest are replaced by a summary written by
+// SummaryModel, which should be small and cheap.
+type CompressionConfig struct {
+	Models          []string `json:"models"`
+	ThresholdTokens int      `json:"threshold_tokens"`
+	KeepRecent      int      `json:"keep_recent"`
+	SummaryModel    string   `json:"summary_model"`
+}
+
+// PostConditionConfig sets requirements on the answers of the models matching
+// its globs. An answer that violates them is retried once with corrective
+// instructions. MaxLength counts characters, JSON requires the answer to be a
+// JSON value, and MustMatch is a regular expression the answer must contain.
+type PostConditionConfig struct {
+	Models    []string `json:"models"`
+	MaxLength int      `json:"max_length"`
+	JSON      bool     `json:"json"`
+	MustMatch string   `json:"must_match"`
+}
+
+// TranscriptionConfig sends /v1/audio/transcriptions requests to several
+// models at once, such as a local whisper.cpp and OpenAI's whisper-1. Mode
+// first returns the first model's transcript unless it fails; mode confidence
+// returns the transcript with the highest confidence. Audio files larger than
+// LargeFileBytes go only to LargeFileModel.
+type TranscriptionConfig struct {
+	Models         []string `json:"models"`
+	Mode           string   `json:"mode"`
+	LargeFileBytes int64    `json:"large_file_bytes"`
+	LargeFileModel string   `json:"large_file_model"`
+}
+
+// SyntheticModelConfig is a model the router answers itself. Rules are tried
+// in order against the last user message and the first whose regular
+// expression matches gives the response; Response is used if none does.
+// Responses are Go templates.
+type SyntheticModelConfig struct {
+	Name     string          `json:"name"`
+	Response string          `json:"response"`
+	Rules    []SyntheticRule `json:"rules"`
+}
+
+// SyntheticRule answers with Response when Match matches the last user message
+type SyntheticRule struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+}
+
+// ModelAlias maps a model name clients use to one or more models. Requests go
+// to the first model unless Race is set, in which case non-streaming requests
+// are sent to all of them and the first successful response wins. Otherwise
+// RoutePolicy, if set, chooses the model for each request: priority,
+// cheapest or fastest.
+type ModelAlias struct {
+	Models      []string `json:"models"`
+	Race        bool     `json:"race"`
+	RoutePolicy string   `json:"route_policy"`
+}
+
+// ModelPrice is what a model costs in US dollars per 1,000 tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns what a request with the given token counts costs in US dollars
+func (p ModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (p.Input*float64(promptTokens) + p.Output*float64(completionTokens)) / 1000
+}
+
+// LimitsConfig bounds the copies the router keeps of traffic for its own
+// use. They never limit what clients receive. Zero keeps the default.
+type LimitsConfig struct {
+	// RecordedResponseBytes is how much of a response history and the audit log keep, 4 MiB by default
+	RecordedResponseBytes int `json:"recorded_response_bytes"`
+	// ErrorPeekBytes is how much of an error response is read to classify it, 64 KiB by default
+	ErrorPeekBytes int `json:"error_peek_bytes"`
+	// StreamLineBytes is the longest event stream line counted for progress, 1 MiB by default
+	StreamLineBytes int `json:"stream_line_bytes"`
+}
+
+// StreamResumeConfig keeps streamed responses so clients can resume them with
+// Last-Event-ID. RetentionSeconds is how long a finished stream is kept, five
+// minutes by default.
+type StreamResumeConfig struct {
+	Enabled          bool `json:"enabled"`
+	RetentionSeconds int  `json:"retention_seconds"`
+}
+
+// PriorityClass orders requests waiting for a backend's concurrency slots. A
+// request is in the first class naming its API key in Keys or matching its
+// model with a glob in Models, or else in a default class of priority 0.
+// Higher priorities are served first and may push lower ones out of a full
+// queue. Shed refuses the class's requests at once when the backend is busy
+// instead of queueing them.
+type PriorityClass struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	Keys     []string `json:"keys"`
+	Models   []string `json:"models"`
+	Shed     bool     `json:"shed"`
 }
 
 // Config is the structure for the proxy configuration
@@ -19,4 +539,99 @@ type Config struct {
 	Backends        []BackendConfig `json:"backends"`
 	GlobalAPIKeyEnv string          `json:"global_api_key_env"`
 	GlobalAPIKey    string
+	RoutingRules    []RoutingRule          `json:"routing_rules"`
+	Aliases         map[string]ModelAlias  `json:"aliases"`
+	Redaction       RedactionConfig        `json:"redaction"`
+	HistoryDir      string                 `json:"history_dir"`
+	History         *history.Store         `json:"-"`
+	Audit           AuditConfig            `json:"audit"`
+	AuditLog        *audit.Log             `json:"-"`
+	Version         string                 `json:"-"`
+	Auth            AuthConfig             `json:"auth"`
+	UsageReport     UsageReportConfig      `json:"usage_report"`
+	Report          ReportConfig           `json:"report"`
+	Tokenizers      []TokenizerConfig      `json:"tokenizers"`
+	TokenizerSet    *tokenizer.Set         `json:"-"`
+	Listeners       []ListenerConfig       `json:"listeners"`
+	PostConditions  []PostConditionConfig  `json:"post_conditions"`
+	Requirements    *postcondition.Set     `json:"-"`
+	Transcription   TranscriptionConfig    `json:"transcription"`
+	APIKeys         []APIKeyConfig         `json:"api_keys"`
+	SyntheticModels []SyntheticModelConfig `json:"synthetic_models"`
+	SyntheticSet    *synthetic.Set         `json:"-"`
+	ModelPrices     map[string]ModelPrice  `json:"model_prices"`
+	Limits          LimitsConfig           `json:"limits"`
+	StreamResume    StreamResumeConfig     `json:"stream_resume"`
+	Streams         *resume.Store          `json:"-"`
+	JWT             JWTConfig              `json:"jwt"`
+	JWTVerifier     *oidc.Verifier         `json:"-"`
+	Network         NetworkConfig          `json:"network"`
+	ClientIPs       *clientip.Policy       `json:"-"`
+	Timezone        string                 `json:"timezone"`
+	Location        *time.Location         `json:"-"`
+	State           StateConfig            `json:"state"`
+	StateStore      state.Store            `json:"-"`
+	Lockout         LockoutConfig          `json:"lockout"`
+	Lockouts        *lockout.Tracker       `json:"-"`
+	Capture         *capture.Writer        `json:"-"`
+	KeyFile         string                 `json:"key_file"`
+	Keys            *keyring.Ring          `json:"-"`
+	PriorityClasses []PriorityClass        `json:"priority_classes"`
+	ContextWindows  []ContextWindowConfig  `json:"context_windows"`
+	Compression     []CompressionConfig    `json:"compression"`
+	Summaries       *summary.Cache         `json:"-"`
+	SemanticCache   SemanticCacheConfig    `json:"semantic_cache"`
+	ResponseCache   *semcache.Cache        `json:"-"`
+	Batches         BatchConfig            `json:"batches"`
+	BatchStore      *batch.Store           `json:"-"`
+	// AssistantBackends maps assistant IDs to the backend holding them
+	AssistantBackends map[string]string  `json:"assistant_backends"`
+	AssistantRoutes   *assistants.Routes `json:"-"`
+	Moderation        ModerationConfig   `json:"moderation"`
+	// Guardrails are the templates API keys and backends name
+	Guardrails map[string]GuardrailConfig `json:"guardrails"`
+	// Capabilities declare what models support, ahead of what backends with
+	// ProbeCapabilities report
+	Capabilities []ModelCapabilityConfig `json:"model_capabilities"`
+	// ModelFamilies are matched before the families the router knows
+	ModelFamilies []ModelFamilyConfig `json:"model_families"`
+	// Router holds the proxies of the backends, built from this configuration
+	Router Router `json:"-"`
+	// Extensions are the compiled-in resolvers, transformers and middlewares
+	// and those this configuration adds, served by the Router built from it
+	Extensions Extensions `json:"-"`
+	// Transport, if set, carries requests to every backend in place of the
+	// transports their configs describe, for programs embedding the router
+	Transport http.RoundTripper `json:"-"`
+}
+
+// Extensions routes and rewrites requests with the extensions of a
+// configuration. It is implemented by extension.Registry and kept as an
+// interface here because the extension package builds on this one.
+type Extensions interface {
+	// Resolve asks the resolvers in turn for a backend, returning the name of
+	// the one that matched, the backend's prefix and the upstream model
+	Resolve(r *http.Request, modelName string) (name, prefix, upstreamModel string, ok bool)
+	// Transform runs the transformers over a chat request, stopping at the first error
+	Transform(r *http.Request, chatReq map[string]interface{}) error
+	// HasTransformers reports whether there are transformers to run
+	HasTransformers() bool
+	// Wrap wraps next in the middlewares, the first running first, and returns their names
+	Wrap(next http.Handler) (http.Handler, []string)
+}
+
+// Router finds the proxy of a backend. It is implemented by proxy.Router and
+// kept as an interface here because the proxy package builds on this one.
+type Router interface {
+	// ByName returns the proxy of the backend called name and its prefix
+	ByName(name string) (http.Handler, string, bool)
+	// ByPrefix returns the proxy of the backend with prefix and its name
+	ByPrefix(prefix string) (http.Handler, string, bool)
+	// Match returns the proxy of the backend whose prefix starts modelName,
+	// with its name and prefix
+	Match(modelName string) (http.Handler, string, string, bool)
+	// Default returns the proxy of the default backend and its name
+	Default() (http.Handler, string)
+	// Extensions returns the extensions requests to the backends go through
+	Extensions() Extensions
 }
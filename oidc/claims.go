@@ -0,0 +1,32 @@
+// Package oidc verifies JSON Web Tokens issued by an OpenID Connect provider,
+// so a deployment can accept its single sign-on tokens instead of handing out
+// the router key. Signing keys are fetched from the provider's JWKS endpoint,
+// found through discovery unless configured, and cached.
+package oidc
+
+import "strings"
+
+// Claims are the claims of a verified token
+type Claims map[string]interface{}
+
+// Strings returns a claim as a list, whether it is a string or an array of strings
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// LooksLikeJWT reports whether a bearer token has the shape of a JWT
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
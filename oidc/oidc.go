@@ -0,0 +1,340 @@
+//go:build !nosso && !minimal
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Available reports whether token verification is built in
+const Available = true
+
+// leeway allows for clock skew between the provider and the router
+const leeway = time.Minute
+
+// keysTTL is how long fetched signing keys are used before they are fetched again
+const keysTTL = time.Hour
+
+// refetchInterval is how often an unknown key ID may trigger a fetch, so
+// tokens with made-up key IDs cannot make the router hammer the provider
+const refetchInterval = time.Minute
+
+// maxVerified bounds the cache of tokens already verified
+const maxVerified = 1024
+
+// Verifier checks tokens against one issuer and audience
+type Verifier struct {
+	issuer   string
+	audience string
+	jwksURL  string
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+	verified  map[string]Claims
+}
+
+// New returns a verifier for tokens from issuer for audience. The signing keys
+// are fetched from jwksURL, or from the jwks_uri the issuer's discovery
+// document names if it is empty.
+func New(issuer, audience, jwksURL string) *Verifier {
+	return &Verifier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		jwksURL:  jwksURL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		verified: make(map[string]Claims),
+	}
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a token and
+// returns its claims
+func (v *Verifier) Verify(token string) (Claims, error) {
+	v.mu.Lock()
+	claims, ok := v.verified[token]
+	v.mu.Unlock()
+	if ok {
+		if err := v.checkTime(claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != v.issuer {
+		return nil, fmt.Errorf("issuer %q is not trusted", iss)
+	}
+	audienceOK := false
+	for _, aud := range claims.Strings("aud") {
+		audienceOK = audienceOK || aud == v.audience
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("token is not for audience %q", v.audience)
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if err := v.checkTime(claims); err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	if len(v.verified) >= maxVerified {
+		clear(v.verified)
+	}
+	v.verified[token] = claims
+	v.mu.Unlock()
+	return claims, nil
+}
+
+// checkTime checks that a token is within its lifetime
+func (v *Verifier) checkTime(claims Claims) error {
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// key returns the signing key with kid, fetching the keys if they are stale
+// or kid is unknown. A token without kid may use the only key there is.
+func (v *Verifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key, ok := v.lookup(kid)
+	stale := time.Since(v.fetched) > keysTTL
+	if (!ok || stale) && time.Since(v.attempted) > refetchInterval {
+		v.attempted = time.Now()
+		keys, err := v.fetchKeys()
+		if err != nil && v.keys == nil {
+			return nil, fmt.Errorf("fetching signing keys: %w", err)
+		}
+		if err == nil {
+			v.keys, v.fetched = keys, time.Now()
+		}
+		key, ok = v.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds a cached key; v.mu must be held
+func (v *Verifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetchKeys fetches the provider's signing keys
+func (v *Verifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	jwksURL := v.jwksURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("discovery: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(jwksURL, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+// getJSON fetches a JSON document
+func (v *Verifier) getJSON(url string, into interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// jwk is a JSON Web Key; only RSA and EC public keys are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks a JWS signature; only asymmetric algorithms are accepted
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "512":
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(rsaKey, ch, digest, signature) != nil {
+			return errors.New("invalid signature")
+		}
+	case strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPSS(rsaKey, ch, digest, signature, nil) != nil {
+			return errors.New("invalid signature")
+		}
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 2*((ecKey.Params().BitSize+7)/8) {
+			return errors.New("invalid signature")
+		}
+		size := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, into interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,121 @@
+//go:build !nosso && !minimal
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64.EncodeToString(signature)
+}
+
+// newProvider serves a discovery document and JWKS with an RSA and an EC key
+func newProvider(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey, fetches *int) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+		case "/keys":
+			*fetches++
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64.EncodeToString(rsaKey.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64.EncodeToString(ecKey.X.Bytes()), "y": b64.EncodeToString(ecKey.Y.Bytes())},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fetches := 0
+	provider := newProvider(t, rsaKey, ecKey, &fetches)
+	v := New(provider.URL, "llm-router", "")
+
+	now := time.Now().Unix()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": provider.URL, "aud": []string{"other", "llm-router"}, "sub": "alice", "exp": now + 300}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"rsa", sign(t, "RS256", "rsa", rsaKey, claims(nil)), ""},
+		{"ec", sign(t, "ES256", "ec", ecKey, claims(nil)), ""},
+		{"wrong key", sign(t, "RS256", "rsa", otherKey, claims(nil)), "invalid signature"},
+		{"unknown kid", sign(t, "RS256", "nope", rsaKey, claims(nil)), "unknown signing key"},
+		{"issuer", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})), "issuer"},
+		{"audience", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})), "audience"},
+		{"expired", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": now - 3600})), "expired"},
+		{"no expiry", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})), "no expiry"},
+		{"not yet", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": now + 3600})), "not valid yet"},
+		{"unsigned", strings.Join(strings.Split(sign(t, "RS256", "rsa", rsaKey, claims(nil)), ".")[:2], ".") + ".", "invalid signature"},
+	}
+	for _, tt := range tests {
+		got, err := v.Verify(tt.token)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+		case tt.err == "" && got.Strings("sub")[0] != "alice":
+			t.Errorf("%s: unexpected claims %v", tt.name, got)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the keys to be fetched once and cached, got %d fetches", fetches)
+	}
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	if !LooksLikeJWT("eyJhbGciOi.eyJzdWIi.c2ln") || LooksLikeJWT("sk-proj-abc") || LooksLikeJWT("eyJ.a") {
+		t.Errorf("Unexpected JWT detection")
+	}
+}
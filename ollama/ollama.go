@@ -0,0 +1,167 @@
+// Package ollama calls the parts of Ollama's native API the router uses to
+// manage the models of Ollama backends, which its OpenAI-compatible API
+// cannot: listing installed models and their details, pulling models and
+// loading them.
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls one Ollama server
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New returns a client for the Ollama server at baseURL, which may be the
+// URL of its OpenAI-compatible API, using transport
+func New(baseURL string, transport http.RoundTripper) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/v1")
+	return &Client{baseURL: u.String(), http: &http.Client{Transport: transport}}, nil
+}
+
+// Model is an installed model
+type Model struct {
+	Name       string    `json:"name"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+}
+
+// Details describes a model
+type Details struct {
+	Capabilities []string               `json:"capabilities"`
+	ModelInfo    map[string]interface{} `json:"model_info"`
+}
+
+// ContextLength is the context window the model was trained with, or 0 if
+// Ollama does not report it
+func (d *Details) ContextLength() int {
+	for name, value := range d.ModelInfo {
+		if length, ok := value.(float64); ok && strings.HasSuffix(name, ".context_length") {
+			return int(length)
+		}
+	}
+	return 0
+}
+
+// Tags lists the installed models
+func (c *Client) Tags(ctx context.Context) ([]Model, error) {
+	var tags struct {
+		Models []Model `json:"models"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+// Show describes an installed model
+func (c *Client) Show(ctx context.Context, name string) (*Details, error) {
+	var details Details
+	if err := c.call(ctx, http.MethodPost, "/api/show", map[string]string{"model": name}, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// Progress is a step of pulling a model
+type Progress struct {
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// String describes the step, with how much of a layer is downloaded
+func (p Progress) String() string {
+	if p.Total > 0 {
+		return fmt.Sprintf("%s %d%%", p.Status, p.Completed*100/p.Total)
+	}
+	return p.Status
+}
+
+// Pull downloads a model, calling progress with each step Ollama reports
+func (c *Client) Pull(ctx context.Context, name string, progress func(Progress)) error {
+	resp, err := c.send(ctx, http.MethodPost, "/api/pull", map[string]interface{}{"model": name, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var step Progress
+		if err := decoder.Decode(&step); err == io.EOF {
+			return errors.New("pull ended before it succeeded")
+		} else if err != nil {
+			return err
+		}
+		if step.Error != "" {
+			return errors.New(step.Error)
+		}
+		progress(step)
+		if step.Status == "success" {
+			return nil
+		}
+	}
+}
+
+// Load loads a model into memory and keeps it there for keepAlive, a duration
+// such as "30m" or seconds, negative to keep it loaded
+func (c *Client) Load(ctx context.Context, name, keepAlive string) error {
+	var value interface{} = keepAlive
+	if seconds, err := strconv.Atoi(keepAlive); err == nil {
+		value = seconds
+	}
+	var response struct {
+		Done bool `json:"done"`
+	}
+	return c.call(ctx, http.MethodPost, "/api/generate", map[string]interface{}{"model": name, "keep_alive": value, "stream": false}, &response)
+}
+
+// call sends request to path and decodes the answer into response
+func (c *Client) call(ctx context.Context, method, path string, request, response interface{}) error {
+	resp, err := c.send(ctx, method, path, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// send sends request to path, failing unless the answer is 200 OK
+func (c *Client) send(ctx context.Context, method, path string, request interface{}) (*http.Response, error) {
+	var body bytes.Buffer
+	if request != nil {
+		json.NewEncoder(&body).Encode(request)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s returned status %d", method, path, resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,307 @@
+// Package router embeds llm-router in other Go programs. New turns a
+// configuration into an http.Handler serving the router's API, which can be
+// mounted in any server:
+//
+//	cfg := &model.Config{
+//		GlobalAPIKey: "router-key",
+//		Backends: []model.BackendConfig{
+//			{Name: "ollama", BaseURL: "http://localhost:11434", Prefix: "ollama/", Default: true},
+//		},
+//	}
+//	h, err := router.New(cfg, router.WithLogger(logger))
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	http.Handle("/", h)
+//
+// Stores kept on disk, such as the exchange history, the audit log, batches
+// and the key file, are left to the embedding program, which opens them and
+// sets them on the configuration before calling New. A state store set on the
+// configuration is used in place of the one its state settings describe, so
+// the program can share its own Redis connection. Each router keeps its own
+// routing rules, redaction, tokenizers, post-conditions, synthetic models and
+// backend health, so several can be embedded side by side.
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kcolemangt/llm-router/assistants"
+	"github.com/kcolemangt/llm-router/clientip"
+	"github.com/kcolemangt/llm-router/config"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/handler"
+	"github.com/kcolemangt/llm-router/lockout"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/oidc"
+	"github.com/kcolemangt/llm-router/postcondition"
+	"github.com/kcolemangt/llm-router/proxy"
+	"github.com/kcolemangt/llm-router/redact"
+	"github.com/kcolemangt/llm-router/resume"
+	"github.com/kcolemangt/llm-router/rules"
+	"github.com/kcolemangt/llm-router/semcache"
+	"github.com/kcolemangt/llm-router/state"
+	"github.com/kcolemangt/llm-router/summary"
+	"github.com/kcolemangt/llm-router/synthetic"
+	"github.com/kcolemangt/llm-router/tokenizer"
+	"go.uber.org/zap"
+)
+
+// maxStateEntries bounds the keys kept by the in-memory state store
+const maxStateEntries = 100000
+
+// Option adjusts a configuration before the router is built from it
+type Option func(*model.Config)
+
+// WithLogger logs to logger instead of discarding log output
+func WithLogger(logger *zap.Logger) Option {
+	return func(cfg *model.Config) { cfg.Logger = logger }
+}
+
+// WithTransport sends every backend request through transport, in place of
+// the transports the backends' configs describe
+func WithTransport(transport http.RoundTripper) Option {
+	return func(cfg *model.Config) { cfg.Transport = transport }
+}
+
+// Router serves the router's API for one configuration. Several can be built
+// in one process; each must be closed once it no longer serves requests.
+type Router struct {
+	http.Handler
+	proxies *proxy.Router
+	// store is the state store New opened, nil for one the program set
+	store state.Store
+}
+
+// Close releases the backend connections of the router and the state store it
+// opened. Requests in flight finish; a store or transport set on the
+// configuration is left to the program.
+func (r *Router) Close() error {
+	r.proxies.Close()
+	if r.store != nil {
+		return r.store.Close()
+	}
+	return nil
+}
+
+// New checks cfg and returns a router serving the API for it. The
+// configuration belongs to the router afterwards and must not be changed.
+func New(cfg *model.Config, opts ...Option) (*Router, error) {
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	if problems := config.Validate(cfg); len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	if cfg.Transport == nil {
+		for _, backend := range cfg.Backends {
+			if _, err := proxy.NewTransport(backend.Transport); err != nil {
+				return nil, fmt.Errorf("%s: %w", backend.Name, err)
+			}
+		}
+	}
+	ownStore := cfg.StateStore == nil
+	if err := Prepare(cfg); err != nil {
+		return nil, err
+	}
+	r := &Router{Handler: handler.NewHandler(cfg)}
+	r.proxies, _ = cfg.Router.(*proxy.Router)
+	if ownStore {
+		r.store = cfg.StateStore
+	}
+	return r, nil
+}
+
+// Prepare builds what a loaded configuration needs to serve requests and
+// sets it on cfg: the backends' proxies and the rules, caches and trackers
+// its settings ask for. It does not validate cfg or open stores on disk.
+func Prepare(cfg *model.Config) error {
+	// Extensions of this configuration, such as routing rules, are its own
+	extensions := extension.NewRegistry()
+	cfg.Extensions = extensions
+
+	// Scrub sensitive data from requests and logs before anything else uses the logger
+	if err := redact.Register(cfg, extensions); err != nil {
+		return fmt.Errorf("redaction: %w", err)
+	}
+	logger := cfg.Logger
+
+	// Load tokenizers before anything counts tokens, the proxies included
+	var err error
+	if cfg.TokenizerSet, err = loadTokenizers(cfg); err != nil {
+		return fmt.Errorf("tokenizers: %w", err)
+	}
+	if cfg.Requirements, err = compilePostConditions(cfg); err != nil {
+		return fmt.Errorf("post-conditions: %w", err)
+	}
+	if cfg.SyntheticSet, err = compileSyntheticModels(cfg); err != nil {
+		return fmt.Errorf("synthetic models: %w", err)
+	}
+
+	// Detect the APIs of backends that ask for it before their proxies are built
+	proxy.DetectBackends(cfg.Backends, logger)
+	cfg.Router = proxy.NewRouter(cfg)
+
+	if err := rules.Register(cfg, extensions); err != nil {
+		return fmt.Errorf("routing rules: %w", err)
+	}
+
+	// Accept single sign-on tokens if configured
+	if cfg.JWT.Issuer != "" {
+		cfg.JWTVerifier = oidc.New(cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.JWKSURL)
+		logger.Info("Accepting JWTs", zap.String("issuer", cfg.JWT.Issuer), zap.String("audience", cfg.JWT.Audience))
+	}
+
+	// Keep state other instances share where the configuration says
+	if cfg.StateStore == nil {
+		switch cfg.State.Driver {
+		case state.DriverRedis:
+			prefix := cfg.State.Prefix
+			if prefix == "" {
+				prefix = "llm-router:"
+			}
+			cfg.StateStore = state.NewRedis(cfg.State.Address, os.Getenv(cfg.State.PasswordEnv), cfg.State.DB, prefix)
+			logger.Info("Sharing state through Redis", zap.String("address", cfg.State.Address), zap.Int("db", cfg.State.DB))
+		case state.DriverFile:
+			store, err := state.OpenFile(cfg.State.Path, maxStateEntries)
+			if err != nil {
+				return fmt.Errorf("state: %w", err)
+			}
+			cfg.StateStore = store
+			logger.Info("Keeping state in a file", zap.String("path", cfg.State.Path))
+		default:
+			cfg.StateStore = state.NewMemory(maxStateEntries)
+		}
+	}
+
+	// Turn away addresses that keep failing authentication
+	if cfg.Lockout.Threshold > 0 {
+		window, ban := 10*time.Minute, 15*time.Minute
+		if cfg.Lockout.WindowSeconds > 0 {
+			window = time.Duration(cfg.Lockout.WindowSeconds) * time.Second
+		}
+		if cfg.Lockout.BanSeconds > 0 {
+			ban = time.Duration(cfg.Lockout.BanSeconds) * time.Second
+		}
+		cfg.Lockouts = lockout.NewShared(cfg.StateStore, cfg.Lockout.Threshold, window, ban, logger)
+		logger.Info("Locking out failed clients", zap.Int("threshold", cfg.Lockout.Threshold),
+			zap.Duration("window", window), zap.Duration("ban", ban))
+		if len(cfg.Network.TrustedProxies) == 0 {
+			logger.Warn("Lockouts are enabled without network.trusted_proxies; behind a tunnel every client shares its address")
+		}
+	}
+
+	if len(cfg.Compression) > 0 {
+		cfg.Summaries = summary.New()
+	}
+	cfg.AssistantRoutes = assistants.New()
+	if cache := cfg.SemanticCache; len(cache.Models) > 0 {
+		maxEntries := cache.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = 1000
+		}
+		cfg.ResponseCache = semcache.New(maxEntries, time.Duration(cache.TTLSeconds)*time.Second)
+		logger.Info("Semantic cache enabled", zap.Strings("models", cache.Models),
+			zap.String("embeddingModel", cache.EmbeddingModel), zap.Int("maxEntries", maxEntries))
+	}
+
+	// Reports and calendar periods follow the configured time zone, not the server's
+	if cfg.Location, err = time.LoadLocation(cfg.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q: %w", cfg.Timezone, err)
+	}
+
+	// Without a configured secret, exported usage keeps its noise only while this router runs
+	if cfg.UsageReport.Epsilon > 0 && cfg.UsageReport.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		cfg.UsageReport.Secret = hex.EncodeToString(secret)
+	}
+
+	// Find the real client behind tunnels and filter clients by address
+	if cfg.ClientIPs, err = clientip.New(cfg.Network.TrustedProxies, cfg.Network.Allow, cfg.Network.Deny); err != nil {
+		return fmt.Errorf("network: %w", err)
+	}
+
+	// Keep streamed responses for clients that reconnect if configured
+	if cfg.StreamResume.Enabled {
+		retention := time.Duration(cfg.StreamResume.RetentionSeconds) * time.Second
+		if retention == 0 {
+			retention = 5 * time.Minute
+		}
+		cfg.Streams = resume.New(retention, cfg.Limits.RecordedResponseBytes)
+		logger.Info("Keeping streams for resumption", zap.Duration("retention", retention))
+	}
+	return nil
+}
+
+// loadTokenizers loads the configured tokenizers and selects them for their models
+func loadTokenizers(cfg *model.Config) (*tokenizer.Set, error) {
+	set := &tokenizer.Set{}
+	for i, tc := range cfg.Tokenizers {
+		t, err := tokenizer.Load(tc.Type, tc.Path, tc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %d: %w", i, err)
+		}
+		if err := set.Add(tc.Models, t); err != nil {
+			return nil, fmt.Errorf("tokenizer %d: %w", i, err)
+		}
+		cfg.Logger.Info("Tokenizer loaded",
+			zap.String("type", tc.Type),
+			zap.String("path", tc.Path),
+			zap.Strings("models", tc.Models))
+	}
+	return set, nil
+}
+
+// compilePostConditions compiles the configured post-conditions
+func compilePostConditions(cfg *model.Config) (*postcondition.Set, error) {
+	set := &postcondition.Set{}
+	for i, pc := range cfg.PostConditions {
+		c, err := postcondition.Compile(pc.Models, pc.MaxLength, pc.JSON, pc.MustMatch)
+		if err != nil {
+			return nil, fmt.Errorf("post-condition %d: %w", i, err)
+		}
+		set.Add(c)
+		cfg.Logger.Info("Post-conditions set",
+			zap.Strings("models", pc.Models),
+			zap.Int("maxLength", pc.MaxLength),
+			zap.Bool("json", pc.JSON),
+			zap.String("mustMatch", pc.MustMatch))
+	}
+	return set, nil
+}
+
+// compileSyntheticModels compiles the configured synthetic models
+func compileSyntheticModels(cfg *model.Config) (*synthetic.Set, error) {
+	set := &synthetic.Set{}
+	for i, sm := range cfg.SyntheticModels {
+		m, err := synthetic.Compile(sm.Name, sm.Response, syntheticRules(sm))
+		if err != nil {
+			return nil, fmt.Errorf("synthetic model %d: %w", i, err)
+		}
+		if err := set.Add(m); err != nil {
+			return nil, err
+		}
+		cfg.Logger.Info("Synthetic model set", zap.String("model", m.Name), zap.Int("rules", m.Rules()))
+	}
+	return set, nil
+}
+
+// syntheticRules returns the rules of a synthetic model config entry
+func syntheticRules(sm model.SyntheticModelConfig) []synthetic.Rule {
+	rules := make([]synthetic.Rule, len(sm.Rules))
+	for i, r := range sm.Rules {
+		rules[i] = synthetic.Rule(r)
+	}
+	return rules
+}
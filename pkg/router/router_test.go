@@ -0,0 +1,153 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/state"
+)
+
+// recordingTransport answers every request itself and remembers its URL
+type recordingTransport struct {
+	urls []string
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.urls = append(t.urls, r.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"model":"llama3","choices":[]}`)),
+		Request:    r,
+	}, nil
+}
+
+func TestNewServesTheAPIThroughTheGivenTransport(t *testing.T) {
+	transport := &recordingTransport{}
+	h, err := New(&model.Config{
+		GlobalAPIKey: "router-key",
+		Backends:     []model.BackendConfig{{Name: "ollama", BaseURL: "http://ollama.internal:11434", Prefix: "ollama/", Default: true}},
+	}, WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"ollama/llama3","messages":[]}`))
+	req.Header.Set("Authorization", "Bearer router-key")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"model":"ollama/llama3"`) {
+		t.Errorf("Expected the backend's answer under the requested model, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(transport.urls) != 1 || transport.urls[0] != "http://ollama.internal:11434/v1/chat/completions" {
+		t.Errorf("Expected one request through the transport, got %v", transport.urls)
+	}
+}
+
+func TestNewRejectsInvalidConfiguration(t *testing.T) {
+	_, err := New(&model.Config{Backends: []model.BackendConfig{
+		{Name: "ollama", BaseURL: "http://localhost:11434", Prefix: "ollama/", Transport: model.TransportConfig{Protocol: "http3"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "http3") {
+		t.Errorf("Expected the unknown protocol to be reported, got %v", err)
+	}
+
+	if _, err := New(&model.Config{}); err == nil {
+		t.Error("Expected a configuration without backends to be refused")
+	}
+}
+
+func TestRoutersKeepTheirOwnRules(t *testing.T) {
+	build := func(backend string) (*Router, *recordingTransport) {
+		transport := &recordingTransport{}
+		h, err := New(&model.Config{
+			GlobalAPIKey: "router-key",
+			Backends: []model.BackendConfig{
+				{Name: "ollama", BaseURL: "http://ollama.internal:11434", Prefix: "ollama/", Default: true},
+				{Name: "groq", BaseURL: "http://groq.internal", Prefix: "groq/"},
+			},
+			RoutingRules: []model.RoutingRule{{When: `hasTag("batch")`, Backend: backend}},
+		}, WithTransport(transport))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h, transport
+	}
+	toOllama, ollamaTransport := build("ollama")
+	defer toOllama.Close()
+	toGroq, groqTransport := build("groq")
+	defer toGroq.Close()
+
+	for _, h := range []*Router{toOllama, toGroq} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"llama3","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		req.Header.Set("X-Router-Tags", "batch")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(ollamaTransport.urls) != 1 || !strings.HasPrefix(ollamaTransport.urls[0], "http://ollama.internal:11434/") {
+		t.Errorf("Expected the first router to follow its own rule, got %v", ollamaTransport.urls)
+	}
+	if len(groqTransport.urls) != 1 || !strings.HasPrefix(groqTransport.urls[0], "http://groq.internal/") {
+		t.Errorf("Expected the second router to follow its own rule, got %v", groqTransport.urls)
+	}
+}
+
+func TestRoutersKeepTheirOwnSyntheticModels(t *testing.T) {
+	build := func(response string) *Router {
+		h, err := New(&model.Config{
+			GlobalAPIKey:    "router-key",
+			Backends:        []model.BackendConfig{{Name: "ollama", BaseURL: "http://ollama.internal:11434", Prefix: "ollama/", Default: true}},
+			SyntheticModels: []model.SyntheticModelConfig{{Name: "policy-bot", Response: response}},
+		}, WithTransport(&recordingTransport{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	first := build("first policy")
+	defer first.Close()
+	second := build("second policy")
+	defer second.Close()
+
+	for h, want := range map[*Router]string{first: "first policy", second: "second policy"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"policy-bot","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Authorization", "Bearer router-key")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected %q from its own synthetic model, got %s", want, rec.Body.String())
+		}
+	}
+}
+
+// closeCountingStore counts the calls to Close
+type closeCountingStore struct {
+	*state.Memory
+	closed int
+}
+
+func (s *closeCountingStore) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestCloseLeavesTheProgramsStore(t *testing.T) {
+	store := &closeCountingStore{Memory: state.NewMemory(10)}
+	h, err := New(&model.Config{
+		Backends:   []model.BackendConfig{{Name: "ollama", BaseURL: "http://ollama.internal:11434", Prefix: "ollama/", Default: true}},
+		StateStore: store,
+	}, WithTransport(&recordingTransport{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil || store.closed != 0 {
+		t.Errorf("Expected the program's store left open, got %v after %d closes", err, store.closed)
+	}
+}
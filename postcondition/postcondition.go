@@ -0,0 +1,98 @@
+// Package postcondition checks model answers against per-model requirements:
+// a maximum length, being valid JSON, or containing a pattern. Violations are
+// described so they can be sent back to the model as corrective instructions.
+// Each configuration keeps its conditions in a Set of its own.
+package postcondition
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Conditions are the compiled requirements of one config entry
+type Conditions struct {
+	globs     []string
+	maxLength int
+	json      bool
+	mustMatch *regexp.Regexp
+}
+
+// Compile checks the requirements on the answers of the models matching
+// globs and compiles mustMatch: at most maxLength characters if it is set,
+// valid JSON if requireJSON is, and text matching mustMatch if it is set
+func Compile(globs []string, maxLength int, requireJSON bool, mustMatch string) (*Conditions, error) {
+	if len(globs) == 0 {
+		return nil, fmt.Errorf("no models")
+	}
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %q", glob)
+		}
+	}
+	if maxLength < 0 {
+		return nil, fmt.Errorf("negative max_length")
+	}
+	c := &Conditions{globs: globs, maxLength: maxLength, json: requireJSON}
+	if mustMatch != "" {
+		re, err := regexp.Compile(mustMatch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid must_match: %w", err)
+		}
+		c.mustMatch = re
+	}
+	return c, nil
+}
+
+// Check returns the requirements content violates, each phrased as an
+// instruction to the model
+func (c *Conditions) Check(content string) []string {
+	var violations []string
+	if length := utf8.RuneCountInString(content); c.maxLength > 0 && length > c.maxLength {
+		violations = append(violations, fmt.Sprintf("Your answer was %d characters long; keep it to at most %d characters.", length, c.maxLength))
+	}
+	if c.json && !json.Valid([]byte(strings.TrimSpace(content))) {
+		violations = append(violations, "Your answer was not valid JSON; respond with a single JSON value only, without code fences or explanation.")
+	}
+	if c.mustMatch != nil && !c.mustMatch.MatchString(content) {
+		violations = append(violations, fmt.Sprintf("Your answer must contain text matching the regular expression %s.", c.mustMatch))
+	}
+	return violations
+}
+
+// Correction returns the message asking the model to fix its violations
+func Correction(violations []string) string {
+	return "Your previous answer did not meet the requirements.\n- " + strings.Join(violations, "\n- ") +
+		"\nAnswer the original request again, following these requirements."
+}
+
+// Set holds the conditions of a configuration, in order. A nil Set holds none.
+type Set struct {
+	compiled []*Conditions
+}
+
+// Add adds c after the conditions added before
+func (s *Set) Add(c *Conditions) {
+	s.compiled = append(s.compiled, c)
+}
+
+// For returns the conditions of the first entry matching any of the model
+// names, or nil if none does
+func (s *Set) For(modelNames ...string) *Conditions {
+	if s == nil {
+		return nil
+	}
+	for _, c := range s.compiled {
+		for _, glob := range c.globs {
+			for _, name := range modelNames {
+				if ok, _ := path.Match(glob, name); ok {
+					return c
+				}
+			}
+		}
+	}
+	return nil
+}
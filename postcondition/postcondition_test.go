@@ -0,0 +1,74 @@
+package postcondition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	c, err := Compile([]string{"*"}, 10, true, `"id"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{`{"id":1}`, 0},
+		{` {"id":1} `, 0},
+		{`{"id":12345}`, 1},
+		{`{"name":1}`, 1},
+		{"```json\n{\"id\":1}\n```", 2},
+		{"Sure! Here is the JSON you asked for.", 3},
+	}
+	for _, tt := range tests {
+		if got := c.Check(tt.content); len(got) != tt.want {
+			t.Errorf("%q: expected %d violations, got %v", tt.content, tt.want, got)
+		}
+	}
+	if correction := Correction(c.Check("nope")); !strings.Contains(correction, "not valid JSON") || !strings.Contains(correction, `"id"`) {
+		t.Errorf("Unexpected correction %q", correction)
+	}
+}
+
+func TestCompileRejectsInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		globs     []string
+		maxLength int
+		mustMatch string
+	}{
+		{nil, 0, ""},
+		{[]string{"["}, 0, ""},
+		{[]string{"*"}, -1, ""},
+		{[]string{"*"}, 0, "("},
+	} {
+		if _, err := Compile(tt.globs, tt.maxLength, false, tt.mustMatch); err == nil {
+			t.Errorf("Expected %+v to be rejected", tt)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	set := &Set{}
+	for _, globs := range [][]string{{"ollama/*"}, {"extract"}} {
+		c, err := Compile(globs, 100, globs[0] == "ollama/*", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Add(c)
+	}
+
+	if c := set.For("ollama/llama3"); c == nil || !c.json {
+		t.Errorf("Expected the JSON conditions for ollama/llama3")
+	}
+	if c := set.For("extract", "openai/gpt-4o"); c == nil || c.json {
+		t.Errorf("Expected the alias conditions for extract")
+	}
+	if c := set.For("openai/gpt-4o"); c != nil {
+		t.Errorf("Expected no conditions for openai/gpt-4o")
+	}
+	var none *Set
+	if c := none.For("ollama/llama3"); c != nil {
+		t.Errorf("Expected no conditions without a set")
+	}
+}
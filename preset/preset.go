@@ -0,0 +1,127 @@
+// Package preset holds the defaults of well-known backends: where their
+// OpenAI-compatible API is served, which environment variable usually holds
+// the key, and the request parameters they reject or name differently. A
+// backend's preset only fills in what its config leaves unset.
+package preset
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// Preset is the defaults of one kind of backend. Every preset authenticates
+// with a bearer key, if it needs one.
+type Preset struct {
+	// BaseURL includes the path the OpenAI-compatible API is mounted below
+	BaseURL string
+	// KeyEnvVar is the conventional key variable; if set, the key is required
+	KeyEnvVar    string
+	StripParams  []string
+	ParamLimits  map[string]model.ParamLimit
+	ParamRenames map[string]string
+}
+
+// one is a limit of 1, for backends that generate a single choice
+var one = 1.0
+
+var presets = map[string]Preset{
+	"openai": {
+		BaseURL:   "https://api.openai.com",
+		KeyEnvVar: "OPENAI_API_KEY",
+	},
+	"ollama": {
+		BaseURL: "http://localhost:11434",
+	},
+	"lmstudio": {
+		BaseURL:      "http://localhost:1234",
+		StripParams:  []string{"store", "metadata"},
+		ParamRenames: map[string]string{"max_completion_tokens": "max_tokens"},
+	},
+	"vllm": {
+		BaseURL:     "http://localhost:8000",
+		StripParams: []string{"store", "metadata"},
+	},
+	"groq": {
+		BaseURL:     "https://api.groq.com/openai",
+		KeyEnvVar:   "GROQ_API_KEY",
+		StripParams: []string{"logprobs", "top_logprobs", "logit_bias"},
+		ParamLimits: map[string]model.ParamLimit{"n": {Max: &one}},
+	},
+	"together": {
+		BaseURL:   "https://api.together.xyz",
+		KeyEnvVar: "TOGETHER_API_KEY",
+	},
+	"openrouter": {
+		BaseURL:   "https://openrouter.ai/api",
+		KeyEnvVar: "OPENROUTER_API_KEY",
+	},
+	"mistral": {
+		BaseURL:      "https://api.mistral.ai",
+		KeyEnvVar:    "MISTRAL_API_KEY",
+		StripParams:  []string{"logprobs", "top_logprobs", "logit_bias", "user", "store", "metadata"},
+		ParamRenames: map[string]string{"max_completion_tokens": "max_tokens"},
+	},
+}
+
+// Names returns the names of all presets, sorted
+func Names() []string {
+	return slices.Sorted(maps.Keys(presets))
+}
+
+// Lookup returns the preset called name
+func Lookup(name string) (Preset, bool) {
+	p, ok := presets[name]
+	return p, ok
+}
+
+// Apply fills in the fields of backend that its preset provides and the
+// config leaves unset. The name defaults to the preset's and the prefix to the
+// name followed by a slash. Stripped parameters are added to the configured
+// ones, and limits and renames are added for parameters the config does not
+// mention.
+func Apply(backend *model.BackendConfig) error {
+	if backend.Preset == "" {
+		return nil
+	}
+	p, ok := presets[backend.Preset]
+	if !ok {
+		return fmt.Errorf("unknown preset %q (available: %s)", backend.Preset, strings.Join(Names(), ", "))
+	}
+
+	if backend.Name == "" {
+		backend.Name = backend.Preset
+	}
+	if backend.Prefix == "" {
+		backend.Prefix = backend.Name + "/"
+	}
+	if backend.BaseURL == "" && len(backend.Instances) == 0 {
+		backend.BaseURL = p.BaseURL
+	}
+	if p.KeyEnvVar != "" && backend.KeyEnvVar == "" {
+		backend.KeyEnvVar = p.KeyEnvVar
+		backend.RequireAPIKey = true
+	}
+	for _, param := range p.StripParams {
+		if !slices.Contains(backend.StripParams, param) {
+			backend.StripParams = append(backend.StripParams, param)
+		}
+	}
+	backend.ParamLimits = merge(backend.ParamLimits, p.ParamLimits)
+	backend.ParamRenames = merge(backend.ParamRenames, p.ParamRenames)
+	return nil
+}
+
+// merge returns configured with the defaults it does not set added, without
+// modifying either map
+func merge[V any](configured, defaults map[string]V) map[string]V {
+	if len(defaults) == 0 {
+		return configured
+	}
+	merged := maps.Clone(defaults)
+	maps.Copy(merged, configured)
+	return merged
+}
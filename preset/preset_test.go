@@ -0,0 +1,69 @@
+package preset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestApplyFillsUnsetFields(t *testing.T) {
+	backend := model.BackendConfig{Preset: "groq"}
+	if err := Apply(&backend); err != nil {
+		t.Fatalf("Apply failed: %s", err)
+	}
+	if backend.Name != "groq" || backend.Prefix != "groq/" || backend.BaseURL != "https://api.groq.com/openai" {
+		t.Errorf("Unexpected defaults %+v", backend)
+	}
+	if !backend.RequireAPIKey || backend.KeyEnvVar != "GROQ_API_KEY" {
+		t.Errorf("Expected the key to be required from GROQ_API_KEY, got %v %s", backend.RequireAPIKey, backend.KeyEnvVar)
+	}
+	if limit := backend.ParamLimits["n"]; limit.Max == nil || *limit.Max != 1 {
+		t.Errorf("Expected n to be limited to 1, got %+v", limit)
+	}
+}
+
+func TestApplyKeepsConfiguredFields(t *testing.T) {
+	backend := model.BackendConfig{
+		Preset:       "mistral",
+		Name:         "eu",
+		BaseURL:      "https://mistral.internal",
+		KeyEnvVar:    "EU_KEY",
+		StripParams:  []string{"seed", "user"},
+		ParamRenames: map[string]string{"max_completion_tokens": "max_new_tokens"},
+	}
+	if err := Apply(&backend); err != nil {
+		t.Fatalf("Apply failed: %s", err)
+	}
+	if backend.Name != "eu" || backend.Prefix != "eu/" || backend.BaseURL != "https://mistral.internal" || backend.KeyEnvVar != "EU_KEY" {
+		t.Errorf("Expected configured fields to be kept, got %+v", backend)
+	}
+	want := []string{"seed", "user", "logprobs", "top_logprobs", "logit_bias", "store", "metadata"}
+	if !reflect.DeepEqual(backend.StripParams, want) {
+		t.Errorf("Expected stripped params %v, got %v", want, backend.StripParams)
+	}
+	if backend.ParamRenames["max_completion_tokens"] != "max_new_tokens" {
+		t.Errorf("Expected the configured rename to win, got %v", backend.ParamRenames)
+	}
+	if presets["mistral"].ParamRenames["max_completion_tokens"] != "max_tokens" {
+		t.Errorf("Expected the preset itself to be unchanged")
+	}
+}
+
+func TestApplyUnknownPreset(t *testing.T) {
+	backend := model.BackendConfig{Name: "x", Preset: "nope"}
+	if err := Apply(&backend); err == nil {
+		t.Errorf("Expected an error for an unknown preset")
+	}
+	if backend.Prefix != "" {
+		t.Errorf("Expected the backend to be left alone, got %+v", backend)
+	}
+}
+
+func TestPresetsAreComplete(t *testing.T) {
+	for _, name := range Names() {
+		if presets[name].BaseURL == "" {
+			t.Errorf("Preset %s has no base URL", name)
+		}
+	}
+}
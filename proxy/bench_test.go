@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+var benchBody = []byte(fmt.Sprintf(`{"model":"o3-mini","max_tokens":100000,"temperature":1.5,"store":true,"messages":[{"role":"user","content":%q}]}`,
+	strings.Repeat("The quick brown fox jumps over the lazy dog. ", 500)))
+
+// BenchmarkReadJSONBody measures capturing and decoding a request body
+func BenchmarkReadJSONBody(b *testing.B) {
+	logger := zap.NewNop()
+	b.SetBytes(int64(len(benchBody)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(benchBody))
+		if _, ok := readJSONBody(req, "bench", logger); !ok {
+			b.Fatal("Failed to read body")
+		}
+	}
+}
+
+// BenchmarkAdjustParams measures a full strip, clamp and rename transformation
+func BenchmarkAdjustParams(b *testing.B) {
+	max := 4096.0
+	backend := model.BackendConfig{
+		Name:         "bench",
+		StripParams:  []string{"store"},
+		ParamLimits:  map[string]model.ParamLimit{"max_tokens": {Max: &max}},
+		ParamRenames: map[string]string{"max_tokens": "max_completion_tokens"},
+	}
+	handler := adjustParams(backend, zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	b.SetBytes(int64(len(benchBody)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(benchBody))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
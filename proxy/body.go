@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// readJSONBody decodes the JSON body of a POST request, leaving r.Body readable
+// for the next handler. It returns false for other methods and non-JSON bodies.
+func readJSONBody(r *http.Request, name string, logger *zap.Logger) (map[string]interface{}, bool) {
+	if r.Body == nil || r.Method != http.MethodPost {
+		return nil, false
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		logger.Warn("Failed to read request body", zap.String("backend", name), zap.Error(err))
+		return nil, false
+	}
+
+	var payload map[string]interface{}
+	if err := utils.UnmarshalJSON(body, &payload); err != nil || payload == nil {
+		return nil, false
+	}
+	return payload, true
+}
+
+// readBody reads the whole request body and leaves r.Body readable for the next handler
+func readBody(r *http.Request) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, max(r.ContentLength, 0)+bytes.MinRead))
+	_, err := buf.ReadFrom(r.Body)
+	r.Body.Close()
+	body := buf.Bytes()
+	replaceBody(r, body)
+	return body, err
+}
+
+// writeJSONBody encodes payload as the new request body
+func writeJSONBody(r *http.Request, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	replaceBody(r, body)
+	return nil
+}
+
+// replaceBody swaps the request body and keeps the length headers consistent
+func replaceBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// maxRewrittenBody bounds the JSON responses read whole to be rewritten;
+// larger ones pass through unchanged
+const maxRewrittenBody = 8 << 20
+
+// readResponseBody reads a response body whole so it can be rewritten. A body
+// larger than maxRewrittenBody is left readable as it was and reported false.
+func readResponseBody(resp *http.Response) ([]byte, bool, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRewrittenBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, false, err
+	}
+	if len(body) > maxRewrittenBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil, false, nil
+	}
+	resp.Body.Close()
+	return body, true, nil
+}
+
+// replaceResponseBody swaps the response body and keeps the length headers consistent
+func replaceResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// lineRewriter passes a response body through rewrite as whole lines arrive,
+// and appends what end returns when the body ends. A line longer than the
+// configured stream line limit is passed through unchanged.
+type lineRewriter struct {
+	body    io.ReadCloser
+	rewrite func(lines []byte) []byte
+	end     func() []byte
+	maxLine int
+	buf     []byte
+	pending []byte
+	out     []byte
+	err     error
+}
+
+// newLineRewriter wraps body in a lineRewriter passing lines longer than
+// maxLine through unchanged; end may be nil
+func newLineRewriter(body io.ReadCloser, rewrite func(lines []byte) []byte, end func() []byte, maxLine int) *lineRewriter {
+	return &lineRewriter{body: body, rewrite: rewrite, end: end, maxLine: maxLine}
+}
+
+func (l *lineRewriter) Read(p []byte) (int, error) {
+	for len(l.out) == 0 {
+		if l.err != nil {
+			if len(l.pending) > 0 {
+				l.out, l.pending = l.pending, nil
+			} else if l.end != nil {
+				l.out, l.end = l.end(), nil
+			}
+			if len(l.out) == 0 {
+				return 0, l.err
+			}
+			break
+		}
+		if l.buf == nil {
+			l.buf = make([]byte, 32*1024)
+		}
+		n, err := l.body.Read(l.buf)
+		l.err = err
+		l.pending = append(l.pending, l.buf[:n]...)
+		if i := bytes.LastIndexByte(l.pending, '\n'); i >= 0 {
+			l.out = l.rewrite(l.pending[:i+1])
+			l.pending = append([]byte(nil), l.pending[i+1:]...)
+		} else if len(l.pending) > l.maxLine {
+			l.out, l.pending = l.pending, nil
+		}
+	}
+	n := copy(p, l.out)
+	l.out = l.out[n:]
+	return n, nil
+}
+
+func (l *lineRewriter) Close() error {
+	return l.body.Close()
+}
+
+// encodeJSON marshals v without escaping HTML characters, so text passed
+// through keeps its original form
+func encodeJSON(v interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/kcolemangt/llm-router/extension"
+)
+
+// OutcomeClientCancelled is the outcome of requests the client went away from
+// before their answer was complete
+const OutcomeClientCancelled = "client_cancelled"
+
+// StatusClientClosedRequest is recorded, as nginx does, for requests the
+// client went away from before their answer began
+const StatusClientClosedRequest = 499
+
+// CancelStats counts the requests to a backend that clients went away from
+type CancelStats struct {
+	// Requests were cancelled before the backend answered
+	Requests int64 `json:"requests"`
+	// Streams were cancelled while their answer streamed
+	Streams int64 `json:"streams"`
+	// PartialTokensEstimate is the output the cancelled streams had generated
+	PartialTokensEstimate int64 `json:"partial_tokens_estimate"`
+}
+
+// cancellations holds the CancelStats of each backend
+type cancellations struct {
+	sync.Mutex
+	stats map[string]*CancelStats
+}
+
+// cancelledByClient reports whether the request ended because its client went
+// away, rather than because the router stopped it, as when a race is decided
+func cancelledByClient(r *http.Request) bool {
+	return context.Cause(r.Context()) == context.Canceled
+}
+
+// clientCancelled records that the client of a request to backend went away,
+// while its answer streamed or before it began
+func (rt *Router) clientCancelled(r *http.Request, backend string, streaming bool, partialTokens int) {
+	extension.FromRequest(r).Outcome = OutcomeClientCancelled
+	rt.cancellations.Lock()
+	defer rt.cancellations.Unlock()
+	if rt.cancellations.stats == nil {
+		rt.cancellations.stats = make(map[string]*CancelStats)
+	}
+	stats := rt.cancellations.stats[backend]
+	if stats == nil {
+		stats = &CancelStats{}
+		rt.cancellations.stats[backend] = stats
+	}
+	if streaming {
+		stats.Streams++
+		stats.PartialTokensEstimate += int64(partialTokens)
+	} else {
+		stats.Requests++
+	}
+}
+
+// Cancellations returns the requests clients went away from per backend since
+// the router was built
+func (rt *Router) Cancellations() map[string]CancelStats {
+	if rt == nil {
+		return map[string]CancelStats{}
+	}
+	rt.cancellations.Lock()
+	defer rt.cancellations.Unlock()
+	out := make(map[string]CancelStats, len(rt.cancellations.stats))
+	for backend, stats := range rt.cancellations.stats {
+		out[backend] = *stats
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestClientCancelStopsBackend(t *testing.T) {
+	upstreamDone := make(chan struct{}, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+		upstreamDone <- struct{}{}
+	}))
+	defer upstream.Close()
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "cancelling", BaseURL: upstream.URL, Prefix: "c/"}}, Logger: zap.NewNop()})
+
+	send := func(cancel func(context.Context) context.Context) (*httptest.ResponseRecorder, *extension.RequestContext) {
+		rc := &extension.RequestContext{}
+		ctx := cancel(context.Background())
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"slow"}`)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		rt.proxies["c/"].ServeHTTP(rec, extension.WithRequestContext(req, rc))
+		select {
+		case <-upstreamDone:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the backend request to be cancelled")
+		}
+		return rec, rc
+	}
+
+	before := rt.Cancellations()["cancelling"]
+
+	// The client going away
+	rec, rc := send(func(parent context.Context) context.Context {
+		ctx, cancel := context.WithCancel(parent)
+		time.AfterFunc(50*time.Millisecond, cancel)
+		return ctx
+	})
+	if rec.Code != StatusClientClosedRequest || rc.Outcome != OutcomeClientCancelled {
+		t.Errorf("Expected a client_cancelled outcome with status 499, got %d %q", rec.Code, rc.Outcome)
+	}
+	if stats := rt.Cancellations()["cancelling"]; stats.Requests != before.Requests+1 || stats.Streams != before.Streams {
+		t.Errorf("Expected one cancelled request, got %+v", stats)
+	}
+
+	// The router stopping a request, as when a race is decided
+	rec, rc = send(func(parent context.Context) context.Context {
+		ctx, cancel := context.WithCancelCause(parent)
+		time.AfterFunc(50*time.Millisecond, func() { cancel(errors.New("race decided")) })
+		return ctx
+	})
+	if rec.Code == StatusClientClosedRequest || rc.Outcome != "" || rt.Cancellations()["cancelling"].Requests != before.Requests+1 {
+		t.Errorf("Expected a request the router stopped not to count as cancelled, got %d %q", rec.Code, rc.Outcome)
+	}
+}
+
+func TestClientCancelStopsStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello there\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "cancelling-stream", BaseURL: upstream.URL, Prefix: "s/"}}, Logger: zap.NewNop()})
+
+	rc := &extension.RequestContext{}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"slow","stream":true}`)).WithContext(ctx)
+	before := rt.Cancellations()["cancelling-stream"]
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rt.proxies["s/"].ServeHTTP(httptest.NewRecorder(), extension.WithRequestContext(req, rc))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to end once the client went away")
+	}
+	if rc.Outcome != OutcomeClientCancelled {
+		t.Errorf("Expected a client_cancelled outcome, got %q", rc.Outcome)
+	}
+	if stats := rt.Cancellations()["cancelling-stream"]; stats.Streams != before.Streams+1 || stats.PartialTokensEstimate <= before.PartialTokensEstimate {
+		t.Errorf("Expected one cancelled stream with its partial output, got %+v", stats)
+	}
+}
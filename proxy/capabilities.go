@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/ollama"
+)
+
+// capabilityCache keeps what each backend model supports, including failures
+// to find out, so a model is asked about at most once per catalogTTL
+type capabilityCache struct {
+	sync.Mutex
+	entries map[string]capabilityEntry
+}
+
+type capabilityEntry struct {
+	capabilities *model.ModelCapabilityConfig
+	err          error
+	fetched      time.Time
+}
+
+// ModelCapabilities returns what a model of an Ollama backend supports, from
+// the capabilities and context length Ollama's /api/show reports for it
+func (rt *Router) ModelCapabilities(backend model.BackendConfig, modelName string) (*model.ModelCapabilityConfig, error) {
+	key := backend.Name + "\x00" + modelName
+	rt.capabilities.Lock()
+	entry, ok := rt.capabilities.entries[key]
+	rt.capabilities.Unlock()
+	if ok && time.Since(entry.fetched) < catalogTTL {
+		return entry.capabilities, entry.err
+	}
+
+	client, err := rt.ollamaClient(backend)
+	if err == nil {
+		entry.capabilities, entry.err = fetchCapabilities(client, modelName)
+	} else {
+		entry.capabilities, entry.err = nil, err
+	}
+	entry.fetched = time.Now()
+	rt.capabilities.Lock()
+	if rt.capabilities.entries == nil {
+		rt.capabilities.entries = make(map[string]capabilityEntry)
+	}
+	rt.capabilities.entries[key] = entry
+	rt.capabilities.Unlock()
+	return entry.capabilities, entry.err
+}
+
+// fetchCapabilities asks an Ollama server about a model
+func fetchCapabilities(client *ollama.Client, modelName string) (*model.ModelCapabilityConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), catalogTimeout)
+	defer cancel()
+	details, err := client.Show(ctx, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	supported := func(capability string) *bool {
+		ok := slices.Contains(details.Capabilities, capability)
+		return &ok
+	}
+	always := true
+	capabilities := &model.ModelCapabilityConfig{Streaming: &always, JSONMode: &always, MaxContext: details.ContextLength()}
+	// Older servers do not report capabilities
+	if len(details.Capabilities) > 0 {
+		capabilities.Tools, capabilities.Vision = supported("tools"), supported("vision")
+	}
+	return capabilities, nil
+}
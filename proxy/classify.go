@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Classes of backend errors
+const (
+	ClassAuth          = "auth"
+	ClassQuota         = "quota"
+	ClassCapacity      = "capacity"
+	ClassNetwork       = "network"
+	ClassModelNotFound = "model_not_found"
+	ClassInvalid       = "invalid_request"
+	ClassServer        = "server"
+)
+
+// defaultErrorPeek bounds how much of an error response is inspected unless configured
+const defaultErrorPeek = 64 << 10
+
+// Classify determines the class of a failed backend response from its status
+// code and body. The body is matched case-insensitively against the messages
+// OpenAI, Anthropic, Groq, Ollama and vLLM use.
+func Classify(status int, body []byte) string {
+	lower := bytes.ToLower(body)
+	has := func(words ...string) bool {
+		for _, word := range words {
+			if bytes.Contains(lower, []byte(word)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("model_not_found", "model not found", "no such model") ||
+		(has("model") && has("not found", "does not exist")):
+		return ClassModelNotFound
+	case status == http.StatusPaymentRequired || has("insufficient_quota", "quota", "billing", "credit balance"):
+		return ClassQuota
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ClassAuth
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == 529 || has("overloaded"):
+		return ClassCapacity
+	case status == http.StatusBadGateway || status == http.StatusGatewayTimeout:
+		return ClassNetwork
+	case status == http.StatusNotFound:
+		return ClassModelNotFound
+	case status >= 500:
+		return ClassServer
+	default:
+		return ClassInvalid
+	}
+}
+
+// Failover reports whether errors of a class mean requests should go to
+// another backend. Auth, quota and request errors would fail the same way
+// again, and must not silently move traffic to a paid fallback.
+func Failover(class string) bool {
+	return class == ClassCapacity || class == ClassNetwork
+}
+
+// errorCounts tallies errors per backend and class
+type errorCounts struct {
+	sync.Mutex
+	counts map[string]map[string]int64
+}
+
+// countError records an error of class for a backend
+func (rt *Router) countError(backend, class string) {
+	rt.errorCounts.Lock()
+	defer rt.errorCounts.Unlock()
+	if rt.errorCounts.counts == nil {
+		rt.errorCounts.counts = make(map[string]map[string]int64)
+	}
+	if rt.errorCounts.counts[backend] == nil {
+		rt.errorCounts.counts[backend] = make(map[string]int64)
+	}
+	rt.errorCounts.counts[backend][class]++
+}
+
+// ErrorCounts returns the number of errors per backend and class since the router was built
+func (rt *Router) ErrorCounts() map[string]map[string]int64 {
+	if rt == nil {
+		return map[string]map[string]int64{}
+	}
+	rt.errorCounts.Lock()
+	defer rt.errorCounts.Unlock()
+	out := make(map[string]map[string]int64, len(rt.errorCounts.counts))
+	for backend, classes := range rt.errorCounts.counts {
+		out[backend] = make(map[string]int64, len(classes))
+		for class, n := range classes {
+			out[backend][class] = n
+		}
+	}
+	return out
+}
+
+// classifyResponse classifies an error response by its first bytes, leaving
+// the whole body readable
+func classifyResponse(resp *http.Response, peek int) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(peek)))
+	if err != nil {
+		return ClassNetwork, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	return Classify(resp.StatusCode, body), nil
+}
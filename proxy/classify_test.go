@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{401, `{"error":{"message":"Incorrect API key provided","code":"invalid_api_key"}}`, ClassAuth},
+		{403, `{"error":"forbidden"}`, ClassAuth},
+		{429, `{"error":{"message":"You exceeded your current quota","code":"insufficient_quota"}}`, ClassQuota},
+		{429, `{"error":{"message":"Rate limit reached for requests"}}`, ClassCapacity},
+		{529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, ClassCapacity},
+		{503, ``, ClassCapacity},
+		{502, ``, ClassNetwork},
+		{404, `{"error":"model 'llama9' not found, try pulling it first"}`, ClassModelNotFound},
+		{404, `{"error":{"message":"The model gpt-5 does not exist","code":"model_not_found"}}`, ClassModelNotFound},
+		{400, `{"error":{"message":"max_tokens is too large"}}`, ClassInvalid},
+		{500, `{"error":"internal"}`, ClassServer},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("Classify(%d, %s) = %s, want %s", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestOnlyCapacityAndNetworkErrorsMarkUnhealthy(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	var status int
+	var body string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer upstream.Close()
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "classify", BaseURL: upstream.URL, Prefix: "c/"}}, Logger: logger})
+
+	send := func(s int, b string) *httptest.ResponseRecorder {
+		status, body = s, b
+		rec := httptest.NewRecorder()
+		rt.proxies["c/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+		return rec
+	}
+
+	rec := send(401, `{"error":"invalid api key"}`)
+	if !rt.Healthy("classify") {
+		t.Errorf("Expected an auth error to leave the backend healthy")
+	}
+	if rec.Header().Get("X-Router-Error-Class") != ClassAuth || !strings.Contains(rec.Body.String(), "invalid api key") {
+		t.Errorf("Expected the error to be classified and passed through, got %v %q", rec.Header(), rec.Body.String())
+	}
+
+	send(503, `{"error":"overloaded"}`)
+	if rt.Healthy("classify") {
+		t.Errorf("Expected a capacity error to mark the backend unhealthy")
+	}
+	send(200, `{}`)
+	if !rt.Healthy("classify") {
+		t.Errorf("Expected a success to mark the backend healthy again")
+	}
+
+	counts := rt.ErrorCounts()["classify"]
+	if counts[ClassAuth] != 1 || counts[ClassCapacity] != 1 {
+		t.Errorf("Unexpected error counts %v", counts)
+	}
+}
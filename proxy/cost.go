@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/extension"
+	"go.uber.org/zap"
+)
+
+// addCost reports the estimated cost of a priced request in the X-Router-Cost
+// header, in US dollars from the usage in the response. Streams report usage
+// after the headers are sent, so their cost is only recorded in the audit log.
+func addCost(resp *http.Response, backend string, logger *zap.Logger) error {
+	rc := extension.FromRequest(resp.Request)
+	if rc.Price == nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" ||
+		strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+	body, ok, err := readResponseBody(resp)
+	if !ok {
+		return err
+	}
+	replaceResponseBody(resp, body)
+	prompt, completion, _, err := audit.Usage(body)
+	if err != nil {
+		return nil
+	}
+
+	cost := rc.Price.Cost(prompt, completion)
+	resp.Header.Set("X-Router-Cost", strconv.FormatFloat(cost, 'f', 6, 64))
+	logger.Info("Request cost",
+		zap.String("requestID", rc.ID),
+		zap.String("keyID", rc.KeyID),
+		zap.String("backend", backend),
+		zap.String("model", rc.Model),
+		zap.Int("promptTokens", prompt),
+		zap.Int("completionTokens", completion),
+		zap.Float64("costUSD", cost))
+	return nil
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/ollama"
+	"go.uber.org/zap"
+)
+
+// DiscoveredModel is an installed model of an Ollama backend, under the backend's prefix
+type DiscoveredModel struct {
+	ID         string
+	Backend    string
+	ModifiedAt time.Time
+}
+
+// discovered holds the installed models of one backend
+type discovered struct {
+	prefix  string
+	aliases bool
+	models  []ollama.Model
+}
+
+// ollamaClient returns a client for the Ollama API of a backend
+func (rt *Router) ollamaClient(backend model.BackendConfig) (*ollama.Client, error) {
+	baseURL := backend.BaseURL
+	if len(backend.Instances) > 0 {
+		baseURL = backend.Instances[0]
+	}
+	transport, err := rt.transportFor(backend)
+	if err != nil {
+		return nil, err
+	}
+	return ollama.New(baseURL, transport)
+}
+
+// Discover keeps track of the installed models of the Ollama backends with
+// discovery configured, polling each one until ctx is done
+func (rt *Router) Discover(ctx context.Context, backends []model.BackendConfig, logger *zap.Logger) {
+	for _, backend := range backends {
+		if backend.Discovery.IntervalSeconds > 0 {
+			go rt.discover(ctx, backend, logger)
+		}
+	}
+}
+
+// discover polls one backend's installed models
+func (rt *Router) discover(ctx context.Context, backend model.BackendConfig, logger *zap.Logger) {
+	client, err := rt.ollamaClient(backend)
+	if err != nil {
+		logger.Error("Cannot discover models", zap.String("backend", backend.Name), zap.Error(err))
+		return
+	}
+	ticker := time.NewTicker(time.Duration(backend.Discovery.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		poll, cancel := context.WithTimeout(ctx, catalogTimeout)
+		models, err := client.Tags(poll)
+		cancel()
+		if err != nil {
+			// The last list is kept while the server is away
+			logger.Warn("Failed to discover models", zap.String("backend", backend.Name), zap.Error(err))
+		} else {
+			rt.setDiscovered(backend, models, logger)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setDiscovered records a backend's installed models, logging what changed,
+// and works out which bare names are unambiguous
+func (rt *Router) setDiscovered(backend model.BackendConfig, models []ollama.Model, logger *zap.Logger) {
+	rt.discoveryMu.Lock()
+	defer rt.discoveryMu.Unlock()
+	if rt.discovered == nil {
+		rt.discovered = make(map[string]discovered)
+	}
+
+	names := func(models []ollama.Model) []string {
+		var list []string
+		for _, m := range models {
+			list = append(list, m.Name)
+		}
+		return list
+	}
+	before, after := names(rt.discovered[backend.Name].models), names(models)
+	var added, removed []string
+	for _, name := range after {
+		if !slices.Contains(before, name) {
+			added = append(added, name)
+		}
+	}
+	for _, name := range before {
+		if !slices.Contains(after, name) {
+			removed = append(removed, name)
+		}
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		logger.Info("Discovered model changes", zap.String("backend", backend.Name),
+			zap.Strings("added", added), zap.Strings("removed", removed))
+	}
+	rt.discovered[backend.Name] = discovered{prefix: backend.Prefix, aliases: backend.Discovery.Aliases, models: models}
+
+	owners := make(map[string][]string)
+	for _, d := range rt.discovered {
+		if !d.aliases {
+			continue
+		}
+		for _, m := range d.models {
+			bare := []string{m.Name}
+			if base, ok := strings.CutSuffix(m.Name, ":latest"); ok {
+				bare = append(bare, base)
+			}
+			for _, name := range bare {
+				owners[name] = append(owners[name], d.prefix+m.Name)
+			}
+		}
+	}
+	rt.bareNames = make(map[string]string)
+	for name, ids := range owners {
+		if len(ids) == 1 {
+			rt.bareNames[name] = ids[0]
+		}
+	}
+}
+
+// Discovered lists the installed models of every discovering backend
+func (rt *Router) Discovered() []DiscoveredModel {
+	rt.discoveryMu.RLock()
+	defer rt.discoveryMu.RUnlock()
+	var list []DiscoveredModel
+	for name, d := range rt.discovered {
+		for _, m := range d.models {
+			list = append(list, DiscoveredModel{ID: d.prefix + m.Name, Backend: name, ModifiedAt: m.ModifiedAt})
+		}
+	}
+	slices.SortFunc(list, func(a, b DiscoveredModel) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
+
+// BareModel returns the prefixed name of the discovered model a bare name
+// stands for, if exactly one backend has a model of that name
+func (rt *Router) BareModel(name string) (string, bool) {
+	rt.discoveryMu.RLock()
+	defer rt.discoveryMu.RUnlock()
+	id, ok := rt.bareNames[name]
+	return id, ok
+}
+
+// BareNames lists the bare names that stand for discovered models
+func (rt *Router) BareNames() []string {
+	rt.discoveryMu.RLock()
+	defer rt.discoveryMu.RUnlock()
+	var names []string
+	for name := range rt.bareNames {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestDiscover(t *testing.T) {
+	var polls atomic.Int32
+	tags := func(models string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/tags" {
+				t.Errorf("Unexpected request to %s", r.URL.Path)
+			}
+			polls.Add(1)
+			io.WriteString(w, models)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	gpu1 := tags(`{"models": [{"name": "llama3:latest", "modified_at": "2024-05-01T12:00:00Z"}, {"name": "qwen2.5:7b"}]}`)
+	gpu2 := tags(`{"models": [{"name": "qwen2.5:7b"}]}`)
+	backends := []model.BackendConfig{
+		{Name: "gpu1", BaseURL: gpu1.URL + "/v1", Prefix: "gpu1/", Discovery: model.DiscoveryConfig{IntervalSeconds: 60, Aliases: true}},
+		{Name: "gpu2", BaseURL: gpu2.URL, Prefix: "gpu2/", Discovery: model.DiscoveryConfig{IntervalSeconds: 60, Aliases: true}},
+		{Name: "openai", BaseURL: "http://unused", Prefix: "openai/"},
+	}
+	rt := NewRouter(&model.Config{Backends: backends, Logger: zap.NewNop()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt.Discover(ctx, backends, zap.NewNop())
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rt.Discovered()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var ids []string
+	for _, m := range rt.Discovered() {
+		ids = append(ids, m.ID)
+	}
+	if len(ids) != 3 || ids[0] != "gpu1/llama3:latest" || ids[1] != "gpu1/qwen2.5:7b" || ids[2] != "gpu2/qwen2.5:7b" {
+		t.Fatalf("Unexpected models: %v", ids)
+	}
+	if polls.Load() != 2 {
+		t.Errorf("Expected one poll per discovering backend, got %d", polls.Load())
+	}
+	if id, ok := rt.BareModel("llama3"); !ok || id != "gpu1/llama3:latest" {
+		t.Errorf("Expected llama3 to stand for gpu1/llama3:latest, got %q", id)
+	}
+	if _, ok := rt.BareModel("qwen2.5:7b"); ok {
+		t.Error("Expected a model on both backends to have no bare name")
+	}
+}
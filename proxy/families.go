@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// FamilyNone, as a backend's model_family, turns family adaptation off
+const FamilyNone = "none"
+
+// Instruction roles a model family can expect system prompts under. Models
+// taking no instructions at all, like o1-mini, are sent them as user messages.
+const (
+	RoleSystem    = "system"
+	RoleDeveloper = "developer"
+	RoleUser      = "user"
+)
+
+// DefaultModelFamilies are the families the router knows, matched after the
+// configured ones and in order, so narrower patterns come first. OpenAI's
+// reasoning models take max_completion_tokens and developer messages, and
+// reject sampling parameters; open-weight models served by Ollama, vLLM or
+// llama.cpp predate both. DeepSeek-R1 and QwQ think aloud in <think> blocks.
+var DefaultModelFamilies = []model.ModelFamilyConfig{
+	{
+		Name:            "openai-reasoning-preview",
+		Models:          []string{"o1-mini*", "o1-preview*"},
+		StripParams:     []string{"temperature", "top_p"},
+		ParamRenames:    map[string]string{"max_tokens": "max_completion_tokens"},
+		InstructionRole: RoleUser,
+		ReasoningEffort: takesEffort(false),
+	},
+	{
+		Name:            "openai-reasoning",
+		Models:          []string{"o1*", "o3*", "o4*", "gpt-5*"},
+		StripParams:     []string{"temperature", "top_p"},
+		ParamRenames:    map[string]string{"max_tokens": "max_completion_tokens"},
+		InstructionRole: RoleDeveloper,
+		ReasoningEffort: takesEffort(true),
+	},
+	{
+		Name:            "deepseek-r1",
+		Models:          []string{"deepseek-r1*", "deepseek-reasoner*", "qwq*"},
+		StripParams:     []string{"temperature", "top_p"},
+		ParamRenames:    map[string]string{"max_completion_tokens": "max_tokens"},
+		InstructionRole: RoleSystem,
+		ReasoningEffort: takesEffort(false),
+		ThinkTags:       true,
+		ThinkOpened:     true,
+	},
+	{
+		Name: "open-weights",
+		Models: []string{"llama*", "codellama*", "qwen*", "mistral*", "mixtral*", "codestral*",
+			"gemma*", "phi*", "deepseek*", "granite*", "starcoder*", "command-r*"},
+		ParamRenames:    map[string]string{"max_completion_tokens": "max_tokens"},
+		InstructionRole: RoleSystem,
+		ReasoningEffort: takesEffort(false),
+	},
+}
+
+// takesEffort returns a ReasoningEffort of its own for a family, so changing
+// one family's setting leaves the others alone
+func takesEffort(supported bool) *bool {
+	return &supported
+}
+
+// LookupFamily returns the family called name among families
+func LookupFamily(families []model.ModelFamilyConfig, name string) (model.ModelFamilyConfig, bool) {
+	for _, family := range families {
+		if family.Name == name {
+			return family, true
+		}
+	}
+	return model.ModelFamilyConfig{}, false
+}
+
+// familyOf returns the first of families with a pattern matching modelName,
+// ignoring case and any organization the name starts with, as in
+// meta-llama/Llama-3.1-8B
+func familyOf(families []model.ModelFamilyConfig, modelName string) (model.ModelFamilyConfig, bool) {
+	name := strings.ToLower(modelName)
+	base := name[strings.LastIndex(name, "/")+1:]
+	for _, family := range families {
+		for _, glob := range family.Models {
+			if ok, _ := path.Match(glob, name); ok {
+				return family, true
+			}
+			if ok, _ := path.Match(glob, base); ok {
+				return family, true
+			}
+		}
+	}
+	return model.ModelFamilyConfig{}, false
+}
+
+// adaptToFamily returns a handler that translates requests to the API of the
+// target model's family: the family the backend pins, or else the one its
+// model name matches. Requests for models of no known family pass unchanged.
+func adaptToFamily(backend model.BackendConfig, families []model.ModelFamilyConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	pinned, isPinned := LookupFamily(families, backend.ModelFamily)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/chat/completions") && !strings.HasSuffix(r.URL.Path, "/responses") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		payload, ok := readJSONBody(r, backend.Name, logger)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		family := pinned
+		if !isPinned {
+			modelName, _ := payload["model"].(string)
+			if family, ok = familyOf(families, modelName); !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		changes := translateForFamily(payload, family)
+		if len(changes) > 0 && writeJSONBody(r, payload) == nil {
+			logger.Debug("Adapted request to model family",
+				zap.String("backend", backend.Name),
+				zap.String("requestID", extension.FromRequest(r).ID),
+				zap.String("family", family.Name),
+				zap.Strings("changes", changes))
+		}
+		if family.ThinkTags && backend.StripThinking {
+			r = r.WithContext(context.WithValue(r.Context(), thinkKey{}, family.ThinkOpened))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// translateForFamily removes the parameters of a chat completions or responses
+// request that family rejects, renames others and the roles of its
+// instructions as family expects, and lists what it changed
+func translateForFamily(payload map[string]interface{}, family model.ModelFamilyConfig) []string {
+	var changes []string
+	strip := family.StripParams
+	if family.ReasoningEffort != nil && !*family.ReasoningEffort {
+		// The responses API sets the effort in a reasoning object
+		strip = append(slices.Clone(strip), "reasoning_effort", "reasoning")
+	}
+	for _, param := range strip {
+		if _, ok := payload[param]; ok {
+			delete(payload, param)
+			changes = append(changes, "stripped "+param)
+		}
+	}
+	for _, from := range sortedKeys(family.ParamRenames) {
+		to := family.ParamRenames[from]
+		value, ok := payload[from]
+		if !ok {
+			continue
+		}
+		delete(payload, from)
+		// A value the client set explicitly under the new name wins
+		if _, exists := payload[to]; !exists {
+			payload[to] = value
+		}
+		changes = append(changes, "renamed "+from+" to "+to)
+	}
+
+	if family.InstructionRole == "" {
+		return changes
+	}
+	renamed := 0
+	for _, key := range []string{"messages", "input"} {
+		items, _ := payload[key].([]interface{})
+		for _, item := range items {
+			message, ok := item.(map[string]interface{})
+			if !ok || message["role"] == family.InstructionRole {
+				continue
+			}
+			if message["role"] == RoleSystem || message["role"] == RoleDeveloper {
+				message["role"] = family.InstructionRole
+				renamed++
+			}
+		}
+	}
+	if renamed > 0 {
+		changes = append(changes, "sent instructions as "+family.InstructionRole+" messages")
+	}
+	return changes
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestRequestsAreAdaptedToModelFamily(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	rt := NewRouter(&model.Config{
+		Backends: []model.BackendConfig{
+			{Name: "cloud", BaseURL: upstream.URL, Prefix: "cloud/"},
+			{Name: "azure", BaseURL: upstream.URL, Prefix: "azure/", ModelFamily: "openai-reasoning"},
+			{Name: "raw", BaseURL: upstream.URL, Prefix: "raw/", ModelFamily: FamilyNone},
+		},
+		ModelFamilies: []model.ModelFamilyConfig{{Name: "house", Models: []string{"o3-house*"}}},
+		Logger:        logger,
+	})
+
+	send := func(prefix, path, body string) {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rt.proxies[prefix].ServeHTTP(httptest.NewRecorder(), extension.WithRequestContext(r, extension.NewRequestContext(r, "")))
+	}
+	role := func(i int) interface{} {
+		messages, _ := received["messages"].([]interface{})
+		if i >= len(messages) {
+			return nil
+		}
+		return messages[i].(map[string]interface{})["role"]
+	}
+
+	send("cloud/", "/v1/chat/completions", `{"model":"o3-mini","max_tokens":500,"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`)
+	if _, ok := received["max_tokens"]; ok || received["max_completion_tokens"] != 500.0 {
+		t.Errorf("Expected max_tokens renamed for a reasoning model, got %v", received)
+	}
+	if role(0) != RoleDeveloper || role(1) != "user" {
+		t.Errorf("Expected the system message sent as a developer message, got %v", received["messages"])
+	}
+
+	send("cloud/", "/v1/chat/completions", `{"model":"meta-llama/Llama-3.1-8B","max_completion_tokens":500,"messages":[{"role":"developer","content":"Be brief."}]}`)
+	if received["max_tokens"] != 500.0 || role(0) != RoleSystem {
+		t.Errorf("Expected an open-weight model to get max_tokens and a system message, got %v", received)
+	}
+
+	send("cloud/", "/v1/chat/completions", `{"model":"gpt-4o","max_tokens":500,"messages":[{"role":"system","content":"Be brief."}]}`)
+	if received["max_tokens"] != 500.0 || role(0) != RoleSystem {
+		t.Errorf("Expected a model of no family unchanged, got %v", received)
+	}
+
+	send("cloud/", "/v1/chat/completions", `{"model":"o3-house-2","max_tokens":500,"messages":[{"role":"system","content":"Be brief."}]}`)
+	if received["max_tokens"] != 500.0 || role(0) != RoleSystem {
+		t.Errorf("Expected a configured family to be matched first, got %v", received)
+	}
+
+	send("cloud/", "/v1/chat/completions", `{"model":"o1-mini","temperature":0.2,"reasoning_effort":"high","messages":[{"role":"developer","content":"Be brief."}]}`)
+	if _, ok := received["temperature"]; ok || role(0) != RoleUser {
+		t.Errorf("Expected o1-mini to get no temperature and instructions as a user message, got %v", received)
+	}
+	if _, ok := received["reasoning_effort"]; ok {
+		t.Errorf("Expected reasoning_effort removed for a model without it, got %v", received)
+	}
+
+	send("cloud/", "/v1/chat/completions", `{"model":"o4-mini","top_p":0.9,"reasoning_effort":"high"}`)
+	if _, ok := received["top_p"]; ok || received["reasoning_effort"] != "high" {
+		t.Errorf("Expected top_p removed and reasoning_effort kept, got %v", received)
+	}
+
+	send("azure/", "/v1/responses", `{"model":"my-deployment","input":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`)
+	input, _ := received["input"].([]interface{})
+	if len(input) != 2 || input[0].(map[string]interface{})["role"] != RoleDeveloper {
+		t.Errorf("Expected the pinned family to apply to any model name, got %v", received)
+	}
+
+	send("raw/", "/v1/chat/completions", `{"model":"o3-mini","max_tokens":500}`)
+	if received["max_tokens"] != 500.0 {
+		t.Errorf("Expected no adaptation with model_family none, got %v", received)
+	}
+}
+
+func TestDefaultFamiliesDoNotShareSettings(t *testing.T) {
+	preview, _ := LookupFamily(DefaultModelFamilies, "openai-reasoning-preview")
+	r1, _ := LookupFamily(DefaultModelFamilies, "deepseek-r1")
+	if preview.ReasoningEffort == r1.ReasoningEffort {
+		t.Error("Expected each family to have a reasoning_effort setting of its own")
+	}
+}
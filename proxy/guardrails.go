@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// applyGuardrails returns a handler that adds the guardrails of the request's
+// API key and of the backend to the prompt: the key's first, then the
+// backend's. It runs after the client's request has been routed, so no
+// client-supplied field can remove them.
+func applyGuardrails(backend model.BackendConfig, guardrails map[string]model.GuardrailConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := backend.Guardrails
+		if key := extension.FromRequest(r).Key; key != nil {
+			names = append(append([]string(nil), key.Guardrails...), backend.Guardrails...)
+		}
+		if len(names) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		payload, ok := readJSONBody(r, backend.Name, logger)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var applied []string
+		for i := len(names) - 1; i >= 0; i-- {
+			// Applied innermost first so the first named ends up outermost
+			if template, ok := guardrails[names[i]]; ok && addGuardrail(payload, template) {
+				applied = append([]string{names[i]}, applied...)
+			}
+		}
+		if len(applied) > 0 && writeJSONBody(r, payload) == nil {
+			logger.Debug("Applied guardrails",
+				zap.String("backend", backend.Name),
+				zap.String("requestID", extension.FromRequest(r).ID),
+				zap.Strings("guardrails", applied))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// addGuardrail adds a guardrail to a chat completions, responses or
+// completions request, and reports whether it found a prompt to add it to
+func addGuardrail(payload map[string]interface{}, g model.GuardrailConfig) bool {
+	if prompt, ok := payload["prompt"].(string); ok {
+		if g.SystemPrompt != "" {
+			prompt = g.SystemPrompt + "\n\n" + g.Prefix + prompt + g.Suffix
+		} else {
+			prompt = g.Prefix + prompt + g.Suffix
+		}
+		payload["prompt"] = prompt
+		return true
+	}
+
+	_, isResponses := payload["input"]
+	if !isResponses {
+		if _, ok := payload["messages"].([]interface{}); !ok {
+			return false
+		}
+	}
+
+	if g.Prefix != "" || g.Suffix != "" {
+		if input, ok := payload["input"].(string); ok {
+			payload["input"] = g.Prefix + input + g.Suffix
+		} else {
+			wrapLatestUserMessage(payload, g.Prefix, g.Suffix, isResponses)
+		}
+	}
+	if g.SystemPrompt != "" {
+		if isResponses {
+			// The responses API keeps the system prompt apart from the input
+			if instructions, _ := payload["instructions"].(string); instructions != "" {
+				payload["instructions"] = g.SystemPrompt + "\n\n" + instructions
+			} else {
+				payload["instructions"] = g.SystemPrompt
+			}
+		} else {
+			messages, _ := payload["messages"].([]interface{})
+			system := map[string]interface{}{"role": "system", "content": g.SystemPrompt}
+			payload["messages"] = append([]interface{}{system}, messages...)
+		}
+	}
+	return true
+}
+
+// wrapLatestUserMessage adds prefix and suffix around the content of the most
+// recent user message, as text parts if its content has several parts
+func wrapLatestUserMessage(payload map[string]interface{}, prefix, suffix string, isResponses bool) {
+	messages, _ := payload["messages"].([]interface{})
+	partType := "text"
+	if isResponses {
+		messages, _ = payload["input"].([]interface{})
+		partType = "input_text"
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		message, _ := messages[i].(map[string]interface{})
+		if message["role"] != "user" {
+			continue
+		}
+		switch content := message["content"].(type) {
+		case string:
+			message["content"] = prefix + content + suffix
+		case []interface{}:
+			parts := content
+			if prefix != "" {
+				parts = append([]interface{}{map[string]interface{}{"type": partType, "text": prefix}}, parts...)
+			}
+			if suffix != "" {
+				parts = append(parts, map[string]interface{}{"type": partType, "text": suffix})
+			}
+			message["content"] = parts
+		}
+		return
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestGuardrailsAreAddedForKeyAndBackend(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	rt := NewRouter(&model.Config{
+		Backends: []model.BackendConfig{{
+			Name: "up", BaseURL: upstream.URL, Prefix: "up/", Guardrails: []string{"reminder"},
+		}},
+		Guardrails: map[string]model.GuardrailConfig{
+			"hostnames": {SystemPrompt: "Never reveal internal hostnames."},
+			"reminder":  {Prefix: "[policy] ", Suffix: " [end]"},
+		},
+		Logger: logger,
+	})
+
+	send := func(path, body string, key *model.APIKeyConfig) {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rc := extension.NewRequestContext(r, "")
+		rc.Key = key
+		rt.proxies["up/"].ServeHTTP(httptest.NewRecorder(), extension.WithRequestContext(r, rc))
+	}
+	key := &model.APIKeyConfig{Name: "contractor", Guardrails: []string{"hostnames"}}
+
+	send("/v1/chat/completions", `{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`, key)
+	messages, _ := received["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("Expected the guardrail system message to be added, got %v", received)
+	}
+	if first := messages[0].(map[string]interface{}); first["role"] != "system" || first["content"] != "Never reveal internal hostnames." {
+		t.Errorf("Expected the key's system prompt first, got %v", first)
+	}
+	if last := messages[2].(map[string]interface{}); last["content"] != "[policy] hi [end]" {
+		t.Errorf("Expected the backend's prefix and suffix around the user message, got %v", last)
+	}
+
+	send("/v1/responses", `{"instructions":"Be brief.","input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}]}`, key)
+	if received["instructions"] != "Never reveal internal hostnames.\n\nBe brief." {
+		t.Errorf("Expected the system prompt before the instructions, got %v", received["instructions"])
+	}
+	input, _ := received["input"].([]interface{})
+	if parts := input[0].(map[string]interface{})["content"].([]interface{}); len(parts) != 3 ||
+		parts[0].(map[string]interface{})["text"] != "[policy] " || parts[2].(map[string]interface{})["type"] != "input_text" {
+		t.Errorf("Expected the prefix and suffix as input_text parts, got %v", parts)
+	}
+
+	send("/v1/chat/completions", `{"messages":[{"role":"user","content":"hi"}]}`, nil)
+	messages, _ = received["messages"].([]interface{})
+	if len(messages) != 1 || messages[0].(map[string]interface{})["content"] != "[policy] hi [end]" {
+		t.Errorf("Expected only the backend's guardrail without a named key, got %v", messages)
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// applyHeaderRules removes the client headers matching a backend's
+// remove_headers, except those matching its pass_headers, then sets its
+// OpenAI organization and project and its set_headers. It returns the names
+// of the removed headers.
+func applyHeaderRules(header http.Header, backend model.BackendConfig) []string {
+	var removed []string
+	if len(backend.RemoveHeaders) > 0 {
+		for name := range header {
+			if matchesHeader(backend.RemoveHeaders, name) && !matchesHeader(backend.PassHeaders, name) {
+				header.Del(name)
+				removed = append(removed, name)
+			}
+		}
+	}
+	setOpenAIAccount(header, backend)
+	for name, value := range backend.SetHeaders {
+		header.Set(name, value)
+	}
+	return removed
+}
+
+// setOpenAIAccount sets the OpenAI organization and project a backend's
+// usage is billed to, replacing any the client sent
+func setOpenAIAccount(header http.Header, backend model.BackendConfig) {
+	if backend.OpenAIOrg != "" {
+		header.Set("OpenAI-Organization", backend.OpenAIOrg)
+	}
+	if backend.OpenAIProject != "" {
+		header.Set("OpenAI-Project", backend.OpenAIProject)
+	}
+}
+
+// matchesHeader reports whether a header name matches one of patterns,
+// ignoring case. A pattern ending in * matches every name it begins.
+func matchesHeader(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestHeaderRules(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+	backend := model.BackendConfig{
+		Name:          "headers",
+		BaseURL:       upstream.URL,
+		Prefix:        "h/",
+		SetHeaders:    map[string]string{"OpenAI-Organization": "org-router", "X-Team": "search"},
+		RemoveHeaders: []string{"x-stainless-*", "Anthropic-*", "X-Team"},
+		PassHeaders:   []string{"anthropic-version"},
+		OpenAIProject: "proj_search",
+	}
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{backend}, Logger: zap.NewNop()})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	req.Header.Set("X-Stainless-OS", "MacOS")
+	req.Header.Set("X-Stainless-Runtime-Version", "v20")
+	req.Header.Set("Anthropic-Beta", "tools-2024")
+	req.Header.Set("Anthropic-Version", "2023-06-01")
+	req.Header.Set("OpenAI-Organization", "org-client")
+	req.Header.Set("X-Team", "client")
+	req.Header.Set("OpenAI-Project", "proj_client")
+	req.Header.Set("User-Agent", "OpenAI/JS 4.0")
+	rt.proxies["h/"].ServeHTTP(httptest.NewRecorder(), req)
+
+	for name, want := range map[string]string{
+		"X-Stainless-Os":              "",
+		"X-Stainless-Runtime-Version": "",
+		"Anthropic-Beta":              "",
+		"Anthropic-Version":           "2023-06-01",
+		"Openai-Organization":         "org-router",
+		"X-Team":                      "search",
+		"Openai-Project":              "proj_search",
+		"User-Agent":                  "OpenAI/JS 4.0",
+	} {
+		if got.Get(name) != want {
+			t.Errorf("Expected %s to be %q, got %q", name, want, got.Get(name))
+		}
+	}
+}
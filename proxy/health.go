@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// healthRetry is how long a backend is unhealthy after a failed request,
+// before requests are sent to it again to find out whether it recovered
+const healthRetry = 30 * time.Second
+
+// Healthy reports whether a backend's most recent request succeeded or failed
+// only in a way that another backend would not fix, such as an auth or quota
+// error. Network and capacity errors make it unhealthy for healthRetry.
+// Backends that have not been used yet are healthy.
+func (rt *Router) Healthy(name string) bool {
+	if rt == nil {
+		return true
+	}
+	failed, found := rt.health.Load(name)
+	return !found || time.Since(failed.(time.Time)) >= healthRetry
+}
+
+// markHealth records the outcome of a request to a backend
+func (rt *Router) markHealth(name string, ok bool) {
+	if ok {
+		rt.health.Delete(name)
+	} else {
+		rt.health.Store(name, time.Now())
+	}
+}
+
+// makeModifyResponse returns a function that records backend health from upstream
+// responses and applies any response post-processing the backend needs
+func (rt *Router) makeModifyResponse(backend model.BackendConfig, streamLine, errorPeek int, logger *zap.Logger) func(*http.Response) error {
+	responseHook := newHook(backend.Hooks.ResponseURL, backend, logger)
+	return func(resp *http.Response) error {
+		if resp.StatusCode >= http.StatusBadRequest {
+			class, err := classifyResponse(resp, errorPeek)
+			if err != nil {
+				return err
+			}
+			rt.countError(backend.Name, class)
+			rt.markHealth(backend.Name, !Failover(class))
+			resp.Header.Set("X-Router-Error-Class", class)
+			logger.Warn("Backend returned an error",
+				zap.String("backend", backend.Name),
+				zap.Int("status", resp.StatusCode),
+				zap.String("class", class))
+		} else {
+			rt.markHealth(backend.Name, true)
+		}
+		if backend.EmulateJSONSchema {
+			if err := repairStructuredOutput(resp, backend.Name, logger); err != nil {
+				return err
+			}
+		}
+		if err := stripThinking(resp, streamLine); err != nil {
+			return err
+		}
+		if err := injectUsage(resp, streamLine, rt.tokenizers); err != nil {
+			return err
+		}
+		if err := addCost(resp, backend.Name, logger); err != nil {
+			return err
+		}
+		if err := restoreModelName(resp, streamLine); err != nil {
+			return err
+		}
+		return applyResponseHook(resp, responseHook)
+	}
+}
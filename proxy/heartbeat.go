@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"go.uber.org/zap"
+)
+
+// sendHeartbeats keeps streaming requests to a backend alive while they wait
+// for its answer, sending the client an SSE comment every interval until the
+// first bytes of the answer arrive. Tunnels and load balancers that close
+// idle connections then leave slow models time to think.
+func sendHeartbeats(name string, interval time.Duration, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if stream, _ := extension.ChatRequest(r)["stream"].(bool); !stream {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hw := &heartbeatWriter{ResponseWriter: w, header: make(http.Header), controller: http.NewResponseController(w)}
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-r.Context().Done():
+					return
+				case <-ticker.C:
+					if !hw.ping() {
+						return
+					}
+				}
+			}
+		}()
+		next.ServeHTTP(hw, r)
+		close(done)
+		<-stopped
+
+		if hw.pings > 0 {
+			logger.Debug("Sent heartbeats before the backend answered",
+				zap.String("backend", name), zap.Int("heartbeats", hw.pings), zap.Int("status", hw.status))
+		}
+		if hw.failed {
+			writeErrorEvent(w, hw.body.Bytes())
+		}
+	})
+}
+
+// heartbeatWriter sends heartbeats to the client until the answer begins.
+// Once a heartbeat has started the response as an event stream, the answer's
+// header is dropped and an error answer held back to be sent as an event.
+type heartbeatWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	header     http.Header
+
+	mu sync.Mutex
+	// started is set when a heartbeat began the response, decided when the
+	// answer's status is known, and flowing when its body begins
+	started, decided, flowing bool
+	// streaming is set when the answer began the response as an event stream
+	streaming bool
+	failed    bool
+	status    int
+	pings     int
+	body      bytes.Buffer
+}
+
+func (h *heartbeatWriter) Header() http.Header {
+	return h.header
+}
+
+func (h *heartbeatWriter) WriteHeader(status int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(status)
+}
+
+// writeHeader decides how the answer reaches the client; h.mu must be held
+func (h *heartbeatWriter) writeHeader(status int) {
+	if h.decided {
+		return
+	}
+	h.decided, h.status = true, status
+	if h.started {
+		h.failed = status != http.StatusOK
+		return
+	}
+	copyHeader(h.ResponseWriter.Header(), h.header)
+	h.ResponseWriter.WriteHeader(status)
+	h.streaming = status == http.StatusOK && strings.HasPrefix(h.header.Get("Content-Type"), "text/event-stream")
+}
+
+func (h *heartbeatWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(http.StatusOK)
+	h.flowing = true
+	if h.failed {
+		return h.body.Write(p)
+	}
+	return h.ResponseWriter.Write(p)
+}
+
+// FlushError flushes the client's connection, never during a heartbeat
+func (h *heartbeatWriter) FlushError() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.controller.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to set deadlines
+func (h *heartbeatWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// ping sends a heartbeat, starting the response as an event stream if the
+// answer has not begun. It reports whether more heartbeats may follow.
+func (h *heartbeatWriter) ping() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.flowing || h.decided && !h.started && !h.streaming {
+		return false
+	}
+	if !h.started && !h.decided {
+		h.started = true
+		header := h.ResponseWriter.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		h.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	if _, err := h.ResponseWriter.Write([]byte(": ping\n\n")); err != nil {
+		return false
+	}
+	h.pings++
+	h.controller.Flush()
+	return true
+}
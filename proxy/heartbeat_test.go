@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"go.uber.org/zap"
+)
+
+func TestHeartbeats(t *testing.T) {
+	request := func(stream bool) *http.Request {
+		rc := &extension.RequestContext{}
+		rc.SetChatRequest(map[string]interface{}{"model": "o1", "stream": stream}, nil)
+		return extension.WithRequestContext(httptest.NewRequest("POST", "/v1/chat/completions", nil), rc)
+	}
+	backend := func(delay time.Duration, status int, contentType, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("X-Backend", "yes")
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		})
+	}
+	tests := []struct {
+		name        string
+		stream      bool
+		delay       time.Duration
+		status      int
+		contentType string
+		body        string
+		wantStatus  int
+		wantPing    bool
+		wantBody    string
+	}{
+		{"slow stream", true, 100 * time.Millisecond, 200, "text/event-stream", "data: {}\n\n", 200, true, "data: {}\n\n"},
+		{"slow error", true, 100 * time.Millisecond, 500, "application/json", "{\"error\": {\"message\": \"boom\"}}\n", 200, true, "data: {\"error\":{\"message\":\"boom\"}}\n\n"},
+		{"fast stream", true, 0, 200, "text/event-stream", "data: {}\n\n", 200, false, "data: {}\n\n"},
+		{"fast error", true, 0, 500, "application/json", `{"error": {}}`, 500, false, `{"error": {}}`},
+		{"not streaming", false, 100 * time.Millisecond, 200, "application/json", `{}`, 200, false, `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler := sendHeartbeats("thinking", 20*time.Millisecond, zap.NewNop(), backend(tt.delay, tt.status, tt.contentType, tt.body))
+			handler.ServeHTTP(rec, request(tt.stream))
+			body := rec.Body.String()
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if pinged := strings.HasPrefix(body, ": ping\n\n"); pinged != tt.wantPing {
+				t.Errorf("Expected heartbeats %v, got %q", tt.wantPing, body)
+			}
+			if !strings.HasSuffix(body, tt.wantBody) {
+				t.Errorf("Expected the answer %q after any heartbeats, got %q", tt.wantBody, body)
+			}
+			if tt.wantPing && rec.Header().Get("Content-Type") != "text/event-stream" {
+				t.Errorf("Expected heartbeats to start an event stream, got %q", rec.Header().Get("Content-Type"))
+			}
+			if !tt.wantPing && rec.Header().Get("X-Backend") != "yes" {
+				t.Error("Expected the backend's header when no heartbeat was sent")
+			}
+		})
+	}
+}
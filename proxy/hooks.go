@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// DefaultHookTimeout bounds a hook call when no timeout is configured
+const DefaultHookTimeout = 5 * time.Second
+
+// hookPayload is what a hook service receives
+type hookPayload struct {
+	Stage     string          `json:"stage"`
+	Backend   string          `json:"backend"`
+	RequestID string          `json:"request_id"`
+	Path      string          `json:"path"`
+	Status    int             `json:"status,omitempty"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// hookResult is a hook service's answer. An empty body leaves the original
+// unchanged and a non-empty error rejects the request.
+type hookResult struct {
+	Body  json.RawMessage `json:"body"`
+	Error string          `json:"error"`
+}
+
+// hook calls an external service that may rewrite or reject JSON bodies, so
+// organization-specific logic such as redaction can live outside the router
+type hook struct {
+	url      string
+	backend  string
+	failOpen bool
+	client   *http.Client
+	logger   *zap.Logger
+}
+
+// newHook returns a hook for url, or nil if url is empty
+func newHook(url string, backend model.BackendConfig, logger *zap.Logger) *hook {
+	if url == "" {
+		return nil
+	}
+	timeout := time.Duration(backend.Hooks.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	return &hook{
+		url:      url,
+		backend:  backend.Name,
+		failOpen: backend.Hooks.FailOpen,
+		client:   &http.Client{Timeout: timeout},
+		logger:   logger,
+	}
+}
+
+// call sends body to the hook service and returns the body to use instead.
+// Bodies that are not JSON are passed through without calling the hook.
+func (h *hook) call(ctx context.Context, payload hookPayload) ([]byte, error) {
+	if !json.Valid(payload.Body) {
+		return payload.Body, nil
+	}
+	payload.Backend = h.backend
+
+	result, err := h.post(ctx, payload)
+	if err != nil {
+		if h.failOpen {
+			h.logger.Warn("Hook failed, continuing without it",
+				zap.String("backend", h.backend), zap.String("stage", payload.Stage), zap.Error(err))
+			return payload.Body, nil
+		}
+		h.logger.Error("Hook failed",
+			zap.String("backend", h.backend), zap.String("stage", payload.Stage), zap.Error(err))
+		return nil, utils.NewError(utils.ErrHookFailed, "Hook for backend %s failed: %s", h.backend, err)
+	}
+	if result.Error != "" {
+		h.logger.Info("Hook rejected request",
+			zap.String("backend", h.backend), zap.String("stage", payload.Stage), zap.String("reason", result.Error))
+		return nil, utils.NewError(utils.ErrInvalidRequest, "%s", result.Error)
+	}
+	if len(result.Body) == 0 {
+		return payload.Body, nil
+	}
+	h.logger.Debug("Hook rewrote body", zap.String("backend", h.backend), zap.String("stage", payload.Stage))
+	return result.Body, nil
+}
+
+// post delivers the payload. A 204 response means no change.
+func (h *hook) post(ctx context.Context, payload hookPayload) (hookResult, error) {
+	var result hookResult
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return result, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return result, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("invalid hook response: %w", err)
+	}
+	return result, nil
+}
+
+// applyHooks returns a handler that passes request bodies through the backend's
+// request hook before forwarding them
+func applyHooks(backend model.BackendConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	requestHook := newHook(backend.Hooks.RequestURL, backend, logger)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestHook == nil || r.Method != http.MethodPost || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+			return
+		}
+		body, err = requestHook.call(r.Context(), hookPayload{
+			Stage:     "request",
+			RequestID: extension.FromRequest(r).ID,
+			Path:      r.URL.Path,
+			Body:      body,
+		})
+		if err != nil {
+			utils.WriteErr(w, err)
+			return
+		}
+		replaceBody(r, body)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// applyResponseHook passes a complete JSON response body through the response
+// hook. Streamed responses are forwarded untouched.
+func applyResponseHook(resp *http.Response, h *hook) error {
+	if h == nil || strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	body, err = h.call(resp.Request.Context(), hookPayload{
+		Stage:     "response",
+		RequestID: extension.FromRequest(resp.Request).ID,
+		Path:      resp.Request.URL.Path,
+		Status:    resp.StatusCode,
+		Body:      body,
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// newHookServer answers hook calls by rewriting "secret" to "[redacted]" and
+// rejecting bodies that mention "forbidden"
+func newHookServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload hookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Invalid hook payload: %s", err)
+		}
+		body := string(payload.Body)
+		switch {
+		case strings.Contains(body, "forbidden"):
+			io.WriteString(w, `{"error":"forbidden content"}`)
+		case strings.Contains(body, "secret"):
+			json.NewEncoder(w).Encode(hookResult{Body: json.RawMessage(strings.ReplaceAll(body, "secret", "[redacted]"))})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHooksRewriteRequestAndResponse(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	hooks := newHookServer(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "secret") {
+			t.Errorf("Expected the request hook to redact the body, got %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"the secret is out"}}]}`)
+	}))
+	defer upstream.Close()
+
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{
+		Name:    "up",
+		BaseURL: upstream.URL,
+		Prefix:  "up/",
+		Hooks:   model.HookConfig{RequestURL: hooks.URL, ResponseURL: hooks.URL},
+	}}, Logger: logger})
+
+	rec := httptest.NewRecorder()
+	rt.proxies["up/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"my secret"}]}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "the [redacted] is out") {
+		t.Errorf("Expected the response hook to redact the response, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	rt.proxies["up/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"forbidden"}]}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "forbidden content") {
+		t.Errorf("Expected the request hook to reject the request, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHookFailure(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{}`)
+	}))
+	defer upstream.Close()
+
+	for _, failOpen := range []bool{false, true} {
+		rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{
+			Name:    "up",
+			BaseURL: upstream.URL,
+			Prefix:  "up/",
+			Hooks:   model.HookConfig{RequestURL: "http://127.0.0.1:1/unreachable", FailOpen: failOpen},
+		}}, Logger: logger})
+
+		rec := httptest.NewRecorder()
+		rt.proxies["up/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+		want := http.StatusBadGateway
+		if failOpen {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Errorf("Expected status %d with fail_open=%v, got %d: %s", want, failOpen, rec.Code, rec.Body.String())
+		}
+	}
+}
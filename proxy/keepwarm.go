@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// defaultKeepWarmInterval is within Ollama's default keep_alive of five minutes
+const defaultKeepWarmInterval = 4 * time.Minute
+
+// warmTimeout bounds a keep-warm request, which may have to load the model
+const warmTimeout = 2 * time.Minute
+
+// KeepWarm keeps the models of the backends with keep_warm configured loaded,
+// sending each model a request periodically until ctx is done. Schedules are
+// read in location, the local time zone if nil.
+func (rt *Router) KeepWarm(ctx context.Context, backends []model.BackendConfig, location *time.Location, logger *zap.Logger) {
+	if location == nil {
+		location = time.Local
+	}
+	for _, backend := range backends {
+		if len(backend.KeepWarm.Models) > 0 {
+			go rt.keepWarm(ctx, backend, location, logger)
+		}
+	}
+}
+
+// keepWarm keeps one backend's models loaded during its schedule
+func (rt *Router) keepWarm(ctx context.Context, backend model.BackendConfig, location *time.Location, logger *zap.Logger) {
+	interval := defaultKeepWarmInterval
+	if backend.KeepWarm.IntervalSeconds > 0 {
+		interval = time.Duration(backend.KeepWarm.IntervalSeconds) * time.Second
+	}
+	var windows []Window
+	for _, config := range backend.KeepWarm.Schedule {
+		// Validated with the configuration
+		window, _ := ParseWindow(config)
+		windows = append(windows, window)
+	}
+	scheduled := func() bool {
+		now := time.Now().In(location)
+		return len(windows) == 0 || slices.ContainsFunc(windows, func(w Window) bool { return w.Contains(now) })
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// Models may still be loaded from before a restart
+	warmed := true
+	for {
+		if scheduled() {
+			for _, name := range backend.KeepWarm.Models {
+				start := time.Now()
+				if err := rt.warm(ctx, backend, name); err != nil {
+					logger.Warn("Failed to keep model warm", zap.String("backend", backend.Name), zap.String("model", name), zap.Error(err))
+				} else {
+					logger.Debug("Kept model warm", zap.String("backend", backend.Name), zap.String("model", name),
+						zap.Duration("duration", time.Since(start)))
+				}
+			}
+			warmed = true
+		} else if warmed {
+			rt.release(ctx, backend, logger)
+			warmed = false
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// release has Ollama unload a backend's models outside their schedule. Other
+// backends unload idle models on their own, if at all.
+func (rt *Router) release(ctx context.Context, backend model.BackendConfig, logger *zap.Logger) {
+	if backend.KeepWarm.KeepAlive == "" {
+		return
+	}
+	client, err := rt.ollamaClient(backend)
+	if err != nil {
+		logger.Warn("Failed to release models", zap.String("backend", backend.Name), zap.Error(err))
+		return
+	}
+	for _, name := range backend.KeepWarm.Models {
+		unload, cancel := context.WithTimeout(ctx, warmTimeout)
+		err := client.Load(unload, name, "0")
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to release model", zap.String("backend", backend.Name), zap.String("model", name), zap.Error(err))
+		} else {
+			logger.Info("Released model outside its keep-warm schedule", zap.String("backend", backend.Name), zap.String("model", name))
+		}
+	}
+}
+
+// warm has a backend load a model: Ollama through its API when a keep_alive
+// is configured, any other backend by answering a one-token chat completion
+func (rt *Router) warm(ctx context.Context, backend model.BackendConfig, modelName string) error {
+	ctx, cancel := context.WithTimeout(ctx, warmTimeout)
+	defer cancel()
+	if keepAlive := backend.KeepWarm.KeepAlive; keepAlive != "" {
+		client, err := rt.ollamaClient(backend)
+		if err != nil {
+			return err
+		}
+		return client.Load(ctx, modelName, keepAlive)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      modelName,
+		"messages":   []map[string]string{{"role": "user", "content": "hi"}},
+		"max_tokens": 1,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Sent through the backend's proxy so it carries the backend's key and paths
+	answer := &discardWriter{header: make(http.Header)}
+	rt.proxies[rt.prefixes[backend.Name]].ServeHTTP(answer, req)
+	if answer.status != http.StatusOK {
+		return fmt.Errorf("backend answered with status %d", answer.status)
+	}
+	return nil
+}
+
+// discardWriter keeps only the status of an answer
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (d *discardWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardWriter) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+}
+
+func (d *discardWriter) Write(p []byte) (int, error) {
+	d.WriteHeader(http.StatusOK)
+	return len(p), nil
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestKeepWarm(t *testing.T) {
+	var mu sync.Mutex
+	pings := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		pings[r.URL.Path+" "+body["model"].(string)] = body
+		mu.Unlock()
+		w.Write([]byte(`{"done": true}`))
+	}))
+	defer server.Close()
+	backends := []model.BackendConfig{
+		{Name: "warm-ollama", BaseURL: server.URL, Prefix: "o/", KeepWarm: model.KeepWarmConfig{Models: []string{"llama3"}, KeepAlive: "-1"}},
+		{Name: "warm-llamacpp", BaseURL: server.URL, Prefix: "l/", KeepWarm: model.KeepWarmConfig{Models: []string{"qwen"}}},
+	}
+	rt := NewRouter(&model.Config{Backends: backends, Logger: zap.NewNop()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt.KeepWarm(ctx, backends, nil, zap.NewNop())
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(pings)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if load := pings["/api/generate llama3"]; load == nil || load["keep_alive"] != float64(-1) || load["prompt"] != nil {
+		t.Errorf("Expected Ollama to be asked to keep llama3 loaded, got %v", pings)
+	}
+	if chat := pings["/v1/chat/completions qwen"]; chat == nil || chat["max_tokens"] != float64(1) {
+		t.Errorf("Expected a one-token completion for qwen, got %v", pings)
+	}
+}
+
+func TestKeepWarmReleasesOutsideSchedule(t *testing.T) {
+	loads := make(chan map[string]interface{}, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		loads <- body
+		w.Write([]byte(`{"done": true}`))
+	}))
+	defer server.Close()
+	// A window starting in two hours does not include now
+	now := time.Now().UTC()
+	window := model.KeepWarmWindow{Start: now.Add(2 * time.Hour).Format("15:04"), End: now.Add(3 * time.Hour).Format("15:04")}
+	backends := []model.BackendConfig{{Name: "scheduled", BaseURL: server.URL, Prefix: "s/",
+		KeepWarm: model.KeepWarmConfig{Models: []string{"llama3"}, KeepAlive: "-1", Schedule: []model.KeepWarmWindow{window}}}}
+	rt := NewRouter(&model.Config{Backends: backends, Logger: zap.NewNop()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt.KeepWarm(ctx, backends, time.UTC, zap.NewNop())
+	select {
+	case load := <-loads:
+		if load["model"] != "llama3" || load["keep_alive"] != float64(0) {
+			t.Errorf("Expected llama3 to be unloaded, got %v", load)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the model to be released outside its schedule")
+	}
+}
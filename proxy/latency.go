@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// latencyWeight is how much each new measurement moves a backend's average
+const latencyWeight = 0.3
+
+// latencies holds the moving average of each backend's time to response headers
+type latencies struct {
+	sync.Mutex
+	byBackend map[string]time.Duration
+}
+
+// Latency returns the exponentially weighted moving average of the time a
+// backend takes to answer with response headers, and whether it was measured
+func (rt *Router) Latency(name string) (time.Duration, bool) {
+	if rt == nil {
+		return 0, false
+	}
+	rt.latencies.Lock()
+	defer rt.latencies.Unlock()
+	d, ok := rt.latencies.byBackend[name]
+	return d, ok
+}
+
+// recordLatency adds a measurement to a backend's moving average
+func (rt *Router) recordLatency(name string, d time.Duration) {
+	rt.latencies.Lock()
+	defer rt.latencies.Unlock()
+	if rt.latencies.byBackend == nil {
+		rt.latencies.byBackend = make(map[string]time.Duration)
+	}
+	if avg, ok := rt.latencies.byBackend[name]; ok {
+		d = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(avg))
+	}
+	rt.latencies.byBackend[name] = d
+}
+
+// timedTransport measures how long a backend takes to start answering. Server
+// errors and failed requests are left out of the moving average, which they
+// would shorten, but count as failures in the rolling statistics.
+type timedTransport struct {
+	http.RoundTripper
+	backend string
+	rt      *Router
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err == nil && resp.StatusCode < http.StatusInternalServerError {
+		t.rt.recordLatency(t.backend, elapsed)
+	}
+	// A client hanging up says nothing about the backend
+	if req.Context().Err() == nil {
+		t.rt.recordRequest(t.backend, elapsed, err != nil || failedStatus(resp.StatusCode))
+	}
+	return resp, err
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// Limiter caps the number of in-flight requests to a backend, optionally
+// holding excess requests in a bounded queue until a slot frees up. Queued
+// requests are served by priority class, then in arrival order.
+type Limiter struct {
+	name          string
+	maxConcurrent int
+	maxQueue      int
+	timeout       time.Duration
+	logger        *zap.Logger
+	// classes order queued requests by priority
+	classes []model.PriorityClass
+
+	mu      sync.Mutex
+	active  int
+	waiters []*waiter
+}
+
+// waiter is a queued request. ready receives true when it is handed a slot
+// and false when a higher-priority request pushes it out of the queue.
+type waiter struct {
+	priority int
+	ready    chan bool
+}
+
+// NewLimiter returns a limiter allowing maxConcurrent in-flight requests and up to
+// maxQueue waiting requests. A zero timeout waits until the client goes away.
+func NewLimiter(name string, maxConcurrent, maxQueue int, timeout time.Duration, logger *zap.Logger) *Limiter {
+	return &Limiter{
+		name:          name,
+		maxConcurrent: maxConcurrent,
+		maxQueue:      maxQueue,
+		timeout:       timeout,
+		logger:        logger,
+	}
+}
+
+// Acquire reserves an in-flight slot, returning false if the backend is saturated
+func (l *Limiter) Acquire(r *http.Request) bool {
+	class := PriorityFor(l.classes, extension.FromRequest(r))
+	fields := []zap.Field{zap.String("backend", l.name), zap.String("priorityClass", class.Name)}
+
+	l.mu.Lock()
+	// Fast path: a slot is free and nobody is waiting for it
+	if l.active < l.maxConcurrent && len(l.waiters) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return true
+	}
+	if class.Shed {
+		l.mu.Unlock()
+		l.logger.Info("Request shed while backend is busy", fields...)
+		return false
+	}
+
+	// Otherwise take a place in the queue, pushing out a lower-priority
+	// request if it is full
+	if len(l.waiters) >= l.maxQueue {
+		last := len(l.waiters) - 1
+		if last < 0 || l.waiters[last].priority >= class.Priority {
+			l.mu.Unlock()
+			l.logger.Warn("Backend saturated and queue full", fields...)
+			return false
+		}
+		l.waiters[last].ready <- false
+		l.waiters = l.waiters[:last]
+	}
+	w := &waiter{priority: class.Priority, ready: make(chan bool, 1)}
+	i := len(l.waiters)
+	for i > 0 && l.waiters[i-1].priority < w.priority {
+		i--
+	}
+	l.waiters = slices.Insert(l.waiters, i, w)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	l.logger.Debug("Request queued for backend", fields...)
+	select {
+	case granted := <-w.ready:
+		if !granted {
+			l.logger.Info("Request pushed out of the backend queue by higher-priority traffic", fields...)
+		}
+		return granted
+	case <-timeout:
+		l.logger.Warn("Timed out waiting in backend queue", fields...)
+	case <-r.Context().Done():
+		l.logger.Info("Client went away while queued", fields...)
+	}
+	l.abandon(w)
+	return false
+}
+
+// abandon takes a waiter that gave up out of the queue, passing on a slot it
+// was handed in the meantime
+func (l *Limiter) abandon(w *waiter) {
+	l.mu.Lock()
+	for i, other := range l.waiters {
+		if other == w {
+			l.waiters = slices.Delete(l.waiters, i, i+1)
+			l.mu.Unlock()
+			return
+		}
+	}
+	l.mu.Unlock()
+	if <-w.ready {
+		l.Release()
+	}
+}
+
+// Release frees a slot previously reserved with Acquire, handing it to the
+// first waiter if there is one
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) > 0 {
+		w := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		w.ready <- true
+		return
+	}
+	l.active--
+}
+
+// Wrap returns a handler that enforces the limiter in front of next
+func (l *Limiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Acquire(r) {
+			utils.WriteErr(w, utils.NewError(utils.ErrBackendSaturated, "Backend %s is at capacity, try again later", l.name))
+			return
+		}
+		defer l.Release()
+		next.ServeHTTP(w, r)
+	})
+}
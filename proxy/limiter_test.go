@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestLimiterRejectsWhenSaturated(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	limiter := NewLimiter("test", 1, 0, 0, logger)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := limiter.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rec.Code)
+	}
+	close(release)
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	limiter := NewLimiter("test", 1, 1, 50*time.Millisecond, logger)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	if !limiter.Acquire(req) {
+		t.Fatalf("Expected first request to acquire a slot")
+	}
+
+	start := time.Now()
+	if limiter.Acquire(req) {
+		t.Errorf("Expected queued request to time out")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Expected queued request to wait for the timeout")
+	}
+
+	limiter.Release()
+	if !limiter.Acquire(req) {
+		t.Errorf("Expected request to acquire a slot after release")
+	}
+}
+
+// keyRequest returns a request sent with the named API key
+func keyRequest(key string) *http.Request {
+	req := httptest.NewRequest("POST", "/", nil)
+	return extension.WithRequestContext(req, &extension.RequestContext{Key: &model.APIKeyConfig{Name: key}})
+}
+
+// waitQueued waits until n requests are queued on the limiter
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		queued := len(l.waiters)
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %d queued requests", n)
+}
+
+func TestLimiterServesHigherPriorityFirst(t *testing.T) {
+	limiter := NewLimiter("test", 1, 2, 0, zap.NewNop())
+	limiter.classes = []model.PriorityClass{
+		{Name: "interactive", Priority: 10, Keys: []string{"cursor"}},
+		{Name: "batch", Priority: -10, Keys: []string{"eval"}},
+	}
+	if !limiter.Acquire(keyRequest("eval")) {
+		t.Fatal("Expected the first request to acquire a slot")
+	}
+
+	order := make(chan string, 2)
+	for i, key := range []string{"eval", "cursor"} {
+		go func() {
+			if limiter.Acquire(keyRequest(key)) {
+				order <- key
+			}
+		}()
+		waitQueued(t, limiter, i+1)
+	}
+
+	limiter.Release()
+	if first := <-order; first != "cursor" {
+		t.Errorf("Expected the interactive request to jump the queue, got %s first", first)
+	}
+	limiter.Release()
+	if second := <-order; second != "eval" {
+		t.Errorf("Expected the batch request next, got %s", second)
+	}
+}
+
+func TestLimiterPushesOutLowerPriorityWhenQueueIsFull(t *testing.T) {
+	limiter := NewLimiter("test", 1, 1, 0, zap.NewNop())
+	limiter.classes = []model.PriorityClass{
+		{Name: "interactive", Priority: 10, Keys: []string{"cursor"}},
+		{Name: "batch", Priority: -10, Keys: []string{"eval"}},
+	}
+	limiter.Acquire(keyRequest("eval"))
+
+	pushedOut := make(chan bool)
+	go func() { pushedOut <- !limiter.Acquire(keyRequest("eval")) }()
+	waitQueued(t, limiter, 1)
+
+	granted := make(chan bool)
+	go func() { granted <- limiter.Acquire(keyRequest("cursor")) }()
+	if !<-pushedOut {
+		t.Error("Expected the queued batch request to be refused")
+	}
+	// An equal or lower priority does not displace anyone
+	if limiter.Acquire(keyRequest("eval")) {
+		t.Error("Expected a batch request to be refused while the queue is full")
+	}
+	limiter.Release()
+	if !<-granted {
+		t.Error("Expected the interactive request to be served")
+	}
+}
+
+func TestLimiterShedsClassWhenBusy(t *testing.T) {
+	limiter := NewLimiter("test", 1, 5, 0, zap.NewNop())
+	limiter.classes = []model.PriorityClass{{Name: "batch", Models: []string{"ollama/*"}, Shed: true}}
+
+	shed := extension.WithRequestContext(httptest.NewRequest("POST", "/", nil), &extension.RequestContext{Model: "ollama/llama3"})
+	if !limiter.Acquire(shed) {
+		t.Fatal("Expected a shed class to be served while a slot is free")
+	}
+	if limiter.Acquire(shed) {
+		t.Error("Expected a shed class to be refused instead of queued")
+	}
+	limiter.Release()
+}
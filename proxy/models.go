@@ -0,0 +1,293 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// catalogTTL is how long a backend's model list is reused before it is fetched again
+const catalogTTL = 5 * time.Minute
+
+// catalog caches the models each backend reports from GET /v1/models
+type catalog struct {
+	sync.Mutex
+	entries map[string]catalogEntry
+}
+
+type catalogEntry struct {
+	models  []string
+	fetched time.Time
+}
+
+// catalogTimeout bounds model listing; discovery must not hold up a failing request for long
+const catalogTimeout = 5 * time.Second
+
+// BackendModels returns the models a backend offers, from cache when fresh
+func (rt *Router) BackendModels(backend model.BackendConfig) ([]string, error) {
+	rt.catalog.Lock()
+	entry, ok := rt.catalog.entries[backend.Name]
+	rt.catalog.Unlock()
+	if ok && time.Since(entry.fetched) < catalogTTL {
+		return entry.models, nil
+	}
+
+	baseURL := backend.BaseURL
+	if len(backend.Instances) > 0 {
+		baseURL = backend.Instances[0]
+	}
+	transport, err := rt.transportFor(backend)
+	if err != nil {
+		return nil, err
+	}
+	models, err := fetchModels(baseURL, backend, transport)
+	if err != nil {
+		return nil, err
+	}
+	rt.catalog.Lock()
+	if rt.catalog.entries == nil {
+		rt.catalog.entries = make(map[string]catalogEntry)
+	}
+	rt.catalog.entries[backend.Name] = catalogEntry{models: models, fetched: time.Now()}
+	rt.catalog.Unlock()
+	return models, nil
+}
+
+// FetchModels lists the models served at baseURL, one of the backend's URLs,
+// using the backend's key. Listing models is free on every provider, which
+// makes it a safe way to check that a backend works.
+func FetchModels(baseURL string, backend model.BackendConfig) ([]string, error) {
+	transport, err := NewTransport(backend.Transport)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.CloseIdleConnections()
+	return fetchModels(baseURL, backend, transport)
+}
+
+// fetchModels lists the models served at baseURL over transport
+func fetchModels(baseURL string, backend model.BackendConfig, transport http.RoundTripper) ([]string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + rewritePath("/v1/models", backend.PathRewrite)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if backend.RequireAPIKey {
+		if apiKey := os.Getenv(backend.KeyEnvVar); apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+	}
+	// Project keys and organizations see the models of their project
+	setOpenAIAccount(req.Header, backend)
+
+	client := &http.Client{Timeout: catalogTimeout, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing models returned status %d", resp.StatusCode)
+	}
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// nearestModel returns the available model closest to name, if any is close
+// enough to be what the user meant: the same model with or without a tag or
+// version suffix, or a small typo
+func nearestModel(name string, models []string) (string, bool) {
+	lower := strings.ToLower(name)
+	best, bestDistance := "", -1
+	for _, m := range models {
+		candidate := strings.ToLower(m)
+		if strings.HasPrefix(candidate, lower+":") || strings.HasPrefix(candidate, lower+"-") ||
+			strings.HasPrefix(lower, candidate+":") {
+			return m, true
+		}
+		if d := editDistance(lower, candidate); bestDistance < 0 || d < bestDistance {
+			best, bestDistance = m, d
+		}
+	}
+	if bestDistance >= 0 && bestDistance <= max(1, len(name)/5) {
+		return best, true
+	}
+	return "", false
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// handleModelNotFound returns a handler that catches model-not-found errors from
+// the backend. Depending on the backend's configuration it pulls the model and
+// retries, or retries once with the nearest available model or a fallback
+// model; otherwise it answers with an error listing the models the backend
+// offers.
+func (rt *Router) handleModelNotFound(backend model.BackendConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Keep the raw body for a retry; it is only decoded if the model is missing
+		body, err := readBody(r)
+		if err != nil {
+			utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+			return
+		}
+
+		held := &holdWriter{ResponseWriter: w, header: make(http.Header)}
+		next.ServeHTTP(held, r)
+		if !held.held {
+			return
+		}
+
+		var chatReq map[string]interface{}
+		utils.UnmarshalJSON(body, &chatReq)
+		requested, _ := chatReq["model"].(string)
+		if requested == "" {
+			held.release()
+			return
+		}
+
+		if pullsModel(backend, requested) {
+			stream, _ := chatReq["stream"].(bool)
+			rt.pullMissing(w, r, backend, requested, stream, body, logger, next)
+			return
+		}
+
+		models, err := rt.BackendModels(backend)
+		if err != nil {
+			logger.Warn("Could not list backend models", zap.String("backend", backend.Name), zap.Error(err))
+		}
+
+		substitute := ""
+		if backend.ModelNearestMatch {
+			substitute, _ = nearestModel(requested, models)
+		}
+		if substitute == "" || substitute == requested {
+			substitute = backend.ModelFallback
+		}
+		if substitute != "" && substitute != requested {
+			logger.Info("Model not found, retrying with substitute",
+				zap.String("backend", backend.Name),
+				zap.String("requested", requested),
+				zap.String("substitute", substitute))
+			chatReq["model"] = substitute
+			if writeJSONBody(r, chatReq) == nil {
+				w.Header().Set("X-Router-Model-Substituted", requested+" -> "+substitute)
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if len(models) == 0 {
+			held.release()
+			return
+		}
+		utils.WriteErr(w, utils.NewError(utils.ErrModelNotFound,
+			"Model %s is not available on backend %s. Available models: %s",
+			requested, backend.Name, strings.Join(models, ", ")))
+	})
+}
+
+// holdWriter holds back a model-not-found response so the request can be
+// retried or answered differently; any other response passes straight through
+type holdWriter struct {
+	http.ResponseWriter
+	header  http.Header
+	decided bool
+	held    bool
+	status  int
+	body    bytes.Buffer
+}
+
+func (h *holdWriter) Header() http.Header {
+	return h.header
+}
+
+func (h *holdWriter) WriteHeader(status int) {
+	if h.decided {
+		return
+	}
+	h.decided = true
+	h.status = status
+	if h.header.Get("X-Router-Error-Class") == ClassModelNotFound {
+		h.held = true
+		return
+	}
+	copyHeader(h.ResponseWriter.Header(), h.header)
+	h.ResponseWriter.WriteHeader(status)
+}
+
+func (h *holdWriter) Write(p []byte) (int, error) {
+	h.WriteHeader(http.StatusOK)
+	if h.held {
+		return h.body.Write(p)
+	}
+	return h.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (h *holdWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// release sends the held response unchanged
+func (h *holdWriter) release() {
+	copyHeader(h.ResponseWriter.Header(), h.header)
+	h.ResponseWriter.WriteHeader(h.status)
+	h.ResponseWriter.Write(h.body.Bytes())
+}
+
+func copyHeader(dst, src http.Header) {
+	for key, values := range src {
+		dst[key] = values
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestNearestModel(t *testing.T) {
+	models := []string{"llama3:latest", "mistral:7b-instruct", "qwen2.5-coder:7b"}
+	tests := []struct {
+		name, want string
+	}{
+		{"llama3", "llama3:latest"},
+		{"mistral:7b", "mistral:7b-instruct"},
+		{"qwen2.5-coder", "qwen2.5-coder:7b"},
+		{"lama3:latest", "llama3:latest"},
+		{"gpt-4o", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := nearestModel(tt.name, models); got != tt.want {
+			t.Errorf("nearestModel(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newOllamaStub serves /v1/models and answers completions only for installed models
+func newOllamaStub(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			io.WriteString(w, `{"object":"list","data":[{"id":"llama3:latest"},{"id":"mistral:7b"}]}`)
+			return
+		}
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "llama3:latest" && req.Model != "mistral:7b" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":"model '`+req.Model+`' not found, try pulling it first"}`)
+			return
+		}
+		io.WriteString(w, `{"model":"`+req.Model+`"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestModelNotFoundRetriesNearestOrFallback(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	upstream := newOllamaStub(t)
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{
+		{Name: "nearest", BaseURL: upstream.URL, Prefix: "n/", ModelNearestMatch: true},
+		{Name: "fallback", BaseURL: upstream.URL, Prefix: "f/", ModelFallback: "mistral:7b"},
+	}, Logger: logger})
+
+	tests := []struct {
+		prefix, want string
+	}{
+		{"n/", "llama3:latest"},
+		{"f/", "mistral:7b"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		rt.proxies[tt.prefix].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"llama3"}`)))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("Expected %s to retry with %s, got %d: %s", tt.prefix, tt.want, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("X-Router-Model-Substituted"); got != "llama3 -> "+tt.want {
+			t.Errorf("Unexpected substitution header %q", got)
+		}
+	}
+}
+
+func TestModelNotFoundListsAvailableModels(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	upstream := newOllamaStub(t)
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "hint", BaseURL: upstream.URL, Prefix: "h/"}}, Logger: logger})
+
+	rec := httptest.NewRecorder()
+	rt.proxies["h/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "model_not_found") || !strings.Contains(body, "llama3:latest, mistral:7b") {
+		t.Errorf("Expected a hint listing available models, got %s", body)
+	}
+}
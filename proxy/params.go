@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// adjustParams returns a handler that fits top-level JSON parameters to what the
+// backend accepts: unsupported parameters are removed, numeric parameters are
+// clamped to their limits, and parameters are renamed, in that order
+func adjustParams(backend model.BackendConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := readJSONBody(r, backend.Name, logger)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var changes []string
+		for _, param := range backend.StripParams {
+			if _, ok := payload[param]; ok {
+				delete(payload, param)
+				changes = append(changes, "stripped "+param)
+			}
+		}
+		for _, param := range sortedKeys(backend.ParamLimits) {
+			if clamped, ok := clampParam(payload[param], backend.ParamLimits[param]); ok {
+				payload[param] = clamped
+				changes = append(changes, "clamped "+param)
+			}
+		}
+		for _, from := range sortedKeys(backend.ParamRenames) {
+			to := backend.ParamRenames[from]
+			value, ok := payload[from]
+			if !ok {
+				continue
+			}
+			delete(payload, from)
+			// A value the client set explicitly under the new name wins
+			if _, exists := payload[to]; !exists {
+				payload[to] = value
+			}
+			changes = append(changes, "renamed "+from+" to "+to)
+		}
+
+		if len(changes) > 0 && writeJSONBody(r, payload) == nil {
+			logger.Debug("Adjusted parameters for backend",
+				zap.String("backend", backend.Name),
+				zap.Strings("changes", changes))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clampParam returns value limited to [limit.Min, limit.Max] if it is a number outside that range
+func clampParam(value interface{}, limit model.ParamLimit) (json.Number, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return "", false
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case limit.Min != nil && f < *limit.Min:
+		f = *limit.Min
+	case limit.Max != nil && f > *limit.Max:
+		f = *limit.Max
+	default:
+		return "", false
+	}
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), true
+}
+
+// sortedKeys returns the keys of m in order so adjustments are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
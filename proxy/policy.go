@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// Policies for choosing among the models of an alias
+const (
+	// PolicyPriority takes the first model whose backend is healthy
+	PolicyPriority = "priority"
+	// PolicyCheapest takes the model with the lowest estimated cost
+	PolicyCheapest = "cheapest"
+	// PolicyFastest takes the model whose backend answers soonest on average
+	PolicyFastest = "fastest"
+)
+
+// Candidate is one model an alias may route to
+type Candidate struct {
+	Model   string
+	Backend string
+	// Cost is the estimated cost of the request, if Priced
+	Cost   float64
+	Priced bool
+}
+
+// Choose returns the index of the candidate the policy picks. Candidates on
+// unhealthy backends are skipped, and if all of them are, Choose fails with
+// utils.ErrBackendUnhealthy. Ties go to the earlier candidate. Unpriced
+// candidates rank after priced ones, and backends without a latency
+// measurement rank first so they get measured.
+func (rt *Router) Choose(policy string, candidates []Candidate) (int, error) {
+	eligible := make([]int, 0, len(candidates))
+	backends := make([]string, 0, len(candidates))
+	for i, c := range candidates {
+		if rt.Healthy(c.Backend) {
+			eligible = append(eligible, i)
+		}
+		backends = append(backends, c.Backend)
+	}
+	if len(eligible) == 0 {
+		return 0, utils.NewError(utils.ErrBackendUnhealthy, "Every backend the request could go to is unhealthy: %s", strings.Join(backends, ", "))
+	}
+
+	best := eligible[0]
+	for _, i := range eligible[1:] {
+		if rt.better(policy, candidates[i], candidates[best]) {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+// better reports whether the policy prefers a over b
+func (rt *Router) better(policy string, a, b Candidate) bool {
+	switch policy {
+	case PolicyCheapest:
+		if a.Priced != b.Priced {
+			return a.Priced
+		}
+		return a.Priced && a.Cost < b.Cost
+	case PolicyFastest:
+		return rt.latencyOf(a.Backend) < rt.latencyOf(b.Backend)
+	}
+	return false
+}
+
+// latencyOf is a backend's average latency, zero if it was never measured
+func (rt *Router) latencyOf(backend string) time.Duration {
+	d, _ := rt.Latency(backend)
+	return d
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+func TestChoose(t *testing.T) {
+	rt := NewRouter(&model.Config{})
+	rt.recordLatency("policy-slow", 800*time.Millisecond)
+	rt.recordLatency("policy-quick", 100*time.Millisecond)
+	rt.markHealth("policy-down", false)
+
+	candidates := []Candidate{
+		{Model: "down/cheap", Backend: "policy-down", Cost: 0.001, Priced: true},
+		{Model: "slow/mid", Backend: "policy-slow", Cost: 0.01, Priced: true},
+		{Model: "quick/unpriced", Backend: "policy-quick"},
+		{Model: "quick/pricey", Backend: "policy-quick", Cost: 0.05, Priced: true},
+	}
+	for policy, want := range map[string]string{
+		PolicyPriority: "slow/mid",
+		PolicyCheapest: "slow/mid",
+		PolicyFastest:  "quick/unpriced",
+	} {
+		if got, err := rt.Choose(policy, candidates); err != nil || candidates[got].Model != want {
+			t.Errorf("%s: expected %s, got %s (%v)", policy, want, candidates[got].Model, err)
+		}
+	}
+
+	// Unmeasured backends are tried first so they get measured
+	fresh := append([]Candidate{}, candidates[1:]...)
+	fresh = append(fresh, Candidate{Model: "new/model", Backend: "policy-new"})
+	if got, _ := rt.Choose(PolicyFastest, fresh); fresh[got].Model != "new/model" {
+		t.Errorf("Expected the unmeasured backend, got %s", fresh[got].Model)
+	}
+
+	// With every backend down, there is nothing to choose
+	if _, err := rt.Choose(PolicyCheapest, candidates[:1]); !errors.Is(err, utils.ErrBackendUnhealthy) {
+		t.Errorf("Expected ErrBackendUnhealthy, got %v", err)
+	}
+
+	// A backend that failed long enough ago is tried again
+	rt.health.Store("policy-down", time.Now().Add(-healthRetry))
+	if got, err := rt.Choose(PolicyCheapest, candidates); err != nil || got != 0 {
+		t.Errorf("Expected the recovered cheapest backend, got %d (%v)", got, err)
+	}
+}
+
+func TestLatencyMovingAverage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{{Name: "timed", BaseURL: server.URL, Prefix: "timed/", Default: true}}, Logger: zap.NewNop()})
+	defaultProxy(rt).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+	d, ok := rt.Latency("timed")
+	if !ok || d < 20*time.Millisecond {
+		t.Fatalf("Expected a latency of at least 20ms, got %s (%v)", d, ok)
+	}
+
+	rt.recordLatency("timed", d+time.Second)
+	if avg, _ := rt.Latency("timed"); (avg - d - 300*time.Millisecond).Abs() > time.Microsecond {
+		t.Errorf("Expected the average to move 30%% of the way, got %s from %s", avg, d)
+	}
+}
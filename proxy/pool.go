@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// Load balancing strategies for backend pools
+const (
+	RoundRobin = "round_robin"
+	Sticky     = "sticky"
+	// Adaptive shifts traffic away from instances whose latency or error
+	// rate degrades, and back once they recover
+	Adaptive = "adaptive"
+)
+
+// Thresholds of the adaptive strategy. An instance is degraded once its error
+// rate or p95 latency crosses the degrade threshold and recovers only once
+// both are back under the lower recover threshold, so it does not flap.
+// Latencies are relative to the fastest healthy instance, and never count as
+// slow within latencySlack of it.
+const (
+	adaptiveWindow      = 20
+	adaptiveMinRequests = 10
+	degradeErrorRate    = 0.25
+	recoverErrorRate    = 0.1
+	degradeLatency      = 3.0
+	recoverLatency      = 1.5
+	latencySlack        = 100 * time.Millisecond
+	// probeEvery sends every nth request to a degraded instance so its
+	// statistics show when it recovers
+	probeEvery = 5
+)
+
+// DefaultStickyHeader is the header clients can set to pin a conversation to an instance
+const DefaultStickyHeader = "X-Conversation-ID"
+
+// Pool spreads requests for one backend across several instances
+type Pool struct {
+	name      string
+	strategy  string
+	header    string
+	instances []poolInstance
+	next      uint64
+	logger    *zap.Logger
+	// mu guards the degraded flags of the adaptive strategy
+	mu sync.Mutex
+}
+
+type poolInstance struct {
+	url      string
+	handler  http.Handler
+	window   *window
+	degraded bool
+}
+
+// NewPool returns an empty pool using the given strategy, round robin by default
+func NewPool(name, strategy, header string, logger *zap.Logger) *Pool {
+	if strategy == "" {
+		strategy = RoundRobin
+	}
+	if header == "" {
+		header = DefaultStickyHeader
+	}
+	return &Pool{name: name, strategy: strategy, header: header, logger: logger}
+}
+
+// Add registers an instance. Instances are identified by URL for sticky hashing.
+func (p *Pool) Add(url string, handler http.Handler) {
+	p.instances = append(p.instances, poolInstance{url: url, handler: handler, window: newWindow(adaptiveWindow)})
+}
+
+// ServeHTTP implements http.Handler
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	instance := &p.instances[p.pick(r)]
+	p.logger.Debug("Pool instance selected",
+		zap.String("backend", p.name),
+		zap.String("instance", instance.url))
+	if p.strategy != Adaptive {
+		instance.handler.ServeHTTP(w, r)
+		return
+	}
+
+	tw := &timingWriter{ResponseWriter: w, start: time.Now()}
+	instance.handler.ServeHTTP(tw, r)
+	// A client hanging up says nothing about the instance
+	if r.Context().Err() != nil {
+		return
+	}
+	if tw.status == 0 {
+		tw.status, tw.latency = http.StatusOK, time.Since(tw.start)
+	}
+	instance.window.add(tw.latency, failedStatus(tw.status))
+	p.evaluate()
+}
+
+// pick returns the index of the instance for a request
+func (p *Pool) pick(r *http.Request) int {
+	switch p.strategy {
+	case Sticky:
+		if key := p.conversationKey(r); key != "" {
+			return rendezvous(key, p.instances)
+		}
+	case Adaptive:
+		return p.pickAdaptive()
+	}
+	n := atomic.AddUint64(&p.next, 1)
+	return int((n - 1) % uint64(len(p.instances)))
+}
+
+// pickAdaptive takes the healthy instances in turn, except that every
+// probeEvery-th request goes to a degraded one
+func (p *Pool) pickAdaptive() int {
+	n := atomic.AddUint64(&p.next, 1) - 1
+	p.mu.Lock()
+	var healthy, degraded []int
+	for i, instance := range p.instances {
+		if instance.degraded {
+			degraded = append(degraded, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	p.mu.Unlock()
+
+	switch {
+	case len(healthy) == 0:
+		return int(n % uint64(len(p.instances)))
+	case len(degraded) > 0 && n%probeEvery == probeEvery-1:
+		return degraded[(n/probeEvery)%uint64(len(degraded))]
+	}
+	return healthy[n%uint64(len(healthy))]
+}
+
+// evaluate marks instances degraded or recovered from their recent requests
+func (p *Pool) evaluate() {
+	stats := make([]WindowStats, len(p.instances))
+	for i, instance := range p.instances {
+		stats[i] = instance.window.stats()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// The fastest healthy instance is the baseline, or the fastest of all
+	// when every instance is degraded
+	var fastest, fastestOverall time.Duration
+	for i, s := range stats {
+		if s.Requests < adaptiveMinRequests || s.P95 == 0 {
+			continue
+		}
+		if fastestOverall == 0 || s.P95 < fastestOverall {
+			fastestOverall = s.P95
+		}
+		if !p.instances[i].degraded && (fastest == 0 || s.P95 < fastest) {
+			fastest = s.P95
+		}
+	}
+	if fastest == 0 {
+		fastest = fastestOverall
+	}
+
+	for i, s := range stats {
+		instance := &p.instances[i]
+		if s.Requests < adaptiveMinRequests {
+			continue
+		}
+		slow := func(factor float64) bool {
+			return fastest > 0 && float64(s.P95) > factor*float64(fastest) && s.P95 > fastest+latencySlack
+		}
+		switch {
+		case !instance.degraded && (s.ErrorRate >= degradeErrorRate || slow(degradeLatency)):
+			instance.degraded = true
+			p.logger.Warn("Pool instance degraded, shifting traffic away",
+				zap.String("backend", p.name),
+				zap.String("instance", instance.url),
+				zap.Duration("p50", s.P50),
+				zap.Duration("p95", s.P95),
+				zap.Float64("errorRate", s.ErrorRate))
+		case instance.degraded && s.ErrorRate <= recoverErrorRate && !slow(recoverLatency):
+			instance.degraded = false
+			p.logger.Info("Pool instance recovered",
+				zap.String("backend", p.name),
+				zap.String("instance", instance.url),
+				zap.Duration("p50", s.P50),
+				zap.Duration("p95", s.P95),
+				zap.Float64("errorRate", s.ErrorRate))
+		}
+	}
+}
+
+// timingWriter records the status of a response and how long it took to start
+type timingWriter struct {
+	http.ResponseWriter
+	start   time.Time
+	status  int
+	latency time.Duration
+}
+
+func (t *timingWriter) WriteHeader(status int) {
+	if t.status == 0 {
+		t.status = status
+		t.latency = time.Since(t.start)
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *timingWriter) Write(p []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+		t.latency = time.Since(t.start)
+	}
+	return t.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (t *timingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// conversationKey identifies the conversation a request belongs to: the sticky
+// header if the client sent one, otherwise the opening system and user messages,
+// which stay the same as a conversation grows
+func (p *Pool) conversationKey(r *http.Request) string {
+	if key := r.Header.Get(p.header); key != "" {
+		return key
+	}
+
+	chatReq, ok := readJSONBody(r, p.name, p.logger)
+	if !ok {
+		return ""
+	}
+	var system, user string
+	for _, m := range utils.Messages(chatReq) {
+		message, _ := m.(map[string]interface{})
+		switch message["role"] {
+		case "system", "developer":
+			if system == "" {
+				system = utils.MessageText(message)
+			}
+		case "user":
+			user = utils.MessageText(message)
+		}
+		if user != "" {
+			break
+		}
+	}
+	if system == "" && user == "" {
+		return ""
+	}
+	return system + "\x00" + user
+}
+
+// rendezvous returns the index of the instance with the highest hash for key.
+// Adding or removing an instance only moves the conversations that hashed to it.
+func rendezvous(key string, instances []poolInstance) int {
+	best, bestScore := 0, uint64(0)
+	for i, instance := range instances {
+		sum := sha256.Sum256([]byte(instance.url + "\x00" + key))
+		if score := binary.BigEndian.Uint64(sum[:8]); score > bestScore || i == 0 {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
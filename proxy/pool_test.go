@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestPool returns a pool whose instances record which one served each request
+func newTestPool(strategy string, served *[]string) *Pool {
+	pool := NewPool("test", strategy, "", zap.NewNop())
+	for _, url := range []string{"http://a", "http://b", "http://c"} {
+		url := url
+		pool.Add(url, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*served = append(*served, url)
+		}))
+	}
+	return pool
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	var served []string
+	pool := newTestPool(RoundRobin, &served)
+	for i := 0; i < 6; i++ {
+		pool.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{}`)))
+	}
+	want := "http://a http://b http://c http://a http://b http://c"
+	if got := strings.Join(served, " "); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestPoolStickyConversation(t *testing.T) {
+	var served []string
+	pool := newTestPool(Sticky, &served)
+
+	first := `{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hello"}]}`
+	followUp := `{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hello"},` +
+		`{"role":"assistant","content":"hi"},{"role":"user","content":"how are you?"}]}`
+	for _, body := range []string{first, followUp, first} {
+		pool.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	}
+	if served[0] != served[1] || served[0] != served[2] {
+		t.Errorf("Expected one conversation to stay on one instance, got %v", served)
+	}
+}
+
+func TestPoolStickyHeader(t *testing.T) {
+	var served []string
+	pool := newTestPool(Sticky, &served)
+
+	seen := make(map[string]bool)
+	for _, id := range []string{"conv-1", "conv-2", "conv-3", "conv-4", "conv-5", "conv-6"} {
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+			req.Header.Set(DefaultStickyHeader, id)
+			pool.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		if n := len(served); served[n-1] != served[n-2] {
+			t.Errorf("Expected %s to stay on one instance, got %s and %s", id, served[n-2], served[n-1])
+		}
+		seen[served[len(served)-1]] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected conversations to spread across instances, all went to %v", seen)
+	}
+}
+
+func TestPoolAdaptiveShiftsAwayFromFailingInstance(t *testing.T) {
+	failing := true
+	served := make(map[string]int)
+	pool := NewPool("test", Adaptive, "", zap.NewNop())
+	for _, url := range []string{"http://a", "http://b"} {
+		url := url
+		pool.Add(url, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served[url]++
+			if url == "http://b" && failing {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+	}
+	send := func(n int) {
+		clear(served)
+		for i := 0; i < n; i++ {
+			pool.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{}`)))
+		}
+	}
+
+	send(40)
+	send(100)
+	if served["http://b"] != 100/probeEvery {
+		t.Errorf("Expected the failing instance to get only probes, got %v", served)
+	}
+
+	// Recovery waits until the failures have left the window
+	failing = false
+	send(adaptiveWindow * probeEvery)
+	send(100)
+	if served["http://a"] != 50 || served["http://b"] != 50 {
+		t.Errorf("Expected traffic to return to the recovered instance, got %v", served)
+	}
+}
+
+func TestWindowStats(t *testing.T) {
+	w := newWindow(10)
+	for i := 1; i <= 12; i++ {
+		w.add(time.Duration(i)*time.Millisecond, i%4 == 0)
+	}
+	stats := w.stats()
+	if stats.Requests != 10 || stats.ErrorRate != 0.3 {
+		t.Errorf("Expected 10 requests with a 0.3 error rate, got %+v", stats)
+	}
+	if stats.P50 != 7*time.Millisecond || stats.P95 != 10*time.Millisecond {
+		t.Errorf("Expected p50 7ms and p95 10ms, got %v and %v", stats.P50, stats.P95)
+	}
+}
@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"path"
+	"slices"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// PriorityFor returns the class of a request among classes: the first naming
+// its API key or matching its model, or the default class
+func PriorityFor(classes []model.PriorityClass, rc *extension.RequestContext) model.PriorityClass {
+	for _, class := range classes {
+		if rc.Key != nil && slices.Contains(class.Keys, rc.Key.Name) {
+			return class
+		}
+		for _, glob := range class.Models {
+			if ok, _ := path.Match(glob, rc.Model); ok && rc.Model != "" {
+				return class
+			}
+		}
+	}
+	return model.PriorityClass{Name: "default"}
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// API formats a probe can detect. Only the OpenAI format is proxied; the
+// others are reported so a backend can be pointed at its OpenAI-compatible API.
+const (
+	FormatOpenAI    = "openai"
+	FormatOllama    = "ollama"
+	FormatAnthropic = "anthropic"
+)
+
+// probePrefixes are where OpenAI-compatible APIs are commonly mounted below a
+// base URL, in the order they are tried. The empty prefix finds base URLs that
+// already end in /v1.
+var probePrefixes = []string{"/v1", "", "/openai/v1", "/api/v1"}
+
+// probeEndpoints are the OpenAI endpoints whose presence is reported
+var probeEndpoints = []string{
+	"/chat/completions",
+	"/responses",
+	"/embeddings",
+	"/audio/speech",
+	"/audio/transcriptions",
+	"/images/generations",
+}
+
+// Detection is what probing a backend found
+type Detection struct {
+	Backend string `json:"backend"`
+	URL     string `json:"url"`
+	// Formats lists the API formats the backend speaks
+	Formats []string `json:"formats"`
+	// Prefix is where the OpenAI-compatible API is mounted below the base URL
+	Prefix string `json:"prefix"`
+	// Endpoints lists the OpenAI endpoints that exist below Prefix
+	Endpoints []string `json:"endpoints"`
+	// PathRewrite maps client paths to the backend's when Prefix is not /v1
+	PathRewrite map[string]string `json:"path_rewrite,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// Probe detects the API formats and endpoints a backend offers, using only
+// requests that cost nothing: model listings, and GET requests to endpoints
+// that a server without them answers with 404
+func Probe(backend model.BackendConfig) Detection {
+	baseURL := backend.BaseURL
+	if len(backend.Instances) > 0 {
+		baseURL = backend.Instances[0]
+	}
+	d := Detection{Backend: backend.Name, URL: baseURL}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	transport, err := NewTransport(backend.Transport)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Timeout: catalogTimeout, Transport: transport}
+	get := func(path string) (int, map[string]interface{}) {
+		u := *base
+		u.Path = strings.TrimSuffix(base.Path, "/") + path
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return 0, nil
+		}
+		if backend.RequireAPIKey {
+			if apiKey := os.Getenv(backend.KeyEnvVar); apiKey != "" {
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+				req.Header.Set("x-api-key", apiKey)
+			}
+		}
+		req.Header.Set("anthropic-version", "2023-06-01")
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, nil
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	d.Prefix = "/v1"
+	found := false
+	for _, prefix := range probePrefixes {
+		status, body := get(prefix + "/models")
+		if status == 0 || status == http.StatusNotFound {
+			continue
+		}
+		if format := listingFormat(body); format != "" {
+			d.Formats = append(d.Formats, format)
+			d.Prefix = prefix
+			found = true
+			break
+		}
+	}
+	if status, body := get("/api/tags"); status == http.StatusOK && body["models"] != nil {
+		d.Formats = append(d.Formats, FormatOllama)
+	}
+	if len(d.Formats) == 0 {
+		d.Error = "no known API found"
+		return d
+	}
+
+	if found {
+		for _, endpoint := range probeEndpoints {
+			if status, _ := get(d.Prefix + endpoint); status != 0 && status != http.StatusNotFound {
+				d.Endpoints = append(d.Endpoints, endpoint)
+			}
+		}
+		if d.Prefix != "/v1" {
+			d.PathRewrite = map[string]string{"/v1/": d.Prefix + "/"}
+		}
+	}
+	return d
+}
+
+// listingFormat recognizes the format of a model listing or its error response
+func listingFormat(body map[string]interface{}) string {
+	if body["type"] == "error" {
+		return FormatAnthropic
+	}
+	if data, ok := body["data"].([]interface{}); ok {
+		if len(data) > 0 {
+			// Anthropic lists its models with a type
+			if first, _ := data[0].(map[string]interface{}); first["type"] == "model" {
+				return FormatAnthropic
+			}
+		}
+		return FormatOpenAI
+	}
+	if _, ok := body["error"]; ok {
+		// OpenAI-compatible servers answer a missing or wrong key with an error object
+		return FormatOpenAI
+	}
+	return ""
+}
+
+// ProbeAll probes backends in parallel
+func ProbeAll(backends []model.BackendConfig) []Detection {
+	var wg sync.WaitGroup
+	detections := make([]Detection, len(backends))
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, backend model.BackendConfig) {
+			defer wg.Done()
+			detections[i] = Probe(backend)
+		}(i, backend)
+	}
+	wg.Wait()
+	return detections
+}
+
+// DetectBackends probes the backends with auto_detect set and fills in their
+// path rewrites unless configured. What was detected is logged.
+func DetectBackends(backends []model.BackendConfig, logger *zap.Logger) {
+	var indexes []int
+	var selected []model.BackendConfig
+	for i, backend := range backends {
+		if backend.AutoDetect {
+			indexes = append(indexes, i)
+			selected = append(selected, backend)
+		}
+	}
+
+	for j, d := range ProbeAll(selected) {
+		backend := &backends[indexes[j]]
+		if d.Error != "" {
+			logger.Warn("Backend detection failed", zap.String("backend", d.Backend), zap.String("url", d.URL), zap.String("error", d.Error))
+			continue
+		}
+		logger.Info("Backend detected",
+			zap.String("backend", d.Backend),
+			zap.Strings("formats", d.Formats),
+			zap.String("prefix", d.Prefix),
+			zap.Strings("endpoints", d.Endpoints))
+		if !slices.Contains(d.Formats, FormatOpenAI) {
+			logger.Warn("Backend has no OpenAI-compatible API; point base_url at one",
+				zap.String("backend", d.Backend),
+				zap.Strings("formats", d.Formats))
+		}
+		if len(backend.PathRewrite) == 0 && len(d.PathRewrite) > 0 {
+			backend.PathRewrite = d.PathRewrite
+			logger.Info("Path rewrite detected", zap.String("backend", d.Backend), zap.Any("path_rewrite", d.PathRewrite))
+		}
+	}
+}
+
+// rewritePath replaces the longest matching prefix of path according to rewrites
+func rewritePath(path string, rewrites map[string]string) string {
+	if len(rewrites) == 0 {
+		return path
+	}
+	prefixes := make([]string, 0, len(rewrites))
+	for prefix := range rewrites {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			return rewrites[prefix] + rest
+		}
+	}
+	return path
+}
+
+// String summarizes a detection for command line output
+func (d Detection) String() string {
+	if d.Error != "" {
+		return d.Error
+	}
+	s := fmt.Sprintf("%s at %s%s", strings.Join(d.Formats, ", "), d.URL, d.Prefix)
+	if len(d.Endpoints) > 0 {
+		s += ": " + strings.Join(d.Endpoints, " ")
+	}
+	return s
+}
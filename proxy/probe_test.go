@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// newProbeServer returns a backend answering the given paths with JSON bodies and everything else with 404
+func newProbeServer(routes map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && body == "" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		routes        map[string]string
+		path          string
+		wantFormats   []string
+		wantPrefix    string
+		wantEndpoints []string
+		wantRewrite   map[string]string
+	}{
+		{
+			name: "openai",
+			routes: map[string]string{
+				"/v1/models":           `{"object":"list","data":[{"id":"gpt-4o"}]}`,
+				"/v1/chat/completions": "",
+				"/v1/embeddings":       "",
+			},
+			wantFormats:   []string{FormatOpenAI},
+			wantPrefix:    "/v1",
+			wantEndpoints: []string{"/chat/completions", "/embeddings"},
+		},
+		{
+			name: "base URL ending in /v1",
+			routes: map[string]string{
+				"/v1/models":           `{"error":{"message":"invalid api key"}}`,
+				"/v1/chat/completions": "",
+			},
+			path:          "/v1",
+			wantFormats:   []string{FormatOpenAI},
+			wantPrefix:    "",
+			wantEndpoints: []string{"/chat/completions"},
+			wantRewrite:   map[string]string{"/v1/": "/"},
+		},
+		{
+			name: "ollama",
+			routes: map[string]string{
+				"/v1/models":           `{"object":"list","data":[{"id":"llama3"}]}`,
+				"/v1/chat/completions": "",
+				"/api/tags":            `{"models":[{"name":"llama3"}]}`,
+			},
+			wantFormats:   []string{FormatOpenAI, FormatOllama},
+			wantPrefix:    "/v1",
+			wantEndpoints: []string{"/chat/completions"},
+		},
+		{
+			name: "ollama native only",
+			routes: map[string]string{
+				"/api/tags": `{"models":[]}`,
+			},
+			wantFormats: []string{FormatOllama},
+			wantPrefix:  "/v1",
+		},
+		{
+			name: "anthropic",
+			routes: map[string]string{
+				"/v1/models":   `{"type":"error","error":{"type":"authentication_error"}}`,
+				"/v1/messages": "",
+			},
+			wantFormats: []string{FormatAnthropic},
+			wantPrefix:  "/v1",
+		},
+		{
+			name: "openai under another prefix",
+			routes: map[string]string{
+				"/openai/v1/models":           `{"data":[]}`,
+				"/openai/v1/chat/completions": "",
+			},
+			wantFormats:   []string{FormatOpenAI},
+			wantPrefix:    "/openai/v1",
+			wantEndpoints: []string{"/chat/completions"},
+			wantRewrite:   map[string]string{"/v1/": "/openai/v1/"},
+		},
+	}
+
+	for _, tt := range tests {
+		server := newProbeServer(tt.routes)
+		d := Probe(model.BackendConfig{Name: tt.name, BaseURL: server.URL + tt.path})
+		server.Close()
+
+		if d.Error != "" {
+			t.Errorf("%s: error %q", tt.name, d.Error)
+			continue
+		}
+		if !reflect.DeepEqual(d.Formats, tt.wantFormats) {
+			t.Errorf("%s: formats %v, want %v", tt.name, d.Formats, tt.wantFormats)
+		}
+		if d.Prefix != tt.wantPrefix {
+			t.Errorf("%s: prefix %q, want %q", tt.name, d.Prefix, tt.wantPrefix)
+		}
+		if !reflect.DeepEqual(d.Endpoints, tt.wantEndpoints) {
+			t.Errorf("%s: endpoints %v, want %v", tt.name, d.Endpoints, tt.wantEndpoints)
+		}
+		if !reflect.DeepEqual(d.PathRewrite, tt.wantRewrite) {
+			t.Errorf("%s: path rewrite %v, want %v", tt.name, d.PathRewrite, tt.wantRewrite)
+		}
+	}
+}
+
+func TestProbeUnknown(t *testing.T) {
+	server := newProbeServer(nil)
+	defer server.Close()
+
+	d := Probe(model.BackendConfig{Name: "nothing", BaseURL: server.URL})
+	if d.Error == "" {
+		t.Errorf("expected an error for a server with no known API, got %+v", d)
+	}
+}
+
+func TestDetectBackends(t *testing.T) {
+	server := newProbeServer(map[string]string{
+		"/openai/v1/models":           `{"data":[{"id":"gpt-4o"}]}`,
+		"/openai/v1/chat/completions": `{"path":"rewritten"}`,
+	})
+	defer server.Close()
+
+	backends := []model.BackendConfig{
+		{Name: "detected", BaseURL: server.URL, Prefix: "a/", Default: true, AutoDetect: true},
+		{Name: "configured", BaseURL: server.URL, Prefix: "b/", AutoDetect: true, PathRewrite: map[string]string{"/v1/": "/custom/"}},
+		{Name: "skipped", BaseURL: server.URL, Prefix: "c/"},
+	}
+	DetectBackends(backends, zap.NewNop())
+
+	if got := backends[0].PathRewrite["/v1/"]; got != "/openai/v1/" {
+		t.Errorf("detected rewrite %q, want /openai/v1/", got)
+	}
+	if got := backends[1].PathRewrite["/v1/"]; got != "/custom/" {
+		t.Errorf("configured rewrite replaced with %q", got)
+	}
+	if backends[2].PathRewrite != nil {
+		t.Errorf("backend without auto_detect got rewrite %v", backends[2].PathRewrite)
+	}
+
+	rt := NewRouter(&model.Config{Backends: backends, Logger: zap.NewNop()})
+	rec := httptest.NewRecorder()
+	defaultProxy(rt).ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)))
+	if !strings.Contains(rec.Body.String(), "rewritten") {
+		t.Errorf("request not sent to the rewritten path: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	rewrites := map[string]string{"/v1/": "/api/", "/v1/audio/": "/speech/"}
+	for path, want := range map[string]string{
+		"/v1/chat/completions": "/api/chat/completions",
+		"/v1/audio/speech":     "/speech/speech",
+		"/health":              "/health",
+	} {
+		if got := rewritePath(path, rewrites); got != want {
+			t.Errorf("rewritePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if got := rewritePath("/v1/models", nil); got != "/v1/models" {
+		t.Errorf("rewritePath without rewrites = %q", got)
+	}
+}
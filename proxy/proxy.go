@@ -1,42 +1,360 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/kcolemangt/llm-router/extension"
 	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/tokenizer"
 	"github.com/kcolemangt/llm-router/utils"
+	"github.com/kcolemangt/llm-router/vision"
 	"go.uber.org/zap"
 )
 
-// Proxies holds the created reverse proxies by prefix
-var Proxies map[string]*httputil.ReverseProxy
+// Router holds the proxies of one configuration's backends and the settings
+// they share. Each router owns its backends' connection pools and what it
+// observes of them, such as health, latency and error counts, so several can
+// serve side by side, and a reloaded configuration gets a new router while the
+// old one finishes its requests. Requests are expected without an
+// Accept-Encoding header, as the handler sends them, so the transport hands
+// the stages that rewrite answers decompressed bodies.
+type Router struct {
+	proxies     map[string]http.Handler
+	prefixes    map[string]string
+	defaultName string
+	// matchOrder lists the prefixes longest first, so the most specific wins
+	matchOrder []string
 
-// DefaultProxy is the default reverse proxy used when no specific match is found
-var DefaultProxy *httputil.ReverseProxy
+	streamLine      int
+	errorPeek       int
+	priorityClasses []model.PriorityClass
+	guardrails      map[string]model.GuardrailConfig
+	extensions      model.Extensions
+	// families are the configured model families, then the default ones
+	families []model.ModelFamilyConfig
+	// tokenizers count the completion tokens of responses lacking usage
+	tokenizers *tokenizer.Set
 
-// InitializeProxies sets up the reverse proxy handlers based on the backend configurations
-func InitializeProxies(backends []model.BackendConfig, logger *zap.Logger) {
-	Proxies = make(map[string]*httputil.ReverseProxy)
+	// transport, if set, carries every backend's requests in place of the
+	// transports their configs describe
+	transport  http.RoundTripper
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+	// pacers hold the reported rate limits of paced backends, shared by their instances
+	pacers map[string]*pacer
 
-	for _, backend := range backends {
-		urlParsed, err := url.Parse(backend.BaseURL)
-		if err != nil {
-			logger.Fatal("Error parsing URL for backend", zap.String("backend", backend.Name), zap.Error(err))
+	// discovered holds the installed models of discovering backends, and
+	// bareNames the unambiguous bare names standing for them
+	discoveryMu sync.RWMutex
+	discovered  map[string]discovered
+	bareNames   map[string]string
+
+	// pulls holds the models being pulled onto Ollama backends, and the
+	// recently failed pulls
+	pullsMu sync.Mutex
+	pulls   map[string]*ModelPull
+
+	// What the router observed of its backends, by backend name
+	health        sync.Map
+	windows       sync.Map
+	errorCounts   errorCounts
+	latencies     latencies
+	cancellations cancellations
+	catalog       catalog
+	capabilities  capabilityCache
+}
+
+// limitOr returns limit if it is set and fallback otherwise
+func limitOr(limit, fallback int) int {
+	if limit > 0 {
+		return limit
+	}
+	return fallback
+}
+
+// NewRouter builds the proxies of cfg's backends
+func NewRouter(cfg *model.Config) *Router {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	rt := &Router{
+		proxies:         make(map[string]http.Handler),
+		prefixes:        make(map[string]string),
+		streamLine:      limitOr(cfg.Limits.StreamLineBytes, defaultStreamLine),
+		errorPeek:       limitOr(cfg.Limits.ErrorPeekBytes, defaultErrorPeek),
+		priorityClasses: cfg.PriorityClasses,
+		guardrails:      cfg.Guardrails,
+		extensions:      cfg.Extensions,
+		families:        slices.Concat(cfg.ModelFamilies, DefaultModelFamilies),
+		tokenizers:      cfg.TokenizerSet,
+		transport:       cfg.Transport,
+		transports:      make(map[string]*http.Transport),
+		pacers:          make(map[string]*pacer),
+	}
+
+	if rt.extensions == nil {
+		rt.extensions = extension.NewRegistry()
+	}
+
+	for _, backend := range cfg.Backends {
+		if backend.RateLimits.Pace {
+			rt.pacers[backend.Name] = &pacer{}
+		}
+		if backend.Transport.InsecureSkipVerify {
+			logger.Warn("TLS certificate verification is disabled for backend", zap.String("backend", backend.Name))
+		}
+		var proxy http.Handler
+		if len(backend.Instances) > 0 {
+			pool := NewPool(backend.Name, backend.LoadBalancing, backend.StickyHeader, logger)
+			for _, instance := range backend.Instances {
+				pool.Add(instance, rt.newReverseProxy(instance, backend, logger))
+			}
+			proxy = pool
+			logger.Debug("Backend pool created",
+				zap.String("backend", backend.Name),
+				zap.Int("instances", len(backend.Instances)),
+				zap.String("loadBalancing", backend.LoadBalancing))
+		} else {
+			proxy = rt.newReverseProxy(backend.BaseURL, backend, logger)
+		}
+		if backend.RequireAPIKey {
+			proxy = requireAPIKey(backend, logger, proxy)
+		}
+		proxy = rt.handleModelNotFound(backend, logger, proxy)
+		proxy = rt.watchStreams(backend.Name, time.Duration(backend.StallTimeout)*time.Second, rt.streamLine, logger, proxy)
+		if backend.Hooks.RequestURL != "" || backend.Hooks.ResponseURL != "" {
+			proxy = applyHooks(backend, logger, proxy)
 		}
 
-		proxy := httputil.NewSingleHostReverseProxy(urlParsed)
-		proxy.Director = makeDirector(urlParsed, backend, logger)
+		// Runs after the backend's own adjustments, which name parameters as clients send them
+		if backend.ModelFamily != FamilyNone {
+			proxy = adaptToFamily(backend, rt.families, logger, proxy)
+		}
+		if len(backend.StripParams) > 0 || len(backend.ParamLimits) > 0 || len(backend.ParamRenames) > 0 {
+			proxy = adjustParams(backend, logger, proxy)
+		}
+		if len(rt.guardrails) > 0 {
+			proxy = applyGuardrails(backend, rt.guardrails, logger, proxy)
+		}
+		if len(backend.Voices) > 0 {
+			proxy = mapVoices(backend, logger, proxy)
+		}
+		if backend.EmulateJSONSchema {
+			proxy = emulateStructuredOutput(backend.Name, logger, proxy)
+		}
+		if backend.ImageMode != "" && backend.ImageMode != vision.ModePassthrough {
+			proxy = adaptImages(backend.Name, backend.ImageMode, backend.MaxImageDimension, logger, proxy)
+		}
+		if backend.MaxConcurrent > 0 {
+			limiter := NewLimiter(backend.Name, backend.MaxConcurrent, backend.MaxQueue,
+				time.Duration(backend.QueueTimeout)*time.Second, logger)
+			limiter.classes = rt.priorityClasses
+			proxy = limiter.Wrap(proxy)
+			logger.Debug("Concurrency limit set",
+				zap.String("backend", backend.Name),
+				zap.Int("maxConcurrent", backend.MaxConcurrent),
+				zap.Int("maxQueue", backend.MaxQueue))
+		}
+		// Outermost, so requests waiting in the queue get heartbeats too
+		if backend.Heartbeat > 0 {
+			proxy = sendHeartbeats(backend.Name, time.Duration(backend.Heartbeat)*time.Second, logger, proxy)
+		}
 
-		Proxies[strings.TrimSpace(backend.Prefix)] = proxy
+		prefix := strings.TrimSpace(backend.Prefix)
+		rt.proxies[prefix] = proxy
+		rt.prefixes[backend.Name] = prefix
 		if backend.Default {
-			DefaultProxy = proxy
+			rt.defaultName = backend.Name
 			logger.Debug("Default proxy set", zap.String("backend", backend.Name))
 		}
 	}
+
+	for prefix := range rt.proxies {
+		rt.matchOrder = append(rt.matchOrder, prefix)
+	}
+	slices.SortFunc(rt.matchOrder, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	return rt
+}
+
+// ByName returns the proxy of the backend called name and its prefix
+func (rt *Router) ByName(name string) (http.Handler, string, bool) {
+	if rt == nil {
+		return nil, "", false
+	}
+	prefix, ok := rt.prefixes[name]
+	if !ok {
+		return nil, "", false
+	}
+	return rt.proxies[prefix], prefix, true
+}
+
+// ByPrefix returns the proxy of the backend with prefix and its name
+func (rt *Router) ByPrefix(prefix string) (http.Handler, string, bool) {
+	if rt == nil {
+		return nil, "", false
+	}
+	target, ok := rt.proxies[prefix]
+	if !ok {
+		return nil, "", false
+	}
+	for name, p := range rt.prefixes {
+		if p == prefix {
+			return target, name, true
+		}
+	}
+	return target, "", true
+}
+
+// Match returns the proxy of the backend whose prefix starts modelName, the
+// longest if several do, with its name and prefix
+func (rt *Router) Match(modelName string) (http.Handler, string, string, bool) {
+	if rt == nil {
+		return nil, "", "", false
+	}
+	for _, prefix := range rt.matchOrder {
+		if strings.HasPrefix(modelName, prefix) {
+			target, name, _ := rt.ByPrefix(prefix)
+			return target, name, prefix, true
+		}
+	}
+	return nil, "", "", false
+}
+
+// Default returns the proxy of the default backend and its name, or nil if
+// there is none
+func (rt *Router) Default() (http.Handler, string) {
+	if rt == nil || rt.defaultName == "" {
+		return nil, ""
+	}
+	target, _, _ := rt.ByName(rt.defaultName)
+	return target, rt.defaultName
+}
+
+// Extensions returns the resolvers, transformers and middlewares of the
+// router's configuration, after the compiled-in ones
+func (rt *Router) Extensions() model.Extensions {
+	if rt == nil {
+		return extension.NewRegistry()
+	}
+	return rt.extensions
+}
+
+// Close closes the idle connections of the router's backends. Requests in
+// flight finish. A transport set in the configuration is left to its owner.
+func (rt *Router) Close() {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, transport := range rt.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// newReverseProxy creates the reverse proxy for one base URL of a backend
+func (rt *Router) newReverseProxy(baseURL string, backend model.BackendConfig, logger *zap.Logger) *httputil.ReverseProxy {
+	urlParsed, err := url.Parse(baseURL)
+	if err != nil {
+		logger.Fatal("Error parsing URL for backend", zap.String("backend", backend.Name), zap.Error(err))
+	}
+
+	transport, err := rt.transportFor(backend)
+	if err != nil {
+		logger.Fatal("Invalid transport for backend", zap.String("backend", backend.Name), zap.Error(err))
+	}
+
+	reverseProxy := httputil.NewSingleHostReverseProxy(urlParsed)
+	reverseProxy.Transport = &timedTransport{RoundTripper: transport, backend: backend.Name, rt: rt}
+	if limits := backend.RateLimits; limits.RetryBudget > 0 || limits.Pace {
+		reverseProxy.Transport = &rateLimitTransport{
+			RoundTripper: reverseProxy.Transport,
+			backend:      backend.Name,
+			budget:       time.Duration(limits.RetryBudget) * time.Second,
+			pacer:        rt.pacers[backend.Name],
+			logger:       logger,
+		}
+	}
+	reverseProxy.Director = makeDirector(urlParsed, backend, logger)
+	reverseProxy.ErrorHandler = rt.makeErrorHandler(backend, logger)
+	reverseProxy.ModifyResponse = rt.makeModifyResponse(backend, rt.streamLine, rt.errorPeek, logger)
+	return reverseProxy
+}
+
+// makeErrorHandler returns a function that reports upstream failures as OpenAI-compatible errors
+func (rt *Router) makeErrorHandler(backend model.BackendConfig, logger *zap.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, req *http.Request, err error) {
+		// Rejections from response processing are not backend failures
+		var routerErr *utils.Error
+		if errors.As(err, &routerErr) {
+			utils.WriteErr(w, routerErr)
+			return
+		}
+		// Requests held back by pacing never reached the backend
+		var limited *rateLimitedError
+		if errors.As(err, &limited) {
+			logger.Warn("Refused request until the backend's rate limit resets",
+				zap.String("backend", backend.Name), zap.Duration("wait", limited.wait))
+			w.Header().Set("Retry-After", strconv.Itoa(int(limited.wait.Seconds())+1))
+			utils.WriteErr(w, utils.NewError(utils.ErrRateLimited, "%s", limited))
+			return
+		}
+		// A client hanging up says nothing about the backend
+		if errors.Is(err, context.Canceled) && cancelledByClient(req) {
+			logger.Info("Client cancelled request, cancelled backend request",
+				zap.String("backend", backend.Name), zap.String("URL", req.URL.String()))
+			rt.clientCancelled(req, backend.Name, false, 0)
+			w.WriteHeader(StatusClientClosedRequest)
+			return
+		}
+		if !errors.Is(err, context.Canceled) {
+			rt.countError(backend.Name, ClassNetwork)
+			rt.markHealth(backend.Name, false)
+		}
+		logger.Error("Backend request failed",
+			zap.String("backend", backend.Name),
+			zap.String("URL", req.URL.String()),
+			zap.Error(err),
+		)
+		utils.WriteErr(w, utils.NewError(utils.ErrBackendUnavailable, "Backend %s is unavailable: %s", backend.Name, err))
+	}
+}
+
+// requireAPIKey returns a handler that refuses requests for a backend that
+// requires an API key when there is none to send it: the backend's key_env_var
+// is unset and the client's Authorization may not be forwarded
+func requireAPIKey(backend model.BackendConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if backend.KeyEnvVar != "" && os.Getenv(backend.KeyEnvVar) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" && extension.FromRequest(r).ForwardAuthorization {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logger.Error("Missing required API key for backend, rejecting request",
+			zap.String("backend", backend.Name),
+			zap.String("envVar", backend.KeyEnvVar),
+			zap.String("requestID", extension.FromRequest(r).ID))
+		utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Backend %s requires an API key and the router has none to send it", backend.Name))
+	})
 }
 
 // makeDirector returns a function that modifies requests to route through the reverse proxy
@@ -44,10 +362,11 @@ func makeDirector(urlParsed *url.URL, backend model.BackendConfig, logger *zap.L
 	return func(req *http.Request) {
 		originalHost := req.Host
 		originalPath := req.URL.Path
+		extension.FromRequest(req).Backend = backend.Name
 		req.Host = urlParsed.Host
 		req.URL.Scheme = urlParsed.Scheme
 		req.URL.Host = urlParsed.Host
-		req.URL.Path = urlParsed.Path + originalPath
+		req.URL.Path = urlParsed.Path + rewritePath(originalPath, backend.PathRewrite)
 
 		// Log the modifications to the request URL and Host
 		logger.Info("Modified request URL and Host",
@@ -60,6 +379,15 @@ func makeDirector(urlParsed *url.URL, backend model.BackendConfig, logger *zap.L
 		req.Header.Set("X-Forwarded-Host", originalHost)
 		logger.Debug("Set X-Forwarded-Host header", zap.String("X-Forwarded-Host", originalHost))
 
+		if removed := applyHeaderRules(req.Header, backend); len(removed) > 0 || len(backend.SetHeaders) > 0 {
+			logger.Debug("Applied backend header rules", zap.String("backend", backend.Name),
+				zap.Strings("removed", removed), zap.Int("set", len(backend.SetHeaders)))
+		}
+		if backend.OpenAIOrg != "" || backend.OpenAIProject != "" {
+			logger.Debug("Set OpenAI organization and project", zap.String("backend", backend.Name),
+				zap.String("organization", backend.OpenAIOrg), zap.String("project", backend.OpenAIProject))
+		}
+
 		if backend.RequireAPIKey {
 			apiKey := os.Getenv(backend.KeyEnvVar)
 			if apiKey != "" {
@@ -70,19 +398,14 @@ func makeDirector(urlParsed *url.URL, backend model.BackendConfig, logger *zap.L
 					zap.String("APIKeyEnvVar", backend.KeyEnvVar),
 					zap.String("Authorization", utils.RedactAuthorization(auth)),
 				)
+			} else if existingAuth := req.Header.Get("Authorization"); existingAuth != "" && extension.FromRequest(req).ForwardAuthorization {
+				logger.Info("Authorization header already set, forwarding to backend",
+					zap.String("backend", backend.Name),
+					zap.String("Authorization", utils.RedactAuthorization(existingAuth)),
+				)
 			} else {
-				existingAuth := req.Header.Get("Authorization")
-				if existingAuth != "" {
-					logger.Info("Authorization header already set, forwarding to backend",
-						zap.String("backend", backend.Name),
-						zap.String("Authorization", utils.RedactAuthorization(existingAuth)),
-					)
-				} else {
-					logger.Fatal("Missing required API key for backend, rejecting request",
-						zap.String("backend", backend.Name),
-						zap.String("envVar", backend.KeyEnvVar),
-					)
-				}
+				// requireAPIKey refused the request before it got here
+				req.Header.Del("Authorization")
 			}
 		} else {
 			req.Header.Del("Authorization")
@@ -1,6 +1,9 @@
 package proxy
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/kcolemangt/llm-router/model"
@@ -14,11 +17,44 @@ func TestMultipleProxiesInitialization(t *testing.T) {
 		{Name: "test2", BaseURL: "http://localhost:8082", Prefix: "test2/", Default: true},
 	}
 
-	InitializeProxies(backends, logger)
-	if len(Proxies) != 2 {
-		t.Errorf("Expected 2 proxies, got %d", len(Proxies))
+	rt := NewRouter(&model.Config{Backends: backends, Logger: logger})
+	if len(rt.proxies) != 2 {
+		t.Errorf("Expected 2 proxies, got %d", len(rt.proxies))
 	}
-	if DefaultProxy != Proxies["test2/"] {
-		t.Errorf("Default proxy not set correctly")
+	if _, name := rt.Default(); name != "test2" {
+		t.Errorf("Default proxy not set correctly, got %q", name)
 	}
 }
+
+func TestUnreachableBackendReturnsJSONError(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	backends := []model.BackendConfig{
+		{Name: "down", BaseURL: "http://127.0.0.1:1", Prefix: "down/", Default: true},
+	}
+
+	rt := NewRouter(&model.Config{Backends: backends, Logger: logger})
+	rec := httptest.NewRecorder()
+	defaultProxy(rt).ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", rec.Code)
+	}
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON error body, got %q", rec.Body.String())
+	}
+	if body.Error.Type != "server_error" || body.Error.Code != "backend_unavailable" {
+		t.Errorf("Unexpected error body: %+v", body.Error)
+	}
+}
+
+// defaultProxy returns the handler of the router's default backend
+func defaultProxy(rt *Router) http.Handler {
+	h, _ := rt.Default()
+	return h
+}
@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/ollama"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// defaultPullTimeout bounds a pull unless the backend configures its own
+const defaultPullTimeout = 30 * time.Minute
+
+// pullRetry is how long a failed pull is reported to requests for its model
+// before one of them may start another
+const pullRetry = time.Minute
+
+// pullRetryAfter is the Retry-After, in seconds, of requests answered while
+// their model is pulled
+const pullRetryAfter = 5
+
+// pullProgressInterval is how often a streaming request waiting for a pull is
+// sent its progress
+var pullProgressInterval = 2 * time.Second
+
+// ModelPull is a model being pulled onto an Ollama backend
+type ModelPull struct {
+	done     chan struct{}
+	mu       sync.Mutex
+	progress ollama.Progress
+	err      error
+	finished time.Time
+}
+
+// Done is closed when the pull has finished
+func (p *ModelPull) Done() <-chan struct{} {
+	return p.done
+}
+
+// Progress returns the last step of the pull
+func (p *ModelPull) Progress() ollama.Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.progress
+}
+
+// Err returns why a finished pull failed
+func (p *ModelPull) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// pullsModel reports whether a backend pulls a model it does not have
+func pullsModel(backend model.BackendConfig, modelName string) bool {
+	for _, glob := range backend.PullMissing.Models {
+		if ok, _ := path.Match(glob, modelName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Pull starts pulling a model onto an Ollama backend, or returns the pull of
+// it already under way. A pull that failed less than a minute ago is returned
+// rather than tried again.
+func (rt *Router) Pull(backend model.BackendConfig, modelName string, logger *zap.Logger) *ModelPull {
+	key := backend.Name + "\x00" + modelName
+	rt.pullsMu.Lock()
+	defer rt.pullsMu.Unlock()
+	if pull, ok := rt.pulls[key]; ok {
+		select {
+		case <-pull.done:
+			if pull.Err() != nil && time.Since(pull.finished) < pullRetry {
+				return pull
+			}
+		default:
+			return pull
+		}
+	}
+	if rt.pulls == nil {
+		rt.pulls = make(map[string]*ModelPull)
+	}
+	pull := &ModelPull{done: make(chan struct{}), progress: ollama.Progress{Status: "starting"}}
+	rt.pulls[key] = pull
+
+	timeout := defaultPullTimeout
+	if backend.PullMissing.TimeoutSeconds > 0 {
+		timeout = time.Duration(backend.PullMissing.TimeoutSeconds) * time.Second
+	}
+	logger.Info("Pulling missing model", zap.String("backend", backend.Name), zap.String("model", modelName))
+	go func() {
+		// The pull outlives the request that started it
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		client, err := rt.ollamaClient(backend)
+		if err == nil {
+			err = client.Pull(ctx, modelName, func(step ollama.Progress) {
+				pull.mu.Lock()
+				pull.progress = step
+				pull.mu.Unlock()
+			})
+		}
+		if err != nil {
+			logger.Warn("Failed to pull model", zap.String("backend", backend.Name), zap.String("model", modelName), zap.Error(err))
+		} else {
+			logger.Info("Pulled model", zap.String("backend", backend.Name), zap.String("model", modelName))
+			// The backend's model list has changed
+			rt.catalog.Lock()
+			delete(rt.catalog.entries, backend.Name)
+			rt.catalog.Unlock()
+		}
+		pull.mu.Lock()
+		pull.err, pull.finished = err, time.Now()
+		pull.mu.Unlock()
+		close(pull.done)
+	}()
+	return pull
+}
+
+// pullMissing pulls a model the backend does not have and sends the request
+// again. Streaming requests are kept open meanwhile with the pull's progress
+// in SSE comments; other requests are answered 425 Too Early until it is done.
+func (rt *Router) pullMissing(w http.ResponseWriter, r *http.Request, backend model.BackendConfig, modelName string, stream bool, body []byte, logger *zap.Logger, next http.Handler) {
+	pull := rt.Pull(backend, modelName, logger)
+	failed := func() *utils.Error {
+		return utils.NewError(utils.ErrModelNotFound, "Model %s is not on backend %s and pulling it failed: %s", modelName, backend.Name, pull.Err())
+	}
+	if !stream {
+		select {
+		case <-pull.Done():
+		default:
+			w.Header().Set("Retry-After", strconv.Itoa(pullRetryAfter))
+			utils.WriteErr(w, utils.NewError(utils.ErrModelPulling, "Model %s is being pulled onto backend %s (%s), try again later",
+				modelName, backend.Name, pull.Progress()))
+			return
+		}
+		if pull.Err() != nil {
+			utils.WriteErr(w, failed())
+			return
+		}
+		replaceBody(r, body)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	ticker := time.NewTicker(pullProgressInterval)
+	defer ticker.Stop()
+	for pulled := false; !pulled; {
+		fmt.Fprintf(w, ": pulling %s: %s\n\n", modelName, pull.Progress())
+		controller.Flush()
+		select {
+		case <-pull.Done():
+			pulled = true
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if pull.Err() != nil {
+		err := failed()
+		data, _ := json.Marshal(map[string]interface{}{"error": map[string]interface{}{
+			"message": err.Message, "type": utils.ErrorType(err.Status), "code": err.Code,
+		}})
+		writeErrorEvent(w, data)
+		return
+	}
+	replaceBody(r, body)
+	started := &startedWriter{ResponseWriter: w}
+	next.ServeHTTP(started, r)
+	if started.failed {
+		writeErrorEvent(w, started.body.Bytes())
+	}
+}
+
+// writeErrorEvent ends an event stream with an error
+func writeErrorEvent(w http.ResponseWriter, data []byte) {
+	var compact bytes.Buffer
+	if json.Compact(&compact, data) == nil {
+		data = compact.Bytes()
+	}
+	fmt.Fprintf(w, "data: %s\n\n", bytes.TrimSpace(data))
+}
+
+// startedWriter continues a response whose header was already sent, holding
+// back the body of an error answer
+type startedWriter struct {
+	http.ResponseWriter
+	decided bool
+	failed  bool
+	body    bytes.Buffer
+}
+
+func (s *startedWriter) WriteHeader(status int) {
+	if !s.decided {
+		s.decided, s.failed = true, status != http.StatusOK
+	}
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.WriteHeader(http.StatusOK)
+	if s.failed {
+		return s.body.Write(p)
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (s *startedWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// newPullStub serves an Ollama server that has no models until they are
+// pulled; pulls finish when release is closed
+func newPullStub(t *testing.T, release chan struct{}) *httptest.Server {
+	var mu sync.Mutex
+	installed := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path == "/api/pull" {
+			if req.Model == "missing" {
+				io.WriteString(w, `{"error":"pull model manifest: file does not exist"}`)
+				return
+			}
+			io.WriteString(w, `{"status":"pulling manifest"}`+"\n")
+			fmt.Fprintf(w, `{"status":"downloading","total":200,"completed":90}`+"\n")
+			w.(http.Flusher).Flush()
+			<-release
+			mu.Lock()
+			installed[req.Model] = true
+			mu.Unlock()
+			io.WriteString(w, `{"status":"success"}`+"\n")
+			return
+		}
+		mu.Lock()
+		ok := installed[req.Model]
+		mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"message":"model \"`+req.Model+`\" not found, try pulling it first"}}`)
+			return
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"model\":\""+req.Model+"\"}\n\ndata: [DONE]\n\n")
+			return
+		}
+		io.WriteString(w, `{"model":"`+req.Model+`"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPullMissingModel(t *testing.T) {
+	release := make(chan struct{})
+	upstream := newPullStub(t, release)
+	backend := model.BackendConfig{Name: "pulling", BaseURL: upstream.URL, Prefix: "p/", PullMissing: model.PullConfig{Models: []string{"llama3*", "missing"}}}
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{backend}, Logger: zap.NewNop()})
+	send := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rt.proxies["p/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := send(`{"model":"llama3"}`)
+	if rec.Code != http.StatusTooEarly || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), "model_pulling") {
+		t.Fatalf("Expected 425 while the model is pulled, got %d: %s", rec.Code, rec.Body.String())
+	}
+	close(release)
+	<-rt.Pull(backend, "llama3", zap.NewNop()).Done()
+	if rec := send(`{"model":"llama3"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "llama3") {
+		t.Errorf("Expected the pulled model to answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Pulls that fail are reported rather than started again
+	send(`{"model":"missing"}`)
+	<-rt.Pull(backend, "missing", zap.NewNop()).Done()
+	rec = send(`{"model":"missing"}`)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "file does not exist") {
+		t.Errorf("Expected the failed pull to be reported, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Models not configured to be pulled fail as before
+	if rec := send(`{"model":"mistral"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a model that is not pulled, got %d", rec.Code)
+	}
+}
+
+func TestPullMissingModelStreams(t *testing.T) {
+	pullProgressInterval = 10 * time.Millisecond
+	defer func() { pullProgressInterval = 2 * time.Second }()
+	release := make(chan struct{})
+	upstream := newPullStub(t, release)
+	backend := model.BackendConfig{Name: "streaming-pull", BaseURL: upstream.URL, Prefix: "s/", PullMissing: model.PullConfig{Models: []string{"*"}}}
+	rt := NewRouter(&model.Config{Backends: []model.BackendConfig{backend}, Logger: zap.NewNop()})
+
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	rec := httptest.NewRecorder()
+	rt.proxies["s/"].ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen2.5","stream":true}`)))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, ": pulling qwen2.5: downloading 45%") {
+		t.Errorf("Expected the pull's progress as comments, got %q", body)
+	}
+	if !strings.HasSuffix(body, "data: {\"model\":\"qwen2.5\"}\n\ndata: [DONE]\n\n") {
+		t.Errorf("Expected the answer after the pull, got %q", body)
+	}
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"go.uber.org/zap"
+)
+
+// rateLimitTransport retries requests a backend answers with Retry-After while
+// the waits fit in the budget, and paces requests by the rate limits the
+// backend reports
+type rateLimitTransport struct {
+	http.RoundTripper
+	backend string
+	budget  time.Duration
+	// pacer is nil unless the backend is paced
+	pacer  *pacer
+	logger *zap.Logger
+}
+
+// rateLimitedError refuses a request that would have to wait longer than the
+// retry budget for the backend's rate limit to reset
+type rateLimitedError struct {
+	backend string
+	wait    time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("Rate limit of backend %s is exhausted for another %s", e.backend, e.wait.Round(time.Second))
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline := time.Now().Add(t.budget)
+	if t.pacer != nil {
+		wait := t.pacer.wait(extension.FromRequest(req).TokensEstimate)
+		if wait > 0 {
+			if time.Now().Add(wait).After(deadline) {
+				return nil, &rateLimitedError{backend: t.backend, wait: wait}
+			}
+			t.logger.Info("Pacing request until the backend's rate limit resets",
+				zap.String("backend", t.backend), zap.Duration("wait", wait))
+			if err := sleep(req, wait); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Keep the body so the request can be sent again
+	var body []byte
+	if t.budget > 0 && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	for {
+		resp, err := t.RoundTripper.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if t.pacer != nil {
+			t.pacer.observe(resp.Header)
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		wait, ok := retryAfter(resp.Header)
+		if !ok || t.budget == 0 || time.Now().Add(wait).After(deadline) {
+			return resp, nil
+		}
+		t.logger.Info("Backend asked to retry later, holding request",
+			zap.String("backend", t.backend),
+			zap.Int("status", resp.StatusCode),
+			zap.Duration("retryAfter", wait))
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+}
+
+// sleep waits for d unless the client goes away first
+func sleep(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// retryAfter returns the wait a Retry-After header asks for, in seconds or as
+// an HTTP date
+func retryAfter(h http.Header) (time.Duration, bool) {
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// pacer holds requests to a backend whose reported rate limits have run out
+type pacer struct {
+	mu sync.Mutex
+	// requestsReset is when a used-up request limit resets
+	requestsReset time.Time
+	// tokensRemaining is what the token limit allows until tokensReset
+	tokensRemaining int
+	tokensReset     time.Time
+}
+
+// wait returns how long a request of about tokens tokens has to wait
+func (p *pacer) wait(tokens int) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	until := p.requestsReset
+	if now.Before(p.tokensReset) && p.tokensRemaining < max(tokens, 1) && p.tokensReset.After(until) {
+		until = p.tokensReset
+	}
+	return max(until.Sub(now), 0)
+}
+
+// observe records the rate limits reported in a response, in OpenAI's
+// x-ratelimit headers, which Groq and others share, or Anthropic's
+func (p *pacer) observe(h http.Header) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if remaining, reset, ok := rateLimit(h, "requests", now); ok && remaining <= 0 {
+		p.requestsReset = reset
+	}
+	if remaining, reset, ok := rateLimit(h, "tokens", now); ok {
+		p.tokensRemaining, p.tokensReset = remaining, reset
+	}
+}
+
+// rateLimit returns what remains of the requests or tokens limit reported in
+// h and when it resets
+func rateLimit(h http.Header, limit string, now time.Time) (int, time.Time, bool) {
+	if remaining, err := strconv.Atoi(h.Get("X-Ratelimit-Remaining-" + limit)); err == nil {
+		reset, err := time.ParseDuration(h.Get("X-Ratelimit-Reset-" + limit))
+		if err != nil {
+			return 0, time.Time{}, false
+		}
+		return remaining, now.Add(reset), true
+	}
+	if remaining, err := strconv.Atoi(h.Get("Anthropic-Ratelimit-" + limit + "-Remaining")); err == nil {
+		reset, err := time.Parse(time.RFC3339, h.Get("Anthropic-Ratelimit-"+limit+"-Reset"))
+		if err != nil {
+			return 0, time.Time{}, false
+		}
+		return remaining, reset, true
+	}
+	return 0, time.Time{}, false
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestRetryAfterHeldWithinBudget(t *testing.T) {
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	for _, budget := range []int{0, 5} {
+		bodies = nil
+		rt := NewRouter(&model.Config{Logger: zap.NewNop(), Backends: []model.BackendConfig{
+			{Name: "openai", BaseURL: upstream.URL, Default: true, RateLimits: model.RateLimitConfig{RetryBudget: budget}},
+		}})
+		rec := httptest.NewRecorder()
+		defaultProxy(rt).ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)))
+
+		switch {
+		case budget == 0 && (rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "0"):
+			t.Errorf("Expected the 429 and its Retry-After to reach the client, got %d %v", rec.Code, rec.Header())
+		case budget > 0 && (rec.Code != http.StatusOK || len(bodies) != 2 || bodies[1] != `{"model":"gpt-4o"}`):
+			t.Errorf("Expected the request to be retried with its body, got %d after %q", rec.Code, bodies)
+		}
+	}
+}
+
+func TestPacingRefusesUntilRateLimitResets(t *testing.T) {
+	requests := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+		w.Header().Set("X-Ratelimit-Reset-Requests", "30s")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	rt := NewRouter(&model.Config{Logger: zap.NewNop(), Backends: []model.BackendConfig{
+		{Name: "openai", BaseURL: upstream.URL, Default: true, RateLimits: model.RateLimitConfig{RetryBudget: 1, Pace: true}},
+	}})
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		defaultProxy(rt).ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+		if i == 1 && (rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" ||
+			!strings.Contains(rec.Body.String(), "rate_limited")) {
+			t.Errorf("Expected a rate_limited refusal with Retry-After 30, got %d %v %s", rec.Code, rec.Header(), rec.Body.String())
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the paced request to be held back from the backend, got %d requests", requests)
+	}
+}
+
+func TestPacerWaitsForTokens(t *testing.T) {
+	p := &pacer{}
+	h := http.Header{}
+	h.Set("X-Ratelimit-Remaining-Tokens", "100")
+	h.Set("X-Ratelimit-Reset-Tokens", "6m0s")
+	p.observe(h)
+	if wait := p.wait(50); wait != 0 {
+		t.Errorf("Expected a request within the remaining tokens to go ahead, got %v", wait)
+	}
+	if wait := p.wait(500); wait < 5*time.Minute {
+		t.Errorf("Expected a request over the remaining tokens to wait for the reset, got %v", wait)
+	}
+}
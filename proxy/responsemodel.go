@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// restoreModelName rewrites the model a response reports to the name the
+// client asked for, when the router sent the backend another name through an
+// alias, a prefix or a rewrite. Some clients check that the two match.
+func restoreModelName(resp *http.Response, maxLine int) error {
+	rc := extension.FromRequest(resp.Request)
+	if rc.BackendModel == "" || rc.BackendModel == rc.Model || resp.StatusCode >= http.StatusBadRequest {
+		return nil
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = newLineRewriter(resp.Body, func(lines []byte) []byte {
+			return rewriteEventLines(lines, rc.Model)
+		}, nil, maxLine)
+		return nil
+	}
+	body, ok, err := readResponseBody(resp)
+	if !ok {
+		return err
+	}
+	body, _ = rewriteModel(body, rc.Model)
+	replaceResponseBody(resp, body)
+	return nil
+}
+
+// rewriteEventLines rewrites the model in the data lines of complete event
+// stream lines
+func rewriteEventLines(lines []byte, model string) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		data, ok := utils.SSEData(line)
+		if !ok {
+			out.Write(line)
+			continue
+		}
+		trimmed := bytes.TrimSpace(data)
+		rewritten, ok := rewriteModel(trimmed, model)
+		if !ok {
+			out.Write(line)
+			continue
+		}
+		// data ends where the line ending starts
+		start := len(bytes.TrimRight(line, "\r\n")) - len(data) + bytes.Index(data, trimmed)
+		out.Write(line[:start])
+		out.Write(rewritten)
+		out.Write(line[start+len(trimmed):])
+	}
+	return out.Bytes()
+}
+
+// rewriteModel sets the model of a JSON object, and of the response object
+// nested in Responses API events, reporting whether there was one to set
+func rewriteModel(data []byte, model string) ([]byte, bool) {
+	if !bytes.Contains(data, []byte(`"model"`)) {
+		return data, false
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(data, &object) != nil {
+		return data, false
+	}
+
+	changed := false
+	if _, ok := object["model"]; ok {
+		object["model"], _ = json.Marshal(model)
+		changed = true
+	}
+	if inner, ok := object["response"]; ok {
+		if rewritten, ok := rewriteModel(inner, model); ok {
+			object["response"] = rewritten
+			changed = true
+		}
+	}
+	if !changed {
+		return data, false
+	}
+
+	out, err := encodeJSON(object)
+	if err != nil {
+		return data, false
+	}
+	return out, true
+}
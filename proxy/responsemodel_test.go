@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRewriteEventLines(t *testing.T) {
+	stream := "event: response.created\n" +
+		"data: {\"type\":\"response.created\",\"response\":{\"id\":\"r1\",\"model\":\"deepseek-r1\"}}\n\n" +
+		"data: {\"id\":\"c1\",\"model\":\"deepseek-r1\",\"choices\":[{\"delta\":{\"content\":\"<b>\"}}]}\r\n\r\n" +
+		"data: {\"delta\":\"hi\"}\n\n" +
+		"data: [DONE]\n\n"
+	got := rewriteEventLines([]byte(stream), "o1")
+
+	want := "event: response.created\n" +
+		"data: {\"response\":{\"id\":\"r1\",\"model\":\"o1\"},\"type\":\"response.created\"}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"<b>\"}}],\"id\":\"c1\",\"model\":\"o1\"}\r\n\r\n" +
+		"data: {\"delta\":\"hi\"}\n\n" +
+		"data: [DONE]\n\n"
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestLineRewriterWaitsForWholeLines(t *testing.T) {
+	// Deliver the stream a few bytes at a time so lines arrive split
+	stream := "data: {\"model\":\"deepseek-r1\",\"n\":1}\n\ndata: {\"model\":\"deepseek-r1\",\"n\":2}\n\n"
+	rewrite := func(lines []byte) []byte { return rewriteEventLines(lines, "o1") }
+	rewriter := newLineRewriter(io.NopCloser(&trickleReader{s: stream}), rewrite, nil, defaultStreamLine)
+	got, err := io.ReadAll(rewriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "data: {\"model\":\"o1\",\"n\":1}\n\ndata: {\"model\":\"o1\",\"n\":2}\n\n"
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// A line longer than the bound passes through unchanged
+	long := "data: {\"model\":\"deepseek-r1\",\"text\":\"" + strings.Repeat("x", 64) + "\"}\n"
+	rewriter = newLineRewriter(io.NopCloser(&trickleReader{s: long}), rewrite, nil, 16)
+	if got, _ := io.ReadAll(rewriter); string(got) != long {
+		t.Errorf("Expected an overlong line unchanged, got %q", got)
+	}
+}
+
+// trickleReader returns at most 5 bytes per read
+type trickleReader struct{ s string }
+
+func (r *trickleReader) Read(p []byte) (int, error) {
+	if r.s == "" {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), 5)], r.s)
+	r.s = r.s[n:]
+	return n, nil
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// dayNames are the day names a schedule may use, indexed by time.Weekday
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Window is a parsed keep-warm window
+type Window struct {
+	days [7]bool
+	// start and end are minutes after midnight
+	start, end int
+}
+
+// ParseWindow checks and parses a keep-warm window
+func ParseWindow(config model.KeepWarmWindow) (Window, error) {
+	var w Window
+	var err error
+	if w.start, err = minuteOfDay(config.Start); err != nil {
+		return w, err
+	}
+	if w.end, err = minuteOfDay(config.End); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("window %s-%s is empty", config.Start, config.End)
+	}
+
+	days := strings.ToLower(strings.TrimSpace(config.Days))
+	if days == "" || days == "*" {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		return w, nil
+	}
+	for _, item := range strings.Split(days, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		from, fromOK := dayIndex(first)
+		to, toOK := from, fromOK
+		if isRange {
+			to, toOK = dayIndex(last)
+		}
+		if !fromOK || !toOK {
+			return w, fmt.Errorf("unknown days %q, expected names like mon-fri or sat,sun", item)
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+// dayIndex returns the time.Weekday of a day name
+func dayIndex(name string) (int, bool) {
+	for i, day := range dayNames {
+		if name == day {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// minuteOfDay parses a time of day such as 09:30
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls in the window, in t's time zone
+func (w Window) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	// Past midnight the window belongs to the day before
+	return w.days[day] && minute >= w.start || w.days[(day+6)%7] && minute < w.end
+}
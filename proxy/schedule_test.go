@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestWindow(t *testing.T) {
+	// 2024-06-03 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window model.KeepWarmWindow
+		time   time.Time
+		want   bool
+	}{
+		{model.KeepWarmWindow{Days: "mon-fri", Start: "09:00", End: "18:00"}, at(3, 9, 0), true},
+		{model.KeepWarmWindow{Days: "mon-fri", Start: "09:00", End: "18:00"}, at(3, 18, 0), false},
+		{model.KeepWarmWindow{Days: "mon-fri", Start: "09:00", End: "18:00"}, at(8, 12, 0), false},
+		{model.KeepWarmWindow{Days: "Sat,sun", Start: "10:00", End: "12:00"}, at(9, 11, 0), true},
+		{model.KeepWarmWindow{Days: "fri-mon", Start: "10:00", End: "12:00"}, at(9, 11, 0), true},
+		{model.KeepWarmWindow{Days: "fri-mon", Start: "10:00", End: "12:00"}, at(4, 11, 0), false},
+		{model.KeepWarmWindow{Start: "22:00", End: "02:00"}, at(4, 23, 30), true},
+		{model.KeepWarmWindow{Days: "fri", Start: "22:00", End: "02:00"}, at(8, 1, 0), true},
+		{model.KeepWarmWindow{Days: "fri", Start: "22:00", End: "02:00"}, at(7, 1, 0), false},
+	}
+	for _, tt := range tests {
+		w, err := ParseWindow(tt.window)
+		if err != nil {
+			t.Fatalf("ParseWindow(%v): %v", tt.window, err)
+		}
+		if got := w.Contains(tt.time); got != tt.want {
+			t.Errorf("%v contains %s = %v, want %v", tt.window, tt.time.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+
+	for _, invalid := range []model.KeepWarmWindow{
+		{Days: "weekdays", Start: "09:00", End: "18:00"},
+		{Days: "mon-", Start: "09:00", End: "18:00"},
+		{Start: "9am", End: "18:00"},
+		{Start: "09:00", End: "09:00"},
+	} {
+		if _, err := ParseWindow(invalid); err == nil {
+			t.Errorf("Expected %v to be refused", invalid)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// progressInterval is how often active streams publish progress events
+var progressInterval = time.Second
+
+// StreamProgress is published on the admin event stream as "stream.progress"
+// while a response streams and as "stream.end" when it finishes
+type StreamProgress struct {
+	RequestID      string `json:"request_id"`
+	Backend        string `json:"backend"`
+	Model          string `json:"model"`
+	Chunks         int    `json:"chunks"`
+	TokensEstimate int    `json:"tokens_estimate"`
+	ElapsedMS      int64  `json:"elapsed_ms"`
+	Aborted        bool   `json:"aborted,omitempty"`
+}
+
+// defaultStreamLine bounds the incomplete line kept for counting unless configured
+const defaultStreamLine = 1 << 20
+
+// DefaultStallTimeout is how long a write to a streaming client may block
+// before the client is considered gone
+const DefaultStallTimeout = 60 * time.Second
+
+// streamWatcher aborts streamed responses as soon as the client stops reading,
+// either by disconnecting or by not accepting data for stallTimeout. Aborting
+// closes the backend connection and releases the concurrency slot instead of
+// letting a dead client pin them. The partial output is logged.
+type streamWatcher struct {
+	rt           *Router
+	name         string
+	stallTimeout time.Duration
+	maxLine      int
+	logger       *zap.Logger
+	next         http.Handler
+}
+
+// watchStreams wraps next in a streamWatcher counting lines of up to maxLine bytes
+func (rt *Router) watchStreams(name string, stallTimeout time.Duration, maxLine int, logger *zap.Logger, next http.Handler) *streamWatcher {
+	if stallTimeout <= 0 {
+		stallTimeout = DefaultStallTimeout
+	}
+	return &streamWatcher{rt: rt, name: name, stallTimeout: stallTimeout, maxLine: maxLine, logger: logger, next: next}
+}
+
+// ServeHTTP implements http.Handler
+func (s *streamWatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := extension.FromRequest(r)
+	sw := &streamWriter{
+		ResponseWriter: w,
+		controller:     http.NewResponseController(w),
+		stallTimeout:   s.stallTimeout,
+		maxLine:        s.maxLine,
+		progress:       StreamProgress{RequestID: rc.ID, Backend: s.name, Model: rc.Model},
+		start:          time.Now(),
+	}
+	sw.lastProgress = sw.start
+	// Deferred so it also runs when the reverse proxy aborts the handler
+	defer func() {
+		if !sw.streaming {
+			return
+		}
+		sw.controller.SetWriteDeadline(time.Time{})
+		aborted := sw.writeErr != nil || r.Context().Err() != nil
+		if events.Active() {
+			progress := sw.snapshot()
+			progress.Aborted = aborted
+			events.Publish("stream.end", progress)
+		}
+		if !aborted {
+			return
+		}
+		s.rt.clientCancelled(r, s.name, true, utils.EstimateTokens(sw.chars))
+		s.logger.Warn("Client stopped reading stream, released backend",
+			zap.String("backend", s.name),
+			zap.Duration("elapsed", time.Since(sw.start)),
+			zap.Int("chunks", sw.chunks),
+			zap.Int("partialTokensEstimate", utils.EstimateTokens(sw.chars)),
+			zap.NamedError("writeError", sw.writeErr),
+			zap.NamedError("contextError", r.Context().Err()))
+	}()
+	s.next.ServeHTTP(sw, r)
+}
+
+// streamWriter bounds every write of an event stream with a deadline and
+// counts the generated text that reached the client
+type streamWriter struct {
+	http.ResponseWriter
+	controller   *http.ResponseController
+	stallTimeout time.Duration
+	maxLine      int
+	streaming    bool
+	checked      bool
+	writeErr     error
+	pending      []byte
+	skipping     bool
+	chunks       int
+	chars        int
+	progress     StreamProgress
+	start        time.Time
+	lastProgress time.Time
+}
+
+func (s *streamWriter) WriteHeader(status int) {
+	s.check()
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.check()
+	if !s.streaming {
+		return s.ResponseWriter.Write(p)
+	}
+
+	// Deadlines are unsupported by some writers, such as test recorders
+	s.controller.SetWriteDeadline(time.Now().Add(s.stallTimeout))
+	n, err := s.ResponseWriter.Write(p)
+	if err != nil {
+		s.writeErr = err
+	}
+	s.count(p[:n])
+	if events.Active() && time.Since(s.lastProgress) >= progressInterval {
+		s.lastProgress = time.Now()
+		events.Publish("stream.progress", s.snapshot())
+	}
+	return n, err
+}
+
+// snapshot returns the progress of the stream so far
+func (s *streamWriter) snapshot() StreamProgress {
+	progress := s.progress
+	progress.Chunks = s.chunks
+	progress.TokensEstimate = utils.EstimateTokens(s.chars)
+	progress.ElapsedMS = time.Since(s.start).Milliseconds()
+	return progress
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (s *streamWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// check decides once, when the response starts, whether it is an event stream
+func (s *streamWriter) check() {
+	if s.checked {
+		return
+	}
+	s.checked = true
+	s.streaming = strings.HasPrefix(s.Header().Get("Content-Type"), "text/event-stream")
+}
+
+// count tallies the data events in p, carrying an incomplete line to the next write
+func (s *streamWriter) count(p []byte) {
+	if s.skipping {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			return
+		}
+		p, s.skipping = p[i+1:], false
+	}
+	s.pending = append(s.pending, p...)
+	start := 0
+	for {
+		i := bytes.IndexByte(s.pending[start:], '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimRight(s.pending[start:start+i], "\r")
+		start += i + 1
+
+		data, ok := utils.SSEData(line)
+		if !ok || len(data) == 0 || data[0] != '{' {
+			continue
+		}
+		s.chunks++
+		// Decoding every chunk is too slow for the hot path; the text
+		// fields are found by name instead
+		s.chars += stringFieldLen(data, `"content":`) + stringFieldLen(data, `"delta":`)
+	}
+	s.pending = append(s.pending[:0], s.pending[start:]...)
+	// A line this long is not counted rather than kept in memory; what the
+	// client receives was written before counting
+	if len(s.pending) > s.maxLine {
+		s.pending = s.pending[:0]
+		s.skipping = true
+	}
+}
+
+// stringFieldLen returns the length of the first string value of key in the
+// JSON object data, counting each escape sequence as one character
+func stringFieldLen(data []byte, key string) int {
+	i := bytes.Index(data, []byte(key))
+	if i < 0 {
+		return 0
+	}
+	value := bytes.TrimLeft(data[i+len(key):], " ")
+	if len(value) == 0 || value[0] != '"' {
+		return 0
+	}
+	n := 0
+	for j := 1; j < len(value); j++ {
+		switch value[j] {
+		case '"':
+			return n
+		case '\\':
+			if j+1 < len(value) && value[j+1] == 'u' {
+				j += 5
+			} else {
+				j++
+			}
+		}
+		n++
+	}
+	return n
+}
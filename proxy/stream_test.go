@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/events"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestStalledClientReleasesBackend(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	released := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk := fmt.Sprintf("data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", strings.Repeat("x", 32<<10))
+		for {
+			if _, err := io.WriteString(w, chunk); err != nil {
+				break
+			}
+			w.(http.Flusher).Flush()
+		}
+		close(released)
+	}))
+	defer upstream.Close()
+
+	limiter := NewLimiter("up", 1, 1, 0, logger)
+	rt := NewRouter(&model.Config{})
+	handler := limiter.Wrap(rt.watchStreams("up", 200*time.Millisecond, defaultStreamLine, logger,
+		rt.newReverseProxy(upstream.URL, model.BackendConfig{Name: "up"}, logger)))
+	router := httptest.NewServer(handler)
+	defer router.Close()
+
+	// A client that sends a request and never reads the response
+	conn, err := net.Dial("tcp", router.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST /v1/chat/completions HTTP/1.1\r\nHost: router\r\nContent-Length: 2\r\n\r\n{}")
+
+	select {
+	case <-released:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected the backend stream to be closed after the client stalled")
+	}
+
+	// The slot must free up while a second request waits in the queue
+	limiter.timeout = 5 * time.Second
+	if !limiter.Acquire(httptest.NewRequest("POST", "/", nil)) {
+		t.Errorf("Expected the concurrency slot to be released")
+	}
+}
+
+func TestStreamWriterCountsPartialOutput(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "text/event-stream")
+	sw := &streamWriter{ResponseWriter: rec, controller: http.NewResponseController(rec), stallTimeout: time.Second, maxLine: defaultStreamLine}
+
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+		"event: response.output_text.delta\r\ndata: {\"delta\":\" world\"}\r\n\r\n" +
+		"data: [DONE]\n\n"
+	// Split writes in the middle of lines
+	for len(stream) > 0 {
+		n := min(7, len(stream))
+		sw.Write([]byte(stream[:n]))
+		stream = stream[n:]
+	}
+
+	if sw.chunks != 2 {
+		t.Errorf("Expected 2 chunks, got %d", sw.chunks)
+	}
+	if sw.chars != len("Hello world") {
+		t.Errorf("Expected %d characters, got %d", len("Hello world"), sw.chars)
+	}
+	if rec.Body.Len() == 0 {
+		t.Errorf("Expected the stream to reach the client")
+	}
+}
+
+func TestStreamWriterSkipsOverlongLines(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "text/event-stream")
+	sw := &streamWriter{ResponseWriter: rec, controller: http.NewResponseController(rec), stallTimeout: time.Second, maxLine: 64}
+
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"" + strings.Repeat("z", 1000) + "\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"after\"}}]}\n\n"
+	for i := 0; i < len(stream); i += 10 {
+		sw.Write([]byte(stream[i:min(i+10, len(stream))]))
+		if len(sw.pending) > 64+10 {
+			t.Fatalf("Expected the pending line to stay bounded, got %d bytes", len(sw.pending))
+		}
+	}
+
+	if sw.chunks != 1 || sw.chars != len("after") {
+		t.Errorf("Expected only the chunk after the long line to be counted, got %d chunks of %d characters", sw.chunks, sw.chars)
+	}
+	if rec.Body.String() != stream {
+		t.Errorf("Expected the client to receive the whole stream")
+	}
+}
+
+func TestStreamProgressEvents(t *testing.T) {
+	progressInterval = 0
+	defer func() { progressInterval = time.Second }()
+	ch, unsubscribe := events.Subscribe(16)
+	defer unsubscribe()
+
+	handler := NewRouter(&model.Config{}).watchStreams("up", time.Second, defaultStreamLine, zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+	var types []string
+	var last StreamProgress
+	for len(ch) > 0 {
+		event := <-ch
+		types = append(types, event.Type)
+		last = event.Data.(StreamProgress)
+	}
+	if strings.Join(types, ",") != "stream.progress,stream.progress,stream.end" {
+		t.Errorf("Unexpected events %v", types)
+	}
+	if last.Backend != "up" || last.Chunks != 2 || last.TokensEstimate == 0 || last.Aborted {
+		t.Errorf("Unexpected final progress %+v", last)
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/structured"
+	"go.uber.org/zap"
+)
+
+type schemaKey struct{}
+
+// emulateStructuredOutput returns a handler that replaces a json_schema
+// response_format with prompt instructions for backends that lack support
+func emulateStructuredOutput(name string, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chatReq, ok := readJSONBody(r, name, logger)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		schema, ok := structured.Apply(chatReq)
+		if !ok || writeJSONBody(r, chatReq) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Debug("Emulating structured output with prompt instructions", zap.String("backend", name))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), schemaKey{}, schema)))
+	})
+}
+
+// repairStructuredOutput extracts JSON from each choice, or output text of a
+// responses answer, of an emulated structured output response and validates it
+// against the requested schema. The outcome is reported in the
+// X-Router-Structured-Output header as valid, repaired or invalid.
+func repairStructuredOutput(resp *http.Response, name string, logger *zap.Logger) error {
+	schema, ok := resp.Request.Context().Value(schemaKey{}).(map[string]interface{})
+	if !ok || resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var completion map[string]interface{}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil
+	}
+
+	outcome := "valid"
+	for _, answer := range answerTexts(completion) {
+		content, ok := answer.holder[answer.field].(string)
+		if !ok {
+			continue
+		}
+
+		repaired, ok := structured.Repair(content)
+		if !ok {
+			outcome = "invalid"
+			logger.Warn("Structured output is not JSON", zap.String("backend", name))
+			continue
+		}
+		var value interface{}
+		json.Unmarshal([]byte(repaired), &value)
+		if err := structured.Validate(schema, value); err != nil {
+			outcome = "invalid"
+			logger.Warn("Structured output does not match schema", zap.String("backend", name), zap.Error(err))
+		} else if repaired != content && outcome == "valid" {
+			outcome = "repaired"
+		}
+		answer.holder[answer.field] = repaired
+	}
+
+	if modified, err := json.Marshal(completion); err == nil {
+		resp.Body = io.NopCloser(bytes.NewReader(modified))
+		resp.ContentLength = int64(len(modified))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(modified)))
+	}
+	resp.Header.Set("X-Router-Structured-Output", outcome)
+	return nil
+}
+
+// answerText is a field of a response holding answer text
+type answerText struct {
+	holder map[string]interface{}
+	field  string
+}
+
+// answerTexts returns the message contents of a chat completion's choices and
+// the output texts of a responses answer
+func answerTexts(completion map[string]interface{}) []answerText {
+	var texts []answerText
+	choices, _ := completion["choices"].([]interface{})
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		if message, ok := choice["message"].(map[string]interface{}); ok {
+			texts = append(texts, answerText{message, "content"})
+		}
+	}
+	output, _ := completion["output"].([]interface{})
+	for _, o := range output {
+		item, _ := o.(map[string]interface{})
+		content, _ := item["content"].([]interface{})
+		for _, p := range content {
+			if part, _ := p.(map[string]interface{}); part["type"] == "output_text" {
+				texts = append(texts, answerText{part, "text"})
+			}
+		}
+	}
+	return texts
+}
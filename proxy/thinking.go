@@ -0,0 +1,312 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// thinkUndecided bounds how much of an answer is held back to learn whether it
+// starts inside a block opened by the prompt
+const thinkUndecided = 8 << 10
+
+// thinkKey marks requests whose answers are stripped, holding whether the
+// family's chat template opens the block in the prompt
+type thinkKey struct{}
+
+// stripThinking removes the <think> blocks of models that reason aloud from
+// the answers of requests marked by adaptToFamily, for clients that would show
+// them as part of the answer. Streamed answers are filtered as they arrive.
+func stripThinking(resp *http.Response, maxLine int) error {
+	opened, strip := resp.Request.Context().Value(thinkKey{}).(bool)
+	if !strip || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		stream := &thinkStream{filters: make(map[string]*thinkFilter), opened: opened}
+		resp.Body = newLineRewriter(resp.Body, stream.rewrite, stream.end, maxLine)
+		return nil
+	}
+	body, ok, err := readResponseBody(resp)
+	if !ok {
+		return err
+	}
+	var completion map[string]interface{}
+	if json.Unmarshal(body, &completion) == nil {
+		choices, _ := completion["choices"].([]interface{})
+		for _, c := range choices {
+			choice, _ := c.(map[string]interface{})
+			message, _ := choice["message"].(map[string]interface{})
+			if text, ok := message["content"].(string); ok {
+				message["content"] = stripThinkBlocks(text)
+			}
+			if text, ok := choice["text"].(string); ok {
+				choice["text"] = stripThinkBlocks(text)
+			}
+		}
+		// Responses carry the answer in the text parts of their output items
+		output, _ := completion["output"].([]interface{})
+		stripOutputItems(output)
+		if modified, err := encodeJSON(completion); err == nil {
+			body = modified
+		}
+	}
+	replaceResponseBody(resp, body)
+	return nil
+}
+
+// stripThinkBlocks removes the <think> blocks of a whole answer. Chat templates
+// often open the block in the prompt, so an answer starting inside one is
+// recognized by its closing tag.
+func stripThinkBlocks(text string) string {
+	if end := strings.Index(text, thinkClose); end >= 0 && !strings.Contains(text[:end], thinkOpen) {
+		text = thinkOpen + text
+	}
+	f := thinkFilter{decided: true}
+	return f.write(text) + f.flush()
+}
+
+// stripOutputItems removes the <think> blocks of the text parts of responses
+// API output items
+func stripOutputItems(items []interface{}) {
+	for _, i := range items {
+		item, _ := i.(map[string]interface{})
+		parts, _ := item["content"].([]interface{})
+		for _, p := range parts {
+			part, _ := p.(map[string]interface{})
+			if text, ok := part["text"].(string); ok {
+				part["text"] = stripThinkBlocks(text)
+			}
+		}
+	}
+}
+
+// thinkStream filters the text of a streamed answer, keeping a filter per
+// choice of chat completions and per content part of responses. The event
+// line naming a responses event is held until its data is rewritten, so
+// text held back can be sent in an event of its own before it.
+type thinkStream struct {
+	filters map[string]*thinkFilter
+	event   []byte
+	opened  bool
+}
+
+// filter returns the filter of the text identified by key
+func (s *thinkStream) filter(key string) *thinkFilter {
+	f := s.filters[key]
+	if f == nil {
+		f = &thinkFilter{opened: s.opened}
+		s.filters[key] = f
+	}
+	return f
+}
+
+// rewrite filters the content of the events in complete stream lines
+func (s *thinkStream) rewrite(lines []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("event:")) {
+			out.Write(s.event)
+			s.event = append([]byte(nil), line...)
+			continue
+		}
+		data, ok := utils.SSEData(line)
+		var chunk map[string]interface{}
+		if !ok || json.Unmarshal(data, &chunk) != nil {
+			out.Write(s.event)
+			s.event = nil
+			out.Write(line)
+			continue
+		}
+
+		if _, ok := chunk["choices"]; ok {
+			s.rewriteChoices(chunk)
+		} else {
+			s.rewriteResponseEvent(chunk, &out)
+		}
+		out.Write(s.event)
+		s.event = nil
+		rewritten, err := encodeJSON(chunk)
+		if err != nil {
+			out.Write(line)
+			continue
+		}
+		out.WriteString("data: ")
+		out.Write(rewritten)
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// end returns an event line the stream ended on
+func (s *thinkStream) end() []byte {
+	event := s.event
+	s.event = nil
+	return event
+}
+
+// rewriteChoices filters the text of the choices of a chat completions or
+// completions chunk
+func (s *thinkStream) rewriteChoices(chunk map[string]interface{}) {
+	choices, _ := chunk["choices"].([]interface{})
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		f := s.filter(fmt.Sprint(choice["index"]))
+		// Chat completions stream deltas, completions text
+		object, key := choice, "text"
+		if delta, ok := choice["delta"].(map[string]interface{}); ok {
+			object, key = delta, "content"
+		}
+		text, _ := object[key].(string)
+		text = f.write(text)
+		// The last chunk of a choice carries what was held back
+		if choice["finish_reason"] != nil {
+			text += f.flush()
+		}
+		if _, ok := object[key].(string); ok || text != "" {
+			object[key] = text
+		}
+	}
+}
+
+// rewriteResponseEvent filters the text of a responses API event. What was held
+// back of a content part is written to out as a delta event before the event
+// that ends the part.
+func (s *thinkStream) rewriteResponseEvent(event map[string]interface{}, out *bytes.Buffer) {
+	key := fmt.Sprint(event["output_index"], "/", event["content_index"])
+	switch event["type"] {
+	case "response.output_text.delta":
+		delta, _ := event["delta"].(string)
+		event["delta"] = s.filter(key).write(delta)
+	case "response.output_text.done":
+		if held := s.filter(key).flush(); held != "" {
+			delta := map[string]interface{}{
+				"type":          "response.output_text.delta",
+				"output_index":  event["output_index"],
+				"content_index": event["content_index"],
+				"delta":         held,
+			}
+			if id, ok := event["item_id"]; ok {
+				delta["item_id"] = id
+			}
+			if encoded, err := encodeJSON(delta); err == nil {
+				out.WriteString("event: response.output_text.delta\ndata: ")
+				out.Write(encoded)
+				out.WriteString("\n\n")
+			}
+		}
+		if text, ok := event["text"].(string); ok {
+			event["text"] = stripThinkBlocks(text)
+		}
+	case "response.content_part.done":
+		stripOutputItems([]interface{}{map[string]interface{}{"content": []interface{}{event["part"]}}})
+	case "response.output_item.done":
+		stripOutputItems([]interface{}{event["item"]})
+	case "response.completed", "response.incomplete":
+		response, _ := event["response"].(map[string]interface{})
+		output, _ := response["output"].([]interface{})
+		stripOutputItems(output)
+	}
+}
+
+// thinkFilter removes <think> blocks from text arriving in pieces, holding back
+// what may be the start of a tag until the next piece tells. The answer starts
+// inside a block the prompt opened if a closing tag comes before any opening
+// tag. When the chat template opens blocks, the start of the answer is held
+// back until a tag or thinkUndecided bytes without one tell; otherwise the
+// first content decides.
+type thinkFilter struct {
+	opened  bool
+	decided bool
+	inside  bool
+	// trim drops the whitespace models put after a block
+	trim    bool
+	pending string
+}
+
+// write returns the text outside blocks that can be passed on so far
+func (f *thinkFilter) write(text string) string {
+	text, f.pending = f.pending+text, ""
+	if !f.decided {
+		open, end := strings.Index(text, thinkOpen), strings.Index(text, thinkClose)
+		switch {
+		case text == "":
+			return ""
+		case end >= 0 && (open < 0 || end < open):
+			text, f.trim = text[end+len(thinkClose):], true
+		case f.opened && open < 0 && len(text) <= thinkUndecided:
+			f.pending = text
+			return ""
+		}
+		f.decided = true
+	}
+	var out strings.Builder
+	for text != "" {
+		tag := thinkOpen
+		if f.inside {
+			tag = thinkClose
+		}
+		i := strings.Index(text, tag)
+		if i < 0 {
+			keep := partialTag(text, tag)
+			if !f.inside {
+				f.emit(&out, text[:len(text)-keep])
+			}
+			f.pending = text[len(text)-keep:]
+			break
+		}
+		if !f.inside {
+			f.emit(&out, text[:i])
+		}
+		text = text[i+len(tag):]
+		f.inside = !f.inside
+		f.trim = !f.inside
+	}
+	return out.String()
+}
+
+// flush returns the text held back at the end of the answer
+func (f *thinkFilter) flush() string {
+	text := f.pending
+	f.pending = ""
+	if f.inside {
+		return ""
+	}
+	var out strings.Builder
+	f.emit(&out, text)
+	return out.String()
+}
+
+func (f *thinkFilter) emit(out *strings.Builder, text string) {
+	if f.trim {
+		text = strings.TrimLeft(text, " \t\r\n")
+		f.trim = text == ""
+	}
+	out.WriteString(text)
+}
+
+// partialTag returns the length of the longest end of text that starts tag
+func partialTag(text, tag string) int {
+	for n := min(len(text), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestThinkFilterAcrossPieces(t *testing.T) {
+	var f thinkFilter
+	var got strings.Builder
+	for _, piece := range []string{"<thi", "nk>Let me see", " what 2+2 is.</th", "ink>\n\n", "It is 4", " <", "3"} {
+		got.WriteString(f.write(piece))
+	}
+	got.WriteString(f.flush())
+	if got.String() != "It is 4 <3" {
+		t.Errorf("Expected the think block removed, got %q", got.String())
+	}
+
+	opened := thinkFilter{opened: true}
+	got.Reset()
+	for _, piece := range []string{"The prompt", " opened the block.</th", "ink>\n\nIt is 4"} {
+		got.WriteString(opened.write(piece))
+	}
+	if got.String() != "It is 4" {
+		t.Errorf("Expected a stream starting inside a block to lose it, got %q", got.String())
+	}
+	plain := thinkFilter{opened: true}
+	if held := plain.write("No reasoning"); held != "" {
+		t.Errorf("Expected the start of an answer held back until it is decided, got %q", held)
+	}
+	if rest := plain.flush(); rest != "No reasoning" {
+		t.Errorf("Expected the held answer at the end, got %q", rest)
+	}
+	var unopened thinkFilter
+	if passed := unopened.write("") + unopened.write("No reasoning"); passed != "No reasoning" {
+		t.Errorf("Expected the first content to decide when the template opens no block, got %q", passed)
+	}
+	if passed := unopened.write(" here, </think> is just text"); passed != " here, </think> is just text" {
+		t.Errorf("Expected a later closing tag left alone, got %q", passed)
+	}
+	long := thinkFilter{opened: true}
+	if passed := long.write(strings.Repeat("a", thinkUndecided+1)); len(passed) != thinkUndecided+1 {
+		t.Errorf("Expected an answer without tags passed on after %d bytes, got %d", thinkUndecided, len(passed))
+	}
+
+	if stripped := stripThinkBlocks("The prompt opened the block.</think>\nAnswer"); stripped != "Answer" {
+		t.Errorf("Expected an answer starting inside a block to lose it, got %q", stripped)
+	}
+	if stripped := stripThinkBlocks("No reasoning here"); stripped != "No reasoning here" {
+		t.Errorf("Expected an answer without blocks unchanged, got %q", stripped)
+	}
+}
+
+func TestThinkingIsStrippedForBackendsAskingForIt(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/responses") && strings.Contains(r.URL.Path, "stream") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range []string{
+				`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"content_index":0,"delta":"Hmm...</think>"}`,
+				`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"content_index":0,"delta":"\n\nHi"}`,
+				`{"type":"response.output_text.done","item_id":"msg_1","output_index":0,"content_index":0,"text":"Hmm...</think>\n\nHi"}`,
+				`{"type":"response.completed","response":{"output":[{"type":"message","content":[{"type":"output_text","text":"Hmm...</think>\n\nHi"}]}]}}`,
+			} {
+				var typed struct{ Type string }
+				json.Unmarshal([]byte(event), &typed)
+				io.WriteString(w, "event: "+typed.Type+"\ndata: "+event+"\n\n")
+			}
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/responses") {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"output":[{"type":"reasoning","summary":[]},{"type":"message","content":[{"type":"output_text","text":"<think>Hmm...</think>\n\nHi there"}]}]}`)
+			return
+		}
+		if strings.Contains(r.URL.Path, "stream") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","content":"<think>Hmm"},"finish_reason":null}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"...</think>\n\nHi"},"finish_reason":null}]}`,
+				`{"choices":[{"index":0,"delta":{"content":" there <"},"finish_reason":null}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			} {
+				io.WriteString(w, "data: "+chunk+"\n\n")
+			}
+			io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"<think>Hmm...</think>\n\nHi there"}}]}`)
+	}))
+	defer upstream.Close()
+
+	rt := NewRouter(&model.Config{
+		Backends: []model.BackendConfig{
+			{Name: "r1", BaseURL: upstream.URL, Prefix: "r1/", StripThinking: true},
+			{Name: "r1-raw", BaseURL: upstream.URL, Prefix: "r1-raw/"},
+		},
+		Logger: logger,
+	})
+	send := func(prefix, path, body string) string {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		rt.proxies[prefix].ServeHTTP(rec, extension.WithRequestContext(r, extension.NewRequestContext(r, "")))
+		return rec.Body.String()
+	}
+
+	if body := send("r1/", "/v1/chat/completions", `{"model":"deepseek-r1:14b"}`); strings.Contains(body, "Hmm") || !strings.Contains(body, `"content":"Hi there"`) {
+		t.Errorf("Expected the think block removed from the answer, got %s", body)
+	}
+	body := send("r1/", "/stream/v1/chat/completions", `{"model":"deepseek-r1:14b","stream":true}`)
+	if strings.Contains(body, "Hmm") || !strings.Contains(body, `"content":"Hi"`) ||
+		!strings.Contains(body, `"content":" there "`) || !strings.Contains(body, `"content":"<"`) || !strings.Contains(body, "data: [DONE]") {
+		t.Errorf("Expected the think block removed from the stream, got %s", body)
+	}
+	if body := send("r1/", "/v1/responses", `{"model":"deepseek-r1:14b"}`); strings.Contains(body, "Hmm") || !strings.Contains(body, `"text":"Hi there"`) {
+		t.Errorf("Expected the think block removed from the response output, got %s", body)
+	}
+	body = send("r1/", "/stream/v1/responses", `{"model":"deepseek-r1:14b","stream":true}`)
+	if strings.Contains(body, "Hmm") || strings.Count(body, `"text":"Hi"`) != 2 ||
+		!strings.Contains(body, "event: response.output_text.delta\ndata: ") || !strings.Contains(body, `"delta":"Hi"`) {
+		t.Errorf("Expected the think block removed from the response stream, got %s", body)
+	}
+	if body := send("r1/", "/v1/chat/completions", `{"model":"llama3.1"}`); !strings.Contains(body, "Hmm") {
+		t.Errorf("Expected answers of models without think tags unchanged, got %s", body)
+	}
+	if body := send("r1-raw/", "/v1/chat/completions", `{"model":"deepseek-r1:14b"}`); !strings.Contains(body, "Hmm") {
+		t.Errorf("Expected answers unchanged without strip_thinking, got %s", body)
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// Protocols a backend transport can speak
+const (
+	ProtocolAuto  = "auto"
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "http2"
+)
+
+// ProxyDirect connects to a backend without a proxy, whatever the environment says
+const ProxyDirect = "direct"
+
+// NewTransport builds the transport a backend's config describes, starting
+// from Go's default transport, which honors the proxy environment variables
+// and the system trust store
+func NewTransport(tc model.TransportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch tc.Protocol {
+	case "", ProtocolAuto:
+	case ProtocolHTTP1:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP1(true)
+	case ProtocolHTTP2:
+		// Without HTTP/1 to fall back to, plain http URLs use h2c with prior knowledge
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q (available: %s, %s, %s)", tc.Protocol, ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if tc.DialTimeout > 0 {
+		dialer.Timeout = time.Duration(tc.DialTimeout) * time.Second
+	}
+	if tc.KeepAlive > 0 {
+		dialer.KeepAlive = time.Duration(tc.KeepAlive) * time.Second
+	}
+	transport.DialContext = dialer.DialContext
+
+	if tc.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = tc.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < tc.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = tc.MaxIdleConnsPerHost
+		}
+	}
+	transport.MaxConnsPerHost = tc.MaxConnsPerHost
+	if tc.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = time.Duration(tc.IdleConnTimeout) * time.Second
+	}
+	transport.DisableKeepAlives = tc.DisableKeepAlives
+
+	switch tc.Proxy {
+	case "":
+	case ProxyDirect:
+		transport.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(tc.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", tc.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if tc.CAFile != "" || tc.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: tc.InsecureSkipVerify}
+	}
+	if tc.CAFile != "" {
+		pem, err := os.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", tc.CAFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return transport, nil
+}
+
+// transportFor returns the transport of a backend, shared by its instances and
+// model listing, creating it on first use
+func (rt *Router) transportFor(backend model.BackendConfig) (http.RoundTripper, error) {
+	if rt.transport != nil {
+		return rt.transport, nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if transport, ok := rt.transports[backend.Name]; ok {
+		return transport, nil
+	}
+	transport, err := NewTransport(backend.Transport)
+	if err != nil {
+		return nil, err
+	}
+	rt.transports[backend.Name] = transport
+	return transport, nil
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// newH2CServer returns a backend serving HTTP/1 and h2c that reports the protocol of each request
+func newH2CServer() *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	return server
+}
+
+func TestTransportProtocols(t *testing.T) {
+	server := newH2CServer()
+	defer server.Close()
+
+	for protocol, want := range map[string]string{"": "HTTP/1.1", ProtocolHTTP1: "HTTP/1.1", ProtocolHTTP2: "HTTP/2.0"} {
+		rt := NewRouter(&model.Config{Backends: []model.BackendConfig{
+			{Name: "vllm", BaseURL: server.URL, Prefix: "vllm/", Default: true, Transport: model.TransportConfig{Protocol: protocol}},
+		}, Logger: zap.NewNop()})
+		rec := httptest.NewRecorder()
+		defaultProxy(rt).ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("protocol %q: expected %s upstream, got %q", protocol, want, got)
+		}
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	transport, err := NewTransport(model.TransportConfig{MaxIdleConnsPerHost: 500, MaxConnsPerHost: 64, IdleConnTimeout: 300, DisableKeepAlives: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.MaxIdleConnsPerHost != 500 || transport.MaxIdleConns < 500 || transport.MaxConnsPerHost != 64 ||
+		transport.IdleConnTimeout != 300*time.Second || !transport.DisableKeepAlives {
+		t.Errorf("Settings not applied: %+v", transport)
+	}
+	if _, err := NewTransport(model.TransportConfig{Protocol: "spdy"}); err == nil || !strings.Contains(err.Error(), "spdy") {
+		t.Errorf("Expected an unknown protocol error, got %v", err)
+	}
+}
+
+func TestFetchModelsUsesBackendTransport(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("Expected h2c, got %s", r.Proto)
+		}
+		io.WriteString(w, `{"data":[{"id":"llama3"}]}`)
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	models, err := FetchModels(server.URL, model.BackendConfig{Name: "h2c-only", Transport: model.TransportConfig{Protocol: ProtocolHTTP2}})
+	if err != nil || len(models) != 1 {
+		t.Errorf("Expected one model over h2c, got %v %v", models, err)
+	}
+}
+
+func TestTransportTrust(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":[{"id":"local-model"}]}`)
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	tests := []struct {
+		name string
+		tc   model.TransportConfig
+		ok   bool
+	}{
+		{"system trust store", model.TransportConfig{}, false},
+		{"custom CA", model.TransportConfig{CAFile: caFile}, true},
+		{"skip verify", model.TransportConfig{InsecureSkipVerify: true}, true},
+	}
+	for i, tt := range tests {
+		backend := model.BackendConfig{Name: fmt.Sprintf("lmstudio-%d", i), Transport: tt.tc}
+		_, err := FetchModels(server.URL, backend)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected success %v, got %v", tt.name, tt.ok, err)
+		}
+	}
+
+	if _, err := NewTransport(model.TransportConfig{CAFile: os.DevNull}); err == nil {
+		t.Errorf("Expected an empty CA bundle to be rejected")
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	var proxied string
+	outbound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Proxies are sent the absolute URL of the backend
+		proxied = r.URL.String()
+		io.WriteString(w, `{"data":[]}`)
+	}))
+	defer outbound.Close()
+
+	backend := model.BackendConfig{Name: "corporate", Transport: model.TransportConfig{Proxy: outbound.URL}}
+	if _, err := FetchModels("http://backend.internal:8080", backend); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "http://backend.internal:8080/v1/models" {
+		t.Errorf("Expected the request to go through the proxy, got %q", proxied)
+	}
+
+	for _, proxy := range []string{"proxy.internal:3128", "::"} {
+		if _, err := NewTransport(model.TransportConfig{Proxy: proxy}); err == nil {
+			t.Errorf("Expected proxy %q to be rejected", proxy)
+		}
+	}
+	if transport, err := NewTransport(model.TransportConfig{Proxy: ProxyDirect}); err != nil || transport.Proxy != nil {
+		t.Errorf("Expected direct connections, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/tokenizer"
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// countBatch is how much completion text is collected before it is counted,
+// so long streams are not held in memory
+const countBatch = 64 << 10
+
+// injectUsage adds estimated token usage to chat completions and responses
+// that lack it, so clients showing the cost of each request work the same
+// with every backend. Prompt tokens are the request's estimate; completion
+// tokens are counted with the tokenizer tokenizers selects for the model. Streams get usage only when
+// the client asked for it with stream_options.include_usage, and the
+// Responses API's response.completed event always carries it.
+func injectUsage(resp *http.Response, maxLine int, tokenizers *tokenizer.Set) error {
+	rc := extension.FromRequest(resp.Request)
+	path := resp.Request.URL.Path
+	if rc.ChatRequest == nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	if path != "/v1/chat/completions" && path != "/v1/responses" {
+		return nil
+	}
+
+	counter := &usageCounter{rc: rc, tokenizers: tokenizers}
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		options, _ := rc.ChatRequest["stream_options"].(map[string]interface{})
+		if include, _ := options["include_usage"].(bool); path == "/v1/chat/completions" && !include {
+			return nil
+		}
+		resp.Body = newLineRewriter(resp.Body, counter.rewriteLines, counter.end, maxLine)
+		return nil
+	}
+
+	body, ok, err := readResponseBody(resp)
+	if !ok {
+		return err
+	}
+	body = counter.completeBody(body)
+	replaceResponseBody(resp, body)
+	return nil
+}
+
+// usageCounter follows a response, counting the completion text and
+// supplying usage where the backend reported none
+type usageCounter struct {
+	rc         *extension.RequestContext
+	tokenizers *tokenizer.Set
+	text       strings.Builder
+	completion int
+	reported   bool
+	last       streamEvent
+}
+
+// streamEvent holds the fields of an event the counter reads
+type streamEvent struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Object  string          `json:"object"`
+	Created int64           `json:"created"`
+	Model   string          `json:"model"`
+	Usage   json.RawMessage `json:"usage"`
+	Delta   json.RawMessage `json:"delta"`
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		Message struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Output []struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+}
+
+// add counts completion text, in batches
+func (u *usageCounter) add(text string) {
+	u.text.WriteString(text)
+	if u.text.Len() >= countBatch {
+		u.flush()
+	}
+}
+
+// flush counts the text collected so far
+func (u *usageCounter) flush() {
+	if u.text.Len() > 0 {
+		u.completion += u.tokenizers.Count(u.rc.Model, u.text.String())
+		u.text.Reset()
+	}
+}
+
+// usage returns the estimated usage in the field names of the API
+func (u *usageCounter) usage() map[string]interface{} {
+	u.flush()
+	u.rc.UsageEstimated = true
+	prompt := u.rc.TokensEstimate
+	if u.last.Object == "chat.completion.chunk" || u.last.Object == "chat.completion" {
+		return map[string]interface{}{"prompt_tokens": prompt, "completion_tokens": u.completion,
+			"total_tokens": prompt + u.completion, "estimated": true}
+	}
+	return map[string]interface{}{"input_tokens": prompt, "output_tokens": u.completion,
+		"total_tokens": prompt + u.completion, "estimated": true}
+}
+
+// read decodes an event or body, counting its text and noting reported usage
+func (u *usageCounter) read(data []byte) (streamEvent, bool) {
+	var event streamEvent
+	if json.Unmarshal(data, &event) != nil {
+		return event, false
+	}
+	if hasUsage(event.Usage) {
+		u.reported = true
+	}
+	for _, choice := range event.Choices {
+		u.add(choice.Delta.Content + choice.Delta.ReasoningContent + choice.Message.Content + choice.Message.ReasoningContent)
+	}
+	for _, item := range event.Output {
+		for _, part := range item.Content {
+			u.add(part.Text)
+		}
+	}
+	var delta string
+	if event.Type == "response.output_text.delta" && json.Unmarshal(event.Delta, &delta) == nil {
+		u.add(delta)
+	}
+	if event.Object != "" {
+		u.last = event
+	}
+	return event, true
+}
+
+// completeBody adds usage to a JSON response that has none
+func (u *usageCounter) completeBody(body []byte) []byte {
+	event, ok := u.read(body)
+	if !ok || u.reported || (event.Object != "chat.completion" && event.Object != "response") {
+		return body
+	}
+	completed, ok := setUsage(body, u.usage())
+	if !ok {
+		return body
+	}
+	return completed
+}
+
+// rewriteLines counts the events in complete lines of a stream, fills in the
+// usage of a response.completed event and adds a usage chunk before the end
+// of a chat completions stream
+func (u *usageCounter) rewriteLines(lines []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		data, ok := utils.SSEData(line)
+		if !ok {
+			out.Write(line)
+			continue
+		}
+		if string(data) == "[DONE]" {
+			out.Write(u.end())
+			out.Write(line)
+			continue
+		}
+		event, ok := u.read(data)
+		if !ok || event.Type != "response.completed" || u.reported {
+			out.Write(line)
+			continue
+		}
+		var completed map[string]json.RawMessage
+		var response struct {
+			Usage json.RawMessage `json:"usage"`
+		}
+		if json.Unmarshal(data, &completed) != nil || json.Unmarshal(completed["response"], &response) != nil || hasUsage(response.Usage) {
+			out.Write(line)
+			continue
+		}
+		u.last.Object = "response"
+		filled, ok := setUsage(completed["response"], u.usage())
+		if !ok {
+			out.Write(line)
+			continue
+		}
+		completed["response"] = filled
+		encoded, err := encodeJSON(completed)
+		if err != nil {
+			out.Write(line)
+			continue
+		}
+		out.WriteString("data: ")
+		out.Write(encoded)
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// end returns a usage chunk for a chat completions stream that reported none,
+// once
+func (u *usageCounter) end() []byte {
+	if u.reported || u.last.Object != "chat.completion.chunk" {
+		return nil
+	}
+	u.reported = true
+	chunk, _ := json.Marshal(map[string]interface{}{
+		"id":      u.last.ID,
+		"object":  u.last.Object,
+		"created": u.last.Created,
+		"model":   u.last.Model,
+		"choices": []interface{}{},
+		"usage":   u.usage(),
+	})
+	return append(append([]byte("data: "), chunk...), "\n\n"...)
+}
+
+// setUsage sets the usage of a JSON object that has none
+func setUsage(data []byte, usage map[string]interface{}) ([]byte, bool) {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(data, &object) != nil || object == nil || hasUsage(object["usage"]) {
+		return data, false
+	}
+	object["usage"], _ = json.Marshal(usage)
+	out, err := encodeJSON(object)
+	if err != nil {
+		return data, false
+	}
+	return out, true
+}
+
+// hasUsage reports whether a usage field is set
+func hasUsage(usage json.RawMessage) bool {
+	return len(usage) > 0 && string(usage) != "null"
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/extension"
+)
+
+// usageResponse runs injectUsage on a response to a request with chatReq and
+// returns the body the client would receive
+func usageResponse(t *testing.T, path, contentType, body string, chatReq map[string]interface{}) (string, *extension.RequestContext) {
+	t.Helper()
+	rc := &extension.RequestContext{}
+	rc.SetChatRequest(chatReq, nil)
+	req := extension.WithRequestContext(httptest.NewRequest("POST", path, nil), rc)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+	if err := injectUsage(resp, defaultStreamLine, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), rc
+}
+
+func TestInjectUsageIntoStream(t *testing.T) {
+	chatReq := map[string]interface{}{
+		"model":          "llama3",
+		"stream":         true,
+		"stream_options": map[string]interface{}{"include_usage": true},
+		"messages":       []interface{}{map[string]interface{}{"role": "user", "content": "Say hello to everyone"}},
+	}
+	stream := `data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"llama3","choices":[{"delta":{"content":"Hello there, "}}]}` + "\n\n" +
+		`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"llama3","choices":[{"delta":{"content":"everyone!"}}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+	out, rc := usageResponse(t, "/v1/chat/completions", "text/event-stream", stream, chatReq)
+
+	usageAt, doneAt := strings.Index(out, `"usage"`), strings.Index(out, "[DONE]")
+	if usageAt < 0 || usageAt > doneAt {
+		t.Fatalf("Expected a usage chunk before [DONE], got %q", out)
+	}
+	prompt, completion, total, err := audit.Usage([]byte(out))
+	if err != nil || prompt != rc.TokensEstimate || completion != 6 || total != prompt+completion {
+		t.Errorf("Expected estimated usage, got %d %d %d %v", prompt, completion, total, err)
+	}
+	if !rc.UsageEstimated {
+		t.Error("Expected the request to be marked as estimated")
+	}
+
+	// Without include_usage the stream is untouched, as OpenAI would send it
+	delete(chatReq, "stream_options")
+	if out, _ := usageResponse(t, "/v1/chat/completions", "text/event-stream", stream, chatReq); out != stream {
+		t.Errorf("Expected the stream unchanged, got %q", out)
+	}
+
+	// Reported usage is kept
+	reported := strings.Replace(stream, "data: [DONE]", `data: {"id":"c1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":4,"total_tokens":13}}`+"\n\ndata: [DONE]", 1)
+	chatReq["stream_options"] = map[string]interface{}{"include_usage": true}
+	if out, rc := usageResponse(t, "/v1/chat/completions", "text/event-stream", reported, chatReq); out != reported || rc.UsageEstimated {
+		t.Errorf("Expected reported usage to be kept, got %q", out)
+	}
+}
+
+func TestInjectUsageIntoResponsesStream(t *testing.T) {
+	chatReq := map[string]interface{}{"model": "llama3", "stream": true, "input": "hi"}
+	stream := "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"Hello <there>\"}\n\n" +
+		"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"r1\",\"usage\":null}}\n\n"
+	out, _ := usageResponse(t, "/v1/responses", "text/event-stream", stream, chatReq)
+
+	if !strings.Contains(out, `"output_tokens":4`) || !strings.Contains(out, "event: response.completed\n") {
+		t.Errorf("Expected usage in response.completed, got %q", out)
+	}
+}
+
+func TestInjectUsageIntoBody(t *testing.T) {
+	chatReq := map[string]interface{}{"model": "llama3", "messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi"}}}
+	body := `{"id":"c1","object":"chat.completion","choices":[{"message":{"role":"assistant","content":"Hello there!"}}]}`
+	out, _ := usageResponse(t, "/v1/chat/completions", "application/json", body, chatReq)
+
+	var completion struct {
+		Usage map[string]interface{} `json:"usage"`
+	}
+	json.Unmarshal([]byte(out), &completion)
+	if completion.Usage["completion_tokens"] != 3.0 || completion.Usage["estimated"] != true {
+		t.Errorf("Expected estimated usage, got %s", out)
+	}
+
+	// Bodies that are not completions are left alone
+	if out, _ := usageResponse(t, "/v1/chat/completions", "application/json", `{"choices":[]}`, chatReq); out != `{"choices":[]}` {
+		t.Errorf("Expected an unknown body unchanged, got %s", out)
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kcolemangt/llm-router/vision"
+	"go.uber.org/zap"
+)
+
+// adaptImages returns a handler that resizes or strips image parts in chat
+// requests according to the backend's image mode
+func adaptImages(backend string, mode string, maxDimension int, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chatReq, ok := readJSONBody(r, backend, logger)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result, err := vision.Adapt(chatReq, mode, maxDimension)
+		if err != nil {
+			// Forward the original request and let the backend decide
+			logger.Warn("Failed to adapt images", zap.String("backend", backend), zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+		if result.Resized == 0 && result.Stripped == 0 && result.Oversized == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := writeJSONBody(r, chatReq); err != nil {
+			logger.Warn("Failed to encode adapted request", zap.String("backend", backend), zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if result.Stripped > 0 {
+			logger.Warn("Removed images for text-only backend",
+				zap.String("backend", backend),
+				zap.Int("images", result.Stripped))
+			w.Header().Set("X-Router-Warning", fmt.Sprintf("%d image(s) removed: backend %s does not accept images", result.Stripped, backend))
+		}
+		if result.Oversized > 0 {
+			logger.Warn("Removed images too large to resize",
+				zap.String("backend", backend),
+				zap.Int("images", result.Oversized))
+			w.Header().Add("X-Router-Warning", fmt.Sprintf("%d image(s) removed: more than %d pixels", result.Oversized, vision.MaxPixels))
+		}
+		if result.Resized > 0 {
+			logger.Info("Resized images", zap.String("backend", backend), zap.Int("images", result.Resized))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
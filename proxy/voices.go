@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// defaultVoice is the voice map key that applies to voices without an entry
+const defaultVoice = "*"
+
+// mapVoices returns a handler that translates the voice of text-to-speech
+// requests to one the backend offers, using its voice map
+func mapVoices(backend model.BackendConfig, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/audio/speech") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		payload, ok := readJSONBody(r, backend.Name, logger)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		voice, _ := payload["voice"].(string)
+		mapped, ok := backend.Voices[voice]
+		if !ok {
+			mapped, ok = backend.Voices[defaultVoice]
+		}
+		if ok && mapped != voice {
+			payload["voice"] = mapped
+			if writeJSONBody(r, payload) == nil {
+				logger.Debug("Mapped voice for backend",
+					zap.String("backend", backend.Name),
+					zap.String("voice", voice),
+					zap.String("mapped", mapped))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// windowSize is how many recent requests a backend's rolling statistics cover
+const windowSize = 100
+
+// WindowStats summarizes the recent requests to a backend or instance.
+// Percentiles cover the requests that were answered; ErrorRate counts
+// server errors, rate limits and failed connections.
+type WindowStats struct {
+	Requests  int           `json:"requests"`
+	P50       time.Duration `json:"p50"`
+	P95       time.Duration `json:"p95"`
+	ErrorRate float64       `json:"error_rate"`
+}
+
+// window keeps the latency and outcome of the most recent requests
+type window struct {
+	mu      sync.Mutex
+	samples []sample
+	n       int
+	next    int
+}
+
+// newWindow returns a window covering the last size requests
+func newWindow(size int) *window {
+	return &window{samples: make([]sample, size)}
+}
+
+type sample struct {
+	latency time.Duration
+	failed  bool
+}
+
+// add records one request
+func (w *window) add(latency time.Duration, failed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = sample{latency: latency, failed: failed}
+	w.next = (w.next + 1) % len(w.samples)
+	if w.n < len(w.samples) {
+		w.n++
+	}
+}
+
+// stats summarizes the recorded requests
+func (w *window) stats() WindowStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := WindowStats{Requests: w.n}
+	if w.n == 0 {
+		return stats
+	}
+	answered := make([]time.Duration, 0, w.n)
+	failures := 0
+	for _, s := range w.samples[:w.n] {
+		if s.failed {
+			failures++
+			continue
+		}
+		answered = append(answered, s.latency)
+	}
+	stats.ErrorRate = float64(failures) / float64(w.n)
+	if len(answered) > 0 {
+		slices.Sort(answered)
+		stats.P50 = answered[(len(answered)-1)*50/100]
+		stats.P95 = answered[(len(answered)-1)*95/100]
+	}
+	return stats
+}
+
+// failedStatus reports whether a response status counts against a backend:
+// server errors and rate limits, which another backend would not share
+func failedStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// Stats returns the rolling latency percentiles and error rate of a backend
+// over its most recent requests
+func (rt *Router) Stats(name string) WindowStats {
+	if rt == nil {
+		return WindowStats{}
+	}
+	if w, ok := rt.windows.Load(name); ok {
+		return w.(*window).stats()
+	}
+	return WindowStats{}
+}
+
+// recordRequest adds a request to a backend's rolling statistics
+func (rt *Router) recordRequest(name string, latency time.Duration, failed bool) {
+	w, ok := rt.windows.Load(name)
+	if !ok {
+		w, _ = rt.windows.LoadOrStore(name, newWindow(windowSize))
+	}
+	w.(*window).add(latency, failed)
+}
@@ -0,0 +1,60 @@
+package redact
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// core redacts log messages and string fields before they are written
+type core struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+// WrapCore returns a zap core that redacts everything it logs. Use it with
+// zap.WrapCore.
+func (r *Redactor) WrapCore(c zapcore.Core) zapcore.Core {
+	return &core{Core: c, redactor: r}
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{Core: c.Core.With(c.fields(fields)), redactor: c.redactor}
+}
+
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message, _ = c.redactor.String(entry.Message)
+	return c.Core.Write(entry, c.fields(fields))
+}
+
+// fields redacts string-like fields; structured fields such as arrays are
+// written as they are
+func (c *core) fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String, _ = c.redactor.String(f.String)
+		case zapcore.ByteStringType:
+			s, _ := c.redactor.String(string(f.Interface.([]byte)))
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: s}
+		case zapcore.StringerType:
+			s, _ := c.redactor.String(f.Interface.(fmt.Stringer).String())
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: s}
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				s, _ := c.redactor.String(err.Error())
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: s}
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
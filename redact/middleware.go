@@ -0,0 +1,74 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/utils"
+	"go.uber.org/zap"
+)
+
+// Middleware returns a middleware that redacts JSON request bodies before they
+// are recorded or forwarded to a backend
+func (r *Redactor) Middleware(logger *zap.Logger) extension.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPost || req.Body == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			body, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				utils.WriteErr(w, utils.NewError(utils.ErrInternal, "Error reading request body"))
+				return
+			}
+			var payload interface{}
+			if utils.UnmarshalJSON(body, &payload) == nil {
+				if counts := r.JSON(payload); len(counts) > 0 {
+					if redacted, err := json.Marshal(payload); err == nil {
+						body = redacted
+						logger.Info("Redacted request body",
+							zap.String("requestID", extension.FromRequest(req).ID),
+							zap.Any("matches", counts))
+					}
+				}
+			}
+
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// Register sets up the configured redaction: request bodies are scrubbed by a
+// middleware and log output by wrapping cfg.Logger
+func Register(cfg *model.Config, registry *extension.Registry) error {
+	if !cfg.Redaction.Requests && !cfg.Redaction.Logs {
+		return nil
+	}
+	redactor, err := New(cfg.Redaction)
+	if err != nil {
+		return err
+	}
+	if cfg.Redaction.Logs {
+		cfg.Logger = cfg.Logger.WithOptions(zap.WrapCore(redactor.WrapCore))
+	}
+	if cfg.Redaction.Requests {
+		registry.RegisterMiddleware("redact", redactor.Middleware(cfg.Logger))
+	}
+	cfg.Logger.Info("Redaction enabled",
+		zap.Strings("detectors", cfg.Redaction.Detectors),
+		zap.Int("patterns", len(cfg.Redaction.Patterns)),
+		zap.Bool("requests", cfg.Redaction.Requests),
+		zap.Bool("logs", cfg.Redaction.Logs))
+	return nil
+}
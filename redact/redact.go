@@ -0,0 +1,155 @@
+// Package redact scrubs sensitive data such as email addresses, API keys and
+// credit card numbers from request bodies and log output. Matches are replaced
+// with a marker naming the detector, e.g. [REDACTED:email].
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// detector finds one kind of sensitive data. valid, if set, rejects matches
+// that only look like the real thing.
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// builtins are the detectors that can be enabled by name
+var builtins = map[string]detector{
+	"email": {
+		name: "email",
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"api_key": {
+		name: "api_key",
+		re: regexp.MustCompile(`\b(?:sk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}|gsk_[A-Za-z0-9]{20,}|` +
+			`AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})\b`),
+	},
+	"credit_card": {
+		name:  "credit_card",
+		re:    regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid: luhn,
+	},
+}
+
+// Detectors returns the names of the built-in detectors
+func Detectors() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redactor replaces sensitive data in strings and decoded JSON
+type Redactor struct {
+	detectors []detector
+}
+
+// New returns a redactor using the configured built-in detectors and patterns
+func New(cfg model.RedactionConfig) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range cfg.Detectors {
+		d, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q (available: %s)", name, strings.Join(Detectors(), ", "))
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	for i, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %d: %w", i, err)
+		}
+		name := pattern.Name
+		if name == "" {
+			name = "pattern"
+		}
+		r.detectors = append(r.detectors, detector{name: name, re: re})
+	}
+	return r, nil
+}
+
+// String returns s with every match replaced, and the number of matches per detector
+func (r *Redactor) String(s string) (string, map[string]int) {
+	var counts map[string]int
+	for _, d := range r.detectors {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			if counts == nil {
+				counts = make(map[string]int)
+			}
+			counts[d.name]++
+			return "[REDACTED:" + d.name + "]"
+		})
+	}
+	return s, counts
+}
+
+// JSON redacts every string in a decoded JSON value in place, at any depth, and
+// returns the number of matches per detector
+func (r *Redactor) JSON(v interface{}) map[string]int {
+	counts := make(map[string]int)
+	r.walk(v, counts)
+	return counts
+}
+
+func (r *Redactor) walk(v interface{}, counts map[string]int) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				v[key] = r.count(s, counts)
+				continue
+			}
+			r.walk(value, counts)
+		}
+	case []interface{}:
+		for i, value := range v {
+			if s, ok := value.(string); ok {
+				v[i] = r.count(s, counts)
+				continue
+			}
+			r.walk(value, counts)
+		}
+	}
+}
+
+func (r *Redactor) count(s string, counts map[string]int) string {
+	redacted, found := r.String(s)
+	for name, n := range found {
+		counts[name] += n
+	}
+	return redacted
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum used by card numbers
+func luhn(s string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,190 @@
+// Package report summarizes the audit log for people rather than tools:
+// requests, errors, tokens, cost and latency over a period, in total and per
+// key, backend and model, as JSON, CSV or Markdown. Summaries are printed by
+// the llm-router report command or posted to a webhook every day or week.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+)
+
+// Formats a summary can be rendered in
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// Row is the usage of one key, backend or model, or of everything
+type Row struct {
+	Name             string  `json:"name,omitempty"`
+	Requests         int64   `json:"requests"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	AvgDurationMS    int64   `json:"avg_duration_ms"`
+	durationMS       int64
+}
+
+// Summary is the usage over a period. Rows are ordered by requests, most first.
+type Summary struct {
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Total    Row       `json:"total"`
+	Keys     []Row     `json:"keys"`
+	Backends []Row     `json:"backends"`
+	Models   []Row     `json:"models"`
+}
+
+// Build summarizes the entries of the period from since to until. Keys are
+// named by their api_keys name where the entry has one, otherwise by key ID.
+func Build(entries []audit.Entry, since, until time.Time) Summary {
+	s := Summary{Since: since, Until: until}
+	keys := make(map[string]*Row)
+	backends := make(map[string]*Row)
+	models := make(map[string]*Row)
+	for _, e := range entries {
+		key := e.KeyName
+		if key == "" {
+			key = e.KeyID
+		}
+		add(&s.Total, e)
+		add(rowFor(keys, key), e)
+		add(rowFor(backends, e.Backend), e)
+		add(rowFor(models, e.Model), e)
+	}
+	finish(&s.Total)
+	s.Keys, s.Backends, s.Models = sorted(keys), sorted(backends), sorted(models)
+	return s
+}
+
+// rowFor returns the row of name, adding it if needed
+func rowFor(rows map[string]*Row, name string) *Row {
+	row, ok := rows[name]
+	if !ok {
+		row = &Row{Name: name}
+		rows[name] = row
+	}
+	return row
+}
+
+// add counts an entry in a row
+func add(row *Row, e audit.Entry) {
+	row.Requests++
+	if e.Status >= 400 {
+		row.Errors++
+	}
+	row.PromptTokens += int64(e.PromptTokens)
+	row.CompletionTokens += int64(e.CompletionTokens)
+	row.TotalTokens += int64(e.TotalTokens)
+	row.CostUSD += e.CostUSD
+	row.durationMS += e.DurationMS
+}
+
+// finish derives a row's averages
+func finish(row *Row) {
+	if row.Requests > 0 {
+		row.AvgDurationMS = row.durationMS / row.Requests
+	}
+}
+
+// sorted returns the rows, most requests first and then by name
+func sorted(rows map[string]*Row) []Row {
+	out := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		finish(row)
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatMarkdown:
+		return "text/markdown"
+	}
+	return "application/json"
+}
+
+// Render writes the summary in a format, with times in loc
+func Render(w io.Writer, s Summary, format string, loc *time.Location) error {
+	switch format {
+	case FormatJSON, "":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	case FormatCSV:
+		return renderCSV(w, s)
+	case FormatMarkdown:
+		return renderMarkdown(w, s, loc)
+	}
+	return fmt.Errorf("unknown format %q (available: %s, %s, %s)", format, FormatJSON, FormatCSV, FormatMarkdown)
+}
+
+// renderCSV writes one line per row, naming the group it belongs to
+func renderCSV(w io.Writer, s Summary) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"group", "name", "requests", "errors", "prompt_tokens", "completion_tokens", "total_tokens", "cost_usd", "avg_duration_ms"})
+	write := func(group string, row Row) {
+		out.Write([]string{group, row.Name,
+			strconv.FormatInt(row.Requests, 10), strconv.FormatInt(row.Errors, 10),
+			strconv.FormatInt(row.PromptTokens, 10), strconv.FormatInt(row.CompletionTokens, 10),
+			strconv.FormatInt(row.TotalTokens, 10), strconv.FormatFloat(row.CostUSD, 'f', 4, 64),
+			strconv.FormatInt(row.AvgDurationMS, 10)})
+	}
+	write("total", s.Total)
+	for _, group := range []struct {
+		name string
+		rows []Row
+	}{{"key", s.Keys}, {"backend", s.Backends}, {"model", s.Models}} {
+		for _, row := range group.rows {
+			write(group.name, row)
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// renderMarkdown writes the totals and a table per group, for chat and email
+func renderMarkdown(w io.Writer, s Summary, loc *time.Location) error {
+	const layout = "2006-01-02 15:04"
+	fmt.Fprintf(w, "# LLM router usage, %s to %s\n\n", s.Since.In(loc).Format(layout), s.Until.In(loc).Format(layout))
+	fmt.Fprintf(w, "**%d requests** (%d errors), %d tokens, $%.2f, %d ms on average\n",
+		s.Total.Requests, s.Total.Errors, s.Total.TotalTokens, s.Total.CostUSD, s.Total.AvgDurationMS)
+	for _, group := range []struct {
+		title, column string
+		rows          []Row
+	}{{"By key", "Key", s.Keys}, {"By backend", "Backend", s.Backends}, {"By model", "Model", s.Models}} {
+		fmt.Fprintf(w, "\n## %s\n\n", group.title)
+		fmt.Fprintf(w, "| %s | Requests | Errors | Prompt tokens | Completion tokens | Cost | Avg latency |\n", group.column)
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: | ---: |")
+		for _, row := range group.rows {
+			name := row.Name
+			if name == "" {
+				name = "-"
+			}
+			fmt.Fprintf(w, "| %s | %d | %d | %d | %d | $%.2f | %d ms |\n",
+				name, row.Requests, row.Errors, row.PromptTokens, row.CompletionTokens, row.CostUSD, row.AvgDurationMS)
+		}
+	}
+	return nil
+}
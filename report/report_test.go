@@ -0,0 +1,123 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+)
+
+var entries = []audit.Entry{
+	{KeyID: "k1", KeyName: "alice", Backend: "openai", Model: "gpt-4o", Status: 200, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, CostUSD: 0.5, DurationMS: 100},
+	{KeyID: "k1", KeyName: "alice", Backend: "openai", Model: "gpt-4o-mini", Status: 500, DurationMS: 300},
+	{KeyID: "router", Backend: "ollama", Model: "llama3", Status: 200, PromptTokens: 2, CompletionTokens: 2, TotalTokens: 4, DurationMS: 20},
+}
+
+func TestBuild(t *testing.T) {
+	s := Build(entries, time.Time{}, time.Time{})
+	if s.Total.Requests != 3 || s.Total.Errors != 1 || s.Total.TotalTokens != 19 || s.Total.CostUSD != 0.5 || s.Total.AvgDurationMS != 140 {
+		t.Errorf("Unexpected total: %+v", s.Total)
+	}
+	if len(s.Keys) != 2 || s.Keys[0].Name != "alice" || s.Keys[0].Requests != 2 || s.Keys[1].Name != "router" {
+		t.Errorf("Unexpected keys: %+v", s.Keys)
+	}
+	if len(s.Backends) != 2 || s.Backends[0].Name != "openai" || s.Backends[0].AvgDurationMS != 200 {
+		t.Errorf("Unexpected backends: %+v", s.Backends)
+	}
+	// Models with as many requests are ordered by name
+	if len(s.Models) != 3 || s.Models[0].Name != "gpt-4o" || s.Models[2].Name != "llama3" {
+		t.Errorf("Unexpected models: %+v", s.Models)
+	}
+}
+
+func TestRender(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := Build(entries, since, since.AddDate(0, 0, 7))
+
+	var out bytes.Buffer
+	if err := Render(&out, s, FormatCSV, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("Expected a header and 8 rows, got %d lines:\n%s", len(lines), out.String())
+	}
+	if lines[1] != "total,,3,1,12,7,19,0.5000,140" || lines[2] != "key,alice,2,1,10,5,15,0.5000,200" {
+		t.Errorf("Unexpected rows:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := Render(&out, s, FormatMarkdown, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2024-05-01 00:00 to 2024-05-08 00:00", "**3 requests** (1 errors)", "| alice | 2 | 1 | 10 | 5 | $0.50 | 200 ms |"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Markdown is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := Render(&out, s, "xml", time.UTC); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		hour     int
+		want     time.Time
+	}{
+		{ScheduleDaily, 11, time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{ScheduleDaily, 10, time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{ScheduleWeekly, 9, time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		{ScheduleWeekly, 0, time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := Next(tt.schedule, tt.hour, now); !got.Equal(tt.want) {
+			t.Errorf("Next(%s, %d) = %v, want %v", tt.schedule, tt.hour, got, tt.want)
+		}
+	}
+
+	// A Monday before the hour is due the same day
+	monday := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+	if got := Next(ScheduleWeekly, 9, monday); !got.Equal(monday.Add(time.Hour)) {
+		t.Errorf("Expected the summary due the same Monday, got %v", got)
+	}
+
+	since, until := Covered(ScheduleWeekly, monday)
+	if !until.Equal(monday) || !since.Equal(monday.AddDate(0, 0, -7)) {
+		t.Errorf("Unexpected weekly period %v to %v", since, until)
+	}
+}
+
+func TestPost(t *testing.T) {
+	var contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		contentType, body = r.Header.Get("Content-Type"), string(data)
+	}))
+	defer server.Close()
+
+	if err := Post(context.Background(), server.URL, Build(entries, time.Time{}, time.Time{}), FormatMarkdown, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "text/markdown" || !strings.Contains(body, "## By key") {
+		t.Errorf("Unexpected webhook request %q:\n%s", contentType, body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := Post(context.Background(), failing.URL, Summary{}, FormatJSON, time.UTC); err == nil {
+		t.Error("Expected an error when the webhook fails")
+	}
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+// Schedules a summary can be posted on
+const (
+	ScheduleDaily  = "daily"
+	ScheduleWeekly = "weekly"
+)
+
+// webhookTimeout bounds how long posting a summary may take
+const webhookTimeout = 30 * time.Second
+
+// Next returns when the next summary is due after now: at hour o'clock in
+// now's location, every day or every Monday
+func Next(schedule string, hour int, now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if schedule == ScheduleWeekly {
+		next = next.AddDate(0, 0, (int(time.Monday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(now) {
+		if schedule == ScheduleWeekly {
+			next = next.AddDate(0, 0, 7)
+		} else {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
+
+// Covered returns the period a summary due at at covers: the day or week
+// ending then
+func Covered(schedule string, at time.Time) (time.Time, time.Time) {
+	if schedule == ScheduleWeekly {
+		return at.AddDate(0, 0, -7), at
+	}
+	return at.AddDate(0, 0, -1), at
+}
+
+// Schedule posts a summary of the audit log at auditPath to the configured
+// webhook whenever one is due, until ctx is done. Failures are logged and the
+// next summary is still sent.
+func Schedule(ctx context.Context, settings model.ReportConfig, auditPath string, loc *time.Location, logger *zap.Logger) {
+	for {
+		due := Next(settings.Schedule, settings.Hour, time.Now().In(loc))
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		since, until := Covered(settings.Schedule, due)
+		entries, err := audit.Read(auditPath, audit.Query{Since: since, Until: until})
+		if err == nil {
+			err = Post(ctx, settings.WebhookURL, Build(entries, since, until), settings.Format, loc)
+		}
+		if err != nil {
+			logger.Error("Failed to send usage report", zap.String("schedule", settings.Schedule), zap.Error(err))
+			continue
+		}
+		logger.Info("Sent usage report", zap.String("schedule", settings.Schedule),
+			zap.Time("since", since), zap.Int("requests", len(entries)))
+	}
+}
+
+// Post renders a summary and sends it to a webhook
+func Post(ctx context.Context, url string, s Summary, format string, loc *time.Location) error {
+	var body bytes.Buffer
+	if err := Render(&body, s, format, loc); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType(format))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Package resume keeps the events of streamed responses for a while after
+// they finish, so a client whose connection drops can reconnect with the
+// Last-Event-ID header and receive the rest of the stream instead of
+// generating the response again. Event IDs are the request ID and the
+// event's number, such as 3f2a9c0e1b7d4a65-12.
+package resume
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBytes is how much of a stream is kept unless configured
+const DefaultMaxBytes = 4 << 20
+
+// ErrTruncated is returned when following a stream past the events that were kept
+var ErrTruncated = errors.New("stream was too large to keep")
+
+// Store holds the streams of recent requests by request ID
+type Store struct {
+	mu        sync.Mutex
+	retention time.Duration
+	maxBytes  int
+	streams   map[string]*Stream
+}
+
+// New returns a store keeping finished streams for retention and at most
+// maxBytes of each stream
+func New(retention time.Duration, maxBytes int) *Store {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &Store{retention: retention, maxBytes: maxBytes, streams: make(map[string]*Stream)}
+}
+
+// Start begins keeping the stream of request id for the client key keyID,
+// dropping streams whose retention has passed
+func (s *Store) Start(id, keyID string) *Stream {
+	st := &Stream{ID: id, KeyID: keyID, maxBytes: s.maxBytes, changed: make(chan struct{})}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for other, kept := range s.streams {
+		if kept.expired(now, s.retention) {
+			delete(s.streams, other)
+		}
+	}
+	s.streams[id] = st
+	return st
+}
+
+// Get returns the stream of request id, or nil if it is unknown or expired
+func (s *Store) Get(id string) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.streams[id]
+	if st == nil || st.expired(time.Now(), s.retention) {
+		return nil
+	}
+	return st
+}
+
+// Stream is the sequence of events of one streamed response
+type Stream struct {
+	ID    string
+	KeyID string
+
+	mu        sync.Mutex
+	maxBytes  int
+	size      int
+	events    [][]byte
+	truncated bool
+	done      bool
+	finished  time.Time
+	// changed is closed and replaced whenever an event is added or the stream finishes
+	changed chan struct{}
+}
+
+// Append adds an event, without its trailing blank line, and returns its number
+func (st *Stream) Append(event []byte) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := len(st.events) + 1
+	if st.truncated || st.size+len(event) > st.maxBytes {
+		st.truncated = true
+	} else {
+		st.events = append(st.events, append([]byte(nil), event...))
+		st.size += len(event)
+	}
+	st.notify()
+	return n
+}
+
+// Finish marks the stream complete; followers stop after the last event
+func (st *Stream) Finish() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.done = true
+	st.finished = time.Now()
+	st.notify()
+}
+
+// Follow calls fn with each event numbered after after, waiting for events
+// still to come until the stream finishes or ctx is done
+func (st *Stream) Follow(ctx context.Context, after int, fn func(n int, event []byte) error) error {
+	next := after + 1
+	for {
+		st.mu.Lock()
+		pending := st.events[min(next-1, len(st.events)):]
+		done, truncated, changed := st.done, st.truncated, st.changed
+		st.mu.Unlock()
+
+		for _, event := range pending {
+			if err := fn(next, event); err != nil {
+				return err
+			}
+			next++
+		}
+		switch {
+		case truncated:
+			return ErrTruncated
+		case done:
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notify wakes followers; st.mu must be held
+func (st *Stream) notify() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// expired reports whether the stream finished longer than retention ago
+func (st *Stream) expired(now time.Time, retention time.Duration) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.done && now.Sub(st.finished) > retention
+}
+
+// FormatID returns the event ID of event n of the stream of request id
+func FormatID(id string, n int) string {
+	return id + "-" + strconv.Itoa(n)
+}
+
+// ParseID splits an event ID into the request ID and the event number
+func ParseID(eventID string) (string, int, bool) {
+	i := strings.LastIndexByte(eventID, '-')
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(eventID[i+1:])
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return eventID[:i], n, true
+}
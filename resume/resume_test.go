@@ -0,0 +1,69 @@
+package resume
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFollowWaitsForTheRestOfTheStream(t *testing.T) {
+	store := New(time.Minute, 0)
+	stream := store.Start("req", "key")
+	stream.Append([]byte("data: 1"))
+	stream.Append([]byte("data: 2"))
+
+	got := make(chan string, 4)
+	result := make(chan error)
+	go func() {
+		result <- stream.Follow(context.Background(), 1, func(n int, event []byte) error {
+			got <- FormatID("req", n) + " " + string(event)
+			return nil
+		})
+	}()
+	if s := <-got; s != "req-2 data: 2" {
+		t.Errorf("Expected the event after the last one seen, got %q", s)
+	}
+	stream.Append([]byte("data: 3"))
+	if s := <-got; s != "req-3 data: 3" {
+		t.Errorf("Expected the event added while following, got %q", s)
+	}
+	stream.Finish()
+	if err := <-result; err != nil {
+		t.Errorf("Expected following to end with the stream, got %s", err)
+	}
+	if store.Get("req") != stream {
+		t.Errorf("Expected the finished stream to be kept")
+	}
+}
+
+func TestStreamsExpireAndTruncate(t *testing.T) {
+	store := New(0, 10)
+	stream := store.Start("old", "key")
+	stream.Append([]byte("0123456789"))
+	if n := stream.Append([]byte("more")); n != 2 {
+		t.Errorf("Expected events to be numbered past the limit, got %d", n)
+	}
+	err := stream.Follow(context.Background(), 0, func(int, []byte) error { return nil })
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+
+	stream.Finish()
+	time.Sleep(time.Millisecond)
+	store.Start("new", "key")
+	if store.Get("old") != nil {
+		t.Errorf("Expected the expired stream to be dropped")
+	}
+}
+
+func TestParseID(t *testing.T) {
+	if id, n, ok := ParseID(FormatID("3f2a9c0e1b7d4a65", 12)); !ok || id != "3f2a9c0e1b7d4a65" || n != 12 {
+		t.Errorf("Unexpected round trip %q %d %v", id, n, ok)
+	}
+	for _, bad := range []string{"", "12", "-3", "req-x", "req-+"} {
+		if _, _, ok := ParseID(bad); ok {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Env supplies the variables and functions an expression can reference
+type Env struct {
+	Vars  map[string]interface{}
+	Funcs map[string]func(args []interface{}) (interface{}, error)
+}
+
+// Expr is a compiled expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// node evaluates one piece of the expression tree
+type node func(env *Env) (interface{}, error)
+
+// String returns the expression source
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against env
+func (e *Expr) Eval(env *Env) (interface{}, error) {
+	return e.root(env)
+}
+
+// EvalBool evaluates the expression and requires a boolean result
+func (e *Expr) EvalBool(env *Env) (bool, error) {
+	v, err := e.root(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q returned %T, not bool", e.source, v)
+	}
+	return b, nil
+}
+
+// Compile parses an expression. The language supports string, number and
+// boolean literals, variables, function calls, parentheses, the comparison
+// operators == != < <= > >=, and the logical operators && || !.
+func Compile(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits the source into identifiers, literals and operators
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) {
+				r, n := utf8.DecodeRuneInString(src[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				i += n
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) {
+				r, n := utf8.DecodeRuneInString(src[i:])
+				if !unicode.IsDigit(r) && r != '.' {
+					break
+				}
+				i += n
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(src) && rune(src[i]) != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		default:
+			two := ""
+			if i+1 < len(src) {
+				two = src[i : i+2]
+			}
+			switch two {
+			case "&&", "||", "==", "!=", "<=", ">=":
+				tokens = append(tokens, token{tokOp, two, i})
+				i += 2
+				continue
+			}
+			if strings.ContainsRune("()!<>,", c) {
+				tokens = append(tokens, token{tokOp, string(c), i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env *Env) (interface{}, error) {
+			lv, err := evalBool(l, env)
+			if err != nil || lv {
+				return lv, err
+			}
+			return evalBool(right, env)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env *Env) (interface{}, error) {
+			lv, err := evalBool(l, env)
+			if err != nil || !lv {
+				return lv, err
+			}
+			return evalBool(right, env)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(env *Env) (interface{}, error) {
+			v, err := evalBool(operand, env)
+			return !v, err
+		}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp {
+		return left, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op := t.text
+	return func(env *Env) (interface{}, error) {
+		lv, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		return compare(op, lv, rv)
+	}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return constant(f), nil
+	case tokString:
+		return constant(t.text), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		name := t.text
+		return func(env *Env) (interface{}, error) {
+			v, ok := env.Vars[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown variable %q", name)
+			}
+			return normalize(v), nil
+		}, nil
+	case tokOp:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, fmt.Errorf("expected ) at position %d", p.peek().pos)
+			}
+			return inner, nil
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	var args []node
+	if !p.accept(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, fmt.Errorf("expected , or ) at position %d", p.peek().pos)
+			}
+		}
+	}
+	return func(env *Env) (interface{}, error) {
+		fn, ok := env.Funcs[name.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", name.text)
+		}
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			v, err := arg(env)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		v, err := fn(values)
+		return normalize(v), err
+	}, nil
+}
+
+func constant(v interface{}) node {
+	return func(*Env) (interface{}, error) { return v, nil }
+}
+
+func evalBool(n node, env *Env) (bool, error) {
+	v, err := n(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %T", v)
+	}
+	return b, nil
+}
+
+// normalize converts Go numeric types to float64 so comparisons behave uniformly
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
+
+func compare(op string, lv, rv interface{}) (interface{}, error) {
+	switch l := lv.(type) {
+	case float64:
+		r, ok := rv.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %T", rv)
+		}
+		switch op {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+	case string:
+		r, ok := rv.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %T", rv)
+		}
+		switch op {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+	case bool:
+		r, ok := rv.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare bool with %T", rv)
+		}
+		switch op {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		}
+		return nil, fmt.Errorf("operator %s not supported for bool", op)
+	}
+	return nil, fmt.Errorf("cannot compare %T", lv)
+}
@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"go.uber.org/zap"
+)
+
+func TestExpressions(t *testing.T) {
+	env := &Env{
+		Vars: map[string]interface{}{
+			"model":  "ollama/llama3",
+			"tokens": 5000,
+			"stream": true,
+			"région": "europe",
+		},
+		Funcs: map[string]func([]interface{}) (interface{}, error){
+			"startsWith": stringFunc(2, func(args []string) interface{} {
+				return len(args[0]) >= len(args[1]) && args[0][:len(args[1])] == args[1]
+			}),
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`model == "ollama/llama3"`, true},
+		{`model != 'ollama/llama3'`, false},
+		{`tokens > 4000 && stream`, true},
+		{`tokens >= 6000 || !stream`, false},
+		{`startsWith(model, "ollama/") && (tokens < 100 || tokens < 10000)`, true},
+		{`!(tokens == 5000)`, false},
+		{`true`, true},
+		{`région == "europe" && tokens > 4000`, true},
+	}
+
+	for _, tt := range tests {
+		expr, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %s", tt.expr, err)
+			continue
+		}
+		got, err := expr.EvalBool(env)
+		if err != nil {
+			t.Errorf("Eval(%q) failed: %s", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{`model ==`, `"unterminated`, `(tokens > 1`, `tokens > 1 extra`, `a # b`} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Expected Compile(%q) to fail", src)
+		}
+	}
+}
+
+func TestEvalTypeErrors(t *testing.T) {
+	env := &Env{Vars: map[string]interface{}{"model": "gpt-4"}}
+	for _, src := range []string{`model > 3`, `missing == 1`, `unknown()`, `model`} {
+		expr, err := Compile(src)
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %s", src, err)
+		}
+		if _, err := expr.EvalBool(env); err == nil {
+			t.Errorf("Expected Eval(%q) to fail", src)
+		}
+	}
+}
+
+func TestResolverFirstMatchWins(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	backends := []model.BackendConfig{
+		{Name: "ollama", Prefix: "ollama/"},
+		{Name: "groq", Prefix: "groq/"},
+	}
+	routingRules := []model.RoutingRule{
+		{When: `messages > 10`, Backend: "groq", Model: "llama3-70b-8192"},
+		{When: `startsWith(model, "ollama/")`, Backend: "ollama"},
+	}
+
+	resolver, err := NewResolver(routingRules, backends, logger)
+	if err != nil {
+		t.Fatalf("Failed to build resolver: %s", err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	rc := &extension.RequestContext{}
+	rc.SetChatRequest(map[string]interface{}{
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi"}},
+	}, nil)
+	req = extension.WithRequestContext(req, rc)
+
+	prefix, upstreamModel, ok := resolver.Resolve(req, "ollama/phi3")
+	if !ok || prefix != "ollama/" || upstreamModel != "phi3" {
+		t.Errorf("Unexpected resolution: %s %s %v", prefix, upstreamModel, ok)
+	}
+
+	if _, _, ok := resolver.Resolve(req, "gpt-4"); ok {
+		t.Errorf("Expected no rule to match")
+	}
+}
+
+func TestResolverUnknownBackend(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	_, err := NewResolver([]model.RoutingRule{{When: "true", Backend: "missing"}}, nil, logger)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown backend")
+	}
+}
+
+func TestEnvTimeVariables(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	env := NewEnv(req, "gpt-4", time.Date(2024, 5, 6, 23, 0, 0, 0, time.UTC), nil)
+	expr, _ := Compile(`hour >= 22 && weekday == "Monday"`)
+	if ok, err := expr.EvalBool(env); err != nil || !ok {
+		t.Errorf("Expected time expression to match, got %v %v", ok, err)
+	}
+}
@@ -0,0 +1,155 @@
+// Package rules implements scriptable routing: each configured rule pairs an
+// expression with a target backend, and the first rule whose expression is
+// true decides where a chat completions request goes.
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kcolemangt/llm-router/extension"
+	"github.com/kcolemangt/llm-router/model"
+	"github.com/kcolemangt/llm-router/proxy"
+	"go.uber.org/zap"
+)
+
+// compiledRule is a routing rule ready for evaluation
+type compiledRule struct {
+	expr    *Expr
+	backend model.BackendConfig
+	model   string
+}
+
+// Resolver evaluates routing rules in order and routes to the first match
+type Resolver struct {
+	rules  []compiledRule
+	router *proxy.Router
+	logger *zap.Logger
+}
+
+// NewResolver compiles the routing rules, resolving each rule's backend by name
+func NewResolver(routingRules []model.RoutingRule, backends []model.BackendConfig, logger *zap.Logger) (*Resolver, error) {
+	byName := make(map[string]model.BackendConfig)
+	for _, backend := range backends {
+		byName[backend.Name] = backend
+	}
+
+	resolver := &Resolver{logger: logger}
+	for i, rule := range routingRules {
+		backend, ok := byName[rule.Backend]
+		if !ok {
+			return nil, fmt.Errorf("routing rule %d: unknown backend %q", i, rule.Backend)
+		}
+		expr, err := Compile(rule.When)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %d: %w", i, err)
+		}
+		resolver.rules = append(resolver.rules, compiledRule{expr: expr, backend: backend, model: rule.Model})
+	}
+	return resolver, nil
+}
+
+// Register compiles the configured routing rules and registers them as a
+// resolver of the configuration's registry
+func Register(cfg *model.Config, registry *extension.Registry) error {
+	if len(cfg.RoutingRules) == 0 {
+		return nil
+	}
+	resolver, err := NewResolver(cfg.RoutingRules, cfg.Backends, cfg.Logger)
+	if err != nil {
+		return err
+	}
+	resolver.router, _ = cfg.Router.(*proxy.Router)
+	registry.RegisterResolver("rules", resolver)
+	cfg.Logger.Info("Routing rules registered", zap.Int("count", len(cfg.RoutingRules)))
+	return nil
+}
+
+// Resolve implements extension.Resolver
+func (res *Resolver) Resolve(r *http.Request, modelName string) (string, string, bool) {
+	env := NewEnv(r, modelName, time.Now(), res.router)
+	for _, rule := range res.rules {
+		matched, err := rule.expr.EvalBool(env)
+		if err != nil {
+			res.logger.Warn("Routing rule failed to evaluate",
+				zap.String("rule", rule.expr.String()),
+				zap.Error(err))
+			continue
+		}
+		if !matched {
+			continue
+		}
+
+		upstreamModel := rule.model
+		if upstreamModel == "" {
+			upstreamModel = strings.TrimPrefix(modelName, rule.backend.Prefix)
+		}
+		res.logger.Debug("Routing rule matched",
+			zap.String("rule", rule.expr.String()),
+			zap.String("backend", rule.backend.Name))
+		return rule.backend.Prefix, upstreamModel, true
+	}
+	return "", "", false
+}
+
+// NewEnv builds the variables and functions available to routing expressions
+// from the request context, plus the request path and the time of day. The
+// healthy function asks router, and finds every backend healthy without one.
+func NewEnv(r *http.Request, modelName string, now time.Time, router *proxy.Router) *Env {
+	rc := extension.FromRequest(r)
+	vars := rc.Vars()
+	vars["model"] = modelName
+	vars["path"] = r.URL.Path
+	vars["hour"] = now.Hour()
+	vars["weekday"] = now.Weekday().String()
+
+	return &Env{
+		Vars: vars,
+		Funcs: map[string]func([]interface{}) (interface{}, error){
+			"header": stringFunc(1, func(args []string) interface{} {
+				return r.Header.Get(args[0])
+			}),
+			"healthy": stringFunc(1, func(args []string) interface{} {
+				return router.Healthy(args[0])
+			}),
+			"hasTag": stringFunc(1, func(args []string) interface{} {
+				return rc.HasTag(args[0])
+			}),
+			"requires": stringFunc(1, func(args []string) interface{} {
+				return rc.Requires(args[0])
+			}),
+			"startsWith": stringFunc(2, func(args []string) interface{} {
+				return strings.HasPrefix(args[0], args[1])
+			}),
+			"endsWith": stringFunc(2, func(args []string) interface{} {
+				return strings.HasSuffix(args[0], args[1])
+			}),
+			"contains": stringFunc(2, func(args []string) interface{} {
+				return strings.Contains(args[0], args[1])
+			}),
+			"lower": stringFunc(1, func(args []string) interface{} {
+				return strings.ToLower(args[0])
+			}),
+		},
+	}
+}
+
+// stringFunc adapts a function of n string arguments to an expression function
+func stringFunc(n int, fn func(args []string) interface{}) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != n {
+			return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+		}
+		strs := make([]string, n)
+		for i, arg := range args {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %d is %T, not string", i+1, arg)
+			}
+			strs[i] = s
+		}
+		return fn(strs), nil
+	}
+}
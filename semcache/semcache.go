@@ -0,0 +1,131 @@
+// Package semcache remembers completions by the embedding of their prompt, so
+// a prompt similar enough to one answered before is served the same answer
+// without reaching a backend.
+package semcache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Entry is a remembered response
+type Entry struct {
+	ContentType string
+	Body        []byte
+
+	scope   string
+	vector  []float64
+	expires time.Time
+}
+
+// Stats counts lookups since startup
+type Stats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	Entries int     `json:"entries"`
+}
+
+// Cache holds up to a bounded number of entries for a while; the oldest go
+// first
+type Cache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	entries []*Entry
+	hits    int64
+	misses  int64
+}
+
+// New returns a cache holding up to maxEntries entries for ttl each. A zero
+// ttl keeps entries until they are pushed out.
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{maxEntries: maxEntries, ttl: ttl}
+}
+
+// Lookup returns the entry of a scope whose prompt is most similar to vector,
+// if its similarity reaches threshold
+func (c *Cache) Lookup(scope string, vector []float64, threshold float64) (*Entry, float64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var best *Entry
+	bestSimilarity := 0.0
+	live := c.entries[:0]
+	for _, entry := range c.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			continue
+		}
+		live = append(live, entry)
+		if entry.scope != scope {
+			continue
+		}
+		if similarity := Cosine(entry.vector, vector); similarity > bestSimilarity {
+			best, bestSimilarity = entry, similarity
+		}
+	}
+	clear(c.entries[len(live):])
+	c.entries = live
+
+	if best == nil || bestSimilarity < threshold {
+		c.misses++
+		return nil, bestSimilarity, false
+	}
+	c.hits++
+	return best, bestSimilarity, true
+}
+
+// Store remembers a response for a prompt of a scope
+func (c *Cache) Store(scope string, vector []float64, contentType string, body []byte) {
+	if c == nil || c.maxEntries <= 0 {
+		return
+	}
+	entry := &Entry{ContentType: contentType, Body: body, scope: scope, vector: vector}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entry)
+	if over := len(c.entries) - c.maxEntries; over > 0 {
+		clear(c.entries[:over])
+		c.entries = c.entries[over:]
+	}
+}
+
+// Stats returns the lookups counted since startup and the number of entries
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := Stats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries)}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 if their lengths
+// differ or either is zero
+func Cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,58 @@
+package semcache
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCosine(t *testing.T) {
+	if got := Cosine([]float64{1, 0}, []float64{2, 0}); math.Abs(got-1) > 1e-9 {
+		t.Errorf("Expected parallel vectors to be identical, got %v", got)
+	}
+	if got := Cosine([]float64{1, 0}, []float64{0, 1}); got != 0 {
+		t.Errorf("Expected orthogonal vectors to be unrelated, got %v", got)
+	}
+	if got := Cosine([]float64{1}, []float64{1, 0}); got != 0 {
+		t.Errorf("Expected vectors of different lengths to be unrelated, got %v", got)
+	}
+}
+
+func TestLookupFindsSimilarPromptsInScope(t *testing.T) {
+	c := New(10, 0)
+	c.Store("gpt", []float64{1, 0.1}, "application/json", []byte("answer"))
+
+	if entry, _, ok := c.Lookup("gpt", []float64{1, 0.12}, 0.99); !ok || string(entry.Body) != "answer" {
+		t.Errorf("Expected a similar prompt to hit")
+	}
+	if _, _, ok := c.Lookup("gpt", []float64{0.1, 1}, 0.99); ok {
+		t.Errorf("Expected a different prompt to miss")
+	}
+	if _, _, ok := c.Lookup("llama", []float64{1, 0.1}, 0.99); ok {
+		t.Errorf("Expected another scope to miss")
+	}
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || math.Abs(stats.HitRate-1.0/3) > 1e-9 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestEntriesExpireAndAreBounded(t *testing.T) {
+	c := New(2, time.Millisecond)
+	c.Store("s", []float64{1}, "", []byte("a"))
+	time.Sleep(5 * time.Millisecond)
+	if _, _, ok := c.Lookup("s", []float64{1}, 0.9); ok {
+		t.Errorf("Expected an expired entry to miss")
+	}
+
+	c = New(2, 0)
+	c.Store("s", []float64{1, 0}, "", []byte("a"))
+	c.Store("s", []float64{0, 1}, "", []byte("b"))
+	c.Store("s", []float64{1, 1}, "", []byte("c"))
+	if _, _, ok := c.Lookup("s", []float64{1, 0}, 0.99); ok {
+		t.Errorf("Expected the oldest entry to be pushed out")
+	}
+	if c.Stats().Entries != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Stats().Entries)
+	}
+}
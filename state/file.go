@@ -0,0 +1,171 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fileCompactAfter is how many changes are appended to a file store before it
+// is rewritten with only its live entries
+const fileCompactAfter = 10000
+
+// File is an in-memory store that keeps its entries in a file, so a router
+// running alone keeps lockouts and spent budgets across restarts without an
+// external service. Every change is appended to the file as a JSON line; the
+// file is rewritten with the entries still alive when it is opened and after
+// every fileCompactAfter changes.
+type File struct {
+	memory *Memory
+	path   string
+
+	// mu keeps the file in the order of the changes to memory
+	mu      sync.Mutex
+	file    *os.File
+	changes int
+}
+
+// fileRecord is one change to a file store
+type fileRecord struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value,omitempty"`
+	Expires time.Time `json:"expires,omitzero"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+// OpenFile opens or creates the store kept in the file at path, holding up
+// to maxEntries keys
+func OpenFile(path string, maxEntries int) (*File, error) {
+	f := &File{memory: NewMemory(maxEntries), path: path}
+	data, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(data)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			var record fileRecord
+			if json.Unmarshal(scanner.Bytes(), &record) != nil {
+				// A line cut short by a crash loses only that change
+				continue
+			}
+			if record.Deleted {
+				f.memory.Delete(context.Background(), record.Key)
+			} else {
+				f.memory.put(record.Key, record.Value, record.Expires)
+			}
+		}
+		data.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Incr adds n to the counter at key
+func (f *File) Incr(_ context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count, expires, err := f.memory.incr(key, n, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return count, f.append(fileRecord{Key: key, Value: strconv.AppendInt(nil, count, 10), Expires: expires})
+}
+
+// Get returns the value at key
+func (f *File) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return f.memory.Get(ctx, key)
+}
+
+// Set stores value at key
+func (f *File) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expires := expiry(time.Now(), ttl)
+	f.memory.put(key, value, expires)
+	return f.append(fileRecord{Key: key, Value: value, Expires: expires})
+}
+
+// Delete removes key
+func (f *File) Delete(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.memory.Delete(ctx, key)
+	return f.append(fileRecord{Key: key, Deleted: true})
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// append writes a change to the file, compacting it when enough have been
+// written; f.mu must be held
+func (f *File) append(record fileRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if f.changes++; f.changes >= fileCompactAfter {
+		return f.compact()
+	}
+	return nil
+}
+
+// compact replaces the file with one holding only the live entries and opens
+// it for appending; f.mu must be held unless the store is being opened
+func (f *File) compact() error {
+	temp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+	f.memory.each(func(key string, value []byte, expires time.Time) {
+		if err == nil {
+			err = encoder.Encode(fileRecord{Key: key, Value: value, Expires: expires})
+		}
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.changes = file, 0
+	return nil
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory is a store in this process's memory. It holds at most maxEntries
+// keys; expired keys are dropped first and, under a flood of new keys, the
+// ones closest to expiring.
+type Memory struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an empty in-memory store of up to maxEntries keys
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{maxEntries: maxEntries, entries: make(map[string]*entry)}
+}
+
+// Incr adds n to the counter at key, which is kept as a decimal number like
+// Redis does
+func (m *Memory) Incr(_ context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	count, _, err := m.incr(key, n, ttl)
+	return count, err
+}
+
+// incr adds n to the counter at key and returns its new value and expiry
+func (m *Memory) incr(key string, n int64, ttl time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key, now)
+	if e == nil {
+		e = m.insert(key, expiry(now, ttl), now)
+	}
+	count, err := strconv.ParseInt(string(e.value), 10, 64)
+	if len(e.value) > 0 && err != nil {
+		return 0, time.Time{}, err
+	}
+	count += n
+	e.value = strconv.AppendInt(e.value[:0], count, 10)
+	return count, e.expires, nil
+}
+
+// Get returns the value at key
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key, time.Now())
+	if e == nil {
+		return nil, false, nil
+	}
+	return append([]byte(nil), e.value...), true, nil
+}
+
+// Set stores value at key
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.put(key, value, expiry(time.Now(), ttl))
+	return nil
+}
+
+// put stores value at key until expires, zero for never
+func (m *Memory) put(key string, value []byte, expires time.Time) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key, now)
+	if e == nil {
+		e = m.insert(key, time.Time{}, now)
+	}
+	e.value = append([]byte(nil), value...)
+	e.expires = expires
+}
+
+// Delete removes key
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Close does nothing; the entries go with the process
+func (m *Memory) Close() error {
+	return nil
+}
+
+// each calls fn with every entry that has not expired
+func (m *Memory) each(fn func(key string, value []byte, expires time.Time)) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.entries {
+		if e := m.lookup(key, now); e != nil {
+			fn(key, e.value, e.expires)
+		}
+	}
+}
+
+// lookup returns the entry at key, dropping it if it expired; m.mu must be held
+func (m *Memory) lookup(key string, now time.Time) *entry {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !now.Before(e.expires) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+// insert adds an empty entry at key, making room for it if the store is
+// full; m.mu must be held
+func (m *Memory) insert(key string, expires, now time.Time) *entry {
+	if len(m.entries) >= m.maxEntries {
+		m.evict(now)
+	}
+	e := &entry{expires: expires}
+	m.entries[key] = e
+	return e
+}
+
+// evict drops expired entries, and the one closest to expiring if none are;
+// m.mu must be held
+func (m *Memory) evict(now time.Time) {
+	soonest, soonestTime := "", time.Time{}
+	for key, e := range m.entries {
+		if e.expires.IsZero() {
+			continue
+		}
+		if !now.Before(e.expires) {
+			delete(m.entries, key)
+			continue
+		}
+		if soonest == "" || e.expires.Before(soonestTime) {
+			soonest, soonestTime = key, e.expires
+		}
+	}
+	if len(m.entries) >= m.maxEntries && soonest != "" {
+		delete(m.entries, soonest)
+	}
+}
+
+// expiry returns when an entry written now with ttl expires, zero for never
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
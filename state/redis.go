@@ -0,0 +1,233 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redisTimeout bounds a command whose context has no deadline, so an
+// unreachable server slows requests down instead of hanging them
+const redisTimeout = 2 * time.Second
+
+// redisIdle is how many idle connections are kept for reuse
+const redisIdle = 16
+
+// incrScript adds to a counter and starts its expiry if it has none, in one
+// step so a crash in between cannot leave a counter that never expires
+const incrScript = `local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return v`
+
+// Redis is a store on a Redis server, shared by every router using it. Keys
+// are prefixed so routers can share a server with other programs.
+type Redis struct {
+	address  string
+	password string
+	db       int
+	prefix   string
+	idle     chan *redisConn
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis returns a store on the Redis server at address, selecting
+// database db and logging in with password if it is set. Connections are
+// made when commands need them.
+func NewRedis(address, password string, db int, prefix string) *Redis {
+	return &Redis{
+		address:  address,
+		password: password,
+		db:       db,
+		prefix:   prefix,
+		idle:     make(chan *redisConn, redisIdle),
+	}
+}
+
+// Incr adds n to the counter at key
+func (r *Redis) Incr(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	reply, err := r.do(ctx, "EVAL", incrScript, "1", r.prefix+key,
+		strconv.FormatInt(n, 10), strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %v to INCRBY", reply)
+	}
+	return count, nil
+}
+
+// Get returns the value at key
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value at key
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", r.prefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Delete removes key
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", r.prefix+key)
+	return err
+}
+
+// Close closes the idle connections
+func (r *Redis) Close() error {
+	for {
+		select {
+		case conn := <-r.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply: nil, an int64, a string for a
+// status, []byte for a bulk string or []any for an array. A connection that
+// fails is closed rather than reused.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	reply, err := conn.command(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case r.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one, logging in and
+// selecting the database
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-r.idle:
+		return conn, nil
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "tcp", r.address)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: c, reader: bufio.NewReader(c)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	if r.password != "" {
+		if _, err := conn.command("AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.command("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// command writes a command as an array of bulk strings and reads the reply
+func (c *redisConn) command(args ...string) (any, error) {
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads one reply
+func (c *redisConn) read() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				// The rest of the array is left unread, so an error element
+				// must not pass for a reply the connection can be reused after
+				return nil, fmt.Errorf("redis: array reply element %d: %v", i, err)
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: malformed reply %q", line)
+}
@@ -0,0 +1,37 @@
+// Package state keeps the counters and values the router needs to agree on
+// across instances: failed authentication counts and the rate limits and
+// budgets of named keys. The key file, semantic cache and audit log are not
+// kept here. The in-memory store
+// serves a single instance, and the file store a single instance that keeps
+// its state across restarts; instances behind a load balancer share a Redis
+// server instead, so a client cannot spread its attempts over them.
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// Drivers a store can be opened with
+const (
+	DriverMemory = "memory"
+	DriverFile   = "file"
+	DriverRedis  = "redis"
+)
+
+// Store is a key-value store with expiring entries. Keys are shared by every
+// router using the store, so callers name them after their package.
+type Store interface {
+	// Incr adds n to the counter at key and returns its new value. A counter
+	// that does not exist starts at zero and expires ttl later, if ttl is
+	// positive; adding to it does not extend its life.
+	Incr(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+	// Get returns the value at key, and false if there is none
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value at key, expiring ttl later if ttl is positive
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key, if it exists
+	Delete(ctx context.Context, key string) error
+	// Close releases the store's connections
+	Close() error
+}
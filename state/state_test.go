@@ -0,0 +1,261 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore checks the behavior every store shares
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	for want := int64(1); want <= 3; want++ {
+		if got, err := s.Incr(ctx, "count", 1, time.Minute); err != nil || got != want {
+			t.Fatalf("Incr = %d, %v, want %d", got, err, want)
+		}
+	}
+	if got, err := s.Incr(ctx, "count", 5, time.Minute); err != nil || got != 8 {
+		t.Errorf("Incr by 5 = %d, %v, want 8", got, err)
+	}
+	if value, ok, err := s.Get(ctx, "count"); err != nil || !ok || string(value) != "8" {
+		t.Errorf("Get counter = %q, %v, %v", value, ok, err)
+	}
+
+	if err := s.Set(ctx, "value", []byte("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := s.Get(ctx, "value"); err != nil || !ok || string(value) != "hello" {
+		t.Errorf("Get = %q, %v, %v", value, ok, err)
+	}
+	if err := s.Delete(ctx, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get(ctx, "value"); err != nil || ok {
+		t.Errorf("Expected a deleted key to be missing, got %v, %v", ok, err)
+	}
+	if _, ok, err := s.Get(ctx, "never"); err != nil || ok {
+		t.Errorf("Expected a missing key, got %v, %v", ok, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(100)
+	testStore(t, m)
+
+	ctx := context.Background()
+	m.Incr(ctx, "short", 1, 20*time.Millisecond)
+	m.Set(ctx, "brief", []byte("x"), 20*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if got, _ := m.Incr(ctx, "short", 1, time.Minute); got != 1 {
+		t.Errorf("Expected an expired counter to start over, got %d", got)
+	}
+	if _, ok, _ := m.Get(ctx, "brief"); ok {
+		t.Errorf("Expected the value to expire")
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	m := NewMemory(2)
+	ctx := context.Background()
+	m.Set(ctx, "soon", []byte("1"), time.Minute)
+	m.Set(ctx, "later", []byte("2"), time.Hour)
+	m.Set(ctx, "new", []byte("3"), time.Hour)
+	if _, ok, _ := m.Get(ctx, "soon"); ok {
+		t.Errorf("Expected the key closest to expiring to be evicted")
+	}
+	for _, key := range []string{"later", "new"} {
+		if _, ok, _ := m.Get(ctx, key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	f, err := OpenFile(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, f)
+	ctx := context.Background()
+	f.Set(ctx, "brief", []byte("x"), 20*time.Millisecond)
+	f.Set(ctx, "kept", []byte("y"), time.Hour)
+	f.Close()
+	time.Sleep(30 * time.Millisecond)
+
+	f, err = OpenFile(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, err := f.Incr(ctx, "count", 1, time.Minute); err != nil || got != 9 {
+		t.Errorf("Expected the counter to survive reopening, got %d, %v", got, err)
+	}
+	if value, ok, _ := f.Get(ctx, "kept"); !ok || string(value) != "y" {
+		t.Errorf("Expected the value to survive reopening, got %q, %v", value, ok)
+	}
+	for _, key := range []string{"brief", "value"} {
+		if _, ok, _ := f.Get(ctx, key); ok {
+			t.Errorf("Expected %s to stay gone", key)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("Expected the file compacted to its live entries and one change, got %d lines", lines)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	r := NewRedis(server.addr, "secret", 2, "test:")
+	defer r.Close()
+	testStore(t, r)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.db != "2" {
+		t.Errorf("Expected database 2 to be selected, got %q", server.db)
+	}
+	if _, ok := server.data["test:count"]; !ok {
+		t.Errorf("Expected keys to be prefixed, got %v", server.data)
+	}
+	if server.ttl["test:count"] != "60000" {
+		t.Errorf("Expected the counter to expire in a minute, got %q", server.ttl["test:count"])
+	}
+
+}
+
+func TestRedisClosesConnectionsAfterErrorsInArrays(t *testing.T) {
+	server := newFakeRedis(t, "")
+	r := NewRedis(server.addr, "", 0, "")
+	defer r.Close()
+	if _, err := r.do(context.Background(), "PAIR"); err == nil || !strings.Contains(err.Error(), "first failed") {
+		t.Fatalf("Expected the error element reported, got %v", err)
+	}
+	if len(r.idle) != 0 {
+		t.Fatal("Expected the connection with an unread reply closed, not kept")
+	}
+	if err := r.Set(context.Background(), "key", []byte("value"), 0); err != nil {
+		t.Errorf("Expected the next command to succeed on a new connection, got %v", err)
+	}
+}
+
+func TestRedisWrongPassword(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	if _, _, err := NewRedis(server.addr, "wrong", 0, "").Get(context.Background(), "count"); err == nil {
+		t.Errorf("Expected a wrong password to fail")
+	}
+}
+
+// fakeRedis answers the commands the store sends, keeping keys in a map
+type fakeRedis struct {
+	addr     string
+	password string
+
+	mu   sync.Mutex
+	db   string
+	data map[string]string
+	ttl  map[string]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	f := &fakeRedis{addr: listener.Addr().String(), password: password, data: map[string]string{}, ttl: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required\r\n"
+		case cmd == "SELECT":
+			f.db, reply = args[1], "+OK\r\n"
+		case cmd == "EVAL":
+			key := args[3]
+			n, _ := strconv.ParseInt(args[4], 10, 64)
+			count, _ := strconv.ParseInt(f.data[key], 10, 64)
+			count += n
+			f.data[key] = strconv.FormatInt(count, 10)
+			if _, ok := f.ttl[key]; !ok {
+				f.ttl[key] = args[5]
+			}
+			reply = fmt.Sprintf(":%d\r\n", count)
+		case cmd == "GET":
+			value, ok := f.data[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			}
+		case cmd == "SET":
+			f.data[args[1]], reply = args[2], "+OK\r\n"
+		case cmd == "PAIR":
+			reply = "*2\r\n-ERR first failed\r\n:2\r\n"
+		case cmd == "DEL":
+			delete(f.data, args[1])
+			reply = ":1\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	var count int
+	if _, err := fmt.Fscanf(reader, "*%d\r\n", &count); err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
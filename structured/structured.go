@@ -0,0 +1,271 @@
+// Package structured emulates OpenAI structured outputs for backends that do
+// not support response_format json_schema: the schema is turned into prompt
+// instructions, and the model's answer is repaired and validated afterwards.
+package structured
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Schema extracts the JSON schema from a response_format of type json_schema,
+// or from the text.format of a responses request
+func Schema(chatReq map[string]interface{}) (map[string]interface{}, bool) {
+	if text, ok := chatReq["text"].(map[string]interface{}); ok {
+		format, _ := text["format"].(map[string]interface{})
+		if format["type"] != "json_schema" {
+			return nil, false
+		}
+		schema, ok := format["schema"].(map[string]interface{})
+		return schema, ok
+	}
+	format, _ := chatReq["response_format"].(map[string]interface{})
+	if format["type"] != "json_schema" {
+		return nil, false
+	}
+	jsonSchema, _ := format["json_schema"].(map[string]interface{})
+	schema, ok := jsonSchema["schema"].(map[string]interface{})
+	return schema, ok
+}
+
+// Instructions returns the system prompt text asking the model to follow schema
+func Instructions(schema map[string]interface{}) string {
+	encoded, _ := json.MarshalIndent(schema, "", "  ")
+	return "Respond only with a single JSON value that conforms to the following JSON Schema. " +
+		"Do not wrap it in code fences and do not add any explanation.\n" + string(encoded)
+}
+
+// Apply replaces the response_format of a chat completions request, or the
+// text.format of a responses request, with prompt instructions in its
+// messages or input, returning the schema the response should be validated
+// against
+func Apply(chatReq map[string]interface{}) (map[string]interface{}, bool) {
+	schema, ok := Schema(chatReq)
+	if !ok {
+		return nil, false
+	}
+	delete(chatReq, "response_format")
+	if text, ok := chatReq["text"].(map[string]interface{}); ok {
+		delete(text, "format")
+		if len(text) == 0 {
+			delete(chatReq, "text")
+		}
+	}
+
+	instructions := Instructions(schema)
+	switch input := chatReq["input"].(type) {
+	case string:
+		chatReq["input"] = []interface{}{
+			map[string]interface{}{"role": "system", "content": instructions},
+			map[string]interface{}{"role": "user", "content": input},
+		}
+	case []interface{}:
+		chatReq["input"] = withInstructions(input, instructions)
+	default:
+		messages, _ := chatReq["messages"].([]interface{})
+		chatReq["messages"] = withInstructions(messages, instructions)
+	}
+	return schema, true
+}
+
+// withInstructions adds instructions to a leading system prompt, or as one
+func withInstructions(messages []interface{}, instructions string) []interface{} {
+	if len(messages) > 0 {
+		// Extend a leading system prompt rather than adding a second one
+		if first, _ := messages[0].(map[string]interface{}); first["role"] == "system" || first["role"] == "developer" {
+			if content, ok := first["content"].(string); ok {
+				first["content"] = content + "\n\n" + instructions
+				return messages
+			}
+		}
+	}
+	system := map[string]interface{}{"role": "system", "content": instructions}
+	return append([]interface{}{system}, messages...)
+}
+
+// Repair extracts a JSON value from model output that may be wrapped in code
+// fences or surrounded by prose. It returns false if no JSON value is found.
+func Repair(content string) (string, bool) {
+	trimmed := strings.TrimSpace(content)
+	if json.Valid([]byte(trimmed)) {
+		return trimmed, true
+	}
+
+	// Strip a ```json ... ``` fence
+	if start := strings.Index(trimmed, "```"); start >= 0 {
+		inner := trimmed[start+3:]
+		if newline := strings.IndexByte(inner, '\n'); newline >= 0 {
+			inner = inner[newline+1:]
+		}
+		if end := strings.Index(inner, "```"); end >= 0 {
+			inner = strings.TrimSpace(inner[:end])
+			if json.Valid([]byte(inner)) {
+				return inner, true
+			}
+		}
+	}
+
+	// Fall back to the first balanced object or array
+	return firstBalanced(trimmed)
+}
+
+// firstBalanced returns the first bracketed value in s that is valid JSON.
+// Brackets are matched in one pass; the values nested in one that is not
+// valid, or never closes, are tried once it has closed or s has ended.
+func firstBalanced(s string) (string, bool) {
+	var opens []int
+	var nested [][2]int
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case len(opens) == 0 && c != '{' && c != '[':
+			// Prose between values
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			opens = append(opens, i)
+		case c == '}' || c == ']':
+			start := opens[len(opens)-1]
+			opens = opens[:len(opens)-1]
+			if len(opens) > 0 {
+				nested = append(nested, [2]int{start, i + 1})
+				continue
+			}
+			if json.Valid([]byte(s[start : i+1])) {
+				return s[start : i+1], true
+			}
+			if value, ok := firstValid(s, nested); ok {
+				return value, true
+			}
+			nested = nested[:0]
+		}
+	}
+	return firstValid(s, nested)
+}
+
+// firstValid returns the span of s that starts first and is valid JSON
+func firstValid(s string, spans [][2]int) (string, bool) {
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	for _, span := range spans {
+		if value := s[span[0]:span[1]]; json.Valid([]byte(value)) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Validate checks value against the subset of JSON Schema that structured
+// outputs use: type, properties, required, additionalProperties, items and enum
+func Validate(schema map[string]interface{}, value interface{}) error {
+	return validate(schema, value, "$")
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v not in enum", path, value)
+		}
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s", path, strings.Join(types, " or "))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[fmt.Sprint(name)]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, propValue := range v {
+			propSchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := validate(propSchema, propValue, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes normalizes the "type" keyword, which may be a string or a list
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, v := range t {
+			types = append(types, fmt.Sprint(v))
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return true
+}
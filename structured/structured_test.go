@@ -0,0 +1,130 @@
+package structured
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var personSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"name": map[string]interface{}{"type": "string"},
+		"age":  map[string]interface{}{"type": "integer"},
+		"role": map[string]interface{}{"type": "string", "enum": []interface{}{"admin", "user"}},
+	},
+	"required":             []interface{}{"name", "age"},
+	"additionalProperties": false,
+}
+
+func TestRepair(t *testing.T) {
+	tests := map[string]string{
+		`{"a":1}`:                  `{"a":1}`,
+		"```json\n{\"a\": 1}\n```": `{"a": 1}`,
+		`Sure! Here you go: {"a": "}"} hope it helps`: `{"a": "}"}`,
+		`Result: [1, 2, 3].`:                          `[1, 2, 3]`,
+		`{not json, but [1, 2] is} {"a": 1}`:          `[1, 2]`,
+		`Cut short: {"a": [1, 2]`:                     `[1, 2]`,
+	}
+	for input, want := range tests {
+		got, ok := Repair(input)
+		if !ok || got != want {
+			t.Errorf("Repair(%q) = %q, %v; want %q", input, got, ok, want)
+		}
+	}
+
+	if _, ok := Repair("no json here"); ok {
+		t.Errorf("Expected Repair to fail without JSON")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		doc   string
+		valid bool
+	}{
+		{`{"name":"Ada","age":36}`, true},
+		{`{"name":"Ada","age":36,"role":"admin"}`, true},
+		{`{"name":"Ada"}`, false},
+		{`{"name":"Ada","age":36.5}`, false},
+		{`{"name":"Ada","age":36,"role":"root"}`, false},
+		{`{"name":"Ada","age":36,"extra":true}`, false},
+		{`[]`, false},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		json.Unmarshal([]byte(tt.doc), &value)
+		err := Validate(personSchema, value)
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%s) error = %v, want valid=%v", tt.doc, err, tt.valid)
+		}
+	}
+}
+
+func TestApplyExtendsSystemPrompt(t *testing.T) {
+	chatReq := map[string]interface{}{
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": "You are helpful."},
+			map[string]interface{}{"role": "user", "content": "Who?"},
+		},
+		"response_format": map[string]interface{}{
+			"type":        "json_schema",
+			"json_schema": map[string]interface{}{"name": "person", "schema": personSchema},
+		},
+	}
+
+	schema, ok := Apply(chatReq)
+	if !ok || schema == nil {
+		t.Fatalf("Expected schema to be applied")
+	}
+	if _, ok := chatReq["response_format"]; ok {
+		t.Errorf("Expected response_format to be removed")
+	}
+	messages := chatReq["messages"].([]interface{})
+	if len(messages) != 2 {
+		t.Fatalf("Expected no extra message, got %d", len(messages))
+	}
+	system := messages[0].(map[string]interface{})["content"].(string)
+	if !strings.HasPrefix(system, "You are helpful.") || !strings.Contains(system, `"additionalProperties": false`) {
+		t.Errorf("Unexpected system prompt %q", system)
+	}
+}
+
+func TestApplyToResponsesInput(t *testing.T) {
+	format := map[string]interface{}{"type": "json_schema", "name": "person", "schema": personSchema}
+	request := map[string]interface{}{"input": "Who?", "text": map[string]interface{}{"format": format}}
+	if schema, ok := Apply(request); !ok || schema == nil {
+		t.Fatalf("Expected the schema of text.format to be applied")
+	}
+	if _, ok := request["text"]; ok {
+		t.Errorf("Expected text.format to be removed")
+	}
+	input, _ := request["input"].([]interface{})
+	if len(input) != 2 || input[0].(map[string]interface{})["role"] != "system" || input[1].(map[string]interface{})["content"] != "Who?" {
+		t.Errorf("Expected the instructions before the question, got %v", request["input"])
+	}
+
+	request = map[string]interface{}{
+		"input": []interface{}{
+			map[string]interface{}{"role": "developer", "content": "Be brief."},
+			map[string]interface{}{"role": "user", "content": "Who?"},
+		},
+		"text": map[string]interface{}{"format": format, "verbosity": "low"},
+	}
+	Apply(request)
+	input, _ = request["input"].([]interface{})
+	developer, _ := input[0].(map[string]interface{})["content"].(string)
+	if len(input) != 2 || !strings.HasPrefix(developer, "Be brief.") || !strings.Contains(developer, "JSON Schema") {
+		t.Errorf("Expected the developer prompt extended, got %v", input)
+	}
+	if text := request["text"].(map[string]interface{}); text["verbosity"] != "low" || text["format"] != nil {
+		t.Errorf("Expected only the format removed, got %v", text)
+	}
+}
+
+func TestApplyIgnoresOtherFormats(t *testing.T) {
+	chatReq := map[string]interface{}{"response_format": map[string]interface{}{"type": "json_object"}}
+	if _, ok := Apply(chatReq); ok {
+		t.Errorf("Expected json_object to be left alone")
+	}
+}
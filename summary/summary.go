@@ -0,0 +1,71 @@
+// Package summary remembers summaries of the older turns of conversations, so
+// a conversation that keeps growing is summarized incrementally instead of
+// from its first message on every request.
+package summary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// maxEntries bounds how many summaries are remembered; the oldest go first
+const maxEntries = 1000
+
+// Cache maps conversation prefixes to their summaries
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	order   []string
+}
+
+// New returns an empty cache
+func New() *Cache {
+	return &Cache{entries: make(map[string]string)}
+}
+
+// Keys returns a key for every prefix of messages: keys[i] identifies
+// messages[:i+1]. Each key chains the previous one, so a conversation that
+// grew since it was last summarized still finds the summary of its start.
+func Keys(messages []interface{}) []string {
+	keys := make([]string, len(messages))
+	var previous []byte
+	for i, m := range messages {
+		encoded, _ := json.Marshal(m)
+		h := sha256.New()
+		h.Write(previous)
+		h.Write(encoded)
+		previous = h.Sum(nil)
+		keys[i] = hex.EncodeToString(previous)
+	}
+	return keys
+}
+
+// Get returns the summary remembered for a key
+func (c *Cache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	text, ok := c.entries[key]
+	return text, ok
+}
+
+// Put remembers the summary for a key
+func (c *Cache) Put(key, text string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = text
+	if len(c.order) > maxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
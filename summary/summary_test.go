@@ -0,0 +1,37 @@
+package summary
+
+import "testing"
+
+func TestKeysIdentifyPrefixes(t *testing.T) {
+	short := []interface{}{"a", "b"}
+	long := []interface{}{"a", "b", "c"}
+	shortKeys, longKeys := Keys(short), Keys(long)
+	if shortKeys[1] != longKeys[1] {
+		t.Errorf("Expected a shared prefix to share its key")
+	}
+	if longKeys[2] == longKeys[1] {
+		t.Errorf("Expected a longer prefix to get a new key")
+	}
+	if Keys([]interface{}{"b", "a"})[1] == shortKeys[1] {
+		t.Errorf("Expected the order of messages to change the key")
+	}
+}
+
+func TestCacheEvictsOldest(t *testing.T) {
+	c := New()
+	for i := 0; i <= maxEntries; i++ {
+		c.Put(Keys([]interface{}{i})[0], "summary")
+	}
+	if _, ok := c.Get(Keys([]interface{}{0})[0]); ok {
+		t.Errorf("Expected the oldest summary to be evicted")
+	}
+	if text, ok := c.Get(Keys([]interface{}{maxEntries})[0]); !ok || text != "summary" {
+		t.Errorf("Expected the newest summary, got %q", text)
+	}
+
+	var missing *Cache
+	missing.Put("key", "summary")
+	if _, ok := missing.Get("key"); ok {
+		t.Errorf("Expected a nil cache to remember nothing")
+	}
+}
@@ -0,0 +1,115 @@
+// Package synthetic answers models the router serves itself, such as a bot
+// that returns the team's usage policy or a model for health checks. Their
+// responses are Go templates, chosen by regular expressions matched against
+// the last user message. Each configuration keeps its models in a Set of its own.
+package synthetic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Model is a compiled synthetic model
+type Model struct {
+	Name     string
+	rules    []rule
+	response *template.Template
+}
+
+type rule struct {
+	match    *regexp.Regexp
+	response *template.Template
+}
+
+// Rule answers with Response when the regular expression Match matches the
+// last user message
+type Rule struct {
+	Match    string
+	Response string
+}
+
+// Compile checks a synthetic model called name, answering with response unless
+// one of rules matches, and compiles its patterns and templates
+func Compile(name, response string, rules []Rule) (*Model, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no name")
+	}
+	if response == "" && len(rules) == 0 {
+		return nil, fmt.Errorf("no response or rules")
+	}
+	m := &Model{Name: name}
+	var err error
+	if m.response, err = template.New(name).Parse(response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	for i, r := range rules {
+		compiled := rule{}
+		if compiled.match, err = regexp.Compile(r.Match); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match: %w", i, err)
+		}
+		if compiled.response, err = template.New(fmt.Sprintf("%s rule %d", name, i)).Parse(r.Response); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid response: %w", i, err)
+		}
+		m.rules = append(m.rules, compiled)
+	}
+	return m, nil
+}
+
+// Respond renders the response to a request. vars are the request context
+// variables; the template also sees the last user message as .last_user,
+// the submatches of the rule's expression as .match and the current time as .time.
+func (m *Model) Respond(vars map[string]interface{}, lastUser string) (string, error) {
+	data := make(map[string]interface{}, len(vars)+3)
+	for k, v := range vars {
+		data[k] = v
+	}
+	data["last_user"] = lastUser
+	data["time"] = time.Now()
+
+	tmpl := m.response
+	for _, r := range m.rules {
+		if match := r.match.FindStringSubmatch(lastUser); match != nil {
+			tmpl = r.response
+			data["match"] = match
+			break
+		}
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Rules returns the number of rules of the model
+func (m *Model) Rules() int {
+	return len(m.rules)
+}
+
+// Set holds synthetic models by name. A nil Set holds none.
+type Set struct {
+	models map[string]*Model
+}
+
+// Add adds m to the set, refusing a second model of the same name
+func (s *Set) Add(m *Model) error {
+	if _, ok := s.models[m.Name]; ok {
+		return fmt.Errorf("synthetic model %s is defined more than once", m.Name)
+	}
+	if s.models == nil {
+		s.models = make(map[string]*Model)
+	}
+	s.models[m.Name] = m
+	return nil
+}
+
+// For returns the synthetic model called name, or nil if there is none
+func (s *Set) For(name string) *Model {
+	if s == nil {
+		return nil
+	}
+	return s.models[name]
+}
@@ -0,0 +1,63 @@
+package synthetic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRespondRulesAndTemplate(t *testing.T) {
+	m, err := Compile("policy-bot", "Usage policy for {{.key_id}}: no customer data.", []Rule{
+		{Match: `(?i)^echo (.+)`, Response: "{{index .match 1}}"},
+		{Match: `(?i)ping`, Response: "pong"},
+	})
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+
+	for lastUser, want := range map[string]string{
+		"echo hello there": "hello there",
+		"PING?":            "pong",
+		"what's allowed?":  "Usage policy for key-1234: no customer data.",
+	} {
+		got, err := m.Respond(map[string]interface{}{"key_id": "key-1234"}, lastUser)
+		if err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", lastUser, want, got, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, response string
+		rules          []Rule
+	}{
+		{"", "x", nil},
+		{"empty", "", nil},
+		{"bad-template", "{{.x", nil},
+		{"bad-match", "", []Rule{{Match: "(", Response: "x"}}},
+	} {
+		if _, err := Compile(tt.name, tt.response, tt.rules); err == nil {
+			t.Errorf("Expected %+v to be rejected", tt)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	health, _ := Compile("health", "ok", nil)
+	set := &Set{}
+	if err := set.Add(health); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if set.For("health") == nil || set.For("other") != nil {
+		t.Errorf("Expected only the health model in the set")
+	}
+
+	again, _ := Compile("health", "again", nil)
+	if err := set.Add(again); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("Expected a duplicate name to be rejected, got %v", err)
+	}
+	var none *Set
+	if none.For("health") != nil {
+		t.Errorf("Expected no models without a set")
+	}
+}
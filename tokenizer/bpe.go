@@ -0,0 +1,360 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-tokenization patterns splitting text into the pieces BPE merges within.
+// Go's regexp has no lookahead, so the \s+(?!\S) alternative is left out and
+// emulated by split.
+const (
+	// PatternCL100K is the pattern of OpenAI's cl100k_base and Llama 3
+	PatternCL100K = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`
+	// PatternGPT2 is the pattern of GPT-2 and byte-level Hugging Face tokenizers
+	PatternGPT2 = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+`
+)
+
+// maxPiece bounds the length of a piece that is merged exactly; merging is
+// quadratic, and longer pieces such as base64 blobs are estimated instead
+const maxPiece = 2048
+
+// compilePattern compiles a pre-tokenization pattern, dropping the lookahead
+// alternative Go cannot compile
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.ReplaceAll(pattern, `\s+(?!\S)|`, "")
+	pattern = strings.ReplaceAll(pattern, `|\s+(?!\S)`, "")
+	return regexp.Compile(pattern)
+}
+
+// split pre-tokenizes text. A run of whitespace before a word gives its last
+// space to the word, as \s+(?!\S) does in the original patterns.
+func split(re *regexp.Regexp, text string) []string {
+	pieces := re.FindAllString(text, -1)
+	for i := 0; i < len(pieces)-1; i++ {
+		piece, next := pieces[i], pieces[i+1]
+		if len(piece) < 2 || !strings.HasSuffix(piece, " ") || strings.TrimSpace(piece) != "" {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(next); unicode.IsSpace(r) {
+			continue
+		}
+		pieces[i] = piece[:len(piece)-1]
+		if r, _ := utf8.DecodeRuneInString(next); unicode.IsDigit(r) {
+			// Numbers do not take a leading space, which becomes a piece of its own
+			pieces = append(pieces[:i+1], append([]string{" "}, pieces[i+1:]...)...)
+			i++
+		} else {
+			pieces[i+1] = " " + next
+		}
+	}
+	return pieces
+}
+
+// merge applies byte pair merges to symbols, always merging the adjacent
+// pair with the lowest rank first, and returns the remaining symbols
+func merge(symbols []string, rank func(a, b string) (int, bool)) []string {
+	for len(symbols) > 1 {
+		best, at := -1, -1
+		for i := 0; i < len(symbols)-1; i++ {
+			if r, ok := rank(symbols[i], symbols[i+1]); ok && (best < 0 || r < best) {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		symbols[at] += symbols[at+1]
+		symbols = append(symbols[:at+1], symbols[at+2:]...)
+	}
+	return symbols
+}
+
+// Tiktoken is a tokenizer for OpenAI models, loaded from a tiktoken rank file
+type Tiktoken struct {
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// LoadTiktoken loads a tiktoken rank file, such as cl100k_base.tiktoken, in
+// which each line is a base64 token and its rank. The pattern defaults to
+// PatternCL100K.
+func LoadTiktoken(path, pattern string) (*Tiktoken, error) {
+	if pattern == "" {
+		pattern = PatternCL100K
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tiktoken{ranks: make(map[string]int), pattern: re}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", path, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		t.ranks[string(token)] = rank
+	}
+	return t, scanner.Err()
+}
+
+// Count implements Tokenizer
+func (t *Tiktoken) Count(text string) int {
+	count := 0
+	for _, piece := range split(t.pattern, text) {
+		if _, ok := t.ranks[piece]; ok {
+			count++
+			continue
+		}
+		if len(piece) > maxPiece {
+			count += Heuristic{}.Count(piece)
+			continue
+		}
+		symbols := make([]string, len(piece))
+		for i := 0; i < len(piece); i++ {
+			symbols[i] = piece[i : i+1]
+		}
+		count += len(merge(symbols, func(a, b string) (int, bool) {
+			r, ok := t.ranks[a+b]
+			return r, ok
+		}))
+	}
+	return count
+}
+
+// HuggingFace is a BPE tokenizer loaded from a Hugging Face tokenizer.json.
+// Byte-level models (GPT-2, Llama 3, Qwen) and SentencePiece models that mark
+// spaces with ▁ (Llama 2, Mistral) are supported.
+type HuggingFace struct {
+	vocab        map[string]int
+	merges       map[[2]string]int
+	pattern      *regexp.Regexp
+	byteLevel    bool
+	metaspace    string
+	byteFallback bool
+}
+
+// tokenizerFile is the part of tokenizer.json that determines token counts
+type tokenizerFile struct {
+	Model struct {
+		Type         string            `json:"type"`
+		Vocab        map[string]int    `json:"vocab"`
+		Merges       []json.RawMessage `json:"merges"`
+		ByteFallback bool              `json:"byte_fallback"`
+	} `json:"model"`
+	PreTokenizer *preTokenizer `json:"pre_tokenizer"`
+	Normalizer   *normalizer   `json:"normalizer"`
+}
+
+type preTokenizer struct {
+	Type    string `json:"type"`
+	Pattern struct {
+		Regex string `json:"Regex"`
+	} `json:"pattern"`
+	Replacement   string         `json:"replacement"`
+	PreTokenizers []preTokenizer `json:"pretokenizers"`
+}
+
+type normalizer struct {
+	Type    string `json:"type"`
+	Pattern struct {
+		String string `json:"String"`
+	} `json:"pattern"`
+	Content     string       `json:"content"`
+	Normalizers []normalizer `json:"normalizers"`
+}
+
+// LoadHuggingFace loads a BPE tokenizer from a tokenizer.json file
+func LoadHuggingFace(path string) (*HuggingFace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file tokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if file.Model.Type != "BPE" {
+		return nil, fmt.Errorf("%s: unsupported model type %q; only BPE is supported", path, file.Model.Type)
+	}
+
+	h := &HuggingFace{vocab: file.Model.Vocab, merges: make(map[[2]string]int, len(file.Model.Merges)), byteFallback: file.Model.ByteFallback}
+	for i, raw := range file.Model.Merges {
+		// Merges are "a b" strings in older files and ["a", "b"] pairs in newer ones
+		var pair [2]string
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			a, b, ok := strings.Cut(s, " ")
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid merge %q", path, s)
+			}
+			pair = [2]string{a, b}
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("%s: invalid merge %s", path, raw)
+		}
+		h.merges[pair] = i
+	}
+
+	if file.PreTokenizer != nil {
+		h.configure(*file.PreTokenizer)
+	}
+	if file.Normalizer != nil && h.metaspace == "" {
+		h.metaspace = metaspaceReplacement(*file.Normalizer)
+	}
+	if h.byteLevel && h.pattern == nil {
+		h.pattern, _ = compilePattern(PatternGPT2)
+	}
+	if h.pattern == nil && h.metaspace == "" {
+		return nil, fmt.Errorf("%s: unsupported pre-tokenizer; expected ByteLevel, Split or Metaspace", path)
+	}
+	return h, nil
+}
+
+// configure sets up pre-tokenization from the tokenizer.json pre_tokenizer
+func (h *HuggingFace) configure(p preTokenizer) {
+	switch p.Type {
+	case "ByteLevel":
+		h.byteLevel = true
+	case "Split":
+		if re, err := compilePattern(p.Pattern.Regex); err == nil && p.Pattern.Regex != "" {
+			h.pattern = re
+		}
+	case "Metaspace":
+		h.metaspace = p.Replacement
+		if h.metaspace == "" {
+			h.metaspace = "▁"
+		}
+	case "Sequence":
+		for _, inner := range p.PreTokenizers {
+			h.configure(inner)
+		}
+	}
+}
+
+// metaspaceReplacement finds a normalizer replacing spaces, as SentencePiece
+// models exported without a Metaspace pre-tokenizer use
+func metaspaceReplacement(n normalizer) string {
+	if n.Type == "Replace" && n.Pattern.String == " " {
+		return n.Content
+	}
+	for _, inner := range n.Normalizers {
+		if r := metaspaceReplacement(inner); r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+// Count implements Tokenizer
+func (h *HuggingFace) Count(text string) int {
+	var pieces []string
+	if h.metaspace != "" {
+		// SentencePiece marks the start of every word with the replacement
+		marked := h.metaspace + strings.ReplaceAll(text, " ", h.metaspace)
+		for _, word := range strings.SplitAfter(marked, h.metaspace) {
+			if word != "" {
+				pieces = append(pieces, word)
+			}
+		}
+		pieces = joinMarkers(pieces, h.metaspace)
+	} else {
+		pieces = split(h.pattern, text)
+	}
+
+	count := 0
+	for _, piece := range pieces {
+		if len(piece) > maxPiece {
+			count += Heuristic{}.Count(piece)
+			continue
+		}
+		var symbols []string
+		if h.byteLevel {
+			for i := 0; i < len(piece); i++ {
+				symbols = append(symbols, string(byteToRune[piece[i]]))
+			}
+		} else {
+			for _, r := range piece {
+				symbols = append(symbols, string(r))
+			}
+		}
+		if _, ok := h.vocab[strings.Join(symbols, "")]; ok {
+			count++
+			continue
+		}
+		for _, symbol := range merge(symbols, func(a, b string) (int, bool) {
+			r, ok := h.merges[[2]string{a, b}]
+			return r, ok
+		}) {
+			if _, ok := h.vocab[symbol]; !ok && h.byteFallback {
+				// Unknown characters are spelled out as <0xNN> byte tokens
+				count += len(symbol)
+				continue
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// joinMarkers turns pieces that SplitAfter ends with a marker into pieces that
+// start with one, the way SentencePiece words begin with ▁
+func joinMarkers(pieces []string, marker string) []string {
+	var words []string
+	carry := ""
+	for _, piece := range pieces {
+		word := strings.TrimSuffix(piece, marker)
+		if carry != "" || word != "" {
+			words = append(words, carry+word)
+		}
+		carry = ""
+		if strings.HasSuffix(piece, marker) {
+			carry = marker
+		}
+	}
+	if carry != "" {
+		words = append(words, carry)
+	}
+	return words
+}
+
+// byteToRune is the reversible mapping of bytes to printable runes that
+// byte-level tokenizers use in their vocabularies
+var byteToRune = func() [256]rune {
+	var table [256]rune
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			table[b] = rune(b)
+		} else {
+			table[b] = rune(256 + n)
+			n++
+		}
+	}
+	return table
+}()
@@ -0,0 +1,95 @@
+// Package tokenizer counts tokens the way a model family does. Tokenizers are
+// loaded from the files model vendors publish: tiktoken rank files for OpenAI
+// models and Hugging Face tokenizer.json files for open models, including
+// SentencePiece models exported in that format. Each is selected for the
+// models whose names match its globs in a Set, which each configuration has
+// its own of; other models fall back to a character heuristic.
+package tokenizer
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/kcolemangt/llm-router/utils"
+)
+
+// Types of tokenizer that can be configured
+const (
+	TypeHeuristic   = "heuristic"
+	TypeTiktoken    = "tiktoken"
+	TypeHuggingFace = "huggingface"
+)
+
+// Tokenizer counts the tokens in a text
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Heuristic estimates four characters per token
+type Heuristic struct{}
+
+// Count implements Tokenizer
+func (Heuristic) Count(text string) int {
+	return utils.EstimateTokens(len(text))
+}
+
+// Load loads a tokenizer of type typ from file; pattern overrides the
+// pre-tokenization pattern of tiktoken files
+func Load(typ, file, pattern string) (Tokenizer, error) {
+	switch typ {
+	case TypeHeuristic:
+		return Heuristic{}, nil
+	case TypeTiktoken:
+		return LoadTiktoken(file, pattern)
+	case TypeHuggingFace:
+		return LoadHuggingFace(file)
+	default:
+		return nil, fmt.Errorf("unknown tokenizer type %q (available: %s, %s, %s)", typ, TypeTiktoken, TypeHuggingFace, TypeHeuristic)
+	}
+}
+
+// selection maps model globs to tokenizers, first match wins
+type selection struct {
+	globs     []string
+	tokenizer Tokenizer
+}
+
+// Set selects tokenizers by model name. A nil Set selects none, so every model
+// gets the heuristic.
+type Set struct {
+	selections []selection
+}
+
+// Add selects t for the models matching globs that no earlier entry matches
+func (s *Set) Add(globs []string, t Tokenizer) error {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q", glob)
+		}
+	}
+	s.selections = append(s.selections, selection{globs: globs, tokenizer: t})
+	return nil
+}
+
+// For returns the tokenizer selected for a model, or nil if none is configured
+func (s *Set) For(modelName string) Tokenizer {
+	if s == nil {
+		return nil
+	}
+	for _, sel := range s.selections {
+		for _, glob := range sel.globs {
+			if ok, _ := path.Match(glob, modelName); ok {
+				return sel.tokenizer
+			}
+		}
+	}
+	return nil
+}
+
+// Count counts the tokens of text for a model, estimating if no tokenizer is configured
+func (s *Set) Count(modelName, text string) int {
+	if t := s.For(modelName); t != nil {
+		return t.Count(text)
+	}
+	return Heuristic{}.Count(text)
+}
@@ -0,0 +1,144 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTiktoken writes a rank file with every single byte plus extra tokens
+func writeTiktoken(t *testing.T, extra ...string) string {
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, token := range extra {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), 256+i)
+	}
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	os.WriteFile(path, []byte(b.String()), 0644)
+	return path
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, []byte(content), 0644)
+	return path
+}
+
+func TestSplitGivesTrailingSpaceToWord(t *testing.T) {
+	re, _ := compilePattern(PatternCL100K + `|\s+(?!\S)`)
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"a  b", []string{"a", " ", " b"}},
+		{"x  12", []string{"x", " ", " ", "12"}},
+		{"line\n\nnext", []string{"line", "\n\n", "next"}},
+		{"it's 1234", []string{"it", "'s", " ", "123", "4"}},
+	}
+	for _, tt := range tests {
+		if got := split(re, tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("split(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTiktokenMergesByRank(t *testing.T) {
+	tok, err := LoadTiktoken(writeTiktoken(t, "he", "ll", "llo", " world"), "")
+	if err != nil {
+		t.Fatalf("Failed to load: %s", err)
+	}
+	// " hello" merges to " ", "he", "llo"; " world" is a single token
+	if got := tok.Count(" hello world"); got != 4 {
+		t.Errorf("Expected 4 tokens, got %d", got)
+	}
+	if got := tok.Count(""); got != 0 {
+		t.Errorf("Expected 0 tokens for empty text, got %d", got)
+	}
+}
+
+func TestHuggingFaceByteLevel(t *testing.T) {
+	path := writeFile(t, "tokenizer.json", `{
+		"model": {"type": "BPE",
+			"vocab": {"h":0,"e":1,"l":2,"o":3,"x":4,"Ġ":5,"he":6,"ll":7,"hell":8,"hello":9,"Ġhello":10},
+			"merges": ["h e", "l l", ["he", "ll"], "hell o", "Ġ hello"]},
+		"pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "use_regex": true}
+	}`)
+	tok, err := LoadHuggingFace(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %s", err)
+	}
+	tests := map[string]int{"hello": 1, " hello hello": 2, "hellx": 2}
+	for text, want := range tests {
+		if got := tok.Count(text); got != want {
+			t.Errorf("Count(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestHuggingFaceSentencePiece(t *testing.T) {
+	vocab := `"vocab": {"▁":0,"h":1,"i":2,"▁h":3,"▁hi":4}, "merges": ["▁ h", "▁h i"], "byte_fallback": true`
+	metaspace := writeFile(t, "metaspace.json", `{"model": {"type": "BPE", `+vocab+`},
+		"pre_tokenizer": {"type": "Metaspace", "replacement": "▁"}}`)
+	normalized := writeFile(t, "normalized.json", `{"model": {"type": "BPE", `+vocab+`},
+		"normalizer": {"type": "Sequence", "normalizers": [{"type": "Prepend", "prepend": "▁"},
+			{"type": "Replace", "pattern": {"String": " "}, "content": "▁"}]}}`)
+
+	for _, path := range []string{metaspace, normalized} {
+		tok, err := LoadHuggingFace(path)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %s", path, err)
+		}
+		// "!" and "é" are not in the vocabulary and fall back to one token per byte
+		tests := map[string]int{"hi": 1, "hi hi!": 3, "é": 3}
+		for text, want := range tests {
+			if got := tok.Count(text); got != want {
+				t.Errorf("%s: Count(%q) = %d, want %d", filepath.Base(path), text, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadRejectsUnsupported(t *testing.T) {
+	unigram := writeFile(t, "unigram.json", `{"model": {"type": "Unigram"}}`)
+	if _, err := LoadHuggingFace(unigram); err == nil {
+		t.Errorf("Expected Unigram models to be rejected")
+	}
+	if _, err := Load("sentencepiece", "", ""); err == nil {
+		t.Errorf("Expected an unknown type to be rejected")
+	}
+}
+
+func TestSetSelectsByModel(t *testing.T) {
+	tok, err := Load(TypeTiktoken, writeTiktoken(t, " world"), "")
+	if err != nil {
+		t.Fatalf("Failed to load: %s", err)
+	}
+	set := &Set{}
+	if err := set.Add([]string{"openai/gpt-4*", "gpt-4*"}, tok); err != nil {
+		t.Fatalf("Failed to add: %s", err)
+	}
+	if err := set.Add([]string{"["}, Heuristic{}); err == nil {
+		t.Errorf("Expected an invalid model pattern to be rejected")
+	}
+
+	if set.For("openai/gpt-4o") == nil || set.For("gpt-4o-mini") == nil {
+		t.Errorf("Expected the tiktoken tokenizer for gpt-4 models")
+	}
+	if set.For("ollama/llama3") != nil {
+		t.Errorf("Expected no tokenizer for other models")
+	}
+	if got := set.Count("ollama/llama3", "twelve chars"); got != 3 {
+		t.Errorf("Expected the heuristic for other models, got %d", got)
+	}
+	var none *Set
+	if got := none.Count("openai/gpt-4o", "twelve chars"); got != 3 {
+		t.Errorf("Expected the heuristic without a set, got %d", got)
+	}
+}
@@ -0,0 +1,116 @@
+// Package transcription compares transcripts of the same audio from different
+// backends and renders verbose transcripts in the response format a client
+// asked for, so backends can be queried for verbose_json whatever the client
+// wants.
+package transcription
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Modes of choosing between transcripts
+const (
+	// ModeFirst returns the first model's transcript unless it fails
+	ModeFirst = "first"
+	// ModeConfidence returns the transcript with the highest confidence
+	ModeConfidence = "confidence"
+)
+
+// Response formats of the transcriptions API
+const (
+	FormatJSON        = "json"
+	FormatText        = "text"
+	FormatSRT         = "srt"
+	FormatVTT         = "vtt"
+	FormatVerboseJSON = "verbose_json"
+)
+
+// Verbose is a verbose_json transcript
+type Verbose struct {
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments"`
+}
+
+// Segment is a timed part of a verbose transcript
+type Segment struct {
+	Start      float64  `json:"start"`
+	End        float64  `json:"end"`
+	Text       string   `json:"text"`
+	AvgLogprob *float64 `json:"avg_logprob"`
+}
+
+// Parse parses a verbose_json transcript
+func Parse(body []byte) (Verbose, error) {
+	var v Verbose
+	if err := json.Unmarshal(body, &v); err != nil {
+		return Verbose{}, fmt.Errorf("invalid verbose transcript: %w", err)
+	}
+	return v, nil
+}
+
+// Confidence returns the mean token probability of a transcript, weighting
+// segments by duration. It returns false if no segment has a log probability.
+func Confidence(v Verbose) (float64, bool) {
+	var sum, weight float64
+	for _, segment := range v.Segments {
+		if segment.AvgLogprob == nil {
+			continue
+		}
+		duration := segment.End - segment.Start
+		if duration <= 0 {
+			duration = 1
+		}
+		sum += math.Exp(*segment.AvgLogprob) * duration
+		weight += duration
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return sum / weight, true
+}
+
+// Render converts a verbose_json body to a response format, returning the body
+// and its content type
+func Render(body []byte, format string) ([]byte, string, error) {
+	if format == FormatVerboseJSON {
+		return body, "application/json", nil
+	}
+	v, err := Parse(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case "", FormatJSON:
+		encoded, err := json.Marshal(map[string]string{"text": v.Text})
+		return encoded, "application/json", err
+	case FormatText:
+		return []byte(v.Text + "\n"), "text/plain; charset=utf-8", nil
+	case FormatSRT:
+		var b strings.Builder
+		for i, segment := range v.Segments {
+			fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1,
+				timestamp(segment.Start, ","), timestamp(segment.End, ","), strings.TrimSpace(segment.Text))
+		}
+		return []byte(b.String()), "text/plain; charset=utf-8", nil
+	case FormatVTT:
+		var b strings.Builder
+		b.WriteString("WEBVTT\n\n")
+		for _, segment := range v.Segments {
+			fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+				timestamp(segment.Start, "."), timestamp(segment.End, "."), strings.TrimSpace(segment.Text))
+		}
+		return []byte(b.String()), "text/vtt; charset=utf-8", nil
+	default:
+		return nil, "", fmt.Errorf("unknown response format %q", format)
+	}
+}
+
+// timestamp formats seconds as HH:MM:SS followed by the separator and milliseconds
+func timestamp(seconds float64, separator string) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
@@ -0,0 +1,49 @@
+package transcription
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const verbose = `{"text":"Hello there. General Kenobi.","segments":[
+	{"start":0,"end":1.5,"text":" Hello there.","avg_logprob":-0.1},
+	{"start":1.5,"end":3725.25,"text":" General Kenobi.","avg_logprob":-0.5}]}`
+
+func TestConfidence(t *testing.T) {
+	v, err := Parse([]byte(verbose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := Confidence(v)
+	want := (math.Exp(-0.1)*1.5 + math.Exp(-0.5)*3723.75) / 3725.25
+	if !ok || math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected confidence %f, got %f (%v)", want, got, ok)
+	}
+	if _, ok := Confidence(Verbose{Text: "no segments"}); ok {
+		t.Errorf("Expected no confidence without log probabilities")
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format      string
+		want        string
+		contentType string
+	}{
+		{"", `{"text":"Hello there. General Kenobi."}`, "application/json"},
+		{FormatText, "Hello there. General Kenobi.\n", "text/plain; charset=utf-8"},
+		{FormatSRT, "1\n00:00:00,000 --> 00:00:01,500\nHello there.\n\n2\n00:00:01,500 --> 01:02:05,250\nGeneral Kenobi.\n\n", "text/plain; charset=utf-8"},
+		{FormatVTT, "WEBVTT\n\n00:00:00.000 --> 00:00:01.500\nHello there.\n\n00:00:01.500 --> 01:02:05.250\nGeneral Kenobi.\n\n", "text/vtt; charset=utf-8"},
+		{FormatVerboseJSON, verbose, "application/json"},
+	}
+	for _, tt := range tests {
+		body, contentType, err := Render([]byte(verbose), tt.format)
+		if err != nil || string(body) != tt.want || contentType != tt.contentType {
+			t.Errorf("%q: got %q %q %v", tt.format, body, contentType, err)
+		}
+	}
+	if _, _, err := Render([]byte(verbose), "mp3"); err == nil || !strings.Contains(err.Error(), "mp3") {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package usage aggregates per-key usage from the audit log. Exact reports are
+// for the router's operators; reports shared outside the organization can be
+// privatized with Laplace noise and bucketing so they reveal trends without
+// exposing any single request.
+package usage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+// defaultTokenSensitivity bounds how many tokens one request is assumed to add
+const defaultTokenSensitivity = 4096
+
+// KeyUsage is the usage of one API key
+type KeyUsage struct {
+	KeyID            string `json:"key_id"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	// CostUSD is the estimated cost of the priced requests; privatized
+	// reports leave it out
+	CostUSD float64 `json:"cost_usd,omitempty"`
+	// First and Last are the times of the key's first and last request
+	// counted, which tell apart the sets of requests privatized counts cover
+	First time.Time `json:"-"`
+	Last  time.Time `json:"-"`
+}
+
+// Report is usage per key, ordered by key ID
+type Report struct {
+	Keys []KeyUsage `json:"keys"`
+	// Periods breaks the usage down by calendar day or month, oldest first
+	Periods []Period `json:"periods,omitempty"`
+	// Privatized is set when the counts are noised and bucketed
+	Privatized bool `json:"privatized,omitempty"`
+}
+
+// Calendar periods a report can be broken down by
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Period is usage per key in the day or month starting at Start
+type Period struct {
+	Start time.Time  `json:"start"`
+	Keys  []KeyUsage `json:"keys"`
+}
+
+// Aggregate sums audit entries per key
+func Aggregate(entries []audit.Entry) Report {
+	return Report{Keys: sumKeys(entries)}
+}
+
+// AggregateBy sums audit entries per key, in total and per calendar day or
+// month. Periods begin at midnight in loc, so a team's billing days match its
+// own calendar rather than the server's.
+func AggregateBy(entries []audit.Entry, period string, loc *time.Location) Report {
+	byStart := make(map[time.Time][]audit.Entry)
+	for _, e := range entries {
+		t := e.Time.In(loc)
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if period == PeriodMonth {
+			start = start.AddDate(0, 0, 1-t.Day())
+		}
+		byStart[start] = append(byStart[start], e)
+	}
+
+	report := Aggregate(entries)
+	report.Periods = make([]Period, 0, len(byStart))
+	for start, periodEntries := range byStart {
+		report.Periods = append(report.Periods, Period{Start: start, Keys: sumKeys(periodEntries)})
+	}
+	sort.Slice(report.Periods, func(i, j int) bool { return report.Periods[i].Start.Before(report.Periods[j].Start) })
+	return report
+}
+
+// sumKeys sums entries per key, ordered by key ID
+func sumKeys(entries []audit.Entry) []KeyUsage {
+	byKey := make(map[string]*KeyUsage)
+	for _, e := range entries {
+		u, ok := byKey[e.KeyID]
+		if !ok {
+			u = &KeyUsage{KeyID: e.KeyID}
+			byKey[e.KeyID] = u
+		}
+		u.Requests++
+		u.PromptTokens += int64(e.PromptTokens)
+		u.CompletionTokens += int64(e.CompletionTokens)
+		u.TotalTokens += int64(e.TotalTokens)
+		u.CostUSD += e.CostUSD
+		if u.First.IsZero() || e.Time.Before(u.First) {
+			u.First = e.Time
+		}
+		if e.Time.After(u.Last) {
+			u.Last = e.Time
+		}
+	}
+
+	keys := make([]KeyUsage, 0, len(byKey))
+	for _, u := range byKey {
+		keys = append(keys, *u)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys
+}
+
+// Privatize returns a copy of report for external sharing. Each count gets
+// Laplace noise scaled to what one request can contribute divided by epsilon,
+// then is rounded to the nearest bucket. Zero epsilon or bucket skips that step.
+// The noise is drawn from a keyed hash of cfg.Secret, the period, the key ID,
+// the field and the requests counted, so asking again for the same counts
+// returns the same noise instead of a fresh draw to average away.
+func Privatize(report Report, cfg model.UsageReportConfig) Report {
+	sensitivity := float64(cfg.TokenSensitivity)
+	if sensitivity <= 0 {
+		sensitivity = defaultTokenSensitivity
+	}
+	noisy := func(period string, u KeyUsage, field string, n int64, scale float64) int64 {
+		v := float64(n)
+		if cfg.Epsilon > 0 {
+			seed := fmt.Sprintf("%s\x00%s\x00%s\x00%d\x00%d", period, u.KeyID, field, u.First.UnixNano(), u.Last.UnixNano())
+			v += laplace(uniform(cfg.Secret, seed), scale/cfg.Epsilon)
+		}
+		if cfg.Bucket > 0 {
+			v = math.Round(v/float64(cfg.Bucket)) * float64(cfg.Bucket)
+		}
+		return max(int64(math.Round(v)), 0)
+	}
+
+	privatize := func(period string, keys []KeyUsage) []KeyUsage {
+		out := make([]KeyUsage, len(keys))
+		for i, u := range keys {
+			out[i] = KeyUsage{
+				KeyID:            u.KeyID,
+				Requests:         noisy(period, u, "requests", u.Requests, 1),
+				PromptTokens:     noisy(period, u, "prompt_tokens", u.PromptTokens, sensitivity),
+				CompletionTokens: noisy(period, u, "completion_tokens", u.CompletionTokens, sensitivity),
+			}
+			out[i].TotalTokens = out[i].PromptTokens + out[i].CompletionTokens
+		}
+		return out
+	}
+
+	out := Report{Keys: privatize("", report.Keys), Privatized: true}
+	for _, p := range report.Periods {
+		out.Periods = append(out.Periods, Period{Start: p.Start, Keys: privatize(p.Start.Format(time.RFC3339), p.Keys)})
+	}
+	return out
+}
+
+// uniform returns a number in (0, 1) derived from the keyed hash of seed
+func uniform(secret, seed string) float64 {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(seed))
+	bits := binary.BigEndian.Uint64(mac.Sum(nil)) >> 11
+	return (float64(bits) + 0.5) / (1 << 53)
+}
+
+// laplace maps p, uniform in (0, 1), onto a Laplace distribution centred on zero
+func laplace(p, scale float64) float64 {
+	u := p - 0.5
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
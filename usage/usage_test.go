@@ -0,0 +1,119 @@
+package usage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kcolemangt/llm-router/audit"
+	"github.com/kcolemangt/llm-router/model"
+)
+
+func TestAggregate(t *testing.T) {
+	report := Aggregate([]audit.Entry{
+		{KeyID: "b", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, CostUSD: 0.25},
+		{KeyID: "a", PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+		{KeyID: "b", PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25, CostUSD: 0.5},
+	})
+	want := []KeyUsage{
+		{KeyID: "a", Requests: 1, PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+		{KeyID: "b", Requests: 2, PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40, CostUSD: 0.75},
+	}
+	if len(report.Keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %d", len(want), len(report.Keys))
+	}
+	for i := range want {
+		if report.Keys[i] != want[i] {
+			t.Errorf("Key %d: got %+v, want %+v", i, report.Keys[i], want[i])
+		}
+	}
+}
+
+func TestAggregateByPeriod(t *testing.T) {
+	// 23:30 UTC on the last day of the month is already the next month in Berlin
+	berlin := time.FixedZone("CET", 60*60)
+	entries := []audit.Entry{
+		{KeyID: "a", Time: time.Date(2024, 1, 31, 22, 30, 0, 0, time.UTC), TotalTokens: 1},
+		{KeyID: "a", Time: time.Date(2024, 1, 31, 23, 30, 0, 0, time.UTC), TotalTokens: 2},
+		{KeyID: "b", Time: time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC), TotalTokens: 4},
+	}
+
+	days := AggregateBy(entries, PeriodDay, berlin)
+	if len(days.Periods) != 3 || len(days.Keys) != 2 {
+		t.Fatalf("Expected 3 days and 2 keys, got %+v", days)
+	}
+	if !days.Periods[1].Start.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, berlin)) || days.Periods[1].Keys[0].TotalTokens != 2 {
+		t.Errorf("Unexpected second day %+v", days.Periods[1])
+	}
+
+	months := AggregateBy(entries, PeriodMonth, berlin)
+	if len(months.Periods) != 2 || months.Periods[0].Keys[0].TotalTokens != 1 || len(months.Periods[1].Keys) != 2 {
+		t.Errorf("Unexpected months %+v", months.Periods)
+	}
+	if utc := AggregateBy(entries, PeriodMonth, time.UTC); len(utc.Periods) != 2 || utc.Periods[0].Keys[0].TotalTokens != 3 {
+		t.Errorf("Unexpected months in UTC %+v", utc.Periods)
+	}
+
+	private := Privatize(months, model.UsageReportConfig{Bucket: 10})
+	if len(private.Periods) != 2 || private.Periods[1].Keys[1].TotalTokens != 0 {
+		t.Errorf("Expected periods to be privatized, got %+v", private.Periods)
+	}
+}
+
+func TestPrivatizeBuckets(t *testing.T) {
+	exact := Report{Keys: []KeyUsage{{KeyID: "a", Requests: 7, PromptTokens: 1260, CompletionTokens: 40}}}
+	report := Privatize(exact, model.UsageReportConfig{Bucket: 100})
+	got := report.Keys[0]
+	if got.Requests != 0 || got.PromptTokens != 1300 || got.CompletionTokens != 0 || got.TotalTokens != 1300 || !report.Privatized {
+		t.Errorf("Unexpected bucketed report %+v", report)
+	}
+	if exact.Keys[0].PromptTokens != 1260 {
+		t.Errorf("Expected the exact report to be left unchanged")
+	}
+}
+
+func TestPrivatizeNoise(t *testing.T) {
+	cfg := model.UsageReportConfig{Epsilon: 0.5, Secret: "s3cret"}
+
+	var sum, changed float64
+	const runs = 2000
+	for i := 0; i < runs; i++ {
+		exact := Report{Keys: []KeyUsage{{KeyID: fmt.Sprint(i), Requests: 1000, PromptTokens: 500000}}}
+		got := Privatize(exact, cfg).Keys[0]
+		sum += float64(got.Requests)
+		if got.Requests != 1000 {
+			changed++
+		}
+		if got.Requests < 0 || got.PromptTokens < 0 {
+			t.Fatalf("Expected non-negative counts, got %+v", got)
+		}
+	}
+	// Laplace noise with scale 2 averages out but rarely leaves a count as is
+	if mean := sum / runs; math.Abs(mean-1000) > 0.5 {
+		t.Errorf("Expected noise to average out, mean %f", mean)
+	}
+	if changed < runs/2 {
+		t.Errorf("Expected most counts to be noised, %v of %d changed", changed, runs)
+	}
+}
+
+func TestPrivatizeRepeatsItsNoise(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	counts := func(last time.Time) Report {
+		return Report{Keys: []KeyUsage{{KeyID: "a", Requests: 1000, PromptTokens: 1000000, First: start, Last: last}}}
+	}
+	cfg := model.UsageReportConfig{Epsilon: 0.1, Secret: "s3cret"}
+
+	first := Privatize(counts(start.Add(time.Hour)), cfg).Keys[0]
+	if again := Privatize(counts(start.Add(time.Hour)), cfg).Keys[0]; again != first {
+		t.Errorf("Expected the same noise for the same requests, got %+v and %+v", first, again)
+	}
+	if other := Privatize(counts(start.Add(2*time.Hour)), cfg).Keys[0]; other.PromptTokens == first.PromptTokens {
+		t.Errorf("Expected other requests to draw other noise, got %+v twice", first)
+	}
+	cfg.Secret = "other"
+	if other := Privatize(counts(start.Add(time.Hour)), cfg).Keys[0]; other.PromptTokens == first.PromptTokens {
+		t.Errorf("Expected another secret to draw other noise, got %+v twice", first)
+	}
+}
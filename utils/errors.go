@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is a routing failure with a fixed HTTP status and OpenAI error code.
+// Errors created from the same sentinel compare equal with errors.Is.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// Sentinel errors raised by the routing pipeline. Clients can branch on their codes.
+var (
+	ErrInvalidAPIKey      = &Error{http.StatusUnauthorized, "invalid_api_key", "Invalid or missing API key"}
+	ErrInvalidRequest     = &Error{http.StatusBadRequest, "invalid_request", "Invalid request"}
+	ErrContextLength      = &Error{http.StatusBadRequest, "context_length_exceeded", "The request does not fit the model's context window"}
+	ErrContentPolicy      = &Error{http.StatusBadRequest, "content_policy_violation", "The request was rejected by the content policy"}
+	ErrCapability         = &Error{http.StatusBadRequest, "unsupported_capability", "The model does not support a feature the request uses"}
+	ErrModelDenied        = &Error{http.StatusForbidden, "model_denied", "Model is not allowed"}
+	ErrPermissionDenied   = &Error{http.StatusForbidden, "permission_denied", "The API key is not permitted to do this"}
+	ErrAddressDenied      = &Error{http.StatusForbidden, "address_denied", "Requests from this address are not allowed"}
+	ErrNotFound           = &Error{http.StatusNotFound, "not_found", "Not found"}
+	ErrModelNotFound      = &Error{http.StatusNotFound, "model_not_found", "Model not found"}
+	ErrUnsupported        = &Error{http.StatusNotFound, "unsupported_endpoint", "Endpoint is not supported"}
+	ErrModelPulling       = &Error{http.StatusTooEarly, "model_pulling", "The model is being pulled, try again later"}
+	ErrQuotaExceeded      = &Error{http.StatusTooManyRequests, "quota_exceeded", "Quota exceeded"}
+	ErrLockedOut          = &Error{http.StatusTooManyRequests, "locked_out", "Too many failed authentication attempts, try again later"}
+	ErrBackendSaturated   = &Error{http.StatusTooManyRequests, "backend_at_capacity", "Backend is at capacity, try again later"}
+	ErrRateLimited        = &Error{http.StatusTooManyRequests, "rate_limited", "The backend's rate limit is exhausted, try again later"}
+	ErrNoBackend          = &Error{http.StatusBadGateway, "no_backend", "No suitable backend found"}
+	ErrBackendUnavailable = &Error{http.StatusBadGateway, "backend_unavailable", "Backend is unavailable"}
+	ErrBackendUnhealthy   = &Error{http.StatusServiceUnavailable, "backend_unhealthy", "Backend is unhealthy"}
+	ErrHookFailed         = &Error{http.StatusBadGateway, "hook_failed", "External hook failed"}
+	ErrInternal           = &Error{http.StatusInternalServerError, "internal_error", "Internal error"}
+)
+
+// NewError returns an error with the status and code of sentinel and a more specific message
+func NewError(sentinel *Error, format string, args ...interface{}) *Error {
+	return &Error{Status: sentinel.Status, Code: sentinel.Code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is an Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// APIError is the body of an OpenAI-compatible error response
+type APIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    string  `json:"code,omitempty"`
+}
+
+// errorEnvelope wraps an APIError the way OpenAI does: {"error": {...}}
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+// ErrorType returns the OpenAI error type corresponding to an HTTP status code
+func ErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// WriteErr writes err as an OpenAI-compatible JSON error response. Errors that
+// are not an *Error are reported as internal errors.
+func WriteErr(w http.ResponseWriter, err error) {
+	var routerErr *Error
+	if !errors.As(err, &routerErr) {
+		routerErr = NewError(ErrInternal, "%s", err)
+	}
+	WriteError(w, routerErr.Status, routerErr.Message, routerErr.Code)
+}
+
+// WriteError writes an OpenAI-compatible JSON error response so clients like
+// Cursor can show the message instead of a generic failure
+func WriteError(w http.ResponseWriter, status int, message, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorEnvelope{Error: APIError{
+		Message: message,
+		Type:    ErrorType(status),
+		Code:    code,
+	}})
+}
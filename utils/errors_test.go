@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSentinelErrorMapping(t *testing.T) {
+	tests := []struct {
+		err      error
+		status   int
+		code     string
+		errType  string
+		sentinel *Error
+	}{
+		{NewError(ErrNoBackend, "No suitable backend found for model %s", "x/y"), http.StatusBadGateway, "no_backend", "server_error", ErrNoBackend},
+		{ErrModelDenied, http.StatusForbidden, "model_denied", "permission_error", ErrModelDenied},
+		{fmt.Errorf("wrapped: %w", ErrQuotaExceeded), http.StatusTooManyRequests, "quota_exceeded", "rate_limit_error", ErrQuotaExceeded},
+		{ErrBackendUnhealthy, http.StatusServiceUnavailable, "backend_unhealthy", "server_error", ErrBackendUnhealthy},
+		{ErrInvalidAPIKey, http.StatusUnauthorized, "invalid_api_key", "authentication_error", ErrInvalidAPIKey},
+		{errors.New("boom"), http.StatusInternalServerError, "internal_error", "server_error", ErrInternal},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		WriteErr(rec, tt.err)
+
+		if rec.Code != tt.status {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.status, rec.Code)
+		}
+		var body errorEnvelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%v: invalid JSON body %q", tt.err, rec.Body.String())
+		}
+		if body.Error.Code != tt.code || body.Error.Type != tt.errType {
+			t.Errorf("%v: expected %s/%s, got %s/%s", tt.err, tt.code, tt.errType, body.Error.Code, body.Error.Type)
+		}
+		if tt.sentinel != ErrInternal && !errors.Is(tt.err, tt.sentinel) {
+			t.Errorf("%v: expected errors.Is to match sentinel %s", tt.err, tt.sentinel.Code)
+		}
+	}
+}
+
+func TestNewErrorKeepsMessage(t *testing.T) {
+	err := NewError(ErrNoBackend, "No suitable backend found for model %s", "ollama/phi3")
+	if err.Error() != "No suitable backend found for model ollama/phi3" {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+	if errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected errors with different codes not to match")
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// CanonicalJSON re-encodes a JSON document with sorted object keys and no
+// insignificant whitespace so that equivalent payloads produce identical bytes.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := UnmarshalJSON(data, &v); err != nil {
+		return nil, err
+	}
+	// encoding/json sorts map keys when marshalling
+	return json.Marshal(v)
+}
+
+// RequestHash returns the hex-encoded SHA-256 of the canonical form of a JSON request body.
+func RequestHash(body []byte) (string, error) {
+	canonical, err := CanonicalJSON(body)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
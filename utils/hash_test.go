@@ -0,0 +1,38 @@
+package utils
+
+import "testing"
+
+func TestRequestHashIgnoresKeyOrderAndWhitespace(t *testing.T) {
+	a := []byte(`{"model":"ollama/llama3","messages":[{"role":"user","content":"hi"}],"temperature":0.5}`)
+	b := []byte(`{
+		"temperature": 0.5,
+		"messages": [{"content": "hi", "role": "user"}],
+		"model": "ollama/llama3"
+	}`)
+
+	hashA, err := RequestHash(a)
+	if err != nil {
+		t.Fatalf("Failed to hash request: %s", err)
+	}
+	hashB, err := RequestHash(b)
+	if err != nil {
+		t.Fatalf("Failed to hash request: %s", err)
+	}
+	if hashA != hashB {
+		t.Errorf("Expected equal hashes, got %s and %s", hashA, hashB)
+	}
+}
+
+func TestRequestHashDiffersOnContent(t *testing.T) {
+	hashA, _ := RequestHash([]byte(`{"model":"a"}`))
+	hashB, _ := RequestHash([]byte(`{"model":"b"}`))
+	if hashA == hashB {
+		t.Errorf("Expected different hashes for different requests")
+	}
+}
+
+func TestRequestHashInvalidJSON(t *testing.T) {
+	if _, err := RequestHash([]byte(`{"model":`)); err == nil {
+		t.Errorf("Expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// UnmarshalJSON works like json.Unmarshal but decodes numbers as json.Number, so
+// values such as large integer seeds are re-encoded exactly as the client sent them
+func UnmarshalJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level JSON value")
+	}
+	return nil
+}
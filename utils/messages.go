@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// Messages returns the conversation of a chat completions request, or the input
+// items of a responses request, where a plain string input counts as one user message
+func Messages(chatReq map[string]interface{}) []interface{} {
+	if messages, ok := chatReq["messages"].([]interface{}); ok {
+		return messages
+	}
+	switch input := chatReq["input"].(type) {
+	case []interface{}:
+		return input
+	case string:
+		return []interface{}{map[string]interface{}{"role": "user", "content": input}}
+	}
+	return nil
+}
+
+// MessageStats counts the messages in a chat request and the characters of text they contain
+func MessageStats(chatReq map[string]interface{}) (int, int) {
+	messages := Messages(chatReq)
+	chars := 0
+	for _, m := range messages {
+		chars += len(MessageText(m))
+	}
+	return len(messages), chars
+}
+
+// MessageText returns the text of a chat message, joining the text parts of multipart content
+func MessageText(m interface{}) string {
+	message, _ := m.(map[string]interface{})
+	switch content := message["content"].(type) {
+	case string:
+		return content
+	case []interface{}:
+		var texts []string
+		for _, p := range content {
+			part, _ := p.(map[string]interface{})
+			// Chat completions parts are "text", responses parts are "input_text"
+			if text, ok := part["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// LastUserText returns the text of the most recent user message
+func LastUserText(chatReq map[string]interface{}) string {
+	messages := Messages(chatReq)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if message, _ := messages[i].(map[string]interface{}); message["role"] == "user" {
+			return MessageText(message)
+		}
+	}
+	return ""
+}
+
+// EstimateTokens returns a rough token count for a number of characters of text
+func EstimateTokens(chars int) int {
+	return (chars + 3) / 4
+}
+
+// MaxOutputTokens returns the output limit a chat request sets with
+// max_completion_tokens, max_tokens or max_output_tokens, or 0 if it sets none
+func MaxOutputTokens(chatReq map[string]interface{}) int {
+	for _, param := range []string{"max_completion_tokens", "max_tokens", "max_output_tokens"} {
+		var limit float64
+		switch v := chatReq[param].(type) {
+		case float64:
+			limit = v
+		case json.Number:
+			limit, _ = v.Float64()
+		}
+		if limit > 0 {
+			return int(limit)
+		}
+	}
+	return 0
+}
+
+// KeyID returns a stable, non-reversible identifier for an Authorization header
+// value, suitable for logs and routing decisions
+func KeyID(auth string) string {
+	if auth == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(auth, "Bearer ")))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
+
+// scriptLanguages maps Unicode scripts to the language most commonly written in them
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+}
+
+// latinStopwords are frequent short words that distinguish common Latin-script languages
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "is", "to", "of", "what", "how", "this", "with"},
+	"es": {"el", "la", "los", "que", "es", "por", "para", "con", "una"},
+	"fr": {"le", "les", "est", "et", "des", "une", "pour", "avec", "que"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "wie"},
+	"pt": {"o", "os", "que", "não", "uma", "para", "com", "é", "do"},
+	"it": {"il", "che", "è", "per", "una", "con", "non", "sono", "della"},
+}
+
+// DetectLanguage makes a cheap guess at the language of text, returning an
+// ISO 639-1 code or "und" when undetermined. Non-Latin scripts are identified by
+// script; Latin text is scored against a handful of common stopwords.
+func DetectLanguage(text string) string {
+	for _, r := range text {
+		for _, sl := range scriptLanguages {
+			if unicode.Is(sl.script, r) {
+				// Kana anywhere means Japanese even when Han characters come first
+				if sl.language == "zh" && strings.IndexFunc(text, func(r rune) bool {
+					return unicode.In(r, unicode.Hiragana, unicode.Katakana)
+				}) >= 0 {
+					return "ja"
+				}
+				return sl.language
+			}
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	best, bestScore := "und", 0
+	for _, language := range []string{"en", "es", "fr", "de", "pt", "it"} {
+		score := 0
+		for _, word := range words {
+			for _, stopword := range latinStopwords[language] {
+				if word == stopword {
+					score++
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = language, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,72 @@
+package utils
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"How do I reverse a list in Python and what is the complexity?":    "en",
+		"¿Cómo puedo ordenar una lista por fecha para el informe?":         "es",
+		"Wie kann ich das Problem mit der Datei lösen und ist das sicher?": "de",
+		"如何在Python中反转列表":                                                   "zh",
+		"Pythonでリストを逆にする方法":                                                "ja",
+		"Как развернуть список?":                                           "ru",
+		"x = 1": "und",
+	}
+	for text, want := range tests {
+		if got := DetectLanguage(text); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestKeyIDIsStableAndRedacted(t *testing.T) {
+	id := KeyID("Bearer sk-secret")
+	if id != KeyID("sk-secret") {
+		t.Errorf("Expected Bearer prefix to be ignored")
+	}
+	if id == "" || id == "sk-secret" || len(id) != len("key-")+8 {
+		t.Errorf("Unexpected key ID %q", id)
+	}
+	if KeyID("") != "" {
+		t.Errorf("Expected empty key ID for missing key")
+	}
+}
+
+func TestMessageStats(t *testing.T) {
+	chatReq := map[string]interface{}{
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": "abc"},
+			map[string]interface{}{"role": "user", "content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "de"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:"}},
+			}},
+		},
+	}
+	messages, chars := MessageStats(chatReq)
+	if messages != 2 || chars != 5 {
+		t.Errorf("Expected 2 messages and 5 chars, got %d and %d", messages, chars)
+	}
+	if LastUserText(chatReq) != "de" {
+		t.Errorf("Unexpected last user text %q", LastUserText(chatReq))
+	}
+}
+
+func TestMaxOutputTokens(t *testing.T) {
+	var decoded map[string]interface{}
+	UnmarshalJSON([]byte(`{"max_tokens":512}`), &decoded)
+	tests := []struct {
+		chatReq map[string]interface{}
+		want    int
+	}{
+		{decoded, 512},
+		{map[string]interface{}{"max_completion_tokens": 100.0, "max_tokens": 50.0}, 100},
+		{map[string]interface{}{"max_output_tokens": 64.0}, 64},
+		{map[string]interface{}{"max_tokens": "many"}, 0},
+		{map[string]interface{}{}, 0},
+	}
+	for _, tt := range tests {
+		if got := MaxOutputTokens(tt.chatReq); got != tt.want {
+			t.Errorf("MaxOutputTokens(%v) = %d, want %d", tt.chatReq, got, tt.want)
+		}
+	}
+}
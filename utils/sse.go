@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SSEEvent is one server-sent event
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry int
+}
+
+// SSEReader reassembles server-sent events from a stream, regardless of how
+// the bytes are split across reads
+type SSEReader struct {
+	scanner *bufio.Scanner
+}
+
+// maxSSELine bounds a single line so a misbehaving backend cannot exhaust memory
+const maxSSELine = 4 << 20
+
+// NewSSEReader returns a reader of the events in r
+func NewSSEReader(r io.Reader) *SSEReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxSSELine)
+	scanner.Split(scanSSELines)
+	return &SSEReader{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF when the stream ends. Comment lines
+// are skipped and a trailing event without a blank line is still returned.
+func (s *SSEReader) Next() (SSEEvent, error) {
+	var event SSEEvent
+	var data []string
+	seen := false
+
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			if seen {
+				event.Data = strings.Join(data, "\n")
+				return event, nil
+			}
+			continue
+		}
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := sseField(line)
+		switch string(field) {
+		case "data":
+			data = append(data, string(value))
+		case "event":
+			event.Event = string(value)
+		case "id":
+			event.ID = string(value)
+		case "retry":
+			if retry, err := strconv.Atoi(string(value)); err == nil {
+				event.Retry = retry
+			}
+		default:
+			continue
+		}
+		seen = true
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return SSEEvent{}, err
+	}
+	if seen {
+		event.Data = strings.Join(data, "\n")
+		return event, nil
+	}
+	return SSEEvent{}, io.EOF
+}
+
+// SSEData returns the value of a data line of an event stream, read the way
+// SSEReader reads it, and whether line is one. The line may end in its line
+// ending.
+func SSEData(line []byte) ([]byte, bool) {
+	field, value := sseField(line)
+	if string(field) != "data" {
+		return nil, false
+	}
+	return value, true
+}
+
+// sseField splits a line of an event stream into its field name and value,
+// dropping the line ending and the space that may follow the colon
+func sseField(line []byte) (field, value []byte) {
+	line = bytes.TrimRight(line, "\r\n")
+	field, value, _ = bytes.Cut(line, []byte(":"))
+	return field, bytes.TrimPrefix(value, []byte(" "))
+}
+
+// scanSSELines splits on \n, \r\n or a lone \r, as the SSE specification requires
+func scanSSELines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if !atEOF {
+				// Need more data to know whether \n follows
+				return 0, nil, nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func readAllEvents(t *testing.T, r io.Reader) []SSEEvent {
+	reader := NewSSEReader(r)
+	var events []SSEEvent
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestSSEReaderReassemblesEvents(t *testing.T) {
+	stream := ": keep-alive\r\n\r\n" +
+		"event: response.created\r\nid: 1\r\ndata: {\"a\":\r\ndata: 1}\r\n\r\n" +
+		"data: [DONE]"
+
+	// One byte at a time exercises every split point
+	events := readAllEvents(t, iotest.OneByteReader(strings.NewReader(stream)))
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %+v", len(events), events)
+	}
+	if events[0].Event != "response.created" || events[0].ID != "1" || events[0].Data != "{\"a\":\n1}" {
+		t.Errorf("Unexpected first event %+v", events[0])
+	}
+	if events[1].Data != "[DONE]" {
+		t.Errorf("Expected trailing event without blank line, got %+v", events[1])
+	}
+}
+
+func TestSSEData(t *testing.T) {
+	tests := []struct {
+		line string
+		data string
+		ok   bool
+	}{
+		{"data: {\"a\":1}\n", `{"a":1}`, true},
+		{"data:[DONE]\r\n", "[DONE]", true},
+		{"data:  two spaces", " two spaces", true},
+		{"data", "", true},
+		{"event: data", "", false},
+		{": data: comment", "", false},
+	}
+	for _, tt := range tests {
+		data, ok := SSEData([]byte(tt.line))
+		if ok != tt.ok || string(data) != tt.data {
+			t.Errorf("%q: got %q %v, want %q %v", tt.line, data, ok, tt.data, tt.ok)
+		}
+	}
+}
+
+func FuzzSSEReader(f *testing.F) {
+	f.Add([]byte("data: {\"choices\":[]}\n\ndata: [DONE]\n\n"))
+	f.Add([]byte("event: x\r\nid: 7\r\nretry: 100\r\ndata: a\r\ndata: b\r\n\r\n"))
+	f.Add([]byte(":comment\rdata\r\r"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		whole := readAllEvents(t, strings.NewReader(string(data)))
+		split := readAllEvents(t, iotest.OneByteReader(strings.NewReader(string(data))))
+		if len(whole) != len(split) {
+			t.Fatalf("Event count depends on read boundaries: %d vs %d", len(whole), len(split))
+		}
+		for i := range whole {
+			if whole[i] != split[i] {
+				t.Fatalf("Event %d depends on read boundaries: %+v vs %+v", i, whole[i], split[i])
+			}
+		}
+	})
+}
+
+func BenchmarkSSEReader(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		sb.WriteString("data: {\"choices\":[{\"delta\":{\"content\":\"token \"}}]}\n\n")
+	}
+	stream := sb.String()
+
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader := NewSSEReader(strings.NewReader(stream))
+		for {
+			if _, err := reader.Next(); err != nil {
+				break
+			}
+		}
+	}
+}
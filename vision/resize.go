@@ -0,0 +1,102 @@
+//go:build !novision && !minimal
+
+package vision
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+
+	// Register decoders for the formats clients commonly send
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Available reports whether image resizing is built in
+const Available = true
+
+// ResizeDataURL downscales a base64 data URL image so that its longest side is at
+// most maxDimension, re-encoding it as JPEG. Remote URLs and images that already
+// fit are returned unchanged; images of more than MaxPixels pixels are refused
+// with ErrTooLarge.
+func ResizeDataURL(url string, maxDimension int) (string, bool, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return url, false, nil
+	}
+	comma := strings.IndexByte(url, ',')
+	if comma < 0 || !strings.HasSuffix(url[:comma], ";base64") {
+		return url, false, fmt.Errorf("unsupported image data URL")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(url[comma+1:])
+	if err != nil {
+		return url, false, fmt.Errorf("invalid base64 image: %w", err)
+	}
+	// Check the size the header claims before decoding a single pixel
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return url, false, fmt.Errorf("unsupported image: %w", err)
+	}
+	width, height := config.Width, config.Height
+	if width <= maxDimension && height <= maxDimension {
+		return url, false, nil
+	}
+	if int64(width)*int64(height) > MaxPixels {
+		return url, false, fmt.Errorf("%w: %dx%d", ErrTooLarge, width, height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return url, false, fmt.Errorf("unsupported image: %w", err)
+	}
+	if width >= height {
+		height = max(1, height*maxDimension/width)
+		width = maxDimension
+	} else {
+		width = max(1, width*maxDimension/height)
+		height = maxDimension
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(src, width, height), &jpeg.Options{Quality: 85}); err != nil {
+		return url, false, err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), true, nil
+}
+
+// downscale shrinks src to width x height by averaging each destination pixel's
+// source box, flattening transparency onto white since JPEG has no alpha
+func downscale(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, src, bounds.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := flat.PixOffset(bounds.Min.X+sx, bounds.Min.Y+sy)
+					r += uint32(flat.Pix[i])
+					g += uint32(flat.Pix[i+1])
+					b += uint32(flat.Pix[i+2])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 255})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,20 @@
+//go:build novision || minimal
+
+package vision
+
+import (
+	"errors"
+	"strings"
+)
+
+// Available reports whether image resizing is built in
+const Available = false
+
+// ResizeDataURL fails in builds without the image codecs; remote URLs are
+// still passed through unchanged
+func ResizeDataURL(url string, maxDimension int) (string, bool, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return url, false, nil
+	}
+	return url, false, errors.New("image resizing is not built in")
+}
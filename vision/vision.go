@@ -0,0 +1,146 @@
+// Package vision adapts image content in chat requests to what a backend can
+// handle: downscaling large inline images or removing them for text-only models.
+package vision
+
+import (
+	"errors"
+	"strings"
+)
+
+// Image handling modes for a backend
+const (
+	ModePassthrough = "passthrough"
+	ModeResize      = "resize"
+	ModeStrip       = "strip"
+)
+
+// DefaultMaxDimension is the longest side images are resized to when no limit is configured
+const DefaultMaxDimension = 1024
+
+// MaxPixels bounds the images resized. A small compressed image can describe
+// a huge one, so larger images are removed rather than decoded.
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned for images of more than MaxPixels pixels
+var ErrTooLarge = errors.New("image is too large to resize")
+
+// Result summarizes the changes made to a request. Oversized counts the
+// images removed for having more than MaxPixels pixels.
+type Result struct {
+	Resized   int
+	Stripped  int
+	Oversized int
+}
+
+// Adapt applies mode to every image part in the messages of chatReq, or in the
+// input of a responses request
+func Adapt(chatReq map[string]interface{}, mode string, maxDimension int) (Result, error) {
+	var result Result
+	if mode == "" || mode == ModePassthrough {
+		return result, nil
+	}
+	if maxDimension <= 0 {
+		maxDimension = DefaultMaxDimension
+	}
+
+	for _, m := range messagesOf(chatReq) {
+		message, _ := m.(map[string]interface{})
+		parts, ok := message["content"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		kept := parts[:0]
+		stripped := 0
+		for _, p := range parts {
+			part, _ := p.(map[string]interface{})
+			url, setURL, ok := imageOf(part)
+			if !ok {
+				kept = append(kept, p)
+				continue
+			}
+
+			switch mode {
+			case ModeStrip:
+				stripped++
+				continue
+			case ModeResize:
+				resized, changed, err := ResizeDataURL(url, maxDimension)
+				if errors.Is(err, ErrTooLarge) {
+					result.Oversized++
+					continue
+				}
+				if err != nil {
+					return result, err
+				}
+				if changed {
+					setURL(resized)
+					result.Resized++
+				}
+			}
+			kept = append(kept, p)
+		}
+
+		if len(kept) < len(parts) {
+			message["content"] = collapseText(kept)
+			result.Stripped += stripped
+		}
+	}
+	return result, nil
+}
+
+// HasImages reports whether any message of chatReq has an image part
+func HasImages(chatReq map[string]interface{}) bool {
+	for _, m := range messagesOf(chatReq) {
+		message, _ := m.(map[string]interface{})
+		parts, _ := message["content"].([]interface{})
+		for _, p := range parts {
+			part, _ := p.(map[string]interface{})
+			if _, _, ok := imageOf(part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// messagesOf returns the messages of a chat completions request, or the input
+// items of a responses request
+func messagesOf(chatReq map[string]interface{}) []interface{} {
+	if messages, ok := chatReq["messages"].([]interface{}); ok {
+		return messages
+	}
+	input, _ := chatReq["input"].([]interface{})
+	return input
+}
+
+// imageOf returns the URL of an image part and a function replacing it. Chat
+// completions nest the URL in an image_url object; the responses API sets it
+// on input_image parts directly.
+func imageOf(part map[string]interface{}) (string, func(string), bool) {
+	switch part["type"] {
+	case "image_url":
+		imageURL, _ := part["image_url"].(map[string]interface{})
+		url, _ := imageURL["url"].(string)
+		return url, func(resized string) { imageURL["url"] = resized }, true
+	case "input_image":
+		url, _ := part["image_url"].(string)
+		return url, func(resized string) { part["image_url"] = resized }, true
+	}
+	return "", nil, false
+}
+
+// collapseText turns content made only of text parts back into a plain string,
+// which text-only backends handle most reliably
+func collapseText(parts []interface{}) interface{} {
+	var texts []string
+	for _, p := range parts {
+		part, _ := p.(map[string]interface{})
+		text, ok := part["text"].(string)
+		if part["type"] != "text" || !ok {
+			return parts
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n")
+}
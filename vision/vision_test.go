@@ -0,0 +1,130 @@
+//go:build !novision && !minimal
+
+package vision
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func pngDataURL(width, height int) string {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func chatWithImage(url string) map[string]interface{} {
+	return map[string]interface{}{
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "What is this?"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}},
+			}},
+		},
+	}
+}
+
+func TestResizeLargeImage(t *testing.T) {
+	chatReq := chatWithImage(pngDataURL(800, 400))
+	result, err := Adapt(chatReq, ModeResize, 200)
+	if err != nil || result.Resized != 1 {
+		t.Fatalf("Expected one resized image, got %+v (%v)", result, err)
+	}
+
+	parts := chatReq["messages"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})
+	url := parts[1].(map[string]interface{})["image_url"].(map[string]interface{})["url"].(string)
+	if !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+		t.Fatalf("Expected JPEG data URL, got %.40s", url)
+	}
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(url, "data:image/jpeg;base64,"))
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode resized image: %s", err)
+	}
+	if config.Width != 200 || config.Height != 100 {
+		t.Errorf("Expected 200x100, got %dx%d", config.Width, config.Height)
+	}
+}
+
+func TestResizeKeepsSmallAndRemoteImages(t *testing.T) {
+	for _, url := range []string{pngDataURL(100, 50), "https://example.com/cat.png"} {
+		chatReq := chatWithImage(url)
+		result, err := Adapt(chatReq, ModeResize, 200)
+		if err != nil || result.Resized != 0 {
+			t.Errorf("Expected %.40s to be left alone, got %+v (%v)", url, result, err)
+		}
+	}
+}
+
+func TestStripImages(t *testing.T) {
+	chatReq := chatWithImage("https://example.com/cat.png")
+	result, err := Adapt(chatReq, ModeStrip, 0)
+	if err != nil || result.Stripped != 1 {
+		t.Fatalf("Expected one stripped image, got %+v (%v)", result, err)
+	}
+	content := chatReq["messages"].([]interface{})[0].(map[string]interface{})["content"]
+	if content != "What is this?" {
+		t.Errorf("Expected content collapsed to text, got %v", content)
+	}
+}
+
+func TestResizeInvalidImage(t *testing.T) {
+	if _, err := Adapt(chatWithImage("data:image/png;base64,!!!"), ModeResize, 200); err == nil {
+		t.Errorf("Expected an error for invalid base64")
+	}
+}
+
+func TestResizeRemovesImagesAboveThePixelCap(t *testing.T) {
+	// A PNG header is enough to claim a size; the pixels are never decoded
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 50000)
+	binary.BigEndian.PutUint32(data[20:], 50000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	bomb := "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+
+	chatReq := chatWithImage(bomb)
+	result, err := Adapt(chatReq, ModeResize, 200)
+	if err != nil || result.Oversized != 1 {
+		t.Fatalf("Expected the oversized image removed, got %+v (%v)", result, err)
+	}
+	if content := chatReq["messages"].([]interface{})[0].(map[string]interface{})["content"]; content != "What is this?" {
+		t.Errorf("Expected only the text left, got %v", content)
+	}
+}
+
+func TestResizeResponsesInputImages(t *testing.T) {
+	request := map[string]interface{}{
+		"input": []interface{}{
+			map[string]interface{}{"role": "user", "content": []interface{}{
+				map[string]interface{}{"type": "input_text", "text": "What is this?"},
+				map[string]interface{}{"type": "input_image", "image_url": pngDataURL(800, 400)},
+			}},
+		},
+	}
+	if !HasImages(request) {
+		t.Error("Expected the input image to be found")
+	}
+	result, err := Adapt(request, ModeResize, 200)
+	if err != nil || result.Resized != 1 {
+		t.Fatalf("Expected one resized image, got %+v (%v)", result, err)
+	}
+	parts := request["input"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})
+	if url := parts[1].(map[string]interface{})["image_url"].(string); !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+		t.Errorf("Expected a JPEG data URL, got %.40s", url)
+	}
+}